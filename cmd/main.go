@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"log"
@@ -35,69 +36,324 @@ import (
 //	@name						Authorization
 
 func main() {
-	log.Println("Loading environment variables...")
-	config.LoadEnv()
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		os.Exit(runConfigCommand(os.Args[2:]))
+	}
+
+	log.Println("Loading configuration...")
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	pkg.ConfigureJWT(cfg.JWT.Secret, cfg.JWT.TTL)
+	pkg.ConfigurePasswordHasher(cfg.Password)
+	passwordPolicy, err := pkg.NewPasswordPolicy(cfg.Password)
+	if err != nil {
+		log.Fatalf("Failed to load password policy: %v", err)
+	}
 
 	log.Println("Connecting to MongoDB...")
-	cfg, err := config.ConnectToMongo()
+	mongoConn, err := config.ConnectToMongo(cfg.Mongo)
 	if err != nil {
 		log.Fatalf("Failed to connect to MongoDB: %v", err)
 	}
 	defer func() {
 		log.Println("Closing MongoDB connection...")
-		cfg.CloseMongo()
+		mongoConn.CloseMongo()
 	}()
 
 	log.Println("Initializing repositories...")
-	repository := pkg.NewRepository(cfg.Database)
+	repository := pkg.NewRepository(mongoConn.Database)
 
 	log.Println("Initializing cache...")
-	cacheInstance := cache.NewCache(5 * time.Minute)
+	cacheInstance := cache.NewCache(cfg.Cache.TTL)
 
 	log.Println("Initializing services...")
 	userService := pkg.NewUserService(repository.UserRepositoryInterface, cacheInstance)
 	postService := pkg.NewPostService(repository.PostRepositoryInterface, cacheInstance)
+	postService.Slugs = repository.SlugRepositoryInterface
+	if err := postService.BackfillSlugs(); err != nil {
+		log.Printf("Failed to backfill post slugs: %v", err)
+	}
 	commentService := pkg.NewCommentService(repository.CommentRepositoryInterface, userService, cacheInstance)
+	lockoutService := pkg.NewLockoutService(repository.LoginAttemptRepositoryInterface, cfg.Lockout)
+	sessionService := pkg.NewSessionService(repository.SessionRepositoryInterface)
+
+	log.Println("Initializing mailer...")
+	mailer, err := pkg.NewMailer(cfg.Mail)
+	if err != nil {
+		log.Fatalf("Failed to initialize mailer: %v", err)
+	}
+	passwordResetService := pkg.NewPasswordResetService(repository.TokenRepositoryInterface, userService, sessionService, mailer, cfg.Server.PublicURL, cfg.Auth.PasswordResetTTL)
+	passwordResetService.Policy = passwordPolicy
+	emailVerificationService := pkg.NewEmailVerificationService(repository.TokenRepositoryInterface, userService, mailer, cfg.Server.PublicURL, cfg.Auth.EmailVerificationTTL)
+	emailVerificationService.SessionService = sessionService
+	magicLinkService := pkg.NewMagicLinkService(repository.TokenRepositoryInterface, userService, mailer, cfg.Server.PublicURL, cfg.Auth.MagicLinkTTL, cfg.Auth.MagicLinkBindIP, cfg.Auth.MagicLinkBindDevice)
+	oidcService := pkg.NewOIDCService(repository.TokenRepositoryInterface, userService, cfg.OIDC.Providers, cfg.Server.PublicURL)
+	accessTokenService := pkg.NewAccessTokenService(repository.AccessTokenRepositoryInterface, userService)
+	webAuthnService, err := pkg.NewWebAuthnService(cfg.WebAuthn, cfg.Server.PublicURL, repository.TokenRepositoryInterface, userService)
+	if err != nil {
+		log.Fatalf("Failed to initialize WebAuthn: %v", err)
+	}
+	auditService := pkg.NewAuditService(repository.AuditRepositoryInterface)
+	blobStore, err := pkg.NewBlobStore(cfg.Media)
+	if err != nil {
+		log.Fatalf("Failed to initialize media storage: %v", err)
+	}
+	mediaService := pkg.NewMediaService(repository.MediaRepositoryInterface, blobStore, cfg.Media, cfg.Server.PublicURL)
+	mediaService.Users = userService
+	postService.Media = mediaService
+	if err := mediaService.ResumeProcessing(); err != nil {
+		log.Printf("Failed to resume media processing: %v", err)
+	}
+	postService.Reactions = repository.ReactionRepositoryInterface
+	commentService.Reactions = repository.ReactionRepositoryInterface
+	reactionService := pkg.NewReactionService(repository.ReactionRepositoryInterface, postService, commentService, cfg.Reactions)
+	accountService := pkg.NewAccountService(userService, postService, commentService, sessionService, passwordPolicy, cfg.Account)
+	accountService.Reactions = reactionService
+	postService.Bookmarks = repository.BookmarkRepositoryInterface
+	bookmarkService := pkg.NewBookmarkService(repository.BookmarkRepositoryInterface, repository.ReadingListRepositoryInterface, postService, cfg.Server.PublicURL)
+	accountService.Bookmarks = bookmarkService
+	feedService := pkg.NewFeedService(repository.FollowRepositoryInterface, postService, userService, cfg.Feed)
+	postService.Feed = feedService
+	accountService.Feed = feedService
+	notificationService := pkg.NewNotificationService(repository.NotificationRepositoryInterface, userService, postService, commentService, cfg.Notifications)
+	postService.Notifications = notificationService
+	commentService.Notifications = notificationService
+	reactionService.Notifications = notificationService
+	accountService.Notifications = notificationService
+	var eventBroker pkg.EventBroker = pkg.NewMemoryEventBroker()
+	if cfg.Events.Broker == "mongo" {
+		eventBroker = pkg.NewMongoEventBroker(mongoConn.Database, "events", cfg.Events.CappedSize)
+	}
+	eventBus := pkg.NewEventBus(eventBroker, cfg.Events)
+	postService.Events = eventBus
+	commentService.Events = eventBus
+	reactionService.Events = eventBus
+	notificationService.Events = eventBus
+	sessionService.Events = eventBus
+	feedService.Listen(eventBus)
+	streamService := pkg.NewStreamService(eventBus, postService, userService, repository.TokenRepositoryInterface, sessionService, cfg.Events)
+	exportService := pkg.NewExportService(repository.ExportRepositoryInterface, mailer, cfg.Export, cfg.Server.PublicURL,
+		pkg.ProfileExportSection(),
+		pkg.PostsExportSection(postService),
+		pkg.CommentsExportSection(commentService),
+		pkg.SessionsExportSection(sessionService),
+		pkg.AccessTokensExportSection(accessTokenService),
+		pkg.AuditExportSection(auditService),
+		pkg.MediaExportSection(mediaService),
+		pkg.ReactionsExportSection(reactionService),
+		pkg.BookmarksExportSection(bookmarkService),
+		pkg.FollowsExportSection(feedService),
+		pkg.NotificationsExportSection(notificationService),
+	)
+	adminService := pkg.NewAdminService(userService, sessionService, passwordResetService)
+	adminService.Notifications = notificationService
+	mfaService := pkg.NewMFAService(userService, repository.SettingsRepositoryInterface, cfg.Auth.MFAIssuer, cfg.Auth.MFAChallengeTTL, cfg.Auth.MFARequiredRoles)
+	confirmationService := pkg.NewConfirmationService(repository.TokenRepositoryInterface, mfaService, webAuthnService, mailer, cfg.Server.PublicURL)
+	emailVerificationService.Confirmations = confirmationService
+	accountService.Confirmations = confirmationService
+
+	log.Println("Initializing rate limiter...")
+	var rateLimitStore pkg.RateLimitStore = pkg.NewMemoryRateLimitStore()
+	if cfg.RateLimit.Store == "mongo" {
+		rateLimitStore = pkg.NewMongoRateLimitStore(mongoConn.Database.Collection("rate_limits"))
+	}
+	limiter := pkg.NewRateLimiter(rateLimitStore, cfg.RateLimit)
+	magicLinkService.Limiter = limiter
 
 	log.Println("Initializing handlers...")
 	handler := pkg.NewHandler(postService, commentService, userService)
+	handler.LockoutService = lockoutService
+	handler.SessionService = sessionService
+	handler.PasswordResetService = passwordResetService
+	handler.EmailVerificationService = emailVerificationService
+	handler.MFAService = mfaService
+	handler.ConfirmationService = confirmationService
+	handler.AccessTokenService = accessTokenService
+	handler.OIDCService = oidcService
+	handler.MagicLinkService = magicLinkService
+	handler.WebAuthnService = webAuthnService
+	handler.AccountService = accountService
+	handler.ExportService = exportService
+	handler.AdminService = adminService
+	handler.MediaService = mediaService
+	handler.ReactionService = reactionService
+	handler.BookmarkService = bookmarkService
+	handler.FeedService = feedService
+	handler.NotificationService = notificationService
+	handler.StreamService = streamService
+	handler.AuditService = auditService
+	handler.PasswordPolicy = passwordPolicy
+	requireVerifiedEmail := pkg.VerifiedEmailMiddleware(userService, cfg.Auth.RequireVerifiedEmail)
+	noImpersonation := pkg.DenyImpersonationMiddleware()
 
 	log.Println("Setting up router...")
 	router := gin.Default()
+	// Client IPs key rate limits, lockouts and magic link bindings, so
+	// X-Forwarded-For is only believed from our own proxies.
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatalf("Invalid trusted proxies: %v", err)
+	}
+	router.Use(pkg.RequestIDMiddleware())
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 	{
-		router.POST("/auth/register", handler.Register)
-		router.POST("/auth/login", handler.Login)
-		router.GET("/auth/users", handler.GetUsers) //.Use(pkg.OwnerOrAdminMiddleware(postService))
+		router.POST("/auth/register", limiter.Middleware("register"), handler.Register)
+		router.POST("/auth/login", limiter.Middleware("login"), handler.Login)
+		router.POST("/auth/mfa/verify", limiter.Middleware("mfa"), handler.VerifyMFA)
+		router.POST("/auth/mfa/webauthn/begin", limiter.Middleware("mfa"), handler.BeginWebAuthnMFA)
+		router.POST("/auth/mfa/webauthn/finish", limiter.Middleware("mfa"), handler.FinishWebAuthnMFA)
+		router.POST("/auth/password/forgot", limiter.Middleware("password_reset"), handler.ForgotPassword)
+		router.POST("/auth/password/reset", limiter.Middleware("password_reset"), handler.ResetPassword)
+		router.POST("/auth/verify-email", handler.VerifyEmail)
+		router.POST("/auth/email/revert", handler.RevertEmail)
+		router.POST("/auth/magic-link", limiter.Middleware("magic_link"), handler.RequestMagicLink)
+		router.GET("/auth/magic-link/consume", limiter.Middleware("login"), handler.ConsumeMagicLink)
+		router.GET("/auth/oidc/:provider/start", limiter.Middleware("login"), handler.StartOIDCLogin)
+		router.GET("/auth/oidc/:provider/callback", handler.OIDCCallback)
+		router.POST("/auth/webauthn/login/begin", limiter.Middleware("login"), handler.BeginWebAuthnLogin)
+		router.POST("/auth/webauthn/login/finish", limiter.Middleware("login"), handler.FinishWebAuthnLogin)
+		router.GET("/exports/:token", handler.DownloadExport)
+		router.GET("/media/:id", handler.ServeMedia)
+		router.GET("/media/:id/:variant", handler.ServeMediaVariant)
+		router.GET("/highlight.css", handler.HighlightCSS)
+		router.GET("/reading-lists/:token", handler.GetSharedReadingList)
+		router.GET("/auth/users", pkg.JWTMiddleware(sessionService, nil), mfaService.EnforcementMiddleware(), pkg.AdminMiddleware(), handler.GetUsers)
+		router.GET("/api/stream", pkg.StreamAuthMiddleware(streamService, pkg.JWTMiddleware(sessionService, accessTokenService)), mfaService.EnforcementMiddleware(), handler.Stream)
 	}
-	api := router.Group("/api").Use(pkg.JWTMiddleware())
+	api := router.Group("/api").Use(pkg.JWTMiddleware(sessionService, accessTokenService), mfaService.EnforcementMiddleware())
 	{
 		{
-			api.POST("/posts", handler.CreatePost)
+			api.POST("/posts", requireVerifiedEmail, handler.CreatePost)
 			api.GET("/posts", handler.GetPosts)
 			api.GET("/posts/:id", handler.GetPostById)
 			api.PATCH("/posts/:id", pkg.OwnerOrAdminMiddleware(postService), handler.UpdatePost)
 			api.DELETE("/posts/:id", pkg.OwnerOrAdminMiddleware(postService), handler.DeletePost)
 		}
 		{
-			api.POST("/posts/:id/comments", handler.AddComment)
+			api.POST("/posts/:id/comments", limiter.Middleware("comments"), requireVerifiedEmail, handler.AddComment)
 			api.GET("/posts/:id/comments", handler.GetComments)
 			api.GET("/posts/comments/", handler.GetAllComment)
 			api.DELETE("/posts/comments/:commentID", pkg.OwnerOrAdminMiddleware(postService), handler.DeleteComment)
 			api.PATCH("/posts/comments/:commentID", pkg.OwnerOrAdminMiddleware(postService), handler.UpdateComment)
 		}
+		{
+			api.GET("/reactions", handler.GetReactionTypes)
+			api.PUT("/posts/:id/reactions/:type", limiter.Middleware("reactions"), handler.ReactToPost)
+			api.DELETE("/posts/:id/reactions/:type", limiter.Middleware("reactions"), handler.RemovePostReaction)
+			api.PUT("/posts/comments/:commentID/reactions/:type", limiter.Middleware("reactions"), handler.ReactToComment)
+			api.DELETE("/posts/comments/:commentID/reactions/:type", limiter.Middleware("reactions"), handler.RemoveCommentReaction)
+		}
+		{
+			api.GET("/me/bookmarks", handler.GetBookmarks)
+			api.POST("/me/bookmarks", handler.AddBookmark)
+			api.PATCH("/me/bookmarks/:id", handler.UpdateBookmark)
+			api.DELETE("/me/bookmarks/:id", handler.DeleteBookmark)
+			api.GET("/me/reading-lists", handler.GetReadingLists)
+			api.POST("/me/reading-lists", handler.CreateReadingList)
+			api.PATCH("/me/reading-lists/:id", handler.UpdateReadingList)
+			api.DELETE("/me/reading-lists/:id", handler.DeleteReadingList)
+		}
+		{
+			api.GET("/feed", handler.GetFeed)
+			api.GET("/me/follows", handler.GetFollows)
+			api.PUT("/me/follows/authors/:username", handler.FollowAuthor)
+			api.DELETE("/me/follows/authors/:username", handler.UnfollowAuthor)
+			api.PUT("/me/follows/tags/:tag", handler.FollowTag)
+			api.DELETE("/me/follows/tags/:tag", handler.UnfollowTag)
+		}
+		{
+			api.GET("/notifications", handler.GetNotifications)
+			api.GET("/notifications/unread-count", handler.GetUnreadNotificationCount)
+			api.POST("/notifications/read-all", handler.MarkAllNotificationsRead)
+			api.POST("/notifications/:id/read", handler.MarkNotificationRead)
+			api.GET("/me/notification-preferences", handler.GetNotificationPreferences)
+			api.PUT("/me/notification-preferences", handler.UpdateNotificationPreferences)
+			api.POST("/stream/tickets", handler.CreateStreamTicket)
+		}
+		{
+			api.POST("/media", limiter.Middleware("uploads"), requireVerifiedEmail, handler.UploadMedia)
+			api.GET("/media", handler.GetMedia)
+			api.GET("/media/:id", handler.GetMediaByID)
+		}
+		{
+			api.GET("/me", handler.GetMe)
+			api.PATCH("/me", noImpersonation, handler.UpdateMe)
+			api.DELETE("/me", noImpersonation, handler.DeleteMe)
+			api.POST("/me/password", noImpersonation, handler.ChangePassword)
+			api.POST("/me/export", noImpersonation, limiter.Middleware("exports"), handler.StartExport)
+			api.GET("/me/exports", handler.GetExports)
+			api.PUT("/me/email", noImpersonation, handler.ChangeEmail)
+			api.POST("/me/confirm/email", noImpersonation, limiter.Middleware("verification_email"), handler.SendConfirmationLink)
+			api.POST("/me/confirm/webauthn/begin", noImpersonation, handler.BeginPasskeyConfirmation)
+			api.POST("/me/confirm/webauthn/finish", noImpersonation, limiter.Middleware("mfa"), handler.FinishPasskeyConfirmation)
+			api.POST("/me/verify-email/resend", limiter.Middleware("verification_email"), handler.ResendVerificationEmail)
+		}
+		{
+			api.POST("/me/mfa/totp/enroll", noImpersonation, handler.EnrollTOTP)
+			api.POST("/me/mfa/totp/confirm", noImpersonation, handler.ConfirmTOTP)
+			api.DELETE("/me/mfa/totp", noImpersonation, handler.DisableTOTP)
+			api.POST("/me/mfa/recovery-codes", noImpersonation, handler.RegenerateRecoveryCodes)
+		}
+		{
+			api.POST("/me/webauthn/register/begin", noImpersonation, handler.BeginWebAuthnRegistration)
+			api.POST("/me/webauthn/register/finish", noImpersonation, handler.FinishWebAuthnRegistration)
+			api.GET("/me/webauthn/credentials", handler.GetWebAuthnCredentials)
+			api.PATCH("/me/webauthn/credentials/:id", noImpersonation, handler.RenameWebAuthnCredential)
+			api.DELETE("/me/webauthn/credentials/:id", noImpersonation, handler.DeleteWebAuthnCredential)
+		}
+		{
+			api.POST("/me/tokens", noImpersonation, handler.CreateAccessToken)
+			api.GET("/me/tokens", handler.GetAccessTokens)
+			api.DELETE("/me/tokens/:id", noImpersonation, handler.RevokeAccessToken)
+		}
+		{
+			api.GET("/admin/lockouts", pkg.AdminMiddleware(), handler.GetLockouts)
+			api.DELETE("/admin/lockouts/users/:username", pkg.AdminMiddleware(), handler.UnlockAccount)
+			api.DELETE("/admin/lockouts/ips/:ip", pkg.AdminMiddleware(), handler.UnlockIP)
+			api.GET("/admin/mfa/policy", pkg.AdminMiddleware(), handler.GetMFAPolicy)
+			api.PUT("/admin/mfa/policy", pkg.AdminMiddleware(), handler.UpdateMFAPolicy)
+		}
+		{
+			api.GET("/admin/users", pkg.AdminMiddleware(), handler.SearchUsers)
+			api.GET("/admin/users/:id", pkg.AdminMiddleware(), handler.GetUserDetails)
+			api.PUT("/admin/users/:id/role", pkg.AdminMiddleware(), handler.SetUserRole)
+			api.POST("/admin/users/:id/suspend", pkg.AdminMiddleware(), handler.SuspendUser)
+			api.POST("/admin/users/:id/ban", pkg.AdminMiddleware(), handler.BanUser)
+			api.DELETE("/admin/users/:id/restriction", pkg.AdminMiddleware(), handler.LiftUserRestriction)
+			api.POST("/admin/users/:id/password-reset", pkg.AdminMiddleware(), handler.ForceUserPasswordReset)
+			api.DELETE("/admin/users/:id/sessions", pkg.AdminMiddleware(), handler.RevokeUserSessions)
+			api.POST("/admin/users/:id/impersonate", pkg.AdminMiddleware(), handler.ImpersonateUser)
+		}
+		{
+			api.GET("/admin/audit", pkg.AdminMiddleware(), handler.GetAuditEvents)
+			api.GET("/admin/audit/verify", pkg.AdminMiddleware(), handler.VerifyAuditLog)
+		}
 	}
 
 	srv := &http.Server{
-		Addr:              ":8080",
+		Addr:              cfg.Server.Addr,
 		Handler:           router,
-		ReadTimeout:       10 * time.Second,
-		WriteTimeout:      10 * time.Second,
-		IdleTimeout:       120 * time.Second,
-		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
 	}
+	// Open streams would otherwise hold up the shutdown until it times out.
+	srv.RegisterOnShutdown(eventBus.Close)
+
+	go func() {
+		for range time.Tick(time.Hour) {
+			if err := exportService.PurgeExpired(time.Now()); err != nil {
+				log.Printf("Failed to purge expired exports: %v", err)
+			}
+			if err := mediaService.PurgeOrphans(time.Now()); err != nil {
+				log.Printf("Failed to purge unused media: %v", err)
+			}
+		}
+	}()
 
-	log.Println("Starting server on :8080...")
+	log.Printf("Starting server on %s...", cfg.Server.Addr)
 	go func() {
 		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Fatalf("Server listen error: %s\n", err)
@@ -109,11 +365,32 @@ func main() {
 	<-quit
 	log.Println("Received shutdown signal, shutting down server...")
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
 	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
+	exportService.Wait()
+	mediaService.Wait()
 
 	log.Println("Server exiting")
 }
+
+// runConfigCommand implements "config print", which shows the effective
+// configuration with secrets redacted.
+func runConfigCommand(args []string) int {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintln(os.Stderr, "usage: blog-backend config print [flags]")
+		return 2
+	}
+	cfg, err := config.Load(args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid configuration:\n%v\n", err)
+		return 1
+	}
+	if err := cfg.Print(os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to print configuration: %v\n", err)
+		return 1
+	}
+	return 0
+}
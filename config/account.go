@@ -0,0 +1,47 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// ContentAnonymize keeps a deleted user's content but removes the link
+	// to the account.
+	ContentAnonymize = "anonymize"
+	// ContentDelete removes a deleted user's content.
+	ContentDelete = "delete"
+)
+
+// AccountConfig controls self-service account management, in particular
+// what happens to a user's posts and comments when they delete their
+// account.
+type AccountConfig struct {
+	DeletedPosts    string `yaml:"deleted_posts"`
+	DeletedComments string `yaml:"deleted_comments"`
+	// DeletedUsername replaces the author name on anonymized comments.
+	DeletedUsername string `yaml:"deleted_username"`
+}
+
+func defaultAccount() AccountConfig {
+	return AccountConfig{
+		DeletedPosts:    ContentAnonymize,
+		DeletedComments: ContentAnonymize,
+		DeletedUsername: "[deleted]",
+	}
+}
+
+func (c AccountConfig) validate() []error {
+	var errs []error
+	policy := func(name, value string) {
+		if value != ContentAnonymize && value != ContentDelete {
+			errs = append(errs, fmt.Errorf("%s must be %q or %q", name, ContentAnonymize, ContentDelete))
+		}
+	}
+	policy("account.deleted_posts", c.DeletedPosts)
+	policy("account.deleted_comments", c.DeletedComments)
+	if c.DeletedUsername == "" {
+		errs = append(errs, errors.New("account.deleted_username is required"))
+	}
+	return errs
+}
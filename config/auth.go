@@ -0,0 +1,60 @@
+package config
+
+import (
+	"errors"
+	"time"
+)
+
+// AuthConfig holds settings for the account flows built on top of
+// password login.
+type AuthConfig struct {
+	PasswordResetTTL     time.Duration `yaml:"password_reset_ttl"`
+	EmailVerificationTTL time.Duration `yaml:"email_verification_ttl"`
+	// RequireVerifiedEmail blocks creating posts and comments until the
+	// user has confirmed their email address.
+	RequireVerifiedEmail bool `yaml:"require_verified_email"`
+
+	MFAIssuer       string        `yaml:"mfa_issuer"`
+	MFAChallengeTTL time.Duration `yaml:"mfa_challenge_ttl"`
+	// MFARequiredRoles lists roles that must use two-factor login. Admins
+	// can change the list at runtime; this is the initial value.
+	MFARequiredRoles []string `yaml:"mfa_required_roles"`
+
+	MagicLinkTTL time.Duration `yaml:"magic_link_ttl"`
+	// MagicLinkBindIP only accepts a magic link from the IP address that
+	// requested it.
+	MagicLinkBindIP bool `yaml:"magic_link_bind_ip"`
+	// MagicLinkBindDevice only accepts a magic link in the browser that
+	// requested it, identified by a cookie set on request.
+	MagicLinkBindDevice bool `yaml:"magic_link_bind_device"`
+}
+
+func defaultAuth() AuthConfig {
+	return AuthConfig{
+		PasswordResetTTL:     time.Hour,
+		EmailVerificationTTL: 24 * time.Hour,
+		MFAIssuer:            "Blog",
+		MFAChallengeTTL:      5 * time.Minute,
+		MagicLinkTTL:         15 * time.Minute,
+	}
+}
+
+func (c AuthConfig) validate() []error {
+	var errs []error
+	if c.PasswordResetTTL <= 0 {
+		errs = append(errs, errors.New("auth.password_reset_ttl must be positive"))
+	}
+	if c.EmailVerificationTTL <= 0 {
+		errs = append(errs, errors.New("auth.email_verification_ttl must be positive"))
+	}
+	if c.MFAIssuer == "" {
+		errs = append(errs, errors.New("auth.mfa_issuer is required"))
+	}
+	if c.MFAChallengeTTL <= 0 {
+		errs = append(errs, errors.New("auth.mfa_challenge_ttl must be positive"))
+	}
+	if c.MagicLinkTTL <= 0 {
+		errs = append(errs, errors.New("auth.magic_link_ttl must be positive"))
+	}
+	return errs
+}
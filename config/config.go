@@ -1,94 +1,526 @@
 package config
 
 import (
-	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net"
+	"net/url"
 	"os"
-	"sync"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
-
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
 )
 
-var (
-	once      sync.Once
-	uri       string
-	dbName    string
-	jwtSecret string
-)
+const redacted = "********"
 
+// Config is the complete application configuration. Values are resolved in
+// the following order, later sources overriding earlier ones: built-in
+// defaults, the config file, environment variables, command-line flags.
 type Config struct {
-	MongoClient *mongo.Client
-	Database    *mongo.Database
+	Server ServerConfig `yaml:"server"`
+	Mongo  MongoConfig  `yaml:"mongo"`
+	JWT    JWTConfig    `yaml:"jwt"`
+	Cache  CacheConfig  `yaml:"cache"`
+
+	RateLimit     RateLimitConfig     `yaml:"rate_limit"`
+	Lockout       LockoutConfig       `yaml:"lockout"`
+	Mail          MailConfig          `yaml:"mail"`
+	Auth          AuthConfig          `yaml:"auth"`
+	OIDC          OIDCConfig          `yaml:"oidc"`
+	WebAuthn      WebAuthnConfig      `yaml:"webauthn"`
+	Password      PasswordConfig      `yaml:"password"`
+	Account       AccountConfig       `yaml:"account"`
+	Export        ExportConfig        `yaml:"export"`
+	Media         MediaConfig         `yaml:"media"`
+	Reactions     ReactionsConfig     `yaml:"reactions"`
+	Feed          FeedConfig          `yaml:"feed"`
+	Notifications NotificationsConfig `yaml:"notifications"`
+	Events        EventsConfig        `yaml:"events"`
 }
 
-func LoadEnv() {
-	err := godotenv.Load()
-	if err != nil {
-		log.Printf("Warning: .env file not found: %v", err)
-	}
-	mongoUser := os.Getenv("MONGO_USER")
-	mongoPass := os.Getenv("MONGO_PASSWORD")
-	dbName = os.Getenv("MONGO_DATABASE")
-	jwtSecret = os.Getenv("JWT_SECRET")
+type ServerConfig struct {
+	Addr string `yaml:"addr"`
+	// PublicURL is the externally reachable base URL used in links sent
+	// to users, e.g. in password reset mails.
+	PublicURL         string        `yaml:"public_url"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout"`
+	// TrustedProxies lists the addresses or CIDR ranges of the proxies in
+	// front of the server. Only they are believed about the client's
+	// address in X-Forwarded-For; by default no one is.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+}
 
-	if mongoUser == "" || mongoPass == "" || dbName == "" || jwtSecret == "" {
-		log.Fatal("MONGO_USER, MONGO_PASSWORD, MONGO_DATABASE and JWT_SECRET are required")
-	}
+type MongoConfig struct {
+	// URI, when set, is used as-is and takes precedence over the
+	// individual connection fields below.
+	URI            string        `yaml:"uri"`
+	Host           string        `yaml:"host"`
+	Port           int           `yaml:"port"`
+	User           string        `yaml:"user"`
+	Password       string        `yaml:"password"`
+	Database       string        `yaml:"database"`
+	AuthSource     string        `yaml:"auth_source"`
+	ConnectTimeout time.Duration `yaml:"connect_timeout"`
+}
+
+type JWTConfig struct {
+	Secret string        `yaml:"secret"`
+	TTL    time.Duration `yaml:"ttl"`
+}
+
+type CacheConfig struct {
+	TTL time.Duration `yaml:"ttl"`
+}
 
+func Default() Config {
 	host := "localhost"
 	if os.Getenv("DOCKER_CONTAINER") == "true" {
 		host = "mongo"
 	}
-
-	uri = fmt.Sprintf("mongodb://%s:%s@%s:27017/%s?authSource=admin",
-		mongoUser,
-		mongoPass,
-		host,
-		dbName,
-	)
+	return Config{
+		Server: ServerConfig{
+			Addr:              ":8080",
+			PublicURL:         "http://localhost:8080",
+			ReadTimeout:       10 * time.Second,
+			WriteTimeout:      10 * time.Second,
+			IdleTimeout:       120 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			ShutdownTimeout:   5 * time.Second,
+		},
+		Mongo: MongoConfig{
+			Host:           host,
+			Port:           27017,
+			AuthSource:     "admin",
+			ConnectTimeout: 10 * time.Second,
+		},
+		JWT: JWTConfig{
+			TTL: 12 * time.Hour,
+		},
+		Cache: CacheConfig{
+			TTL: 5 * time.Minute,
+		},
+		RateLimit:     defaultRateLimit(),
+		Lockout:       defaultLockout(),
+		Mail:          defaultMail(),
+		Auth:          defaultAuth(),
+		WebAuthn:      defaultWebAuthn(),
+		Password:      defaultPassword(),
+		Account:       defaultAccount(),
+		Export:        defaultExport(),
+		Media:         defaultMedia(),
+		Reactions:     defaultReactions(),
+		Feed:          defaultFeed(),
+		Notifications: defaultNotifications(),
+		Events:        defaultEvents(),
+	}
 }
 
-func ConnectToMongo() (*Config, error) {
-	LoadEnv()
-	fmt.Printf("!!!Connect to monga: uri: %s\n", uri)
-	clientOptions := options.Client().ApplyURI(uri)
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+// Load builds the configuration from all sources and validates it. args are
+// the command-line arguments without the program name.
+func Load(args []string) (*Config, error) {
+	if err := godotenv.Load(); err != nil {
+		log.Printf("Warning: .env file not found: %v", err)
+	}
 
-	client, err := mongo.Connect(ctx, clientOptions)
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	cfg := Default()
+	fs, flags := newFlagSet(&cfg)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	flags.capture(fs)
+
+	path := *flags.configFile
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path != "" {
+		if err := loadFile(path, &cfg); err != nil {
+			return nil, err
+		}
+	}
+	if err := applyEnv(&cfg, os.Getenv); err != nil {
+		return nil, err
+	}
+	if err := flags.apply(fs); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
 	}
+	return &cfg, nil
+}
 
-	err = client.Ping(ctx, nil)
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to ping MongoDB: %w", err)
+		return fmt.Errorf("failed to read config file: %w", err)
 	}
+	return decodeFile(filepath.Ext(path), data, cfg)
+}
 
-	database := client.Database(dbName)
-	return &Config{
-		MongoClient: client,
-		Database:    database,
-	}, nil
+func decodeFile(ext string, data []byte, cfg *Config) error {
+	switch strings.ToLower(ext) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return fmt.Errorf("failed to parse YAML config: %w", err)
+		}
+	case ".toml":
+		// TOML has no duration type, so decode generically and feed the
+		// result through the YAML decoder, which understands "10s" style
+		// durations and shares the same field tags.
+		var raw map[string]interface{}
+		if err := toml.Unmarshal(data, &raw); err != nil {
+			return fmt.Errorf("failed to parse TOML config: %w", err)
+		}
+		intermediate, err := yaml.Marshal(raw)
+		if err != nil {
+			return fmt.Errorf("failed to parse TOML config: %w", err)
+		}
+		if err := yaml.Unmarshal(intermediate, cfg); err != nil {
+			return fmt.Errorf("failed to parse TOML config: %w", err)
+		}
+	default:
+		return fmt.Errorf("unsupported config file extension %q", ext)
+	}
+	return nil
 }
 
-func (c *Config) CloseMongo() {
-	if c.MongoClient != nil {
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
+func applyEnv(cfg *Config, getenv func(string) string) error {
+	var errs []error
+	str := func(key string, dst *string) {
+		if v := getenv(key); v != "" {
+			*dst = v
+		}
+	}
+	dur := func(key string, dst *time.Duration) {
+		if v := getenv(key); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				return
+			}
+			*dst = d
+		}
+	}
+	boolean := func(key string, dst *bool) {
+		if v := getenv(key); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				return
+			}
+			*dst = b
+		}
+	}
+	num := func(key string, dst *int) {
+		if v := getenv(key); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				return
+			}
+			*dst = n
+		}
+	}
+	num64 := func(key string, dst *int64) {
+		if v := getenv(key); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+				return
+			}
+			*dst = n
+		}
+	}
+
+	str("SERVER_ADDR", &cfg.Server.Addr)
+	str("PUBLIC_URL", &cfg.Server.PublicURL)
+	if port := getenv("PORT"); port != "" && getenv("SERVER_ADDR") == "" {
+		cfg.Server.Addr = ":" + port
+	}
+	dur("SERVER_READ_TIMEOUT", &cfg.Server.ReadTimeout)
+	dur("SERVER_WRITE_TIMEOUT", &cfg.Server.WriteTimeout)
+	dur("SERVER_IDLE_TIMEOUT", &cfg.Server.IdleTimeout)
+	dur("SERVER_READ_HEADER_TIMEOUT", &cfg.Server.ReadHeaderTimeout)
+	dur("SERVER_SHUTDOWN_TIMEOUT", &cfg.Server.ShutdownTimeout)
+	if v := getenv("TRUSTED_PROXIES"); v != "" {
+		cfg.Server.TrustedProxies = strings.Split(v, ",")
+	}
+
+	str("MONGO_URI", &cfg.Mongo.URI)
+	str("MONGO_HOST", &cfg.Mongo.Host)
+	num("MONGO_PORT", &cfg.Mongo.Port)
+	str("MONGO_USER", &cfg.Mongo.User)
+	str("MONGO_PASSWORD", &cfg.Mongo.Password)
+	str("MONGO_DATABASE", &cfg.Mongo.Database)
+	str("MONGO_AUTH_SOURCE", &cfg.Mongo.AuthSource)
+	dur("MONGO_CONNECT_TIMEOUT", &cfg.Mongo.ConnectTimeout)
+
+	str("JWT_SECRET", &cfg.JWT.Secret)
+	dur("JWT_TTL", &cfg.JWT.TTL)
+
+	dur("CACHE_TTL", &cfg.Cache.TTL)
+
+	boolean("RATE_LIMIT_ENABLED", &cfg.RateLimit.Enabled)
+	str("RATE_LIMIT_STORE", &cfg.RateLimit.Store)
+
+	boolean("LOCKOUT_ENABLED", &cfg.Lockout.Enabled)
+	num("LOCKOUT_MAX_ACCOUNT_FAILURES", &cfg.Lockout.MaxAccountFailures)
+	num("LOCKOUT_MAX_IP_FAILURES", &cfg.Lockout.MaxIPFailures)
+	dur("LOCKOUT_DURATION", &cfg.Lockout.LockoutDuration)
+
+	str("MAIL_BACKEND", &cfg.Mail.Backend)
+	str("MAIL_FROM", &cfg.Mail.From)
+	str("MAIL_OUTBOX_DIR", &cfg.Mail.OutboxDir)
+	str("SMTP_HOST", &cfg.Mail.SMTP.Host)
+	num("SMTP_PORT", &cfg.Mail.SMTP.Port)
+	str("SMTP_USERNAME", &cfg.Mail.SMTP.Username)
+	str("SMTP_PASSWORD", &cfg.Mail.SMTP.Password)
 
-		if err := c.MongoClient.Disconnect(ctx); err != nil {
-			log.Printf("Error while disconnecting from MongoDB: %v", err)
+	dur("PASSWORD_RESET_TTL", &cfg.Auth.PasswordResetTTL)
+	dur("EMAIL_VERIFICATION_TTL", &cfg.Auth.EmailVerificationTTL)
+	boolean("REQUIRE_VERIFIED_EMAIL", &cfg.Auth.RequireVerifiedEmail)
+	str("MFA_ISSUER", &cfg.Auth.MFAIssuer)
+	dur("MFA_CHALLENGE_TTL", &cfg.Auth.MFAChallengeTTL)
+	if v := getenv("MFA_REQUIRED_ROLES"); v != "" {
+		cfg.Auth.MFARequiredRoles = strings.Split(v, ",")
+	}
+	dur("MAGIC_LINK_TTL", &cfg.Auth.MagicLinkTTL)
+	boolean("MAGIC_LINK_BIND_IP", &cfg.Auth.MagicLinkBindIP)
+	boolean("MAGIC_LINK_BIND_DEVICE", &cfg.Auth.MagicLinkBindDevice)
+	str("WEBAUTHN_RP_ID", &cfg.WebAuthn.RPID)
+	str("WEBAUTHN_RP_DISPLAY_NAME", &cfg.WebAuthn.RPDisplayName)
+	if v := getenv("WEBAUTHN_RP_ORIGINS"); v != "" {
+		cfg.WebAuthn.RPOrigins = strings.Split(v, ",")
+	}
+	str("PASSWORD_HASHER", &cfg.Password.Hasher)
+	num("PASSWORD_BCRYPT_COST", &cfg.Password.BcryptCost)
+	num("PASSWORD_MIN_LENGTH", &cfg.Password.MinLength)
+	num("PASSWORD_MAX_LENGTH", &cfg.Password.MaxLength)
+	str("PASSWORD_BREACHED_LIST", &cfg.Password.BreachedList)
+	str("ACCOUNT_DELETED_POSTS", &cfg.Account.DeletedPosts)
+	str("ACCOUNT_DELETED_COMMENTS", &cfg.Account.DeletedComments)
+	str("EXPORT_DIR", &cfg.Export.Dir)
+	dur("EXPORT_TTL", &cfg.Export.TTL)
+	str("MEDIA_BACKEND", &cfg.Media.Backend)
+	str("MEDIA_DIR", &cfg.Media.Dir)
+	num64("MEDIA_MAX_SIZE", &cfg.Media.MaxSize)
+	num64("MEDIA_USER_QUOTA", &cfg.Media.UserQuota)
+	dur("MEDIA_ORPHAN_TTL", &cfg.Media.OrphanTTL)
+	num("MEDIA_WORKERS", &cfg.Media.Workers)
+	str("S3_ENDPOINT", &cfg.Media.S3.Endpoint)
+	str("S3_REGION", &cfg.Media.S3.Region)
+	str("S3_BUCKET", &cfg.Media.S3.Bucket)
+	str("S3_ACCESS_KEY", &cfg.Media.S3.AccessKey)
+	str("S3_SECRET_KEY", &cfg.Media.S3.SecretKey)
+	// Client secrets of providers declared in the config file can be
+	// supplied as OIDC_<NAME>_CLIENT_SECRET to keep them out of the file.
+	for name, p := range cfg.OIDC.Providers {
+		str("OIDC_"+strings.ToUpper(strings.ReplaceAll(name, "-", "_"))+"_CLIENT_SECRET", &p.ClientSecret)
+		cfg.OIDC.Providers[name] = p
+	}
+
+	return errors.Join(errs...)
+}
+
+type flagValues struct {
+	configFile *string
+	set        map[string]string
+}
+
+func newFlagSet(cfg *Config) (*flag.FlagSet, *flagValues) {
+	fs := flag.NewFlagSet("blog-backend", flag.ContinueOnError)
+	values := &flagValues{
+		configFile: fs.String("config", "", "path to a YAML or TOML config file (env CONFIG_FILE)"),
+	}
+
+	fs.StringVar(&cfg.Server.Addr, "addr", cfg.Server.Addr, "HTTP listen address")
+	fs.DurationVar(&cfg.Server.ReadTimeout, "read-timeout", cfg.Server.ReadTimeout, "HTTP read timeout")
+	fs.DurationVar(&cfg.Server.WriteTimeout, "write-timeout", cfg.Server.WriteTimeout, "HTTP write timeout")
+	fs.DurationVar(&cfg.Server.IdleTimeout, "idle-timeout", cfg.Server.IdleTimeout, "HTTP idle timeout")
+	fs.DurationVar(&cfg.Server.ShutdownTimeout, "shutdown-timeout", cfg.Server.ShutdownTimeout, "graceful shutdown timeout")
+	fs.StringVar(&cfg.Server.PublicURL, "public-url", cfg.Server.PublicURL, "externally reachable base URL used in mailed links")
+	fs.StringVar(&cfg.Mongo.URI, "mongo-uri", cfg.Mongo.URI, "MongoDB connection URI")
+	fs.StringVar(&cfg.Mongo.Host, "mongo-host", cfg.Mongo.Host, "MongoDB host")
+	fs.IntVar(&cfg.Mongo.Port, "mongo-port", cfg.Mongo.Port, "MongoDB port")
+	fs.StringVar(&cfg.Mongo.Database, "mongo-database", cfg.Mongo.Database, "MongoDB database name")
+	fs.DurationVar(&cfg.JWT.TTL, "jwt-ttl", cfg.JWT.TTL, "lifetime of issued JWTs")
+	fs.DurationVar(&cfg.Cache.TTL, "cache-ttl", cfg.Cache.TTL, "in-memory cache TTL")
+	fs.BoolVar(&cfg.RateLimit.Enabled, "rate-limit", cfg.RateLimit.Enabled, "enable request rate limiting")
+	fs.StringVar(&cfg.RateLimit.Store, "rate-limit-store", cfg.RateLimit.Store, "rate limit store: memory or mongo")
+	fs.StringVar(&cfg.Mail.Backend, "mail-backend", cfg.Mail.Backend, "mail backend: smtp, file or memory")
+	fs.StringVar(&cfg.Media.Backend, "media-backend", cfg.Media.Backend, "media storage backend: local or s3")
+	return fs, values
+}
+
+// capture remembers the flags given on the command line, before the file and
+// environment overwrite the fields they are bound to.
+func (v *flagValues) capture(fs *flag.FlagSet) {
+	v.set = map[string]string{}
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name != "config" {
+			v.set[f.Name] = f.Value.String()
+		}
+	})
+}
+
+func (v *flagValues) apply(fs *flag.FlagSet) error {
+	var errs []error
+	for name, value := range v.set {
+		// Setting the flag again writes the value through the bound
+		// pointer into the config, overriding file and environment values.
+		if err := fs.Set(name, value); err != nil {
+			errs = append(errs, err)
 		}
 	}
+	return errors.Join(errs...)
 }
 
-func GetJWTSecret() string {
-	once.Do(LoadEnv)
-	return jwtSecret
+// Validate reports every configuration problem at once rather than stopping
+// at the first one.
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Server.Addr == "" {
+		errs = append(errs, errors.New("server.addr is required"))
+	}
+	if u, err := url.Parse(c.Server.PublicURL); err != nil || u.Scheme == "" || u.Host == "" {
+		errs = append(errs, errors.New("server.public_url must be an absolute URL"))
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			errs = append(errs, fmt.Errorf("server.trusted_proxies: %q is not an IP address or CIDR range", proxy))
+		}
+	}
+	positive := func(name string, d time.Duration) {
+		if d <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive", name))
+		}
+	}
+	positive("server.read_timeout", c.Server.ReadTimeout)
+	positive("server.write_timeout", c.Server.WriteTimeout)
+	positive("server.idle_timeout", c.Server.IdleTimeout)
+	positive("server.read_header_timeout", c.Server.ReadHeaderTimeout)
+	positive("server.shutdown_timeout", c.Server.ShutdownTimeout)
+	positive("mongo.connect_timeout", c.Mongo.ConnectTimeout)
+	positive("jwt.ttl", c.JWT.TTL)
+	positive("cache.ttl", c.Cache.TTL)
+
+	if c.Mongo.URI != "" {
+		if _, err := url.Parse(c.Mongo.URI); err != nil || !strings.HasPrefix(c.Mongo.URI, "mongodb") {
+			errs = append(errs, errors.New("mongo.uri must be a valid mongodb:// or mongodb+srv:// URI"))
+		}
+	} else {
+		if c.Mongo.Host == "" {
+			errs = append(errs, errors.New("mongo.host is required when mongo.uri is not set"))
+		}
+		if c.Mongo.Port <= 0 || c.Mongo.Port > 65535 {
+			errs = append(errs, errors.New("mongo.port must be between 1 and 65535"))
+		}
+		if c.Mongo.User == "" {
+			errs = append(errs, errors.New("mongo.user (MONGO_USER) is required when mongo.uri is not set"))
+		}
+		if c.Mongo.Password == "" {
+			errs = append(errs, errors.New("mongo.password (MONGO_PASSWORD) is required when mongo.uri is not set"))
+		}
+	}
+	if c.Mongo.Database == "" {
+		errs = append(errs, errors.New("mongo.database (MONGO_DATABASE) is required"))
+	}
+	if c.JWT.Secret == "" {
+		errs = append(errs, errors.New("jwt.secret (JWT_SECRET) is required"))
+	}
+	errs = append(errs, c.RateLimit.validate()...)
+	errs = append(errs, c.Lockout.validate()...)
+	errs = append(errs, c.Mail.validate()...)
+	errs = append(errs, c.Auth.validate()...)
+	errs = append(errs, c.OIDC.validate()...)
+	errs = append(errs, c.WebAuthn.validate()...)
+	errs = append(errs, c.Password.validate()...)
+	errs = append(errs, c.Account.validate()...)
+	errs = append(errs, c.Export.validate()...)
+	errs = append(errs, c.Media.validate()...)
+	errs = append(errs, c.Reactions.validate()...)
+	errs = append(errs, c.Feed.validate()...)
+	errs = append(errs, c.Notifications.validate()...)
+	errs = append(errs, c.Events.validate()...)
+	return errors.Join(errs...)
+}
+
+// MongoURI returns the connection URI, building it from the individual
+// fields when no explicit URI was configured.
+func (c MongoConfig) MongoURI() string {
+	if c.URI != "" {
+		return c.URI
+	}
+	u := url.URL{
+		Scheme: "mongodb",
+		User:   url.UserPassword(c.User, c.Password),
+		Host:   fmt.Sprintf("%s:%d", c.Host, c.Port),
+		Path:   "/" + c.Database,
+	}
+	if c.AuthSource != "" {
+		u.RawQuery = url.Values{"authSource": {c.AuthSource}}.Encode()
+	}
+	return u.String()
+}
+
+// Redacted returns a copy of the configuration that is safe to print or log.
+func (c Config) Redacted() Config {
+	if c.Mongo.Password != "" {
+		c.Mongo.Password = redacted
+	}
+	if c.Mongo.URI != "" {
+		c.Mongo.URI = redactURI(c.Mongo.URI)
+	}
+	if c.JWT.Secret != "" {
+		c.JWT.Secret = redacted
+	}
+	if c.Mail.SMTP.Password != "" {
+		c.Mail.SMTP.Password = redacted
+	}
+	if c.Media.S3.SecretKey != "" {
+		c.Media.S3.SecretKey = redacted
+	}
+	if len(c.OIDC.Providers) > 0 {
+		providers := make(map[string]OIDCProvider, len(c.OIDC.Providers))
+		for name, p := range c.OIDC.Providers {
+			if p.ClientSecret != "" {
+				p.ClientSecret = redacted
+			}
+			providers[name] = p
+		}
+		c.OIDC.Providers = providers
+	}
+	return c
+}
+
+func redactURI(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return redacted
+	}
+	return u.Redacted()
+}
+
+// Print writes the redacted configuration as YAML.
+func (c Config) Print(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c.Redacted()); err != nil {
+		return err
+	}
+	return enc.Close()
 }
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// EventsConfig controls real-time updates. Broker is "memory" for a single
+// instance or "mongo" to share events between replicas through a capped
+// collection of CappedSize bytes. Each instance keeps the last History
+// events to replay to clients that reconnect, and queues up to Buffer
+// events per stream before dropping a client that can't keep up.
+type EventsConfig struct {
+	Broker     string `yaml:"broker"`
+	CappedSize int64  `yaml:"capped_size"`
+	History    int    `yaml:"history"`
+	Buffer     int    `yaml:"buffer"`
+	// Heartbeat is how often idle streams are pinged so that proxies
+	// keep them open.
+	Heartbeat         time.Duration `yaml:"heartbeat"`
+	MaxStreamsPerUser int           `yaml:"max_streams_per_user"`
+	MaxPosts          int           `yaml:"max_posts"`
+	// TicketTTL is how long a ticket for opening a stream from a browser,
+	// which can't send the Authorization header, stays valid.
+	TicketTTL time.Duration `yaml:"ticket_ttl"`
+}
+
+func defaultEvents() EventsConfig {
+	return EventsConfig{
+		Broker:            "memory",
+		CappedSize:        16 << 20,
+		History:           1000,
+		Buffer:            64,
+		Heartbeat:         25 * time.Second,
+		MaxStreamsPerUser: 5,
+		MaxPosts:          50,
+		TicketTTL:         time.Minute,
+	}
+}
+
+func (c EventsConfig) validate() []error {
+	var errs []error
+	switch c.Broker {
+	case "memory":
+	case "mongo":
+		if c.CappedSize < 4096 {
+			errs = append(errs, errors.New("events.capped_size must be at least 4096"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("events.broker must be \"memory\" or \"mongo\", got %q", c.Broker))
+	}
+	if c.History < 0 {
+		errs = append(errs, errors.New("events.history must not be negative"))
+	}
+	if c.Buffer < 1 {
+		errs = append(errs, errors.New("events.buffer must be at least 1"))
+	}
+	if c.Heartbeat <= 0 {
+		errs = append(errs, errors.New("events.heartbeat must be positive"))
+	}
+	if c.MaxStreamsPerUser < 1 {
+		errs = append(errs, errors.New("events.max_streams_per_user must be at least 1"))
+	}
+	if c.MaxPosts < 0 {
+		errs = append(errs, errors.New("events.max_posts must not be negative"))
+	}
+	if c.TicketTTL <= 0 {
+		errs = append(errs, errors.New("events.ticket_ttl must be positive"))
+	}
+	return errs
+}
@@ -0,0 +1,31 @@
+package config
+
+import (
+	"errors"
+	"time"
+)
+
+// ExportConfig controls personal data exports. Finished archives are kept
+// in Dir and can be downloaded until TTL has passed.
+type ExportConfig struct {
+	Dir string        `yaml:"dir"`
+	TTL time.Duration `yaml:"ttl"`
+}
+
+func defaultExport() ExportConfig {
+	return ExportConfig{
+		Dir: "exports",
+		TTL: 7 * 24 * time.Hour,
+	}
+}
+
+func (c ExportConfig) validate() []error {
+	var errs []error
+	if c.Dir == "" {
+		errs = append(errs, errors.New("export.dir is required"))
+	}
+	if c.TTL <= 0 {
+		errs = append(errs, errors.New("export.ttl must be positive"))
+	}
+	return errs
+}
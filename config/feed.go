@@ -0,0 +1,51 @@
+package config
+
+import (
+	"errors"
+	"time"
+)
+
+// FeedConfig controls the personalized home feed. Feeds are assembled
+// when they are read. The recent posts of authors with at least
+// FanoutThreshold followers are also kept in memory, CacheSize per author
+// for up to CacheTTL, and new posts are added there as they are written,
+// on every instance that shares the event broker.
+// PageSize is the default number of posts per page and MaxPageSize the
+// most a client may ask for.
+type FeedConfig struct {
+	FanoutThreshold int           `yaml:"fanout_threshold"`
+	CacheSize       int           `yaml:"cache_size"`
+	CacheTTL        time.Duration `yaml:"cache_ttl"`
+	PageSize        int           `yaml:"page_size"`
+	MaxPageSize     int           `yaml:"max_page_size"`
+}
+
+func defaultFeed() FeedConfig {
+	return FeedConfig{
+		FanoutThreshold: 1000,
+		CacheSize:       100,
+		CacheTTL:        10 * time.Minute,
+		PageSize:        20,
+		MaxPageSize:     100,
+	}
+}
+
+func (c FeedConfig) validate() []error {
+	var errs []error
+	if c.FanoutThreshold < 1 {
+		errs = append(errs, errors.New("feed.fanout_threshold must be at least 1"))
+	}
+	if c.CacheSize < 1 {
+		errs = append(errs, errors.New("feed.cache_size must be at least 1"))
+	}
+	if c.CacheTTL <= 0 {
+		errs = append(errs, errors.New("feed.cache_ttl must be positive"))
+	}
+	if c.PageSize < 1 {
+		errs = append(errs, errors.New("feed.page_size must be at least 1"))
+	}
+	if c.MaxPageSize < c.PageSize {
+		errs = append(errs, errors.New("feed.max_page_size must be at least feed.page_size"))
+	}
+	return errs
+}
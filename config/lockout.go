@@ -0,0 +1,56 @@
+package config
+
+import (
+	"errors"
+	"time"
+)
+
+// LockoutConfig controls brute-force protection on login. Every failure
+// doubles the delay before the next attempt is accepted, starting at
+// BaseDelay and capped at MaxDelay. Once an account or IP reaches its
+// failure threshold it is locked for LockoutDuration. Failures older than
+// FailureWindow are forgotten.
+type LockoutConfig struct {
+	Enabled            bool          `yaml:"enabled"`
+	MaxAccountFailures int           `yaml:"max_account_failures"`
+	MaxIPFailures      int           `yaml:"max_ip_failures"`
+	BaseDelay          time.Duration `yaml:"base_delay"`
+	MaxDelay           time.Duration `yaml:"max_delay"`
+	LockoutDuration    time.Duration `yaml:"lockout_duration"`
+	FailureWindow      time.Duration `yaml:"failure_window"`
+}
+
+func defaultLockout() LockoutConfig {
+	return LockoutConfig{
+		Enabled:            true,
+		MaxAccountFailures: 5,
+		MaxIPFailures:      20,
+		BaseDelay:          time.Second,
+		MaxDelay:           time.Minute,
+		LockoutDuration:    15 * time.Minute,
+		FailureWindow:      15 * time.Minute,
+	}
+}
+
+func (c LockoutConfig) validate() []error {
+	if !c.Enabled {
+		return nil
+	}
+	var errs []error
+	if c.MaxAccountFailures <= 0 {
+		errs = append(errs, errors.New("lockout.max_account_failures must be positive"))
+	}
+	if c.MaxIPFailures <= 0 {
+		errs = append(errs, errors.New("lockout.max_ip_failures must be positive"))
+	}
+	if c.BaseDelay < 0 || c.MaxDelay < c.BaseDelay {
+		errs = append(errs, errors.New("lockout.base_delay must not be negative or exceed lockout.max_delay"))
+	}
+	if c.LockoutDuration <= 0 {
+		errs = append(errs, errors.New("lockout.lockout_duration must be positive"))
+	}
+	if c.FailureWindow <= 0 {
+		errs = append(errs, errors.New("lockout.failure_window must be positive"))
+	}
+	return errs
+}
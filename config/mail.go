@@ -0,0 +1,58 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MailConfig selects how outgoing mail is delivered. The "file" and
+// "memory" backends never send anything and are meant for local
+// development and tests.
+type MailConfig struct {
+	Backend   string     `yaml:"backend"`
+	From      string     `yaml:"from"`
+	OutboxDir string     `yaml:"outbox_dir"`
+	SMTP      SMTPConfig `yaml:"smtp"`
+}
+
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+func defaultMail() MailConfig {
+	return MailConfig{
+		Backend:   "file",
+		From:      "blog@localhost",
+		OutboxDir: "outbox",
+		SMTP: SMTPConfig{
+			Port: 587,
+		},
+	}
+}
+
+func (c MailConfig) validate() []error {
+	var errs []error
+	if c.From == "" {
+		errs = append(errs, errors.New("mail.from is required"))
+	}
+	switch c.Backend {
+	case "smtp":
+		if c.SMTP.Host == "" {
+			errs = append(errs, errors.New("mail.smtp.host is required for the smtp backend"))
+		}
+		if c.SMTP.Port <= 0 || c.SMTP.Port > 65535 {
+			errs = append(errs, errors.New("mail.smtp.port must be between 1 and 65535"))
+		}
+	case "file":
+		if c.OutboxDir == "" {
+			errs = append(errs, errors.New("mail.outbox_dir is required for the file backend"))
+		}
+	case "memory":
+	default:
+		errs = append(errs, fmt.Errorf("mail.backend must be one of smtp, file, memory, got %q", c.Backend))
+	}
+	return errs
+}
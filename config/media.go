@@ -0,0 +1,108 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MediaConfig controls uploaded media. Files are kept by Backend: "local"
+// writes them below Dir, "s3" to a bucket of any S3-compatible service.
+// MaxSize and UserQuota are in bytes. Uploads that no post refers to are
+// removed once OrphanTTL has passed.
+//
+// Images are processed in the background by Workers workers into a square
+// thumbnail of ThumbnailSize pixels and one variant per width in
+// VariantWidths narrower than the original, each as WebP and as JPEG of
+// JPEGQuality.
+type MediaConfig struct {
+	Backend       string        `yaml:"backend"`
+	Dir           string        `yaml:"dir"`
+	MaxSize       int64         `yaml:"max_size"`
+	UserQuota     int64         `yaml:"user_quota"`
+	AllowedTypes  []string      `yaml:"allowed_types"`
+	OrphanTTL     time.Duration `yaml:"orphan_ttl"`
+	Workers       int           `yaml:"workers"`
+	VariantWidths []int         `yaml:"variant_widths"`
+	ThumbnailSize int           `yaml:"thumbnail_size"`
+	JPEGQuality   int           `yaml:"jpeg_quality"`
+	S3            S3Config      `yaml:"s3"`
+}
+
+type S3Config struct {
+	Endpoint  string `yaml:"endpoint"`
+	Region    string `yaml:"region"`
+	Bucket    string `yaml:"bucket"`
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
+	UseSSL    bool   `yaml:"use_ssl"`
+	PathStyle bool   `yaml:"path_style"`
+}
+
+func defaultMedia() MediaConfig {
+	return MediaConfig{
+		Backend:       "local",
+		Dir:           "media",
+		MaxSize:       10 << 20,
+		UserQuota:     500 << 20,
+		AllowedTypes:  []string{"image/png", "image/jpeg", "image/gif", "image/webp"},
+		OrphanTTL:     24 * time.Hour,
+		Workers:       2,
+		VariantWidths: []int{320, 640, 1280},
+		ThumbnailSize: 256,
+		JPEGQuality:   82,
+		S3: S3Config{
+			Region: "us-east-1",
+			UseSSL: true,
+		},
+	}
+}
+
+func (c MediaConfig) validate() []error {
+	var errs []error
+	switch c.Backend {
+	case "local":
+		if c.Dir == "" {
+			errs = append(errs, errors.New("media.dir is required for the local backend"))
+		}
+	case "s3":
+		if c.S3.Endpoint == "" {
+			errs = append(errs, errors.New("media.s3.endpoint is required for the s3 backend"))
+		}
+		if c.S3.Bucket == "" {
+			errs = append(errs, errors.New("media.s3.bucket is required for the s3 backend"))
+		}
+		if c.S3.AccessKey == "" || c.S3.SecretKey == "" {
+			errs = append(errs, errors.New("media.s3.access_key and media.s3.secret_key (S3_ACCESS_KEY, S3_SECRET_KEY) are required for the s3 backend"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("media.backend must be one of local, s3, got %q", c.Backend))
+	}
+	if c.MaxSize <= 0 {
+		errs = append(errs, errors.New("media.max_size must be positive"))
+	}
+	if c.UserQuota < c.MaxSize {
+		errs = append(errs, errors.New("media.user_quota must be at least media.max_size"))
+	}
+	if len(c.AllowedTypes) == 0 {
+		errs = append(errs, errors.New("media.allowed_types must not be empty"))
+	}
+	if c.OrphanTTL <= 0 {
+		errs = append(errs, errors.New("media.orphan_ttl must be positive"))
+	}
+	if c.Workers < 1 {
+		errs = append(errs, errors.New("media.workers must be at least 1"))
+	}
+	for _, width := range c.VariantWidths {
+		if width <= 0 {
+			errs = append(errs, fmt.Errorf("media.variant_widths must be positive, got %d", width))
+		}
+	}
+	if c.ThumbnailSize <= 0 {
+		errs = append(errs, errors.New("media.thumbnail_size must be positive"))
+	}
+	if c.JPEGQuality < 1 || c.JPEGQuality > 100 {
+		errs = append(errs, errors.New("media.jpeg_quality must be between 1 and 100"))
+	}
+	return errs
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MongoConnection struct {
+	MongoClient *mongo.Client
+	Database    *mongo.Database
+}
+
+func ConnectToMongo(cfg MongoConfig) (*MongoConnection, error) {
+	log.Printf("Connecting to MongoDB: uri: %s", redactURI(cfg.MongoURI()))
+	clientOptions := options.Client().ApplyURI(cfg.MongoURI())
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
+	defer cancel()
+
+	client, err := mongo.Connect(ctx, clientOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MongoDB: %w", err)
+	}
+
+	err = client.Ping(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to ping MongoDB: %w", err)
+	}
+
+	database := client.Database(cfg.Database)
+	return &MongoConnection{
+		MongoClient: client,
+		Database:    database,
+	}, nil
+}
+
+func (c *MongoConnection) CloseMongo() {
+	if c.MongoClient != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := c.MongoClient.Disconnect(ctx); err != nil {
+			log.Printf("Error while disconnecting from MongoDB: %v", err)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package config
+
+import (
+	"errors"
+	"time"
+)
+
+// NotificationsConfig controls the in-app notification inbox.
+// Notifications are deleted Retention after their last update. MaxMentions
+// caps how many users a single post or comment notifies by mentioning
+// them.
+type NotificationsConfig struct {
+	Retention   time.Duration `yaml:"retention"`
+	MaxMentions int           `yaml:"max_mentions"`
+}
+
+func defaultNotifications() NotificationsConfig {
+	return NotificationsConfig{
+		Retention:   90 * 24 * time.Hour,
+		MaxMentions: 10,
+	}
+}
+
+func (c NotificationsConfig) validate() []error {
+	var errs []error
+	if c.Retention <= 0 {
+		errs = append(errs, errors.New("notifications.retention must be positive"))
+	}
+	if c.MaxMentions < 0 {
+		errs = append(errs, errors.New("notifications.max_mentions must not be negative"))
+	}
+	return errs
+}
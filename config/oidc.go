@@ -0,0 +1,53 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+)
+
+// OIDCConfig lists the OpenID Connect identity providers users can sign in
+// with, keyed by the name used in /auth/oidc/:provider routes.
+type OIDCConfig struct {
+	Providers map[string]OIDCProvider `yaml:"providers"`
+}
+
+type OIDCProvider struct {
+	// Issuer is the provider's issuer URL; its discovery document is
+	// fetched from Issuer + "/.well-known/openid-configuration".
+	Issuer       string `yaml:"issuer"`
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+	// RedirectURL defaults to server.public_url +
+	// "/auth/oidc/<name>/callback".
+	RedirectURL string   `yaml:"redirect_url"`
+	Scopes      []string `yaml:"scopes"`
+	// AllowSignup creates a local account on first login when no existing
+	// user matches the provider identity or its verified email.
+	AllowSignup bool   `yaml:"allow_signup"`
+	DefaultRole string `yaml:"default_role"`
+}
+
+func (c OIDCConfig) validate() []error {
+	var errs []error
+	names := make([]string, 0, len(c.Providers))
+	for name := range c.Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := c.Providers[name]
+		if u, err := url.Parse(p.Issuer); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("oidc.providers.%s.issuer must be an absolute URL", name))
+		}
+		if p.ClientID == "" {
+			errs = append(errs, fmt.Errorf("oidc.providers.%s.client_id is required", name))
+		}
+		if p.RedirectURL != "" {
+			if u, err := url.Parse(p.RedirectURL); err != nil || u.Scheme == "" || u.Host == "" {
+				errs = append(errs, fmt.Errorf("oidc.providers.%s.redirect_url must be an absolute URL", name))
+			}
+		}
+	}
+	return errs
+}
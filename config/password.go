@@ -0,0 +1,66 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// PasswordConfig selects how passwords are hashed and which passwords are
+// accepted. Existing hashes made with other algorithms or parameters keep
+// working and are upgraded the next time their owner logs in.
+type PasswordConfig struct {
+	// Hasher is "argon2id" or "bcrypt".
+	Hasher     string       `yaml:"hasher"`
+	Argon2     Argon2Config `yaml:"argon2"`
+	BcryptCost int          `yaml:"bcrypt_cost"`
+
+	MinLength int `yaml:"min_length"`
+	MaxLength int `yaml:"max_length"`
+	// BreachedList is a local file of passwords that must not be used, one
+	// per line, either in plain text or as SHA-1 hex in the
+	// "HASH:count" format of Have I Been Pwned downloads.
+	BreachedList string `yaml:"breached_list"`
+}
+
+type Argon2Config struct {
+	// Memory is in KiB.
+	Memory  uint32 `yaml:"memory"`
+	Time    uint32 `yaml:"time"`
+	Threads uint8  `yaml:"threads"`
+}
+
+func defaultPassword() PasswordConfig {
+	return PasswordConfig{
+		Hasher:     "argon2id",
+		Argon2:     Argon2Config{Memory: 64 * 1024, Time: 3, Threads: 4},
+		BcryptCost: 12,
+		MinLength:  8,
+		MaxLength:  128,
+	}
+}
+
+func (c PasswordConfig) validate() []error {
+	var errs []error
+	switch c.Hasher {
+	case "argon2id":
+		if c.Argon2.Memory < 8*uint32(c.Argon2.Threads) || c.Argon2.Time == 0 || c.Argon2.Threads == 0 {
+			errs = append(errs, errors.New("password.argon2 needs time and threads of at least 1 and memory of at least 8 KiB per thread"))
+		}
+	case "bcrypt":
+		if c.BcryptCost < 10 || c.BcryptCost > 31 {
+			errs = append(errs, errors.New("password.bcrypt_cost must be between 10 and 31"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("password.hasher: unknown hasher %q", c.Hasher))
+	}
+	if c.MinLength < 1 {
+		errs = append(errs, errors.New("password.min_length must be at least 1"))
+	}
+	if c.MaxLength < c.MinLength {
+		errs = append(errs, errors.New("password.max_length must not be less than password.min_length"))
+	}
+	if c.Hasher == "bcrypt" && c.MaxLength > 72 {
+		errs = append(errs, errors.New("password.max_length must be at most 72 with bcrypt"))
+	}
+	return errs
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// RateLimitConfig configures the token-bucket rate limiter. Policies are
+// looked up by route name, e.g. "login" or "comments".
+type RateLimitConfig struct {
+	Enabled  bool                       `yaml:"enabled"`
+	Store    string                     `yaml:"store"`
+	Policies map[string]RateLimitPolicy `yaml:"policies"`
+}
+
+// RateLimitPolicy allows Rate requests per Period with bursts of up to Burst
+// requests. Key selects what a bucket is keyed by: "ip", "user", "api_key",
+// or "email" for policies that handlers apply to the address a request is
+// about.
+type RateLimitPolicy struct {
+	Rate   int           `yaml:"rate"`
+	Period time.Duration `yaml:"period"`
+	Burst  int           `yaml:"burst"`
+	Key    string        `yaml:"key"`
+}
+
+func defaultRateLimit() RateLimitConfig {
+	return RateLimitConfig{
+		Enabled: true,
+		Store:   "memory",
+		Policies: map[string]RateLimitPolicy{
+			"login":              {Rate: 5, Period: time.Minute, Burst: 5, Key: "ip"},
+			"register":           {Rate: 3, Period: time.Hour, Burst: 3, Key: "ip"},
+			"mfa":                {Rate: 5, Period: time.Minute, Burst: 5, Key: "ip"},
+			"password_reset":     {Rate: 5, Period: time.Hour, Burst: 3, Key: "ip"},
+			"magic_link":         {Rate: 5, Period: time.Hour, Burst: 3, Key: "ip"},
+			"magic_link_email":   {Rate: 3, Period: time.Hour, Burst: 3, Key: "email"},
+			"verification_email": {Rate: 3, Period: time.Hour, Burst: 3, Key: "user"},
+			"comments":           {Rate: 10, Period: time.Minute, Burst: 5, Key: "user"},
+			"exports":            {Rate: 3, Period: 24 * time.Hour, Burst: 3, Key: "user"},
+			"uploads":            {Rate: 30, Period: time.Hour, Burst: 10, Key: "user"},
+			"reactions":          {Rate: 60, Period: time.Minute, Burst: 30, Key: "user"},
+		},
+	}
+}
+
+func (c RateLimitConfig) validate() []error {
+	var errs []error
+	if c.Store != "memory" && c.Store != "mongo" {
+		errs = append(errs, fmt.Errorf("rate_limit.store must be \"memory\" or \"mongo\", got %q", c.Store))
+	}
+	names := make([]string, 0, len(c.Policies))
+	for name := range c.Policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		p := c.Policies[name]
+		if p.Rate <= 0 {
+			errs = append(errs, fmt.Errorf("rate_limit.policies.%s.rate must be positive", name))
+		}
+		if p.Period <= 0 {
+			errs = append(errs, fmt.Errorf("rate_limit.policies.%s.period must be positive", name))
+		}
+		if p.Burst < 0 {
+			errs = append(errs, fmt.Errorf("rate_limit.policies.%s.burst must not be negative", name))
+		}
+		switch p.Key {
+		case "ip", "user", "api_key", "email":
+		default:
+			errs = append(errs, fmt.Errorf("rate_limit.policies.%s.key must be one of ip, user, api_key, email", name))
+		}
+	}
+	return errs
+}
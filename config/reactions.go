@@ -0,0 +1,54 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// ReactionsConfig lists the reactions users can leave on posts and
+// comments. Name identifies a reaction in URLs and counters; Emoji is what
+// clients show for it.
+type ReactionsConfig struct {
+	Types []ReactionType `yaml:"types"`
+}
+
+type ReactionType struct {
+	Name  string `yaml:"name" json:"name"`
+	Emoji string `yaml:"emoji" json:"emoji"`
+}
+
+var reactionName = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+func defaultReactions() ReactionsConfig {
+	return ReactionsConfig{
+		Types: []ReactionType{
+			{Name: "like", Emoji: "👍"},
+			{Name: "love", Emoji: "❤️"},
+			{Name: "laugh", Emoji: "😂"},
+			{Name: "insightful", Emoji: "💡"},
+			{Name: "celebrate", Emoji: "🎉"},
+		},
+	}
+}
+
+func (c ReactionsConfig) validate() []error {
+	var errs []error
+	if len(c.Types) == 0 {
+		errs = append(errs, errors.New("reactions.types must not be empty"))
+	}
+	seen := map[string]bool{}
+	for _, t := range c.Types {
+		if !reactionName.MatchString(t.Name) {
+			errs = append(errs, fmt.Errorf("reactions.types name %q must be 1 to 32 lowercase letters, digits or underscores", t.Name))
+		}
+		if seen[t.Name] {
+			errs = append(errs, fmt.Errorf("reactions.types name %q is listed twice", t.Name))
+		}
+		seen[t.Name] = true
+		if t.Emoji == "" {
+			errs = append(errs, fmt.Errorf("reactions.types.%s.emoji is required", t.Name))
+		}
+	}
+	return errs
+}
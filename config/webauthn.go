@@ -0,0 +1,32 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+)
+
+// WebAuthnConfig describes this site as a WebAuthn relying party. Empty
+// values are derived from server.public_url.
+type WebAuthnConfig struct {
+	RPID          string   `yaml:"rp_id"`
+	RPDisplayName string   `yaml:"rp_display_name"`
+	RPOrigins     []string `yaml:"rp_origins"`
+}
+
+func defaultWebAuthn() WebAuthnConfig {
+	return WebAuthnConfig{RPDisplayName: "Blog"}
+}
+
+func (c WebAuthnConfig) validate() []error {
+	var errs []error
+	if c.RPDisplayName == "" {
+		errs = append(errs, errors.New("webauthn.rp_display_name is required"))
+	}
+	for _, origin := range c.RPOrigins {
+		if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" {
+			errs = append(errs, fmt.Errorf("webauthn.rp_origins: %q must be a scheme://host[:port] origin", origin))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,399 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	AccessTokenPrefix = "pat_"
+
+	ScopePostsRead     = "posts:read"
+	ScopePostsWrite    = "posts:write"
+	ScopeCommentsRead  = "comments:read"
+	ScopeCommentsWrite = "comments:write"
+
+	maxAccessTokensPerUser    = 50
+	maxAccessTokenLifetime    = 366 * 24 * time.Hour
+	accessTokenTouchInterval  = time.Minute
+	accessTokenDisplayedChars = 8
+)
+
+var (
+	ErrInvalidScope        = errors.New("unknown scope")
+	ErrTooManyAccessTokens = errors.New("too many access tokens")
+)
+
+var AccessTokenScopes = []string{ScopePostsRead, ScopePostsWrite, ScopeCommentsRead, ScopeCommentsWrite}
+
+// accessTokenRouteScopes lists the only routes reachable with a personal
+// access token and the scope each one needs. Everything else, in particular
+// account and token management, requires a login token.
+var accessTokenRouteScopes = map[string]string{
+	"GET /api/posts":                        ScopePostsRead,
+	"GET /api/posts/:id":                    ScopePostsRead,
+	"POST /api/posts":                       ScopePostsWrite,
+	"PATCH /api/posts/:id":                  ScopePostsWrite,
+	"DELETE /api/posts/:id":                 ScopePostsWrite,
+	"GET /api/posts/:id/comments":           ScopeCommentsRead,
+	"GET /api/posts/comments/":              ScopeCommentsRead,
+	"POST /api/posts/:id/comments":          ScopeCommentsWrite,
+	"PATCH /api/posts/comments/:commentID":  ScopeCommentsWrite,
+	"DELETE /api/posts/comments/:commentID": ScopeCommentsWrite,
+}
+
+type AccessTokenRepository struct {
+	Collection *mongo.Collection
+}
+
+func NewAccessTokenRepository(collection *mongo.Collection) *AccessTokenRepository {
+	_, err := collection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.M{"hash": 1}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.M{"user_id": 1}},
+	})
+	if err != nil {
+		log.Printf("Error creating access token indexes: %v", err)
+	}
+	return &AccessTokenRepository{Collection: collection}
+}
+
+func (r *AccessTokenRepository) CreateAccessToken(token AccessToken) error {
+	log.Println("Creating access token for user:", token.UserID)
+	_, err := r.Collection.InsertOne(context.TODO(), token)
+	if err != nil {
+		log.Printf("Error creating access token: %v", err)
+	}
+	return err
+}
+
+func (r *AccessTokenRepository) GetAccessTokenByHash(hash string) (AccessToken, error) {
+	var token AccessToken
+	err := r.Collection.FindOne(context.TODO(), bson.M{"hash": hash}).Decode(&token)
+	if err != nil {
+		log.Printf("Error getting access token: %v", err)
+	}
+	return token, err
+}
+
+func (r *AccessTokenRepository) GetUserAccessTokens(userID string) ([]AccessToken, error) {
+	log.Println("Getting access tokens for user:", userID)
+	opts := options.Find().SetSort(bson.M{"created_at": -1})
+	cursor, err := r.Collection.Find(context.TODO(), bson.M{"user_id": userID}, opts)
+	if err != nil {
+		log.Printf("Error getting access tokens: %v", err)
+		return nil, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Printf("Error closing cursor: %v", err)
+		}
+	}(cursor, context.TODO())
+
+	tokens := []AccessToken{}
+	if err = cursor.All(context.TODO(), &tokens); err != nil {
+		log.Printf("Error decoding access tokens: %v", err)
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (r *AccessTokenRepository) DeleteAccessToken(userID, tokenID string) error {
+	log.Println("Deleting access token:", tokenID)
+	objectID, err := primitive.ObjectIDFromHex(tokenID)
+	if err != nil {
+		log.Printf("Error converting tokenID to ObjectID: %v", err)
+		return err
+	}
+	result, err := r.Collection.DeleteOne(context.TODO(), bson.M{"_id": objectID, "user_id": userID})
+	if err != nil {
+		log.Printf("Error deleting access token: %v", err)
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *AccessTokenRepository) TouchAccessToken(tokenID primitive.ObjectID, now time.Time) error {
+	_, err := r.Collection.UpdateOne(context.TODO(), bson.M{"_id": tokenID}, bson.M{"$set": bson.M{"last_used_at": now}})
+	if err != nil {
+		log.Printf("Error updating access token last use: %v", err)
+	}
+	return err
+}
+
+// AccessTokenService issues and authenticates personal access tokens, which
+// let scripts call the API on a user's behalf without their password.
+type AccessTokenService struct {
+	Repository  AccessTokenRepositoryInterface
+	UserService *UserService
+}
+
+func NewAccessTokenService(repository AccessTokenRepositoryInterface, userService *UserService) *AccessTokenService {
+	return &AccessTokenService{Repository: repository, UserService: userService}
+}
+
+// CreateToken returns the raw token, which is shown to the user once and
+// never stored. A zero lifetime creates a token that does not expire. mfa
+// records whether the user signed in with a second factor; the token only
+// passes the MFA policy if they did.
+func (s *AccessTokenService) CreateToken(user User, name string, scopes []string, lifetime time.Duration, mfa bool) (string, AccessToken, error) {
+	scopes, err := normalizeScopes(scopes)
+	if err != nil {
+		return "", AccessToken{}, err
+	}
+	existing, err := s.Repository.GetUserAccessTokens(user.ID.Hex())
+	if err != nil {
+		return "", AccessToken{}, err
+	}
+	if len(existing) >= maxAccessTokensPerUser {
+		return "", AccessToken{}, ErrTooManyAccessTokens
+	}
+
+	secret, _, err := newOpaqueToken()
+	if err != nil {
+		return "", AccessToken{}, err
+	}
+	raw := AccessTokenPrefix + secret
+	now := time.Now()
+	token := AccessToken{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID.Hex(),
+		Name:      name,
+		Prefix:    raw[:len(AccessTokenPrefix)+accessTokenDisplayedChars],
+		Hash:      hashToken(raw),
+		Scopes:    scopes,
+		MFA:       mfa,
+		CreatedAt: now,
+	}
+	if lifetime > 0 {
+		expiresAt := now.Add(lifetime)
+		token.ExpiresAt = &expiresAt
+	}
+	if err := s.Repository.CreateAccessToken(token); err != nil {
+		return "", AccessToken{}, err
+	}
+	return raw, token, nil
+}
+
+func (s *AccessTokenService) GetUserTokens(userID string) ([]AccessToken, error) {
+	return s.Repository.GetUserAccessTokens(userID)
+}
+
+func (s *AccessTokenService) RevokeToken(userID, tokenID string) error {
+	return s.Repository.DeleteAccessToken(userID, tokenID)
+}
+
+// Authenticate resolves a raw token to its owner. Last use is recorded at
+// most once per accessTokenTouchInterval to keep reads cheap.
+func (s *AccessTokenService) Authenticate(raw string, now time.Time) (User, AccessToken, error) {
+	token, err := s.Repository.GetAccessTokenByHash(hashToken(raw))
+	if err != nil {
+		return User{}, AccessToken{}, ErrInvalidToken
+	}
+	if token.ExpiresAt != nil && !now.Before(*token.ExpiresAt) {
+		return User{}, AccessToken{}, ErrInvalidToken
+	}
+	user, err := s.UserService.GetUserByID(token.UserID)
+	if err != nil {
+		return User{}, AccessToken{}, ErrInvalidToken
+	}
+	if user.Restriction.ActiveAt(now) {
+		return User{}, AccessToken{}, ErrAccountRestricted
+	}
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= accessTokenTouchInterval {
+		if err := s.Repository.TouchAccessToken(token.ID, now); err != nil {
+			log.Printf("Unable to record access token use: %v", err)
+		}
+	}
+	return user, token, nil
+}
+
+func normalizeScopes(scopes []string) ([]string, error) {
+	seen := map[string]bool{}
+	var result []string
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		if !isKnownScope(scope) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidScope, scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			result = append(result, scope)
+		}
+	}
+	if len(result) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+func isKnownScope(scope string) bool {
+	for _, known := range AccessTokenScopes {
+		if scope == known {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticateAccessToken is the part of JWTMiddleware that handles
+// "Bearer pat_..." credentials. It writes the error response itself and
+// returns false when the request must not continue.
+func authenticateAccessToken(c *gin.Context, tokens *AccessTokenService, raw string) bool {
+	if tokens == nil {
+		log.Println("Access tokens are not enabled")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return false
+	}
+	user, token, err := tokens.Authenticate(raw, time.Now())
+	if err != nil {
+		log.Printf("Invalid access token: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		return false
+	}
+
+	required, allowed := accessTokenRouteScopes[c.Request.Method+" "+c.FullPath()]
+	if !allowed {
+		log.Printf("Access token %s used on %s %s", token.Prefix, c.Request.Method, c.FullPath())
+		c.JSON(http.StatusForbidden, gin.H{"error": "This endpoint cannot be used with an access token"})
+		return false
+	}
+	if !hasScope(token.Scopes, required) {
+		log.Printf("Access token %s lacks scope %s", token.Prefix, required)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access token lacks required scope", "required_scope": required})
+		return false
+	}
+
+	c.Set("user_id", user.ID.Hex())
+	c.Set("username", user.Username)
+	c.Set("role", user.Role)
+	// The token satisfies the MFA policy only if the login it was created
+	// from did.
+	c.Set("mfa", token.MFA)
+	c.Set("access_token_id", token.ID.Hex())
+	c.Set("scopes", token.Scopes)
+	log.Printf("Access token valid for user: %s, role: %s", user.Username, user.Role)
+	return true
+}
+
+func hasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateAccessToken godoc
+//
+//	@Summary		Create a personal access token
+//	@Description	Create a scoped token for scripts and CI. The token is returned only once. expires_in_days of 0 means it never expires.
+//	@Security		ApiKeyAuth
+//	@Tags			tokens
+//	@Accept			json
+//	@Produce		json
+//	@Param			input	body		object{name=string,scopes=[]string,expires_in_days=int}	true	"Token name, scopes and lifetime"
+//	@Success		201		{object}	Response
+//	@Failure		400		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/api/me/tokens [post]
+func (h *Handler) CreateAccessToken(c *gin.Context) {
+	var input struct {
+		Name          string   `json:"name" binding:"required,max=100"`
+		Scopes        []string `json:"scopes" binding:"required"`
+		ExpiresInDays int      `json:"expires_in_days" binding:"min=0"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	lifetime := time.Duration(input.ExpiresInDays) * 24 * time.Hour
+	if lifetime > maxAccessTokenLifetime {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "expires_in_days must be at most 366"})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	raw, token, err := h.AccessTokenService.CreateToken(user, strings.TrimSpace(input.Name), input.Scopes, lifetime, c.GetBool("mfa"))
+	if errors.Is(err, ErrInvalidScope) || errors.Is(err, ErrTooManyAccessTokens) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Unable to create access token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to create access token"})
+		return
+	}
+	log.Printf("Access token %s created for user %s", token.Prefix, user.Username)
+	h.audit(c, AuditEvent{Action: AuditAccessTokenCreate, TargetType: auditTargetAccessToken, TargetID: token.ID.Hex()}, nil, token)
+	c.JSON(http.StatusCreated, gin.H{"token": raw, "access_token": token})
+}
+
+// GetAccessTokens godoc
+//
+//	@Summary		List personal access tokens
+//	@Description	List the current user's access tokens without their secrets
+//	@Security		ApiKeyAuth
+//	@Tags			tokens
+//	@Produce		json
+//	@Success		200	{array}		AccessToken
+//	@Failure		500	{object}	Response
+//	@Router			/api/me/tokens [get]
+func (h *Handler) GetAccessTokens(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	tokens, err := h.AccessTokenService.GetUserTokens(userID.(string))
+	if err != nil {
+		log.Printf("Unable to fetch access tokens: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to fetch access tokens"})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// RevokeAccessToken godoc
+//
+//	@Summary		Revoke a personal access token
+//	@Description	Delete one of the current user's access tokens
+//	@Security		ApiKeyAuth
+//	@Tags			tokens
+//	@Produce		json
+//	@Param			id	path		string	true	"Token ID"
+//	@Success		200	{object}	Response
+//	@Failure		404	{object}	Response
+//	@Failure		500	{object}	Response
+//	@Router			/api/me/tokens/{id} [delete]
+func (h *Handler) RevokeAccessToken(c *gin.Context) {
+	userID, _ := c.Get("user_id")
+	err := h.AccessTokenService.RevokeToken(userID.(string), c.Param("id"))
+	if errors.Is(err, mongo.ErrNoDocuments) || errors.Is(err, primitive.ErrInvalidHex) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Access token not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Unable to revoke access token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to revoke access token"})
+		return
+	}
+	h.audit(c, AuditEvent{Action: AuditAccessTokenRevoke, TargetType: auditTargetAccessToken, TargetID: c.Param("id")}, nil, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Access token revoked"})
+}
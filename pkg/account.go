@@ -0,0 +1,434 @@
+package pkg
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/Takeso-user/blog-backend/config"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var (
+	ErrInvalidUsername = errors.New("username must be 3 to 32 characters of letters, digits, '.', '_' or '-'")
+	ErrUsernameTaken   = errors.New("username is already taken")
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{3,32}$`)
+
+// AccountService implements self-service changes to a user's own account.
+// Posts reference their author by username and comments carry a copy of
+// it, so renames and deletions are applied to both.
+type AccountService struct {
+	UserService    *UserService
+	PostService    *PostService
+	CommentService *CommentService
+	SessionService *SessionService
+	PasswordPolicy *PasswordPolicy
+	Config         config.AccountConfig
+	// Reactions, when set, has the user's reactions withdrawn.
+	Reactions *ReactionService
+	// Bookmarks, when set, has the user's bookmarks and reading lists
+	// deleted.
+	Bookmarks *BookmarkService
+	// Feed, when set, has follows moved on renames and deleted with the
+	// account.
+	Feed *FeedService
+	// Notifications, when set, has the user's notifications deleted and
+	// their name updated in the notifications they caused.
+	Notifications *NotificationService
+	// Confirmations checks that password changes and deletions come from
+	// the account owner. Without it only the password is accepted.
+	Confirmations *ConfirmationService
+}
+
+func NewAccountService(userService *UserService, postService *PostService, commentService *CommentService, sessionService *SessionService, passwordPolicy *PasswordPolicy, cfg config.AccountConfig) *AccountService {
+	return &AccountService{
+		UserService:    userService,
+		PostService:    postService,
+		CommentService: commentService,
+		SessionService: sessionService,
+		PasswordPolicy: passwordPolicy,
+		Config:         cfg,
+	}
+}
+
+// Rename changes the username and moves the user's posts and comments to
+// the new name. Existing sessions are revoked because tokens carry the
+// username.
+func (s *AccountService) Rename(user User, username string) (User, error) {
+	if !usernamePattern.MatchString(username) {
+		return User{}, ErrInvalidUsername
+	}
+	if username == user.Username {
+		return user, nil
+	}
+	if _, err := s.UserService.GetUserByUsername(username); err == nil {
+		return User{}, ErrUsernameTaken
+	}
+
+	// The check above is only for a clear error; the unique index decides
+	// between concurrent renames.
+	updated, err := s.UserService.UpdateUser(user.ID, bson.M{"username": username})
+	if mongo.IsDuplicateKeyError(err) {
+		return User{}, ErrUsernameTaken
+	}
+	if err != nil {
+		return User{}, err
+	}
+	s.UserService.InvalidateUser(user)
+	if err := s.reassignPosts(user.Username, bson.M{"author_id": username}); err != nil {
+		return User{}, err
+	}
+	if _, err := s.CommentService.Repository.UpdateCommentsByUser(user.ID.Hex(), bson.M{"username": username}); err != nil {
+		return User{}, err
+	}
+	if s.Feed != nil {
+		if err := s.Feed.RenameAuthor(user.Username, username); err != nil {
+			return User{}, err
+		}
+	}
+	if s.Notifications != nil {
+		if err := s.Notifications.RenameActor(user, username); err != nil {
+			return User{}, err
+		}
+	}
+	log.Printf("User %s renamed to %s", user.Username, username)
+	return updated, s.revokeSessions(user)
+}
+
+// ChangePassword sets a new password after checking the current one.
+// Accounts without a password, such as those created through an identity
+// provider, confirm setting one with another factor.
+func (s *AccountService) ChangePassword(user User, proof Confirmation, password string) error {
+	if err := s.Confirmations.Confirm(user, proof); err != nil {
+		return err
+	}
+	if s.PasswordPolicy != nil {
+		if err := s.PasswordPolicy.Check(password); err != nil {
+			return err
+		}
+	}
+	hashedPassword, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	if _, err := s.UserService.UpdateUser(user.ID, bson.M{"password": hashedPassword, "password_reset_required": false}); err != nil {
+		return err
+	}
+	return s.revokeSessions(user)
+}
+
+// DeleteAccount removes the user after confirming it is them, and
+// anonymizes or deletes their posts and comments as configured.
+func (s *AccountService) DeleteAccount(user User, proof Confirmation) error {
+	if err := s.Confirmations.Confirm(user, proof); err != nil {
+		return err
+	}
+
+	if s.Config.DeletedPosts == config.ContentDelete {
+		if err := s.deletePosts(user.Username); err != nil {
+			return err
+		}
+	} else if err := s.reassignPosts(user.Username, bson.M{"author_id": ""}); err != nil {
+		return err
+	}
+
+	if s.Reactions != nil {
+		if err := s.Reactions.RemoveUserReactions(user.ID.Hex()); err != nil {
+			return err
+		}
+	}
+	if s.Bookmarks != nil {
+		if err := s.Bookmarks.DeleteUserBookmarks(user.ID.Hex()); err != nil {
+			return err
+		}
+	}
+	if s.Feed != nil {
+		if err := s.Feed.RemoveUser(user); err != nil {
+			return err
+		}
+	}
+	if s.Notifications != nil {
+		if err := s.Notifications.RemoveUser(user, s.Config.DeletedUsername); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if s.Config.DeletedComments == config.ContentDelete {
+		err = s.deleteComments(user.ID.Hex())
+	} else {
+		_, err = s.CommentService.Repository.UpdateCommentsByUser(user.ID.Hex(), bson.M{"user_id": "", "username": s.Config.DeletedUsername})
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.UserService.DeleteUser(user); err != nil {
+		return err
+	}
+	log.Printf("User %s deleted their account", user.Username)
+	return s.revokeSessions(user)
+}
+
+func (s *AccountService) reassignPosts(authorID string, updateFields bson.M) error {
+	posts, err := s.PostService.Repository.GetPostsByAuthor(authorID)
+	if err != nil {
+		return err
+	}
+	if _, err := s.PostService.Repository.UpdatePostsByAuthor(authorID, updateFields); err != nil {
+		return err
+	}
+	s.forgetPosts(posts)
+	return nil
+}
+
+func (s *AccountService) deletePosts(authorID string) error {
+	posts, err := s.PostService.Repository.GetPostsByAuthor(authorID)
+	if err != nil {
+		return err
+	}
+	if _, err := s.PostService.Repository.DeletePostsByAuthor(authorID); err != nil {
+		return err
+	}
+	for _, post := range posts {
+		s.PostService.releaseSlugs(post.ID.Hex())
+		s.PostService.releaseMedia(post.ID.Hex())
+		s.PostService.releaseReactions(post.ID.Hex())
+		s.PostService.releaseBookmarks(post.ID.Hex())
+	}
+	s.forgetPosts(posts)
+	return nil
+}
+
+// deleteComments deletes the user's comments and the reactions to them.
+func (s *AccountService) deleteComments(userID string) error {
+	var comments []Comment
+	if s.CommentService.Reactions != nil {
+		var err error
+		if comments, err = s.CommentService.Repository.GetCommentsByUser(userID); err != nil {
+			return err
+		}
+	}
+	if _, err := s.CommentService.Repository.DeleteCommentsByUser(userID); err != nil {
+		return err
+	}
+	if len(comments) > 0 {
+		ids := make([]string, len(comments))
+		for i, comment := range comments {
+			ids[i] = comment.ID.Hex()
+		}
+		s.CommentService.releaseReactions(ids...)
+	}
+	return nil
+}
+
+// forgetPosts drops cached copies so that ownership checks see the change.
+func (s *AccountService) forgetPosts(posts []Post) {
+	for _, post := range posts {
+		s.PostService.Cache.Delete(post.ID.Hex())
+	}
+}
+
+func (s *AccountService) revokeSessions(user User) error {
+	if s.SessionService == nil {
+		return nil
+	}
+	return s.SessionService.RevokeUserSessions(user.ID.Hex())
+}
+
+// meView is the user's own account as returned by /api/me. It leaves out
+// the password hash and second-factor secrets.
+type meView struct {
+	ID            string             `json:"id"`
+	Username      string             `json:"username"`
+	Role          string             `json:"role"`
+	Email         string             `json:"email,omitempty"`
+	EmailVerified bool               `json:"email_verified"`
+	HasPassword   bool               `json:"has_password"`
+	TOTPEnabled   bool               `json:"totp_enabled"`
+	Passkeys      int                `json:"passkeys"`
+	Identities    []ExternalIdentity `json:"identities,omitempty"`
+}
+
+func newMeView(user User) meView {
+	return meView{
+		ID:            user.ID.Hex(),
+		Username:      user.Username,
+		Role:          user.Role,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		HasPassword:   user.Password != "",
+		TOTPEnabled:   user.TOTPEnabled,
+		Passkeys:      len(user.WebAuthnCredentials),
+		Identities:    user.Identities,
+	}
+}
+
+func accountErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidUsername), isPasswordPolicyError(err):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrPasswordMismatch):
+		return http.StatusForbidden
+	case errors.Is(err, ErrUsernameTaken):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// reissueToken answers a change that revoked the user's sessions with a
+// fresh token, keeping the second-factor state of the current one.
+func (h *Handler) reissueToken(c *gin.Context, user User, message string) {
+	mfa, _ := c.Get("mfa")
+	passed, _ := mfa.(bool)
+	token, err := h.issueToken(c, user, passed)
+	if err != nil {
+		log.Printf("Failed to generate token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": message, "token": token})
+}
+
+// GetMe godoc
+//
+//	@Summary		Get the current user
+//	@Description	Return the authenticated user's account
+//	@Security		ApiKeyAuth
+//	@Tags			account
+//	@Produce		json
+//	@Success		200	{object}	Response
+//	@Failure		401	{object}	Response
+//	@Router			/api/me [get]
+func (h *Handler) GetMe(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, newMeView(user))
+}
+
+// UpdateMe godoc
+//
+//	@Summary		Update the current user
+//	@Description	Change the username. Posts and comments follow the new name, other sessions are signed out and a new token is returned.
+//	@Security		ApiKeyAuth
+//	@Tags			account
+//	@Accept			json
+//	@Produce		json
+//	@Param			input	body		object{username=string}	true	"New username"
+//	@Success		200		{object}	Response
+//	@Failure		400		{object}	Response
+//	@Failure		409		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/api/me [patch]
+func (h *Handler) UpdateMe(c *gin.Context) {
+	var input struct {
+		Username string `json:"username" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	updated, err := h.AccountService.Rename(user, strings.TrimSpace(input.Username))
+	if err != nil {
+		log.Printf("Unable to rename user: %v", err)
+		c.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	h.auditUser(c, AuditAccountRename, &user, &updated)
+	h.reissueToken(c, updated, "Account updated")
+}
+
+// ChangePassword godoc
+//
+//	@Summary		Change the password
+//	@Description	Set a new password after confirming the current one. Accounts without a password confirm with a code or confirmation_token instead. Other sessions are signed out and a new token is returned.
+//	@Security		ApiKeyAuth
+//	@Tags			account
+//	@Accept			json
+//	@Produce		json
+//	@Param			input	body		object{current_password=string,code=string,confirmation_token=string,new_password=string}	true	"Confirmation and new password"
+//	@Success		200		{object}	Response
+//	@Failure		400		{object}	Response
+//	@Failure		403		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/api/me/password [post]
+func (h *Handler) ChangePassword(c *gin.Context) {
+	var input struct {
+		Confirmation
+		NewPassword string `json:"new_password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if err := h.AccountService.ChangePassword(user, input.Confirmation, input.NewPassword); err != nil {
+		log.Printf("Unable to change password: %v", err)
+		if h.confirmationFailed(c, user, err) {
+			return
+		}
+		c.JSON(accountErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	h.audit(c, AuditEvent{Action: AuditAccountPassword, TargetType: auditTargetUser, TargetID: user.ID.Hex()}, nil, nil)
+	h.reissueToken(c, user, "Password changed")
+}
+
+// DeleteMe godoc
+//
+//	@Summary		Delete the current user
+//	@Description	Delete the account after confirming the password, or for accounts without one a code or confirmation_token. Posts and comments are anonymized or deleted according to the server's policy.
+//	@Security		ApiKeyAuth
+//	@Tags			account
+//	@Accept			json
+//	@Produce		json
+//	@Param			input	body		object{password=string,code=string,confirmation_token=string}	false	"Confirmation"
+//	@Success		200		{object}	Response
+//	@Failure		403		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/api/me [delete]
+func (h *Handler) DeleteMe(c *gin.Context) {
+	var input struct {
+		Password string `json:"password"`
+		Confirmation
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if input.Confirmation.Password == "" {
+		input.Confirmation.Password = input.Password
+	}
+	if err := h.AccountService.DeleteAccount(user, input.Confirmation); err != nil {
+		log.Printf("Unable to delete account: %v", err)
+		if h.confirmationFailed(c, user, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to delete account"})
+		return
+	}
+	h.auditUser(c, AuditAccountDelete, &user, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Account deleted"})
+}
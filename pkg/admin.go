@@ -0,0 +1,562 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	RestrictionSuspension = "suspension"
+	RestrictionBan        = "ban"
+
+	UserStatusActive    = "active"
+	UserStatusSuspended = "suspended"
+	UserStatusBanned    = "banned"
+
+	impersonationTTL    = time.Hour
+	defaultUserPageSize = 50
+	maxUserPageSize     = 200
+)
+
+var (
+	ErrInvalidRole         = errors.New("role must start with a letter and contain only letters, digits, '_' or '-'")
+	ErrInvalidUserStatus   = errors.New("status must be active, suspended or banned")
+	ErrAccountRestricted   = errors.New("account is suspended or banned")
+	ErrAdminSelfAction     = errors.New("admins cannot do this to their own account")
+	ErrImpersonateAdmin    = errors.New("admins cannot be impersonated")
+	ErrRestrictionInPast   = errors.New("expires_at must be in the future")
+	ErrRestrictionNoReason = errors.New("reason is required")
+)
+
+var rolePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]{0,31}$`)
+
+// UserFilter selects users in the admin user search. Query matches the
+// start of the username or email, ignoring case.
+type UserFilter struct {
+	Query  string
+	Role   string
+	Status string
+	Limit  int64
+	Offset int64
+}
+
+func (f UserFilter) bson(now time.Time) bson.M {
+	var conditions []bson.M
+	if f.Query != "" {
+		prefix := bson.M{"$regex": "^" + regexp.QuoteMeta(f.Query), "$options": "i"}
+		conditions = append(conditions, bson.M{"$or": []bson.M{{"username": prefix}, {"email": prefix}}})
+	}
+	if f.Role != "" {
+		conditions = append(conditions, bson.M{"role": f.Role})
+	}
+	activeRestriction := []bson.M{{"restriction.expires_at": nil}, {"restriction.expires_at": bson.M{"$gt": now}}}
+	switch f.Status {
+	case UserStatusActive:
+		conditions = append(conditions, bson.M{"$or": []bson.M{{"restriction": nil}, {"restriction.expires_at": bson.M{"$lte": now}}}})
+	case UserStatusSuspended:
+		conditions = append(conditions, bson.M{"restriction.type": RestrictionSuspension, "$or": activeRestriction})
+	case UserStatusBanned:
+		conditions = append(conditions, bson.M{"restriction.type": RestrictionBan, "$or": activeRestriction})
+	}
+	if len(conditions) == 0 {
+		return bson.M{}
+	}
+	return bson.M{"$and": conditions}
+}
+
+// AdminService implements user management for admins.
+type AdminService struct {
+	UserService          *UserService
+	SessionService       *SessionService
+	PasswordResetService *PasswordResetService
+	// Notifications, when set, tells users about their new role.
+	Notifications *NotificationService
+}
+
+func NewAdminService(userService *UserService, sessionService *SessionService, passwordResetService *PasswordResetService) *AdminService {
+	return &AdminService{
+		UserService:          userService,
+		SessionService:       sessionService,
+		PasswordResetService: passwordResetService,
+	}
+}
+
+func (s *AdminService) SearchUsers(filter UserFilter) ([]User, int64, error) {
+	switch filter.Status {
+	case "", UserStatusActive, UserStatusSuspended, UserStatusBanned:
+	default:
+		return nil, 0, ErrInvalidUserStatus
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = defaultUserPageSize
+	}
+	if filter.Limit > maxUserPageSize {
+		filter.Limit = maxUserPageSize
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	return s.UserService.Repository.SearchUsers(filter)
+}
+
+// SetRole changes the user's role. Sessions are revoked because tokens
+// carry the role.
+func (s *AdminService) SetRole(admin, user User, role string) (User, error) {
+	if !rolePattern.MatchString(role) {
+		return User{}, ErrInvalidRole
+	}
+	if admin.ID == user.ID {
+		return User{}, ErrAdminSelfAction
+	}
+	updated, err := s.UserService.UpdateUser(user.ID, bson.M{"role": role})
+	if err != nil {
+		return User{}, err
+	}
+	log.Printf("Admin %s changed role of %s from %s to %s", admin.Username, user.Username, user.Role, role)
+	if s.Notifications != nil && role != user.Role {
+		s.Notifications.RoleChanged(admin, updated, role)
+	}
+	return updated, s.RevokeSessions(user)
+}
+
+// Restrict suspends or bans the user and signs them out everywhere.
+func (s *AdminService) Restrict(admin, user User, kind, reason string, expiresAt *time.Time) (User, error) {
+	if admin.ID == user.ID {
+		return User{}, ErrAdminSelfAction
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return User{}, ErrRestrictionNoReason
+	}
+	now := time.Now()
+	if expiresAt != nil && !expiresAt.After(now) {
+		return User{}, ErrRestrictionInPast
+	}
+	restriction := Restriction{Type: kind, Reason: reason, By: admin.Username, CreatedAt: now, ExpiresAt: expiresAt}
+	updated, err := s.UserService.UpdateUser(user.ID, bson.M{"restriction": restriction})
+	if err != nil {
+		return User{}, err
+	}
+	log.Printf("Admin %s placed a %s on %s: %s", admin.Username, kind, user.Username, reason)
+	return updated, s.RevokeSessions(user)
+}
+
+func (s *AdminService) LiftRestriction(admin, user User) (User, error) {
+	updated, err := s.UserService.UpdateUser(user.ID, bson.M{"restriction": nil})
+	if err != nil {
+		return User{}, err
+	}
+	log.Printf("Admin %s lifted the restriction on %s", admin.Username, user.Username)
+	return updated, nil
+}
+
+// ForcePasswordReset rejects the current password from now on, signs the
+// user out and mails them a reset link when they have an address.
+func (s *AdminService) ForcePasswordReset(ctx context.Context, admin, user User) (bool, error) {
+	if _, err := s.UserService.UpdateUser(user.ID, bson.M{"password_reset_required": true}); err != nil {
+		return false, err
+	}
+	log.Printf("Admin %s forced a password reset for %s", admin.Username, user.Username)
+	if err := s.RevokeSessions(user); err != nil {
+		return false, err
+	}
+	if s.PasswordResetService == nil || user.Email == "" {
+		return false, nil
+	}
+	return true, s.PasswordResetService.RequestReset(ctx, user.Username)
+}
+
+func (s *AdminService) RevokeSessions(user User) error {
+	if s.SessionService == nil {
+		return nil
+	}
+	return s.SessionService.RevokeUserSessions(user.ID.Hex())
+}
+
+// restrictedLogin answers a sign-in attempt by a suspended or banned user
+// and returns true. It returns false for users who may sign in.
+func (h *Handler) restrictedLogin(c *gin.Context, user User) bool {
+	restriction := user.Restriction
+	if !restriction.ActiveAt(time.Now()) {
+		return false
+	}
+	log.Printf("Sign-in by %s rejected: account has a %s", user.Username, restriction.Type)
+	message := "Account suspended"
+	if restriction.Type == RestrictionBan {
+		message = "Account banned"
+	}
+	response := gin.H{"error": message, "reason": restriction.Reason}
+	if restriction.ExpiresAt != nil {
+		response["until"] = restriction.ExpiresAt
+	}
+	c.JSON(http.StatusForbidden, response)
+	return true
+}
+
+// adminUserView is a user as shown to admins: the account overview users
+// see of themselves plus moderation state.
+type adminUserView struct {
+	meView
+	Restriction           *Restriction `json:"restriction,omitempty"`
+	PasswordResetRequired bool         `json:"password_reset_required"`
+}
+
+func newAdminUserView(user User) adminUserView {
+	return adminUserView{
+		meView:                newMeView(user),
+		Restriction:           user.Restriction,
+		PasswordResetRequired: user.PasswordResetRequired,
+	}
+}
+
+func adminErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidRole), errors.Is(err, ErrInvalidUserStatus),
+		errors.Is(err, ErrRestrictionInPast), errors.Is(err, ErrRestrictionNoReason):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrAdminSelfAction), errors.Is(err, ErrImpersonateAdmin):
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// adminTarget loads the admin making the request and the user named by
+// the :id parameter. On failure it writes the response and returns false.
+func (h *Handler) adminTarget(c *gin.Context) (User, User, bool) {
+	admin, ok := h.currentUser(c)
+	if !ok {
+		return User{}, User{}, false
+	}
+	user, err := h.UserService.GetUserByID(c.Param("id"))
+	if err != nil {
+		log.Printf("Unable to fetch user: %v", err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return User{}, User{}, false
+	}
+	return admin, user, true
+}
+
+func (h *Handler) respondAdminError(c *gin.Context, action string, err error) {
+	log.Printf("Unable to %s: %v", action, err)
+	status := adminErrorStatus(err)
+	if status == http.StatusInternalServerError {
+		c.JSON(status, gin.H{"error": "Unable to " + action})
+		return
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
+
+// SearchUsers godoc
+//
+//	@Summary		Search users
+//	@Description	List users, optionally filtered by username or email prefix, role and status
+//	@Security		ApiKeyAuth
+//	@Tags			admin
+//	@Produce		json
+//	@Param			q		query		string	false	"Username or email prefix"
+//	@Param			role	query		string	false	"Role"
+//	@Param			status	query		string	false	"active, suspended or banned"
+//	@Param			limit	query		int		false	"Page size, at most 200"
+//	@Param			offset	query		int		false	"Number of users to skip"
+//	@Success		200		{object}	Response
+//	@Failure		400		{object}	Response
+//	@Failure		403		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/api/admin/users [get]
+func (h *Handler) SearchUsers(c *gin.Context) {
+	filter := UserFilter{
+		Query:  strings.TrimSpace(c.Query("q")),
+		Role:   c.Query("role"),
+		Status: c.Query("status"),
+	}
+	var err error
+	if v := c.Query("limit"); v != "" {
+		if filter.Limit, err = strconv.ParseInt(v, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+	}
+	if v := c.Query("offset"); v != "" {
+		if filter.Offset, err = strconv.ParseInt(v, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+			return
+		}
+	}
+
+	users, total, err := h.AdminService.SearchUsers(filter)
+	if err != nil {
+		h.respondAdminError(c, "search users", err)
+		return
+	}
+	views := make([]adminUserView, 0, len(users))
+	for _, user := range users {
+		views = append(views, newAdminUserView(user))
+	}
+	c.JSON(http.StatusOK, gin.H{"users": views, "total": total})
+}
+
+// GetUserDetails godoc
+//
+//	@Summary		Get a user
+//	@Description	Show a user's account, moderation state and sessions
+//	@Security		ApiKeyAuth
+//	@Tags			admin
+//	@Produce		json
+//	@Param			id	path		string	true	"User ID"
+//	@Success		200	{object}	Response
+//	@Failure		403	{object}	Response
+//	@Failure		404	{object}	Response
+//	@Router			/api/admin/users/{id} [get]
+func (h *Handler) GetUserDetails(c *gin.Context) {
+	_, user, ok := h.adminTarget(c)
+	if !ok {
+		return
+	}
+	sessions := []Session{}
+	if h.SessionService != nil {
+		found, err := h.SessionService.GetUserSessions(user.ID.Hex())
+		if err != nil {
+			log.Printf("Unable to fetch sessions: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to fetch sessions"})
+			return
+		}
+		sessions = found
+	}
+	c.JSON(http.StatusOK, gin.H{"user": newAdminUserView(user), "sessions": sessions})
+}
+
+// SetUserRole godoc
+//
+//	@Summary		Change a user's role
+//	@Description	Change the role of another user and sign them out
+//	@Security		ApiKeyAuth
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string				true	"User ID"
+//	@Param			input	body		object{role=string}	true	"New role"
+//	@Success		200		{object}	Response
+//	@Failure		400		{object}	Response
+//	@Failure		403		{object}	Response
+//	@Failure		404		{object}	Response
+//	@Router			/api/admin/users/{id}/role [put]
+func (h *Handler) SetUserRole(c *gin.Context) {
+	var input struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	admin, user, ok := h.adminTarget(c)
+	if !ok {
+		return
+	}
+	updated, err := h.AdminService.SetRole(admin, user, strings.TrimSpace(input.Role))
+	if err != nil {
+		h.respondAdminError(c, "change role", err)
+		return
+	}
+	h.auditUser(c, AuditRoleChange, &user, &updated)
+	c.JSON(http.StatusOK, newAdminUserView(updated))
+}
+
+type restrictionInput struct {
+	Reason    string     `json:"reason" binding:"required"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+func (h *Handler) restrictUser(c *gin.Context, kind string) {
+	var input restrictionInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	admin, user, ok := h.adminTarget(c)
+	if !ok {
+		return
+	}
+	updated, err := h.AdminService.Restrict(admin, user, kind, input.Reason, input.ExpiresAt)
+	if err != nil {
+		h.respondAdminError(c, "restrict user", err)
+		return
+	}
+	h.auditUser(c, AuditUserRestrict, &user, &updated)
+	c.JSON(http.StatusOK, newAdminUserView(updated))
+}
+
+// SuspendUser godoc
+//
+//	@Summary		Suspend a user
+//	@Description	Keep a user from signing in, until expires_at or until lifted, and sign them out
+//	@Security		ApiKeyAuth
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string									true	"User ID"
+//	@Param			input	body		object{reason=string,expires_at=string}	true	"Reason and optional RFC 3339 expiry"
+//	@Success		200		{object}	Response
+//	@Failure		400		{object}	Response
+//	@Failure		403		{object}	Response
+//	@Failure		404		{object}	Response
+//	@Router			/api/admin/users/{id}/suspend [post]
+func (h *Handler) SuspendUser(c *gin.Context) {
+	h.restrictUser(c, RestrictionSuspension)
+}
+
+// BanUser godoc
+//
+//	@Summary		Ban a user
+//	@Description	Ban a user, until expires_at or until lifted, and sign them out
+//	@Security		ApiKeyAuth
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string									true	"User ID"
+//	@Param			input	body		object{reason=string,expires_at=string}	true	"Reason and optional RFC 3339 expiry"
+//	@Success		200		{object}	Response
+//	@Failure		400		{object}	Response
+//	@Failure		403		{object}	Response
+//	@Failure		404		{object}	Response
+//	@Router			/api/admin/users/{id}/ban [post]
+func (h *Handler) BanUser(c *gin.Context) {
+	h.restrictUser(c, RestrictionBan)
+}
+
+// LiftUserRestriction godoc
+//
+//	@Summary		Lift a suspension or ban
+//	@Description	Allow a suspended or banned user to sign in again
+//	@Security		ApiKeyAuth
+//	@Tags			admin
+//	@Produce		json
+//	@Param			id	path		string	true	"User ID"
+//	@Success		200	{object}	Response
+//	@Failure		403	{object}	Response
+//	@Failure		404	{object}	Response
+//	@Router			/api/admin/users/{id}/restriction [delete]
+func (h *Handler) LiftUserRestriction(c *gin.Context) {
+	admin, user, ok := h.adminTarget(c)
+	if !ok {
+		return
+	}
+	updated, err := h.AdminService.LiftRestriction(admin, user)
+	if err != nil {
+		h.respondAdminError(c, "lift restriction", err)
+		return
+	}
+	h.auditUser(c, AuditUserUnrestrict, &user, &updated)
+	c.JSON(http.StatusOK, newAdminUserView(updated))
+}
+
+// ForceUserPasswordReset godoc
+//
+//	@Summary		Force a password reset
+//	@Description	Reject the user's current password, sign them out and mail a reset link if they have an email address
+//	@Security		ApiKeyAuth
+//	@Tags			admin
+//	@Produce		json
+//	@Param			id	path		string	true	"User ID"
+//	@Success		200	{object}	Response
+//	@Failure		403	{object}	Response
+//	@Failure		404	{object}	Response
+//	@Failure		500	{object}	Response
+//	@Router			/api/admin/users/{id}/password-reset [post]
+func (h *Handler) ForceUserPasswordReset(c *gin.Context) {
+	admin, user, ok := h.adminTarget(c)
+	if !ok {
+		return
+	}
+	mailed, err := h.AdminService.ForcePasswordReset(c.Request.Context(), admin, user)
+	if err != nil {
+		h.respondAdminError(c, "force password reset", err)
+		return
+	}
+	h.audit(c, AuditEvent{Action: AuditForcePasswordReset, TargetType: auditTargetUser, TargetID: user.ID.Hex()}, nil, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset required", "mailed": mailed})
+}
+
+// RevokeUserSessions godoc
+//
+//	@Summary		Sign a user out
+//	@Description	Revoke every session of a user
+//	@Security		ApiKeyAuth
+//	@Tags			admin
+//	@Produce		json
+//	@Param			id	path		string	true	"User ID"
+//	@Success		200	{object}	Response
+//	@Failure		403	{object}	Response
+//	@Failure		404	{object}	Response
+//	@Failure		500	{object}	Response
+//	@Router			/api/admin/users/{id}/sessions [delete]
+func (h *Handler) RevokeUserSessions(c *gin.Context) {
+	admin, user, ok := h.adminTarget(c)
+	if !ok {
+		return
+	}
+	if err := h.AdminService.RevokeSessions(user); err != nil {
+		h.respondAdminError(c, "revoke sessions", err)
+		return
+	}
+	log.Printf("Admin %s revoked all sessions of %s", admin.Username, user.Username)
+	h.audit(c, AuditEvent{Action: AuditRevokeSessions, TargetType: auditTargetUser, TargetID: user.ID.Hex()}, nil, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Sessions revoked"})
+}
+
+// ImpersonateUser godoc
+//
+//	@Summary		Impersonate a user
+//	@Description	Issue a one-hour token that acts as the user for support. The token names the admin in its "imp" claim and cannot change credentials or account settings.
+//	@Security		ApiKeyAuth
+//	@Tags			admin
+//	@Produce		json
+//	@Param			id	path		string	true	"User ID"
+//	@Success		200	{object}	Response
+//	@Failure		403	{object}	Response
+//	@Failure		404	{object}	Response
+//	@Failure		500	{object}	Response
+//	@Router			/api/admin/users/{id}/impersonate [post]
+func (h *Handler) ImpersonateUser(c *gin.Context) {
+	admin, user, ok := h.adminTarget(c)
+	if !ok {
+		return
+	}
+	switch {
+	case admin.ID == user.ID:
+		h.respondAdminError(c, "impersonate user", ErrAdminSelfAction)
+		return
+	case user.Role == "Admin":
+		h.respondAdminError(c, "impersonate user", ErrImpersonateAdmin)
+		return
+	}
+
+	mfa, _ := c.Get("mfa")
+	passed, _ := mfa.(bool)
+	sessionID := ""
+	if h.SessionService != nil {
+		session, err := h.SessionService.CreateImpersonationSession(user, admin.Username, c.ClientIP(), c.Request.UserAgent())
+		if err != nil {
+			h.respondAdminError(c, "impersonate user", err)
+			return
+		}
+		sessionID = session.ID.Hex()
+	}
+	token, err := GenerateImpersonationJWT(user, sessionID, passed, admin.Username)
+	if err != nil {
+		h.respondAdminError(c, "impersonate user", err)
+		return
+	}
+	log.Printf("Admin %s is impersonating %s", admin.Username, user.Username)
+	h.audit(c, AuditEvent{Action: AuditImpersonate, TargetType: auditTargetUser, TargetID: user.ID.Hex(), Details: map[string]string{"session_id": sessionID}}, nil, nil)
+	c.JSON(http.StatusOK, gin.H{"token": token, "expires_in": int(impersonationTTL.Seconds())})
+}
@@ -0,0 +1,503 @@
+package pkg
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Audit actions. The part before the dot groups related actions, which
+// the admin query can match with "group.*".
+const (
+	AuditLogin              = "auth.login"
+	AuditLoginFailed        = "auth.login_failed"
+	AuditPostUpdate         = "post.update"
+	AuditPostDelete         = "post.delete"
+	AuditCommentUpdate      = "comment.update"
+	AuditCommentDelete      = "comment.delete"
+	AuditAccountRename      = "account.rename"
+	AuditAccountPassword    = "account.password_change"
+	AuditAccountEmail       = "account.email_change"
+	AuditAccountDelete      = "account.delete"
+	AuditTOTPEnable         = "mfa.totp_enable"
+	AuditTOTPDisable        = "mfa.totp_disable"
+	AuditPasskeyRegister    = "mfa.passkey_register"
+	AuditPasskeyDelete      = "mfa.passkey_delete"
+	AuditAccessTokenCreate  = "token.create"
+	AuditAccessTokenRevoke  = "token.revoke"
+	AuditRoleChange         = "admin.role_change"
+	AuditUserRestrict       = "admin.restrict"
+	AuditUserUnrestrict     = "admin.lift_restriction"
+	AuditForcePasswordReset = "admin.force_password_reset"
+	AuditRevokeSessions     = "admin.revoke_sessions"
+	AuditImpersonate        = "admin.impersonate"
+	AuditUnlock             = "admin.unlock"
+	AuditMFAPolicyChange    = "admin.mfa_policy_change"
+)
+
+const (
+	auditTargetUser        = "user"
+	auditTargetPost        = "post"
+	auditTargetComment     = "comment"
+	auditTargetIP          = "ip"
+	auditTargetSettings    = "settings"
+	auditTargetAccessToken = "access_token"
+	auditTargetPasskey     = "webauthn_credential"
+
+	auditAppendAttempts  = 5
+	auditVerifyBatchSize = 500
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 500
+)
+
+var ErrAuditAppendConflict = errors.New("audit log is being appended to concurrently, giving up")
+
+type AuditRepository struct {
+	Collection *mongo.Collection
+}
+
+func NewAuditRepository(collection *mongo.Collection) *AuditRepository {
+	_, err := collection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.M{"seq": 1}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "actor", Value: 1}, {Key: "seq", Value: -1}}},
+		{Keys: bson.D{{Key: "target_id", Value: 1}, {Key: "seq", Value: -1}}},
+		{Keys: bson.D{{Key: "action", Value: 1}, {Key: "seq", Value: -1}}},
+		{Keys: bson.M{"time": 1}},
+	})
+	if err != nil {
+		log.Printf("Error creating audit indexes: %v", err)
+	}
+	return &AuditRepository{Collection: collection}
+}
+
+// AppendAuditEvent inserts an event. The unique index on seq makes a
+// concurrent append of the same sequence number fail with a duplicate key
+// error. There is deliberately no way to update or delete events.
+func (r *AuditRepository) AppendAuditEvent(event AuditEvent) error {
+	_, err := r.Collection.InsertOne(context.TODO(), event)
+	if err != nil {
+		log.Printf("Error appending audit event: %v", err)
+	}
+	return err
+}
+
+func (r *AuditRepository) GetLastAuditEvent() (AuditEvent, error) {
+	var event AuditEvent
+	opts := options.FindOne().SetSort(bson.M{"seq": -1})
+	err := r.Collection.FindOne(context.TODO(), bson.M{}, opts).Decode(&event)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		log.Printf("Error getting last audit event: %v", err)
+	}
+	return event, err
+}
+
+func (r *AuditRepository) SearchAuditEvents(filter AuditFilter) ([]AuditEvent, int64, error) {
+	log.Println("Searching audit events")
+	query := filter.bson()
+	total, err := r.Collection.CountDocuments(context.TODO(), query)
+	if err != nil {
+		log.Printf("Error counting audit events: %v", err)
+		return nil, 0, err
+	}
+	opts := options.Find().SetSort(bson.M{"seq": -1}).SetSkip(filter.Offset).SetLimit(filter.Limit)
+	events, err := r.find(query, opts)
+	return events, total, err
+}
+
+func (r *AuditRepository) GetAuditEventsAfter(seq int64, limit int64) ([]AuditEvent, error) {
+	opts := options.Find().SetSort(bson.M{"seq": 1}).SetLimit(limit)
+	return r.find(bson.M{"seq": bson.M{"$gt": seq}}, opts)
+}
+
+func (r *AuditRepository) find(filter bson.M, opts *options.FindOptions) ([]AuditEvent, error) {
+	cursor, err := r.Collection.Find(context.TODO(), filter, opts)
+	if err != nil {
+		log.Printf("Error getting audit events: %v", err)
+		return nil, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Printf("Error closing cursor: %v", err)
+		}
+	}(cursor, context.TODO())
+
+	events := []AuditEvent{}
+	if err = cursor.All(context.TODO(), &events); err != nil {
+		log.Printf("Error decoding audit events: %v", err)
+		return nil, err
+	}
+	return events, nil
+}
+
+// AuditFilter selects events in the admin audit query. An Action ending in
+// ".*" matches every action of that group, e.g. "admin.*".
+type AuditFilter struct {
+	Actor      string
+	Action     string
+	TargetType string
+	TargetID   string
+	RequestID  string
+	From       time.Time
+	To         time.Time
+	Limit      int64
+	Offset     int64
+}
+
+func (f AuditFilter) bson() bson.M {
+	query := bson.M{}
+	if f.Actor != "" {
+		query["actor"] = f.Actor
+	}
+	if group, ok := strings.CutSuffix(f.Action, ".*"); ok {
+		query["action"] = bson.M{"$regex": "^" + regexp.QuoteMeta(group+".")}
+	} else if f.Action != "" {
+		query["action"] = f.Action
+	}
+	if f.TargetType != "" {
+		query["target_type"] = f.TargetType
+	}
+	if f.TargetID != "" {
+		query["target_id"] = f.TargetID
+	}
+	if f.RequestID != "" {
+		query["request_id"] = f.RequestID
+	}
+	window := bson.M{}
+	if !f.From.IsZero() {
+		window["$gte"] = f.From
+	}
+	if !f.To.IsZero() {
+		window["$lt"] = f.To
+	}
+	if len(window) > 0 {
+		query["time"] = window
+	}
+	return query
+}
+
+// auditHash is the SHA-256 over the event's JSON encoding without its own
+// hash. The previous event's hash is part of the encoding, which chains
+// the events together. Time is normalized to what MongoDB stores, so
+// hashes still match after a round trip.
+func auditHash(event AuditEvent) (string, error) {
+	event.Hash = ""
+	event.Time = event.Time.UTC().Truncate(time.Millisecond)
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// AuditVerification reports on a walk over the whole audit chain. LastHash
+// can be copied somewhere safe: a later walk that ends before it shows that
+// events were removed from the end.
+type AuditVerification struct {
+	Valid     bool   `json:"valid"`
+	Checked   int64  `json:"checked"`
+	LastSeq   int64  `json:"last_seq"`
+	LastHash  string `json:"last_hash,omitempty"`
+	BrokenSeq int64  `json:"broken_seq,omitempty"`
+	Problem   string `json:"problem,omitempty"`
+}
+
+// AuditService appends events to the hash-chained audit log.
+type AuditService struct {
+	Repository AuditRepositoryInterface
+	mu         sync.Mutex
+}
+
+func NewAuditService(repository AuditRepositoryInterface) *AuditService {
+	return &AuditService{Repository: repository}
+}
+
+// Record links the event to the end of the chain and stores it. Appends
+// from one process are serialized; other instances appending at the same
+// time lose the race on the unique seq and retry.
+func (s *AuditService) Record(event AuditEvent) (AuditEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	event.Time = event.Time.UTC().Truncate(time.Millisecond)
+	for attempt := 0; attempt < auditAppendAttempts; attempt++ {
+		last, err := s.Repository.GetLastAuditEvent()
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return AuditEvent{}, err
+		}
+		event.ID = primitive.NewObjectID()
+		event.Seq = last.Seq + 1
+		event.PrevHash = last.Hash
+		if event.Hash, err = auditHash(event); err != nil {
+			return AuditEvent{}, err
+		}
+		err = s.Repository.AppendAuditEvent(event)
+		if mongo.IsDuplicateKeyError(err) {
+			continue
+		}
+		if err != nil {
+			return AuditEvent{}, err
+		}
+		return event, nil
+	}
+	return AuditEvent{}, ErrAuditAppendConflict
+}
+
+func (s *AuditService) Search(filter AuditFilter) ([]AuditEvent, int64, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultAuditPageSize
+	}
+	if filter.Limit > maxAuditPageSize {
+		filter.Limit = maxAuditPageSize
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	return s.Repository.SearchAuditEvents(filter)
+}
+
+// Verify walks the chain from the first event and stops at the first one
+// whose sequence number, link or hash does not match.
+func (s *AuditService) Verify() (AuditVerification, error) {
+	result := AuditVerification{Valid: true}
+	for {
+		events, err := s.Repository.GetAuditEventsAfter(result.LastSeq, auditVerifyBatchSize)
+		if err != nil {
+			return AuditVerification{}, err
+		}
+		for _, event := range events {
+			hash, err := auditHash(event)
+			if err != nil {
+				return AuditVerification{}, err
+			}
+			switch {
+			case event.Seq != result.LastSeq+1:
+				result.Problem = fmt.Sprintf("expected event %d, found %d", result.LastSeq+1, event.Seq)
+			case event.PrevHash != result.LastHash:
+				result.Problem = "previous hash does not match the preceding event"
+			case event.Hash != hash:
+				result.Problem = "event content does not match its hash"
+			}
+			if result.Problem != "" {
+				result.Valid = false
+				result.BrokenSeq = event.Seq
+				log.Printf("Audit chain broken at event %d: %s", event.Seq, result.Problem)
+				return result, nil
+			}
+			result.Checked++
+			result.LastSeq = event.Seq
+			result.LastHash = event.Hash
+		}
+		if len(events) < auditVerifyBatchSize {
+			return result, nil
+		}
+	}
+}
+
+// AuditExportSection adds the events the user performed to data exports.
+func AuditExportSection(auditService *AuditService) ExportSection {
+	return ExportSection{
+		Name:  "audit_events",
+		Title: "Security log",
+		Collect: func(user User) (interface{}, error) {
+			var all []AuditEvent
+			for {
+				events, total, err := auditService.Search(AuditFilter{Actor: user.Username, Limit: maxAuditPageSize, Offset: int64(len(all))})
+				if err != nil {
+					return nil, err
+				}
+				all = append(all, events...)
+				if len(events) == 0 || int64(len(all)) >= total {
+					return all, nil
+				}
+			}
+		},
+	}
+}
+
+// audit records an event for the request. The actor defaults to the
+// signed-in user; before and after are stored as JSON snapshots. A failure
+// is logged and does not fail the request.
+func (h *Handler) audit(c *gin.Context, event AuditEvent, before, after interface{}) {
+	if h.AuditService == nil {
+		return
+	}
+	if event.Actor == "" {
+		event.Actor = c.GetString("username")
+	}
+	event.Impersonator = c.GetString("impersonator")
+	event.IP = c.ClientIP()
+	event.UserAgent = c.Request.UserAgent()
+	event.RequestID = c.GetString(requestIDKey)
+	event.Before = auditSnapshot(before)
+	event.After = auditSnapshot(after)
+	if _, err := h.AuditService.Record(event); err != nil {
+		log.Printf("Failed to record audit event %s: %v", event.Action, err)
+	}
+}
+
+func auditSnapshot(v interface{}) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Unable to snapshot %T for the audit log: %v", v, err)
+		return nil
+	}
+	return data
+}
+
+// auditLogin records a completed sign-in.
+func (h *Handler) auditLogin(c *gin.Context, user User, mfa bool) {
+	h.audit(c, AuditEvent{
+		Action:     AuditLogin,
+		Actor:      user.Username,
+		TargetType: auditTargetUser,
+		TargetID:   user.ID.Hex(),
+		Details:    map[string]string{"mfa": strconv.FormatBool(mfa)},
+	}, nil, nil)
+}
+
+// auditUser records an action on a user account, snapshotting the account
+// as admins see it so no secrets end up in the log.
+func (h *Handler) auditUser(c *gin.Context, action string, before, after *User) {
+	target := before
+	if target == nil {
+		target = after
+	}
+	event := AuditEvent{Action: action, TargetType: auditTargetUser, TargetID: target.ID.Hex()}
+	var beforeView, afterView interface{}
+	if before != nil {
+		beforeView = newAdminUserView(*before)
+	}
+	if after != nil {
+		afterView = newAdminUserView(*after)
+	}
+	h.audit(c, event, beforeView, afterView)
+}
+
+// auditedPost loads the post for a before snapshot, only when auditing.
+func (h *Handler) auditedPost(id string) interface{} {
+	if h.AuditService == nil {
+		return nil
+	}
+	post, err := h.PostService.GetPostById(id)
+	if err != nil {
+		return nil
+	}
+	return post
+}
+
+// auditedComment loads the comment for a before snapshot, only when
+// auditing.
+func (h *Handler) auditedComment(id string) interface{} {
+	if h.AuditService == nil {
+		return nil
+	}
+	comment, err := h.CommentService.GetCommentByID(id)
+	if err != nil {
+		return nil
+	}
+	return comment
+}
+
+// GetAuditEvents godoc
+//
+//	@Summary		Query the audit log
+//	@Description	List audit events, newest first. action accepts "group.*", e.g. "admin.*".
+//	@Security		ApiKeyAuth
+//	@Tags			admin
+//	@Produce		json
+//	@Param			actor		query		string	false	"Username that performed the action"
+//	@Param			action		query		string	false	"Action, or action group ending in .*"
+//	@Param			target_type	query		string	false	"Target type, e.g. user, post or comment"
+//	@Param			target_id	query		string	false	"Target ID"
+//	@Param			request_id	query		string	false	"Request ID"
+//	@Param			from		query		string	false	"RFC 3339 start time, inclusive"
+//	@Param			to			query		string	false	"RFC 3339 end time, exclusive"
+//	@Param			limit		query		int		false	"Page size, at most 500"
+//	@Param			offset		query		int		false	"Number of events to skip"
+//	@Success		200			{object}	Response
+//	@Failure		400			{object}	Response
+//	@Failure		403			{object}	Response
+//	@Failure		500			{object}	Response
+//	@Router			/api/admin/audit [get]
+func (h *Handler) GetAuditEvents(c *gin.Context) {
+	filter := AuditFilter{
+		Actor:      c.Query("actor"),
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+		RequestID:  c.Query("request_id"),
+	}
+	var err error
+	for name, dst := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if v := c.Query(name); v != "" {
+			if *dst, err = time.Parse(time.RFC3339, v); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name + " time"})
+				return
+			}
+		}
+	}
+	if v := c.Query("limit"); v != "" {
+		if filter.Limit, err = strconv.ParseInt(v, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+	}
+	if v := c.Query("offset"); v != "" {
+		if filter.Offset, err = strconv.ParseInt(v, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+			return
+		}
+	}
+
+	events, total, err := h.AuditService.Search(filter)
+	if err != nil {
+		log.Printf("Unable to search audit events: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to search audit events"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"events": events, "total": total})
+}
+
+// VerifyAuditLog godoc
+//
+//	@Summary		Verify the audit log
+//	@Description	Recompute the hash chain and report the first event that was altered or removed, if any
+//	@Security		ApiKeyAuth
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{object}	AuditVerification
+//	@Failure		403	{object}	Response
+//	@Failure		500	{object}	Response
+//	@Router			/api/admin/audit/verify [get]
+func (h *Handler) VerifyAuditLog(c *gin.Context) {
+	result, err := h.AuditService.Verify()
+	if err != nil {
+		log.Printf("Unable to verify audit log: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to verify audit log"})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
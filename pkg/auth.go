@@ -3,7 +3,6 @@ package pkg
 import (
 	"errors"
 	"github.com/dgrijalva/jwt-go"
-	"golang.org/x/crypto/bcrypt"
 	"log"
 	"os"
 	"sync"
@@ -12,9 +11,21 @@ import (
 
 var (
 	jwtSecret []byte
+	jwtTTL    = 12 * time.Hour
 	once      sync.Once
 )
 
+// ConfigureJWT sets the signing secret and token lifetime from the loaded
+// configuration instead of reading JWT_SECRET from the environment.
+func ConfigureJWT(secret string, ttl time.Duration) {
+	once.Do(func() {})
+	jwtSecret = []byte(secret)
+	if ttl > 0 {
+		jwtTTL = ttl
+	}
+	log.Println("JWT settings loaded from configuration")
+}
+
 func GetJWTSecret() []byte {
 	once.Do(func() {
 		jwtSecret = []byte(os.Getenv("JWT_SECRET"))
@@ -24,24 +35,48 @@ func GetJWTSecret() []byte {
 }
 
 type Claims struct {
-	Username string `json:"username"`
-	Role     string `json:"role"`
-	Password string `json:"password"`
+	UserID    string `json:"user_id,omitempty"`
+	Username  string `json:"username"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid,omitempty"`
+	// MFA is set when the login was completed with a second factor.
+	MFA bool `json:"mfa,omitempty"`
+	// Impersonator is the admin acting as the user.
+	Impersonator string `json:"imp,omitempty"`
 	jwt.StandardClaims
 }
 
+// HashPassword hashes with the configured PasswordHasher, argon2id unless
+// ConfigurePasswordHasher chose otherwise.
 func HashPassword(password string) (string, error) {
 	log.Println("Hashing password")
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashersMu.RLock()
+	hasher := passwordHasher
+	hashersMu.RUnlock()
+	hashedPassword, err := hasher.Hash(password)
 	if err != nil {
 		log.Printf("Error hashing password: %v", err)
 	}
-	return string(hashedPassword), err
+	return hashedPassword, err
 }
 
+// dummyPasswordHash is compared against when a login names an unknown user,
+// so that the response takes as long as for a wrong password.
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := HashPassword("not-a-real-password")
+	return hash
+})
+
+// CheckPassword verifies a password against a hash made by any supported
+// hasher, including legacy bcrypt hashes.
 func CheckPassword(hashedPassword, password string) error {
 	log.Println("Checking password")
-	err := bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password))
+	hasher, _ := hasherFor(hashedPassword)
+	if hasher == nil {
+		log.Printf("Password check failed: %v", ErrUnknownPasswordHash)
+		return ErrUnknownPasswordHash
+	}
+	err := hasher.Verify(hashedPassword, password)
 	if err != nil {
 		log.Printf("Password check failed: %v", err)
 	}
@@ -49,13 +84,34 @@ func CheckPassword(hashedPassword, password string) error {
 }
 
 func GenerateJWT(user User) (string, error) {
+	return GenerateSessionJWT(user, "", false)
+}
+
+// GenerateSessionJWT issues a token bound to a stored session, which lets
+// JWTMiddleware reject it once the session has been revoked. mfa records
+// whether the user passed a second factor.
+func GenerateSessionJWT(user User, sessionID string, mfa bool) (string, error) {
 	log.Println("Generating JWT for user:", user.Username)
+	return signJWT(user, sessionID, mfa, "", jwtTTL)
+}
+
+// GenerateImpersonationJWT issues a short-lived token that lets an admin
+// act as user. The admin's name is kept in the "imp" claim.
+func GenerateImpersonationJWT(user User, sessionID string, mfa bool, impersonator string) (string, error) {
+	log.Printf("Generating impersonation JWT for user %s by %s", user.Username, impersonator)
+	return signJWT(user, sessionID, mfa, impersonator, impersonationTTL)
+}
+
+func signJWT(user User, sessionID string, mfa bool, impersonator string, ttl time.Duration) (string, error) {
 	claims := &Claims{
-		Username: user.Username,
-		Role:     user.Role,
-		Password: user.Password,
+		UserID:       userIDHex(user),
+		Username:     user.Username,
+		Role:         user.Role,
+		SessionID:    sessionID,
+		MFA:          mfa,
+		Impersonator: impersonator,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(time.Hour * 12).Unix(),
+			ExpiresAt: time.Now().Add(ttl).Unix(),
 			IssuedAt:  time.Now().Unix(),
 		},
 	}
@@ -79,3 +135,10 @@ func ParseJWT(tokenStr string) (*Claims, error) {
 	}
 	return claims, nil
 }
+
+func userIDHex(user User) string {
+	if user.ID.IsZero() {
+		return ""
+	}
+	return user.ID.Hex()
+}
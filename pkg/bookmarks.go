@@ -0,0 +1,967 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultBookmarkPageSize   = 20
+	maxBookmarkPageSize       = 100
+	maxReadingLists           = 100
+	maxReadingListName        = 100
+	maxReadingListDescription = 1000
+	maxBookmarkNote           = 1000
+)
+
+var (
+	ErrBookmarkNotFound    = errors.New("bookmark not found")
+	ErrReadingListNotFound = errors.New("reading list not found")
+	ErrReadingListName     = errors.New("name is required and must be at most 100 characters")
+	ErrReadingListTooLong  = errors.New("description must be at most 1000 characters")
+	ErrBookmarkNoteTooLong = errors.New("note must be at most 1000 characters")
+	ErrTooManyReadingLists = errors.New("reading list limit reached")
+)
+
+// BookmarkFilter selects one page of bookmarks, newest first. An empty
+// ListID selects bookmarks in any list or none.
+type BookmarkFilter struct {
+	UserID string
+	ListID string
+	Limit  int64
+	Offset int64
+}
+
+func (f BookmarkFilter) bson() bson.M {
+	query := bson.M{}
+	if f.UserID != "" {
+		query["user_id"] = f.UserID
+	}
+	if f.ListID != "" {
+		query["list_id"] = f.ListID
+	}
+	return query
+}
+
+type BookmarkRepository struct {
+	Collection *mongo.Collection
+}
+
+func NewBookmarkRepository(collection *mongo.Collection) *BookmarkRepository {
+	_, err := collection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "post_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "list_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.M{"post_id": 1}},
+	})
+	if err != nil {
+		log.Printf("Error creating bookmark indexes: %v", err)
+	}
+	return &BookmarkRepository{Collection: collection}
+}
+
+func (r *BookmarkRepository) CreateBookmark(bookmark Bookmark) error {
+	_, err := r.Collection.InsertOne(context.TODO(), bookmark)
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		log.Printf("Error creating bookmark: %v", err)
+	}
+	return err
+}
+
+func (r *BookmarkRepository) GetBookmarkByID(id string) (Bookmark, error) {
+	var bookmark Bookmark
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return bookmark, mongo.ErrNoDocuments
+	}
+	err = r.Collection.FindOne(context.TODO(), bson.M{"_id": objectID}).Decode(&bookmark)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		log.Printf("Error getting bookmark: %v", err)
+	}
+	return bookmark, err
+}
+
+func (r *BookmarkRepository) GetBookmarkByPost(userID, postID string) (Bookmark, error) {
+	var bookmark Bookmark
+	err := r.Collection.FindOne(context.TODO(), bson.M{"user_id": userID, "post_id": postID}).Decode(&bookmark)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		log.Printf("Error getting bookmark: %v", err)
+	}
+	return bookmark, err
+}
+
+// GetBookmarks returns one page of the bookmarks matching filter and the
+// total number of matches. A zero Limit returns all of them.
+func (r *BookmarkRepository) GetBookmarks(filter BookmarkFilter) ([]Bookmark, int64, error) {
+	query := filter.bson()
+	total, err := r.Collection.CountDocuments(context.TODO(), query)
+	if err != nil {
+		log.Printf("Error counting bookmarks: %v", err)
+		return nil, 0, err
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(filter.Offset).
+		SetLimit(filter.Limit)
+	cursor, err := r.Collection.Find(context.TODO(), query, opts)
+	if err != nil {
+		log.Printf("Error getting bookmarks: %v", err)
+		return nil, 0, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Printf("Error closing cursor: %v", err)
+		}
+	}(cursor, context.TODO())
+
+	bookmarks := []Bookmark{}
+	if err = cursor.All(context.TODO(), &bookmarks); err != nil {
+		log.Printf("Error decoding bookmarks: %v", err)
+		return nil, 0, err
+	}
+	return bookmarks, total, nil
+}
+
+func (r *BookmarkRepository) UpdateBookmark(id primitive.ObjectID, updateFields bson.M) (Bookmark, error) {
+	var bookmark Bookmark
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := r.Collection.FindOneAndUpdate(context.TODO(), bson.M{"_id": id}, bson.M{"$set": updateFields}, opts).Decode(&bookmark)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		log.Printf("Error updating bookmark: %v", err)
+	}
+	return bookmark, err
+}
+
+func (r *BookmarkRepository) DeleteBookmark(id primitive.ObjectID) error {
+	_, err := r.Collection.DeleteOne(context.TODO(), bson.M{"_id": id})
+	if err != nil {
+		log.Printf("Error deleting bookmark: %v", err)
+	}
+	return err
+}
+
+// MarkBookmarkedPostsDeleted flags the bookmarks of deleted posts. They are
+// kept, with the title the post had, until their owners remove them.
+func (r *BookmarkRepository) MarkBookmarkedPostsDeleted(postIDs []string) (int64, error) {
+	result, err := r.Collection.UpdateMany(context.TODO(), bson.M{"post_id": bson.M{"$in": postIDs}}, bson.M{"$set": bson.M{"post_deleted": true}})
+	if err != nil {
+		log.Printf("Error marking bookmarks: %v", err)
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// ClearBookmarkList moves the bookmarks in a list out of it.
+func (r *BookmarkRepository) ClearBookmarkList(listID string) (int64, error) {
+	result, err := r.Collection.UpdateMany(context.TODO(), bson.M{"list_id": listID}, bson.M{"$set": bson.M{"list_id": ""}})
+	if err != nil {
+		log.Printf("Error clearing reading list: %v", err)
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+func (r *BookmarkRepository) DeleteBookmarksByUser(userID string) (int64, error) {
+	result, err := r.Collection.DeleteMany(context.TODO(), bson.M{"user_id": userID})
+	if err != nil {
+		log.Printf("Error deleting bookmarks: %v", err)
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+type ReadingListRepository struct {
+	Collection *mongo.Collection
+}
+
+func NewReadingListRepository(collection *mongo.Collection) *ReadingListRepository {
+	_, err := collection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "owner_id", Value: 1}, {Key: "name", Value: 1}}},
+		{Keys: bson.M{"share_token": 1}},
+	})
+	if err != nil {
+		log.Printf("Error creating reading list indexes: %v", err)
+	}
+	return &ReadingListRepository{Collection: collection}
+}
+
+func (r *ReadingListRepository) CreateReadingList(list ReadingList) error {
+	_, err := r.Collection.InsertOne(context.TODO(), list)
+	if err != nil {
+		log.Printf("Error creating reading list: %v", err)
+	}
+	return err
+}
+
+func (r *ReadingListRepository) GetReadingListByID(id string) (ReadingList, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return ReadingList{}, mongo.ErrNoDocuments
+	}
+	return r.findOne(bson.M{"_id": objectID})
+}
+
+func (r *ReadingListRepository) GetReadingListByToken(token string) (ReadingList, error) {
+	return r.findOne(bson.M{"share_token": token})
+}
+
+func (r *ReadingListRepository) GetReadingLists(ownerID string) ([]ReadingList, error) {
+	opts := options.Find().SetSort(bson.M{"name": 1})
+	cursor, err := r.Collection.Find(context.TODO(), bson.M{"owner_id": ownerID}, opts)
+	if err != nil {
+		log.Printf("Error getting reading lists: %v", err)
+		return nil, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Printf("Error closing cursor: %v", err)
+		}
+	}(cursor, context.TODO())
+
+	lists := []ReadingList{}
+	if err = cursor.All(context.TODO(), &lists); err != nil {
+		log.Printf("Error decoding reading lists: %v", err)
+		return nil, err
+	}
+	return lists, nil
+}
+
+func (r *ReadingListRepository) CountReadingLists(ownerID string) (int64, error) {
+	count, err := r.Collection.CountDocuments(context.TODO(), bson.M{"owner_id": ownerID})
+	if err != nil {
+		log.Printf("Error counting reading lists: %v", err)
+	}
+	return count, err
+}
+
+func (r *ReadingListRepository) UpdateReadingList(id primitive.ObjectID, updateFields bson.M) (ReadingList, error) {
+	var list ReadingList
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := r.Collection.FindOneAndUpdate(context.TODO(), bson.M{"_id": id}, bson.M{"$set": updateFields}, opts).Decode(&list)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		log.Printf("Error updating reading list: %v", err)
+	}
+	return list, err
+}
+
+func (r *ReadingListRepository) DeleteReadingList(id primitive.ObjectID) error {
+	_, err := r.Collection.DeleteOne(context.TODO(), bson.M{"_id": id})
+	if err != nil {
+		log.Printf("Error deleting reading list: %v", err)
+	}
+	return err
+}
+
+func (r *ReadingListRepository) DeleteReadingListsByOwner(ownerID string) (int64, error) {
+	result, err := r.Collection.DeleteMany(context.TODO(), bson.M{"owner_id": ownerID})
+	if err != nil {
+		log.Printf("Error deleting reading lists: %v", err)
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+func (r *ReadingListRepository) findOne(filter bson.M) (ReadingList, error) {
+	var list ReadingList
+	err := r.Collection.FindOne(context.TODO(), filter).Decode(&list)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		log.Printf("Error getting reading list: %v", err)
+	}
+	return list, err
+}
+
+// BookmarkService keeps users' private bookmarks and the reading lists
+// they sort them into.
+type BookmarkService struct {
+	Repository BookmarkRepositoryInterface
+	Lists      ReadingListRepositoryInterface
+	Posts      *PostService
+	PublicURL  string
+}
+
+func NewBookmarkService(repository BookmarkRepositoryInterface, lists ReadingListRepositoryInterface, posts *PostService, publicURL string) *BookmarkService {
+	return &BookmarkService{
+		Repository: repository,
+		Lists:      lists,
+		Posts:      posts,
+		PublicURL:  strings.TrimRight(publicURL, "/"),
+	}
+}
+
+// AddBookmark bookmarks a post, given by ID or slug. A post is bookmarked
+// at most once per user; bookmarking it again returns the existing
+// bookmark and false.
+func (s *BookmarkService) AddBookmark(user User, postID, listID, note string) (Bookmark, bool, error) {
+	if utf8.RuneCountInString(note) > maxBookmarkNote {
+		return Bookmark{}, false, ErrBookmarkNoteTooLong
+	}
+	if listID != "" {
+		if _, err := s.ownList(user, listID); err != nil {
+			return Bookmark{}, false, err
+		}
+	}
+	post, err := s.Posts.GetPostByIDOrSlug(postID)
+	if errors.Is(err, mongo.ErrNoDocuments) || errors.Is(err, primitive.ErrInvalidHex) {
+		return Bookmark{}, false, ErrPostNotFound
+	}
+	if err != nil {
+		return Bookmark{}, false, err
+	}
+
+	bookmark := Bookmark{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID.Hex(),
+		PostID:    post.ID.Hex(),
+		ListID:    listID,
+		Note:      note,
+		PostTitle: post.Title,
+		PostSlug:  post.Slug,
+		CreatedAt: time.Now(),
+	}
+	created := true
+	if err := s.Repository.CreateBookmark(bookmark); mongo.IsDuplicateKeyError(err) {
+		created = false
+		if bookmark, err = s.Repository.GetBookmarkByPost(bookmark.UserID, bookmark.PostID); err != nil {
+			return Bookmark{}, false, err
+		}
+	} else if err != nil {
+		return Bookmark{}, false, err
+	}
+	bookmarks := []Bookmark{bookmark}
+	s.attachPosts(bookmarks)
+	return bookmarks[0], created, nil
+}
+
+// UpdateBookmark moves a bookmark to another list, or out of any list when
+// listID is empty, and changes its note. Nil arguments are left alone.
+func (s *BookmarkService) UpdateBookmark(user User, id string, listID, note *string) (Bookmark, error) {
+	bookmark, err := s.ownBookmark(user, id)
+	if err != nil {
+		return Bookmark{}, err
+	}
+	updateFields := bson.M{}
+	if listID != nil {
+		if *listID != "" {
+			if _, err := s.ownList(user, *listID); err != nil {
+				return Bookmark{}, err
+			}
+		}
+		updateFields["list_id"] = *listID
+	}
+	if note != nil {
+		if utf8.RuneCountInString(*note) > maxBookmarkNote {
+			return Bookmark{}, ErrBookmarkNoteTooLong
+		}
+		updateFields["note"] = *note
+	}
+	if len(updateFields) > 0 {
+		bookmark, err = s.Repository.UpdateBookmark(bookmark.ID, updateFields)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return Bookmark{}, ErrBookmarkNotFound
+		}
+		if err != nil {
+			return Bookmark{}, err
+		}
+	}
+	bookmarks := []Bookmark{bookmark}
+	s.attachPosts(bookmarks)
+	return bookmarks[0], nil
+}
+
+func (s *BookmarkService) RemoveBookmark(user User, id string) error {
+	bookmark, err := s.ownBookmark(user, id)
+	if err != nil {
+		return err
+	}
+	return s.Repository.DeleteBookmark(bookmark.ID)
+}
+
+// GetBookmarks returns one page of the user's bookmarks, optionally only
+// those in one list, and their total number.
+func (s *BookmarkService) GetBookmarks(user User, listID string, limit, offset int64) ([]Bookmark, int64, error) {
+	if listID != "" {
+		if _, err := s.ownList(user, listID); err != nil {
+			return nil, 0, err
+		}
+	}
+	filter := BookmarkFilter{UserID: user.ID.Hex(), ListID: listID, Limit: limit, Offset: offset}
+	bookmarks, total, err := s.Repository.GetBookmarks(clampBookmarkPage(filter))
+	if err != nil {
+		return nil, 0, err
+	}
+	s.attachPosts(bookmarks)
+	return bookmarks, total, nil
+}
+
+func (s *BookmarkService) CreateList(user User, name, description string, public bool) (ReadingList, error) {
+	name = strings.TrimSpace(name)
+	if err := validateReadingList(name, description); err != nil {
+		return ReadingList{}, err
+	}
+	count, err := s.Lists.CountReadingLists(user.ID.Hex())
+	if err != nil {
+		return ReadingList{}, err
+	}
+	if count >= maxReadingLists {
+		return ReadingList{}, ErrTooManyReadingLists
+	}
+	now := time.Now()
+	list := ReadingList{
+		ID:          primitive.NewObjectID(),
+		OwnerID:     user.ID.Hex(),
+		Name:        name,
+		Description: description,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if public {
+		list.Public = true
+		if list.ShareToken, _, err = newOpaqueToken(); err != nil {
+			return ReadingList{}, err
+		}
+	}
+	if err := s.Lists.CreateReadingList(list); err != nil {
+		return ReadingList{}, err
+	}
+	return s.presentList(list), nil
+}
+
+func (s *BookmarkService) GetLists(user User) ([]ReadingList, error) {
+	lists, err := s.Lists.GetReadingLists(user.ID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	for i := range lists {
+		lists[i] = s.presentList(lists[i])
+	}
+	return lists, nil
+}
+
+// UpdateList renames, describes, shares or unshares a list. Nil arguments
+// are left alone. Sharing a list again gives it a new share token, so links
+// handed out before it was made private stay dead.
+func (s *BookmarkService) UpdateList(user User, id string, name, description *string, public *bool) (ReadingList, error) {
+	list, err := s.ownList(user, id)
+	if err != nil {
+		return ReadingList{}, err
+	}
+	updateFields := bson.M{}
+	if name != nil {
+		list.Name = strings.TrimSpace(*name)
+		updateFields["name"] = list.Name
+	}
+	if description != nil {
+		list.Description = *description
+		updateFields["description"] = list.Description
+	}
+	if err := validateReadingList(list.Name, list.Description); err != nil {
+		return ReadingList{}, err
+	}
+	if public != nil && *public != list.Public {
+		updateFields["public"] = *public
+		updateFields["share_token"] = ""
+		if *public {
+			token, _, err := newOpaqueToken()
+			if err != nil {
+				return ReadingList{}, err
+			}
+			updateFields["share_token"] = token
+		}
+	}
+	if len(updateFields) == 0 {
+		return s.presentList(list), nil
+	}
+	updateFields["updated_at"] = time.Now()
+	list, err = s.Lists.UpdateReadingList(list.ID, updateFields)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ReadingList{}, ErrReadingListNotFound
+	}
+	if err != nil {
+		return ReadingList{}, err
+	}
+	return s.presentList(list), nil
+}
+
+// DeleteList deletes a list. Its bookmarks are kept outside any list.
+func (s *BookmarkService) DeleteList(user User, id string) error {
+	list, err := s.ownList(user, id)
+	if err != nil {
+		return err
+	}
+	if _, err := s.Repository.ClearBookmarkList(list.ID.Hex()); err != nil {
+		return err
+	}
+	return s.Lists.DeleteReadingList(list.ID)
+}
+
+// GetSharedList returns a public list and one page of its bookmarks. Notes
+// are private and left out.
+func (s *BookmarkService) GetSharedList(token string, limit, offset int64) (ReadingList, []Bookmark, int64, error) {
+	list, err := s.Lists.GetReadingListByToken(token)
+	if errors.Is(err, mongo.ErrNoDocuments) || (err == nil && !list.Public) {
+		return ReadingList{}, nil, 0, ErrReadingListNotFound
+	}
+	if err != nil {
+		return ReadingList{}, nil, 0, err
+	}
+	filter := BookmarkFilter{ListID: list.ID.Hex(), Limit: limit, Offset: offset}
+	bookmarks, total, err := s.Repository.GetBookmarks(clampBookmarkPage(filter))
+	if err != nil {
+		return ReadingList{}, nil, 0, err
+	}
+	for i := range bookmarks {
+		bookmarks[i].Note = ""
+	}
+	s.attachPosts(bookmarks)
+	list.ShareToken = ""
+	return list, bookmarks, total, nil
+}
+
+// DeleteUserBookmarks removes all bookmarks and reading lists of a user.
+func (s *BookmarkService) DeleteUserBookmarks(userID string) error {
+	if _, err := s.Repository.DeleteBookmarksByUser(userID); err != nil {
+		return err
+	}
+	_, err := s.Lists.DeleteReadingListsByOwner(userID)
+	return err
+}
+
+func (s *BookmarkService) ownBookmark(user User, id string) (Bookmark, error) {
+	bookmark, err := s.Repository.GetBookmarkByID(id)
+	if errors.Is(err, mongo.ErrNoDocuments) || (err == nil && bookmark.UserID != user.ID.Hex()) {
+		return Bookmark{}, ErrBookmarkNotFound
+	}
+	return bookmark, err
+}
+
+func (s *BookmarkService) ownList(user User, id string) (ReadingList, error) {
+	list, err := s.Lists.GetReadingListByID(id)
+	if errors.Is(err, mongo.ErrNoDocuments) || (err == nil && list.OwnerID != user.ID.Hex()) {
+		return ReadingList{}, ErrReadingListNotFound
+	}
+	return list, err
+}
+
+// attachPosts adds the current state of each bookmarked post. Posts that
+// no longer exist are flagged instead, and when the lookup fails the
+// bookmarks are shown as stored.
+func (s *BookmarkService) attachPosts(bookmarks []Bookmark) {
+	var ids []string
+	for _, bookmark := range bookmarks {
+		if !bookmark.PostDeleted {
+			ids = append(ids, bookmark.PostID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	posts, err := s.Posts.Repository.GetPostsByIDs(ids)
+	if err != nil {
+		log.Printf("Unable to fetch bookmarked posts: %v", err)
+		return
+	}
+	byID := make(map[string]Post, len(posts))
+	for _, post := range posts {
+		byID[post.ID.Hex()] = post
+	}
+	for i, bookmark := range bookmarks {
+		if bookmark.PostDeleted {
+			continue
+		}
+		post, ok := byID[bookmark.PostID]
+		if !ok {
+			bookmarks[i].PostDeleted = true
+			continue
+		}
+		bookmarks[i].Post = &PostSummary{
+			ID:          post.ID.Hex(),
+			Title:       post.Title,
+			Slug:        post.Slug,
+			AuthorID:    post.AuthorID,
+			ReadingTime: post.ReadingTime,
+			CreatedAt:   post.CreatedAt,
+		}
+	}
+}
+
+func (s *BookmarkService) presentList(list ReadingList) ReadingList {
+	if list.Public && list.ShareToken != "" {
+		list.ShareURL = s.PublicURL + "/reading-lists/" + list.ShareToken
+	}
+	return list
+}
+
+func validateReadingList(name, description string) error {
+	if name == "" || utf8.RuneCountInString(name) > maxReadingListName {
+		return ErrReadingListName
+	}
+	if utf8.RuneCountInString(description) > maxReadingListDescription {
+		return ErrReadingListTooLong
+	}
+	return nil
+}
+
+func clampBookmarkPage(filter BookmarkFilter) BookmarkFilter {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultBookmarkPageSize
+	}
+	if filter.Limit > maxBookmarkPageSize {
+		filter.Limit = maxBookmarkPageSize
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	return filter
+}
+
+func BookmarksExportSection(bookmarkService *BookmarkService) ExportSection {
+	return ExportSection{Name: "bookmarks", Title: "Bookmarks and reading lists", Collect: func(user User) (interface{}, error) {
+		bookmarks, _, err := bookmarkService.Repository.GetBookmarks(BookmarkFilter{UserID: user.ID.Hex()})
+		if err != nil {
+			return nil, err
+		}
+		lists, err := bookmarkService.GetLists(user)
+		if err != nil {
+			return nil, err
+		}
+		return gin.H{"bookmarks": bookmarks, "reading_lists": lists}, nil
+	}}
+}
+
+// releaseBookmarks flags the bookmarks of deleted posts.
+func (s *PostService) releaseBookmarks(postIDs ...string) {
+	if s.Bookmarks == nil {
+		return
+	}
+	if _, err := s.Bookmarks.MarkBookmarkedPostsDeleted(postIDs); err != nil {
+		log.Printf("Error marking bookmarks of posts %v: %v", postIDs, err)
+	}
+}
+
+// pageParams reads the limit and offset query parameters, writing a 400
+// when they are not numbers.
+func pageParams(c *gin.Context) (int64, int64, bool) {
+	var limit, offset int64
+	var err error
+	if v := c.Query("limit"); v != "" {
+		if limit, err = strconv.ParseInt(v, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return 0, 0, false
+		}
+	}
+	if v := c.Query("offset"); v != "" {
+		if offset, err = strconv.ParseInt(v, 10, 64); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+			return 0, 0, false
+		}
+	}
+	return limit, offset, true
+}
+
+func bookmarkError(c *gin.Context, action string, err error) {
+	switch {
+	case errors.Is(err, ErrBookmarkNotFound), errors.Is(err, ErrReadingListNotFound), errors.Is(err, ErrPostNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrReadingListName), errors.Is(err, ErrReadingListTooLong), errors.Is(err, ErrBookmarkNoteTooLong):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrTooManyReadingLists):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Unable to %s: %v", action, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to " + action})
+	}
+}
+
+// GetBookmarks godoc
+//
+//	@Summary		List bookmarks
+//	@Description	List the user's bookmarks, newest first. Bookmarks of deleted posts are kept with post_deleted set and the title the post had.
+//	@Security		ApiKeyAuth
+//	@Tags			bookmarks
+//	@Produce		json
+//	@Param			list_id	query		string	false	"Only bookmarks in this reading list"
+//	@Param			limit	query		int		false	"Page size, at most 100"
+//	@Param			offset	query		int		false	"Number of bookmarks to skip"
+//	@Success		200		{object}	Response
+//	@Failure		400		{object}	Response
+//	@Failure		404		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/api/me/bookmarks [get]
+func (h *Handler) GetBookmarks(c *gin.Context) {
+	limit, offset, ok := pageParams(c)
+	if !ok {
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	bookmarks, total, err := h.BookmarkService.GetBookmarks(user, c.Query("list_id"), limit, offset)
+	if err != nil {
+		bookmarkError(c, "fetch bookmarks", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"bookmarks": bookmarks, "total": total})
+}
+
+// AddBookmark godoc
+//
+//	@Summary		Bookmark a post
+//	@Description	Bookmark a post, optionally in one of the user's reading lists. Bookmarking a post again returns the existing bookmark with 200.
+//	@Security		ApiKeyAuth
+//	@Tags			bookmarks
+//	@Accept			json
+//	@Produce		json
+//	@Param			input	body		object{post_id=string,list_id=string,note=string}	true	"Post ID or slug, reading list and note"
+//	@Success		200		{object}	Bookmark
+//	@Success		201		{object}	Bookmark
+//	@Failure		400		{object}	Response
+//	@Failure		404		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/api/me/bookmarks [post]
+func (h *Handler) AddBookmark(c *gin.Context) {
+	var input struct {
+		PostID string `json:"post_id" binding:"required"`
+		ListID string `json:"list_id"`
+		Note   string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	bookmark, created, err := h.BookmarkService.AddBookmark(user, input.PostID, input.ListID, input.Note)
+	if err != nil {
+		bookmarkError(c, "add bookmark", err)
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, bookmark)
+}
+
+// UpdateBookmark godoc
+//
+//	@Summary		Move a bookmark or change its note
+//	@Description	Move a bookmark to another reading list, or out of any list with an empty list_id, and change its note. Omitted fields are left alone.
+//	@Security		ApiKeyAuth
+//	@Tags			bookmarks
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string								true	"Bookmark ID"
+//	@Param			input	body		object{list_id=string,note=string}	true	"Reading list and note"
+//	@Success		200		{object}	Bookmark
+//	@Failure		400		{object}	Response
+//	@Failure		404		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/api/me/bookmarks/{id} [patch]
+func (h *Handler) UpdateBookmark(c *gin.Context) {
+	var input struct {
+		ListID *string `json:"list_id"`
+		Note   *string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	bookmark, err := h.BookmarkService.UpdateBookmark(user, c.Param("id"), input.ListID, input.Note)
+	if err != nil {
+		bookmarkError(c, "update bookmark", err)
+		return
+	}
+	c.JSON(http.StatusOK, bookmark)
+}
+
+// DeleteBookmark godoc
+//
+//	@Summary		Remove a bookmark
+//	@Description	Remove a bookmark
+//	@Security		ApiKeyAuth
+//	@Tags			bookmarks
+//	@Produce		json
+//	@Param			id	path		string	true	"Bookmark ID"
+//	@Success		200	{object}	Response
+//	@Failure		404	{object}	Response
+//	@Failure		500	{object}	Response
+//	@Router			/api/me/bookmarks/{id} [delete]
+func (h *Handler) DeleteBookmark(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if err := h.BookmarkService.RemoveBookmark(user, c.Param("id")); err != nil {
+		bookmarkError(c, "remove bookmark", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Bookmark removed"})
+}
+
+// GetReadingLists godoc
+//
+//	@Summary		List reading lists
+//	@Description	List the user's reading lists by name
+//	@Security		ApiKeyAuth
+//	@Tags			bookmarks
+//	@Produce		json
+//	@Success		200	{array}		ReadingList
+//	@Failure		500	{object}	Response
+//	@Router			/api/me/reading-lists [get]
+func (h *Handler) GetReadingLists(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	lists, err := h.BookmarkService.GetLists(user)
+	if err != nil {
+		bookmarkError(c, "fetch reading lists", err)
+		return
+	}
+	c.JSON(http.StatusOK, lists)
+}
+
+// CreateReadingList godoc
+//
+//	@Summary		Create a reading list
+//	@Description	Create a reading list. A public list gets a share_url that anyone can open.
+//	@Security		ApiKeyAuth
+//	@Tags			bookmarks
+//	@Accept			json
+//	@Produce		json
+//	@Param			input	body		object{name=string,description=string,public=bool}	true	"Reading list"
+//	@Success		201		{object}	ReadingList
+//	@Failure		400		{object}	Response
+//	@Failure		403		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/api/me/reading-lists [post]
+func (h *Handler) CreateReadingList(c *gin.Context) {
+	var input struct {
+		Name        string `json:"name" binding:"required"`
+		Description string `json:"description"`
+		Public      bool   `json:"public"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	list, err := h.BookmarkService.CreateList(user, input.Name, input.Description, input.Public)
+	if err != nil {
+		bookmarkError(c, "create reading list", err)
+		return
+	}
+	c.JSON(http.StatusCreated, list)
+}
+
+// UpdateReadingList godoc
+//
+//	@Summary		Update a reading list
+//	@Description	Rename, describe, share or unshare a reading list. Omitted fields are left alone. Sharing a list again gives it a new share_url.
+//	@Security		ApiKeyAuth
+//	@Tags			bookmarks
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string												true	"Reading list ID"
+//	@Param			input	body		object{name=string,description=string,public=bool}	true	"Changes"
+//	@Success		200		{object}	ReadingList
+//	@Failure		400		{object}	Response
+//	@Failure		404		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/api/me/reading-lists/{id} [patch]
+func (h *Handler) UpdateReadingList(c *gin.Context) {
+	var input struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+		Public      *bool   `json:"public"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	list, err := h.BookmarkService.UpdateList(user, c.Param("id"), input.Name, input.Description, input.Public)
+	if err != nil {
+		bookmarkError(c, "update reading list", err)
+		return
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// DeleteReadingList godoc
+//
+//	@Summary		Delete a reading list
+//	@Description	Delete a reading list. Its bookmarks are kept outside any list.
+//	@Security		ApiKeyAuth
+//	@Tags			bookmarks
+//	@Produce		json
+//	@Param			id	path		string	true	"Reading list ID"
+//	@Success		200	{object}	Response
+//	@Failure		404	{object}	Response
+//	@Failure		500	{object}	Response
+//	@Router			/api/me/reading-lists/{id} [delete]
+func (h *Handler) DeleteReadingList(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if err := h.BookmarkService.DeleteList(user, c.Param("id")); err != nil {
+		bookmarkError(c, "delete reading list", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Reading list deleted"})
+}
+
+// GetSharedReadingList godoc
+//
+//	@Summary		Open a shared reading list
+//	@Description	Show a public reading list and one page of its bookmarks, without their notes. No authentication is needed.
+//	@Tags			bookmarks
+//	@Produce		json
+//	@Param			token	path		string	true	"Share token"
+//	@Param			limit	query		int		false	"Page size, at most 100"
+//	@Param			offset	query		int		false	"Number of bookmarks to skip"
+//	@Success		200		{object}	Response
+//	@Failure		400		{object}	Response
+//	@Failure		404		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/reading-lists/{token} [get]
+func (h *Handler) GetSharedReadingList(c *gin.Context) {
+	limit, offset, ok := pageParams(c)
+	if !ok {
+		return
+	}
+	list, bookmarks, total, err := h.BookmarkService.GetSharedList(c.Param("token"), limit, offset)
+	if err != nil {
+		bookmarkError(c, "fetch reading list", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"list": list, "bookmarks": bookmarks, "total": total})
+}
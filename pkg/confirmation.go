@@ -0,0 +1,250 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const TokenPurposeConfirmation = "confirmation"
+
+// confirmationTTL is how long a confirmation token from a passkey or a
+// mailed link can be spent on a sensitive change.
+const confirmationTTL = 15 * time.Minute
+
+var ErrConfirmationRequired = errors.New("please confirm this change with your password, a second factor or the link mailed to you")
+
+// Confirmation is what a client sends to prove it is the account owner and
+// not just someone holding their token. One of the fields is enough.
+type Confirmation struct {
+	Password string `json:"current_password"`
+	Code     string `json:"code"`
+	Token    string `json:"confirmation_token"`
+}
+
+// ConfirmationService steps up sensitive account changes, such as a new
+// email address or password, to a fresh proof of a factor the user has:
+// their password, a TOTP or recovery code, or a confirmation token from a
+// passkey assertion or a link mailed to their verified address.
+type ConfirmationService struct {
+	Tokens          TokenRepositoryInterface
+	MFAService      *MFAService
+	WebAuthnService *WebAuthnService
+	Mailer          Mailer
+	PublicURL       string
+}
+
+func NewConfirmationService(tokens TokenRepositoryInterface, mfaService *MFAService, webAuthnService *WebAuthnService, mailer Mailer, publicURL string) *ConfirmationService {
+	return &ConfirmationService{
+		Tokens:          tokens,
+		MFAService:      mfaService,
+		WebAuthnService: webAuthnService,
+		Mailer:          mailer,
+		PublicURL:       strings.TrimRight(publicURL, "/"),
+	}
+}
+
+// ConfirmationMethods lists the ways the user can confirm a change.
+func ConfirmationMethods(user User) []string {
+	var methods []string
+	if user.Password != "" {
+		methods = append(methods, "current_password")
+	}
+	if user.TOTPEnabled || len(user.RecoveryCodes) > 0 {
+		methods = append(methods, "code")
+	}
+	if len(user.WebAuthnCredentials) > 0 {
+		methods = append(methods, "passkey")
+	}
+	if user.Email != "" && user.EmailVerified {
+		methods = append(methods, "email")
+	}
+	return methods
+}
+
+// Confirm checks the proof. Accounts with no factor at all have nothing to
+// confirm with and are let through. A nil service only checks passwords.
+func (s *ConfirmationService) Confirm(user User, proof Confirmation) error {
+	if s == nil {
+		s = &ConfirmationService{}
+	}
+	switch {
+	case proof.Token != "" && s.Tokens != nil:
+		token, err := s.Tokens.ConsumeToken(TokenPurposeConfirmation, hashToken(proof.Token), time.Now())
+		if err != nil || token.UserID != user.ID.Hex() {
+			return ErrInvalidToken
+		}
+		return nil
+	case proof.Code != "" && (user.TOTPEnabled || len(user.RecoveryCodes) > 0) && s.MFAService != nil:
+		return s.MFAService.Verify(user, proof.Code)
+	case proof.Password != "" && user.Password != "":
+		if CheckPassword(user.Password, proof.Password) != nil {
+			return ErrPasswordMismatch
+		}
+		return nil
+	}
+	if len(ConfirmationMethods(user)) == 0 {
+		return nil
+	}
+	return ErrConfirmationRequired
+}
+
+func (s *ConfirmationService) issue(user User) (string, error) {
+	raw, hash, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	err = s.Tokens.CreateToken(OneTimeToken{
+		Hash:      hash,
+		Purpose:   TokenPurposeConfirmation,
+		UserID:    user.ID.Hex(),
+		CreatedAt: now,
+		ExpiresAt: now.Add(confirmationTTL),
+	})
+	return raw, err
+}
+
+// SendLink mails a confirmation link to the user's verified address.
+func (s *ConfirmationService) SendLink(ctx context.Context, user User) error {
+	if user.Email == "" || !user.EmailVerified {
+		return ErrInvalidEmail
+	}
+	raw, err := s.issue(user)
+	if err != nil {
+		return err
+	}
+	link := s.PublicURL + "/confirm?token=" + url.QueryEscape(raw)
+	return s.Mailer.Send(ctx, MailMessage{
+		To:      user.Email,
+		Subject: "Confirm a change to your account",
+		Body: fmt.Sprintf("Hi %s,\n\nOpen the link below to confirm a change to your account, such as a new email address or password. It works once and expires in %s.\n\n%s\n\n"+
+			"If you did not request this, someone may have access to your account. Sign out everywhere and reset your password.\n", user.Username, confirmationTTL, link),
+	})
+}
+
+// FinishPasskey verifies a passkey assertion started with
+// WebAuthnService.BeginLogin and returns a confirmation token.
+func (s *ConfirmationService) FinishPasskey(user User, sessionToken string, response []byte) (string, error) {
+	asserted, err := s.WebAuthnService.FinishLogin(sessionToken, response)
+	if err != nil {
+		return "", err
+	}
+	if asserted.ID != user.ID {
+		return "", ErrWebAuthnCeremonyFailed
+	}
+	return s.issue(user)
+}
+
+// confirmationFailed answers a request whose confirmation failed and
+// reports whether err was such a failure.
+func (h *Handler) confirmationFailed(c *gin.Context, user User, err error) bool {
+	switch {
+	case errors.Is(err, ErrConfirmationRequired):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "confirm_with": ConfirmationMethods(user)})
+	case errors.Is(err, ErrPasswordMismatch), errors.Is(err, ErrInvalidMFACode), errors.Is(err, ErrInvalidToken):
+		h.recordLoginFailure(c, user.Username)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Password, code or confirmation is incorrect"})
+	default:
+		return false
+	}
+	return true
+}
+
+// SendConfirmationLink godoc
+//
+//	@Summary		Mail a confirmation link
+//	@Description	Mail a single-use link to the verified address of the current user. Its token confirms one sensitive change as confirmation_token, for accounts without a password or second factor code.
+//	@Security		ApiKeyAuth
+//	@Tags			account
+//	@Produce		json
+//	@Success		200	{object}	Response
+//	@Failure		400	{object}	Response
+//	@Failure		500	{object}	Response
+//	@Router			/api/me/confirm/email [post]
+func (h *Handler) SendConfirmationLink(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	err := h.ConfirmationService.SendLink(c.Request.Context(), user)
+	if errors.Is(err, ErrInvalidEmail) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No verified email address on file"})
+		return
+	}
+	if err != nil {
+		log.Printf("Unable to send confirmation link: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to send confirmation link"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Confirmation link sent"})
+}
+
+// BeginPasskeyConfirmation godoc
+//
+//	@Summary		Start a passkey confirmation
+//	@Description	Return assertion options for confirming a sensitive change with one of the current user's passkeys
+//	@Security		ApiKeyAuth
+//	@Tags			account
+//	@Produce		json
+//	@Success		200	{object}	Response
+//	@Failure		400	{object}	Response
+//	@Failure		500	{object}	Response
+//	@Router			/api/me/confirm/webauthn/begin [post]
+func (h *Handler) BeginPasskeyConfirmation(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if len(user.WebAuthnCredentials) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No passkeys registered"})
+		return
+	}
+	options, token, err := h.WebAuthnService.BeginLogin(&user, false)
+	if err != nil {
+		log.Printf("Unable to start passkey confirmation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to start passkey confirmation"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"session_token": token, "options": options})
+}
+
+// FinishPasskeyConfirmation godoc
+//
+//	@Summary		Finish a passkey confirmation
+//	@Description	Verify the passkey assertion and return a confirmation_token for one sensitive change
+//	@Security		ApiKeyAuth
+//	@Tags			account
+//	@Accept			json
+//	@Produce		json
+//	@Param			input	body		object{session_token=string,credential=object}	true	"Session token and navigator.credentials.get() result"
+//	@Success		200		{object}	Response
+//	@Failure		400		{object}	Response
+//	@Failure		401		{object}	Response
+//	@Router			/api/me/confirm/webauthn/finish [post]
+func (h *Handler) FinishPasskeyConfirmation(c *gin.Context) {
+	var input webauthnFinishInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	token, err := h.ConfirmationService.FinishPasskey(user, input.SessionToken, input.Credential)
+	if err != nil {
+		log.Printf("Passkey confirmation failed: %v", err)
+		h.recordLoginFailure(c, user.Username)
+		c.JSON(webauthnErrorStatus(err), gin.H{"error": "Passkey verification failed"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"confirmation_token": token, "expires_in": int(confirmationTTL.Seconds())})
+}
@@ -0,0 +1,379 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposeEmailRevert       = "email_revert"
+)
+
+// emailRevertTTL is how long the link mailed to the previous address after
+// an email change can undo it. It is longer than a verification link
+// because the owner may not read that mailbox every day.
+const emailRevertTTL = 7 * 24 * time.Hour
+
+var (
+	ErrInvalidEmail = errors.New("invalid email address")
+	ErrEmailTaken   = errors.New("email address is already in use")
+)
+
+// NormalizeEmail trims and lower-cases an address and rejects anything that
+// is not a bare addr-spec such as "Name <a@b>".
+func NormalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	parsed, err := mail.ParseAddress(email)
+	if err != nil || parsed.Address != email {
+		return "", ErrInvalidEmail
+	}
+	return email, nil
+}
+
+type EmailVerificationService struct {
+	Tokens      TokenRepositoryInterface
+	UserService *UserService
+	Mailer      Mailer
+	PublicURL   string
+	TTL         time.Duration
+	// Confirmations checks that email changes come from the account owner.
+	Confirmations *ConfirmationService
+	// SessionService, when set, has the user's sessions revoked when an
+	// email change is reverted.
+	SessionService *SessionService
+}
+
+func NewEmailVerificationService(tokens TokenRepositoryInterface, userService *UserService, mailer Mailer, publicURL string, ttl time.Duration) *EmailVerificationService {
+	return &EmailVerificationService{
+		Tokens:      tokens,
+		UserService: userService,
+		Mailer:      mailer,
+		PublicURL:   strings.TrimRight(publicURL, "/"),
+		TTL:         ttl,
+	}
+}
+
+// SendVerification replaces any pending verification token for the user
+// and mails a fresh link to their current address.
+func (s *EmailVerificationService) SendVerification(ctx context.Context, user User) error {
+	if user.Email == "" || user.EmailVerified {
+		return nil
+	}
+	userID := user.ID.Hex()
+	if err := s.Tokens.DeleteUserTokens(userID, TokenPurposeEmailVerification); err != nil {
+		return err
+	}
+	raw, hash, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	err = s.Tokens.CreateToken(OneTimeToken{
+		Hash:      hash,
+		Purpose:   TokenPurposeEmailVerification,
+		UserID:    userID,
+		Email:     user.Email,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.TTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := s.PublicURL + "/verify-email?token=" + url.QueryEscape(raw)
+	return s.Mailer.Send(ctx, MailMessage{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below. It expires in %s.\n\n%s\n",
+			user.Username, s.TTL, link),
+	})
+}
+
+// Verify redeems a verification token. Tokens issued for an address the
+// user has since changed are rejected.
+func (s *EmailVerificationService) Verify(raw string) (User, error) {
+	token, err := s.Tokens.ConsumeToken(TokenPurposeEmailVerification, hashToken(raw), time.Now())
+	if err != nil {
+		return User{}, ErrInvalidToken
+	}
+	user, err := s.UserService.GetUserByID(token.UserID)
+	if err != nil {
+		return User{}, err
+	}
+	if user.Email != token.Email {
+		return User{}, ErrInvalidToken
+	}
+	return s.UserService.UpdateUser(user.ID, bson.M{"email_verified": true})
+}
+
+// ChangeEmail sets a new, unverified address and sends a verification link
+// to it. The user confirms the change with a factor they have, and the
+// previous address is sent a link that reverts it.
+func (s *EmailVerificationService) ChangeEmail(ctx context.Context, user User, email string, proof Confirmation) (User, error) {
+	email, err := NormalizeEmail(email)
+	if err != nil {
+		return User{}, err
+	}
+	if err := s.Confirmations.Confirm(user, proof); err != nil {
+		return User{}, err
+	}
+	if existing, err := s.UserService.GetUserByEmail(email); err == nil && existing.ID != user.ID {
+		return User{}, ErrEmailTaken
+	}
+	updated, err := s.UserService.UpdateUser(user.ID, bson.M{"email": email, "email_verified": false})
+	if mongo.IsDuplicateKeyError(err) {
+		return User{}, ErrEmailTaken
+	}
+	if err != nil {
+		return User{}, err
+	}
+	if user.Email != "" && user.Email != email {
+		if err := s.sendChangeNotice(ctx, user, email); err != nil {
+			log.Printf("Unable to notify %s of the email change: %v", user.Username, err)
+		}
+	}
+	return updated, s.SendVerification(ctx, updated)
+}
+
+// sendChangeNotice tells the previous address about an email change, with
+// a link that restores it in case the change was not the owner's.
+func (s *EmailVerificationService) sendChangeNotice(ctx context.Context, user User, email string) error {
+	raw, hash, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	err = s.Tokens.CreateToken(OneTimeToken{
+		Hash:      hash,
+		Purpose:   TokenPurposeEmailRevert,
+		UserID:    user.ID.Hex(),
+		Email:     user.Email,
+		CreatedAt: now,
+		ExpiresAt: now.Add(emailRevertTTL),
+		Data:      map[string]string{"verified": fmt.Sprint(user.EmailVerified)},
+	})
+	if err != nil {
+		return err
+	}
+
+	link := s.PublicURL + "/revert-email?token=" + url.QueryEscape(raw)
+	return s.Mailer.Send(ctx, MailMessage{
+		To:      user.Email,
+		Subject: "Your email address was changed",
+		Body: fmt.Sprintf("Hi %s,\n\nThe email address of your account was changed to %s. If you did not do this, open the link below within %s to restore this address and sign out everywhere, then reset your password.\n\n%s\n",
+			user.Username, email, emailRevertTTL, link),
+	})
+}
+
+// RevertEmail redeems the link sent to a previous address, restoring it
+// and revoking the user's sessions.
+func (s *EmailVerificationService) RevertEmail(raw string) (User, error) {
+	token, err := s.Tokens.ConsumeToken(TokenPurposeEmailRevert, hashToken(raw), time.Now())
+	if err != nil {
+		return User{}, ErrInvalidToken
+	}
+	user, err := s.UserService.GetUserByID(token.UserID)
+	if err != nil {
+		return User{}, err
+	}
+	updated, err := s.UserService.UpdateUser(user.ID, bson.M{"email": token.Email, "email_verified": token.Data["verified"] == "true"})
+	if mongo.IsDuplicateKeyError(err) {
+		return User{}, ErrEmailTaken
+	}
+	if err != nil {
+		return User{}, err
+	}
+	log.Printf("Email change of %s reverted", user.Username)
+	if s.SessionService != nil {
+		return updated, s.SessionService.RevokeUserSessions(user.ID.Hex())
+	}
+	return updated, nil
+}
+
+// VerifiedEmailMiddleware rejects requests from users who have not yet
+// confirmed their email address. It is a no-op unless required is set.
+func VerifiedEmailMiddleware(userService *UserService, required bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !required {
+			c.Next()
+			return
+		}
+		username, _ := c.Get("username")
+		name, _ := username.(string)
+		user, err := userService.GetUserByUsername(name)
+		if err != nil {
+			log.Printf("Unable to fetch user: %v", err)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing or invalid token"})
+			c.Abort()
+			return
+		}
+		if !user.EmailVerified {
+			log.Printf("User %s has not verified their email", name)
+			c.JSON(http.StatusForbidden, gin.H{"error": "Please verify your email address first"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// VerifyEmail godoc
+//
+//	@Summary		Verify an email address
+//	@Description	Confirm the email address of an account using the token from the verification mail
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			input	body		object{token=string}	true	"Verification token"
+//	@Success		200		{object}	Response
+//	@Failure		400		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/auth/verify-email [post]
+func (h *Handler) VerifyEmail(c *gin.Context) {
+	var input struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	_, err := h.EmailVerificationService.Verify(input.Token)
+	if errors.Is(err, ErrInvalidToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+	if err != nil {
+		log.Printf("Unable to verify email: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to verify email"})
+		return
+	}
+	log.Println("Email verified successfully")
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+// ResendVerificationEmail godoc
+//
+//	@Summary		Resend the verification email
+//	@Description	Send a new verification link to the current user's email address
+//	@Security		ApiKeyAuth
+//	@Tags			users
+//	@Produce		json
+//	@Success		200	{object}	Response
+//	@Failure		400	{object}	Response
+//	@Failure		500	{object}	Response
+//	@Router			/api/me/verify-email/resend [post]
+func (h *Handler) ResendVerificationEmail(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if user.Email == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No email address on file"})
+		return
+	}
+	if user.EmailVerified {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email address is already verified"})
+		return
+	}
+	if err := h.EmailVerificationService.SendVerification(c.Request.Context(), user); err != nil {
+		log.Printf("Unable to send verification email: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to send verification email"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+}
+
+// ChangeEmail godoc
+//
+//	@Summary		Change email address
+//	@Description	Set a new email address for the current user and send a verification link to it. The change is confirmed with current_password, a TOTP or recovery code, or a confirmation_token from a passkey or a mailed link. The previous address is mailed a link that reverts the change.
+//	@Security		ApiKeyAuth
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			input	body		object{email=string,current_password=string,code=string,confirmation_token=string}	true	"New email address and confirmation"
+//	@Success		200		{object}	Response
+//	@Failure		400		{object}	Response
+//	@Failure		403		{object}	Response
+//	@Failure		409		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/api/me/email [put]
+func (h *Handler) ChangeEmail(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required"`
+		Confirmation
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	updated, err := h.EmailVerificationService.ChangeEmail(c.Request.Context(), user, input.Email, input.Confirmation)
+	switch {
+	case h.confirmationFailed(c, user, err):
+	case errors.Is(err, ErrInvalidEmail):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email address"})
+	case errors.Is(err, ErrEmailTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": "Email address is already in use"})
+	case err != nil:
+		log.Printf("Unable to change email: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to change email"})
+	default:
+		h.auditUser(c, AuditAccountEmail, &user, &updated)
+		c.JSON(http.StatusOK, gin.H{"message": "Email updated, please check your inbox to verify it"})
+	}
+}
+
+// RevertEmail godoc
+//
+//	@Summary		Revert an email change
+//	@Description	Restore the previous email address of an account using the token mailed to it after the change, and sign the account out everywhere
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			input	body		object{token=string}	true	"Revert token"
+//	@Success		200		{object}	Response
+//	@Failure		400		{object}	Response
+//	@Failure		409		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/auth/email/revert [post]
+func (h *Handler) RevertEmail(c *gin.Context) {
+	var input struct {
+		Token string `json:"token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.EmailVerificationService.RevertEmail(input.Token)
+	switch {
+	case errors.Is(err, ErrInvalidToken):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+	case errors.Is(err, ErrEmailTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": "Email address is already in use"})
+	case err != nil:
+		log.Printf("Unable to revert email change: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to revert email change"})
+	default:
+		h.auditUser(c, AuditAccountEmail, nil, &user)
+		c.JSON(http.StatusOK, gin.H{"message": "Email address restored, please sign in again and reset your password"})
+	}
+}
@@ -0,0 +1,385 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Takeso-user/blog-backend/config"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	EventCommentCreated  = "comment.created"
+	EventCommentUpdated  = "comment.updated"
+	EventCommentDeleted  = "comment.deleted"
+	EventPostUpdated     = "post.updated"
+	EventPostDeleted     = "post.deleted"
+	EventReactionUpdated = "reaction.updated"
+	EventNotification    = "notification"
+	// EventReset tells a reconnecting client that events it missed are no
+	// longer available, so it should reload what it shows.
+	EventReset = "reset"
+	// EventUserSignedOut ends the streams of a user on every instance. It
+	// is never sent to clients.
+	EventUserSignedOut = "user.signed_out"
+	// EventFeedPost and EventFeedForget keep the feed caches of every
+	// instance up to date. They are never sent to clients.
+	EventFeedPost   = "feed.post"
+	EventFeedForget = "feed.forget"
+)
+
+var ErrTooManyStreams = errors.New("too many open streams")
+
+// PostTopic is the topic of the changes to a post and its comments.
+func PostTopic(postID string) string {
+	return "post:" + postID
+}
+
+// UserTopic is the topic of the events only the user may see.
+func UserTopic(userID string) string {
+	return "user:" + userID
+}
+
+// MemoryEventBroker delivers events within one instance.
+type MemoryEventBroker struct {
+	mu          sync.Mutex
+	subscribers map[int]func(Event)
+	next        int
+}
+
+func NewMemoryEventBroker() *MemoryEventBroker {
+	return &MemoryEventBroker{subscribers: map[int]func(Event){}}
+}
+
+func (b *MemoryEventBroker) Publish(event Event) error {
+	// Holding the lock while delivering keeps every subscriber seeing
+	// events in the same order.
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, deliver := range b.subscribers {
+		deliver(event)
+	}
+	return nil
+}
+
+func (b *MemoryEventBroker) Subscribe(deliver func(Event)) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	id := b.next
+	b.next++
+	b.subscribers[id] = deliver
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subscribers, id)
+	}
+}
+
+// MongoEventBroker shares events between replicas through a capped
+// collection, which every instance reads with a tailable cursor.
+type MongoEventBroker struct {
+	Collection *mongo.Collection
+}
+
+// mongoEventSkew is how far back a reopened cursor looks, to catch events
+// stamped by replicas whose clocks run behind.
+const mongoEventSkew = time.Minute
+
+func NewMongoEventBroker(db *mongo.Database, name string, size int64) *MongoEventBroker {
+	err := db.CreateCollection(context.TODO(), name, options.CreateCollection().SetCapped(true).SetSizeInBytes(size))
+	var commandErr mongo.CommandError
+	if err != nil && !(errors.As(err, &commandErr) && commandErr.Name == "NamespaceExists") {
+		log.Printf("Error creating events collection: %v", err)
+	}
+	return &MongoEventBroker{Collection: db.Collection(name)}
+}
+
+func (b *MongoEventBroker) Publish(event Event) error {
+	_, err := b.Collection.InsertOne(context.TODO(), event)
+	if err != nil {
+		log.Printf("Error publishing event: %v", err)
+	}
+	return err
+}
+
+// Subscribe delivers the events in the collection, starting with those
+// already there, and then each new one. When the cursor dies it is
+// reopened shortly after, skipping the events already delivered.
+func (b *MongoEventBroker) Subscribe(deliver func(Event)) func() {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		seen := map[string]time.Time{}
+		filter := bson.M{}
+		for ctx.Err() == nil {
+			opts := options.Find().SetCursorType(options.TailableAwait).SetMaxAwaitTime(time.Second)
+			cursor, err := b.Collection.Find(ctx, filter, opts)
+			if err == nil {
+				var latest time.Time
+				for cursor.Next(ctx) {
+					var event Event
+					if err := cursor.Decode(&event); err != nil {
+						log.Printf("Error decoding event: %v", err)
+						continue
+					}
+					if _, ok := seen[event.ID]; !ok {
+						seen[event.ID] = event.CreatedAt
+						deliver(event)
+					}
+					if event.CreatedAt.After(latest) {
+						latest = event.CreatedAt
+					}
+				}
+				err = cursor.Err()
+				if err := cursor.Close(context.TODO()); err != nil {
+					log.Printf("Error closing cursor: %v", err)
+				}
+				if !latest.IsZero() {
+					since := latest.Add(-mongoEventSkew)
+					filter = bson.M{"created_at": bson.M{"$gte": since}}
+					for id, createdAt := range seen {
+						if createdAt.Before(since) {
+							delete(seen, id)
+						}
+					}
+				}
+			}
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Error reading events: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Second):
+			}
+		}
+	}()
+	return cancel
+}
+
+// EventBus fans the events from the broker out to the streams of this
+// instance. It keeps the most recent events so that a client reconnecting
+// with the ID of the last event it got receives the ones it missed.
+type EventBus struct {
+	Broker EventBroker
+	Config config.EventsConfig
+
+	mu          sync.Mutex
+	history     []Event
+	subscribers map[*Subscription]struct{}
+	streams     map[string]int
+	handlers    map[string]func(Event)
+	stop        func()
+}
+
+func NewEventBus(broker EventBroker, cfg config.EventsConfig) *EventBus {
+	b := &EventBus{
+		Broker:      broker,
+		Config:      cfg,
+		subscribers: map[*Subscription]struct{}{},
+		streams:     map[string]int{},
+		handlers:    map[string]func(Event){},
+	}
+	b.stop = broker.Subscribe(b.deliver)
+	return b
+}
+
+// Publish sends an event to every instance. Failures are logged; clients
+// that miss an event catch up when they reload.
+func (b *EventBus) Publish(topic, eventType string, data interface{}) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Error encoding %s event: %v", eventType, err)
+		return
+	}
+	event := Event{
+		ID:        primitive.NewObjectID().Hex(),
+		Topic:     topic,
+		Type:      eventType,
+		Data:      payload,
+		CreatedAt: time.Now(),
+	}
+	if err := b.Broker.Publish(event); err != nil {
+		log.Printf("Error publishing %s event: %v", eventType, err)
+	}
+}
+
+// Subscribe opens a stream of the user's events on the given topics. With
+// the ID of the last event the client got, it also returns the events on
+// those topics that came after it, or reports them missed when that event
+// is no longer remembered.
+func (b *EventBus) Subscribe(userID string, topics []string, lastEventID string) (*Subscription, []Event, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.streams[userID] >= b.Config.MaxStreamsPerUser {
+		return nil, nil, false, ErrTooManyStreams
+	}
+	sub := &Subscription{
+		bus:    b,
+		userID: userID,
+		topics: topics,
+		events: make(chan Event, b.Config.Buffer),
+		done:   make(chan struct{}),
+	}
+	var replay []Event
+	missed := false
+	if lastEventID != "" {
+		i := slices.IndexFunc(b.history, func(e Event) bool { return e.ID == lastEventID })
+		if i < 0 {
+			missed = true
+		} else {
+			for _, event := range b.history[i+1:] {
+				if sub.wants(event) {
+					replay = append(replay, event)
+				}
+			}
+		}
+	}
+	b.subscribers[sub] = struct{}{}
+	b.streams[userID]++
+	return sub, replay, missed, nil
+}
+
+// Close ends all streams and stops receiving events.
+func (b *EventBus) Close() {
+	b.stop()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subscribers {
+		b.drop(sub)
+	}
+}
+
+// DropUser ends the user's streams on every instance, once their sessions
+// have been revoked.
+func (b *EventBus) DropUser(userID string) {
+	b.Publish(UserTopic(userID), EventUserSignedOut, nil)
+}
+
+// Handle passes the events of the given type to handle on this instance
+// instead of sending them to streams.
+func (b *EventBus) Handle(eventType string, handle func(Event)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[eventType] = handle
+}
+
+func (b *EventBus) deliver(event Event) {
+	b.mu.Lock()
+	handle, ok := b.handlers[event.Type]
+	b.mu.Unlock()
+	if ok {
+		handle(event)
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if event.Type == EventUserSignedOut {
+		for sub := range b.subscribers {
+			if UserTopic(sub.userID) == event.Topic {
+				b.drop(sub)
+			}
+		}
+		return
+	}
+	b.history = append(b.history, event)
+	if extra := len(b.history) - b.Config.History; extra > 0 {
+		b.history = slices.Delete(b.history, 0, extra)
+	}
+	for sub := range b.subscribers {
+		if !sub.wants(event) {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			// The client can't keep up. Dropping it makes it reconnect
+			// and replay what it missed.
+			b.drop(sub)
+		}
+	}
+}
+
+func (b *EventBus) drop(sub *Subscription) {
+	if _, ok := b.subscribers[sub]; !ok {
+		return
+	}
+	delete(b.subscribers, sub)
+	if b.streams[sub.userID]--; b.streams[sub.userID] <= 0 {
+		delete(b.streams, sub.userID)
+	}
+	close(sub.done)
+}
+
+// Subscription is one client's stream of events.
+type Subscription struct {
+	bus    *EventBus
+	userID string
+	topics []string
+	events chan Event
+	done   chan struct{}
+}
+
+// Events delivers the subscribed events as they happen.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Done is closed when the stream ends, because it was closed or because
+// the client fell too far behind.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.bus.drop(s)
+}
+
+func (s *Subscription) wants(event Event) bool {
+	return slices.Contains(s.topics, event.Topic)
+}
+
+// publishComment tells the followers of a post about a change to one of
+// its comments.
+func (s *CommentService) publishComment(eventType, postID string, data interface{}) {
+	if s.Events != nil {
+		s.Events.Publish(PostTopic(postID), eventType, data)
+	}
+}
+
+// publishPost tells the followers of a post that it changed.
+func (s *PostService) publishPost(eventType, postID string, data interface{}) {
+	if s.Events != nil {
+		s.Events.Publish(PostTopic(postID), eventType, data)
+	}
+}
+
+// publishReactions tells the followers of a post about the new reaction
+// counts of the post or one of its comments.
+func (s *ReactionService) publishReactions(targetType, targetID string, counts map[string]int64) {
+	if s.Events == nil {
+		return
+	}
+	postID := targetID
+	if targetType == ReactionOnComment {
+		comment, err := s.Comments.Repository.GetCommentByID(targetID)
+		if err != nil {
+			return
+		}
+		postID = comment.PostID
+	}
+	s.Events.Publish(PostTopic(postID), EventReactionUpdated, gin.H{
+		"target_type": targetType,
+		"target_id":   targetID,
+		"reactions":   counts,
+	})
+}
@@ -0,0 +1,517 @@
+package pkg
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Takeso-user/blog-backend/config"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+var (
+	ErrExportInProgress = errors.New("an export is already being prepared")
+	ErrExportNotReady   = errors.New("export is not ready yet")
+)
+
+type ExportRepository struct {
+	Collection *mongo.Collection
+}
+
+func NewExportRepository(collection *mongo.Collection) *ExportRepository {
+	_, err := collection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.M{"token_hash": 1}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.M{"user_id": 1}},
+		{Keys: bson.M{"expires_at": 1}},
+	})
+	if err != nil {
+		log.Printf("Error creating export indexes: %v", err)
+	}
+	return &ExportRepository{Collection: collection}
+}
+
+func (r *ExportRepository) CreateExport(export DataExport) error {
+	log.Println("Creating export for user:", export.UserID)
+	_, err := r.Collection.InsertOne(context.TODO(), export)
+	if err != nil {
+		log.Printf("Error creating export: %v", err)
+	}
+	return err
+}
+
+func (r *ExportRepository) GetUserExports(userID string) ([]DataExport, error) {
+	log.Println("Getting exports for user:", userID)
+	return r.find(bson.M{"user_id": userID})
+}
+
+func (r *ExportRepository) GetExportByTokenHash(hash string) (DataExport, error) {
+	var export DataExport
+	err := r.Collection.FindOne(context.TODO(), bson.M{"token_hash": hash}).Decode(&export)
+	if err != nil {
+		log.Printf("Error getting export: %v", err)
+	}
+	return export, err
+}
+
+func (r *ExportRepository) UpdateExport(id primitive.ObjectID, updateFields bson.M) error {
+	log.Println("Updating export:", id.Hex())
+	_, err := r.Collection.UpdateByID(context.TODO(), id, bson.M{"$set": updateFields})
+	if err != nil {
+		log.Printf("Error updating export: %v", err)
+	}
+	return err
+}
+
+func (r *ExportRepository) GetExpiredExports(now time.Time) ([]DataExport, error) {
+	return r.find(bson.M{"expires_at": bson.M{"$lte": now}})
+}
+
+func (r *ExportRepository) DeleteExport(id primitive.ObjectID) error {
+	log.Println("Deleting export:", id.Hex())
+	_, err := r.Collection.DeleteOne(context.TODO(), bson.M{"_id": id})
+	if err != nil {
+		log.Printf("Error deleting export: %v", err)
+	}
+	return err
+}
+
+func (r *ExportRepository) find(filter bson.M) ([]DataExport, error) {
+	opts := options.Find().SetSort(bson.M{"created_at": -1})
+	cursor, err := r.Collection.Find(context.TODO(), filter, opts)
+	if err != nil {
+		log.Printf("Error getting exports: %v", err)
+		return nil, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Printf("Error closing cursor: %v", err)
+		}
+	}(cursor, context.TODO())
+
+	exports := []DataExport{}
+	if err = cursor.All(context.TODO(), &exports); err != nil {
+		log.Printf("Error decoding exports: %v", err)
+		return nil, err
+	}
+	return exports, nil
+}
+
+// ExportSection is one file of a personal data export. Collect returns the
+// data to be written as <Name>.json; slices are counted in the index.
+type ExportSection struct {
+	Name    string
+	Title   string
+	Collect func(user User) (interface{}, error)
+}
+
+// profileExport is the account itself. Password hashes, TOTP secrets,
+// recovery codes and passkey keys are left out: they are credentials, not
+// information about the user, and would only be a risk in a downloaded file.
+type profileExport struct {
+	ID            string               `json:"id"`
+	Username      string               `json:"username"`
+	Role          string               `json:"role"`
+	Email         string               `json:"email,omitempty"`
+	EmailVerified bool                 `json:"email_verified"`
+	HasPassword   bool                 `json:"has_password"`
+	TOTPEnabled   bool                 `json:"totp_enabled"`
+	Identities    []identityExport     `json:"identities"`
+	Passkeys      []WebAuthnCredential `json:"passkeys"`
+}
+
+type identityExport struct {
+	Provider string    `json:"provider"`
+	Subject  string    `json:"subject"`
+	Email    string    `json:"email,omitempty"`
+	LinkedAt time.Time `json:"linked_at"`
+}
+
+func ProfileExportSection() ExportSection {
+	return ExportSection{Name: "profile", Title: "Profile", Collect: func(user User) (interface{}, error) {
+		profile := profileExport{
+			ID:            user.ID.Hex(),
+			Username:      user.Username,
+			Role:          user.Role,
+			Email:         user.Email,
+			EmailVerified: user.EmailVerified,
+			HasPassword:   user.Password != "",
+			TOTPEnabled:   user.TOTPEnabled,
+			Identities:    []identityExport{},
+			Passkeys:      user.WebAuthnCredentials,
+		}
+		for _, identity := range user.Identities {
+			profile.Identities = append(profile.Identities, identityExport(identity))
+		}
+		if profile.Passkeys == nil {
+			profile.Passkeys = []WebAuthnCredential{}
+		}
+		return profile, nil
+	}}
+}
+
+func PostsExportSection(postService *PostService) ExportSection {
+	return ExportSection{Name: "posts", Title: "Posts", Collect: func(user User) (interface{}, error) {
+		return postService.Repository.GetPostsByAuthor(user.Username)
+	}}
+}
+
+func CommentsExportSection(commentService *CommentService) ExportSection {
+	return ExportSection{Name: "comments", Title: "Comments", Collect: func(user User) (interface{}, error) {
+		return commentService.Repository.GetCommentsByUser(user.ID.Hex())
+	}}
+}
+
+func SessionsExportSection(sessionService *SessionService) ExportSection {
+	return ExportSection{Name: "sessions", Title: "Sessions", Collect: func(user User) (interface{}, error) {
+		return sessionService.GetUserSessions(user.ID.Hex())
+	}}
+}
+
+func AccessTokensExportSection(accessTokenService *AccessTokenService) ExportSection {
+	return ExportSection{Name: "access_tokens", Title: "Personal access tokens", Collect: func(user User) (interface{}, error) {
+		return accessTokenService.GetUserTokens(user.ID.Hex())
+	}}
+}
+
+// ExportService builds personal data exports in the background. Archives
+// are written to Dir and removed, together with their records, by
+// PurgeExpired once they expire.
+type ExportService struct {
+	Repository ExportRepositoryInterface
+	Mailer     Mailer
+	Dir        string
+	TTL        time.Duration
+	PublicURL  string
+	Sections   []ExportSection
+
+	jobs sync.WaitGroup
+}
+
+func NewExportService(repository ExportRepositoryInterface, mailer Mailer, cfg config.ExportConfig, publicURL string, sections ...ExportSection) *ExportService {
+	return &ExportService{
+		Repository: repository,
+		Mailer:     mailer,
+		Dir:        cfg.Dir,
+		TTL:        cfg.TTL,
+		PublicURL:  strings.TrimRight(publicURL, "/"),
+		Sections:   sections,
+	}
+}
+
+// Start records a new export and builds it in the background. It returns
+// the download link, which works once the export is ready. Only one export
+// per user is prepared at a time.
+func (s *ExportService) Start(user User) (DataExport, string, error) {
+	userID := user.ID.Hex()
+	exports, err := s.Repository.GetUserExports(userID)
+	if err != nil {
+		return DataExport{}, "", err
+	}
+	for _, export := range exports {
+		if export.Status == ExportPending {
+			return DataExport{}, "", ErrExportInProgress
+		}
+	}
+
+	raw, hash, err := newOpaqueToken()
+	if err != nil {
+		return DataExport{}, "", err
+	}
+	now := time.Now()
+	export := DataExport{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Status:    ExportPending,
+		TokenHash: hash,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.TTL),
+	}
+	if err := s.Repository.CreateExport(export); err != nil {
+		return DataExport{}, "", err
+	}
+
+	link := s.PublicURL + "/exports/" + raw
+	s.jobs.Add(1)
+	go func() {
+		defer s.jobs.Done()
+		s.build(export, user, link)
+	}()
+	return export, link, nil
+}
+
+// Wait blocks until all running exports have finished.
+func (s *ExportService) Wait() {
+	s.jobs.Wait()
+}
+
+func (s *ExportService) build(export DataExport, user User, link string) {
+	size, err := s.writeFile(export, user)
+	if err != nil {
+		log.Printf("Export %s failed: %v", export.ID.Hex(), err)
+		if err := s.Repository.UpdateExport(export.ID, bson.M{"status": ExportFailed, "error": "Unable to collect data"}); err != nil {
+			log.Printf("Error marking export as failed: %v", err)
+		}
+		return
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(s.TTL)
+	if err := s.Repository.UpdateExport(export.ID, bson.M{"status": ExportReady, "size": size, "completed_at": now, "expires_at": expiresAt}); err != nil {
+		return
+	}
+	log.Printf("Export %s is ready", export.ID.Hex())
+
+	if s.Mailer == nil || user.Email == "" || !user.EmailVerified {
+		return
+	}
+	err = s.Mailer.Send(context.Background(), MailMessage{
+		To:      user.Email,
+		Subject: "Your data export is ready",
+		Body: fmt.Sprintf("Hi %s,\n\nThe copy of your data you requested is ready. Download it from the link below before %s.\n\n%s\n",
+			user.Username, expiresAt.UTC().Format(time.RFC1123), link),
+	})
+	if err != nil {
+		log.Printf("Error mailing export link: %v", err)
+	}
+}
+
+func (s *ExportService) writeFile(export DataExport, user User) (int64, error) {
+	if err := os.MkdirAll(s.Dir, 0o700); err != nil {
+		return 0, err
+	}
+	path := s.path(export)
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	err = s.WriteArchive(file, user, time.Now())
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return 0, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (s *ExportService) path(export DataExport) string {
+	return filepath.Join(s.Dir, export.ID.Hex()+".zip")
+}
+
+type exportIndexSection struct {
+	ExportSection
+	File  string
+	Count int
+	JSON  string
+}
+
+var exportIndexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Personal data of {{.Username}}</title>
+<style>body{font-family:sans-serif;max-width:60em;margin:2em auto;padding:0 1em}pre{background:#f4f4f4;padding:1em;overflow:auto}</style>
+</head>
+<body>
+<h1>Personal data of {{.Username}}</h1>
+<p>Exported on {{.Generated}}. Each section below is also included as a JSON file in this archive.</p>
+<ul>
+{{- range .Sections}}
+<li><a href="#{{.Name}}">{{.Title}}</a> ({{.Count}}) &mdash; <a href="{{.File}}">{{.File}}</a></li>
+{{- end}}
+</ul>
+{{- range .Sections}}
+<h2 id="{{.Name}}">{{.Title}}</h2>
+<pre>{{.JSON}}</pre>
+{{- end}}
+</body>
+</html>
+`))
+
+// WriteArchive writes a ZIP with one JSON file per section and an
+// index.html that presents all of them.
+func (s *ExportService) WriteArchive(w io.Writer, user User, now time.Time) error {
+	archive := zip.NewWriter(w)
+	sections := make([]exportIndexSection, 0, len(s.Sections))
+	for _, section := range s.Sections {
+		data, err := section.Collect(user)
+		if err != nil {
+			return fmt.Errorf("%s: %w", section.Name, err)
+		}
+		count := 1
+		if value := reflect.ValueOf(data); value.Kind() == reflect.Slice {
+			count = value.Len()
+			if value.IsNil() {
+				data = []interface{}{}
+			}
+		}
+		encoded, err := json.MarshalIndent(data, "", "  ")
+		if err != nil {
+			return fmt.Errorf("%s: %w", section.Name, err)
+		}
+
+		file := section.Name + ".json"
+		if err := writeArchiveFile(archive, file, now, encoded); err != nil {
+			return err
+		}
+		sections = append(sections, exportIndexSection{ExportSection: section, File: file, Count: count, JSON: string(encoded)})
+	}
+
+	var index strings.Builder
+	err := exportIndexTemplate.Execute(&index, map[string]interface{}{
+		"Username":  user.Username,
+		"Generated": now.UTC().Format(time.RFC1123),
+		"Sections":  sections,
+	})
+	if err != nil {
+		return err
+	}
+	if err := writeArchiveFile(archive, "index.html", now, []byte(index.String())); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+func writeArchiveFile(archive *zip.Writer, name string, modified time.Time, data []byte) error {
+	w, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// Open returns the export for a download link and the path of its archive.
+func (s *ExportService) Open(raw string, now time.Time) (DataExport, string, error) {
+	export, err := s.Repository.GetExportByTokenHash(hashToken(raw))
+	if err != nil || !export.ExpiresAt.After(now) || export.Status == ExportFailed {
+		return DataExport{}, "", ErrInvalidToken
+	}
+	if export.Status != ExportReady {
+		return DataExport{}, "", ErrExportNotReady
+	}
+	return export, s.path(export), nil
+}
+
+// PurgeExpired deletes expired archives and their records.
+func (s *ExportService) PurgeExpired(now time.Time) error {
+	exports, err := s.Repository.GetExpiredExports(now)
+	if err != nil {
+		return err
+	}
+	for _, export := range exports {
+		if err := os.Remove(s.path(export)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Error removing export archive: %v", err)
+			continue
+		}
+		if err := s.Repository.DeleteExport(export.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartExport godoc
+//
+//	@Summary		Export personal data
+//	@Description	Start collecting the user's profile, posts, comments, sessions and other data into a ZIP archive. The returned link downloads the archive once it is ready and is also mailed to a verified address.
+//	@Security		ApiKeyAuth
+//	@Tags			account
+//	@Produce		json
+//	@Success		202	{object}	Response
+//	@Failure		409	{object}	Response
+//	@Failure		500	{object}	Response
+//	@Router			/api/me/export [post]
+func (h *Handler) StartExport(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	export, link, err := h.ExportService.Start(user)
+	if err != nil {
+		log.Printf("Unable to start export: %v", err)
+		if errors.Is(err, ErrExportInProgress) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to start export"})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{"export": export, "download_url": link})
+}
+
+// GetExports godoc
+//
+//	@Summary		List data exports
+//	@Description	List the user's data exports and their status
+//	@Security		ApiKeyAuth
+//	@Tags			account
+//	@Produce		json
+//	@Success		200	{object}	Response
+//	@Failure		500	{object}	Response
+//	@Router			/api/me/exports [get]
+func (h *Handler) GetExports(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	exports, err := h.ExportService.Repository.GetUserExports(user.ID.Hex())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to fetch exports"})
+		return
+	}
+	c.JSON(http.StatusOK, exports)
+}
+
+// DownloadExport godoc
+//
+//	@Summary		Download a data export
+//	@Description	Download a finished data export. The link itself is the credential and stops working when the export expires.
+//	@Tags			account
+//	@Produce		application/zip
+//	@Param			token	path		string	true	"Download token"
+//	@Success		200		{file}		binary
+//	@Failure		404		{object}	Response
+//	@Failure		409		{object}	Response
+//	@Router			/exports/{token} [get]
+func (h *Handler) DownloadExport(c *gin.Context) {
+	export, path, err := h.ExportService.Open(c.Param("token"), time.Now())
+	if err != nil {
+		if errors.Is(err, ErrExportNotReady) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "Export not found or expired"})
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	c.FileAttachment(path, "personal-data-"+export.CreatedAt.UTC().Format("2006-01-02")+".zip")
+}
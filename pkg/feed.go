@@ -0,0 +1,718 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Takeso-user/blog-backend/config"
+	"github.com/Takeso-user/in-mem-cache/cache"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	FollowAuthor = "author"
+	FollowTag    = "tag"
+
+	maxFollows = 1000
+
+	// feedTopic carries the changes to the cached posts.
+	feedTopic = "feed"
+)
+
+var (
+	ErrFollowSelf     = errors.New("you cannot follow yourself")
+	ErrTooManyFollows = errors.New("follow limit reached")
+	ErrAuthorNotFound = errors.New("author not found")
+	ErrInvalidCursor  = errors.New("invalid cursor")
+)
+
+// FeedCursor marks the last post of a feed page. Feeds are ordered by
+// creation time and then ID, both descending, so posts published after a
+// page was read never shift the pages after it.
+type FeedCursor struct {
+	CreatedAt time.Time
+	ID        primitive.ObjectID
+}
+
+func feedCursorOf(post Post) *FeedCursor {
+	return &FeedCursor{CreatedAt: post.CreatedAt, ID: post.ID}
+}
+
+// String encodes the cursor for clients. Times are kept to the
+// millisecond, like MongoDB stores them.
+func (c FeedCursor) String() string {
+	raw := strconv.FormatInt(c.CreatedAt.UnixMilli(), 10) + "." + c.ID.Hex()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func ParseFeedCursor(s string) (*FeedCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	millis, id, ok := strings.Cut(string(raw), ".")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	ms, err := strconv.ParseInt(millis, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &FeedCursor{CreatedAt: time.UnixMilli(ms), ID: objectID}, nil
+}
+
+// precedes reports whether post comes after the cursor in a feed.
+func (c *FeedCursor) precedes(post Post) bool {
+	if c == nil {
+		return true
+	}
+	return compareFeedOrder(Post{ID: c.ID, CreatedAt: c.CreatedAt}, post) < 0
+}
+
+// compareFeedOrder orders posts newest first.
+func compareFeedOrder(a, b Post) int {
+	if am, bm := a.CreatedAt.UnixMilli(), b.CreatedAt.UnixMilli(); am != bm {
+		if am > bm {
+			return -1
+		}
+		return 1
+	}
+	return -bytes.Compare(a.ID[:], b.ID[:])
+}
+
+// FeedQuery selects the posts by any of Authors or with any of Tags that
+// come after Before, newest first.
+type FeedQuery struct {
+	Authors []string
+	Tags    []string
+	Before  *FeedCursor
+	Limit   int64
+}
+
+func (q FeedQuery) bson() bson.M {
+	var sources []bson.M
+	if len(q.Authors) > 0 {
+		sources = append(sources, bson.M{"author_id": bson.M{"$in": q.Authors}})
+	}
+	if len(q.Tags) > 0 {
+		sources = append(sources, bson.M{"tags": bson.M{"$in": q.Tags}})
+	}
+	conditions := []bson.M{{"$or": sources}}
+	if q.Before != nil {
+		createdAt := time.UnixMilli(q.Before.CreatedAt.UnixMilli())
+		conditions = append(conditions, bson.M{"$or": []bson.M{
+			{"created_at": bson.M{"$lt": createdAt}},
+			{"created_at": createdAt, "_id": bson.M{"$lt": q.Before.ID}},
+		}})
+	}
+	return bson.M{"$and": conditions}
+}
+
+type FollowRepository struct {
+	Collection *mongo.Collection
+}
+
+func NewFollowRepository(collection *mongo.Collection) *FollowRepository {
+	_, err := collection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "follower_id", Value: 1}, {Key: "kind", Value: 1}, {Key: "target", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "kind", Value: 1}, {Key: "target", Value: 1}}},
+	})
+	if err != nil {
+		log.Printf("Error creating follow indexes: %v", err)
+	}
+	return &FollowRepository{Collection: collection}
+}
+
+// Follow records the follow unless it exists and reports whether it did.
+func (r *FollowRepository) Follow(follow Follow) (bool, error) {
+	filter := bson.M{"follower_id": follow.FollowerID, "kind": follow.Kind, "target": follow.Target}
+	update := bson.M{"$setOnInsert": bson.M{"created_at": follow.CreatedAt}}
+	result, err := r.Collection.UpdateOne(context.TODO(), filter, update, options.Update().SetUpsert(true))
+	// Concurrent upserts of the same follow race to insert it; the loser
+	// finds it exists.
+	if mongo.IsDuplicateKeyError(err) {
+		return false, nil
+	}
+	if err != nil {
+		log.Printf("Error following %s %s: %v", follow.Kind, follow.Target, err)
+		return false, err
+	}
+	return result.UpsertedCount == 1, nil
+}
+
+func (r *FollowRepository) Unfollow(followerID, kind, target string) (bool, error) {
+	result, err := r.Collection.DeleteOne(context.TODO(), bson.M{"follower_id": followerID, "kind": kind, "target": target})
+	if err != nil {
+		log.Printf("Error unfollowing %s %s: %v", kind, target, err)
+		return false, err
+	}
+	return result.DeletedCount == 1, nil
+}
+
+func (r *FollowRepository) GetFollows(followerID string) ([]Follow, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "kind", Value: 1}, {Key: "target", Value: 1}})
+	cursor, err := r.Collection.Find(context.TODO(), bson.M{"follower_id": followerID}, opts)
+	if err != nil {
+		log.Printf("Error getting follows: %v", err)
+		return nil, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Printf("Error closing cursor: %v", err)
+		}
+	}(cursor, context.TODO())
+
+	follows := []Follow{}
+	if err = cursor.All(context.TODO(), &follows); err != nil {
+		log.Printf("Error decoding follows: %v", err)
+		return nil, err
+	}
+	return follows, nil
+}
+
+// CountFollowers maps each of targets that has followers to their number.
+func (r *FollowRepository) CountFollowers(kind string, targets []string) (map[string]int64, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"kind": kind, "target": bson.M{"$in": targets}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$target", "count": bson.M{"$sum": 1}}}},
+	}
+	cursor, err := r.Collection.Aggregate(context.TODO(), pipeline)
+	if err != nil {
+		log.Printf("Error counting followers: %v", err)
+		return nil, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Printf("Error closing cursor: %v", err)
+		}
+	}(cursor, context.TODO())
+
+	var results []struct {
+		Target string `bson:"_id"`
+		Count  int64  `bson:"count"`
+	}
+	if err = cursor.All(context.TODO(), &results); err != nil {
+		log.Printf("Error decoding follower counts: %v", err)
+		return nil, err
+	}
+	counts := make(map[string]int64, len(results))
+	for _, result := range results {
+		counts[result.Target] = result.Count
+	}
+	return counts, nil
+}
+
+func (r *FollowRepository) RenameFollowTarget(kind, from, to string) (int64, error) {
+	result, err := r.Collection.UpdateMany(context.TODO(), bson.M{"kind": kind, "target": from}, bson.M{"$set": bson.M{"target": to}})
+	if err != nil {
+		log.Printf("Error renaming follows of %s %s: %v", kind, from, err)
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+func (r *FollowRepository) DeleteFollowsByFollower(followerID string) (int64, error) {
+	return r.deleteMany(bson.M{"follower_id": followerID})
+}
+
+func (r *FollowRepository) DeleteFollowsByTarget(kind, target string) (int64, error) {
+	return r.deleteMany(bson.M{"kind": kind, "target": target})
+}
+
+func (r *FollowRepository) deleteMany(filter bson.M) (int64, error) {
+	result, err := r.Collection.DeleteMany(context.TODO(), filter)
+	if err != nil {
+		log.Printf("Error deleting follows: %v", err)
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// recentPosts are the newest posts of an author, newest first. Complete
+// is set when they are all the author's posts.
+type recentPosts struct {
+	posts    []Post
+	complete bool
+}
+
+// FeedService builds each user's home feed from the authors and tags they
+// follow. Feeds are assembled on read with one query over the followed
+// sources. Authors with many followers would be read by many such queries,
+// so their recent posts are kept in memory instead, and new posts are
+// added there as they are published.
+type FeedService struct {
+	Follows FollowRepositoryInterface
+	Posts   *PostService
+	Users   *UserService
+	Config  config.FeedConfig
+	// Events, when set by Listen, shares new posts and changes with the
+	// other instances, which would otherwise serve feeds without them
+	// until their cached posts expire.
+	Events *EventBus
+
+	mu        sync.Mutex
+	recent    *cache.Cache
+	followers *cache.Cache
+}
+
+func NewFeedService(follows FollowRepositoryInterface, posts *PostService, users *UserService, cfg config.FeedConfig) *FeedService {
+	return &FeedService{
+		Follows:   follows,
+		Posts:     posts,
+		Users:     users,
+		Config:    cfg,
+		recent:    cache.NewCache(cfg.CacheTTL),
+		followers: cache.NewCache(cfg.CacheTTL),
+	}
+}
+
+// FollowAuthor follows the author with the given username and reports
+// whether the user did not follow them already.
+func (s *FeedService) FollowAuthor(user User, username string) (bool, error) {
+	if username == user.Username {
+		return false, ErrFollowSelf
+	}
+	if _, err := s.Users.GetUserByUsername(username); errors.Is(err, mongo.ErrNoDocuments) {
+		return false, ErrAuthorNotFound
+	} else if err != nil {
+		return false, err
+	}
+	return s.follow(user, FollowAuthor, username)
+}
+
+// FollowTag follows a tag and reports whether the user did not follow it
+// already.
+func (s *FeedService) FollowTag(user User, tag string) (bool, error) {
+	tag = NormalizeTag(tag)
+	if !tagPattern.MatchString(tag) {
+		return false, ErrInvalidTag
+	}
+	return s.follow(user, FollowTag, tag)
+}
+
+func (s *FeedService) follow(user User, kind, target string) (bool, error) {
+	follows, err := s.Follows.GetFollows(user.ID.Hex())
+	if err != nil {
+		return false, err
+	}
+	if len(follows) >= maxFollows {
+		return false, ErrTooManyFollows
+	}
+	created, err := s.Follows.Follow(Follow{FollowerID: user.ID.Hex(), Kind: kind, Target: target, CreatedAt: time.Now()})
+	if kind == FollowAuthor {
+		s.followers.Delete(target)
+	}
+	return created, err
+}
+
+func (s *FeedService) Unfollow(user User, kind, target string) error {
+	if kind == FollowTag {
+		target = NormalizeTag(target)
+	}
+	_, err := s.Follows.Unfollow(user.ID.Hex(), kind, target)
+	if kind == FollowAuthor {
+		s.followers.Delete(target)
+	}
+	return err
+}
+
+// Feed returns the page of the user's feed that comes after cursor, or the
+// first page for a nil cursor, and the cursor of the next page, which is
+// nil on the last one.
+func (s *FeedService) Feed(user User, cursor *FeedCursor, limit int) ([]Post, *FeedCursor, error) {
+	if limit <= 0 {
+		limit = s.Config.PageSize
+	}
+	limit = min(limit, s.Config.MaxPageSize)
+	follows, err := s.Follows.GetFollows(user.ID.Hex())
+	if err != nil {
+		return nil, nil, err
+	}
+	var authors, tags []string
+	for _, follow := range follows {
+		if follow.Kind == FollowAuthor {
+			authors = append(authors, follow.Target)
+		} else {
+			tags = append(tags, follow.Target)
+		}
+	}
+
+	// One more post than the page holds tells whether another page follows.
+	want := limit + 1
+	var posts []Post
+	var queried []string
+	for _, author := range authors {
+		if !s.popular(author) {
+			queried = append(queried, author)
+			continue
+		}
+		recent, err := s.recentPostsOf(author)
+		if err != nil {
+			log.Printf("Unable to load recent posts of %s: %v", author, err)
+			queried = append(queried, author)
+			continue
+		}
+		older := slices.DeleteFunc(slices.Clone(recent.posts), func(post Post) bool { return !cursor.precedes(post) })
+		if len(older) < want && !recent.complete {
+			// The page reaches past the cached posts.
+			queried = append(queried, author)
+			continue
+		}
+		posts = append(posts, older[:min(len(older), want)]...)
+	}
+	if len(queried) > 0 || len(tags) > 0 {
+		found, err := s.Posts.Repository.GetFeedPosts(FeedQuery{Authors: queried, Tags: tags, Before: cursor, Limit: int64(want)})
+		if err != nil {
+			return nil, nil, err
+		}
+		posts = append(posts, found...)
+	}
+
+	slices.SortFunc(posts, compareFeedOrder)
+	posts = slices.CompactFunc(posts, func(a, b Post) bool { return a.ID == b.ID })
+	if len(posts) < want {
+		return posts, nil, nil
+	}
+	posts = posts[:limit]
+	return posts, feedCursorOf(posts[limit-1]), nil
+}
+
+// Listen keeps the cached posts of this instance up to date with the
+// posts published and changed on every instance.
+func (s *FeedService) Listen(events *EventBus) {
+	s.Events = events
+	events.Handle(EventFeedPost, func(event Event) {
+		var post Post
+		if err := json.Unmarshal(event.Data, &post); err != nil {
+			log.Printf("Error decoding feed post: %v", err)
+			return
+		}
+		s.addRecent(post)
+	})
+	events.Handle(EventFeedForget, func(event Event) {
+		var author string
+		if err := json.Unmarshal(event.Data, &author); err != nil {
+			log.Printf("Error decoding feed author: %v", err)
+			return
+		}
+		s.forget(author)
+	})
+}
+
+// Publish adds a new post to the cached posts of its author on every
+// instance.
+func (s *FeedService) Publish(post Post) {
+	if s.Events != nil {
+		s.Events.Publish(feedTopic, EventFeedPost, post)
+		return
+	}
+	s.addRecent(post)
+}
+
+// addRecent adds a post to the cached posts of its author, if there are
+// any; only popular authors have theirs cached.
+func (s *FeedService) addRecent(post Post) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cached, ok := s.recent.Get(post.AuthorID)
+	if !ok {
+		// They are loaded with the post when next read.
+		return
+	}
+	recent := cached.(recentPosts)
+	posts := append([]Post{post}, recent.posts...)
+	if len(posts) > s.Config.CacheSize {
+		posts = posts[:s.Config.CacheSize]
+		recent.complete = false
+	}
+	s.recent.Set(post.AuthorID, recentPosts{posts: posts, complete: recent.complete})
+}
+
+// Forget drops the cached posts of an author on every instance after their
+// posts changed.
+func (s *FeedService) Forget(author string) {
+	if s.Events != nil {
+		s.Events.Publish(feedTopic, EventFeedForget, author)
+		return
+	}
+	s.forget(author)
+}
+
+func (s *FeedService) forget(author string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recent.Delete(author)
+}
+
+// RenameAuthor moves the followers of an author to their new username.
+func (s *FeedService) RenameAuthor(from, to string) error {
+	_, err := s.Follows.RenameFollowTarget(FollowAuthor, from, to)
+	for _, author := range []string{from, to} {
+		s.followers.Delete(author)
+		s.Forget(author)
+	}
+	return err
+}
+
+// RemoveUser deletes what the user follows and who follows them.
+func (s *FeedService) RemoveUser(user User) error {
+	if _, err := s.Follows.DeleteFollowsByFollower(user.ID.Hex()); err != nil {
+		return err
+	}
+	_, err := s.Follows.DeleteFollowsByTarget(FollowAuthor, user.Username)
+	s.followers.Delete(user.Username)
+	s.Forget(user.Username)
+	return err
+}
+
+// popular reports whether an author has enough followers to have their
+// recent posts cached.
+func (s *FeedService) popular(author string) bool {
+	if count, ok := s.followers.Get(author); ok {
+		return count.(int64) >= int64(s.Config.FanoutThreshold)
+	}
+	counts, err := s.Follows.CountFollowers(FollowAuthor, []string{author})
+	if err != nil {
+		log.Printf("Unable to count followers of %s: %v", author, err)
+		return false
+	}
+	s.followers.Set(author, counts[author])
+	return counts[author] >= int64(s.Config.FanoutThreshold)
+}
+
+func (s *FeedService) recentPostsOf(author string) (recentPosts, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if cached, ok := s.recent.Get(author); ok {
+		return cached.(recentPosts), nil
+	}
+	posts, err := s.Posts.Repository.GetFeedPosts(FeedQuery{Authors: []string{author}, Limit: int64(s.Config.CacheSize + 1)})
+	if err != nil {
+		return recentPosts{}, err
+	}
+	recent := recentPosts{posts: posts, complete: len(posts) <= s.Config.CacheSize}
+	if !recent.complete {
+		recent.posts = posts[:s.Config.CacheSize]
+	}
+	s.recent.Set(author, recent)
+	return recent, nil
+}
+
+func FollowsExportSection(feedService *FeedService) ExportSection {
+	return ExportSection{Name: "follows", Title: "Followed authors and tags", Collect: func(user User) (interface{}, error) {
+		return feedService.Follows.GetFollows(user.ID.Hex())
+	}}
+}
+
+func feedError(c *gin.Context, action string, err error) {
+	switch {
+	case errors.Is(err, ErrAuthorNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrFollowSelf), errors.Is(err, ErrInvalidTag), errors.Is(err, ErrInvalidCursor):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrTooManyFollows):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Unable to %s: %v", action, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to " + action})
+	}
+}
+
+// GetFeed godoc
+//
+//	@Summary		Get the home feed
+//	@Description	List the posts of followed authors and tags, newest first. Pass next_cursor as cursor to get the next page; posts published meanwhile do not shift it. next_cursor is missing on the last page.
+//	@Security		ApiKeyAuth
+//	@Tags			feed
+//	@Produce		json
+//	@Param			cursor	query		string	false	"next_cursor of the previous page"
+//	@Param			limit	query		int		false	"Page size"
+//	@Param			format	query		string	false	"markdown or html; both by default"
+//	@Success		200		{object}	Response
+//	@Failure		400		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/api/feed [get]
+func (h *Handler) GetFeed(c *gin.Context) {
+	format, ok := contentFormat(c)
+	if !ok {
+		return
+	}
+	var cursor *FeedCursor
+	if v := c.Query("cursor"); v != "" {
+		var err error
+		if cursor, err = ParseFeedCursor(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	limit := 0
+	if v := c.Query("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	posts, next, err := h.FeedService.Feed(user, cursor, limit)
+	if err != nil {
+		feedError(c, "fetch feed", err)
+		return
+	}
+	for i := range posts {
+		posts[i] = h.PostService.Present(posts[i], format)
+	}
+	h.markPosts(c, posts)
+	response := gin.H{"posts": posts}
+	if next != nil {
+		response["next_cursor"] = next.String()
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetFollows godoc
+//
+//	@Summary		List follows
+//	@Description	List the authors and tags the user follows
+//	@Security		ApiKeyAuth
+//	@Tags			feed
+//	@Produce		json
+//	@Success		200	{object}	Response
+//	@Failure		500	{object}	Response
+//	@Router			/api/me/follows [get]
+func (h *Handler) GetFollows(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	follows, err := h.FeedService.Follows.GetFollows(user.ID.Hex())
+	if err != nil {
+		feedError(c, "fetch follows", err)
+		return
+	}
+	authors, tags := []string{}, []string{}
+	for _, follow := range follows {
+		if follow.Kind == FollowAuthor {
+			authors = append(authors, follow.Target)
+		} else {
+			tags = append(tags, follow.Target)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"authors": authors, "tags": tags})
+}
+
+// FollowAuthor godoc
+//
+//	@Summary		Follow an author
+//	@Description	Add an author's posts to the user's feed. Following an author again changes nothing.
+//	@Security		ApiKeyAuth
+//	@Tags			feed
+//	@Produce		json
+//	@Param			username	path		string	true	"Author's username"
+//	@Success		200			{object}	Response
+//	@Failure		400			{object}	Response
+//	@Failure		403			{object}	Response
+//	@Failure		404			{object}	Response
+//	@Failure		500			{object}	Response
+//	@Router			/api/me/follows/authors/{username} [put]
+func (h *Handler) FollowAuthor(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if _, err := h.FeedService.FollowAuthor(user, c.Param("username")); err != nil {
+		feedError(c, "follow author", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Following " + c.Param("username")})
+}
+
+// UnfollowAuthor godoc
+//
+//	@Summary		Unfollow an author
+//	@Description	Remove an author's posts from the user's feed
+//	@Security		ApiKeyAuth
+//	@Tags			feed
+//	@Produce		json
+//	@Param			username	path		string	true	"Author's username"
+//	@Success		200			{object}	Response
+//	@Failure		500			{object}	Response
+//	@Router			/api/me/follows/authors/{username} [delete]
+func (h *Handler) UnfollowAuthor(c *gin.Context) {
+	h.unfollow(c, FollowAuthor, c.Param("username"))
+}
+
+// FollowTag godoc
+//
+//	@Summary		Follow a tag
+//	@Description	Add posts with a tag to the user's feed. Following a tag again changes nothing.
+//	@Security		ApiKeyAuth
+//	@Tags			feed
+//	@Produce		json
+//	@Param			tag	path		string	true	"Tag"
+//	@Success		200	{object}	Response
+//	@Failure		400	{object}	Response
+//	@Failure		403	{object}	Response
+//	@Failure		500	{object}	Response
+//	@Router			/api/me/follows/tags/{tag} [put]
+func (h *Handler) FollowTag(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if _, err := h.FeedService.FollowTag(user, c.Param("tag")); err != nil {
+		feedError(c, "follow tag", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Following #" + NormalizeTag(c.Param("tag"))})
+}
+
+// UnfollowTag godoc
+//
+//	@Summary		Unfollow a tag
+//	@Description	Remove posts with a tag from the user's feed
+//	@Security		ApiKeyAuth
+//	@Tags			feed
+//	@Produce		json
+//	@Param			tag	path		string	true	"Tag"
+//	@Success		200	{object}	Response
+//	@Failure		500	{object}	Response
+//	@Router			/api/me/follows/tags/{tag} [delete]
+func (h *Handler) UnfollowTag(c *gin.Context) {
+	h.unfollow(c, FollowTag, c.Param("tag"))
+}
+
+func (h *Handler) unfollow(c *gin.Context, kind, target string) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if err := h.FeedService.Unfollow(user, kind, target); err != nil {
+		feedError(c, "unfollow", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Unfollowed"})
+}
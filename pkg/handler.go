@@ -1,17 +1,48 @@
 package pkg
 
 import (
+	"errors"
 	_ "github.com/Takeso-user/blog-backend/docs"
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"log"
 	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"time"
 )
 
 type Handler struct {
 	PostService    *PostService
 	CommentService *CommentService
 	UserService    *UserService
+	LockoutService *LockoutService
+	SessionService *SessionService
+
+	PasswordResetService     *PasswordResetService
+	EmailVerificationService *EmailVerificationService
+	OIDCService              *OIDCService
+	MagicLinkService         *MagicLinkService
+	MFAService               *MFAService
+	AccessTokenService       *AccessTokenService
+	WebAuthnService          *WebAuthnService
+	AccountService           *AccountService
+	ExportService            *ExportService
+	AdminService             *AdminService
+	MediaService             *MediaService
+	ReactionService          *ReactionService
+	BookmarkService          *BookmarkService
+	FeedService              *FeedService
+	NotificationService      *NotificationService
+	StreamService            *StreamService
+	ConfirmationService      *ConfirmationService
+	// AuditService, when set, records security-relevant actions.
+	AuditService *AuditService
+	// PasswordPolicy, when set, is enforced on registration.
+	PasswordPolicy *PasswordPolicy
 }
 
 func NewHandler(postService *PostService, commentService *CommentService, userService *UserService) *Handler {
@@ -24,6 +55,14 @@ func NewHandler(postService *PostService, commentService *CommentService, userSe
 
 type Response map[string]interface{}
 
+// RegisterInput is what a client may choose about a new account. Roles,
+// restrictions and the like are for admins to set.
+type RegisterInput struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Email    string `json:"email,omitempty"`
+}
+
 // Register godoc
 //
 //	@Summary		Register a new user
@@ -31,17 +70,25 @@ type Response map[string]interface{}
 //	@Tags			users
 //	@Accept			json
 //	@Produce		json
-//	@Param			input	body		User	true	"User object"
+//	@Param			input	body		RegisterInput	true	"New account"
 //	@Success		200		{object}	Response
 //	@Failure		400		{object}	Response
+//	@Failure		409		{object}	Response
 //	@Failure		500		{object}	Response
 //	@Router			/auth/register [post]
 func (h *Handler) Register(c *gin.Context) {
-	var input User
-	if err := c.ShouldBindJSON(&input); err != nil {
+	var registration RegisterInput
+	if err := c.ShouldBindJSON(&registration); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	input := User{Username: registration.Username, Password: registration.Password, Email: registration.Email, Role: "user"}
+	if h.PasswordPolicy != nil {
+		if err := h.PasswordPolicy.Check(input.Password); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
 	hashedPassword, err := HashPassword(input.Password)
 	if err != nil {
 		log.Printf("Failed to hash password: %v", err)
@@ -49,16 +96,39 @@ func (h *Handler) Register(c *gin.Context) {
 		return
 	}
 	input.Password = hashedPassword
-	if input.Role == "" {
-		input.Role = "user"
+	if input.Email != "" {
+		input.Email, err = NormalizeEmail(input.Email)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email address"})
+			return
+		}
+		if _, err := h.UserService.GetUserByEmail(input.Email); err == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email address is already in use"})
+			return
+		}
 	}
+	input.ID = primitive.NewObjectID()
 
 	if err := h.UserService.CreateUser(input); err != nil {
 		log.Printf("Failed to register user: %v", err)
+		if isDuplicateUsername(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": ErrUsernameTaken.Error()})
+			return
+		}
+		if mongo.IsDuplicateKeyError(err) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email address is already in use"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register user"})
 		return
 	}
 
+	if h.EmailVerificationService != nil && input.Email != "" {
+		if err := h.EmailVerificationService.SendVerification(c.Request.Context(), input); err != nil {
+			log.Printf("Failed to send verification email: %v", err)
+		}
+	}
+
 	log.Println("User registered successfully")
 	c.JSON(http.StatusOK, gin.H{"message": "User registered successfully"})
 }
@@ -75,6 +145,7 @@ func (h *Handler) Register(c *gin.Context) {
 //	@Success		200		{object}	Response
 //	@Failure		400		{object}	Response
 //	@Failure		401		{object}	Response
+//	@Failure		429		{object}	Response
 //	@Failure		500		{object}	Response
 //	@Router			/auth/login [post]
 func (h *Handler) Login(c *gin.Context) {
@@ -84,10 +155,23 @@ func (h *Handler) Login(c *gin.Context) {
 		return
 	}
 
+	ip := c.ClientIP()
+	if h.LockoutService != nil {
+		if wait := h.LockoutService.Check(input.Username, ip, time.Now()); wait > 0 {
+			log.Printf("Login for %s from %s rejected, locked for %v", input.Username, ip, wait)
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(wait)))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts, try again later"})
+			return
+		}
+	}
+
 	user, err := h.UserService.GetUserByUsername(input.Username)
-	log.Printf("Getting user: %v", user)
-	if err != nil {
+	if err != nil || user.Password == "" {
+		// Still run a full hash comparison so that unknown usernames take
+		// as long as wrong passwords and cannot be told apart by timing.
+		_ = CheckPassword(dummyPasswordHash(), input.Password)
 		log.Printf("Invalid username or password: %v", err)
+		h.recordLoginFailure(c, input.Username)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
 		return
 	}
@@ -95,26 +179,120 @@ func (h *Handler) Login(c *gin.Context) {
 	err = CheckPassword(user.Password, input.Password)
 	if err != nil {
 		log.Printf("Failed to check password: %v", err)
+		h.recordLoginFailure(c, input.Username)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid username or password"})
 		return
 	}
+	if h.LockoutService != nil {
+		h.LockoutService.RecordSuccess(input.Username)
+	}
+	h.upgradePasswordHash(user, input.Password)
+	if user.PasswordResetRequired {
+		log.Printf("Password login by %s rejected, password reset required", user.Username)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Password reset required", "password_reset_required": true})
+		return
+	}
+
+	h.completeLogin(c, user)
+}
+
+// completeLogin finishes a successful first-factor login: it either asks
+// for the second factor or issues the login token.
+func (h *Handler) completeLogin(c *gin.Context, user User) {
+	if h.restrictedLogin(c, user) {
+		return
+	}
+	var methods []string
+	if user.TOTPEnabled {
+		methods = append(methods, "totp")
+	}
+	if len(user.WebAuthnCredentials) > 0 && h.WebAuthnService != nil {
+		methods = append(methods, "webauthn")
+	}
+	if len(methods) > 0 && h.MFAService != nil {
+		challenge, err := h.MFAService.NewChallenge(user)
+		if err != nil {
+			log.Printf("Failed to generate MFA challenge: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+		log.Println("First factor accepted, second factor required")
+		c.JSON(http.StatusOK, gin.H{"mfa_required": true, "mfa_token": challenge, "methods": methods})
+		return
+	}
 
-	token, err := GenerateJWT(user)
+	token, err := h.issueToken(c, user, false)
 	if err != nil {
 		log.Printf("Failed to generate token: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
+	h.auditLogin(c, user, false)
 
 	log.Println("User logged in successfully")
 	c.JSON(http.StatusOK, gin.H{"token": token})
 }
 
+// issueToken starts a session for the user, when sessions are enabled, and
+// returns a JWT bound to it.
+func (h *Handler) issueToken(c *gin.Context, user User, mfa bool) (string, error) {
+	if h.SessionService == nil {
+		return GenerateSessionJWT(user, "", mfa)
+	}
+	session, err := h.SessionService.CreateSession(user, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		return "", err
+	}
+	return GenerateSessionJWT(user, session.ID.Hex(), mfa)
+}
+
+// currentUser loads the authenticated user. On failure it writes the error
+// response itself and returns false.
+func (h *Handler) currentUser(c *gin.Context) (User, bool) {
+	username, _ := c.Get("username")
+	name, _ := username.(string)
+	user, err := h.UserService.GetUserByUsername(name)
+	if err != nil {
+		log.Printf("Unable to fetch current user: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing or invalid token"})
+		return User{}, false
+	}
+	return user, true
+}
+
+// upgradePasswordHash rehashes a just-verified password when its stored
+// hash uses another algorithm or outdated parameters. Failures are only
+// logged; the old hash keeps working.
+func (h *Handler) upgradePasswordHash(user User, password string) {
+	if !PasswordNeedsRehash(user.Password) {
+		return
+	}
+	hashedPassword, err := HashPassword(password)
+	if err != nil {
+		return
+	}
+	if _, err := h.UserService.UpdateUser(user.ID, bson.M{"password": hashedPassword}); err != nil {
+		log.Printf("Unable to upgrade password hash: %v", err)
+		return
+	}
+	log.Printf("Upgraded password hash for user %s", user.Username)
+}
+
+// recordLoginFailure counts a failed sign-in towards the lockout and
+// records it in the audit log. The attempted username is kept as a detail,
+// not as the actor, since whoever tried it has not proven who they are.
+func (h *Handler) recordLoginFailure(c *gin.Context, username string) {
+	if h.LockoutService != nil {
+		h.LockoutService.RecordFailure(username, c.ClientIP(), time.Now())
+	}
+	h.audit(c, AuditEvent{Action: AuditLoginFailed, Details: map[string]string{"username": username}}, nil, nil)
+}
+
 // CreatePost godoc
 //
 //	@Summary		Create a new post
 //
-//	@Description	Create a new post
+//	@Description	Create a new post by the authenticated user. author_id in the body is ignored.
 //
 //	@Security		ApiKeyAuth
 //
@@ -132,8 +310,16 @@ func (h *Handler) CreatePost(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	author, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
 
-	err := h.PostService.CreatePost(input.Title, input.Content, input.AuthorID)
+	err := h.PostService.CreatePost(input.Title, input.Content, author.Username, input.Tags...)
+	if errors.Is(err, ErrInvalidTag) || errors.Is(err, ErrTooManyTags) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		log.Printf("Unable to create post: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to create post"})
@@ -154,16 +340,26 @@ func (h *Handler) CreatePost(c *gin.Context) {
 //
 //	@Tags			posts
 //	@Produce		json
-//	@Success		200	{array}		Post
-//	@Failure		500	{object}	Response
+//	@Param			format	query		string	false	"markdown or html; both by default"
+//	@Success		200		{array}		Post
+//	@Failure		400		{object}	Response
+//	@Failure		500		{object}	Response
 //	@Router			/api/posts [get]
 func (h *Handler) GetPosts(c *gin.Context) {
+	format, ok := contentFormat(c)
+	if !ok {
+		return
+	}
 	posts, err := h.PostService.GetPosts()
 	if err != nil {
 		log.Printf("Unable to fetch posts: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to fetch posts"})
 		return
 	}
+	for i := range posts {
+		posts[i] = h.PostService.Present(posts[i], format)
+	}
+	h.markPosts(c, posts)
 
 	c.JSON(http.StatusOK, posts)
 }
@@ -172,7 +368,7 @@ func (h *Handler) GetPosts(c *gin.Context) {
 //
 //	@Summary		Add a comment to a post
 //
-//	@Description	Add a comment to a post
+//	@Description	Add a comment by the authenticated user to a post, or with parent_id a reply to one of its comments. user_id in the body is ignored.
 //
 //	@Security		ApiKeyAuth
 //
@@ -183,28 +379,36 @@ func (h *Handler) GetPosts(c *gin.Context) {
 //	@Param			input	body		Comment	true	"Comment object"
 //	@Success		200		{object}	Response
 //	@Failure		400		{object}	Response
+//	@Failure		404		{object}	Response
 //	@Failure		500		{object}	Response
 //	@Router			/api/posts/{id}/comments [post]
 func (h *Handler) AddComment(c *gin.Context) {
 	postID := c.Param("id")
 
 	var input struct {
-		UserID  string `json:"user_id"`
-		Content string `json:"content"`
+		Content  string `json:"content"`
+		ParentID string `json:"parent_id"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	userID, err := primitive.ObjectIDFromHex(input.UserID)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+	user, ok := h.currentUser(c)
+	if !ok {
 		return
 	}
 
-	err = h.CommentService.AddComment(postID, userID.Hex(), input.Content)
+	var err error
+	if input.ParentID != "" {
+		err = h.CommentService.AddReply(postID, input.ParentID, user.ID.Hex(), input.Content)
+	} else {
+		err = h.CommentService.AddComment(postID, user.ID.Hex(), input.Content)
+	}
+	if errors.Is(err, ErrCommentNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		log.Printf("Unable to add comment: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to add comment"})
@@ -225,11 +429,17 @@ func (h *Handler) AddComment(c *gin.Context) {
 //
 //	@Tags			comments
 //	@Produce		json
-//	@Param			id	path		string	true	"Post ID"
-//	@Success		200	{array}		Comment
-//	@Failure		500	{object}	Response
+//	@Param			id		path		string	true	"Post ID"
+//	@Param			format	query		string	false	"markdown or html; both by default"
+//	@Success		200		{array}		Comment
+//	@Failure		400		{object}	Response
+//	@Failure		500		{object}	Response
 //	@Router			/api/posts/{id}/comments [get]
 func (h *Handler) GetComments(c *gin.Context) {
+	format, ok := contentFormat(c)
+	if !ok {
+		return
+	}
 	postID := c.Param("id")
 	comments, err := h.CommentService.GetComments(postID)
 	if err != nil {
@@ -237,6 +447,10 @@ func (h *Handler) GetComments(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to fetch comments"})
 		return
 	}
+	for i := range comments {
+		comments[i] = h.CommentService.Present(comments[i], format)
+	}
+	h.markComments(c, comments)
 
 	c.JSON(http.StatusOK, comments)
 }
@@ -245,13 +459,13 @@ func (h *Handler) GetComments(c *gin.Context) {
 //
 //	@Summary		Get all users
 //
-//	@Description	Get all users
+//	@Description	Get all users. Admin only; /api/admin/users supports search and paging.
 //
 //	@Security		ApiKeyAuth
 //
 //	@Tags			users
 //	@Produce		json
-//	@Success		200	{array}		User
+//	@Success		200	{array}		Response
 //	@Failure		500	{object}	Response
 //	@Router			/auth/users [get]
 func (h *Handler) GetUsers(context *gin.Context) {
@@ -262,29 +476,52 @@ func (h *Handler) GetUsers(context *gin.Context) {
 		return
 	}
 
-	context.JSON(http.StatusOK, users)
+	views := make([]adminUserView, 0, len(users))
+	for _, user := range users {
+		views = append(views, newAdminUserView(user))
+	}
+	context.JSON(http.StatusOK, views)
 }
 
 // GetPostById godoc
 //
-//	@Summary		Get a post by ID
-//	@Description	Get a post by ID
+//	@Summary		Get a post by ID or slug
+//	@Description	Get a post by ID or slug. A slug the post had before a title change redirects to the current one.
 //	@Security		ApiKeyAuth
 //	@Tags			posts
 //	@Produce		json
-//	@Param			id	path		string	true	"Post ID"
-//	@Success		200	{object}	Post
-//	@Failure		500	{object}	Response
+//	@Param			id		path		string	true	"Post ID or slug"
+//	@Param			format	query		string	false	"markdown or html; both by default"
+//	@Success		200		{object}	Post
+//	@Success		301		{object}	Response
+//	@Failure		400		{object}	Response
+//	@Failure		404		{object}	Response
+//	@Failure		500		{object}	Response
 //	@Router			/api/posts/{id} [get]
 func (h *Handler) GetPostById(context *gin.Context) {
+	format, ok := contentFormat(context)
+	if !ok {
+		return
+	}
 	postID := context.Param("id")
-	post, err := h.PostService.GetPostById(postID)
+	post, err := h.PostService.GetPostByIDOrSlug(postID)
+	if errors.Is(err, ErrPostNotFound) {
+		context.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		log.Printf("Unable to fetch post: %v", err)
 		context.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to fetch post"})
 		return
 	}
-	context.JSON(http.StatusOK, post)
+	if post.Slug != "" && postID != post.Slug && postID != post.ID.Hex() {
+		location := url.URL{Path: path.Join(path.Dir(context.Request.URL.Path), post.Slug), RawQuery: context.Request.URL.RawQuery}
+		context.Redirect(http.StatusMovedPermanently, location.String())
+		return
+	}
+	posts := []Post{h.PostService.Present(post, format)}
+	h.markPosts(context, posts)
+	context.JSON(http.StatusOK, posts[0])
 }
 
 // DeletePost godoc
@@ -300,12 +537,14 @@ func (h *Handler) GetPostById(context *gin.Context) {
 //	@Router			/api/posts/{id} [delete]
 func (h *Handler) DeletePost(context *gin.Context) {
 	postID := context.Param("id")
+	before := h.auditedPost(postID)
 	err := h.PostService.DeletePost(postID)
 	if err != nil {
 		log.Printf("Unable to delete post: %v", err)
 		context.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to delete post"})
 		return
 	}
+	h.audit(context, AuditEvent{Action: AuditPostDelete, TargetType: auditTargetPost, TargetID: postID}, before, nil)
 	log.Println("Post deleted successfully")
 	context.JSON(http.StatusOK, gin.H{"message": "Post deleted successfully"})
 }
@@ -317,16 +556,25 @@ func (h *Handler) DeletePost(context *gin.Context) {
 //	@Security		ApiKeyAuth
 //	@Tags			comments
 //	@Produce		json
-//	@Success		200	{array}		Comment
-//	@Failure		500	{object}	Response
+//	@Param			format	query		string	false	"markdown or html; both by default"
+//	@Success		200		{array}		Comment
+//	@Failure		400		{object}	Response
+//	@Failure		500		{object}	Response
 //	@Router			/api/posts/comments [get]
 func (h *Handler) GetAllComment(context *gin.Context) {
+	format, ok := contentFormat(context)
+	if !ok {
+		return
+	}
 	comments, err := h.CommentService.GetAllComment()
 	if err != nil {
 		log.Printf("Unable to fetch comments: %v", err)
 		context.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to fetch comments"})
 		return
 	}
+	for i := range comments {
+		comments[i] = h.CommentService.Present(comments[i], format)
+	}
 	context.JSON(http.StatusOK, comments)
 }
 
@@ -342,12 +590,14 @@ func (h *Handler) GetAllComment(context *gin.Context) {
 //	@Router			/api/posts/comments/{commentID} [delete]
 func (h *Handler) DeleteComment(context *gin.Context) {
 	commentID := context.Param("commentID")
+	before := h.auditedComment(commentID)
 	err := h.CommentService.DeleteComment(commentID)
 	if err != nil {
 		log.Printf("Unable to delete comment: %v", err)
 		context.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to delete comment"})
 		return
 	}
+	h.audit(context, AuditEvent{Action: AuditCommentDelete, TargetType: auditTargetComment, TargetID: commentID}, before, nil)
 	log.Println("Comment deleted successfully")
 	context.JSON(http.StatusOK, gin.H{"message": "Comment deleted successfully"})
 }
@@ -380,7 +630,12 @@ func (h *Handler) UpdatePost(context *gin.Context) {
 		return
 	}
 
+	before := h.auditedPost(postID)
 	post, err := h.PostService.UpdatePost(objectID, input)
+	if errors.Is(err, ErrInvalidTag) || errors.Is(err, ErrTooManyTags) {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		log.Printf("Unable to update post: %v", err)
 		context.JSON(http.StatusInternalServerError, gin.H{
@@ -389,6 +644,7 @@ func (h *Handler) UpdatePost(context *gin.Context) {
 		})
 		return
 	}
+	h.audit(context, AuditEvent{Action: AuditPostUpdate, TargetType: auditTargetPost, TargetID: postID}, before, post)
 	log.Println("Post updated successfully")
 	context.JSON(http.StatusOK, gin.H{"message": "Post updated successfully", "post": post})
 }
@@ -421,6 +677,7 @@ func (h *Handler) UpdateComment(context *gin.Context) {
 		return
 	}
 
+	before := h.auditedComment(commentID)
 	comment, err := h.CommentService.UpdateComment(objectID, input)
 	if err != nil {
 		log.Printf("Unable to update comment: %v", err)
@@ -430,6 +687,7 @@ func (h *Handler) UpdateComment(context *gin.Context) {
 		})
 		return
 	}
+	h.audit(context, AuditEvent{Action: AuditCommentUpdate, TargetType: auditTargetComment, TargetID: commentID}, before, comment)
 	log.Println("Comment updated successfully")
 	context.JSON(http.StatusOK, gin.H{"message": "Comment updated successfully", "comment": comment})
 }
@@ -0,0 +1,494 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"log"
+	"slices"
+	"strconv"
+
+	"github.com/disintegration/imaging"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	MediaProcessing = "processing"
+	MediaReady      = "ready"
+	MediaFailed     = "failed"
+)
+
+const (
+	// maxImagePixels keeps decoding an upload within a few hundred MB of
+	// memory, whatever its file size.
+	maxImagePixels = 50_000_000
+	// blurhashSize is the width of the copy the placeholder is computed
+	// from; it only needs to carry the broad colors.
+	blurhashSize = 32
+	// orientedJPEGQuality is used when a JPEG has to be re-encoded to apply
+	// its EXIF orientation.
+	orientedJPEGQuality = 92
+	// mediaQueueSize is how many uploaded images may wait for a worker
+	// before further uploads wait as well.
+	mediaQueueSize = 1000
+)
+
+var (
+	ErrInvalidImage  = errors.New("file is not a valid image")
+	ErrImageTooLarge = errors.New("image dimensions are too large")
+)
+
+// stripMetadata removes EXIF, XMP, IPTC and comments, which may carry
+// location, camera serial numbers or the author's name, from an image
+// without re-encoding it. JPEGs rotated by their EXIF orientation are the
+// exception: they are re-encoded upright, since the orientation goes with
+// the EXIF data. ICC color profiles are kept.
+func stripMetadata(contentType string, data []byte) ([]byte, error) {
+	switch contentType {
+	case "image/jpeg":
+		stripped, orientation, err := stripJPEG(data)
+		if err != nil || orientation <= 1 {
+			return stripped, err
+		}
+		img, err := imaging.Decode(bytes.NewReader(data), imaging.AutoOrientation(true))
+		if err != nil {
+			return nil, ErrInvalidImage
+		}
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: orientedJPEGQuality}); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case "image/png":
+		return stripPNG(data)
+	case "image/webp":
+		return stripWebP(data)
+	case "image/gif":
+		return stripGIF(data)
+	default:
+		return data, nil
+	}
+}
+
+// stripJPEG drops the APP1 (EXIF, XMP), APP13 (IPTC) and comment segments
+// and returns the EXIF orientation, 1 when there is none.
+func stripJPEG(data []byte) ([]byte, int, error) {
+	if len(data) < 4 || data[0] != 0xff || data[1] != 0xd8 {
+		return nil, 0, ErrInvalidImage
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:2]...)
+	orientation := 1
+	for i := 2; ; {
+		if i+2 > len(data) || data[i] != 0xff {
+			return nil, 0, ErrInvalidImage
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xff:
+			i++ // fill byte
+			continue
+		case marker == 0xda, marker == 0xd9:
+			// Entropy-coded data follows the start of scan; no metadata
+			// segments are expected after it.
+			return append(out, data[i:]...), orientation, nil
+		case marker == 0x01, marker >= 0xd0 && marker <= 0xd7:
+			out = append(out, data[i:i+2]...)
+			i += 2
+			continue
+		}
+		if i+4 > len(data) {
+			return nil, 0, ErrInvalidImage
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+		if end < i+4 || end > len(data) {
+			return nil, 0, ErrInvalidImage
+		}
+		payload := data[i+4 : end]
+		switch marker {
+		case 0xe1:
+			if bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+				orientation = exifOrientation(payload[6:])
+			}
+		case 0xed, 0xfe:
+		default:
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+}
+
+// exifOrientation reads the orientation tag from the first IFD of TIFF
+// formatted EXIF data.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	offset := int(order.Uint32(tiff[4:]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[offset:]))
+	for n := 0; n < entries; n++ {
+		entry := offset + 2 + n*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if v := int(order.Uint16(tiff[entry+8:])); v >= 1 && v <= 8 {
+				return v
+			}
+			break
+		}
+	}
+	return 1
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// stripPNG drops the eXIf, text and timestamp chunks.
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, ErrInvalidImage
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, pngSignature...)
+	for i := len(pngSignature); i < len(data); {
+		if i+12 > len(data) {
+			return nil, ErrInvalidImage
+		}
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		end := i + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, ErrInvalidImage
+		}
+		switch string(data[i+4 : i+8]) {
+		case "eXIf", "tEXt", "zTXt", "iTXt", "tIME":
+		default:
+			out = append(out, data[i:end]...)
+		}
+		if string(data[i+4:i+8]) == "IEND" {
+			break
+		}
+		i = end
+	}
+	return out, nil
+}
+
+// stripWebP drops the EXIF and XMP chunks and clears their flags in the
+// extended header.
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, ErrInvalidImage
+	}
+	out := make([]byte, 12, len(data))
+	copy(out, data[:12])
+	for i := 12; i < len(data); {
+		if i+8 > len(data) {
+			return nil, ErrInvalidImage
+		}
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		end := i + 8 + size + size&1
+		if size < 0 || end > len(data) {
+			return nil, ErrInvalidImage
+		}
+		switch string(data[i : i+4]) {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte(nil), data[i:end]...)
+			if len(chunk) > 8 {
+				chunk[8] &^= 0x08 | 0x04
+			}
+			out = append(out, chunk...)
+		default:
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, nil
+}
+
+// gifLoopingApps are the application extensions that set how often an
+// animation loops. Other application extensions, such as XMP, are
+// dropped.
+var gifLoopingApps = []string{"NETSCAPE2.0", "ANIMEXTS1.0"}
+
+// stripGIF drops the comment extensions and the application extensions
+// other than the looping ones.
+func stripGIF(data []byte) ([]byte, error) {
+	if len(data) < 13 || (string(data[:6]) != "GIF87a" && string(data[:6]) != "GIF89a") {
+		return nil, ErrInvalidImage
+	}
+	i := 13 + gifColorTableSize(data[10])
+	if i > len(data) {
+		return nil, ErrInvalidImage
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:i]...)
+	for i < len(data) {
+		start := i
+		switch data[i] {
+		case 0x3b:
+			return append(out, data[i]), nil
+		case 0x2c:
+			// Image descriptor, local color table, LZW code size and the
+			// image data.
+			if i+11 > len(data) {
+				return nil, ErrInvalidImage
+			}
+			i += 10 + gifColorTableSize(data[i+9]) + 1
+		case 0x21:
+			if i+2 > len(data) {
+				return nil, ErrInvalidImage
+			}
+			i += 2
+		default:
+			return nil, ErrInvalidImage
+		}
+		end, err := skipGIFSubBlocks(data, i)
+		if err != nil {
+			return nil, err
+		}
+		if data[start] == 0x21 && dropGIFExtension(data[start+1], data[i:end]) {
+			i = end
+			continue
+		}
+		out = append(out, data[start:end]...)
+		i = end
+	}
+	return nil, ErrInvalidImage
+}
+
+// gifColorTableSize is the size of the color table that the packed field
+// of a screen or image descriptor announces.
+func gifColorTableSize(packed byte) int {
+	if packed&0x80 == 0 {
+		return 0
+	}
+	return 3 << (packed&0x07 + 1)
+}
+
+// skipGIFSubBlocks returns where the data sub-blocks starting at i end.
+func skipGIFSubBlocks(data []byte, i int) (int, error) {
+	for {
+		if i >= len(data) {
+			return 0, ErrInvalidImage
+		}
+		size := int(data[i])
+		i += 1 + size
+		if size == 0 {
+			return i, nil
+		}
+	}
+}
+
+func dropGIFExtension(label byte, blocks []byte) bool {
+	switch label {
+	case 0xfe:
+		return true
+	case 0xff:
+		return len(blocks) < 12 || blocks[0] != 11 || !slices.Contains(gifLoopingApps, string(blocks[1:12]))
+	default:
+		return false
+	}
+}
+
+// checkImage reads the dimensions of an image and rejects those too large
+// to process.
+func checkImage(data []byte) (image.Config, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return cfg, ErrInvalidImage
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return cfg, ErrInvalidImage
+	}
+	if cfg.Width*cfg.Height > maxImagePixels {
+		return cfg, ErrImageTooLarge
+	}
+	return cfg, nil
+}
+
+// enqueue queues the media for one of the Workers workers. When
+// mediaQueueSize images are already waiting, it waits for room.
+func (s *MediaService) enqueue(media Media) {
+	s.jobs.Add(1)
+	s.queue <- media
+}
+
+// work processes queued media until the service is gone.
+func (s *MediaService) work() {
+	for media := range s.queue {
+		s.process(media)
+		s.jobs.Done()
+	}
+}
+
+// ResumeProcessing queues the media whose processing was interrupted by a
+// restart, and media uploaded before images were processed. It returns
+// without waiting for room in the queue.
+func (s *MediaService) ResumeProcessing() error {
+	pending, err := s.Repository.GetUnprocessedMedia()
+	if err != nil {
+		return err
+	}
+	s.jobs.Add(len(pending))
+	go func() {
+		for _, media := range pending {
+			s.queue <- media
+		}
+	}()
+	return nil
+}
+
+// Wait blocks until all queued media has been processed.
+func (s *MediaService) Wait() {
+	s.jobs.Wait()
+}
+
+// process renders the variants and placeholder of an image and stores
+// them. Variants are keyed by content hash, so media sharing a blob also
+// shares its variants.
+func (s *MediaService) process(media Media) {
+	fields, variants, err := s.render(media)
+	if err != nil {
+		log.Printf("Processing media %s failed: %v", media.ID.Hex(), err)
+		s.discardVariants(media, variants, 1)
+		fields = bson.M{"status": MediaFailed}
+	}
+	err = s.Repository.UpdateMedia(media.ID, fields)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// The media was removed while it was processed, before its variants
+		// were recorded.
+		s.discardVariants(media, variants, 0)
+		return
+	}
+	if err != nil {
+		log.Printf("Error saving processed media %s: %v", media.ID.Hex(), err)
+		return
+	}
+	log.Printf("Processed media %s", media.ID.Hex())
+}
+
+// render returns the fields to record for the processed media, and the
+// variants stored so far also when it fails.
+func (s *MediaService) render(media Media) (bson.M, []MediaVariant, error) {
+	content, err := s.Store.Get(context.Background(), media.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer content.Close()
+	img, err := imaging.Decode(content)
+	if err != nil {
+		return nil, nil, err
+	}
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	xComponents, yComponents := 4, 3
+	if height > width {
+		xComponents, yComponents = 3, 4
+	}
+	placeholder := imaging.Fit(img, blurhashSize, blurhashSize, imaging.Box)
+
+	type rendition struct {
+		name string
+		img  image.Image
+	}
+	var renditions []rendition
+	if s.ThumbnailSize > 0 {
+		size := min(s.ThumbnailSize, width, height)
+		renditions = append(renditions, rendition{"thumb", imaging.Fill(img, size, size, imaging.Center, imaging.Lanczos)})
+	}
+	for _, w := range s.VariantWidths {
+		if w < width {
+			renditions = append(renditions, rendition{"w" + strconv.Itoa(w), imaging.Resize(img, w, 0, imaging.Lanczos)})
+		}
+	}
+
+	variants := []MediaVariant{}
+	for _, r := range renditions {
+		webp, err := s.storeVariant(media, r.name+".webp", "image/webp", r.img, func(buf *bytes.Buffer) error {
+			return EncodeWebP(buf, r.img)
+		})
+		if err != nil {
+			return nil, variants, err
+		}
+		variants = append(variants, webp)
+		jpg, err := s.storeVariant(media, r.name+".jpg", "image/jpeg", r.img, func(buf *bytes.Buffer) error {
+			return jpeg.Encode(buf, flatten(r.img), &jpeg.Options{Quality: s.JPEGQuality})
+		})
+		if err != nil {
+			return nil, variants, err
+		}
+		variants = append(variants, jpg)
+	}
+	return bson.M{
+		"status":   MediaReady,
+		"width":    width,
+		"height":   height,
+		"blurhash": Blurhash(placeholder, xComponents, yComponents),
+		"variants": variants,
+	}, variants, nil
+}
+
+func (s *MediaService) storeVariant(media Media, name, contentType string, img image.Image, encode func(*bytes.Buffer) error) (MediaVariant, error) {
+	var buf bytes.Buffer
+	if err := encode(&buf); err != nil {
+		return MediaVariant{}, err
+	}
+	variant := MediaVariant{
+		Name:        name,
+		ContentType: contentType,
+		Width:       img.Bounds().Dx(),
+		Height:      img.Bounds().Dy(),
+		Size:        int64(buf.Len()),
+		Key:         "variants/" + media.Hash + "/" + name,
+	}
+	err := s.Store.Put(context.Background(), variant.Key, &buf, variant.Size, contentType)
+	return variant, err
+}
+
+// discardVariants deletes variants that were stored but not recorded,
+// unless more than owners media still share them.
+func (s *MediaService) discardVariants(media Media, variants []MediaVariant, owners int64) {
+	if len(variants) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if count, err := s.Repository.CountMediaByHash(media.Hash); err == nil && count <= owners {
+		s.deleteVariants(variants)
+	}
+}
+
+func (s *MediaService) deleteVariants(variants []MediaVariant) {
+	for _, variant := range variants {
+		if err := s.Store.Delete(context.Background(), variant.Key); err != nil {
+			log.Printf("Error deleting media variant %s: %v", variant.Key, err)
+		}
+	}
+}
+
+// flatten puts transparent images on white, since JPEG has no alpha.
+func flatten(img image.Image) image.Image {
+	bounds := img.Bounds()
+	background := imaging.New(bounds.Dx(), bounds.Dy(), color.White)
+	return imaging.Overlay(background, img, image.Point{}, 1)
+}
@@ -2,6 +2,10 @@ package pkg
 
 import (
 	"context"
+	"io"
+	"time"
+
+	"github.com/Takeso-user/blog-backend/config"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -13,33 +17,225 @@ type PostRepositoryInterface interface {
 	GetPostByID(postID string) (Post, error)
 	DeletePost(postID string) error
 	UpdatePost(id primitive.ObjectID, updateFields bson.M) (Post, error)
+	GetPostsByAuthor(authorID string) ([]Post, error)
+	UpdatePostsByAuthor(authorID string, updateFields bson.M) (int64, error)
+	DeletePostsByAuthor(authorID string) (int64, error)
+	IncrementPostReactions(id string, deltas map[string]int) (map[string]int64, error)
+	GetPostsByIDs(ids []string) ([]Post, error)
+	GetFeedPosts(query FeedQuery) ([]Post, error)
+}
+
+type SlugRepositoryInterface interface {
+	CreatePostSlug(slug PostSlug) error
+	GetPostSlug(slug string) (PostSlug, error)
+	DeletePostSlugs(postID string) (int64, error)
 }
 
 type CommentRepositoryInterface interface {
 	AddComment(comment Comment) error
 	GetComments(postID string) ([]Comment, error)
 	GetAllComment() ([]Comment, error)
+	GetCommentByID(commentID string) (Comment, error)
 	DeleteComment(commentID string) error
 	UpdateComment(ctx context.Context, filter, updateFields bson.M) (Comment, error)
+	GetCommentsByUser(userID string) ([]Comment, error)
+	UpdateCommentsByUser(userID string, updateFields bson.M) (int64, error)
+	DeleteCommentsByUser(userID string) (int64, error)
+	IncrementCommentReactions(id string, deltas map[string]int) (map[string]int64, error)
+}
+
+type ReactionRepositoryInterface interface {
+	SetReaction(reaction Reaction) (string, error)
+	DeleteReaction(id, reactionType string) (bool, error)
+	GetUserReactions(userID, targetType string, targetIDs []string) (map[string]string, error)
+	GetReactionsByUser(userID string) ([]Reaction, error)
+	DeleteReactionsByTarget(targetType string, targetIDs []string) (int64, error)
+}
+
+type BookmarkRepositoryInterface interface {
+	CreateBookmark(bookmark Bookmark) error
+	GetBookmarkByID(id string) (Bookmark, error)
+	GetBookmarkByPost(userID, postID string) (Bookmark, error)
+	GetBookmarks(filter BookmarkFilter) ([]Bookmark, int64, error)
+	UpdateBookmark(id primitive.ObjectID, updateFields bson.M) (Bookmark, error)
+	DeleteBookmark(id primitive.ObjectID) error
+	MarkBookmarkedPostsDeleted(postIDs []string) (int64, error)
+	ClearBookmarkList(listID string) (int64, error)
+	DeleteBookmarksByUser(userID string) (int64, error)
+}
+
+type ReadingListRepositoryInterface interface {
+	CreateReadingList(list ReadingList) error
+	GetReadingListByID(id string) (ReadingList, error)
+	GetReadingListByToken(token string) (ReadingList, error)
+	GetReadingLists(ownerID string) ([]ReadingList, error)
+	CountReadingLists(ownerID string) (int64, error)
+	UpdateReadingList(id primitive.ObjectID, updateFields bson.M) (ReadingList, error)
+	DeleteReadingList(id primitive.ObjectID) error
+	DeleteReadingListsByOwner(ownerID string) (int64, error)
+}
+
+type FollowRepositoryInterface interface {
+	Follow(follow Follow) (bool, error)
+	Unfollow(followerID, kind, target string) (bool, error)
+	GetFollows(followerID string) ([]Follow, error)
+	CountFollowers(kind string, targets []string) (map[string]int64, error)
+	RenameFollowTarget(kind, from, to string) (int64, error)
+	DeleteFollowsByFollower(followerID string) (int64, error)
+	DeleteFollowsByTarget(kind, target string) (int64, error)
+}
+
+type NotificationRepositoryInterface interface {
+	AddNotification(notification Notification) (Notification, error)
+	GetNotifications(filter NotificationFilter) ([]Notification, int64, error)
+	CountUnreadNotifications(userID string) (int64, error)
+	MarkNotificationRead(userID, id string) (Notification, error)
+	MarkAllNotificationsRead(userID string) (int64, error)
+	RenameNotificationActor(actorID, from, to string) (int64, error)
+	DeleteNotificationsByUser(userID string) (int64, error)
 }
 
 type UserRepositoryInterface interface {
 	CreateUser(user User) error
 	GetUserByUsername(username string) (User, error)
 	GetUserByID(userID string) (User, error)
+	GetUserByEmail(email string) (User, error)
+	GetUserByIdentity(provider, subject string) (User, error)
 	GetUsers() ([]User, error)
+	SearchUsers(filter UserFilter) ([]User, int64, error)
+	UpdateUser(id primitive.ObjectID, updateFields bson.M) (User, error)
+	UseTOTPStep(id primitive.ObjectID, step int64) (bool, error)
+	UseRecoveryCode(id primitive.ObjectID, hash string) (bool, error)
+	DeleteUser(id primitive.ObjectID) error
+}
+
+type LoginAttemptRepositoryInterface interface {
+	GetLoginAttempt(key string) (LoginAttempt, error)
+	AddLoginFailure(key string, threshold int, policy config.LockoutConfig, now time.Time) (LoginAttempt, error)
+	DeleteLoginAttempt(key string) error
+	GetLockedLoginAttempts(now time.Time) ([]LoginAttempt, error)
+}
+
+type TokenRepositoryInterface interface {
+	CreateToken(token OneTimeToken) error
+	ConsumeToken(purpose, hash string, now time.Time) (OneTimeToken, error)
+	DeleteUserTokens(userID, purpose string) error
+}
+
+type SessionRepositoryInterface interface {
+	CreateSession(session Session) error
+	GetSessionByID(sessionID string) (Session, error)
+	GetUserSessions(userID string) ([]Session, error)
+	RevokeSession(sessionID string, now time.Time) error
+	RevokeUserSessions(userID string, now time.Time) error
+}
+
+type AccessTokenRepositoryInterface interface {
+	CreateAccessToken(token AccessToken) error
+	GetAccessTokenByHash(hash string) (AccessToken, error)
+	GetUserAccessTokens(userID string) ([]AccessToken, error)
+	DeleteAccessToken(userID, tokenID string) error
+	TouchAccessToken(tokenID primitive.ObjectID, now time.Time) error
+}
+
+type SettingsRepositoryInterface interface {
+	GetSetting(key string, out interface{}) error
+	SaveSetting(key string, value interface{}) error
+}
+
+type ExportRepositoryInterface interface {
+	CreateExport(export DataExport) error
+	GetUserExports(userID string) ([]DataExport, error)
+	GetExportByTokenHash(hash string) (DataExport, error)
+	UpdateExport(id primitive.ObjectID, updateFields bson.M) error
+	GetExpiredExports(now time.Time) ([]DataExport, error)
+	DeleteExport(id primitive.ObjectID) error
+}
+
+type AuditRepositoryInterface interface {
+	AppendAuditEvent(event AuditEvent) error
+	GetLastAuditEvent() (AuditEvent, error)
+	SearchAuditEvents(filter AuditFilter) ([]AuditEvent, int64, error)
+	GetAuditEventsAfter(seq int64, limit int64) ([]AuditEvent, error)
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg MailMessage) error
+}
+
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, policy config.RateLimitPolicy, now time.Time) (RateLimitResult, error)
+}
+
+// EventBroker carries events to every instance of the server, including
+// the one that published them. Subscribe calls deliver for each event in
+// the order the broker received them until stop is called.
+type EventBroker interface {
+	Publish(event Event) error
+	Subscribe(deliver func(Event)) (stop func())
+}
+
+type MediaRepositoryInterface interface {
+	CreateMedia(media Media) error
+	GetMediaByID(id string) (Media, error)
+	GetMediaByOwnerAndHash(ownerID, hash string) (Media, error)
+	GetUserMedia(ownerID string) ([]Media, error)
+	GetUserMediaUsage(ownerID string) (int64, error)
+	CountMediaByHash(hash string) (int64, error)
+	GetPostMedia(postID string) ([]Media, error)
+	LinkMedia(ids []primitive.ObjectID, ownerID, postID string, now time.Time) error
+	UnlinkPostMedia(postID string, now time.Time) error
+	GetOrphanedMedia(before time.Time) ([]Media, error)
+	GetUnprocessedMedia() ([]Media, error)
+	UpdateMedia(id primitive.ObjectID, updateFields bson.M) error
+	DeleteMedia(id primitive.ObjectID) error
+}
+
+// BlobStore keeps the bytes of uploaded media under opaque keys.
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
 }
 
 type Repository struct {
 	PostRepositoryInterface
+	SlugRepositoryInterface
 	CommentRepositoryInterface
 	UserRepositoryInterface
+	LoginAttemptRepositoryInterface
+	TokenRepositoryInterface
+	SessionRepositoryInterface
+	AccessTokenRepositoryInterface
+	SettingsRepositoryInterface
+	ExportRepositoryInterface
+	AuditRepositoryInterface
+	MediaRepositoryInterface
+	ReactionRepositoryInterface
+	BookmarkRepositoryInterface
+	ReadingListRepositoryInterface
+	FollowRepositoryInterface
+	NotificationRepositoryInterface
 }
 
 func NewRepository(db *mongo.Database) *Repository {
 	return &Repository{
-		PostRepositoryInterface:    NewPostRepository(db.Collection("posts")),
-		CommentRepositoryInterface: NewCommentRepository(db.Collection("comments")),
-		UserRepositoryInterface:    NewUserRepository(db.Collection("users")),
+		PostRepositoryInterface:         NewPostRepository(db.Collection("posts")),
+		SlugRepositoryInterface:         NewSlugRepository(db.Collection("post_slugs")),
+		CommentRepositoryInterface:      NewCommentRepository(db.Collection("comments")),
+		UserRepositoryInterface:         NewUserRepository(db.Collection("users")),
+		LoginAttemptRepositoryInterface: NewLoginAttemptRepository(db.Collection("login_attempts")),
+		TokenRepositoryInterface:        NewTokenRepository(db.Collection("tokens")),
+		SessionRepositoryInterface:      NewSessionRepository(db.Collection("sessions")),
+		AccessTokenRepositoryInterface:  NewAccessTokenRepository(db.Collection("access_tokens")),
+		SettingsRepositoryInterface:     NewSettingsRepository(db.Collection("settings")),
+		ExportRepositoryInterface:       NewExportRepository(db.Collection("exports")),
+		AuditRepositoryInterface:        NewAuditRepository(db.Collection("audit_events")),
+		MediaRepositoryInterface:        NewMediaRepository(db.Collection("media")),
+		ReactionRepositoryInterface:     NewReactionRepository(db.Collection("reactions")),
+		BookmarkRepositoryInterface:     NewBookmarkRepository(db.Collection("bookmarks")),
+		ReadingListRepositoryInterface:  NewReadingListRepository(db.Collection("reading_lists")),
+		FollowRepositoryInterface:       NewFollowRepository(db.Collection("follows")),
+		NotificationRepositoryInterface: NewNotificationRepository(db.Collection("notifications")),
 	}
 }
@@ -1,6 +1,7 @@
 package pkg
 
 import (
+	"encoding/json"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"time"
 )
@@ -10,21 +11,322 @@ type User struct {
 	Username string             `json:"username" bson:"username"`
 	Password string             `json:"password" bson:"password"`
 	Role     string             `json:"role" bson:"role"`
+	Email    string             `json:"email,omitempty" bson:"email,omitempty"`
+
+	EmailVerified bool `json:"email_verified" bson:"email_verified"`
+
+	TOTPEnabled       bool     `json:"totp_enabled" bson:"totp_enabled"`
+	TOTPSecret        string   `json:"-" bson:"totp_secret,omitempty"`
+	TOTPPendingSecret string   `json:"-" bson:"totp_pending_secret,omitempty"`
+	TOTPLastStep      int64    `json:"-" bson:"totp_last_step,omitempty"`
+	RecoveryCodes     []string `json:"-" bson:"recovery_codes,omitempty"`
+
+	Identities []ExternalIdentity `json:"identities,omitempty" bson:"identities,omitempty"`
+
+	WebAuthnCredentials []WebAuthnCredential `json:"-" bson:"webauthn_credentials,omitempty"`
+
+	// Restriction, while active, keeps the user from signing in.
+	Restriction *Restriction `json:"restriction,omitempty" bson:"restriction,omitempty"`
+	// PasswordResetRequired rejects password logins until the password
+	// has been changed.
+	PasswordResetRequired bool `json:"password_reset_required,omitempty" bson:"password_reset_required,omitempty"`
+
+	// MutedNotifications lists the notification types the user turned off.
+	MutedNotifications []string `json:"-" bson:"muted_notifications,omitempty"`
+}
+
+// Restriction is a suspension or ban placed on a user by an admin. Without
+// ExpiresAt it lasts until it is lifted.
+type Restriction struct {
+	Type      string     `json:"type" bson:"type"`
+	Reason    string     `json:"reason" bson:"reason"`
+	By        string     `json:"by" bson:"by"`
+	CreatedAt time.Time  `json:"created_at" bson:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+}
+
+func (r *Restriction) ActiveAt(now time.Time) bool {
+	return r != nil && (r.ExpiresAt == nil || now.Before(*r.ExpiresAt))
+}
+
+// WebAuthnCredential is a registered passkey or security key. ID is the
+// credential ID chosen by the authenticator.
+type WebAuthnCredential struct {
+	ID              []byte     `json:"id" bson:"id"`
+	Name            string     `json:"name" bson:"name"`
+	PublicKey       []byte     `json:"-" bson:"public_key"`
+	AttestationType string     `json:"-" bson:"attestation_type"`
+	Transports      []string   `json:"transports,omitempty" bson:"transports,omitempty"`
+	AAGUID          []byte     `json:"-" bson:"aaguid,omitempty"`
+	SignCount       uint32     `json:"sign_count" bson:"sign_count"`
+	BackupEligible  bool       `json:"backup_eligible" bson:"backup_eligible"`
+	BackupState     bool       `json:"backup_state" bson:"backup_state"`
+	CreatedAt       time.Time  `json:"created_at" bson:"created_at"`
+	LastUsedAt      *time.Time `json:"last_used_at,omitempty" bson:"last_used_at,omitempty"`
 }
 
+// ExternalIdentity links a user to an account at an OpenID Connect
+// provider. Subject is the provider's stable user identifier.
+type ExternalIdentity struct {
+	Provider string    `json:"provider" bson:"provider"`
+	Subject  string    `json:"-" bson:"subject"`
+	Email    string    `json:"email,omitempty" bson:"email,omitempty"`
+	LinkedAt time.Time `json:"linked_at" bson:"linked_at"`
+}
+
+// Post and Comment Content is the Markdown source; ContentHTML is the
+// sanitized HTML rendered from it on write. For posts the table of
+// contents, word count and reading time in minutes are computed then too.
 type Post struct {
-	ID        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-	Title     string             `json:"title" bson:"title"`
-	Content   string             `json:"content" bson:"content"`
-	AuthorID  string             `json:"author_id" bson:"author_id"`
-	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	ID          primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Title       string             `json:"title" bson:"title"`
+	Slug        string             `json:"slug,omitempty" bson:"slug,omitempty"`
+	Content     string             `json:"content,omitempty" bson:"content"`
+	ContentHTML string             `json:"content_html,omitempty" bson:"content_html,omitempty"`
+	TOC         []TOCEntry         `json:"toc,omitempty" bson:"toc,omitempty"`
+	WordCount   int                `json:"word_count" bson:"word_count"`
+	ReadingTime int                `json:"reading_time" bson:"reading_time"`
+	AuthorID    string             `json:"author_id" bson:"author_id"`
+	Tags        []string           `json:"tags,omitempty" bson:"tags,omitempty"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+	Reactions   map[string]int64   `json:"reactions,omitempty" bson:"reactions,omitempty"`
+	MyReaction  string             `json:"my_reaction,omitempty" bson:"-"`
 }
 
 type Comment struct {
+	ID          primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	PostID      string             `json:"post_id" bson:"post_id"`
+	ParentID    string             `json:"parent_id,omitempty" bson:"parent_id,omitempty"`
+	UserID      string             `json:"user_id" bson:"user_id"`
+	Username    string             `json:"username" bson:"username"`
+	Content     string             `json:"content,omitempty" bson:"content"`
+	ContentHTML string             `json:"content_html,omitempty" bson:"content_html,omitempty"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+	Reactions   map[string]int64   `json:"reactions,omitempty" bson:"reactions,omitempty"`
+	MyReaction  string             `json:"my_reaction,omitempty" bson:"-"`
+}
+
+// Reaction is a user's reaction to a post or comment. The ID combines the
+// target and the user, so a user has at most one reaction per target.
+type Reaction struct {
+	ID         string    `json:"-" bson:"_id"`
+	TargetType string    `json:"target_type" bson:"target_type"`
+	TargetID   string    `json:"target_id" bson:"target_id"`
+	UserID     string    `json:"user_id" bson:"user_id"`
+	Type       string    `json:"type" bson:"type"`
+	CreatedAt  time.Time `json:"created_at" bson:"created_at"`
+}
+
+// Bookmark saves a post for a user, optionally in one of their reading
+// lists. The post's title and slug are copied so that the bookmark still
+// says what it was after the post is deleted.
+type Bookmark struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID      string             `json:"-" bson:"user_id"`
+	PostID      string             `json:"post_id" bson:"post_id"`
+	ListID      string             `json:"list_id,omitempty" bson:"list_id"`
+	Note        string             `json:"note,omitempty" bson:"note,omitempty"`
+	PostTitle   string             `json:"post_title" bson:"post_title"`
+	PostSlug    string             `json:"post_slug,omitempty" bson:"post_slug,omitempty"`
+	PostDeleted bool               `json:"post_deleted,omitempty" bson:"post_deleted,omitempty"`
+	Post        *PostSummary       `json:"post,omitempty" bson:"-"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// PostSummary is the current state of a bookmarked post.
+type PostSummary struct {
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	Slug        string    `json:"slug,omitempty"`
+	AuthorID    string    `json:"author_id"`
+	ReadingTime int       `json:"reading_time"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ReadingList is a named folder of bookmarks. A public list can be read by
+// anyone who has its share token.
+type ReadingList struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	OwnerID     string             `json:"-" bson:"owner_id"`
+	Name        string             `json:"name" bson:"name"`
+	Description string             `json:"description,omitempty" bson:"description,omitempty"`
+	Public      bool               `json:"public" bson:"public"`
+	ShareToken  string             `json:"share_token,omitempty" bson:"share_token,omitempty"`
+	ShareURL    string             `json:"share_url,omitempty" bson:"-"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// Follow subscribes a user's feed to the posts of an author, identified
+// by username, or to the posts with a tag.
+type Follow struct {
+	ID         primitive.ObjectID `json:"-" bson:"_id,omitempty"`
+	FollowerID string             `json:"-" bson:"follower_id"`
+	Kind       string             `json:"kind" bson:"kind"`
+	Target     string             `json:"target" bson:"target"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// Notification tells a user about activity that concerns them. Similar
+// events are grouped while the notification is unread: ActorIDs and Actors
+// hold the latest few who caused one, newest first, and ActorCount how
+// many did.
+// Actors keeps the usernames so the inbox reads without looking users up.
+type Notification struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id"`
+	UserID     string             `json:"-" bson:"user_id"`
+	Type       string             `json:"type" bson:"type"`
+	GroupKey   string             `json:"-" bson:"group_key"`
+	ActorIDs   []string           `json:"-" bson:"actor_ids"`
+	Actors     []string           `json:"actors" bson:"actors"`
+	ActorCount int                `json:"actor_count" bson:"actor_count"`
+	PostID     string             `json:"post_id,omitempty" bson:"post_id,omitempty"`
+	PostTitle  string             `json:"post_title,omitempty" bson:"post_title,omitempty"`
+	CommentID  string             `json:"comment_id,omitempty" bson:"comment_id,omitempty"`
+	Role       string             `json:"role,omitempty" bson:"role,omitempty"`
+	Message    string             `json:"message" bson:"-"`
+	Read       bool               `json:"read" bson:"read"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt  time.Time          `json:"updated_at" bson:"updated_at"`
+	ExpiresAt  time.Time          `json:"-" bson:"expires_at"`
+}
+
+// Event is a change pushed to clients in real time. Topic says who may
+// receive it: everyone following a post, or a single user.
+type Event struct {
+	ID        string          `json:"id,omitempty" bson:"_id"`
+	Topic     string          `json:"-" bson:"topic"`
+	Type      string          `json:"type" bson:"type"`
+	Data      json.RawMessage `json:"data,omitempty" bson:"data"`
+	CreatedAt time.Time       `json:"created_at" bson:"created_at"`
+}
+
+// PostSlug records a slug a post has been given. A post keeps the slugs of
+// its earlier titles so that old links redirect to the current one, and no
+// other post can take them.
+type PostSlug struct {
+	Slug      string    `json:"slug" bson:"_id"`
+	PostID    string    `json:"post_id" bson:"post_id"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+type LoginAttempt struct {
+	Key         string    `json:"key" bson:"_id"`
+	Failures    int       `json:"failures" bson:"failures"`
+	LastFailure time.Time `json:"last_failure" bson:"last_failure"`
+	LockedUntil time.Time `json:"locked_until,omitempty" bson:"locked_until,omitempty"`
+}
+
+// OneTimeToken is a single-use secret mailed to a user, such as a password
+// reset link. Only the SHA-256 hash of the secret is stored.
+type OneTimeToken struct {
+	Hash      string     `json:"-" bson:"_id"`
+	Purpose   string     `json:"purpose" bson:"purpose"`
+	UserID    string     `json:"user_id" bson:"user_id"`
+	Email     string     `json:"email,omitempty" bson:"email,omitempty"`
+	CreatedAt time.Time  `json:"created_at" bson:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at" bson:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty" bson:"used_at,omitempty"`
+	// Data carries flow-specific values, such as the PKCE verifier of an
+	// OIDC login.
+	Data map[string]string `json:"-" bson:"data,omitempty"`
+}
+
+type Session struct {
 	ID        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-	PostID    string             `json:"post_id" bson:"post_id"`
 	UserID    string             `json:"user_id" bson:"user_id"`
-	Username  string             `json:"username" bson:"username"`
-	Content   string             `json:"content" bson:"content"`
+	IP        string             `json:"ip" bson:"ip"`
+	UserAgent string             `json:"user_agent" bson:"user_agent"`
 	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+	ExpiresAt time.Time          `json:"expires_at" bson:"expires_at"`
+	RevokedAt *time.Time         `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+	// Impersonator is the admin who started the session on the user's
+	// behalf.
+	Impersonator string `json:"impersonator,omitempty" bson:"impersonator,omitempty"`
+}
+
+// AccessToken is a personal access token. Only the hash of the secret is
+// stored; Prefix keeps its first characters so users can tell tokens apart.
+type AccessToken struct {
+	ID         primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	UserID     string             `json:"-" bson:"user_id"`
+	Name       string             `json:"name" bson:"name"`
+	Prefix     string             `json:"prefix" bson:"prefix"`
+	Hash       string             `json:"-" bson:"hash"`
+	Scopes     []string           `json:"scopes" bson:"scopes"`
+	MFA        bool               `json:"mfa" bson:"mfa"`
+	CreatedAt  time.Time          `json:"created_at" bson:"created_at"`
+	ExpiresAt  *time.Time         `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+	LastUsedAt *time.Time         `json:"last_used_at,omitempty" bson:"last_used_at,omitempty"`
+}
+
+// DataExport is an archive of a user's personal data. The archive is
+// downloaded with a secret link; only the hash of the secret is stored.
+type DataExport struct {
+	ID          primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	UserID      string             `json:"-" bson:"user_id"`
+	Status      string             `json:"status" bson:"status"`
+	Error       string             `json:"error,omitempty" bson:"error,omitempty"`
+	TokenHash   string             `json:"-" bson:"token_hash"`
+	Size        int64              `json:"size,omitempty" bson:"size,omitempty"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+	CompletedAt *time.Time         `json:"completed_at,omitempty" bson:"completed_at,omitempty"`
+	ExpiresAt   time.Time          `json:"expires_at" bson:"expires_at"`
+}
+
+// Media is an uploaded file. The bytes live in the BlobStore under Key,
+// which is derived from the SHA-256 Hash of the content, so identical
+// uploads share one blob. PostIDs are the posts whose content refers to the
+// media; once none do, it is garbage-collected.
+type Media struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	OwnerID     string             `json:"owner_id" bson:"owner_id"`
+	Filename    string             `json:"filename" bson:"filename"`
+	ContentType string             `json:"content_type" bson:"content_type"`
+	Size        int64              `json:"size" bson:"size"`
+	Hash        string             `json:"hash" bson:"hash"`
+	Key         string             `json:"-" bson:"key"`
+	Width       int                `json:"width,omitempty" bson:"width,omitempty"`
+	Height      int                `json:"height,omitempty" bson:"height,omitempty"`
+	Status      string             `json:"status,omitempty" bson:"status,omitempty"`
+	Blurhash    string             `json:"blurhash,omitempty" bson:"blurhash,omitempty"`
+	Variants    []MediaVariant     `json:"variants,omitempty" bson:"variants,omitempty"`
+	PostIDs     []string           `json:"post_ids" bson:"post_ids"`
+	URL         string             `json:"url,omitempty" bson:"-"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// MediaVariant is a resized copy of an uploaded image, such as
+// "thumb.webp" or "w640.jpg".
+type MediaVariant struct {
+	Name        string `json:"name" bson:"name"`
+	ContentType string `json:"content_type" bson:"content_type"`
+	Width       int    `json:"width" bson:"width"`
+	Height      int    `json:"height" bson:"height"`
+	Size        int64  `json:"size" bson:"size"`
+	Key         string `json:"-" bson:"key"`
+	URL         string `json:"url,omitempty" bson:"-"`
+}
+
+// AuditEvent is an entry in the append-only security audit log. Each event
+// carries the hash of the one before it, so editing or removing an event
+// breaks the chain from that point on.
+type AuditEvent struct {
+	ID           primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	Seq          int64              `json:"seq" bson:"seq"`
+	Time         time.Time          `json:"time" bson:"time"`
+	Actor        string             `json:"actor,omitempty" bson:"actor,omitempty"`
+	Impersonator string             `json:"impersonator,omitempty" bson:"impersonator,omitempty"`
+	Action       string             `json:"action" bson:"action"`
+	TargetType   string             `json:"target_type,omitempty" bson:"target_type,omitempty"`
+	TargetID     string             `json:"target_id,omitempty" bson:"target_id,omitempty"`
+	IP           string             `json:"ip,omitempty" bson:"ip,omitempty"`
+	UserAgent    string             `json:"user_agent,omitempty" bson:"user_agent,omitempty"`
+	RequestID    string             `json:"request_id,omitempty" bson:"request_id,omitempty"`
+	Details      map[string]string  `json:"details,omitempty" bson:"details,omitempty"`
+	Before       json.RawMessage    `json:"before,omitempty" bson:"before,omitempty" swaggertype:"object"`
+	After        json.RawMessage    `json:"after,omitempty" bson:"after,omitempty" swaggertype:"object"`
+	PrevHash     string             `json:"prev_hash" bson:"prev_hash"`
+	Hash         string             `json:"hash" bson:"hash"`
 }
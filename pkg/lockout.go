@@ -0,0 +1,266 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Takeso-user/blog-backend/config"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type LoginAttemptRepository struct {
+	Collection *mongo.Collection
+}
+
+func NewLoginAttemptRepository(collection *mongo.Collection) *LoginAttemptRepository {
+	return &LoginAttemptRepository{Collection: collection}
+}
+
+func (r *LoginAttemptRepository) GetLoginAttempt(key string) (LoginAttempt, error) {
+	var attempt LoginAttempt
+	err := r.Collection.FindOne(context.TODO(), bson.M{"_id": key}).Decode(&attempt)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		log.Printf("Error getting login attempt: %v", err)
+	}
+	return attempt, err
+}
+
+// AddLoginFailure counts a failed login against key in a single update,
+// so that concurrent failures can't overwrite each other's counts. A count
+// whose last failure is older than the policy's window, or whose lock has
+// expired, starts over. Reaching threshold locks the key. It returns the
+// attempt as updated.
+func (r *LoginAttemptRepository) AddLoginFailure(key string, threshold int, policy config.LockoutConfig, now time.Time) (LoginAttempt, error) {
+	stale := bson.M{"$or": bson.A{
+		bson.M{"$lt": bson.A{"$last_failure", now.Add(-policy.FailureWindow)}},
+		bson.M{"$and": bson.A{
+			bson.M{"$gt": bson.A{"$locked_until", nil}},
+			bson.M{"$lte": bson.A{"$locked_until", now}},
+		}},
+	}}
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{
+			"failures":     bson.M{"$cond": bson.A{stale, 1, bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$failures", 0}}, 1}}}},
+			"locked_until": bson.M{"$cond": bson.A{stale, "$$REMOVE", "$locked_until"}},
+			"last_failure": now,
+		}}},
+		{{Key: "$set", Value: bson.M{
+			"locked_until": bson.M{"$cond": bson.A{bson.M{"$gte": bson.A{"$failures", threshold}}, now.Add(policy.LockoutDuration), "$locked_until"}},
+		}}},
+	}
+	var attempt LoginAttempt
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := r.Collection.FindOneAndUpdate(context.TODO(), bson.M{"_id": key}, update, opts).Decode(&attempt)
+	if err != nil {
+		log.Printf("Error recording login failure: %v", err)
+	}
+	return attempt, err
+}
+
+func (r *LoginAttemptRepository) DeleteLoginAttempt(key string) error {
+	log.Println("Deleting login attempt:", key)
+	_, err := r.Collection.DeleteOne(context.TODO(), bson.M{"_id": key})
+	if err != nil {
+		log.Printf("Error deleting login attempt: %v", err)
+	}
+	return err
+}
+
+func (r *LoginAttemptRepository) GetLockedLoginAttempts(now time.Time) ([]LoginAttempt, error) {
+	log.Println("Getting locked login attempts")
+	cursor, err := r.Collection.Find(context.TODO(), bson.M{"locked_until": bson.M{"$gt": now}})
+	if err != nil {
+		log.Printf("Error getting locked login attempts: %v", err)
+		return nil, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Printf("Error closing cursor: %v", err)
+		}
+	}(cursor, context.TODO())
+
+	attempts := []LoginAttempt{}
+	if err = cursor.All(context.TODO(), &attempts); err != nil {
+		log.Printf("Error decoding login attempts: %v", err)
+		return nil, err
+	}
+	return attempts, nil
+}
+
+// LockoutService tracks failed logins per account and per client IP and
+// decides when further attempts must wait.
+type LockoutService struct {
+	Repository LoginAttemptRepositoryInterface
+	Policy     config.LockoutConfig
+}
+
+func NewLockoutService(repository LoginAttemptRepositoryInterface, policy config.LockoutConfig) *LockoutService {
+	return &LockoutService{Repository: repository, Policy: policy}
+}
+
+func accountAttemptKey(username string) string {
+	return "user:" + strings.ToLower(username)
+}
+
+func ipAttemptKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check returns how long the caller has to wait before a login for username
+// from ip is accepted. Zero means the attempt may proceed.
+func (s *LockoutService) Check(username, ip string, now time.Time) time.Duration {
+	if !s.Policy.Enabled {
+		return 0
+	}
+	var wait time.Duration
+	for _, key := range []string{accountAttemptKey(username), ipAttemptKey(ip)} {
+		attempt, err := s.Repository.GetLoginAttempt(key)
+		if err != nil {
+			// Missing records are the common case; other errors fail open
+			// so a database hiccup does not lock everyone out.
+			continue
+		}
+		if w := s.waitFor(attempt, now); w > wait {
+			wait = w
+		}
+	}
+	return wait
+}
+
+func (s *LockoutService) waitFor(attempt LoginAttempt, now time.Time) time.Duration {
+	if now.Before(attempt.LockedUntil) {
+		return attempt.LockedUntil.Sub(now)
+	}
+	if attempt.Failures == 0 || now.Sub(attempt.LastFailure) > s.Policy.FailureWindow {
+		return 0
+	}
+	next := attempt.LastFailure.Add(s.backoff(attempt.Failures))
+	if now.Before(next) {
+		return next.Sub(now)
+	}
+	return 0
+}
+
+func (s *LockoutService) backoff(failures int) time.Duration {
+	delay := s.Policy.BaseDelay
+	for i := 1; i < failures && delay < s.Policy.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > s.Policy.MaxDelay {
+		delay = s.Policy.MaxDelay
+	}
+	return delay
+}
+
+func (s *LockoutService) RecordFailure(username, ip string, now time.Time) {
+	if !s.Policy.Enabled {
+		return
+	}
+	s.recordFailure(accountAttemptKey(username), s.Policy.MaxAccountFailures, now)
+	s.recordFailure(ipAttemptKey(ip), s.Policy.MaxIPFailures, now)
+}
+
+func (s *LockoutService) recordFailure(key string, threshold int, now time.Time) {
+	attempt, err := s.Repository.AddLoginFailure(key, threshold, s.Policy, now)
+	if err == nil && attempt.Failures >= threshold {
+		log.Printf("Locking %s after %d failed logins", key, attempt.Failures)
+	}
+}
+
+// RecordSuccess clears the account's failure history. The IP history is
+// kept so that one valid login cannot reset an attacker's budget.
+func (s *LockoutService) RecordSuccess(username string) {
+	if !s.Policy.Enabled {
+		return
+	}
+	_ = s.Repository.DeleteLoginAttempt(accountAttemptKey(username))
+}
+
+func (s *LockoutService) GetLocked(now time.Time) ([]LoginAttempt, error) {
+	return s.Repository.GetLockedLoginAttempts(now)
+}
+
+func (s *LockoutService) UnlockAccount(username string) error {
+	return s.Repository.DeleteLoginAttempt(accountAttemptKey(username))
+}
+
+func (s *LockoutService) UnlockIP(ip string) error {
+	return s.Repository.DeleteLoginAttempt(ipAttemptKey(ip))
+}
+
+// GetLockouts godoc
+//
+//	@Summary		List locked accounts and IPs
+//	@Description	List accounts and client IPs that are currently locked out of login
+//	@Security		ApiKeyAuth
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{array}		LoginAttempt
+//	@Failure		403	{object}	Response
+//	@Failure		500	{object}	Response
+//	@Router			/api/admin/lockouts [get]
+func (h *Handler) GetLockouts(c *gin.Context) {
+	attempts, err := h.LockoutService.GetLocked(time.Now())
+	if err != nil {
+		log.Printf("Unable to fetch lockouts: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to fetch lockouts"})
+		return
+	}
+	c.JSON(http.StatusOK, attempts)
+}
+
+// UnlockAccount godoc
+//
+//	@Summary		Unlock an account
+//	@Description	Clear failed login attempts and any lockout for a username
+//	@Security		ApiKeyAuth
+//	@Tags			admin
+//	@Produce		json
+//	@Param			username	path		string	true	"Username"
+//	@Success		200			{object}	Response
+//	@Failure		403			{object}	Response
+//	@Failure		500			{object}	Response
+//	@Router			/api/admin/lockouts/users/{username} [delete]
+func (h *Handler) UnlockAccount(c *gin.Context) {
+	username := c.Param("username")
+	if err := h.LockoutService.UnlockAccount(username); err != nil {
+		log.Printf("Unable to unlock account: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to unlock account"})
+		return
+	}
+	log.Printf("Account %s unlocked", username)
+	h.audit(c, AuditEvent{Action: AuditUnlock, TargetType: auditTargetUser, Details: map[string]string{"username": username}}, nil, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Account unlocked successfully"})
+}
+
+// UnlockIP godoc
+//
+//	@Summary		Unlock a client IP
+//	@Description	Clear failed login attempts and any lockout for a client IP
+//	@Security		ApiKeyAuth
+//	@Tags			admin
+//	@Produce		json
+//	@Param			ip	path		string	true	"Client IP"
+//	@Success		200	{object}	Response
+//	@Failure		403	{object}	Response
+//	@Failure		500	{object}	Response
+//	@Router			/api/admin/lockouts/ips/{ip} [delete]
+func (h *Handler) UnlockIP(c *gin.Context) {
+	ip := c.Param("ip")
+	if err := h.LockoutService.UnlockIP(ip); err != nil {
+		log.Printf("Unable to unlock IP: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to unlock IP"})
+		return
+	}
+	log.Printf("IP %s unlocked", ip)
+	h.audit(c, AuditEvent{Action: AuditUnlock, TargetType: auditTargetIP, TargetID: ip}, nil, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "IP unlocked successfully"})
+}
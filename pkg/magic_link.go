@@ -0,0 +1,221 @@
+package pkg
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	TokenPurposeMagicLink = "magic_link"
+
+	magicLinkDeviceCookie = "magic_link_device"
+)
+
+// MagicLinkService signs users in with single-use links mailed to their
+// address. Links can optionally be bound to the requesting IP address or
+// browser so that a leaked mail alone is not enough to log in.
+type MagicLinkService struct {
+	Tokens      TokenRepositoryInterface
+	UserService *UserService
+	Mailer      Mailer
+	PublicURL   string
+	TTL         time.Duration
+	BindIP      bool
+	BindDevice  bool
+	// Limiter, when set, limits the links sent to each address with the
+	// magic_link_email policy. The per-IP limit alone is not enough, as
+	// requests can come from many addresses.
+	Limiter *RateLimiter
+}
+
+func NewMagicLinkService(tokens TokenRepositoryInterface, userService *UserService, mailer Mailer, publicURL string, ttl time.Duration, bindIP, bindDevice bool) *MagicLinkService {
+	return &MagicLinkService{
+		Tokens:      tokens,
+		UserService: userService,
+		Mailer:      mailer,
+		PublicURL:   strings.TrimRight(publicURL, "/"),
+		TTL:         ttl,
+		BindIP:      bindIP,
+		BindDevice:  bindDevice,
+	}
+}
+
+// SendLink mails a login link to the account with the given email. Unknown
+// addresses are ignored without error so the endpoint does not reveal which
+// accounts exist. device is the raw device cookie value, used only when
+// BindDevice is set. Requesting a new link invalidates older ones. Requests
+// over the per-address limit are dropped the same way.
+func (s *MagicLinkService) SendLink(ctx context.Context, email, ip, device string) error {
+	email, err := NormalizeEmail(email)
+	if err != nil {
+		return ErrInvalidEmail
+	}
+	if !s.Limiter.Allow(ctx, "magic_link_email", email) {
+		return nil
+	}
+	user, err := s.UserService.GetUserByEmail(email)
+	if err != nil {
+		log.Println("Magic link requested for unknown email")
+		return nil
+	}
+
+	userID := user.ID.Hex()
+	if err := s.Tokens.DeleteUserTokens(userID, TokenPurposeMagicLink); err != nil {
+		return err
+	}
+	raw, hash, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+	data := map[string]string{}
+	if s.BindIP {
+		data["ip"] = ip
+	}
+	if s.BindDevice {
+		data["device"] = hashToken(device)
+	}
+	now := time.Now()
+	err = s.Tokens.CreateToken(OneTimeToken{
+		Hash:      hash,
+		Purpose:   TokenPurposeMagicLink,
+		UserID:    userID,
+		Email:     user.Email,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.TTL),
+		Data:      data,
+	})
+	if err != nil {
+		return err
+	}
+
+	link := s.PublicURL + "/auth/magic-link/consume?token=" + url.QueryEscape(raw)
+	return s.Mailer.Send(ctx, MailMessage{
+		To:      user.Email,
+		Subject: "Your sign-in link",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the link below to sign in. It works once and expires in %s.\n\n%s\n\n"+
+			"If you did not request this, you can ignore this email.\n", user.Username, s.TTL, link),
+	})
+}
+
+// Consume redeems a login link. Since the link proves control of the
+// mailbox, the address is marked verified if it still belongs to the user.
+func (s *MagicLinkService) Consume(raw, ip, device string) (User, error) {
+	token, err := s.Tokens.ConsumeToken(TokenPurposeMagicLink, hashToken(raw), time.Now())
+	if err != nil {
+		return User{}, ErrInvalidToken
+	}
+	if boundIP, ok := token.Data["ip"]; ok && boundIP != ip {
+		log.Printf("Magic link used from %s, issued to %s", ip, boundIP)
+		return User{}, ErrInvalidToken
+	}
+	if boundDevice, ok := token.Data["device"]; ok &&
+		(device == "" || subtle.ConstantTimeCompare([]byte(boundDevice), []byte(hashToken(device))) != 1) {
+		log.Println("Magic link used from a different device")
+		return User{}, ErrInvalidToken
+	}
+
+	user, err := s.UserService.GetUserByID(token.UserID)
+	if err != nil {
+		return User{}, err
+	}
+	if user.Email != token.Email {
+		return User{}, ErrInvalidToken
+	}
+	if !user.EmailVerified {
+		return s.UserService.UpdateUser(user.ID, bson.M{"email_verified": true})
+	}
+	return user, nil
+}
+
+// RequestMagicLink godoc
+//
+//	@Summary		Request a magic login link
+//	@Description	Mail a single-use, short-lived sign-in link to the account's email address
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			input	body		object{email=string}	true	"Email address"
+//	@Success		200		{object}	Response
+//	@Failure		400		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/auth/magic-link [post]
+func (h *Handler) RequestMagicLink(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var device string
+	if h.MagicLinkService.BindDevice {
+		var err error
+		device, _, err = newOpaqueToken()
+		if err != nil {
+			log.Printf("Unable to create device cookie: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to send sign-in link"})
+			return
+		}
+		secure := strings.HasPrefix(h.MagicLinkService.PublicURL, "https://")
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(magicLinkDeviceCookie, device, int(h.MagicLinkService.TTL.Seconds()), "/auth/magic-link", "", secure, true)
+	}
+
+	err := h.MagicLinkService.SendLink(c.Request.Context(), input.Email, c.ClientIP(), device)
+	if errors.Is(err, ErrInvalidEmail) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email address"})
+		return
+	}
+	if err != nil {
+		log.Printf("Unable to send magic link: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to send sign-in link"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "If the account exists, a sign-in link has been sent"})
+}
+
+// ConsumeMagicLink godoc
+//
+//	@Summary		Sign in with a magic link
+//	@Description	Exchange a magic link token for a JWT, or an MFA challenge when two-factor authentication is enabled
+//	@Tags			users
+//	@Produce		json
+//	@Param			token	query		string	true	"Magic link token"
+//	@Success		200		{object}	Response
+//	@Failure		400		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/auth/magic-link/consume [get]
+func (h *Handler) ConsumeMagicLink(c *gin.Context) {
+	raw := c.Query("token")
+	if raw == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing token"})
+		return
+	}
+	device, _ := c.Cookie(magicLinkDeviceCookie)
+
+	user, err := h.MagicLinkService.Consume(raw, c.ClientIP(), device)
+	if errors.Is(err, ErrInvalidToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired sign-in link"})
+		return
+	}
+	if err != nil {
+		log.Printf("Unable to consume magic link: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to sign in"})
+		return
+	}
+	if device != "" {
+		c.SetCookie(magicLinkDeviceCookie, "", -1, "/auth/magic-link", "", false, true)
+	}
+	h.completeLogin(c, user)
+}
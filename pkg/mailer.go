@@ -0,0 +1,134 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Takeso-user/blog-backend/config"
+)
+
+type MailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+func (m MailMessage) render(from string, now time.Time) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", headerValue(from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue(m.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerValue(m.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(m.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// headerValue strips line breaks so user-controlled values cannot inject
+// additional headers.
+func headerValue(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
+
+func NewMailer(cfg config.MailConfig) (Mailer, error) {
+	switch cfg.Backend {
+	case "smtp":
+		return NewSMTPMailer(cfg), nil
+	case "file":
+		return NewFileOutbox(cfg.OutboxDir, cfg.From)
+	case "memory":
+		return NewMemoryOutbox(), nil
+	default:
+		return nil, fmt.Errorf("unknown mail backend %q", cfg.Backend)
+	}
+}
+
+type SMTPMailer struct {
+	Addr string
+	From string
+	Auth smtp.Auth
+}
+
+func NewSMTPMailer(cfg config.MailConfig) *SMTPMailer {
+	mailer := &SMTPMailer{
+		Addr: net.JoinHostPort(cfg.SMTP.Host, strconv.Itoa(cfg.SMTP.Port)),
+		From: cfg.From,
+	}
+	if cfg.SMTP.Username != "" {
+		mailer.Auth = smtp.PlainAuth("", cfg.SMTP.Username, cfg.SMTP.Password, cfg.SMTP.Host)
+	}
+	return mailer
+}
+
+func (m *SMTPMailer) Send(_ context.Context, msg MailMessage) error {
+	log.Printf("Sending mail %q via SMTP", msg.Subject)
+	err := smtp.SendMail(m.Addr, m.Auth, m.From, []string{msg.To}, msg.render(m.From, time.Now()))
+	if err != nil {
+		log.Printf("Error sending mail: %v", err)
+	}
+	return err
+}
+
+// FileOutbox writes every message as an .eml file instead of sending it.
+type FileOutbox struct {
+	Dir  string
+	From string
+}
+
+func NewFileOutbox(dir, from string) (*FileOutbox, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create outbox directory: %w", err)
+	}
+	return &FileOutbox{Dir: dir, From: from}, nil
+}
+
+func (o *FileOutbox) Send(_ context.Context, msg MailMessage) error {
+	now := time.Now()
+	name := fmt.Sprintf("%s-%s.eml", now.Format("20060102T150405.000000000"), sanitizeFileName(msg.To))
+	path := filepath.Join(o.Dir, name)
+	log.Printf("Writing mail %q to %s", msg.Subject, path)
+	return os.WriteFile(path, msg.render(o.From, now), 0o600)
+}
+
+func sanitizeFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '@' || r == '.' || r == '-' || r == '_' ||
+			(r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// MemoryOutbox keeps sent messages in memory so tests can inspect them.
+type MemoryOutbox struct {
+	mu       sync.Mutex
+	messages []MailMessage
+}
+
+func NewMemoryOutbox() *MemoryOutbox {
+	return &MemoryOutbox{}
+}
+
+func (o *MemoryOutbox) Send(_ context.Context, msg MailMessage) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.messages = append(o.messages, msg)
+	return nil
+}
+
+func (o *MemoryOutbox) Messages() []MailMessage {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]MailMessage(nil), o.messages...)
+}
@@ -0,0 +1,286 @@
+package pkg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/gin-gonic/gin"
+	"github.com/gosimple/slug"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+)
+
+// Content formats a client can ask for with ?format=. Without it both the
+// Markdown source and the rendered HTML are returned.
+const (
+	ContentFormatMarkdown = "markdown"
+	ContentFormatHTML     = "html"
+)
+
+var ErrInvalidContentFormat = errors.New("format must be markdown or html")
+
+// highlightStyle is the Chroma style served as /highlight.css for the
+// class-annotated code blocks in posts.
+const highlightStyle = "github"
+
+// wordsPerMinute is the reading speed behind Post.ReadingTime.
+const wordsPerMinute = 200
+
+// Renderer turns Markdown (CommonMark with GFM tables, task lists,
+// strikethrough and autolinks) into HTML and passes it through an allowlist
+// sanitizer. Raw HTML in the source is allowed through to the sanitizer,
+// which is the only thing deciding what survives.
+type Renderer struct {
+	markdown goldmark.Markdown
+	policy   *bluemonday.Policy
+}
+
+// Rendered is the result of rendering a Markdown document.
+type Rendered struct {
+	HTML      string
+	TOC       []TOCEntry
+	WordCount int
+}
+
+// TOCEntry is a heading in a post's table of contents. Slug is the id of
+// the heading in the rendered HTML.
+type TOCEntry struct {
+	Level    int        `json:"level" bson:"level"`
+	Title    string     `json:"title" bson:"title"`
+	Slug     string     `json:"slug" bson:"slug"`
+	Children []TOCEntry `json:"children,omitempty" bson:"children,omitempty"`
+}
+
+func newRenderer(policy *bluemonday.Policy, extensions ...goldmark.Extender) *Renderer {
+	extensions = append([]goldmark.Extender{
+		extension.NewTable(extension.WithTableCellAlignMethod(extension.TableCellAlignAttribute)),
+		extension.TaskList,
+		extension.Strikethrough,
+		extension.Linkify,
+	}, extensions...)
+	return &Renderer{
+		markdown: goldmark.New(
+			goldmark.WithExtensions(extensions...),
+			goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+			goldmark.WithRendererOptions(html.WithUnsafe()),
+		),
+		policy: policy,
+	}
+}
+
+// NewPostRenderer renders post content: the usual user-generated content
+// allowlist plus the disabled checkboxes of task lists. Links get
+// rel="nofollow" and only http, https and mailto URLs are kept. Fenced
+// code blocks are highlighted into spans with Chroma classes and headings
+// get slug ids for anchors.
+func NewPostRenderer() *Renderer {
+	policy := bluemonday.UGCPolicy()
+	policy.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	policy.AllowAttrs("checked", "disabled").Matching(regexp.MustCompile(`^(|checked|disabled)$`)).OnElements("input")
+	policy.AllowAttrs("align").Matching(regexp.MustCompile(`^(left|center|right)$`)).OnElements("th", "td")
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^[A-Za-z0-9_+-]+( [A-Za-z0-9_+-]+)*$`)).OnElements("pre", "code", "span")
+	return newRenderer(policy, highlighting.NewHighlighting(
+		highlighting.WithStyle(highlightStyle),
+		highlighting.WithFormatOptions(chromahtml.WithClasses(true)),
+	))
+}
+
+// NewCommentRenderer renders comments with a smaller allowlist: inline
+// formatting, lists, quotes, code and links, but no headings, images or
+// tables. Disallowed tags are dropped and their text kept.
+func NewCommentRenderer() *Renderer {
+	policy := bluemonday.NewPolicy()
+	policy.AllowElements("p", "br", "em", "strong", "del", "code", "pre", "blockquote", "ul", "ol", "li")
+	policy.AllowStandardURLs()
+	policy.AllowAttrs("href").OnElements("a")
+	policy.RequireNoFollowOnLinks(true)
+	return newRenderer(policy)
+}
+
+func (r *Renderer) Render(source string) (Rendered, error) {
+	src := []byte(source)
+	ctx := parser.NewContext(parser.WithIDs(&headingIDs{used: map[string]bool{}}))
+	doc := r.markdown.Parser().Parse(text.NewReader(src), parser.WithContext(ctx))
+	var buf bytes.Buffer
+	if err := r.markdown.Renderer().Render(&buf, src, doc); err != nil {
+		return Rendered{}, err
+	}
+	return Rendered{
+		HTML:      r.policy.Sanitize(buf.String()),
+		TOC:       tableOfContents(doc, src),
+		WordCount: countWords(doc, src),
+	}, nil
+}
+
+// headingIDs slugs heading text the way post titles are slugged, so that
+// headings in any script get a readable id rather than losing their
+// non-ASCII letters. Repeated ids get -1, -2 and so on.
+type headingIDs struct {
+	used map[string]bool
+}
+
+func (ids *headingIDs) Generate(value []byte, _ ast.NodeKind) []byte {
+	base := slug.Make(string(value))
+	if base == "" {
+		base = "heading"
+	}
+	id := base
+	for n := 1; ids.used[id]; n++ {
+		id = fmt.Sprintf("%s-%d", base, n)
+	}
+	ids.used[id] = true
+	return []byte(id)
+}
+
+func (ids *headingIDs) Put(value []byte) {
+	ids.used[string(value)] = true
+}
+
+// tableOfContents nests the document's headings under the closest
+// preceding heading of a higher level.
+func tableOfContents(doc ast.Node, src []byte) []TOCEntry {
+	var headings []TOCEntry
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := n.(*ast.Heading)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+		slug, _ := heading.AttributeString("id")
+		id, _ := slug.([]byte)
+		headings = append(headings, TOCEntry{Level: heading.Level, Title: plainText(heading, src), Slug: string(id)})
+		return ast.WalkSkipChildren, nil
+	})
+	toc, _ := nestHeadings(headings, 0)
+	return toc
+}
+
+// nestHeadings builds the entries at one level from headings[i:], returning
+// them and the index of the first heading that belongs to a parent level.
+func nestHeadings(headings []TOCEntry, i int) ([]TOCEntry, int) {
+	var entries []TOCEntry
+	for i < len(headings) {
+		entry := headings[i]
+		if len(entries) > 0 && entry.Level < entries[0].Level {
+			break
+		}
+		i++
+		if i < len(headings) && headings[i].Level > entry.Level {
+			entry.Children, i = nestHeadings(headings, i)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, i
+}
+
+// plainText is the text of a node without markup.
+func plainText(n ast.Node, src []byte) string {
+	var sb strings.Builder
+	_ = ast.Walk(n, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch node := n.(type) {
+		case *ast.Text:
+			sb.Write(node.Segment.Value(src))
+			if node.SoftLineBreak() {
+				sb.WriteByte(' ')
+			}
+		case *ast.String:
+			sb.Write(node.Value)
+		}
+		return ast.WalkContinue, nil
+	})
+	return strings.TrimSpace(sb.String())
+}
+
+// countWords counts the words of prose and code alike.
+func countWords(doc ast.Node, src []byte) int {
+	words := 0
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch node := n.(type) {
+		case *ast.Text:
+			words += len(strings.Fields(string(node.Segment.Value(src))))
+		case *ast.String:
+			words += len(strings.Fields(string(node.Value)))
+		case *ast.FencedCodeBlock, *ast.CodeBlock:
+			lines := node.Lines()
+			for i := 0; i < lines.Len(); i++ {
+				line := lines.At(i)
+				words += len(strings.Fields(string(line.Value(src))))
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	return words
+}
+
+// ReadingTime is the estimated reading time in minutes, at least one for
+// any content.
+func ReadingTime(words int) int {
+	if words == 0 {
+		return 0
+	}
+	return (words + wordsPerMinute - 1) / wordsPerMinute
+}
+
+// selectContent keeps the source, the HTML or both for the format.
+func selectContent(format, content, contentHTML string) (string, string) {
+	switch format {
+	case ContentFormatMarkdown:
+		return content, ""
+	case ContentFormatHTML:
+		return "", contentHTML
+	default:
+		return content, contentHTML
+	}
+}
+
+func validContentFormat(format string) bool {
+	return format == "" || format == ContentFormatMarkdown || format == ContentFormatHTML
+}
+
+// contentFormat reads ?format=. On an unknown format it writes the error
+// response and returns false.
+func contentFormat(c *gin.Context) (string, bool) {
+	format := c.Query("format")
+	if !validContentFormat(format) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidContentFormat.Error()})
+		return "", false
+	}
+	return format, true
+}
+
+// HighlightCSS godoc
+//
+//	@Summary		Code highlighting stylesheet
+//	@Description	CSS for the Chroma classes in highlighted code blocks of rendered posts
+//	@Tags			posts
+//	@Produce		text/css
+//	@Success		200	{string}	string
+//	@Router			/highlight.css [get]
+func (h *Handler) HighlightCSS(c *gin.Context) {
+	var buf bytes.Buffer
+	if err := chromahtml.New(chromahtml.WithClasses(true)).WriteCSS(&buf, styles.Get(highlightStyle)); err != nil {
+		log.Printf("Unable to write highlight CSS: %v", err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Data(http.StatusOK, "text/css; charset=utf-8", buf.Bytes())
+}
@@ -0,0 +1,733 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/Takeso-user/blog-backend/config"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// multipartOverhead is allowed on top of media.max_size for the
+	// multipart framing of an upload.
+	multipartOverhead = 1 << 20
+	maxFilenameLength = 255
+)
+
+var (
+	ErrMediaTooLarge       = errors.New("file is too large")
+	ErrMediaTypeNotAllowed = errors.New("file type is not allowed")
+	ErrMediaQuotaExceeded  = errors.New("media quota exceeded")
+	ErrMediaNotFound       = errors.New("media not found")
+)
+
+// mediaReference finds media URLs in post content, absolute or relative.
+var mediaReference = regexp.MustCompile(`/media/([0-9a-f]{24})\b`)
+
+type MediaRepository struct {
+	Collection *mongo.Collection
+}
+
+func NewMediaRepository(collection *mongo.Collection) *MediaRepository {
+	_, err := collection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "owner_id", Value: 1}, {Key: "hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.M{"hash": 1}},
+		{Keys: bson.M{"post_ids": 1}},
+		{Keys: bson.M{"updated_at": 1}},
+	})
+	if err != nil {
+		log.Printf("Error creating media indexes: %v", err)
+	}
+	return &MediaRepository{Collection: collection}
+}
+
+func (r *MediaRepository) CreateMedia(media Media) error {
+	log.Println("Creating media for user:", media.OwnerID)
+	_, err := r.Collection.InsertOne(context.TODO(), media)
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		log.Printf("Error creating media: %v", err)
+	}
+	return err
+}
+
+func (r *MediaRepository) GetMediaByID(id string) (Media, error) {
+	var media Media
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return media, err
+	}
+	err = r.Collection.FindOne(context.TODO(), bson.M{"_id": objectID}).Decode(&media)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		log.Printf("Error getting media: %v", err)
+	}
+	return media, err
+}
+
+func (r *MediaRepository) GetMediaByOwnerAndHash(ownerID, hash string) (Media, error) {
+	var media Media
+	err := r.Collection.FindOne(context.TODO(), bson.M{"owner_id": ownerID, "hash": hash}).Decode(&media)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		log.Printf("Error getting media: %v", err)
+	}
+	return media, err
+}
+
+func (r *MediaRepository) GetUserMedia(ownerID string) ([]Media, error) {
+	return r.find(bson.M{"owner_id": ownerID})
+}
+
+func (r *MediaRepository) GetUserMediaUsage(ownerID string) (int64, error) {
+	cursor, err := r.Collection.Aggregate(context.TODO(), mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"owner_id": ownerID}}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "total": bson.M{"$sum": "$size"}}}},
+	})
+	if err != nil {
+		log.Printf("Error getting media usage: %v", err)
+		return 0, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Printf("Error closing cursor: %v", err)
+		}
+	}(cursor, context.TODO())
+
+	var result []struct {
+		Total int64 `bson:"total"`
+	}
+	if err = cursor.All(context.TODO(), &result); err != nil {
+		log.Printf("Error decoding media usage: %v", err)
+		return 0, err
+	}
+	if len(result) == 0 {
+		return 0, nil
+	}
+	return result[0].Total, nil
+}
+
+func (r *MediaRepository) CountMediaByHash(hash string) (int64, error) {
+	count, err := r.Collection.CountDocuments(context.TODO(), bson.M{"hash": hash})
+	if err != nil {
+		log.Printf("Error counting media: %v", err)
+	}
+	return count, err
+}
+
+func (r *MediaRepository) GetPostMedia(postID string) ([]Media, error) {
+	return r.find(bson.M{"post_ids": postID})
+}
+
+func (r *MediaRepository) LinkMedia(ids []primitive.ObjectID, ownerID, postID string, now time.Time) error {
+	_, err := r.Collection.UpdateMany(context.TODO(), bson.M{"_id": bson.M{"$in": ids}, "owner_id": ownerID}, bson.M{
+		"$addToSet": bson.M{"post_ids": postID},
+		"$set":      bson.M{"updated_at": now},
+	})
+	if err != nil {
+		log.Printf("Error linking media: %v", err)
+	}
+	return err
+}
+
+func (r *MediaRepository) UnlinkPostMedia(postID string, now time.Time) error {
+	_, err := r.Collection.UpdateMany(context.TODO(), bson.M{"post_ids": postID}, bson.M{
+		"$pull": bson.M{"post_ids": postID},
+		"$set":  bson.M{"updated_at": now},
+	})
+	if err != nil {
+		log.Printf("Error unlinking media: %v", err)
+	}
+	return err
+}
+
+// GetOrphanedMedia finds media no post refers to that has not been linked
+// or unlinked since before.
+func (r *MediaRepository) GetOrphanedMedia(before time.Time) ([]Media, error) {
+	return r.find(bson.M{"post_ids.0": bson.M{"$exists": false}, "updated_at": bson.M{"$lt": before}})
+}
+
+// GetUnprocessedMedia finds images still waiting for processing, including
+// those uploaded before processing existed.
+func (r *MediaRepository) GetUnprocessedMedia() ([]Media, error) {
+	return r.find(bson.M{"status": bson.M{"$nin": bson.A{MediaReady, MediaFailed}}})
+}
+
+// UpdateMedia returns mongo.ErrNoDocuments when the media no longer exists.
+func (r *MediaRepository) UpdateMedia(id primitive.ObjectID, updateFields bson.M) error {
+	result, err := r.Collection.UpdateByID(context.TODO(), id, bson.M{"$set": updateFields})
+	if err != nil {
+		log.Printf("Error updating media: %v", err)
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func (r *MediaRepository) DeleteMedia(id primitive.ObjectID) error {
+	_, err := r.Collection.DeleteOne(context.TODO(), bson.M{"_id": id})
+	if err != nil {
+		log.Printf("Error deleting media: %v", err)
+	}
+	return err
+}
+
+func (r *MediaRepository) find(filter bson.M) ([]Media, error) {
+	opts := options.Find().SetSort(bson.M{"created_at": -1})
+	cursor, err := r.Collection.Find(context.TODO(), filter, opts)
+	if err != nil {
+		log.Printf("Error getting media: %v", err)
+		return nil, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Printf("Error closing cursor: %v", err)
+		}
+	}(cursor, context.TODO())
+
+	media := []Media{}
+	if err = cursor.All(context.TODO(), &media); err != nil {
+		log.Printf("Error decoding media: %v", err)
+		return nil, err
+	}
+	return media, nil
+}
+
+// MediaService stores uploads in a BlobStore and tracks which posts use
+// them. Each user's uploads count against their quota, but identical
+// content is stored once: a user uploading the same file again gets the
+// existing media back, and blobs are shared between users by content hash.
+// Uploaded images are processed into variants in the background.
+type MediaService struct {
+	Repository    MediaRepositoryInterface
+	Store         BlobStore
+	MaxSize       int64
+	Quota         int64
+	AllowedTypes  []string
+	OrphanTTL     time.Duration
+	VariantWidths []int
+	ThumbnailSize int
+	JPEGQuality   int
+	PublicURL     string
+	// Users resolves post authors, whose own uploads are the only media
+	// linked to their posts.
+	Users *UserService
+
+	// mu keeps a blob from being deleted by garbage collection while an
+	// upload of the same content starts to share it.
+	mu    sync.Mutex
+	queue chan Media
+	jobs  sync.WaitGroup
+}
+
+func NewMediaService(repository MediaRepositoryInterface, store BlobStore, cfg config.MediaConfig, publicURL string) *MediaService {
+	s := &MediaService{
+		Repository:    repository,
+		Store:         store,
+		MaxSize:       cfg.MaxSize,
+		Quota:         cfg.UserQuota,
+		AllowedTypes:  cfg.AllowedTypes,
+		OrphanTTL:     cfg.OrphanTTL,
+		VariantWidths: cfg.VariantWidths,
+		ThumbnailSize: cfg.ThumbnailSize,
+		JPEGQuality:   cfg.JPEGQuality,
+		PublicURL:     strings.TrimRight(publicURL, "/"),
+		queue:         make(chan Media, mediaQueueSize),
+	}
+	for range max(cfg.Workers, 1) {
+		go s.work()
+	}
+	return s
+}
+
+// Upload stores the file for the owner. The type is sniffed from the
+// content; the client's Content-Type and file extension are not trusted.
+// Metadata is stripped before the file is stored, and the variants are
+// rendered afterwards in the background. The second result reports whether
+// the owner had already uploaded the same content, in which case that media
+// is returned unchanged.
+func (s *MediaService) Upload(ownerID, filename string, r io.Reader) (Media, bool, error) {
+	data, err := io.ReadAll(io.LimitReader(r, s.MaxSize+1))
+	if err != nil {
+		return Media{}, false, err
+	}
+	if int64(len(data)) > s.MaxSize {
+		return Media{}, false, ErrMediaTooLarge
+	}
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	if len(data) == 0 || !slices.Contains(s.AllowedTypes, contentType) {
+		return Media{}, false, ErrMediaTypeNotAllowed
+	}
+	// The dimensions are checked before a rotated JPEG is decoded to
+	// straighten it, so that a small file declaring a huge image can't
+	// exhaust memory.
+	if _, err := checkImage(data); err != nil {
+		return Media{}, false, err
+	}
+	if data, err = stripMetadata(contentType, data); err != nil {
+		return Media{}, false, err
+	}
+	dimensions, err := checkImage(data)
+	if err != nil {
+		return Media{}, false, err
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	existing, err := s.Repository.GetMediaByOwnerAndHash(ownerID, hash)
+	if err == nil {
+		return s.present(existing), true, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return Media{}, false, err
+	}
+	usage, err := s.Repository.GetUserMediaUsage(ownerID)
+	if err != nil {
+		return Media{}, false, err
+	}
+	if usage+int64(len(data)) > s.Quota {
+		return Media{}, false, ErrMediaQuotaExceeded
+	}
+
+	now := time.Now()
+	media := Media{
+		ID:          primitive.NewObjectID(),
+		OwnerID:     ownerID,
+		Filename:    cleanFilename(filename),
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		Hash:        hash,
+		Key:         hash[:2] + "/" + hash,
+		Width:       dimensions.Width,
+		Height:      dimensions.Height,
+		Status:      MediaProcessing,
+		PostIDs:     []string{},
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.Repository.CreateMedia(media); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			// A concurrent upload of the same file by the same user won.
+			existing, err := s.Repository.GetMediaByOwnerAndHash(ownerID, hash)
+			return s.present(existing), true, err
+		}
+		return Media{}, false, err
+	}
+	// Concurrent uploads may all have passed the check above, so the quota
+	// is checked again now that this upload counts, and it is undone if
+	// the quota was overshot.
+	usage, err = s.Repository.GetUserMediaUsage(ownerID)
+	if err == nil && usage > s.Quota {
+		err = ErrMediaQuotaExceeded
+	}
+	var count int64
+	if err == nil {
+		count, err = s.Repository.CountMediaByHash(hash)
+	}
+	if err == nil && count == 1 {
+		err = s.Store.Put(context.Background(), media.Key, bytes.NewReader(data), media.Size, contentType)
+	}
+	if err != nil {
+		if err := s.Repository.DeleteMedia(media.ID); err != nil {
+			log.Printf("Error removing media after failed upload: %v", err)
+		}
+		return Media{}, false, err
+	}
+	log.Printf("Stored media %s (%s, %d bytes)", media.ID.Hex(), contentType, media.Size)
+	s.enqueue(media)
+	return s.present(media), false, nil
+}
+
+// Get returns the media with the URLs of its variants.
+func (s *MediaService) Get(id string) (Media, error) {
+	media, err := s.Repository.GetMediaByID(id)
+	if errors.Is(err, mongo.ErrNoDocuments) || errors.Is(err, primitive.ErrInvalidHex) {
+		return Media{}, ErrMediaNotFound
+	}
+	if err != nil {
+		return Media{}, err
+	}
+	return s.present(media), nil
+}
+
+// Open returns the media and its content. The caller closes the reader.
+func (s *MediaService) Open(id string) (Media, io.ReadCloser, error) {
+	media, err := s.Get(id)
+	if err != nil {
+		return Media{}, nil, err
+	}
+	content, err := s.Store.Get(context.Background(), media.Key)
+	if errors.Is(err, ErrBlobNotFound) {
+		return Media{}, nil, ErrMediaNotFound
+	}
+	if err != nil {
+		return Media{}, nil, err
+	}
+	return media, content, nil
+}
+
+// OpenVariant returns a variant of the media and its content. The caller
+// closes the reader.
+func (s *MediaService) OpenVariant(id, name string) (MediaVariant, io.ReadCloser, error) {
+	media, err := s.Get(id)
+	if err != nil {
+		return MediaVariant{}, nil, err
+	}
+	i := slices.IndexFunc(media.Variants, func(v MediaVariant) bool { return v.Name == name })
+	if i < 0 {
+		return MediaVariant{}, nil, ErrMediaNotFound
+	}
+	variant := media.Variants[i]
+	content, err := s.Store.Get(context.Background(), variant.Key)
+	if errors.Is(err, ErrBlobNotFound) {
+		return MediaVariant{}, nil, ErrMediaNotFound
+	}
+	if err != nil {
+		return MediaVariant{}, nil, err
+	}
+	return variant, content, nil
+}
+
+// GetUserMedia lists the owner's uploads and the bytes they use.
+func (s *MediaService) GetUserMedia(ownerID string) ([]Media, int64, error) {
+	media, err := s.Repository.GetUserMedia(ownerID)
+	if err != nil {
+		return nil, 0, err
+	}
+	usage, err := s.Repository.GetUserMediaUsage(ownerID)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range media {
+		media[i] = s.present(media[i])
+	}
+	return media, usage, nil
+}
+
+// LinkPost records which of the author's uploads the post's content refers
+// to, replacing what was recorded before. Other users' media is not linked,
+// so that deleting the post can't remove it. Media dropped from the post is
+// left for PurgeOrphans.
+func (s *MediaService) LinkPost(postID, author, content string) error {
+	var ids []primitive.ObjectID
+	for _, match := range mediaReference.FindAllStringSubmatch(content, -1) {
+		id, err := primitive.ObjectIDFromHex(match[1])
+		if err == nil && !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	now := time.Now()
+	if err := s.Repository.UnlinkPostMedia(postID, now); err != nil {
+		return err
+	}
+	if len(ids) == 0 || author == "" {
+		return nil
+	}
+	owner, err := s.Users.GetUserByUsername(author)
+	if err != nil {
+		return err
+	}
+	return s.Repository.LinkMedia(ids, owner.ID.Hex(), postID, now)
+}
+
+// ReleasePost unlinks the media of a deleted post and removes the media no
+// other post uses right away.
+func (s *MediaService) ReleasePost(postID string) error {
+	linked, err := s.Repository.GetPostMedia(postID)
+	if err != nil {
+		return err
+	}
+	if err := s.Repository.UnlinkPostMedia(postID, time.Now()); err != nil {
+		return err
+	}
+	for _, media := range linked {
+		media, err := s.Repository.GetMediaByID(media.ID.Hex())
+		if err != nil {
+			continue
+		}
+		if len(media.PostIDs) == 0 {
+			if err := s.remove(media); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// PurgeOrphans removes media that no post has referred to for OrphanTTL:
+// uploads that were never used and media dropped from posts by edits.
+func (s *MediaService) PurgeOrphans(now time.Time) error {
+	orphans, err := s.Repository.GetOrphanedMedia(now.Add(-s.OrphanTTL))
+	if err != nil {
+		return err
+	}
+	for _, media := range orphans {
+		if err := s.remove(media); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// remove deletes the media and, unless other media shares them, its blob
+// and variants.
+func (s *MediaService) remove(media Media) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.Repository.DeleteMedia(media.ID); err != nil {
+		return err
+	}
+	count, err := s.Repository.CountMediaByHash(media.Hash)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		if err := s.Store.Delete(context.Background(), media.Key); err != nil {
+			return err
+		}
+		s.deleteVariants(media.Variants)
+	}
+	log.Printf("Removed unused media %s", media.ID.Hex())
+	return nil
+}
+
+func (s *MediaService) present(media Media) Media {
+	media.URL = s.PublicURL + "/media/" + media.ID.Hex()
+	for i := range media.Variants {
+		media.Variants[i].URL = media.URL + "/" + media.Variants[i].Name
+	}
+	return media
+}
+
+// cleanFilename keeps the base name of the client's file name, without
+// control characters, for the Content-Disposition of downloads.
+func cleanFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "." || name == "/" {
+		name = ""
+	}
+	if len(name) > maxFilenameLength {
+		name = name[:maxFilenameLength]
+	}
+	return strings.ToValidUTF8(name, "")
+}
+
+func MediaExportSection(mediaService *MediaService) ExportSection {
+	return ExportSection{Name: "media", Title: "Uploaded media", Collect: func(user User) (interface{}, error) {
+		media, _, err := mediaService.GetUserMedia(user.ID.Hex())
+		return media, err
+	}}
+}
+
+// UploadMedia godoc
+//
+//	@Summary		Upload media
+//	@Description	Upload an image to use in posts. The type is detected from the content and must be one of media.allowed_types. EXIF and other metadata is removed. A thumbnail and resized variants are rendered in the background; see GET /api/media/{id}. Uploading a file again returns the existing media. Media that no post refers to is removed after media.orphan_ttl.
+//	@Security		ApiKeyAuth
+//	@Tags			media
+//	@Accept			multipart/form-data
+//	@Produce		json
+//	@Param			file	formData	file	true	"File to upload"
+//	@Success		200		{object}	Response
+//	@Success		201		{object}	Response
+//	@Failure		400		{object}	Response
+//	@Failure		403		{object}	Response
+//	@Failure		413		{object}	Response
+//	@Failure		415		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/api/media [post]
+func (h *Handler) UploadMedia(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.MediaService.MaxSize+multipartOverhead)
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": ErrMediaTooLarge.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A file is required in the \"file\" form field"})
+		return
+	}
+	defer file.Close()
+
+	media, existing, err := h.MediaService.Upload(user.ID.Hex(), header.Filename, file)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrMediaTooLarge), errors.Is(err, ErrImageTooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrMediaTypeNotAllowed), errors.Is(err, ErrInvalidImage):
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrMediaQuotaExceeded):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			log.Printf("Unable to store media: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to store media"})
+		}
+		return
+	}
+	if existing {
+		c.JSON(http.StatusOK, gin.H{"message": "Media already uploaded", "media": media})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"message": "Media uploaded successfully", "media": media})
+}
+
+// GetMedia godoc
+//
+//	@Summary		List uploaded media
+//	@Description	List the user's uploads with the bytes used and the quota
+//	@Security		ApiKeyAuth
+//	@Tags			media
+//	@Produce		json
+//	@Success		200	{object}	Response
+//	@Failure		500	{object}	Response
+//	@Router			/api/media [get]
+func (h *Handler) GetMedia(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	media, usage, err := h.MediaService.GetUserMedia(user.ID.Hex())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to fetch media"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"media": media, "usage": usage, "quota": h.MediaService.Quota})
+}
+
+// GetMediaByID godoc
+//
+//	@Summary		Get media details
+//	@Description	Get uploaded media with its dimensions, blurhash placeholder and the URLs of its variants. While the status is "processing" the variants are not available yet.
+//	@Security		ApiKeyAuth
+//	@Tags			media
+//	@Produce		json
+//	@Param			id	path		string	true	"Media ID"
+//	@Success		200	{object}	Media
+//	@Failure		404	{object}	Response
+//	@Failure		500	{object}	Response
+//	@Router			/api/media/{id} [get]
+func (h *Handler) GetMediaByID(c *gin.Context) {
+	media, err := h.MediaService.Get(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, ErrMediaNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to fetch media"})
+		return
+	}
+	c.JSON(http.StatusOK, media)
+}
+
+// ServeMedia godoc
+//
+//	@Summary		Get media
+//	@Description	Get the content of uploaded media. Media is public so that it can be shown in posts.
+//	@Tags			media
+//	@Produce		image/png,image/jpeg,image/gif,image/webp
+//	@Param			id	path		string	true	"Media ID"
+//	@Success		200	{file}		binary
+//	@Failure		404	{object}	Response
+//	@Failure		500	{object}	Response
+//	@Router			/media/{id} [get]
+func (h *Handler) ServeMedia(c *gin.Context) {
+	media, content, err := h.MediaService.Open(c.Param("id"))
+	if err != nil {
+		if errors.Is(err, ErrMediaNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Unable to open media: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to fetch media"})
+		return
+	}
+	defer content.Close()
+
+	etag := strconv.Quote(media.Hash)
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	headers := map[string]string{
+		"ETag":                    etag,
+		"Cache-Control":           "public, max-age=31536000, immutable",
+		"X-Content-Type-Options":  "nosniff",
+		"Content-Security-Policy": "default-src 'none'; sandbox",
+	}
+	if media.Filename != "" {
+		headers["Content-Disposition"] = mime.FormatMediaType("inline", map[string]string{"filename": media.Filename})
+	}
+	c.DataFromReader(http.StatusOK, media.Size, media.ContentType, content, headers)
+}
+
+// ServeMediaVariant godoc
+//
+//	@Summary		Get a media variant
+//	@Description	Get a thumbnail or resized copy of uploaded media, such as thumb.webp or w640.jpg. GET /api/media/{id} lists the variants.
+//	@Tags			media
+//	@Produce		image/webp,image/jpeg
+//	@Param			id		path		string	true	"Media ID"
+//	@Param			variant	path		string	true	"Variant name"
+//	@Success		200		{file}		binary
+//	@Failure		404		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/media/{id}/{variant} [get]
+func (h *Handler) ServeMediaVariant(c *gin.Context) {
+	variant, content, err := h.MediaService.OpenVariant(c.Param("id"), c.Param("variant"))
+	if err != nil {
+		if errors.Is(err, ErrMediaNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("Unable to open media variant: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to fetch media"})
+		return
+	}
+	defer content.Close()
+
+	etag := strconv.Quote(variant.Key)
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.DataFromReader(http.StatusOK, variant.Size, variant.ContentType, content, map[string]string{
+		"ETag":                    etag,
+		"Cache-Control":           "public, max-age=31536000, immutable",
+		"X-Content-Type-Options":  "nosniff",
+		"Content-Security-Policy": "default-src 'none'; sandbox",
+	})
+}
@@ -0,0 +1,573 @@
+package pkg
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	mfaRequiredRolesSetting = "mfa_required_roles"
+	mfaChallengeAudience    = "mfa_challenge"
+	recoveryCodeCount       = 10
+)
+
+var (
+	ErrInvalidMFACode     = errors.New("invalid authentication code")
+	ErrMFANotEnrolled     = errors.New("two-factor authentication is not enabled")
+	ErrMFAAlreadyEnrolled = errors.New("two-factor authentication is already enabled")
+	ErrNoPendingMFA       = errors.New("no pending two-factor enrollment")
+)
+
+type mfaChallengeClaims struct {
+	UserID string `json:"user_id"`
+	jwt.StandardClaims
+}
+
+// MFAService manages TOTP enrollment, verification of second factors and
+// the per-role policy that makes two-factor login mandatory.
+type MFAService struct {
+	UserService  *UserService
+	Settings     SettingsRepositoryInterface
+	Issuer       string
+	ChallengeTTL time.Duration
+
+	mu            sync.RWMutex
+	requiredRoles []string
+}
+
+// NewMFAService loads the required-roles policy from settings, falling back
+// to defaultRequiredRoles when none has been saved yet.
+func NewMFAService(userService *UserService, settings SettingsRepositoryInterface, issuer string, challengeTTL time.Duration, defaultRequiredRoles []string) *MFAService {
+	s := &MFAService{
+		UserService:   userService,
+		Settings:      settings,
+		Issuer:        issuer,
+		ChallengeTTL:  challengeTTL,
+		requiredRoles: defaultRequiredRoles,
+	}
+	if settings != nil {
+		var roles []string
+		if err := settings.GetSetting(mfaRequiredRolesSetting, &roles); err == nil {
+			s.requiredRoles = roles
+		}
+	}
+	return s
+}
+
+func (s *MFAService) RequiredRoles() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]string{}, s.requiredRoles...)
+}
+
+func (s *MFAService) SetRequiredRoles(roles []string) error {
+	if s.Settings != nil {
+		if err := s.Settings.SaveSetting(mfaRequiredRolesSetting, roles); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requiredRoles = roles
+	return nil
+}
+
+func (s *MFAService) RoleRequiresMFA(role string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, r := range s.requiredRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// mfaSigningKey derives a separate key for challenge tokens so that they
+// can never be accepted by ParseJWT as a login token.
+func mfaSigningKey() []byte {
+	sum := sha256.Sum256(append(GetJWTSecret(), []byte(":"+mfaChallengeAudience)...))
+	return sum[:]
+}
+
+func (s *MFAService) NewChallenge(user User) (string, error) {
+	now := time.Now()
+	claims := &mfaChallengeClaims{
+		UserID: user.ID.Hex(),
+		StandardClaims: jwt.StandardClaims{
+			Audience:  mfaChallengeAudience,
+			ExpiresAt: now.Add(s.ChallengeTTL).Unix(),
+			IssuedAt:  now.Unix(),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(mfaSigningKey())
+}
+
+func (s *MFAService) ParseChallenge(tokenStr string) (string, error) {
+	claims := &mfaChallengeClaims{}
+	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return mfaSigningKey(), nil
+	})
+	if err != nil || !token.Valid || !claims.VerifyAudience(mfaChallengeAudience, true) {
+		return "", ErrInvalidToken
+	}
+	return claims.UserID, nil
+}
+
+// BeginEnrollment stores a new pending secret and returns it together with
+// the otpauth URI to show as a QR code.
+func (s *MFAService) BeginEnrollment(user User) (string, string, error) {
+	if user.TOTPEnabled {
+		return "", "", ErrMFAAlreadyEnrolled
+	}
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := s.UserService.UpdateUser(user.ID, bson.M{"totp_pending_secret": secret}); err != nil {
+		return "", "", err
+	}
+	return secret, TOTPURI(s.Issuer, user.Username, secret), nil
+}
+
+// ConfirmEnrollment activates TOTP once the user proves their app produces
+// valid codes, and returns a fresh set of recovery codes.
+func (s *MFAService) ConfirmEnrollment(user User, code string) ([]string, error) {
+	if user.TOTPEnabled {
+		return nil, ErrMFAAlreadyEnrolled
+	}
+	if user.TOTPPendingSecret == "" {
+		return nil, ErrNoPendingMFA
+	}
+	step, ok := ValidateTOTP(user.TOTPPendingSecret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidMFACode
+	}
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.UserService.UpdateUser(user.ID, bson.M{
+		"totp_enabled":        true,
+		"totp_secret":         user.TOTPPendingSecret,
+		"totp_pending_secret": "",
+		"totp_last_step":      step,
+		"recovery_codes":      hashes,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// Verify accepts either a current TOTP code or an unused recovery code.
+// Each TOTP time step and each recovery code can be used only once.
+// Users with only passkeys can still fall back to their recovery codes.
+func (s *MFAService) Verify(user User, code string) error {
+	if !user.TOTPEnabled && len(user.WebAuthnCredentials) == 0 {
+		return ErrMFANotEnrolled
+	}
+	if user.TOTPEnabled {
+		if step, ok := ValidateTOTP(user.TOTPSecret, code, time.Now()); ok {
+			if step <= user.TOTPLastStep {
+				return ErrInvalidMFACode
+			}
+			// The step is checked again as it is recorded, in case a
+			// concurrent request used the same code.
+			used, err := s.UserService.UseTOTPStep(user, step)
+			if err == nil && !used {
+				return ErrInvalidMFACode
+			}
+			return err
+		}
+	}
+
+	hash := hashRecoveryCode(code)
+	for _, stored := range user.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(stored), []byte(hash)) == 1 {
+			used, err := s.UserService.UseRecoveryCode(user, stored)
+			if err != nil {
+				return err
+			}
+			if !used {
+				return ErrInvalidMFACode
+			}
+			log.Printf("Recovery code used by %s, %d left", user.Username, len(user.RecoveryCodes)-1)
+			return nil
+		}
+	}
+	return ErrInvalidMFACode
+}
+
+func (s *MFAService) Disable(user User, code string) error {
+	if !user.TOTPEnabled {
+		return ErrMFANotEnrolled
+	}
+	if err := s.Verify(user, code); err != nil {
+		return err
+	}
+	fields := bson.M{
+		"totp_enabled":   false,
+		"totp_secret":    "",
+		"totp_last_step": int64(0),
+	}
+	// Recovery codes stay valid while passkeys remain as a second factor.
+	if len(user.WebAuthnCredentials) == 0 {
+		fields["recovery_codes"] = []string{}
+	}
+	_, err := s.UserService.UpdateUser(user.ID, fields)
+	return err
+}
+
+func (s *MFAService) RegenerateRecoveryCodes(user User, code string) ([]string, error) {
+	if err := s.Verify(user, code); err != nil {
+		return nil, err
+	}
+	// Verify may have consumed a recovery code; the new set replaces all.
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.UserService.UpdateUser(user.ID, bson.M{"recovery_codes": hashes}); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// EnforcementMiddleware blocks users whose role requires two-factor login
+// but whose token was not obtained with one. Only the enrollment endpoints
+// under /api/me/mfa and /api/me/webauthn stay reachable so that they can
+// set it up.
+func (s *MFAService) EnforcementMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, _ := c.Get("role")
+		mfa, _ := c.Get("mfa")
+		roleName, _ := role.(string)
+		if passed, _ := mfa.(bool); passed || !s.RoleRequiresMFA(roleName) {
+			c.Next()
+			return
+		}
+		if path := c.FullPath(); strings.HasPrefix(path, "/api/me/mfa") || strings.HasPrefix(path, "/api/me/webauthn") {
+			c.Next()
+			return
+		}
+		log.Printf("Role %s requires two-factor authentication", roleName)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is required for your role", "mfa_enrollment_required": true})
+		c.Abort()
+	}
+}
+
+func generateRecoveryCodes() ([]string, []string, error) {
+	const alphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	buf := make([]byte, 10)
+	for i := range codes {
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		var b strings.Builder
+		for j, v := range buf {
+			if j == 5 {
+				b.WriteByte('-')
+			}
+			b.WriteByte(alphabet[int(v)%len(alphabet)])
+		}
+		codes[i] = b.String()
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.TrimSpace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+func mfaErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidMFACode), errors.Is(err, ErrNoPendingMFA),
+		errors.Is(err, ErrMFANotEnrolled), errors.Is(err, ErrMFAAlreadyEnrolled):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// challengedUser resolves the user behind an MFA challenge token and
+// applies the login lockout. On failure it writes the error response itself
+// and returns false.
+func (h *Handler) challengedUser(c *gin.Context, mfaToken string) (User, bool) {
+	userID, err := h.MFAService.ParseChallenge(mfaToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return User{}, false
+	}
+	user, err := h.UserService.GetUserByID(userID)
+	if err != nil {
+		log.Printf("Unable to fetch user: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return User{}, false
+	}
+	if h.LockoutService != nil {
+		if wait := h.LockoutService.Check(user.Username, c.ClientIP(), time.Now()); wait > 0 {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts, try again later"})
+			return User{}, false
+		}
+	}
+	if h.restrictedLogin(c, user) {
+		return User{}, false
+	}
+	return user, true
+}
+
+// VerifyMFA godoc
+//
+//	@Summary		Complete a two-factor login
+//	@Description	Exchange the MFA challenge token from /auth/login and a TOTP or recovery code for a JWT
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			input	body		object{mfa_token=string,code=string}	true	"Challenge token and code"
+//	@Success		200		{object}	Response
+//	@Failure		400		{object}	Response
+//	@Failure		401		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/auth/mfa/verify [post]
+func (h *Handler) VerifyMFA(c *gin.Context) {
+	var input struct {
+		MFAToken string `json:"mfa_token" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, ok := h.challengedUser(c, input.MFAToken)
+	if !ok {
+		return
+	}
+	if err := h.MFAService.Verify(user, input.Code); err != nil {
+		log.Printf("MFA verification failed: %v", err)
+		h.recordLoginFailure(c, user.Username)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+
+	token, err := h.issueToken(c, user, true)
+	if err != nil {
+		log.Printf("Failed to generate token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	h.auditLogin(c, user, true)
+	log.Println("User logged in successfully with MFA")
+	c.JSON(http.StatusOK, gin.H{"token": token})
+}
+
+// EnrollTOTP godoc
+//
+//	@Summary		Start TOTP enrollment
+//	@Description	Generate a TOTP secret and otpauth URI for the current user
+//	@Security		ApiKeyAuth
+//	@Tags			mfa
+//	@Produce		json
+//	@Success		200	{object}	Response
+//	@Failure		400	{object}	Response
+//	@Failure		500	{object}	Response
+//	@Router			/api/me/mfa/totp/enroll [post]
+func (h *Handler) EnrollTOTP(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	secret, uri, err := h.MFAService.BeginEnrollment(user)
+	if err != nil {
+		log.Printf("Unable to start TOTP enrollment: %v", err)
+		c.JSON(mfaErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"secret": secret, "otpauth_uri": uri})
+}
+
+// ConfirmTOTP godoc
+//
+//	@Summary		Confirm TOTP enrollment
+//	@Description	Activate TOTP with a code from the authenticator app; returns one-time recovery codes and a new token
+//	@Security		ApiKeyAuth
+//	@Tags			mfa
+//	@Accept			json
+//	@Produce		json
+//	@Param			input	body		object{code=string}	true	"TOTP code"
+//	@Success		200		{object}	Response
+//	@Failure		400		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/api/me/mfa/totp/confirm [post]
+func (h *Handler) ConfirmTOTP(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	codes, err := h.MFAService.ConfirmEnrollment(user, input.Code)
+	if err != nil {
+		log.Printf("Unable to confirm TOTP enrollment: %v", err)
+		c.JSON(mfaErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	h.audit(c, AuditEvent{Action: AuditTOTPEnable, TargetType: auditTargetUser, TargetID: user.ID.Hex()}, nil, nil)
+	token, err := h.issueToken(c, user, true)
+	if err != nil {
+		log.Printf("Failed to generate token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication enabled", "recovery_codes": codes, "token": token})
+}
+
+// DisableTOTP godoc
+//
+//	@Summary		Disable TOTP
+//	@Description	Turn off two-factor authentication for the current user
+//	@Security		ApiKeyAuth
+//	@Tags			mfa
+//	@Accept			json
+//	@Produce		json
+//	@Param			input	body		object{code=string}	true	"TOTP or recovery code"
+//	@Success		200		{object}	Response
+//	@Failure		400		{object}	Response
+//	@Failure		403		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/api/me/mfa/totp [delete]
+func (h *Handler) DisableTOTP(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if h.MFAService.RoleRequiresMFA(user.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is required for your role"})
+		return
+	}
+	if err := h.MFAService.Disable(user, input.Code); err != nil {
+		log.Printf("Unable to disable TOTP: %v", err)
+		c.JSON(mfaErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	h.audit(c, AuditEvent{Action: AuditTOTPDisable, TargetType: auditTargetUser, TargetID: user.ID.Hex()}, nil, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes godoc
+//
+//	@Summary		Regenerate recovery codes
+//	@Description	Replace all recovery codes of the current user with a new set
+//	@Security		ApiKeyAuth
+//	@Tags			mfa
+//	@Accept			json
+//	@Produce		json
+//	@Param			input	body		object{code=string}	true	"TOTP or recovery code"
+//	@Success		200		{object}	Response
+//	@Failure		400		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/api/me/mfa/recovery-codes [post]
+func (h *Handler) RegenerateRecoveryCodes(c *gin.Context) {
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	codes, err := h.MFAService.RegenerateRecoveryCodes(user, input.Code)
+	if err != nil {
+		log.Printf("Unable to regenerate recovery codes: %v", err)
+		c.JSON(mfaErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// GetMFAPolicy godoc
+//
+//	@Summary		Get the MFA policy
+//	@Description	List the roles that must use two-factor authentication
+//	@Security		ApiKeyAuth
+//	@Tags			admin
+//	@Produce		json
+//	@Success		200	{object}	Response
+//	@Failure		403	{object}	Response
+//	@Router			/api/admin/mfa/policy [get]
+func (h *Handler) GetMFAPolicy(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"required_roles": h.MFAService.RequiredRoles()})
+}
+
+// UpdateMFAPolicy godoc
+//
+//	@Summary		Update the MFA policy
+//	@Description	Set the roles that must use two-factor authentication
+//	@Security		ApiKeyAuth
+//	@Tags			admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			input	body		object{required_roles=[]string}	true	"Roles requiring MFA"
+//	@Success		200		{object}	Response
+//	@Failure		400		{object}	Response
+//	@Failure		403		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/api/admin/mfa/policy [put]
+func (h *Handler) UpdateMFAPolicy(c *gin.Context) {
+	var input struct {
+		RequiredRoles []string `json:"required_roles"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.RequiredRoles == nil {
+		input.RequiredRoles = []string{}
+	}
+	before := h.MFAService.RequiredRoles()
+	if err := h.MFAService.SetRequiredRoles(input.RequiredRoles); err != nil {
+		log.Printf("Unable to update MFA policy: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to update MFA policy"})
+		return
+	}
+	h.audit(c, AuditEvent{Action: AuditMFAPolicyChange, TargetType: auditTargetSettings, TargetID: "mfa_policy"},
+		gin.H{"required_roles": before}, gin.H{"required_roles": input.RequiredRoles})
+	log.Printf("MFA now required for roles: %v", input.RequiredRoles)
+	c.JSON(http.StatusOK, gin.H{"required_roles": input.RequiredRoles})
+}
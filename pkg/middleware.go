@@ -1,14 +1,47 @@
 package pkg
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"log"
 	"net/http"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func JWTMiddleware() gin.HandlerFunc {
+const (
+	requestIDHeader = "X-Request-ID"
+	requestIDKey    = "request_id"
+)
+
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestIDMiddleware tags each request with an ID, reusing a well-formed
+// X-Request-ID from a proxy in front of us, and echoes it in the response
+// so log lines and audit events can be matched to a request.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			buf := make([]byte, 16)
+			if _, err := rand.Read(buf); err != nil {
+				log.Printf("Unable to generate request ID: %v", err)
+			}
+			id = hex.EncodeToString(buf)
+		}
+		c.Set(requestIDKey, id)
+		c.Header(requestIDHeader, id)
+		c.Next()
+	}
+}
+
+// JWTMiddleware authenticates requests by bearer token. When sessions is
+// non-nil, tokens must belong to a session that is still active. Tokens
+// starting with "pat_" are personal access tokens checked against tokens.
+func JWTMiddleware(sessions *SessionService, tokens *AccessTokenService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenStr := c.GetHeader("Authorization")
 		if tokenStr == "" {
@@ -20,6 +53,14 @@ func JWTMiddleware() gin.HandlerFunc {
 		if strings.HasPrefix(tokenStr, "Bearer ") {
 			tokenStr = tokenStr[7:]
 		}
+		if strings.HasPrefix(tokenStr, AccessTokenPrefix) {
+			if !authenticateAccessToken(c, tokens, tokenStr) {
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
 		claims, err := ParseJWT(tokenStr)
 		if err != nil {
 			log.Printf("Invalid token: %v", err)
@@ -28,13 +69,63 @@ func JWTMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		if sessions != nil && (claims.SessionID == "" || !sessions.IsActive(claims.SessionID, time.Now())) {
+			log.Printf("Session revoked or expired for user: %s", claims.Username)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session expired"})
+			c.Abort()
+			return
+		}
+
+		c.Set("user_id", claims.UserID)
+		c.Set("session_id", claims.SessionID)
 		c.Set("username", claims.Username)
 		c.Set("role", claims.Role)
+		c.Set("mfa", claims.MFA)
+		if claims.Impersonator != "" {
+			c.Set("impersonator", claims.Impersonator)
+			log.Printf("Token valid for user: %s, role: %s, impersonated by %s", claims.Username, claims.Role, claims.Impersonator)
+			c.Next()
+			return
+		}
 		log.Printf("Token valid for user: %s, role: %s", claims.Username, claims.Role)
 		c.Next()
 	}
 }
 
+func AdminMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, roleExists := c.Get("role")
+		if !roleExists {
+			log.Println("Missing or invalid token")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing or invalid token"})
+			c.Abort()
+			return
+		}
+		if role != "Admin" {
+			log.Printf("Admin access denied for role %v", role)
+			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// DenyImpersonationMiddleware rejects tokens issued to an admin acting as
+// another user. It guards credential and account changes that support
+// staff should not make on a user's behalf.
+func DenyImpersonationMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if impersonator, ok := c.Get("impersonator"); ok {
+			log.Printf("Impersonated request by %v to %s denied", impersonator, c.FullPath())
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not allowed while impersonating"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
 func OwnerOrAdminMiddleware(postService *PostService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		role, roleExists := c.Get("role")
@@ -6,8 +6,11 @@ package mocks
 
 import (
 	context "context"
+	io "io"
 	reflect "reflect"
+	time "time"
 
+	config "github.com/Takeso-user/blog-backend/config"
 	pkg "github.com/Takeso-user/blog-backend/pkg"
 	gomock "github.com/golang/mock/gomock"
 	bson "go.mongodb.org/mongo-driver/bson"
@@ -65,6 +68,36 @@ func (mr *MockPostRepositoryInterfaceMockRecorder) DeletePost(postID interface{}
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeletePost", reflect.TypeOf((*MockPostRepositoryInterface)(nil).DeletePost), postID)
 }
 
+// DeletePostsByAuthor mocks base method.
+func (m *MockPostRepositoryInterface) DeletePostsByAuthor(authorID string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeletePostsByAuthor", authorID)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeletePostsByAuthor indicates an expected call of DeletePostsByAuthor.
+func (mr *MockPostRepositoryInterfaceMockRecorder) DeletePostsByAuthor(authorID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeletePostsByAuthor", reflect.TypeOf((*MockPostRepositoryInterface)(nil).DeletePostsByAuthor), authorID)
+}
+
+// GetFeedPosts mocks base method.
+func (m *MockPostRepositoryInterface) GetFeedPosts(query pkg.FeedQuery) ([]pkg.Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetFeedPosts", query)
+	ret0, _ := ret[0].([]pkg.Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetFeedPosts indicates an expected call of GetFeedPosts.
+func (mr *MockPostRepositoryInterfaceMockRecorder) GetFeedPosts(query interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFeedPosts", reflect.TypeOf((*MockPostRepositoryInterface)(nil).GetFeedPosts), query)
+}
+
 // GetPostByID mocks base method.
 func (m *MockPostRepositoryInterface) GetPostByID(postID string) (pkg.Post, error) {
 	m.ctrl.T.Helper()
@@ -95,6 +128,51 @@ func (mr *MockPostRepositoryInterfaceMockRecorder) GetPosts() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPosts", reflect.TypeOf((*MockPostRepositoryInterface)(nil).GetPosts))
 }
 
+// GetPostsByAuthor mocks base method.
+func (m *MockPostRepositoryInterface) GetPostsByAuthor(authorID string) ([]pkg.Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPostsByAuthor", authorID)
+	ret0, _ := ret[0].([]pkg.Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPostsByAuthor indicates an expected call of GetPostsByAuthor.
+func (mr *MockPostRepositoryInterfaceMockRecorder) GetPostsByAuthor(authorID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPostsByAuthor", reflect.TypeOf((*MockPostRepositoryInterface)(nil).GetPostsByAuthor), authorID)
+}
+
+// GetPostsByIDs mocks base method.
+func (m *MockPostRepositoryInterface) GetPostsByIDs(ids []string) ([]pkg.Post, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPostsByIDs", ids)
+	ret0, _ := ret[0].([]pkg.Post)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPostsByIDs indicates an expected call of GetPostsByIDs.
+func (mr *MockPostRepositoryInterfaceMockRecorder) GetPostsByIDs(ids interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPostsByIDs", reflect.TypeOf((*MockPostRepositoryInterface)(nil).GetPostsByIDs), ids)
+}
+
+// IncrementPostReactions mocks base method.
+func (m *MockPostRepositoryInterface) IncrementPostReactions(id string, deltas map[string]int) (map[string]int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IncrementPostReactions", id, deltas)
+	ret0, _ := ret[0].(map[string]int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IncrementPostReactions indicates an expected call of IncrementPostReactions.
+func (mr *MockPostRepositoryInterfaceMockRecorder) IncrementPostReactions(id, deltas interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncrementPostReactions", reflect.TypeOf((*MockPostRepositoryInterface)(nil).IncrementPostReactions), id, deltas)
+}
+
 // UpdatePost mocks base method.
 func (m *MockPostRepositoryInterface) UpdatePost(id primitive.ObjectID, updateFields bson.M) (pkg.Post, error) {
 	m.ctrl.T.Helper()
@@ -110,6 +188,88 @@ func (mr *MockPostRepositoryInterfaceMockRecorder) UpdatePost(id, updateFields i
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePost", reflect.TypeOf((*MockPostRepositoryInterface)(nil).UpdatePost), id, updateFields)
 }
 
+// UpdatePostsByAuthor mocks base method.
+func (m *MockPostRepositoryInterface) UpdatePostsByAuthor(authorID string, updateFields bson.M) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdatePostsByAuthor", authorID, updateFields)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdatePostsByAuthor indicates an expected call of UpdatePostsByAuthor.
+func (mr *MockPostRepositoryInterfaceMockRecorder) UpdatePostsByAuthor(authorID, updateFields interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdatePostsByAuthor", reflect.TypeOf((*MockPostRepositoryInterface)(nil).UpdatePostsByAuthor), authorID, updateFields)
+}
+
+// MockSlugRepositoryInterface is a mock of SlugRepositoryInterface interface.
+type MockSlugRepositoryInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockSlugRepositoryInterfaceMockRecorder
+}
+
+// MockSlugRepositoryInterfaceMockRecorder is the mock recorder for MockSlugRepositoryInterface.
+type MockSlugRepositoryInterfaceMockRecorder struct {
+	mock *MockSlugRepositoryInterface
+}
+
+// NewMockSlugRepositoryInterface creates a new mock instance.
+func NewMockSlugRepositoryInterface(ctrl *gomock.Controller) *MockSlugRepositoryInterface {
+	mock := &MockSlugRepositoryInterface{ctrl: ctrl}
+	mock.recorder = &MockSlugRepositoryInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSlugRepositoryInterface) EXPECT() *MockSlugRepositoryInterfaceMockRecorder {
+	return m.recorder
+}
+
+// CreatePostSlug mocks base method.
+func (m *MockSlugRepositoryInterface) CreatePostSlug(slug pkg.PostSlug) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreatePostSlug", slug)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreatePostSlug indicates an expected call of CreatePostSlug.
+func (mr *MockSlugRepositoryInterfaceMockRecorder) CreatePostSlug(slug interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreatePostSlug", reflect.TypeOf((*MockSlugRepositoryInterface)(nil).CreatePostSlug), slug)
+}
+
+// DeletePostSlugs mocks base method.
+func (m *MockSlugRepositoryInterface) DeletePostSlugs(postID string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeletePostSlugs", postID)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeletePostSlugs indicates an expected call of DeletePostSlugs.
+func (mr *MockSlugRepositoryInterfaceMockRecorder) DeletePostSlugs(postID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeletePostSlugs", reflect.TypeOf((*MockSlugRepositoryInterface)(nil).DeletePostSlugs), postID)
+}
+
+// GetPostSlug mocks base method.
+func (m *MockSlugRepositoryInterface) GetPostSlug(slug string) (pkg.PostSlug, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPostSlug", slug)
+	ret0, _ := ret[0].(pkg.PostSlug)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPostSlug indicates an expected call of GetPostSlug.
+func (mr *MockSlugRepositoryInterfaceMockRecorder) GetPostSlug(slug interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPostSlug", reflect.TypeOf((*MockSlugRepositoryInterface)(nil).GetPostSlug), slug)
+}
+
 // MockCommentRepositoryInterface is a mock of CommentRepositoryInterface interface.
 type MockCommentRepositoryInterface struct {
 	ctrl     *gomock.Controller
@@ -161,6 +321,21 @@ func (mr *MockCommentRepositoryInterfaceMockRecorder) DeleteComment(commentID in
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteComment", reflect.TypeOf((*MockCommentRepositoryInterface)(nil).DeleteComment), commentID)
 }
 
+// DeleteCommentsByUser mocks base method.
+func (m *MockCommentRepositoryInterface) DeleteCommentsByUser(userID string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteCommentsByUser", userID)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteCommentsByUser indicates an expected call of DeleteCommentsByUser.
+func (mr *MockCommentRepositoryInterfaceMockRecorder) DeleteCommentsByUser(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteCommentsByUser", reflect.TypeOf((*MockCommentRepositoryInterface)(nil).DeleteCommentsByUser), userID)
+}
+
 // GetAllComment mocks base method.
 func (m *MockCommentRepositoryInterface) GetAllComment() ([]pkg.Comment, error) {
 	m.ctrl.T.Helper()
@@ -176,6 +351,21 @@ func (mr *MockCommentRepositoryInterfaceMockRecorder) GetAllComment() *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAllComment", reflect.TypeOf((*MockCommentRepositoryInterface)(nil).GetAllComment))
 }
 
+// GetCommentByID mocks base method.
+func (m *MockCommentRepositoryInterface) GetCommentByID(commentID string) (pkg.Comment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCommentByID", commentID)
+	ret0, _ := ret[0].(pkg.Comment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCommentByID indicates an expected call of GetCommentByID.
+func (mr *MockCommentRepositoryInterfaceMockRecorder) GetCommentByID(commentID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCommentByID", reflect.TypeOf((*MockCommentRepositoryInterface)(nil).GetCommentByID), commentID)
+}
+
 // GetComments mocks base method.
 func (m *MockCommentRepositoryInterface) GetComments(postID string) ([]pkg.Comment, error) {
 	m.ctrl.T.Helper()
@@ -191,6 +381,36 @@ func (mr *MockCommentRepositoryInterfaceMockRecorder) GetComments(postID interfa
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetComments", reflect.TypeOf((*MockCommentRepositoryInterface)(nil).GetComments), postID)
 }
 
+// GetCommentsByUser mocks base method.
+func (m *MockCommentRepositoryInterface) GetCommentsByUser(userID string) ([]pkg.Comment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCommentsByUser", userID)
+	ret0, _ := ret[0].([]pkg.Comment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCommentsByUser indicates an expected call of GetCommentsByUser.
+func (mr *MockCommentRepositoryInterfaceMockRecorder) GetCommentsByUser(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCommentsByUser", reflect.TypeOf((*MockCommentRepositoryInterface)(nil).GetCommentsByUser), userID)
+}
+
+// IncrementCommentReactions mocks base method.
+func (m *MockCommentRepositoryInterface) IncrementCommentReactions(id string, deltas map[string]int) (map[string]int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IncrementCommentReactions", id, deltas)
+	ret0, _ := ret[0].(map[string]int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IncrementCommentReactions indicates an expected call of IncrementCommentReactions.
+func (mr *MockCommentRepositoryInterfaceMockRecorder) IncrementCommentReactions(id, deltas interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IncrementCommentReactions", reflect.TypeOf((*MockCommentRepositoryInterface)(nil).IncrementCommentReactions), id, deltas)
+}
+
 // UpdateComment mocks base method.
 func (m *MockCommentRepositoryInterface) UpdateComment(ctx context.Context, filter, updateFields bson.M) (pkg.Comment, error) {
 	m.ctrl.T.Helper()
@@ -206,84 +426,1844 @@ func (mr *MockCommentRepositoryInterfaceMockRecorder) UpdateComment(ctx, filter,
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateComment", reflect.TypeOf((*MockCommentRepositoryInterface)(nil).UpdateComment), ctx, filter, updateFields)
 }
 
-// MockUserRepositoryInterface is a mock of UserRepositoryInterface interface.
-type MockUserRepositoryInterface struct {
+// UpdateCommentsByUser mocks base method.
+func (m *MockCommentRepositoryInterface) UpdateCommentsByUser(userID string, updateFields bson.M) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateCommentsByUser", userID, updateFields)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateCommentsByUser indicates an expected call of UpdateCommentsByUser.
+func (mr *MockCommentRepositoryInterfaceMockRecorder) UpdateCommentsByUser(userID, updateFields interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateCommentsByUser", reflect.TypeOf((*MockCommentRepositoryInterface)(nil).UpdateCommentsByUser), userID, updateFields)
+}
+
+// MockReactionRepositoryInterface is a mock of ReactionRepositoryInterface interface.
+type MockReactionRepositoryInterface struct {
 	ctrl     *gomock.Controller
-	recorder *MockUserRepositoryInterfaceMockRecorder
+	recorder *MockReactionRepositoryInterfaceMockRecorder
 }
 
-// MockUserRepositoryInterfaceMockRecorder is the mock recorder for MockUserRepositoryInterface.
-type MockUserRepositoryInterfaceMockRecorder struct {
-	mock *MockUserRepositoryInterface
+// MockReactionRepositoryInterfaceMockRecorder is the mock recorder for MockReactionRepositoryInterface.
+type MockReactionRepositoryInterfaceMockRecorder struct {
+	mock *MockReactionRepositoryInterface
 }
 
-// NewMockUserRepositoryInterface creates a new mock instance.
-func NewMockUserRepositoryInterface(ctrl *gomock.Controller) *MockUserRepositoryInterface {
-	mock := &MockUserRepositoryInterface{ctrl: ctrl}
-	mock.recorder = &MockUserRepositoryInterfaceMockRecorder{mock}
+// NewMockReactionRepositoryInterface creates a new mock instance.
+func NewMockReactionRepositoryInterface(ctrl *gomock.Controller) *MockReactionRepositoryInterface {
+	mock := &MockReactionRepositoryInterface{ctrl: ctrl}
+	mock.recorder = &MockReactionRepositoryInterfaceMockRecorder{mock}
 	return mock
 }
 
 // EXPECT returns an object that allows the caller to indicate expected use.
-func (m *MockUserRepositoryInterface) EXPECT() *MockUserRepositoryInterfaceMockRecorder {
+func (m *MockReactionRepositoryInterface) EXPECT() *MockReactionRepositoryInterfaceMockRecorder {
 	return m.recorder
 }
 
-// CreateUser mocks base method.
-func (m *MockUserRepositoryInterface) CreateUser(user pkg.User) error {
+// DeleteReaction mocks base method.
+func (m *MockReactionRepositoryInterface) DeleteReaction(id, reactionType string) (bool, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateUser", user)
+	ret := m.ctrl.Call(m, "DeleteReaction", id, reactionType)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteReaction indicates an expected call of DeleteReaction.
+func (mr *MockReactionRepositoryInterfaceMockRecorder) DeleteReaction(id, reactionType interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteReaction", reflect.TypeOf((*MockReactionRepositoryInterface)(nil).DeleteReaction), id, reactionType)
+}
+
+// DeleteReactionsByTarget mocks base method.
+func (m *MockReactionRepositoryInterface) DeleteReactionsByTarget(targetType string, targetIDs []string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteReactionsByTarget", targetType, targetIDs)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteReactionsByTarget indicates an expected call of DeleteReactionsByTarget.
+func (mr *MockReactionRepositoryInterfaceMockRecorder) DeleteReactionsByTarget(targetType, targetIDs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteReactionsByTarget", reflect.TypeOf((*MockReactionRepositoryInterface)(nil).DeleteReactionsByTarget), targetType, targetIDs)
+}
+
+// GetReactionsByUser mocks base method.
+func (m *MockReactionRepositoryInterface) GetReactionsByUser(userID string) ([]pkg.Reaction, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetReactionsByUser", userID)
+	ret0, _ := ret[0].([]pkg.Reaction)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetReactionsByUser indicates an expected call of GetReactionsByUser.
+func (mr *MockReactionRepositoryInterfaceMockRecorder) GetReactionsByUser(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetReactionsByUser", reflect.TypeOf((*MockReactionRepositoryInterface)(nil).GetReactionsByUser), userID)
+}
+
+// GetUserReactions mocks base method.
+func (m *MockReactionRepositoryInterface) GetUserReactions(userID, targetType string, targetIDs []string) (map[string]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserReactions", userID, targetType, targetIDs)
+	ret0, _ := ret[0].(map[string]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserReactions indicates an expected call of GetUserReactions.
+func (mr *MockReactionRepositoryInterfaceMockRecorder) GetUserReactions(userID, targetType, targetIDs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserReactions", reflect.TypeOf((*MockReactionRepositoryInterface)(nil).GetUserReactions), userID, targetType, targetIDs)
+}
+
+// SetReaction mocks base method.
+func (m *MockReactionRepositoryInterface) SetReaction(reaction pkg.Reaction) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetReaction", reaction)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetReaction indicates an expected call of SetReaction.
+func (mr *MockReactionRepositoryInterfaceMockRecorder) SetReaction(reaction interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetReaction", reflect.TypeOf((*MockReactionRepositoryInterface)(nil).SetReaction), reaction)
+}
+
+// MockBookmarkRepositoryInterface is a mock of BookmarkRepositoryInterface interface.
+type MockBookmarkRepositoryInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockBookmarkRepositoryInterfaceMockRecorder
+}
+
+// MockBookmarkRepositoryInterfaceMockRecorder is the mock recorder for MockBookmarkRepositoryInterface.
+type MockBookmarkRepositoryInterfaceMockRecorder struct {
+	mock *MockBookmarkRepositoryInterface
+}
+
+// NewMockBookmarkRepositoryInterface creates a new mock instance.
+func NewMockBookmarkRepositoryInterface(ctrl *gomock.Controller) *MockBookmarkRepositoryInterface {
+	mock := &MockBookmarkRepositoryInterface{ctrl: ctrl}
+	mock.recorder = &MockBookmarkRepositoryInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockBookmarkRepositoryInterface) EXPECT() *MockBookmarkRepositoryInterfaceMockRecorder {
+	return m.recorder
+}
+
+// ClearBookmarkList mocks base method.
+func (m *MockBookmarkRepositoryInterface) ClearBookmarkList(listID string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClearBookmarkList", listID)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClearBookmarkList indicates an expected call of ClearBookmarkList.
+func (mr *MockBookmarkRepositoryInterfaceMockRecorder) ClearBookmarkList(listID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClearBookmarkList", reflect.TypeOf((*MockBookmarkRepositoryInterface)(nil).ClearBookmarkList), listID)
+}
+
+// CreateBookmark mocks base method.
+func (m *MockBookmarkRepositoryInterface) CreateBookmark(bookmark pkg.Bookmark) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateBookmark", bookmark)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
-// CreateUser indicates an expected call of CreateUser.
-func (mr *MockUserRepositoryInterfaceMockRecorder) CreateUser(user interface{}) *gomock.Call {
+// CreateBookmark indicates an expected call of CreateBookmark.
+func (mr *MockBookmarkRepositoryInterfaceMockRecorder) CreateBookmark(bookmark interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockUserRepositoryInterface)(nil).CreateUser), user)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateBookmark", reflect.TypeOf((*MockBookmarkRepositoryInterface)(nil).CreateBookmark), bookmark)
 }
 
-// GetUserByID mocks base method.
-func (m *MockUserRepositoryInterface) GetUserByID(userID string) (pkg.User, error) {
+// DeleteBookmark mocks base method.
+func (m *MockBookmarkRepositoryInterface) DeleteBookmark(id primitive.ObjectID) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUserByID", userID)
-	ret0, _ := ret[0].(pkg.User)
+	ret := m.ctrl.Call(m, "DeleteBookmark", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteBookmark indicates an expected call of DeleteBookmark.
+func (mr *MockBookmarkRepositoryInterfaceMockRecorder) DeleteBookmark(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteBookmark", reflect.TypeOf((*MockBookmarkRepositoryInterface)(nil).DeleteBookmark), id)
+}
+
+// DeleteBookmarksByUser mocks base method.
+func (m *MockBookmarkRepositoryInterface) DeleteBookmarksByUser(userID string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteBookmarksByUser", userID)
+	ret0, _ := ret[0].(int64)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetUserByID indicates an expected call of GetUserByID.
-func (mr *MockUserRepositoryInterfaceMockRecorder) GetUserByID(userID interface{}) *gomock.Call {
+// DeleteBookmarksByUser indicates an expected call of DeleteBookmarksByUser.
+func (mr *MockBookmarkRepositoryInterfaceMockRecorder) DeleteBookmarksByUser(userID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByID", reflect.TypeOf((*MockUserRepositoryInterface)(nil).GetUserByID), userID)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteBookmarksByUser", reflect.TypeOf((*MockBookmarkRepositoryInterface)(nil).DeleteBookmarksByUser), userID)
 }
 
-// GetUserByUsername mocks base method.
-func (m *MockUserRepositoryInterface) GetUserByUsername(username string) (pkg.User, error) {
+// GetBookmarkByID mocks base method.
+func (m *MockBookmarkRepositoryInterface) GetBookmarkByID(id string) (pkg.Bookmark, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUserByUsername", username)
-	ret0, _ := ret[0].(pkg.User)
+	ret := m.ctrl.Call(m, "GetBookmarkByID", id)
+	ret0, _ := ret[0].(pkg.Bookmark)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetUserByUsername indicates an expected call of GetUserByUsername.
-func (mr *MockUserRepositoryInterfaceMockRecorder) GetUserByUsername(username interface{}) *gomock.Call {
+// GetBookmarkByID indicates an expected call of GetBookmarkByID.
+func (mr *MockBookmarkRepositoryInterfaceMockRecorder) GetBookmarkByID(id interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByUsername", reflect.TypeOf((*MockUserRepositoryInterface)(nil).GetUserByUsername), username)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBookmarkByID", reflect.TypeOf((*MockBookmarkRepositoryInterface)(nil).GetBookmarkByID), id)
 }
 
-// GetUsers mocks base method.
-func (m *MockUserRepositoryInterface) GetUsers() ([]pkg.User, error) {
+// GetBookmarkByPost mocks base method.
+func (m *MockBookmarkRepositoryInterface) GetBookmarkByPost(userID, postID string) (pkg.Bookmark, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetUsers")
-	ret0, _ := ret[0].([]pkg.User)
+	ret := m.ctrl.Call(m, "GetBookmarkByPost", userID, postID)
+	ret0, _ := ret[0].(pkg.Bookmark)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
-// GetUsers indicates an expected call of GetUsers.
-func (mr *MockUserRepositoryInterfaceMockRecorder) GetUsers() *gomock.Call {
+// GetBookmarkByPost indicates an expected call of GetBookmarkByPost.
+func (mr *MockBookmarkRepositoryInterfaceMockRecorder) GetBookmarkByPost(userID, postID interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUsers", reflect.TypeOf((*MockUserRepositoryInterface)(nil).GetUsers))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBookmarkByPost", reflect.TypeOf((*MockBookmarkRepositoryInterface)(nil).GetBookmarkByPost), userID, postID)
+}
+
+// GetBookmarks mocks base method.
+func (m *MockBookmarkRepositoryInterface) GetBookmarks(filter pkg.BookmarkFilter) ([]pkg.Bookmark, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBookmarks", filter)
+	ret0, _ := ret[0].([]pkg.Bookmark)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetBookmarks indicates an expected call of GetBookmarks.
+func (mr *MockBookmarkRepositoryInterfaceMockRecorder) GetBookmarks(filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBookmarks", reflect.TypeOf((*MockBookmarkRepositoryInterface)(nil).GetBookmarks), filter)
+}
+
+// MarkBookmarkedPostsDeleted mocks base method.
+func (m *MockBookmarkRepositoryInterface) MarkBookmarkedPostsDeleted(postIDs []string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkBookmarkedPostsDeleted", postIDs)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MarkBookmarkedPostsDeleted indicates an expected call of MarkBookmarkedPostsDeleted.
+func (mr *MockBookmarkRepositoryInterfaceMockRecorder) MarkBookmarkedPostsDeleted(postIDs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkBookmarkedPostsDeleted", reflect.TypeOf((*MockBookmarkRepositoryInterface)(nil).MarkBookmarkedPostsDeleted), postIDs)
+}
+
+// UpdateBookmark mocks base method.
+func (m *MockBookmarkRepositoryInterface) UpdateBookmark(id primitive.ObjectID, updateFields bson.M) (pkg.Bookmark, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateBookmark", id, updateFields)
+	ret0, _ := ret[0].(pkg.Bookmark)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateBookmark indicates an expected call of UpdateBookmark.
+func (mr *MockBookmarkRepositoryInterfaceMockRecorder) UpdateBookmark(id, updateFields interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateBookmark", reflect.TypeOf((*MockBookmarkRepositoryInterface)(nil).UpdateBookmark), id, updateFields)
+}
+
+// MockReadingListRepositoryInterface is a mock of ReadingListRepositoryInterface interface.
+type MockReadingListRepositoryInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockReadingListRepositoryInterfaceMockRecorder
+}
+
+// MockReadingListRepositoryInterfaceMockRecorder is the mock recorder for MockReadingListRepositoryInterface.
+type MockReadingListRepositoryInterfaceMockRecorder struct {
+	mock *MockReadingListRepositoryInterface
+}
+
+// NewMockReadingListRepositoryInterface creates a new mock instance.
+func NewMockReadingListRepositoryInterface(ctrl *gomock.Controller) *MockReadingListRepositoryInterface {
+	mock := &MockReadingListRepositoryInterface{ctrl: ctrl}
+	mock.recorder = &MockReadingListRepositoryInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockReadingListRepositoryInterface) EXPECT() *MockReadingListRepositoryInterfaceMockRecorder {
+	return m.recorder
+}
+
+// CountReadingLists mocks base method.
+func (m *MockReadingListRepositoryInterface) CountReadingLists(ownerID string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountReadingLists", ownerID)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountReadingLists indicates an expected call of CountReadingLists.
+func (mr *MockReadingListRepositoryInterfaceMockRecorder) CountReadingLists(ownerID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountReadingLists", reflect.TypeOf((*MockReadingListRepositoryInterface)(nil).CountReadingLists), ownerID)
+}
+
+// CreateReadingList mocks base method.
+func (m *MockReadingListRepositoryInterface) CreateReadingList(list pkg.ReadingList) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateReadingList", list)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateReadingList indicates an expected call of CreateReadingList.
+func (mr *MockReadingListRepositoryInterfaceMockRecorder) CreateReadingList(list interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateReadingList", reflect.TypeOf((*MockReadingListRepositoryInterface)(nil).CreateReadingList), list)
+}
+
+// DeleteReadingList mocks base method.
+func (m *MockReadingListRepositoryInterface) DeleteReadingList(id primitive.ObjectID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteReadingList", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteReadingList indicates an expected call of DeleteReadingList.
+func (mr *MockReadingListRepositoryInterfaceMockRecorder) DeleteReadingList(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteReadingList", reflect.TypeOf((*MockReadingListRepositoryInterface)(nil).DeleteReadingList), id)
+}
+
+// DeleteReadingListsByOwner mocks base method.
+func (m *MockReadingListRepositoryInterface) DeleteReadingListsByOwner(ownerID string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteReadingListsByOwner", ownerID)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteReadingListsByOwner indicates an expected call of DeleteReadingListsByOwner.
+func (mr *MockReadingListRepositoryInterfaceMockRecorder) DeleteReadingListsByOwner(ownerID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteReadingListsByOwner", reflect.TypeOf((*MockReadingListRepositoryInterface)(nil).DeleteReadingListsByOwner), ownerID)
+}
+
+// GetReadingListByID mocks base method.
+func (m *MockReadingListRepositoryInterface) GetReadingListByID(id string) (pkg.ReadingList, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetReadingListByID", id)
+	ret0, _ := ret[0].(pkg.ReadingList)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetReadingListByID indicates an expected call of GetReadingListByID.
+func (mr *MockReadingListRepositoryInterfaceMockRecorder) GetReadingListByID(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetReadingListByID", reflect.TypeOf((*MockReadingListRepositoryInterface)(nil).GetReadingListByID), id)
+}
+
+// GetReadingListByToken mocks base method.
+func (m *MockReadingListRepositoryInterface) GetReadingListByToken(token string) (pkg.ReadingList, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetReadingListByToken", token)
+	ret0, _ := ret[0].(pkg.ReadingList)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetReadingListByToken indicates an expected call of GetReadingListByToken.
+func (mr *MockReadingListRepositoryInterfaceMockRecorder) GetReadingListByToken(token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetReadingListByToken", reflect.TypeOf((*MockReadingListRepositoryInterface)(nil).GetReadingListByToken), token)
+}
+
+// GetReadingLists mocks base method.
+func (m *MockReadingListRepositoryInterface) GetReadingLists(ownerID string) ([]pkg.ReadingList, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetReadingLists", ownerID)
+	ret0, _ := ret[0].([]pkg.ReadingList)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetReadingLists indicates an expected call of GetReadingLists.
+func (mr *MockReadingListRepositoryInterfaceMockRecorder) GetReadingLists(ownerID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetReadingLists", reflect.TypeOf((*MockReadingListRepositoryInterface)(nil).GetReadingLists), ownerID)
+}
+
+// UpdateReadingList mocks base method.
+func (m *MockReadingListRepositoryInterface) UpdateReadingList(id primitive.ObjectID, updateFields bson.M) (pkg.ReadingList, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateReadingList", id, updateFields)
+	ret0, _ := ret[0].(pkg.ReadingList)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateReadingList indicates an expected call of UpdateReadingList.
+func (mr *MockReadingListRepositoryInterfaceMockRecorder) UpdateReadingList(id, updateFields interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateReadingList", reflect.TypeOf((*MockReadingListRepositoryInterface)(nil).UpdateReadingList), id, updateFields)
+}
+
+// MockFollowRepositoryInterface is a mock of FollowRepositoryInterface interface.
+type MockFollowRepositoryInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockFollowRepositoryInterfaceMockRecorder
+}
+
+// MockFollowRepositoryInterfaceMockRecorder is the mock recorder for MockFollowRepositoryInterface.
+type MockFollowRepositoryInterfaceMockRecorder struct {
+	mock *MockFollowRepositoryInterface
+}
+
+// NewMockFollowRepositoryInterface creates a new mock instance.
+func NewMockFollowRepositoryInterface(ctrl *gomock.Controller) *MockFollowRepositoryInterface {
+	mock := &MockFollowRepositoryInterface{ctrl: ctrl}
+	mock.recorder = &MockFollowRepositoryInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockFollowRepositoryInterface) EXPECT() *MockFollowRepositoryInterfaceMockRecorder {
+	return m.recorder
+}
+
+// CountFollowers mocks base method.
+func (m *MockFollowRepositoryInterface) CountFollowers(kind string, targets []string) (map[string]int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountFollowers", kind, targets)
+	ret0, _ := ret[0].(map[string]int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountFollowers indicates an expected call of CountFollowers.
+func (mr *MockFollowRepositoryInterfaceMockRecorder) CountFollowers(kind, targets interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountFollowers", reflect.TypeOf((*MockFollowRepositoryInterface)(nil).CountFollowers), kind, targets)
+}
+
+// DeleteFollowsByFollower mocks base method.
+func (m *MockFollowRepositoryInterface) DeleteFollowsByFollower(followerID string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteFollowsByFollower", followerID)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteFollowsByFollower indicates an expected call of DeleteFollowsByFollower.
+func (mr *MockFollowRepositoryInterfaceMockRecorder) DeleteFollowsByFollower(followerID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteFollowsByFollower", reflect.TypeOf((*MockFollowRepositoryInterface)(nil).DeleteFollowsByFollower), followerID)
+}
+
+// DeleteFollowsByTarget mocks base method.
+func (m *MockFollowRepositoryInterface) DeleteFollowsByTarget(kind, target string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteFollowsByTarget", kind, target)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteFollowsByTarget indicates an expected call of DeleteFollowsByTarget.
+func (mr *MockFollowRepositoryInterfaceMockRecorder) DeleteFollowsByTarget(kind, target interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteFollowsByTarget", reflect.TypeOf((*MockFollowRepositoryInterface)(nil).DeleteFollowsByTarget), kind, target)
+}
+
+// Follow mocks base method.
+func (m *MockFollowRepositoryInterface) Follow(follow pkg.Follow) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Follow", follow)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Follow indicates an expected call of Follow.
+func (mr *MockFollowRepositoryInterfaceMockRecorder) Follow(follow interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Follow", reflect.TypeOf((*MockFollowRepositoryInterface)(nil).Follow), follow)
+}
+
+// GetFollows mocks base method.
+func (m *MockFollowRepositoryInterface) GetFollows(followerID string) ([]pkg.Follow, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetFollows", followerID)
+	ret0, _ := ret[0].([]pkg.Follow)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetFollows indicates an expected call of GetFollows.
+func (mr *MockFollowRepositoryInterfaceMockRecorder) GetFollows(followerID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFollows", reflect.TypeOf((*MockFollowRepositoryInterface)(nil).GetFollows), followerID)
+}
+
+// RenameFollowTarget mocks base method.
+func (m *MockFollowRepositoryInterface) RenameFollowTarget(kind, from, to string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RenameFollowTarget", kind, from, to)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RenameFollowTarget indicates an expected call of RenameFollowTarget.
+func (mr *MockFollowRepositoryInterfaceMockRecorder) RenameFollowTarget(kind, from, to interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RenameFollowTarget", reflect.TypeOf((*MockFollowRepositoryInterface)(nil).RenameFollowTarget), kind, from, to)
+}
+
+// Unfollow mocks base method.
+func (m *MockFollowRepositoryInterface) Unfollow(followerID, kind, target string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Unfollow", followerID, kind, target)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Unfollow indicates an expected call of Unfollow.
+func (mr *MockFollowRepositoryInterfaceMockRecorder) Unfollow(followerID, kind, target interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unfollow", reflect.TypeOf((*MockFollowRepositoryInterface)(nil).Unfollow), followerID, kind, target)
+}
+
+// MockNotificationRepositoryInterface is a mock of NotificationRepositoryInterface interface.
+type MockNotificationRepositoryInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockNotificationRepositoryInterfaceMockRecorder
+}
+
+// MockNotificationRepositoryInterfaceMockRecorder is the mock recorder for MockNotificationRepositoryInterface.
+type MockNotificationRepositoryInterfaceMockRecorder struct {
+	mock *MockNotificationRepositoryInterface
+}
+
+// NewMockNotificationRepositoryInterface creates a new mock instance.
+func NewMockNotificationRepositoryInterface(ctrl *gomock.Controller) *MockNotificationRepositoryInterface {
+	mock := &MockNotificationRepositoryInterface{ctrl: ctrl}
+	mock.recorder = &MockNotificationRepositoryInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockNotificationRepositoryInterface) EXPECT() *MockNotificationRepositoryInterfaceMockRecorder {
+	return m.recorder
+}
+
+// AddNotification mocks base method.
+func (m *MockNotificationRepositoryInterface) AddNotification(notification pkg.Notification) (pkg.Notification, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddNotification", notification)
+	ret0, _ := ret[0].(pkg.Notification)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddNotification indicates an expected call of AddNotification.
+func (mr *MockNotificationRepositoryInterfaceMockRecorder) AddNotification(notification interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddNotification", reflect.TypeOf((*MockNotificationRepositoryInterface)(nil).AddNotification), notification)
+}
+
+// CountUnreadNotifications mocks base method.
+func (m *MockNotificationRepositoryInterface) CountUnreadNotifications(userID string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountUnreadNotifications", userID)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountUnreadNotifications indicates an expected call of CountUnreadNotifications.
+func (mr *MockNotificationRepositoryInterfaceMockRecorder) CountUnreadNotifications(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountUnreadNotifications", reflect.TypeOf((*MockNotificationRepositoryInterface)(nil).CountUnreadNotifications), userID)
+}
+
+// DeleteNotificationsByUser mocks base method.
+func (m *MockNotificationRepositoryInterface) DeleteNotificationsByUser(userID string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteNotificationsByUser", userID)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteNotificationsByUser indicates an expected call of DeleteNotificationsByUser.
+func (mr *MockNotificationRepositoryInterfaceMockRecorder) DeleteNotificationsByUser(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteNotificationsByUser", reflect.TypeOf((*MockNotificationRepositoryInterface)(nil).DeleteNotificationsByUser), userID)
+}
+
+// GetNotifications mocks base method.
+func (m *MockNotificationRepositoryInterface) GetNotifications(filter pkg.NotificationFilter) ([]pkg.Notification, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetNotifications", filter)
+	ret0, _ := ret[0].([]pkg.Notification)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetNotifications indicates an expected call of GetNotifications.
+func (mr *MockNotificationRepositoryInterfaceMockRecorder) GetNotifications(filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetNotifications", reflect.TypeOf((*MockNotificationRepositoryInterface)(nil).GetNotifications), filter)
+}
+
+// MarkAllNotificationsRead mocks base method.
+func (m *MockNotificationRepositoryInterface) MarkAllNotificationsRead(userID string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkAllNotificationsRead", userID)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MarkAllNotificationsRead indicates an expected call of MarkAllNotificationsRead.
+func (mr *MockNotificationRepositoryInterfaceMockRecorder) MarkAllNotificationsRead(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkAllNotificationsRead", reflect.TypeOf((*MockNotificationRepositoryInterface)(nil).MarkAllNotificationsRead), userID)
+}
+
+// MarkNotificationRead mocks base method.
+func (m *MockNotificationRepositoryInterface) MarkNotificationRead(userID, id string) (pkg.Notification, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MarkNotificationRead", userID, id)
+	ret0, _ := ret[0].(pkg.Notification)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MarkNotificationRead indicates an expected call of MarkNotificationRead.
+func (mr *MockNotificationRepositoryInterfaceMockRecorder) MarkNotificationRead(userID, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MarkNotificationRead", reflect.TypeOf((*MockNotificationRepositoryInterface)(nil).MarkNotificationRead), userID, id)
+}
+
+// RenameNotificationActor mocks base method.
+func (m *MockNotificationRepositoryInterface) RenameNotificationActor(actorID, from, to string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RenameNotificationActor", actorID, from, to)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RenameNotificationActor indicates an expected call of RenameNotificationActor.
+func (mr *MockNotificationRepositoryInterfaceMockRecorder) RenameNotificationActor(actorID, from, to interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RenameNotificationActor", reflect.TypeOf((*MockNotificationRepositoryInterface)(nil).RenameNotificationActor), actorID, from, to)
+}
+
+// MockUserRepositoryInterface is a mock of UserRepositoryInterface interface.
+type MockUserRepositoryInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockUserRepositoryInterfaceMockRecorder
+}
+
+// MockUserRepositoryInterfaceMockRecorder is the mock recorder for MockUserRepositoryInterface.
+type MockUserRepositoryInterfaceMockRecorder struct {
+	mock *MockUserRepositoryInterface
+}
+
+// NewMockUserRepositoryInterface creates a new mock instance.
+func NewMockUserRepositoryInterface(ctrl *gomock.Controller) *MockUserRepositoryInterface {
+	mock := &MockUserRepositoryInterface{ctrl: ctrl}
+	mock.recorder = &MockUserRepositoryInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockUserRepositoryInterface) EXPECT() *MockUserRepositoryInterfaceMockRecorder {
+	return m.recorder
+}
+
+// CreateUser mocks base method.
+func (m *MockUserRepositoryInterface) CreateUser(user pkg.User) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateUser", user)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateUser indicates an expected call of CreateUser.
+func (mr *MockUserRepositoryInterfaceMockRecorder) CreateUser(user interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUser", reflect.TypeOf((*MockUserRepositoryInterface)(nil).CreateUser), user)
+}
+
+// DeleteUser mocks base method.
+func (m *MockUserRepositoryInterface) DeleteUser(id primitive.ObjectID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUser", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteUser indicates an expected call of DeleteUser.
+func (mr *MockUserRepositoryInterfaceMockRecorder) DeleteUser(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUser", reflect.TypeOf((*MockUserRepositoryInterface)(nil).DeleteUser), id)
+}
+
+// GetUserByEmail mocks base method.
+func (m *MockUserRepositoryInterface) GetUserByEmail(email string) (pkg.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByEmail", email)
+	ret0, _ := ret[0].(pkg.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByEmail indicates an expected call of GetUserByEmail.
+func (mr *MockUserRepositoryInterfaceMockRecorder) GetUserByEmail(email interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByEmail", reflect.TypeOf((*MockUserRepositoryInterface)(nil).GetUserByEmail), email)
+}
+
+// GetUserByID mocks base method.
+func (m *MockUserRepositoryInterface) GetUserByID(userID string) (pkg.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByID", userID)
+	ret0, _ := ret[0].(pkg.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByID indicates an expected call of GetUserByID.
+func (mr *MockUserRepositoryInterfaceMockRecorder) GetUserByID(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByID", reflect.TypeOf((*MockUserRepositoryInterface)(nil).GetUserByID), userID)
+}
+
+// GetUserByIdentity mocks base method.
+func (m *MockUserRepositoryInterface) GetUserByIdentity(provider, subject string) (pkg.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByIdentity", provider, subject)
+	ret0, _ := ret[0].(pkg.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByIdentity indicates an expected call of GetUserByIdentity.
+func (mr *MockUserRepositoryInterfaceMockRecorder) GetUserByIdentity(provider, subject interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByIdentity", reflect.TypeOf((*MockUserRepositoryInterface)(nil).GetUserByIdentity), provider, subject)
+}
+
+// GetUserByUsername mocks base method.
+func (m *MockUserRepositoryInterface) GetUserByUsername(username string) (pkg.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByUsername", username)
+	ret0, _ := ret[0].(pkg.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByUsername indicates an expected call of GetUserByUsername.
+func (mr *MockUserRepositoryInterfaceMockRecorder) GetUserByUsername(username interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByUsername", reflect.TypeOf((*MockUserRepositoryInterface)(nil).GetUserByUsername), username)
+}
+
+// GetUsers mocks base method.
+func (m *MockUserRepositoryInterface) GetUsers() ([]pkg.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUsers")
+	ret0, _ := ret[0].([]pkg.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUsers indicates an expected call of GetUsers.
+func (mr *MockUserRepositoryInterfaceMockRecorder) GetUsers() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUsers", reflect.TypeOf((*MockUserRepositoryInterface)(nil).GetUsers))
+}
+
+// SearchUsers mocks base method.
+func (m *MockUserRepositoryInterface) SearchUsers(filter pkg.UserFilter) ([]pkg.User, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SearchUsers", filter)
+	ret0, _ := ret[0].([]pkg.User)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// SearchUsers indicates an expected call of SearchUsers.
+func (mr *MockUserRepositoryInterfaceMockRecorder) SearchUsers(filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchUsers", reflect.TypeOf((*MockUserRepositoryInterface)(nil).SearchUsers), filter)
+}
+
+// UpdateUser mocks base method.
+func (m *MockUserRepositoryInterface) UpdateUser(id primitive.ObjectID, updateFields bson.M) (pkg.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateUser", id, updateFields)
+	ret0, _ := ret[0].(pkg.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateUser indicates an expected call of UpdateUser.
+func (mr *MockUserRepositoryInterfaceMockRecorder) UpdateUser(id, updateFields interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateUser", reflect.TypeOf((*MockUserRepositoryInterface)(nil).UpdateUser), id, updateFields)
+}
+
+// UseRecoveryCode mocks base method.
+func (m *MockUserRepositoryInterface) UseRecoveryCode(id primitive.ObjectID, hash string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseRecoveryCode", id, hash)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseRecoveryCode indicates an expected call of UseRecoveryCode.
+func (mr *MockUserRepositoryInterfaceMockRecorder) UseRecoveryCode(id, hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseRecoveryCode", reflect.TypeOf((*MockUserRepositoryInterface)(nil).UseRecoveryCode), id, hash)
+}
+
+// UseTOTPStep mocks base method.
+func (m *MockUserRepositoryInterface) UseTOTPStep(id primitive.ObjectID, step int64) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UseTOTPStep", id, step)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UseTOTPStep indicates an expected call of UseTOTPStep.
+func (mr *MockUserRepositoryInterfaceMockRecorder) UseTOTPStep(id, step interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UseTOTPStep", reflect.TypeOf((*MockUserRepositoryInterface)(nil).UseTOTPStep), id, step)
+}
+
+// MockLoginAttemptRepositoryInterface is a mock of LoginAttemptRepositoryInterface interface.
+type MockLoginAttemptRepositoryInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockLoginAttemptRepositoryInterfaceMockRecorder
+}
+
+// MockLoginAttemptRepositoryInterfaceMockRecorder is the mock recorder for MockLoginAttemptRepositoryInterface.
+type MockLoginAttemptRepositoryInterfaceMockRecorder struct {
+	mock *MockLoginAttemptRepositoryInterface
+}
+
+// NewMockLoginAttemptRepositoryInterface creates a new mock instance.
+func NewMockLoginAttemptRepositoryInterface(ctrl *gomock.Controller) *MockLoginAttemptRepositoryInterface {
+	mock := &MockLoginAttemptRepositoryInterface{ctrl: ctrl}
+	mock.recorder = &MockLoginAttemptRepositoryInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockLoginAttemptRepositoryInterface) EXPECT() *MockLoginAttemptRepositoryInterfaceMockRecorder {
+	return m.recorder
+}
+
+// AddLoginFailure mocks base method.
+func (m *MockLoginAttemptRepositoryInterface) AddLoginFailure(key string, threshold int, policy config.LockoutConfig, now time.Time) (pkg.LoginAttempt, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddLoginFailure", key, threshold, policy, now)
+	ret0, _ := ret[0].(pkg.LoginAttempt)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddLoginFailure indicates an expected call of AddLoginFailure.
+func (mr *MockLoginAttemptRepositoryInterfaceMockRecorder) AddLoginFailure(key, threshold, policy, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddLoginFailure", reflect.TypeOf((*MockLoginAttemptRepositoryInterface)(nil).AddLoginFailure), key, threshold, policy, now)
+}
+
+// DeleteLoginAttempt mocks base method.
+func (m *MockLoginAttemptRepositoryInterface) DeleteLoginAttempt(key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteLoginAttempt", key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteLoginAttempt indicates an expected call of DeleteLoginAttempt.
+func (mr *MockLoginAttemptRepositoryInterfaceMockRecorder) DeleteLoginAttempt(key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteLoginAttempt", reflect.TypeOf((*MockLoginAttemptRepositoryInterface)(nil).DeleteLoginAttempt), key)
+}
+
+// GetLockedLoginAttempts mocks base method.
+func (m *MockLoginAttemptRepositoryInterface) GetLockedLoginAttempts(now time.Time) ([]pkg.LoginAttempt, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLockedLoginAttempts", now)
+	ret0, _ := ret[0].([]pkg.LoginAttempt)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLockedLoginAttempts indicates an expected call of GetLockedLoginAttempts.
+func (mr *MockLoginAttemptRepositoryInterfaceMockRecorder) GetLockedLoginAttempts(now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLockedLoginAttempts", reflect.TypeOf((*MockLoginAttemptRepositoryInterface)(nil).GetLockedLoginAttempts), now)
+}
+
+// GetLoginAttempt mocks base method.
+func (m *MockLoginAttemptRepositoryInterface) GetLoginAttempt(key string) (pkg.LoginAttempt, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLoginAttempt", key)
+	ret0, _ := ret[0].(pkg.LoginAttempt)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLoginAttempt indicates an expected call of GetLoginAttempt.
+func (mr *MockLoginAttemptRepositoryInterfaceMockRecorder) GetLoginAttempt(key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLoginAttempt", reflect.TypeOf((*MockLoginAttemptRepositoryInterface)(nil).GetLoginAttempt), key)
+}
+
+// MockTokenRepositoryInterface is a mock of TokenRepositoryInterface interface.
+type MockTokenRepositoryInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockTokenRepositoryInterfaceMockRecorder
+}
+
+// MockTokenRepositoryInterfaceMockRecorder is the mock recorder for MockTokenRepositoryInterface.
+type MockTokenRepositoryInterfaceMockRecorder struct {
+	mock *MockTokenRepositoryInterface
+}
+
+// NewMockTokenRepositoryInterface creates a new mock instance.
+func NewMockTokenRepositoryInterface(ctrl *gomock.Controller) *MockTokenRepositoryInterface {
+	mock := &MockTokenRepositoryInterface{ctrl: ctrl}
+	mock.recorder = &MockTokenRepositoryInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTokenRepositoryInterface) EXPECT() *MockTokenRepositoryInterfaceMockRecorder {
+	return m.recorder
+}
+
+// ConsumeToken mocks base method.
+func (m *MockTokenRepositoryInterface) ConsumeToken(purpose, hash string, now time.Time) (pkg.OneTimeToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ConsumeToken", purpose, hash, now)
+	ret0, _ := ret[0].(pkg.OneTimeToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ConsumeToken indicates an expected call of ConsumeToken.
+func (mr *MockTokenRepositoryInterfaceMockRecorder) ConsumeToken(purpose, hash, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ConsumeToken", reflect.TypeOf((*MockTokenRepositoryInterface)(nil).ConsumeToken), purpose, hash, now)
+}
+
+// CreateToken mocks base method.
+func (m *MockTokenRepositoryInterface) CreateToken(token pkg.OneTimeToken) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateToken", token)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateToken indicates an expected call of CreateToken.
+func (mr *MockTokenRepositoryInterfaceMockRecorder) CreateToken(token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateToken", reflect.TypeOf((*MockTokenRepositoryInterface)(nil).CreateToken), token)
+}
+
+// DeleteUserTokens mocks base method.
+func (m *MockTokenRepositoryInterface) DeleteUserTokens(userID, purpose string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUserTokens", userID, purpose)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteUserTokens indicates an expected call of DeleteUserTokens.
+func (mr *MockTokenRepositoryInterfaceMockRecorder) DeleteUserTokens(userID, purpose interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUserTokens", reflect.TypeOf((*MockTokenRepositoryInterface)(nil).DeleteUserTokens), userID, purpose)
+}
+
+// MockSessionRepositoryInterface is a mock of SessionRepositoryInterface interface.
+type MockSessionRepositoryInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockSessionRepositoryInterfaceMockRecorder
+}
+
+// MockSessionRepositoryInterfaceMockRecorder is the mock recorder for MockSessionRepositoryInterface.
+type MockSessionRepositoryInterfaceMockRecorder struct {
+	mock *MockSessionRepositoryInterface
+}
+
+// NewMockSessionRepositoryInterface creates a new mock instance.
+func NewMockSessionRepositoryInterface(ctrl *gomock.Controller) *MockSessionRepositoryInterface {
+	mock := &MockSessionRepositoryInterface{ctrl: ctrl}
+	mock.recorder = &MockSessionRepositoryInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSessionRepositoryInterface) EXPECT() *MockSessionRepositoryInterfaceMockRecorder {
+	return m.recorder
+}
+
+// CreateSession mocks base method.
+func (m *MockSessionRepositoryInterface) CreateSession(session pkg.Session) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateSession", session)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateSession indicates an expected call of CreateSession.
+func (mr *MockSessionRepositoryInterfaceMockRecorder) CreateSession(session interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateSession", reflect.TypeOf((*MockSessionRepositoryInterface)(nil).CreateSession), session)
+}
+
+// GetSessionByID mocks base method.
+func (m *MockSessionRepositoryInterface) GetSessionByID(sessionID string) (pkg.Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSessionByID", sessionID)
+	ret0, _ := ret[0].(pkg.Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSessionByID indicates an expected call of GetSessionByID.
+func (mr *MockSessionRepositoryInterfaceMockRecorder) GetSessionByID(sessionID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSessionByID", reflect.TypeOf((*MockSessionRepositoryInterface)(nil).GetSessionByID), sessionID)
+}
+
+// GetUserSessions mocks base method.
+func (m *MockSessionRepositoryInterface) GetUserSessions(userID string) ([]pkg.Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserSessions", userID)
+	ret0, _ := ret[0].([]pkg.Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserSessions indicates an expected call of GetUserSessions.
+func (mr *MockSessionRepositoryInterfaceMockRecorder) GetUserSessions(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserSessions", reflect.TypeOf((*MockSessionRepositoryInterface)(nil).GetUserSessions), userID)
+}
+
+// RevokeSession mocks base method.
+func (m *MockSessionRepositoryInterface) RevokeSession(sessionID string, now time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeSession", sessionID, now)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeSession indicates an expected call of RevokeSession.
+func (mr *MockSessionRepositoryInterfaceMockRecorder) RevokeSession(sessionID, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeSession", reflect.TypeOf((*MockSessionRepositoryInterface)(nil).RevokeSession), sessionID, now)
+}
+
+// RevokeUserSessions mocks base method.
+func (m *MockSessionRepositoryInterface) RevokeUserSessions(userID string, now time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RevokeUserSessions", userID, now)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RevokeUserSessions indicates an expected call of RevokeUserSessions.
+func (mr *MockSessionRepositoryInterfaceMockRecorder) RevokeUserSessions(userID, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RevokeUserSessions", reflect.TypeOf((*MockSessionRepositoryInterface)(nil).RevokeUserSessions), userID, now)
+}
+
+// MockAccessTokenRepositoryInterface is a mock of AccessTokenRepositoryInterface interface.
+type MockAccessTokenRepositoryInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockAccessTokenRepositoryInterfaceMockRecorder
+}
+
+// MockAccessTokenRepositoryInterfaceMockRecorder is the mock recorder for MockAccessTokenRepositoryInterface.
+type MockAccessTokenRepositoryInterfaceMockRecorder struct {
+	mock *MockAccessTokenRepositoryInterface
+}
+
+// NewMockAccessTokenRepositoryInterface creates a new mock instance.
+func NewMockAccessTokenRepositoryInterface(ctrl *gomock.Controller) *MockAccessTokenRepositoryInterface {
+	mock := &MockAccessTokenRepositoryInterface{ctrl: ctrl}
+	mock.recorder = &MockAccessTokenRepositoryInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAccessTokenRepositoryInterface) EXPECT() *MockAccessTokenRepositoryInterfaceMockRecorder {
+	return m.recorder
+}
+
+// CreateAccessToken mocks base method.
+func (m *MockAccessTokenRepositoryInterface) CreateAccessToken(token pkg.AccessToken) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateAccessToken", token)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateAccessToken indicates an expected call of CreateAccessToken.
+func (mr *MockAccessTokenRepositoryInterfaceMockRecorder) CreateAccessToken(token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateAccessToken", reflect.TypeOf((*MockAccessTokenRepositoryInterface)(nil).CreateAccessToken), token)
+}
+
+// DeleteAccessToken mocks base method.
+func (m *MockAccessTokenRepositoryInterface) DeleteAccessToken(userID, tokenID string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteAccessToken", userID, tokenID)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteAccessToken indicates an expected call of DeleteAccessToken.
+func (mr *MockAccessTokenRepositoryInterfaceMockRecorder) DeleteAccessToken(userID, tokenID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteAccessToken", reflect.TypeOf((*MockAccessTokenRepositoryInterface)(nil).DeleteAccessToken), userID, tokenID)
+}
+
+// GetAccessTokenByHash mocks base method.
+func (m *MockAccessTokenRepositoryInterface) GetAccessTokenByHash(hash string) (pkg.AccessToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAccessTokenByHash", hash)
+	ret0, _ := ret[0].(pkg.AccessToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAccessTokenByHash indicates an expected call of GetAccessTokenByHash.
+func (mr *MockAccessTokenRepositoryInterfaceMockRecorder) GetAccessTokenByHash(hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAccessTokenByHash", reflect.TypeOf((*MockAccessTokenRepositoryInterface)(nil).GetAccessTokenByHash), hash)
+}
+
+// GetUserAccessTokens mocks base method.
+func (m *MockAccessTokenRepositoryInterface) GetUserAccessTokens(userID string) ([]pkg.AccessToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserAccessTokens", userID)
+	ret0, _ := ret[0].([]pkg.AccessToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserAccessTokens indicates an expected call of GetUserAccessTokens.
+func (mr *MockAccessTokenRepositoryInterfaceMockRecorder) GetUserAccessTokens(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserAccessTokens", reflect.TypeOf((*MockAccessTokenRepositoryInterface)(nil).GetUserAccessTokens), userID)
+}
+
+// TouchAccessToken mocks base method.
+func (m *MockAccessTokenRepositoryInterface) TouchAccessToken(tokenID primitive.ObjectID, now time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TouchAccessToken", tokenID, now)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TouchAccessToken indicates an expected call of TouchAccessToken.
+func (mr *MockAccessTokenRepositoryInterfaceMockRecorder) TouchAccessToken(tokenID, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TouchAccessToken", reflect.TypeOf((*MockAccessTokenRepositoryInterface)(nil).TouchAccessToken), tokenID, now)
+}
+
+// MockSettingsRepositoryInterface is a mock of SettingsRepositoryInterface interface.
+type MockSettingsRepositoryInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockSettingsRepositoryInterfaceMockRecorder
+}
+
+// MockSettingsRepositoryInterfaceMockRecorder is the mock recorder for MockSettingsRepositoryInterface.
+type MockSettingsRepositoryInterfaceMockRecorder struct {
+	mock *MockSettingsRepositoryInterface
+}
+
+// NewMockSettingsRepositoryInterface creates a new mock instance.
+func NewMockSettingsRepositoryInterface(ctrl *gomock.Controller) *MockSettingsRepositoryInterface {
+	mock := &MockSettingsRepositoryInterface{ctrl: ctrl}
+	mock.recorder = &MockSettingsRepositoryInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockSettingsRepositoryInterface) EXPECT() *MockSettingsRepositoryInterfaceMockRecorder {
+	return m.recorder
+}
+
+// GetSetting mocks base method.
+func (m *MockSettingsRepositoryInterface) GetSetting(key string, out interface{}) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSetting", key, out)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// GetSetting indicates an expected call of GetSetting.
+func (mr *MockSettingsRepositoryInterfaceMockRecorder) GetSetting(key, out interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSetting", reflect.TypeOf((*MockSettingsRepositoryInterface)(nil).GetSetting), key, out)
+}
+
+// SaveSetting mocks base method.
+func (m *MockSettingsRepositoryInterface) SaveSetting(key string, value interface{}) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveSetting", key, value)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveSetting indicates an expected call of SaveSetting.
+func (mr *MockSettingsRepositoryInterfaceMockRecorder) SaveSetting(key, value interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveSetting", reflect.TypeOf((*MockSettingsRepositoryInterface)(nil).SaveSetting), key, value)
+}
+
+// MockExportRepositoryInterface is a mock of ExportRepositoryInterface interface.
+type MockExportRepositoryInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockExportRepositoryInterfaceMockRecorder
+}
+
+// MockExportRepositoryInterfaceMockRecorder is the mock recorder for MockExportRepositoryInterface.
+type MockExportRepositoryInterfaceMockRecorder struct {
+	mock *MockExportRepositoryInterface
+}
+
+// NewMockExportRepositoryInterface creates a new mock instance.
+func NewMockExportRepositoryInterface(ctrl *gomock.Controller) *MockExportRepositoryInterface {
+	mock := &MockExportRepositoryInterface{ctrl: ctrl}
+	mock.recorder = &MockExportRepositoryInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockExportRepositoryInterface) EXPECT() *MockExportRepositoryInterfaceMockRecorder {
+	return m.recorder
+}
+
+// CreateExport mocks base method.
+func (m *MockExportRepositoryInterface) CreateExport(export pkg.DataExport) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateExport", export)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateExport indicates an expected call of CreateExport.
+func (mr *MockExportRepositoryInterfaceMockRecorder) CreateExport(export interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateExport", reflect.TypeOf((*MockExportRepositoryInterface)(nil).CreateExport), export)
+}
+
+// DeleteExport mocks base method.
+func (m *MockExportRepositoryInterface) DeleteExport(id primitive.ObjectID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteExport", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteExport indicates an expected call of DeleteExport.
+func (mr *MockExportRepositoryInterfaceMockRecorder) DeleteExport(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteExport", reflect.TypeOf((*MockExportRepositoryInterface)(nil).DeleteExport), id)
+}
+
+// GetExpiredExports mocks base method.
+func (m *MockExportRepositoryInterface) GetExpiredExports(now time.Time) ([]pkg.DataExport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetExpiredExports", now)
+	ret0, _ := ret[0].([]pkg.DataExport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetExpiredExports indicates an expected call of GetExpiredExports.
+func (mr *MockExportRepositoryInterfaceMockRecorder) GetExpiredExports(now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetExpiredExports", reflect.TypeOf((*MockExportRepositoryInterface)(nil).GetExpiredExports), now)
+}
+
+// GetExportByTokenHash mocks base method.
+func (m *MockExportRepositoryInterface) GetExportByTokenHash(hash string) (pkg.DataExport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetExportByTokenHash", hash)
+	ret0, _ := ret[0].(pkg.DataExport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetExportByTokenHash indicates an expected call of GetExportByTokenHash.
+func (mr *MockExportRepositoryInterfaceMockRecorder) GetExportByTokenHash(hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetExportByTokenHash", reflect.TypeOf((*MockExportRepositoryInterface)(nil).GetExportByTokenHash), hash)
+}
+
+// GetUserExports mocks base method.
+func (m *MockExportRepositoryInterface) GetUserExports(userID string) ([]pkg.DataExport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserExports", userID)
+	ret0, _ := ret[0].([]pkg.DataExport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserExports indicates an expected call of GetUserExports.
+func (mr *MockExportRepositoryInterfaceMockRecorder) GetUserExports(userID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserExports", reflect.TypeOf((*MockExportRepositoryInterface)(nil).GetUserExports), userID)
+}
+
+// UpdateExport mocks base method.
+func (m *MockExportRepositoryInterface) UpdateExport(id primitive.ObjectID, updateFields bson.M) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateExport", id, updateFields)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateExport indicates an expected call of UpdateExport.
+func (mr *MockExportRepositoryInterfaceMockRecorder) UpdateExport(id, updateFields interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateExport", reflect.TypeOf((*MockExportRepositoryInterface)(nil).UpdateExport), id, updateFields)
+}
+
+// MockAuditRepositoryInterface is a mock of AuditRepositoryInterface interface.
+type MockAuditRepositoryInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockAuditRepositoryInterfaceMockRecorder
+}
+
+// MockAuditRepositoryInterfaceMockRecorder is the mock recorder for MockAuditRepositoryInterface.
+type MockAuditRepositoryInterfaceMockRecorder struct {
+	mock *MockAuditRepositoryInterface
+}
+
+// NewMockAuditRepositoryInterface creates a new mock instance.
+func NewMockAuditRepositoryInterface(ctrl *gomock.Controller) *MockAuditRepositoryInterface {
+	mock := &MockAuditRepositoryInterface{ctrl: ctrl}
+	mock.recorder = &MockAuditRepositoryInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAuditRepositoryInterface) EXPECT() *MockAuditRepositoryInterfaceMockRecorder {
+	return m.recorder
+}
+
+// AppendAuditEvent mocks base method.
+func (m *MockAuditRepositoryInterface) AppendAuditEvent(event pkg.AuditEvent) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AppendAuditEvent", event)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AppendAuditEvent indicates an expected call of AppendAuditEvent.
+func (mr *MockAuditRepositoryInterfaceMockRecorder) AppendAuditEvent(event interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AppendAuditEvent", reflect.TypeOf((*MockAuditRepositoryInterface)(nil).AppendAuditEvent), event)
+}
+
+// GetAuditEventsAfter mocks base method.
+func (m *MockAuditRepositoryInterface) GetAuditEventsAfter(seq, limit int64) ([]pkg.AuditEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetAuditEventsAfter", seq, limit)
+	ret0, _ := ret[0].([]pkg.AuditEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetAuditEventsAfter indicates an expected call of GetAuditEventsAfter.
+func (mr *MockAuditRepositoryInterfaceMockRecorder) GetAuditEventsAfter(seq, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAuditEventsAfter", reflect.TypeOf((*MockAuditRepositoryInterface)(nil).GetAuditEventsAfter), seq, limit)
+}
+
+// GetLastAuditEvent mocks base method.
+func (m *MockAuditRepositoryInterface) GetLastAuditEvent() (pkg.AuditEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLastAuditEvent")
+	ret0, _ := ret[0].(pkg.AuditEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLastAuditEvent indicates an expected call of GetLastAuditEvent.
+func (mr *MockAuditRepositoryInterfaceMockRecorder) GetLastAuditEvent() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLastAuditEvent", reflect.TypeOf((*MockAuditRepositoryInterface)(nil).GetLastAuditEvent))
+}
+
+// SearchAuditEvents mocks base method.
+func (m *MockAuditRepositoryInterface) SearchAuditEvents(filter pkg.AuditFilter) ([]pkg.AuditEvent, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SearchAuditEvents", filter)
+	ret0, _ := ret[0].([]pkg.AuditEvent)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// SearchAuditEvents indicates an expected call of SearchAuditEvents.
+func (mr *MockAuditRepositoryInterfaceMockRecorder) SearchAuditEvents(filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchAuditEvents", reflect.TypeOf((*MockAuditRepositoryInterface)(nil).SearchAuditEvents), filter)
+}
+
+// MockMailer is a mock of Mailer interface.
+type MockMailer struct {
+	ctrl     *gomock.Controller
+	recorder *MockMailerMockRecorder
+}
+
+// MockMailerMockRecorder is the mock recorder for MockMailer.
+type MockMailerMockRecorder struct {
+	mock *MockMailer
+}
+
+// NewMockMailer creates a new mock instance.
+func NewMockMailer(ctrl *gomock.Controller) *MockMailer {
+	mock := &MockMailer{ctrl: ctrl}
+	mock.recorder = &MockMailerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockMailer) EXPECT() *MockMailerMockRecorder {
+	return m.recorder
+}
+
+// Send mocks base method.
+func (m *MockMailer) Send(ctx context.Context, msg pkg.MailMessage) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Send", ctx, msg)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Send indicates an expected call of Send.
+func (mr *MockMailerMockRecorder) Send(ctx, msg interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Send", reflect.TypeOf((*MockMailer)(nil).Send), ctx, msg)
+}
+
+// MockRateLimitStore is a mock of RateLimitStore interface.
+type MockRateLimitStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockRateLimitStoreMockRecorder
+}
+
+// MockRateLimitStoreMockRecorder is the mock recorder for MockRateLimitStore.
+type MockRateLimitStoreMockRecorder struct {
+	mock *MockRateLimitStore
+}
+
+// NewMockRateLimitStore creates a new mock instance.
+func NewMockRateLimitStore(ctrl *gomock.Controller) *MockRateLimitStore {
+	mock := &MockRateLimitStore{ctrl: ctrl}
+	mock.recorder = &MockRateLimitStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRateLimitStore) EXPECT() *MockRateLimitStoreMockRecorder {
+	return m.recorder
+}
+
+// Take mocks base method.
+func (m *MockRateLimitStore) Take(ctx context.Context, key string, policy config.RateLimitPolicy, now time.Time) (pkg.RateLimitResult, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Take", ctx, key, policy, now)
+	ret0, _ := ret[0].(pkg.RateLimitResult)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Take indicates an expected call of Take.
+func (mr *MockRateLimitStoreMockRecorder) Take(ctx, key, policy, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Take", reflect.TypeOf((*MockRateLimitStore)(nil).Take), ctx, key, policy, now)
+}
+
+// MockEventBroker is a mock of EventBroker interface.
+type MockEventBroker struct {
+	ctrl     *gomock.Controller
+	recorder *MockEventBrokerMockRecorder
+}
+
+// MockEventBrokerMockRecorder is the mock recorder for MockEventBroker.
+type MockEventBrokerMockRecorder struct {
+	mock *MockEventBroker
+}
+
+// NewMockEventBroker creates a new mock instance.
+func NewMockEventBroker(ctrl *gomock.Controller) *MockEventBroker {
+	mock := &MockEventBroker{ctrl: ctrl}
+	mock.recorder = &MockEventBrokerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockEventBroker) EXPECT() *MockEventBrokerMockRecorder {
+	return m.recorder
+}
+
+// Publish mocks base method.
+func (m *MockEventBroker) Publish(event pkg.Event) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Publish", event)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Publish indicates an expected call of Publish.
+func (mr *MockEventBrokerMockRecorder) Publish(event interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Publish", reflect.TypeOf((*MockEventBroker)(nil).Publish), event)
+}
+
+// Subscribe mocks base method.
+func (m *MockEventBroker) Subscribe(deliver func(pkg.Event)) func() {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Subscribe", deliver)
+	ret0, _ := ret[0].(func())
+	return ret0
+}
+
+// Subscribe indicates an expected call of Subscribe.
+func (mr *MockEventBrokerMockRecorder) Subscribe(deliver interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Subscribe", reflect.TypeOf((*MockEventBroker)(nil).Subscribe), deliver)
+}
+
+// MockMediaRepositoryInterface is a mock of MediaRepositoryInterface interface.
+type MockMediaRepositoryInterface struct {
+	ctrl     *gomock.Controller
+	recorder *MockMediaRepositoryInterfaceMockRecorder
+}
+
+// MockMediaRepositoryInterfaceMockRecorder is the mock recorder for MockMediaRepositoryInterface.
+type MockMediaRepositoryInterfaceMockRecorder struct {
+	mock *MockMediaRepositoryInterface
+}
+
+// NewMockMediaRepositoryInterface creates a new mock instance.
+func NewMockMediaRepositoryInterface(ctrl *gomock.Controller) *MockMediaRepositoryInterface {
+	mock := &MockMediaRepositoryInterface{ctrl: ctrl}
+	mock.recorder = &MockMediaRepositoryInterfaceMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockMediaRepositoryInterface) EXPECT() *MockMediaRepositoryInterfaceMockRecorder {
+	return m.recorder
+}
+
+// CountMediaByHash mocks base method.
+func (m *MockMediaRepositoryInterface) CountMediaByHash(hash string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountMediaByHash", hash)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountMediaByHash indicates an expected call of CountMediaByHash.
+func (mr *MockMediaRepositoryInterfaceMockRecorder) CountMediaByHash(hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountMediaByHash", reflect.TypeOf((*MockMediaRepositoryInterface)(nil).CountMediaByHash), hash)
+}
+
+// CreateMedia mocks base method.
+func (m *MockMediaRepositoryInterface) CreateMedia(media pkg.Media) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateMedia", media)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateMedia indicates an expected call of CreateMedia.
+func (mr *MockMediaRepositoryInterfaceMockRecorder) CreateMedia(media interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateMedia", reflect.TypeOf((*MockMediaRepositoryInterface)(nil).CreateMedia), media)
+}
+
+// DeleteMedia mocks base method.
+func (m *MockMediaRepositoryInterface) DeleteMedia(id primitive.ObjectID) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteMedia", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteMedia indicates an expected call of DeleteMedia.
+func (mr *MockMediaRepositoryInterfaceMockRecorder) DeleteMedia(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMedia", reflect.TypeOf((*MockMediaRepositoryInterface)(nil).DeleteMedia), id)
+}
+
+// GetMediaByID mocks base method.
+func (m *MockMediaRepositoryInterface) GetMediaByID(id string) (pkg.Media, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMediaByID", id)
+	ret0, _ := ret[0].(pkg.Media)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMediaByID indicates an expected call of GetMediaByID.
+func (mr *MockMediaRepositoryInterfaceMockRecorder) GetMediaByID(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMediaByID", reflect.TypeOf((*MockMediaRepositoryInterface)(nil).GetMediaByID), id)
+}
+
+// GetMediaByOwnerAndHash mocks base method.
+func (m *MockMediaRepositoryInterface) GetMediaByOwnerAndHash(ownerID, hash string) (pkg.Media, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetMediaByOwnerAndHash", ownerID, hash)
+	ret0, _ := ret[0].(pkg.Media)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetMediaByOwnerAndHash indicates an expected call of GetMediaByOwnerAndHash.
+func (mr *MockMediaRepositoryInterfaceMockRecorder) GetMediaByOwnerAndHash(ownerID, hash interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetMediaByOwnerAndHash", reflect.TypeOf((*MockMediaRepositoryInterface)(nil).GetMediaByOwnerAndHash), ownerID, hash)
+}
+
+// GetOrphanedMedia mocks base method.
+func (m *MockMediaRepositoryInterface) GetOrphanedMedia(before time.Time) ([]pkg.Media, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetOrphanedMedia", before)
+	ret0, _ := ret[0].([]pkg.Media)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetOrphanedMedia indicates an expected call of GetOrphanedMedia.
+func (mr *MockMediaRepositoryInterfaceMockRecorder) GetOrphanedMedia(before interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetOrphanedMedia", reflect.TypeOf((*MockMediaRepositoryInterface)(nil).GetOrphanedMedia), before)
+}
+
+// GetPostMedia mocks base method.
+func (m *MockMediaRepositoryInterface) GetPostMedia(postID string) ([]pkg.Media, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPostMedia", postID)
+	ret0, _ := ret[0].([]pkg.Media)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPostMedia indicates an expected call of GetPostMedia.
+func (mr *MockMediaRepositoryInterfaceMockRecorder) GetPostMedia(postID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPostMedia", reflect.TypeOf((*MockMediaRepositoryInterface)(nil).GetPostMedia), postID)
+}
+
+// GetUnprocessedMedia mocks base method.
+func (m *MockMediaRepositoryInterface) GetUnprocessedMedia() ([]pkg.Media, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUnprocessedMedia")
+	ret0, _ := ret[0].([]pkg.Media)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUnprocessedMedia indicates an expected call of GetUnprocessedMedia.
+func (mr *MockMediaRepositoryInterfaceMockRecorder) GetUnprocessedMedia() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUnprocessedMedia", reflect.TypeOf((*MockMediaRepositoryInterface)(nil).GetUnprocessedMedia))
+}
+
+// GetUserMedia mocks base method.
+func (m *MockMediaRepositoryInterface) GetUserMedia(ownerID string) ([]pkg.Media, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserMedia", ownerID)
+	ret0, _ := ret[0].([]pkg.Media)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserMedia indicates an expected call of GetUserMedia.
+func (mr *MockMediaRepositoryInterfaceMockRecorder) GetUserMedia(ownerID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserMedia", reflect.TypeOf((*MockMediaRepositoryInterface)(nil).GetUserMedia), ownerID)
+}
+
+// GetUserMediaUsage mocks base method.
+func (m *MockMediaRepositoryInterface) GetUserMediaUsage(ownerID string) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserMediaUsage", ownerID)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserMediaUsage indicates an expected call of GetUserMediaUsage.
+func (mr *MockMediaRepositoryInterfaceMockRecorder) GetUserMediaUsage(ownerID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserMediaUsage", reflect.TypeOf((*MockMediaRepositoryInterface)(nil).GetUserMediaUsage), ownerID)
+}
+
+// LinkMedia mocks base method.
+func (m *MockMediaRepositoryInterface) LinkMedia(ids []primitive.ObjectID, ownerID, postID string, now time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LinkMedia", ids, ownerID, postID, now)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// LinkMedia indicates an expected call of LinkMedia.
+func (mr *MockMediaRepositoryInterfaceMockRecorder) LinkMedia(ids, ownerID, postID, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LinkMedia", reflect.TypeOf((*MockMediaRepositoryInterface)(nil).LinkMedia), ids, ownerID, postID, now)
+}
+
+// UnlinkPostMedia mocks base method.
+func (m *MockMediaRepositoryInterface) UnlinkPostMedia(postID string, now time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UnlinkPostMedia", postID, now)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UnlinkPostMedia indicates an expected call of UnlinkPostMedia.
+func (mr *MockMediaRepositoryInterfaceMockRecorder) UnlinkPostMedia(postID, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UnlinkPostMedia", reflect.TypeOf((*MockMediaRepositoryInterface)(nil).UnlinkPostMedia), postID, now)
+}
+
+// UpdateMedia mocks base method.
+func (m *MockMediaRepositoryInterface) UpdateMedia(id primitive.ObjectID, updateFields bson.M) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateMedia", id, updateFields)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateMedia indicates an expected call of UpdateMedia.
+func (mr *MockMediaRepositoryInterfaceMockRecorder) UpdateMedia(id, updateFields interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateMedia", reflect.TypeOf((*MockMediaRepositoryInterface)(nil).UpdateMedia), id, updateFields)
+}
+
+// MockBlobStore is a mock of BlobStore interface.
+type MockBlobStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockBlobStoreMockRecorder
+}
+
+// MockBlobStoreMockRecorder is the mock recorder for MockBlobStore.
+type MockBlobStoreMockRecorder struct {
+	mock *MockBlobStore
+}
+
+// NewMockBlobStore creates a new mock instance.
+func NewMockBlobStore(ctrl *gomock.Controller) *MockBlobStore {
+	mock := &MockBlobStore{ctrl: ctrl}
+	mock.recorder = &MockBlobStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockBlobStore) EXPECT() *MockBlobStoreMockRecorder {
+	return m.recorder
+}
+
+// Delete mocks base method.
+func (m *MockBlobStore) Delete(ctx context.Context, key string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, key)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockBlobStoreMockRecorder) Delete(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockBlobStore)(nil).Delete), ctx, key)
+}
+
+// Get mocks base method.
+func (m *MockBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx, key)
+	ret0, _ := ret[0].(io.ReadCloser)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockBlobStoreMockRecorder) Get(ctx, key interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockBlobStore)(nil).Get), ctx, key)
+}
+
+// Put mocks base method.
+func (m *MockBlobStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Put", ctx, key, r, size, contentType)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Put indicates an expected call of Put.
+func (mr *MockBlobStoreMockRecorder) Put(ctx, key, r, size, contentType interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Put", reflect.TypeOf((*MockBlobStore)(nil).Put), ctx, key, r, size, contentType)
 }
@@ -0,0 +1,747 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Takeso-user/blog-backend/config"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	NotifyComment    = "comment"
+	NotifyReply      = "reply"
+	NotifyMention    = "mention"
+	NotifyReaction   = "reaction"
+	NotifyRoleChange = "role_change"
+
+	defaultNotificationPageSize = 20
+	maxNotificationPageSize     = 100
+	// maxNotificationActors is how many of a group's actors are kept and
+	// shown.
+	maxNotificationActors = 3
+)
+
+// NotificationTypes lists the notification types users can turn off.
+var NotificationTypes = []string{NotifyComment, NotifyReply, NotifyMention, NotifyReaction, NotifyRoleChange}
+
+var (
+	ErrNotificationNotFound    = errors.New("notification not found")
+	ErrUnknownNotificationType = errors.New("unknown notification type")
+	ErrCommentNotFound         = errors.New("comment not found")
+)
+
+// mentionPattern matches @username where the @ does not continue a word,
+// so that email addresses are not taken for mentions.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\w@./-])@([A-Za-z0-9._-]{3,32})`)
+
+// Mentions returns the usernames mentioned in content, each once, in the
+// order they first appear. A trailing dot is taken as punctuation.
+func Mentions(content string) []string {
+	var usernames []string
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		username := strings.TrimRight(match[1], ".")
+		if usernamePattern.MatchString(username) && !slices.Contains(usernames, username) {
+			usernames = append(usernames, username)
+		}
+	}
+	return usernames
+}
+
+// NotificationFilter selects one page of a user's notifications, most
+// recently updated first.
+type NotificationFilter struct {
+	UserID     string
+	UnreadOnly bool
+	Limit      int64
+	Offset     int64
+}
+
+func (f NotificationFilter) bson() bson.M {
+	query := bson.M{"user_id": f.UserID}
+	if f.UnreadOnly {
+		query["read"] = false
+	}
+	return query
+}
+
+type NotificationRepository struct {
+	Collection *mongo.Collection
+}
+
+func NewNotificationRepository(collection *mongo.Collection) *NotificationRepository {
+	_, err := collection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "updated_at", Value: -1}}},
+		{
+			// A user has at most one unread notification per group, which
+			// similar events are folded into.
+			Keys:    bson.D{{Key: "user_id", Value: 1}, {Key: "group_key", Value: 1}},
+			Options: options.Index().SetUnique(true).SetPartialFilterExpression(bson.M{"read": false}),
+		},
+		{Keys: bson.M{"actor_ids": 1}},
+		{Keys: bson.M{"expires_at": 1}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		log.Printf("Error creating notification indexes: %v", err)
+	}
+	return &NotificationRepository{Collection: collection}
+}
+
+// AddNotification records a notification with a single actor. When the
+// user has an unread notification with the same group key, the actor is
+// added to that one instead; an actor among its latest ones only refreshes
+// it. Only the latest maxNotificationActors actors are kept, so one who
+// dropped out of them is counted again. It returns the notification as
+// stored.
+func (r *NotificationRepository) AddNotification(notification Notification) (Notification, error) {
+	actorID, actor := notification.ActorIDs[0], notification.Actors[0]
+	refresh := bson.M{"updated_at": notification.UpdatedAt, "expires_at": notification.ExpiresAt}
+	if notification.CommentID != "" {
+		refresh["comment_id"] = notification.CommentID
+	}
+	group := func(actors bson.M) bson.M {
+		return bson.M{"user_id": notification.UserID, "group_key": notification.GroupKey, "read": false, "actor_ids": actors}
+	}
+	join := bson.M{
+		"$push": bson.M{
+			"actor_ids": bson.M{"$each": []string{actorID}, "$position": 0, "$slice": maxNotificationActors},
+			"actors":    bson.M{"$each": []string{actor}, "$position": 0, "$slice": maxNotificationActors},
+		},
+		"$inc": bson.M{"actor_count": 1},
+		"$set": refresh,
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	for attempt := 0; ; attempt++ {
+		var stored Notification
+		err := r.Collection.FindOneAndUpdate(context.TODO(), group(bson.M{"$ne": actorID}), join, opts).Decode(&stored)
+		if err == nil {
+			return stored, nil
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			log.Printf("Error adding to notification: %v", err)
+			return Notification{}, err
+		}
+		err = r.Collection.FindOneAndUpdate(context.TODO(), group(bson.M{"$eq": actorID}), bson.M{"$set": refresh}, opts).Decode(&stored)
+		if err == nil {
+			return stored, nil
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			log.Printf("Error refreshing notification: %v", err)
+			return Notification{}, err
+		}
+		_, err = r.Collection.InsertOne(context.TODO(), notification)
+		// Concurrent events of the same group race to start it; the loser
+		// joins it on the second attempt.
+		if mongo.IsDuplicateKeyError(err) && attempt == 0 {
+			continue
+		}
+		if err != nil {
+			log.Printf("Error adding notification: %v", err)
+			return Notification{}, err
+		}
+		return notification, nil
+	}
+}
+
+// GetNotifications returns one page of the notifications matching filter
+// and the total number of matches. A zero Limit returns all of them.
+func (r *NotificationRepository) GetNotifications(filter NotificationFilter) ([]Notification, int64, error) {
+	query := filter.bson()
+	total, err := r.Collection.CountDocuments(context.TODO(), query)
+	if err != nil {
+		log.Printf("Error counting notifications: %v", err)
+		return nil, 0, err
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "updated_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetSkip(filter.Offset).
+		SetLimit(filter.Limit)
+	cursor, err := r.Collection.Find(context.TODO(), query, opts)
+	if err != nil {
+		log.Printf("Error getting notifications: %v", err)
+		return nil, 0, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Printf("Error closing cursor: %v", err)
+		}
+	}(cursor, context.TODO())
+
+	notifications := []Notification{}
+	if err = cursor.All(context.TODO(), &notifications); err != nil {
+		log.Printf("Error decoding notifications: %v", err)
+		return nil, 0, err
+	}
+	return notifications, total, nil
+}
+
+func (r *NotificationRepository) CountUnreadNotifications(userID string) (int64, error) {
+	count, err := r.Collection.CountDocuments(context.TODO(), bson.M{"user_id": userID, "read": false})
+	if err != nil {
+		log.Printf("Error counting unread notifications: %v", err)
+	}
+	return count, err
+}
+
+func (r *NotificationRepository) MarkNotificationRead(userID, id string) (Notification, error) {
+	var notification Notification
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return notification, mongo.ErrNoDocuments
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = r.Collection.FindOneAndUpdate(context.TODO(), bson.M{"_id": objectID, "user_id": userID}, bson.M{"$set": bson.M{"read": true}}, opts).Decode(&notification)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		log.Printf("Error marking notification read: %v", err)
+	}
+	return notification, err
+}
+
+func (r *NotificationRepository) MarkAllNotificationsRead(userID string) (int64, error) {
+	result, err := r.Collection.UpdateMany(context.TODO(), bson.M{"user_id": userID, "read": false}, bson.M{"$set": bson.M{"read": true}})
+	if err != nil {
+		log.Printf("Error marking notifications read: %v", err)
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// RenameNotificationActor changes the username shown for an actor in the
+// notifications they caused.
+func (r *NotificationRepository) RenameNotificationActor(actorID, from, to string) (int64, error) {
+	opts := options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{"actor": from}}})
+	result, err := r.Collection.UpdateMany(context.TODO(), bson.M{"actor_ids": actorID}, bson.M{"$set": bson.M{"actors.$[actor]": to}}, opts)
+	if err != nil {
+		log.Printf("Error renaming notification actor: %v", err)
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+func (r *NotificationRepository) DeleteNotificationsByUser(userID string) (int64, error) {
+	result, err := r.Collection.DeleteMany(context.TODO(), bson.M{"user_id": userID})
+	if err != nil {
+		log.Printf("Error deleting notifications: %v", err)
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// NotificationService records notifications as posts, comments, reactions
+// and role changes happen and keeps each user's inbox. Recording is best
+// effort: failures are logged and never fail the action that caused them.
+type NotificationService struct {
+	Repository NotificationRepositoryInterface
+	Users      *UserService
+	Posts      *PostService
+	Comments   *CommentService
+	Config     config.NotificationsConfig
+	// Events, when set, streams new notifications to their recipients.
+	Events *EventBus
+}
+
+func NewNotificationService(repository NotificationRepositoryInterface, users *UserService, posts *PostService, comments *CommentService, cfg config.NotificationsConfig) *NotificationService {
+	return &NotificationService{Repository: repository, Users: users, Posts: posts, Comments: comments, Config: cfg}
+}
+
+// CommentAdded notifies the author of the commented post, the author of
+// the comment replied to and the users mentioned. Each of them is
+// notified once, in that order of precedence.
+func (s *NotificationService) CommentAdded(comment Comment) {
+	post, err := s.Posts.GetPostById(comment.PostID)
+	if err != nil {
+		log.Printf("Unable to notify about comment %s: %v", comment.ID.Hex(), err)
+		return
+	}
+	notified := []string{comment.UserID}
+	about := Notification{PostID: comment.PostID, PostTitle: post.Title, CommentID: comment.ID.Hex()}
+	if comment.ParentID != "" {
+		if parent, err := s.Comments.Repository.GetCommentByID(comment.ParentID); err == nil {
+			reply := about
+			reply.Type, reply.GroupKey = NotifyReply, "reply:"+parent.ID.Hex()
+			notified = s.notifyID(parent.UserID, comment.UserID, comment.Username, reply, notified)
+		}
+	}
+	if post.AuthorID != "" {
+		if author, err := s.Users.GetUserByUsername(post.AuthorID); err == nil {
+			commented := about
+			commented.Type, commented.GroupKey = NotifyComment, "comment:"+comment.PostID
+			notified = s.notify(author, comment.UserID, comment.Username, commented, notified)
+		}
+	}
+	mention := about
+	mention.Type, mention.GroupKey = NotifyMention, "mention:comment:"+comment.ID.Hex()
+	s.notifyMentions(comment.Content, comment.UserID, comment.Username, mention, notified)
+}
+
+// PostPublished notifies the users mentioned in a new post, or newly
+// mentioned in an edited one.
+func (s *NotificationService) PostPublished(post Post, previousContent string) {
+	author, err := s.Users.GetUserByUsername(post.AuthorID)
+	if err != nil {
+		log.Printf("Unable to notify about post %s: %v", post.ID.Hex(), err)
+		return
+	}
+	notified := append([]string{author.ID.Hex()}, Mentions(previousContent)...)
+	mention := Notification{Type: NotifyMention, GroupKey: "mention:post:" + post.ID.Hex(), PostID: post.ID.Hex(), PostTitle: post.Title}
+	s.notifyMentions(post.Content, author.ID.Hex(), author.Username, mention, notified)
+}
+
+// Reacted notifies the author of a post or comment that the user reacted
+// to it.
+func (s *NotificationService) Reacted(targetType, targetID, userID string) {
+	actor, err := s.Users.GetUserByID(userID)
+	if err != nil {
+		log.Printf("Unable to notify about reaction of %s: %v", userID, err)
+		return
+	}
+	reaction := Notification{Type: NotifyReaction, GroupKey: "reaction:" + targetType + ":" + targetID}
+	switch targetType {
+	case ReactionOnPost:
+		post, err := s.Posts.GetPostById(targetID)
+		if err != nil || post.AuthorID == "" {
+			return
+		}
+		author, err := s.Users.GetUserByUsername(post.AuthorID)
+		if err != nil {
+			return
+		}
+		reaction.PostID, reaction.PostTitle = targetID, post.Title
+		s.notify(author, actor.ID.Hex(), actor.Username, reaction, nil)
+	case ReactionOnComment:
+		comment, err := s.Comments.Repository.GetCommentByID(targetID)
+		if err != nil {
+			return
+		}
+		reaction.PostID, reaction.CommentID = comment.PostID, targetID
+		if post, err := s.Posts.GetPostById(comment.PostID); err == nil {
+			reaction.PostTitle = post.Title
+		}
+		s.notifyID(comment.UserID, actor.ID.Hex(), actor.Username, reaction, nil)
+	}
+}
+
+// RoleChanged tells the user an admin gave them a new role.
+func (s *NotificationService) RoleChanged(admin, user User, role string) {
+	change := Notification{Type: NotifyRoleChange, GroupKey: "role_change:" + primitive.NewObjectID().Hex(), Role: role}
+	s.notify(user, admin.ID.Hex(), admin.Username, change, nil)
+}
+
+// GetNotifications returns one page of the user's notifications, most
+// recently updated first, and their total number.
+func (s *NotificationService) GetNotifications(user User, unreadOnly bool, limit, offset int64) ([]Notification, int64, error) {
+	filter := NotificationFilter{UserID: user.ID.Hex(), UnreadOnly: unreadOnly, Limit: limit, Offset: offset}
+	if filter.Limit <= 0 {
+		filter.Limit = defaultNotificationPageSize
+	}
+	if filter.Limit > maxNotificationPageSize {
+		filter.Limit = maxNotificationPageSize
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	notifications, total, err := s.Repository.GetNotifications(filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range notifications {
+		notifications[i] = presentNotification(notifications[i])
+	}
+	return notifications, total, nil
+}
+
+func (s *NotificationService) UnreadCount(user User) (int64, error) {
+	return s.Repository.CountUnreadNotifications(user.ID.Hex())
+}
+
+func (s *NotificationService) MarkRead(user User, id string) (Notification, error) {
+	notification, err := s.Repository.MarkNotificationRead(user.ID.Hex(), id)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Notification{}, ErrNotificationNotFound
+	}
+	if err != nil {
+		return Notification{}, err
+	}
+	return presentNotification(notification), nil
+}
+
+func (s *NotificationService) MarkAllRead(user User) (int64, error) {
+	return s.Repository.MarkAllNotificationsRead(user.ID.Hex())
+}
+
+// Preferences reports for each notification type whether the user gets
+// notifications of it.
+func (s *NotificationService) Preferences(user User) map[string]bool {
+	preferences := make(map[string]bool, len(NotificationTypes))
+	for _, notificationType := range NotificationTypes {
+		preferences[notificationType] = !slices.Contains(user.MutedNotifications, notificationType)
+	}
+	return preferences
+}
+
+// SetPreferences turns notification types on or off. Types left out keep
+// their setting.
+func (s *NotificationService) SetPreferences(user User, changes map[string]bool) (map[string]bool, error) {
+	preferences := s.Preferences(user)
+	for notificationType, enabled := range changes {
+		if !slices.Contains(NotificationTypes, notificationType) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownNotificationType, notificationType)
+		}
+		preferences[notificationType] = enabled
+	}
+	muted := []string{}
+	for _, notificationType := range NotificationTypes {
+		if !preferences[notificationType] {
+			muted = append(muted, notificationType)
+		}
+	}
+	updated, err := s.Users.UpdateUser(user.ID, bson.M{"muted_notifications": muted})
+	if err != nil {
+		return nil, err
+	}
+	return s.Preferences(updated), nil
+}
+
+// RenameActor shows the user's new username in the notifications they
+// caused.
+func (s *NotificationService) RenameActor(user User, username string) error {
+	_, err := s.Repository.RenameNotificationActor(user.ID.Hex(), user.Username, username)
+	return err
+}
+
+// RemoveUser deletes the user's notifications and shows deletedUsername
+// in place of their name in the notifications they caused.
+func (s *NotificationService) RemoveUser(user User, deletedUsername string) error {
+	if _, err := s.Repository.DeleteNotificationsByUser(user.ID.Hex()); err != nil {
+		return err
+	}
+	return s.RenameActor(user, deletedUsername)
+}
+
+func (s *NotificationService) notifyMentions(content, actorID, actorName string, mention Notification, notified []string) {
+	usernames := Mentions(content)
+	if len(usernames) > s.Config.MaxMentions {
+		usernames = usernames[:s.Config.MaxMentions]
+	}
+	for _, username := range usernames {
+		if slices.Contains(notified, username) {
+			continue
+		}
+		if user, err := s.Users.GetUserByUsername(username); err == nil {
+			notified = s.notify(user, actorID, actorName, mention, notified)
+		}
+	}
+}
+
+func (s *NotificationService) notifyID(userID, actorID, actorName string, notification Notification, notified []string) []string {
+	if userID == "" || slices.Contains(notified, userID) {
+		return notified
+	}
+	user, err := s.Users.GetUserByID(userID)
+	if err != nil {
+		return notified
+	}
+	return s.notify(user, actorID, actorName, notification, notified)
+}
+
+// notify records the notification for user unless they caused it, were
+// already notified of the same event or turned its type off. notified
+// holds the IDs and usernames of those already notified; the returned
+// slice adds user.
+func (s *NotificationService) notify(user User, actorID, actorName string, notification Notification, notified []string) []string {
+	userID := user.ID.Hex()
+	if userID == actorID || slices.Contains(notified, userID) {
+		return notified
+	}
+	notified = append(notified, userID, user.Username)
+	if slices.Contains(user.MutedNotifications, notification.Type) {
+		return notified
+	}
+	now := time.Now()
+	notification.ID = primitive.NewObjectID()
+	notification.UserID = userID
+	notification.ActorIDs = []string{actorID}
+	notification.Actors = []string{actorName}
+	notification.ActorCount = 1
+	notification.CreatedAt = now
+	notification.UpdatedAt = now
+	notification.ExpiresAt = now.Add(s.Config.Retention)
+	stored, err := s.Repository.AddNotification(notification)
+	if err != nil {
+		log.Printf("Unable to notify %s of %s: %v", user.Username, notification.Type, err)
+		return notified
+	}
+	if s.Events != nil {
+		s.Events.Publish(UserTopic(userID), EventNotification, presentNotification(stored))
+	}
+	return notified
+}
+
+// presentNotification keeps the newest actors and describes the
+// notification, e.g. "alice and 4 others reacted to your post".
+func presentNotification(notification Notification) Notification {
+	if len(notification.Actors) > maxNotificationActors {
+		notification.Actors = notification.Actors[:maxNotificationActors]
+	}
+	notification.Message = actorSummary(notification.Actors, notification.ActorCount) + " " + notificationAction(notification)
+	return notification
+}
+
+func actorSummary(actors []string, count int) string {
+	switch {
+	case len(actors) == 0:
+		return "Someone"
+	case count <= 1:
+		return actors[0]
+	case count == 2 && len(actors) == 2:
+		return actors[0] + " and " + actors[1]
+	case count == 2:
+		return actors[0] + " and 1 other"
+	default:
+		return fmt.Sprintf("%s and %d others", actors[0], count-1)
+	}
+}
+
+func notificationAction(notification Notification) string {
+	post := "your post"
+	if notification.PostTitle != "" {
+		post += ` "` + notification.PostTitle + `"`
+	}
+	switch notification.Type {
+	case NotifyComment:
+		return "commented on " + post
+	case NotifyReply:
+		return "replied to your comment"
+	case NotifyMention:
+		if notification.CommentID != "" {
+			return "mentioned you in a comment"
+		}
+		return "mentioned you in a post"
+	case NotifyReaction:
+		if notification.CommentID != "" {
+			return "reacted to your comment"
+		}
+		return "reacted to " + post
+	case NotifyRoleChange:
+		return "changed your role to " + notification.Role
+	default:
+		return notification.Type
+	}
+}
+
+func NotificationsExportSection(notificationService *NotificationService) ExportSection {
+	return ExportSection{Name: "notifications", Title: "Notifications", Collect: func(user User) (interface{}, error) {
+		notifications, _, err := notificationService.Repository.GetNotifications(NotificationFilter{UserID: user.ID.Hex()})
+		if err != nil {
+			return nil, err
+		}
+		for i := range notifications {
+			notifications[i] = presentNotification(notifications[i])
+		}
+		return gin.H{"notifications": notifications, "preferences": notificationService.Preferences(user)}, nil
+	}}
+}
+
+// notifyComment records the notifications about a new comment.
+func (s *CommentService) notifyComment(comment Comment) {
+	if s.Notifications != nil {
+		s.Notifications.CommentAdded(comment)
+	}
+}
+
+// notifyMentions records the notifications about the users a post
+// mentions that previousContent did not.
+func (s *PostService) notifyMentions(post Post, previousContent string) {
+	if s.Notifications != nil {
+		s.Notifications.PostPublished(post, previousContent)
+	}
+}
+
+func notificationError(c *gin.Context, action string, err error) {
+	switch {
+	case errors.Is(err, ErrNotificationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrUnknownNotificationType):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Unable to %s: %v", action, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to " + action})
+	}
+}
+
+// GetNotifications godoc
+//
+//	@Summary		List notifications
+//	@Description	List the user's notifications, most recently updated first, with the number of unread ones. Similar events are grouped while unread, e.g. "alice and 4 others reacted to your post".
+//	@Security		ApiKeyAuth
+//	@Tags			notifications
+//	@Produce		json
+//	@Param			unread	query		bool	false	"Only unread notifications"
+//	@Param			limit	query		int		false	"Page size, at most 100"
+//	@Param			offset	query		int		false	"Number of notifications to skip"
+//	@Success		200		{object}	Response
+//	@Failure		400		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/api/notifications [get]
+func (h *Handler) GetNotifications(c *gin.Context) {
+	limit, offset, ok := pageParams(c)
+	if !ok {
+		return
+	}
+	var unreadOnly bool
+	if v := c.Query("unread"); v != "" {
+		var err error
+		if unreadOnly, err = strconv.ParseBool(v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid unread"})
+			return
+		}
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	notifications, total, err := h.NotificationService.GetNotifications(user, unreadOnly, limit, offset)
+	if err != nil {
+		notificationError(c, "fetch notifications", err)
+		return
+	}
+	unread, err := h.NotificationService.UnreadCount(user)
+	if err != nil {
+		notificationError(c, "fetch notifications", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"notifications": notifications, "total": total, "unread": unread})
+}
+
+// GetUnreadNotificationCount godoc
+//
+//	@Summary		Count unread notifications
+//	@Description	Count the user's unread notifications
+//	@Security		ApiKeyAuth
+//	@Tags			notifications
+//	@Produce		json
+//	@Success		200	{object}	Response
+//	@Failure		500	{object}	Response
+//	@Router			/api/notifications/unread-count [get]
+func (h *Handler) GetUnreadNotificationCount(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	unread, err := h.NotificationService.UnreadCount(user)
+	if err != nil {
+		notificationError(c, "count notifications", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"unread": unread})
+}
+
+// MarkNotificationRead godoc
+//
+//	@Summary		Mark a notification read
+//	@Description	Mark a notification read. Later events of the same kind start a new notification.
+//	@Security		ApiKeyAuth
+//	@Tags			notifications
+//	@Produce		json
+//	@Param			id	path		string	true	"Notification ID"
+//	@Success		200	{object}	Notification
+//	@Failure		404	{object}	Response
+//	@Failure		500	{object}	Response
+//	@Router			/api/notifications/{id}/read [post]
+func (h *Handler) MarkNotificationRead(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	notification, err := h.NotificationService.MarkRead(user, c.Param("id"))
+	if err != nil {
+		notificationError(c, "mark notification read", err)
+		return
+	}
+	c.JSON(http.StatusOK, notification)
+}
+
+// MarkAllNotificationsRead godoc
+//
+//	@Summary		Mark all notifications read
+//	@Description	Mark all of the user's notifications read
+//	@Security		ApiKeyAuth
+//	@Tags			notifications
+//	@Produce		json
+//	@Success		200	{object}	Response
+//	@Failure		500	{object}	Response
+//	@Router			/api/notifications/read-all [post]
+func (h *Handler) MarkAllNotificationsRead(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	updated, err := h.NotificationService.MarkAllRead(user)
+	if err != nil {
+		notificationError(c, "mark notifications read", err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Notifications marked read", "updated": updated})
+}
+
+// GetNotificationPreferences godoc
+//
+//	@Summary		Get notification preferences
+//	@Description	Report for each notification type whether the user gets notifications of it
+//	@Security		ApiKeyAuth
+//	@Tags			notifications
+//	@Produce		json
+//	@Success		200	{object}	map[string]bool
+//	@Failure		401	{object}	Response
+//	@Router			/api/me/notification-preferences [get]
+func (h *Handler) GetNotificationPreferences(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, h.NotificationService.Preferences(user))
+}
+
+// UpdateNotificationPreferences godoc
+//
+//	@Summary		Update notification preferences
+//	@Description	Turn notification types on or off. Types left out keep their setting.
+//	@Security		ApiKeyAuth
+//	@Tags			notifications
+//	@Accept			json
+//	@Produce		json
+//	@Param			input	body		map[string]bool	true	"Notification types and whether they are on"
+//	@Success		200		{object}	map[string]bool
+//	@Failure		400		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/api/me/notification-preferences [put]
+func (h *Handler) UpdateNotificationPreferences(c *gin.Context) {
+	var input map[string]bool
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	preferences, err := h.NotificationService.SetPreferences(user, input)
+	if err != nil {
+		notificationError(c, "update notification preferences", err)
+		return
+	}
+	c.JSON(http.StatusOK, preferences)
+}
@@ -0,0 +1,358 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Takeso-user/blog-backend/config"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/oauth2"
+)
+
+const (
+	TokenPurposeOIDCLogin = "oidc_login"
+
+	oidcStateCookie = "oidc_state"
+	oidcStateTTL    = 10 * time.Minute
+)
+
+var (
+	ErrUnknownOIDCProvider = errors.New("unknown identity provider")
+	ErrOIDCSignupDisabled  = errors.New("no local account is linked to this identity")
+	ErrOIDCAccountConflict = errors.New("an account with this email already exists; sign in with your password first")
+)
+
+var usernameCleaner = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+// oidcClaims are the ID token claims used for account linking.
+type oidcClaims struct {
+	Subject           string `json:"sub"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	PreferredUsername string `json:"preferred_username"`
+	Nonce             string `json:"nonce"`
+}
+
+type oidcClient struct {
+	oauth    *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// OIDCService signs users in with external OpenID Connect providers using
+// the authorization code flow with PKCE. Provider metadata is discovered on
+// first use, so an unreachable provider does not prevent startup.
+type OIDCService struct {
+	Tokens      TokenRepositoryInterface
+	UserService *UserService
+	Providers   map[string]config.OIDCProvider
+	PublicURL   string
+
+	mu      sync.Mutex
+	clients map[string]*oidcClient
+}
+
+func NewOIDCService(tokens TokenRepositoryInterface, userService *UserService, providers map[string]config.OIDCProvider, publicURL string) *OIDCService {
+	return &OIDCService{
+		Tokens:      tokens,
+		UserService: userService,
+		Providers:   providers,
+		PublicURL:   strings.TrimRight(publicURL, "/"),
+		clients:     map[string]*oidcClient{},
+	}
+}
+
+func (s *OIDCService) client(ctx context.Context, name string) (*oidcClient, error) {
+	cfg, ok := s.Providers[name]
+	if !ok {
+		return nil, ErrUnknownOIDCProvider
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if client, ok := s.clients[name]; ok {
+		return client, nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("discovering %s: %w", name, err)
+	}
+	redirectURL := cfg.RedirectURL
+	if redirectURL == "" {
+		redirectURL = s.PublicURL + "/auth/oidc/" + name + "/callback"
+	}
+	scopes := []string{oidc.ScopeOpenID}
+	for _, scope := range cfg.Scopes {
+		if scope != oidc.ScopeOpenID {
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(cfg.Scopes) == 0 {
+		scopes = append(scopes, "email", "profile")
+	}
+	client := &oidcClient{
+		oauth: &oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  redirectURL,
+			Scopes:       scopes,
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+	}
+	s.clients[name] = client
+	return client, nil
+}
+
+// StartLogin returns the provider URL to send the browser to and the state
+// value that must come back on the callback. The PKCE verifier and nonce
+// stay on the server.
+func (s *OIDCService) StartLogin(ctx context.Context, name string) (string, string, error) {
+	client, err := s.client(ctx, name)
+	if err != nil {
+		return "", "", err
+	}
+	state, stateHash, err := newOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, _, err := newOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	now := time.Now()
+	err = s.Tokens.CreateToken(OneTimeToken{
+		Hash:      stateHash,
+		Purpose:   TokenPurposeOIDCLogin,
+		CreatedAt: now,
+		ExpiresAt: now.Add(oidcStateTTL),
+		Data:      map[string]string{"provider": name, "nonce": nonce, "verifier": verifier},
+	})
+	if err != nil {
+		return "", "", err
+	}
+	authURL := client.oauth.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+	return authURL, state, nil
+}
+
+// FinishLogin redeems the authorization code, verifies the ID token and
+// returns the local user for the identity, linking or creating it as
+// needed.
+func (s *OIDCService) FinishLogin(ctx context.Context, name, state, code string) (User, error) {
+	client, err := s.client(ctx, name)
+	if err != nil {
+		return User{}, err
+	}
+	pending, err := s.Tokens.ConsumeToken(TokenPurposeOIDCLogin, hashToken(state), time.Now())
+	if err != nil || pending.Data["provider"] != name {
+		return User{}, ErrInvalidToken
+	}
+
+	token, err := client.oauth.Exchange(ctx, code, oauth2.VerifierOption(pending.Data["verifier"]))
+	if err != nil {
+		return User{}, fmt.Errorf("exchanging code: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return User{}, errors.New("token response has no id_token")
+	}
+	idToken, err := client.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return User{}, fmt.Errorf("verifying id_token: %w", err)
+	}
+	var claims oidcClaims
+	if err := idToken.Claims(&claims); err != nil {
+		return User{}, err
+	}
+	if claims.Nonce != pending.Data["nonce"] {
+		return User{}, errors.New("id_token nonce mismatch")
+	}
+	return s.resolveUser(name, claims)
+}
+
+func (s *OIDCService) resolveUser(name string, claims oidcClaims) (User, error) {
+	user, err := s.UserService.GetUserByIdentity(name, claims.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return User{}, err
+	}
+
+	identity := ExternalIdentity{Provider: name, Subject: claims.Subject, LinkedAt: time.Now()}
+	email, emailErr := NormalizeEmail(claims.Email)
+	if emailErr == nil {
+		identity.Email = email
+		existing, err := s.UserService.GetUserByEmail(email)
+		if err == nil {
+			// Only link when both the provider and the account vouch for
+			// the address. Otherwise anyone could claim an account by its
+			// email, or register with someone else's address ahead of
+			// their first single sign-on.
+			if !claims.EmailVerified || !existing.EmailVerified {
+				return User{}, ErrOIDCAccountConflict
+			}
+			log.Printf("Linking %s identity to user %s", name, existing.Username)
+			return s.UserService.UpdateUser(existing.ID, bson.M{
+				"identities": append(existing.Identities, identity),
+			})
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return User{}, err
+		}
+	}
+
+	cfg := s.Providers[name]
+	if !cfg.AllowSignup {
+		return User{}, ErrOIDCSignupDisabled
+	}
+	username, err := s.availableUsername(claims)
+	if err != nil {
+		return User{}, err
+	}
+	user = User{
+		ID:         primitive.NewObjectID(),
+		Username:   username,
+		Role:       cfg.DefaultRole,
+		Identities: []ExternalIdentity{identity},
+	}
+	if user.Role == "" {
+		user.Role = "user"
+	}
+	if emailErr == nil && claims.EmailVerified {
+		user.Email = email
+		user.EmailVerified = true
+	}
+	if err := s.UserService.CreateUser(user); err != nil {
+		return User{}, err
+	}
+	log.Printf("Provisioned user %s from %s", user.Username, name)
+	return user, nil
+}
+
+// availableUsername derives a username from the ID token and appends a
+// number when it is already taken.
+func (s *OIDCService) availableUsername(claims oidcClaims) (string, error) {
+	base := claims.PreferredUsername
+	if base == "" {
+		base, _, _ = strings.Cut(claims.Email, "@")
+	}
+	base = strings.Trim(usernameCleaner.ReplaceAllString(strings.ToLower(base), "-"), "-.")
+	if base == "" {
+		base = "user"
+	}
+	for i := 0; i < 100; i++ {
+		candidate := base
+		if i > 0 {
+			candidate = fmt.Sprintf("%s%d", base, i+1)
+		}
+		_, err := s.UserService.GetUserByUsername(candidate)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return candidate, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("no free username for %q", base)
+}
+
+func oidcErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrUnknownOIDCProvider):
+		return http.StatusNotFound
+	case errors.Is(err, ErrInvalidToken):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrOIDCSignupDisabled):
+		return http.StatusForbidden
+	case errors.Is(err, ErrOIDCAccountConflict):
+		return http.StatusConflict
+	default:
+		return http.StatusUnauthorized
+	}
+}
+
+// StartOIDCLogin godoc
+//
+//	@Summary		Start an OpenID Connect login
+//	@Description	Redirect to the identity provider's authorization endpoint
+//	@Tags			users
+//	@Param			provider	path	string	true	"Provider name"
+//	@Success		302
+//	@Failure		404	{object}	Response
+//	@Failure		502	{object}	Response
+//	@Router			/auth/oidc/{provider}/start [get]
+func (h *Handler) StartOIDCLogin(c *gin.Context) {
+	name := c.Param("provider")
+	authURL, state, err := h.OIDCService.StartLogin(c.Request.Context(), name)
+	if errors.Is(err, ErrUnknownOIDCProvider) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Unable to start OIDC login: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider unavailable"})
+		return
+	}
+	// The state cookie ties the callback to the browser that started the
+	// login, which prevents login CSRF.
+	secure := strings.HasPrefix(h.OIDCService.PublicURL, "https://")
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, int(oidcStateTTL.Seconds()), "/auth/oidc", "", secure, true)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback godoc
+//
+//	@Summary		Finish an OpenID Connect login
+//	@Description	Handle the identity provider's redirect, link or create the local account and return a JWT
+//	@Tags			users
+//	@Produce		json
+//	@Param			provider	path		string	true	"Provider name"
+//	@Param			code		query		string	true	"Authorization code"
+//	@Param			state		query		string	true	"State"
+//	@Success		200			{object}	Response
+//	@Failure		400			{object}	Response
+//	@Failure		401			{object}	Response
+//	@Failure		403			{object}	Response
+//	@Failure		409			{object}	Response
+//	@Router			/auth/oidc/{provider}/callback [get]
+func (h *Handler) OIDCCallback(c *gin.Context) {
+	if providerErr := c.Query("error"); providerErr != "" {
+		log.Printf("Identity provider returned error: %s", providerErr)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login was cancelled or denied by the identity provider"})
+		return
+	}
+	state := c.Query("state")
+	cookie, err := c.Cookie(oidcStateCookie)
+	if err != nil || state == "" || cookie != state {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired login state"})
+		return
+	}
+	c.SetCookie(oidcStateCookie, "", -1, "/auth/oidc", "", false, true)
+
+	user, err := h.OIDCService.FinishLogin(c.Request.Context(), c.Param("provider"), state, c.Query("code"))
+	if err != nil {
+		log.Printf("OIDC login failed: %v", err)
+		status := oidcErrorStatus(err)
+		message := err.Error()
+		if status == http.StatusUnauthorized {
+			message = "Unable to verify identity provider response"
+		}
+		c.JSON(status, gin.H{"error": message})
+		return
+	}
+	h.completeLogin(c, user)
+}
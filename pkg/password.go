@@ -0,0 +1,263 @@
+package pkg
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/Takeso-user/blog-backend/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrPasswordMismatch    = errors.New("password does not match")
+	ErrUnknownPasswordHash = errors.New("unknown password hash format")
+	ErrPasswordTooShort    = errors.New("password is too short")
+	ErrPasswordTooLong     = errors.New("password is too long")
+	ErrPasswordBreached    = errors.New("password appears in a list of breached passwords")
+)
+
+// PasswordHasher hashes passwords into self-describing strings. The
+// encoded hash carries the algorithm and its parameters, so hashes made
+// with older settings can still be verified and recognized as outdated.
+type PasswordHasher interface {
+	Hash(password string) (string, error)
+	// Verify returns ErrPasswordMismatch when the password is wrong.
+	Verify(encoded, password string) error
+	// Handles reports whether encoded was produced by this algorithm.
+	Handles(encoded string) bool
+	// NeedsRehash reports whether encoded uses different parameters than
+	// the hasher would use now.
+	NeedsRehash(encoded string) bool
+}
+
+// Argon2idHasher produces PHC strings such as
+// $argon2id$v=19$m=65536,t=3,p=4$<salt>$<key>.
+type Argon2idHasher struct {
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+	SaltLen int
+	KeyLen  uint32
+}
+
+func NewArgon2idHasher(memory, time uint32, threads uint8) *Argon2idHasher {
+	return &Argon2idHasher{Memory: memory, Time: time, Threads: threads, SaltLen: 16, KeyLen: 32}
+}
+
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, h.KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, h.Memory, h.Time, h.Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h *Argon2idHasher) Verify(encoded, password string) error {
+	p, err := parseArgon2id(encoded)
+	if err != nil {
+		return err
+	}
+	key := argon2.IDKey([]byte(password), p.salt, p.time, p.memory, p.threads, uint32(len(p.key)))
+	if subtle.ConstantTimeCompare(key, p.key) != 1 {
+		return ErrPasswordMismatch
+	}
+	return nil
+}
+
+func (h *Argon2idHasher) Handles(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func (h *Argon2idHasher) NeedsRehash(encoded string) bool {
+	p, err := parseArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return p.memory != h.Memory || p.time != h.Time || p.threads != h.Threads ||
+		len(p.salt) != h.SaltLen || uint32(len(p.key)) != h.KeyLen
+}
+
+func parseArgon2id(encoded string) (argon2Params, error) {
+	var p argon2Params
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return p, ErrUnknownPasswordHash
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return p, ErrUnknownPasswordHash
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil {
+		return p, ErrUnknownPasswordHash
+	}
+	var err error
+	if p.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return p, ErrUnknownPasswordHash
+	}
+	if p.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(p.key) == 0 {
+		return p, ErrUnknownPasswordHash
+	}
+	return p, nil
+}
+
+// BcryptHasher produces standard $2a$ bcrypt hashes.
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	return string(hash), err
+}
+
+func (h *BcryptHasher) Verify(encoded, password string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return ErrPasswordMismatch
+	}
+	return err
+}
+
+func (h *BcryptHasher) Handles(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func (h *BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.Cost
+}
+
+var (
+	hashersMu sync.RWMutex
+	// passwordHasher hashes new passwords; legacyHashers only verify.
+	passwordHasher PasswordHasher = NewArgon2idHasher(64*1024, 3, 4)
+	legacyHashers                 = []PasswordHasher{&BcryptHasher{Cost: bcrypt.DefaultCost}}
+)
+
+// ConfigurePasswordHasher selects the hasher for new passwords. The other
+// supported algorithms stay available for verifying existing hashes.
+func ConfigurePasswordHasher(cfg config.PasswordConfig) {
+	argon := NewArgon2idHasher(cfg.Argon2.Memory, cfg.Argon2.Time, cfg.Argon2.Threads)
+	bc := &BcryptHasher{Cost: cfg.BcryptCost}
+
+	hashersMu.Lock()
+	defer hashersMu.Unlock()
+	if cfg.Hasher == "bcrypt" {
+		passwordHasher, legacyHashers = bc, []PasswordHasher{argon}
+	} else {
+		passwordHasher, legacyHashers = argon, []PasswordHasher{bc}
+	}
+	log.Printf("Password hasher set to %s", cfg.Hasher)
+}
+
+func hasherFor(encoded string) (PasswordHasher, bool) {
+	hashersMu.RLock()
+	defer hashersMu.RUnlock()
+	if passwordHasher.Handles(encoded) {
+		return passwordHasher, true
+	}
+	for _, h := range legacyHashers {
+		if h.Handles(encoded) {
+			return h, false
+		}
+	}
+	return nil, false
+}
+
+// PasswordNeedsRehash reports whether a stored hash was made with another
+// algorithm or with outdated parameters and should be replaced.
+func PasswordNeedsRehash(encoded string) bool {
+	h, current := hasherFor(encoded)
+	return h == nil || !current || h.NeedsRehash(encoded)
+}
+
+// PasswordPolicy decides which new passwords are acceptable.
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	// breached holds upper-case SHA-1 hex digests of forbidden passwords.
+	breached map[string]struct{}
+}
+
+// NewPasswordPolicy builds the policy and loads the breached-password list,
+// if one is configured.
+func NewPasswordPolicy(cfg config.PasswordConfig) (*PasswordPolicy, error) {
+	policy := &PasswordPolicy{MinLength: cfg.MinLength, MaxLength: cfg.MaxLength, breached: map[string]struct{}{}}
+	if cfg.BreachedList == "" {
+		return policy, nil
+	}
+	f, err := os.Open(cfg.BreachedList)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		policy.AddBreached(scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	log.Printf("Loaded %d breached passwords", len(policy.breached))
+	return policy, nil
+}
+
+// AddBreached adds one line of a breached-password list: either a SHA-1
+// hex digest, optionally followed by ":count", or a plain password.
+func (p *PasswordPolicy) AddBreached(line string) {
+	line = strings.TrimRight(line, "\r\n")
+	if line == "" {
+		return
+	}
+	digest, _, _ := strings.Cut(line, ":")
+	if _, err := hex.DecodeString(digest); err != nil || len(digest) != 2*sha1.Size {
+		digest = sha1Hex(line)
+	}
+	p.breached[strings.ToUpper(digest)] = struct{}{}
+}
+
+// Check returns why password is not acceptable, or nil.
+func (p *PasswordPolicy) Check(password string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		return fmt.Errorf("%w: at least %d characters are required", ErrPasswordTooShort, p.MinLength)
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		return fmt.Errorf("%w: at most %d characters are allowed", ErrPasswordTooLong, p.MaxLength)
+	}
+	if _, found := p.breached[strings.ToUpper(sha1Hex(password))]; found {
+		return ErrPasswordBreached
+	}
+	return nil
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func isPasswordPolicyError(err error) bool {
+	return errors.Is(err, ErrPasswordTooShort) || errors.Is(err, ErrPasswordTooLong) || errors.Is(err, ErrPasswordBreached)
+}
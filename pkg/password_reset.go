@@ -0,0 +1,186 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+type PasswordResetService struct {
+	Tokens         TokenRepositoryInterface
+	UserService    *UserService
+	SessionService *SessionService
+	Mailer         Mailer
+	PublicURL      string
+	TTL            time.Duration
+	// Policy, when set, rejects weak new passwords before the token is
+	// used up.
+	Policy *PasswordPolicy
+}
+
+func NewPasswordResetService(tokens TokenRepositoryInterface, userService *UserService, sessionService *SessionService, mailer Mailer, publicURL string, ttl time.Duration) *PasswordResetService {
+	return &PasswordResetService{
+		Tokens:         tokens,
+		UserService:    userService,
+		SessionService: sessionService,
+		Mailer:         mailer,
+		PublicURL:      strings.TrimRight(publicURL, "/"),
+		TTL:            ttl,
+	}
+}
+
+// RequestReset mails a reset link to the user identified by email or
+// username. Unknown users are ignored without error so that the endpoint
+// does not reveal which accounts exist.
+func (s *PasswordResetService) RequestReset(ctx context.Context, identifier string) error {
+	var user User
+	var err error
+	if strings.Contains(identifier, "@") {
+		user, err = s.UserService.GetUserByEmail(identifier)
+	} else {
+		user, err = s.UserService.GetUserByUsername(identifier)
+	}
+	if err != nil || user.Email == "" {
+		log.Println("Password reset requested for unknown user or user without email")
+		return nil
+	}
+
+	userID := user.ID.Hex()
+	if err := s.Tokens.DeleteUserTokens(userID, TokenPurposePasswordReset); err != nil {
+		return err
+	}
+	raw, hash, err := newOpaqueToken()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	err = s.Tokens.CreateToken(OneTimeToken{
+		Hash:      hash,
+		Purpose:   TokenPurposePasswordReset,
+		UserID:    userID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.TTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	link := s.PublicURL + "/reset-password?token=" + url.QueryEscape(raw)
+	return s.Mailer.Send(ctx, MailMessage{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password. It expires in %s.\n\n%s\n\n"+
+			"If you did not request this, you can ignore this email.\n", user.Username, s.TTL, link),
+	})
+}
+
+// ResetPassword redeems a reset token, sets the new password and revokes
+// every existing session of the user.
+func (s *PasswordResetService) ResetPassword(raw, newPassword string) error {
+	if s.Policy != nil {
+		if err := s.Policy.Check(newPassword); err != nil {
+			return err
+		}
+	}
+	token, err := s.Tokens.ConsumeToken(TokenPurposePasswordReset, hashToken(raw), time.Now())
+	if err != nil {
+		return ErrInvalidToken
+	}
+	user, err := s.UserService.GetUserByID(token.UserID)
+	if err != nil {
+		return err
+	}
+	hashedPassword, err := HashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+	if _, err := s.UserService.UpdateUser(user.ID, bson.M{"password": hashedPassword, "password_reset_required": false}); err != nil {
+		return err
+	}
+	if err := s.Tokens.DeleteUserTokens(token.UserID, TokenPurposePasswordReset); err != nil {
+		log.Printf("Error deleting remaining reset tokens: %v", err)
+	}
+	if s.SessionService != nil {
+		return s.SessionService.RevokeUserSessions(token.UserID)
+	}
+	return nil
+}
+
+// ForgotPassword godoc
+//
+//	@Summary		Request a password reset
+//	@Description	Mail a single-use password reset link to the account's email address
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			input	body		object{login=string}	true	"Username or email"
+//	@Success		200		{object}	Response
+//	@Failure		400		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/auth/password/forgot [post]
+func (h *Handler) ForgotPassword(c *gin.Context) {
+	var input struct {
+		Login string `json:"login" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.PasswordResetService.RequestReset(c.Request.Context(), input.Login); err != nil {
+		log.Printf("Unable to start password reset: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to start password reset"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "If the account exists, a reset link has been sent"})
+}
+
+// ResetPassword godoc
+//
+//	@Summary		Reset a password
+//	@Description	Set a new password using a reset token and sign out all sessions
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			input	body		object{token=string,password=string}	true	"Reset token and new password"
+//	@Success		200		{object}	Response
+//	@Failure		400		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/auth/password/reset [post]
+func (h *Handler) ResetPassword(c *gin.Context) {
+	var input struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.PasswordResetService.ResetPassword(input.Token, input.Password)
+	if errors.Is(err, ErrInvalidToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+	if isPasswordPolicyError(err) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Unable to reset password: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to reset password"})
+		return
+	}
+	log.Println("Password reset successfully")
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
+}
@@ -0,0 +1,264 @@
+package pkg
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Takeso-user/blog-backend/config"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// tokenBucket is the state of one client under one policy. ExpiresAt is
+// when the bucket will be full again and can be forgotten.
+type tokenBucket struct {
+	Tokens    float64   `bson:"tokens"`
+	UpdatedAt time.Time `bson:"updated_at"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+func bucketCapacity(policy config.RateLimitPolicy) float64 {
+	if policy.Burst > 0 {
+		return float64(policy.Burst)
+	}
+	return float64(policy.Rate)
+}
+
+// take refills the bucket for the time elapsed since its last update and
+// tries to remove one token from it.
+func (b *tokenBucket) take(policy config.RateLimitPolicy, now time.Time) RateLimitResult {
+	capacity := bucketCapacity(policy)
+	perSecond := float64(policy.Rate) / policy.Period.Seconds()
+
+	if b.UpdatedAt.IsZero() {
+		b.Tokens = capacity
+	} else if elapsed := now.Sub(b.UpdatedAt).Seconds(); elapsed > 0 {
+		b.Tokens = math.Min(capacity, b.Tokens+elapsed*perSecond)
+	}
+	b.UpdatedAt = now
+
+	result := RateLimitResult{Limit: int(capacity)}
+	if b.Tokens >= 1 {
+		b.Tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - b.Tokens) / perSecond * float64(time.Second))
+	}
+	result.Remaining = int(b.Tokens)
+	result.Reset = time.Duration((capacity - b.Tokens) / perSecond * float64(time.Second))
+	b.ExpiresAt = now.Add(policy.Period + result.Reset)
+	return result
+}
+
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	takes   int
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]*tokenBucket)}
+}
+
+func (s *MemoryRateLimitStore) Take(_ context.Context, key string, policy config.RateLimitPolicy, now time.Time) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{}
+		s.buckets[key] = bucket
+	}
+	result := bucket.take(policy, now)
+
+	s.takes++
+	if s.takes%1000 == 0 {
+		s.prune(now)
+	}
+	return result, nil
+}
+
+// prune drops buckets that have been idle long enough to be full again, so
+// the map does not grow with every client ever seen. They expire like the
+// documents of MongoRateLimitStore.
+func (s *MemoryRateLimitStore) prune(now time.Time) {
+	for key, bucket := range s.buckets {
+		if !now.Before(bucket.ExpiresAt) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// MongoRateLimitStore keeps buckets in a shared collection so that limits
+// hold across replicas. Updates use optimistic concurrency on updated_at.
+type MongoRateLimitStore struct {
+	Collection *mongo.Collection
+}
+
+const mongoRateLimitRetries = 5
+
+func NewMongoRateLimitStore(collection *mongo.Collection) *MongoRateLimitStore {
+	_, err := collection.Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys:    bson.M{"expires_at": 1},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		log.Printf("Error creating rate limit TTL index: %v", err)
+	}
+	return &MongoRateLimitStore{Collection: collection}
+}
+
+func (s *MongoRateLimitStore) Take(ctx context.Context, key string, policy config.RateLimitPolicy, now time.Time) (RateLimitResult, error) {
+	for attempt := 0; attempt < mongoRateLimitRetries; attempt++ {
+		var bucket tokenBucket
+		err := s.Collection.FindOne(ctx, bson.M{"_id": key}).Decode(&bucket)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return RateLimitResult{}, err
+		}
+		found := err == nil
+		previous := bucket.UpdatedAt
+
+		result := bucket.take(policy, now)
+		doc := bson.M{
+			"tokens":     bucket.Tokens,
+			"updated_at": bucket.UpdatedAt,
+			"expires_at": bucket.ExpiresAt,
+		}
+
+		if !found {
+			doc["_id"] = key
+			_, err = s.Collection.InsertOne(ctx, doc)
+			if mongo.IsDuplicateKeyError(err) {
+				continue
+			}
+			return result, err
+		}
+
+		res, err := s.Collection.UpdateOne(ctx, bson.M{"_id": key, "updated_at": previous}, bson.M{"$set": doc})
+		if err != nil {
+			return RateLimitResult{}, err
+		}
+		if res.MatchedCount == 1 {
+			return result, nil
+		}
+	}
+	return RateLimitResult{}, errors.New("rate limit bucket is under contention")
+}
+
+type RateLimiter struct {
+	Store    RateLimitStore
+	Policies map[string]config.RateLimitPolicy
+	Enabled  bool
+}
+
+func NewRateLimiter(store RateLimitStore, cfg config.RateLimitConfig) *RateLimiter {
+	return &RateLimiter{Store: store, Policies: cfg.Policies, Enabled: cfg.Enabled}
+}
+
+// Middleware enforces the named policy. Requests from admins are never
+// limited, and unknown policy names leave the route unlimited.
+func (l *RateLimiter) Middleware(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if l == nil || !l.Enabled {
+			c.Next()
+			return
+		}
+		policy, ok := l.Policies[name]
+		if !ok {
+			c.Next()
+			return
+		}
+		if role, _ := c.Get("role"); role == "Admin" {
+			c.Next()
+			return
+		}
+
+		key := name + ":" + rateLimitKey(c, policy.Key)
+		result, err := l.Store.Take(c.Request.Context(), key, policy, time.Now())
+		if err != nil {
+			// Fail open: an unavailable store must not take the API down.
+			log.Printf("Rate limit store error: %v", err)
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+		if !result.Allowed {
+			log.Printf("Rate limit exceeded for %s", key)
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// Allow applies the named policy to subject, a value the handler takes from
+// the request body, such as an email address. Like Middleware it allows the
+// request when the limiter is disabled, the policy is unknown or the store
+// fails.
+func (l *RateLimiter) Allow(ctx context.Context, name, subject string) bool {
+	if l == nil || !l.Enabled {
+		return true
+	}
+	policy, ok := l.Policies[name]
+	if !ok {
+		return true
+	}
+	sum := sha256.Sum256([]byte(subject))
+	key := name + ":" + policy.Key + ":" + hex.EncodeToString(sum[:])
+	result, err := l.Store.Take(ctx, key, policy, time.Now())
+	if err != nil {
+		log.Printf("Rate limit store error: %v", err)
+		return true
+	}
+	if !result.Allowed {
+		log.Printf("Rate limit exceeded for %s", key)
+	}
+	return result.Allowed
+}
+
+func rateLimitKey(c *gin.Context, kind string) string {
+	switch kind {
+	case "user":
+		if username, ok := c.Get("username"); ok {
+			return "user:" + username.(string)
+		}
+	case "api_key":
+		apiKey := c.GetHeader("X-API-Key")
+		if apiKey == "" {
+			apiKey = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		}
+		if apiKey != "" {
+			sum := sha256.Sum256([]byte(apiKey))
+			return "key:" + hex.EncodeToString(sum[:])
+		}
+	}
+	return "ip:" + c.ClientIP()
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
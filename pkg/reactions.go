@@ -0,0 +1,519 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/Takeso-user/blog-backend/config"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	ReactionOnPost    = "post"
+	ReactionOnComment = "comment"
+)
+
+var (
+	ErrUnknownReaction        = errors.New("unknown reaction type")
+	ErrReactionTargetNotFound = errors.New("post or comment not found")
+)
+
+type ReactionRepository struct {
+	Collection *mongo.Collection
+}
+
+func NewReactionRepository(collection *mongo.Collection) *ReactionRepository {
+	_, err := collection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "target_type", Value: 1}, {Key: "target_id", Value: 1}}},
+		{Keys: bson.D{{Key: "target_type", Value: 1}, {Key: "target_id", Value: 1}}},
+	})
+	if err != nil {
+		log.Printf("Error creating reaction indexes: %v", err)
+	}
+	return &ReactionRepository{Collection: collection}
+}
+
+// SetReaction records the reaction, replacing the user's earlier reaction
+// to the same target, and returns the type of that earlier reaction, or ""
+// when there was none.
+func (r *ReactionRepository) SetReaction(reaction Reaction) (string, error) {
+	update := bson.M{
+		"$set": bson.M{"type": reaction.Type},
+		"$setOnInsert": bson.M{
+			"target_type": reaction.TargetType,
+			"target_id":   reaction.TargetID,
+			"user_id":     reaction.UserID,
+			"created_at":  reaction.CreatedAt,
+		},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before)
+	for attempt := 0; ; attempt++ {
+		var previous Reaction
+		err := r.Collection.FindOneAndUpdate(context.TODO(), bson.M{"_id": reaction.ID}, update, opts).Decode(&previous)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return "", nil
+		}
+		// Concurrent upserts of the same reaction race to insert it; the
+		// loser finds it on the second attempt.
+		if mongo.IsDuplicateKeyError(err) && attempt == 0 {
+			continue
+		}
+		if err != nil {
+			log.Printf("Error setting reaction: %v", err)
+			return "", err
+		}
+		return previous.Type, nil
+	}
+}
+
+// DeleteReaction removes the reaction if it is of reactionType and reports
+// whether it did.
+func (r *ReactionRepository) DeleteReaction(id, reactionType string) (bool, error) {
+	result, err := r.Collection.DeleteOne(context.TODO(), bson.M{"_id": id, "type": reactionType})
+	if err != nil {
+		log.Printf("Error deleting reaction: %v", err)
+		return false, err
+	}
+	return result.DeletedCount == 1, nil
+}
+
+// GetUserReactions maps each of the targets the user reacted to to the
+// type of their reaction.
+func (r *ReactionRepository) GetUserReactions(userID, targetType string, targetIDs []string) (map[string]string, error) {
+	reactions, err := r.find(bson.M{"user_id": userID, "target_type": targetType, "target_id": bson.M{"$in": targetIDs}})
+	if err != nil {
+		return nil, err
+	}
+	types := make(map[string]string, len(reactions))
+	for _, reaction := range reactions {
+		types[reaction.TargetID] = reaction.Type
+	}
+	return types, nil
+}
+
+func (r *ReactionRepository) GetReactionsByUser(userID string) ([]Reaction, error) {
+	return r.find(bson.M{"user_id": userID})
+}
+
+func (r *ReactionRepository) DeleteReactionsByTarget(targetType string, targetIDs []string) (int64, error) {
+	result, err := r.Collection.DeleteMany(context.TODO(), bson.M{"target_type": targetType, "target_id": bson.M{"$in": targetIDs}})
+	if err != nil {
+		log.Printf("Error deleting reactions: %v", err)
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+func (r *ReactionRepository) find(filter bson.M) ([]Reaction, error) {
+	opts := options.Find().SetSort(bson.M{"created_at": -1})
+	cursor, err := r.Collection.Find(context.TODO(), filter, opts)
+	if err != nil {
+		log.Printf("Error getting reactions: %v", err)
+		return nil, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Printf("Error closing cursor: %v", err)
+		}
+	}(cursor, context.TODO())
+
+	reactions := []Reaction{}
+	if err = cursor.All(context.TODO(), &reactions); err != nil {
+		log.Printf("Error decoding reactions: %v", err)
+		return nil, err
+	}
+	return reactions, nil
+}
+
+// ReactionService lets users react to posts and comments with one of the
+// configured reaction types. Each post and comment carries counters per
+// type, kept up to date with atomic increments as reactions change.
+type ReactionService struct {
+	Repository ReactionRepositoryInterface
+	Posts      *PostService
+	Comments   *CommentService
+	Types      []config.ReactionType
+	// Notifications, when set, tells authors about new reactions.
+	Notifications *NotificationService
+	// Events, when set, streams the new counts to the readers of the post.
+	Events *EventBus
+}
+
+func NewReactionService(repository ReactionRepositoryInterface, posts *PostService, comments *CommentService, cfg config.ReactionsConfig) *ReactionService {
+	return &ReactionService{Repository: repository, Posts: posts, Comments: comments, Types: cfg.Types}
+}
+
+func reactionID(targetType, targetID, userID string) string {
+	return targetType + ":" + targetID + ":" + userID
+}
+
+// React sets the user's reaction to the target, replacing the reaction
+// they had before. Reacting again with the same type changes nothing. It
+// returns the target's reaction counts.
+func (s *ReactionService) React(targetType, targetID, userID, reactionType string) (map[string]int64, error) {
+	if !slices.ContainsFunc(s.Types, func(t config.ReactionType) bool { return t.Name == reactionType }) {
+		return nil, ErrUnknownReaction
+	}
+	counts, err := s.counts(targetType, targetID)
+	if err != nil {
+		return nil, err
+	}
+	id := reactionID(targetType, targetID, userID)
+	previous, err := s.Repository.SetReaction(Reaction{
+		ID:         id,
+		TargetType: targetType,
+		TargetID:   targetID,
+		UserID:     userID,
+		Type:       reactionType,
+		CreatedAt:  time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if previous == reactionType {
+		return activeCounts(counts), nil
+	}
+	deltas := map[string]int{reactionType: 1}
+	if previous != "" {
+		deltas[previous] = -1
+	}
+	counts, err = s.increment(targetType, targetID, deltas)
+	if errors.Is(err, ErrReactionTargetNotFound) {
+		// The target was deleted meanwhile.
+		if _, err := s.Repository.DeleteReaction(id, reactionType); err != nil {
+			log.Printf("Error removing reaction to deleted %s: %v", targetType, err)
+		}
+	}
+	if err != nil {
+		return counts, err
+	}
+	// Changing a reaction is not news to the author.
+	if previous == "" && s.Notifications != nil {
+		s.Notifications.Reacted(targetType, targetID, userID)
+	}
+	s.publishReactions(targetType, targetID, counts)
+	return counts, nil
+}
+
+// Unreact removes the user's reaction of reactionType from the target, if
+// they have one, and returns the target's reaction counts.
+func (s *ReactionService) Unreact(targetType, targetID, userID, reactionType string) (map[string]int64, error) {
+	counts, err := s.counts(targetType, targetID)
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := s.Repository.DeleteReaction(reactionID(targetType, targetID, userID), reactionType)
+	if err != nil {
+		return nil, err
+	}
+	if !deleted {
+		return activeCounts(counts), nil
+	}
+	counts, err = s.increment(targetType, targetID, map[string]int{reactionType: -1})
+	if err != nil {
+		return counts, err
+	}
+	s.publishReactions(targetType, targetID, counts)
+	return counts, nil
+}
+
+// RemoveUserReactions withdraws all reactions of a user, for instance when
+// their account is deleted.
+func (s *ReactionService) RemoveUserReactions(userID string) error {
+	reactions, err := s.Repository.GetReactionsByUser(userID)
+	if err != nil {
+		return err
+	}
+	for _, reaction := range reactions {
+		deleted, err := s.Repository.DeleteReaction(reaction.ID, reaction.Type)
+		if err != nil {
+			return err
+		}
+		if !deleted {
+			continue
+		}
+		_, err = s.increment(reaction.TargetType, reaction.TargetID, map[string]int{reaction.Type: -1})
+		if err != nil && !errors.Is(err, ErrReactionTargetNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// MarkPosts sets MyReaction on the posts the user reacted to.
+func (s *ReactionService) MarkPosts(userID string, posts []Post) error {
+	ids := make([]string, len(posts))
+	for i, post := range posts {
+		ids[i] = post.ID.Hex()
+	}
+	mine, err := s.Repository.GetUserReactions(userID, ReactionOnPost, ids)
+	if err != nil {
+		return err
+	}
+	for i := range posts {
+		posts[i].MyReaction = mine[ids[i]]
+		posts[i].Reactions = activeCounts(posts[i].Reactions)
+	}
+	return nil
+}
+
+// MarkComments sets MyReaction on the comments the user reacted to.
+func (s *ReactionService) MarkComments(userID string, comments []Comment) error {
+	ids := make([]string, len(comments))
+	for i, comment := range comments {
+		ids[i] = comment.ID.Hex()
+	}
+	mine, err := s.Repository.GetUserReactions(userID, ReactionOnComment, ids)
+	if err != nil {
+		return err
+	}
+	for i := range comments {
+		comments[i].MyReaction = mine[ids[i]]
+		comments[i].Reactions = activeCounts(comments[i].Reactions)
+	}
+	return nil
+}
+
+func (s *ReactionService) counts(targetType, targetID string) (map[string]int64, error) {
+	var counts map[string]int64
+	var err error
+	switch targetType {
+	case ReactionOnPost:
+		var post Post
+		post, err = s.Posts.Repository.GetPostByID(targetID)
+		counts = post.Reactions
+	case ReactionOnComment:
+		var comment Comment
+		comment, err = s.Comments.Repository.GetCommentByID(targetID)
+		counts = comment.Reactions
+	default:
+		return nil, ErrReactionTargetNotFound
+	}
+	if err != nil {
+		return nil, reactionTargetError(err)
+	}
+	return counts, nil
+}
+
+func (s *ReactionService) increment(targetType, targetID string, deltas map[string]int) (map[string]int64, error) {
+	var counts map[string]int64
+	var err error
+	switch targetType {
+	case ReactionOnPost:
+		counts, err = s.Posts.Repository.IncrementPostReactions(targetID, deltas)
+		s.Posts.Cache.Delete(targetID)
+	case ReactionOnComment:
+		counts, err = s.Comments.Repository.IncrementCommentReactions(targetID, deltas)
+	default:
+		return nil, ErrReactionTargetNotFound
+	}
+	if err != nil {
+		return nil, reactionTargetError(err)
+	}
+	return activeCounts(counts), nil
+}
+
+func reactionTargetError(err error) error {
+	if errors.Is(err, mongo.ErrNoDocuments) || errors.Is(err, primitive.ErrInvalidHex) {
+		return ErrReactionTargetNotFound
+	}
+	return err
+}
+
+// activeCounts leaves out the reaction types nobody uses any more.
+func activeCounts(counts map[string]int64) map[string]int64 {
+	active := map[string]int64{}
+	for reaction, count := range counts {
+		if count > 0 {
+			active[reaction] = count
+		}
+	}
+	return active
+}
+
+func ReactionsExportSection(reactionService *ReactionService) ExportSection {
+	return ExportSection{Name: "reactions", Title: "Reactions", Collect: func(user User) (interface{}, error) {
+		return reactionService.Repository.GetReactionsByUser(user.ID.Hex())
+	}}
+}
+
+// releaseReactions removes the reactions to a deleted post.
+func (s *PostService) releaseReactions(postIDs ...string) {
+	if s.Reactions == nil {
+		return
+	}
+	if _, err := s.Reactions.DeleteReactionsByTarget(ReactionOnPost, postIDs); err != nil {
+		log.Printf("Error deleting reactions to posts %v: %v", postIDs, err)
+	}
+}
+
+// releaseReactions removes the reactions to deleted comments.
+func (s *CommentService) releaseReactions(commentIDs ...string) {
+	if s.Reactions == nil {
+		return
+	}
+	if _, err := s.Reactions.DeleteReactionsByTarget(ReactionOnComment, commentIDs); err != nil {
+		log.Printf("Error deleting reactions to comments %v: %v", commentIDs, err)
+	}
+}
+
+// markPosts fills in the current user's reactions. Posts are still shown
+// when that fails.
+func (h *Handler) markPosts(c *gin.Context, posts []Post) {
+	if h.ReactionService == nil || len(posts) == 0 {
+		return
+	}
+	user, err := h.UserService.GetUserByUsername(c.GetString("username"))
+	if err == nil {
+		err = h.ReactionService.MarkPosts(user.ID.Hex(), posts)
+	}
+	if err != nil {
+		log.Printf("Unable to mark reactions: %v", err)
+	}
+}
+
+// markComments fills in the current user's reactions. Comments are still
+// shown when that fails.
+func (h *Handler) markComments(c *gin.Context, comments []Comment) {
+	if h.ReactionService == nil || len(comments) == 0 {
+		return
+	}
+	user, err := h.UserService.GetUserByUsername(c.GetString("username"))
+	if err == nil {
+		err = h.ReactionService.MarkComments(user.ID.Hex(), comments)
+	}
+	if err != nil {
+		log.Printf("Unable to mark reactions: %v", err)
+	}
+}
+
+// GetReactionTypes godoc
+//
+//	@Summary		List reaction types
+//	@Description	List the reactions that can be left on posts and comments, as configured in reactions.types
+//	@Security		ApiKeyAuth
+//	@Tags			reactions
+//	@Produce		json
+//	@Success		200	{array}	config.ReactionType
+//	@Router			/api/reactions [get]
+func (h *Handler) GetReactionTypes(c *gin.Context) {
+	c.JSON(http.StatusOK, h.ReactionService.Types)
+}
+
+// ReactToPost godoc
+//
+//	@Summary		React to a post
+//	@Description	Set the user's reaction to a post, replacing the reaction they had before. Repeating the request changes nothing.
+//	@Security		ApiKeyAuth
+//	@Tags			reactions
+//	@Produce		json
+//	@Param			id		path		string	true	"Post ID"
+//	@Param			type	path		string	true	"Reaction type"
+//	@Success		200		{object}	Response
+//	@Failure		400		{object}	Response
+//	@Failure		404		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/api/posts/{id}/reactions/{type} [put]
+func (h *Handler) ReactToPost(c *gin.Context) {
+	h.react(c, ReactionOnPost, c.Param("id"))
+}
+
+// RemovePostReaction godoc
+//
+//	@Summary		Remove a reaction from a post
+//	@Description	Remove the user's reaction of the given type from a post. Repeating the request changes nothing.
+//	@Security		ApiKeyAuth
+//	@Tags			reactions
+//	@Produce		json
+//	@Param			id		path		string	true	"Post ID"
+//	@Param			type	path		string	true	"Reaction type"
+//	@Success		200		{object}	Response
+//	@Failure		404		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/api/posts/{id}/reactions/{type} [delete]
+func (h *Handler) RemovePostReaction(c *gin.Context) {
+	h.unreact(c, ReactionOnPost, c.Param("id"))
+}
+
+// ReactToComment godoc
+//
+//	@Summary		React to a comment
+//	@Description	Set the user's reaction to a comment, replacing the reaction they had before. Repeating the request changes nothing.
+//	@Security		ApiKeyAuth
+//	@Tags			reactions
+//	@Produce		json
+//	@Param			commentID	path		string	true	"Comment ID"
+//	@Param			type		path		string	true	"Reaction type"
+//	@Success		200			{object}	Response
+//	@Failure		400			{object}	Response
+//	@Failure		404			{object}	Response
+//	@Failure		500			{object}	Response
+//	@Router			/api/posts/comments/{commentID}/reactions/{type} [put]
+func (h *Handler) ReactToComment(c *gin.Context) {
+	h.react(c, ReactionOnComment, c.Param("commentID"))
+}
+
+// RemoveCommentReaction godoc
+//
+//	@Summary		Remove a reaction from a comment
+//	@Description	Remove the user's reaction of the given type from a comment. Repeating the request changes nothing.
+//	@Security		ApiKeyAuth
+//	@Tags			reactions
+//	@Produce		json
+//	@Param			commentID	path		string	true	"Comment ID"
+//	@Param			type		path		string	true	"Reaction type"
+//	@Success		200			{object}	Response
+//	@Failure		404			{object}	Response
+//	@Failure		500			{object}	Response
+//	@Router			/api/posts/comments/{commentID}/reactions/{type} [delete]
+func (h *Handler) RemoveCommentReaction(c *gin.Context) {
+	h.unreact(c, ReactionOnComment, c.Param("commentID"))
+}
+
+func (h *Handler) react(c *gin.Context, targetType, targetID string) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	reactionType := c.Param("type")
+	counts, err := h.ReactionService.React(targetType, targetID, user.ID.Hex(), reactionType)
+	if err != nil {
+		reactionError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"reactions": counts, "my_reaction": reactionType})
+}
+
+func (h *Handler) unreact(c *gin.Context, targetType, targetID string) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	counts, err := h.ReactionService.Unreact(targetType, targetID, user.ID.Hex(), c.Param("type"))
+	if err != nil {
+		reactionError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"reactions": counts})
+}
+
+func reactionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrUnknownReaction):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrReactionTargetNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Unable to update reaction: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to update reaction"})
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"log"
+	"strings"
+	"time"
 )
 
 type PostRepository struct {
@@ -22,9 +24,40 @@ type CommentRepository struct {
 }
 
 func NewUserRepository(collection *mongo.Collection) *UserRepository {
+	_, err := collection.Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys: bson.M{"email": 1},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"email": bson.M{"$type": "string"}}),
+	})
+	if err != nil {
+		log.Printf("Error creating unique email index: %v", err)
+	}
+	_, err = collection.Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys: bson.D{{Key: "identities.provider", Value: 1}, {Key: "identities.subject", Value: 1}},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{"identities.subject": bson.M{"$exists": true}}),
+	})
+	if err != nil {
+		log.Printf("Error creating unique identity index: %v", err)
+	}
+	_, err = collection.Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys:    bson.M{"username": 1},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Printf("Error creating unique username index: %v", err)
+	}
 	return &UserRepository{Collection: collection}
 }
 
+// isDuplicateUsername reports whether err is a write refused by the unique
+// username index.
+func isDuplicateUsername(err error) bool {
+	return mongo.IsDuplicateKeyError(err) && strings.Contains(err.Error(), "username_1")
+}
+
 func (r *UserRepository) CreateUser(user User) error {
 	log.Println("Creating user:", user.Username)
 	_, err := r.Collection.InsertOne(context.TODO(), user)
@@ -61,6 +94,82 @@ func (r *UserRepository) GetUserByID(userID string) (User, error) {
 	return user, err
 }
 
+func (r *UserRepository) GetUserByEmail(email string) (User, error) {
+	log.Println("Getting user by email")
+	var user User
+	err := r.Collection.FindOne(context.TODO(), bson.M{"email": email}).Decode(&user)
+	if err != nil {
+		log.Printf("Error getting user by email: %v", err)
+	}
+	return user, err
+}
+
+func (r *UserRepository) GetUserByIdentity(provider, subject string) (User, error) {
+	log.Println("Getting user by identity:", provider)
+	var user User
+	filter := bson.M{"identities": bson.M{"$elemMatch": bson.M{"provider": provider, "subject": subject}}}
+	err := r.Collection.FindOne(context.TODO(), filter).Decode(&user)
+	if err != nil {
+		log.Printf("Error getting user by identity: %v", err)
+	}
+	return user, err
+}
+
+func (r *UserRepository) UpdateUser(id primitive.ObjectID, updateFields bson.M) (User, error) {
+	log.Println("Updating user by ID:", id.Hex())
+	var updatedUser User
+	err := r.Collection.FindOneAndUpdate(
+		context.TODO(),
+		bson.M{"_id": id},
+		bson.M{"$set": updateFields},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updatedUser)
+	if err != nil {
+		log.Printf("Error updating user: %v", err)
+	}
+	return updatedUser, err
+}
+
+// UseTOTPStep records step as the user's last used TOTP time step, unless
+// that step or a later one was already used. It reports whether the step
+// was recorded, so that of two concurrent logins with the same code only
+// one succeeds.
+func (r *UserRepository) UseTOTPStep(id primitive.ObjectID, step int64) (bool, error) {
+	filter := bson.M{"_id": id, "$or": bson.A{
+		bson.M{"totp_last_step": bson.M{"$lt": step}},
+		bson.M{"totp_last_step": bson.M{"$exists": false}},
+	}}
+	result, err := r.Collection.UpdateOne(context.TODO(), filter, bson.M{"$set": bson.M{"totp_last_step": step}})
+	if err != nil {
+		log.Printf("Error recording TOTP step: %v", err)
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// UseRecoveryCode removes the recovery code with the given hash and
+// reports whether the user still had it.
+func (r *UserRepository) UseRecoveryCode(id primitive.ObjectID, hash string) (bool, error) {
+	result, err := r.Collection.UpdateOne(context.TODO(),
+		bson.M{"_id": id, "recovery_codes": hash},
+		bson.M{"$pull": bson.M{"recovery_codes": hash}},
+	)
+	if err != nil {
+		log.Printf("Error using recovery code: %v", err)
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+func (r *UserRepository) DeleteUser(id primitive.ObjectID) error {
+	log.Println("Deleting user by ID:", id.Hex())
+	_, err := r.Collection.DeleteOne(context.TODO(), bson.M{"_id": id})
+	if err != nil {
+		log.Printf("Error deleting user: %v", err)
+	}
+	return err
+}
+
 func (r *UserRepository) GetUsers() ([]User, error) {
 	log.Println("Getting all users")
 	cursor, err := r.Collection.Find(context.TODO(), bson.M{})
@@ -83,7 +192,45 @@ func (r *UserRepository) GetUsers() ([]User, error) {
 	return users, nil
 }
 
+// SearchUsers returns one page of the users matching filter, sorted by
+// username, and the total number of matches.
+func (r *UserRepository) SearchUsers(filter UserFilter) ([]User, int64, error) {
+	log.Println("Searching users")
+	query := filter.bson(time.Now())
+	total, err := r.Collection.CountDocuments(context.TODO(), query)
+	if err != nil {
+		log.Printf("Error counting users: %v", err)
+		return nil, 0, err
+	}
+	opts := options.Find().SetSort(bson.M{"username": 1}).SetSkip(filter.Offset).SetLimit(filter.Limit)
+	cursor, err := r.Collection.Find(context.TODO(), query, opts)
+	if err != nil {
+		log.Printf("Error searching users: %v", err)
+		return nil, 0, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Printf("Error closing cursor: %v", err)
+		}
+	}(cursor, context.TODO())
+
+	users := []User{}
+	if err = cursor.All(context.TODO(), &users); err != nil {
+		log.Printf("Error decoding users: %v", err)
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
 func NewPostRepository(collection *mongo.Collection) *PostRepository {
+	_, err := collection.Indexes().CreateMany(context.TODO(), []mongo.IndexModel{
+		{Keys: bson.D{{Key: "author_id", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+		{Keys: bson.D{{Key: "tags", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+	})
+	if err != nil {
+		log.Printf("Error creating post indexes: %v", err)
+	}
 	return &PostRepository{Collection: collection}
 }
 
@@ -162,6 +309,106 @@ func (r *PostRepository) UpdatePost(id primitive.ObjectID, updateFields bson.M)
 	return updatedPost, err
 }
 
+func (r *PostRepository) GetPostsByAuthor(authorID string) ([]Post, error) {
+	log.Println("Getting posts by author:", authorID)
+	cursor, err := r.Collection.Find(context.TODO(), bson.M{"author_id": authorID})
+	if err != nil {
+		log.Printf("Error getting posts: %v", err)
+		return nil, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Printf("Error closing cursor: %v", err)
+		}
+	}(cursor, context.TODO())
+
+	var posts []Post
+	if err = cursor.All(context.TODO(), &posts); err != nil {
+		log.Printf("Error decoding posts: %v", err)
+		return nil, err
+	}
+	return posts, nil
+}
+
+// GetPostsByIDs returns the posts that exist among ids, in no particular
+// order.
+func (r *PostRepository) GetPostsByIDs(ids []string) ([]Post, error) {
+	objectIDs := make([]primitive.ObjectID, 0, len(ids))
+	for _, id := range ids {
+		if objectID, err := primitive.ObjectIDFromHex(id); err == nil {
+			objectIDs = append(objectIDs, objectID)
+		}
+	}
+	cursor, err := r.Collection.Find(context.TODO(), bson.M{"_id": bson.M{"$in": objectIDs}})
+	if err != nil {
+		log.Printf("Error getting posts: %v", err)
+		return nil, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Printf("Error closing cursor: %v", err)
+		}
+	}(cursor, context.TODO())
+
+	var posts []Post
+	if err = cursor.All(context.TODO(), &posts); err != nil {
+		log.Printf("Error decoding posts: %v", err)
+		return nil, err
+	}
+	return posts, nil
+}
+
+// GetFeedPosts returns the posts matching query, newest first.
+func (r *PostRepository) GetFeedPosts(query FeedQuery) ([]Post, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}).
+		SetLimit(query.Limit)
+	cursor, err := r.Collection.Find(context.TODO(), query.bson(), opts)
+	if err != nil {
+		log.Printf("Error getting feed posts: %v", err)
+		return nil, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Printf("Error closing cursor: %v", err)
+		}
+	}(cursor, context.TODO())
+
+	var posts []Post
+	if err = cursor.All(context.TODO(), &posts); err != nil {
+		log.Printf("Error decoding posts: %v", err)
+		return nil, err
+	}
+	return posts, nil
+}
+
+func (r *PostRepository) UpdatePostsByAuthor(authorID string, updateFields bson.M) (int64, error) {
+	log.Println("Updating posts by author:", authorID)
+	result, err := r.Collection.UpdateMany(context.TODO(), bson.M{"author_id": authorID}, bson.M{"$set": updateFields})
+	if err != nil {
+		log.Printf("Error updating posts: %v", err)
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+func (r *PostRepository) DeletePostsByAuthor(authorID string) (int64, error) {
+	log.Println("Deleting posts by author:", authorID)
+	result, err := r.Collection.DeleteMany(context.TODO(), bson.M{"author_id": authorID})
+	if err != nil {
+		log.Printf("Error deleting posts: %v", err)
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+func (r *PostRepository) IncrementPostReactions(id string, deltas map[string]int) (map[string]int64, error) {
+	return incrementReactions(r.Collection, id, deltas)
+}
+
 func NewCommentRepository(collection *mongo.Collection) *CommentRepository {
 	return &CommentRepository{Collection: collection}
 }
@@ -222,6 +469,21 @@ func (r *CommentRepository) GetAllComment() ([]Comment, error) {
 	return comments, nil
 }
 
+func (r *CommentRepository) GetCommentByID(id string) (Comment, error) {
+	log.Println("Getting comment by ID:", id)
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		log.Printf("Error converting commentID to ObjectID: %v", err)
+		return Comment{}, err
+	}
+	var comment Comment
+	err = r.Collection.FindOne(context.TODO(), bson.M{"_id": objectID}).Decode(&comment)
+	if err != nil {
+		log.Printf("Error getting comment: %v", err)
+	}
+	return comment, err
+}
+
 func (r *CommentRepository) DeleteComment(id string) error {
 	log.Println("Deleting comment by ID:", id)
 	objectID, err := primitive.ObjectIDFromHex(id)
@@ -250,3 +512,76 @@ func (r *CommentRepository) UpdateComment(ctx context.Context, filter, update bs
 	}
 	return updatedComment, err
 }
+
+func (r *CommentRepository) GetCommentsByUser(userID string) ([]Comment, error) {
+	log.Println("Getting comments by user:", userID)
+	opts := options.Find().SetSort(bson.M{"created_at": 1})
+	cursor, err := r.Collection.Find(context.TODO(), bson.M{"user_id": userID}, opts)
+	if err != nil {
+		log.Printf("Error getting comments: %v", err)
+		return nil, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Printf("Error closing cursor: %v", err)
+		}
+	}(cursor, context.TODO())
+
+	var comments []Comment
+	if err = cursor.All(context.TODO(), &comments); err != nil {
+		log.Printf("Error decoding comments: %v", err)
+		return nil, err
+	}
+	return comments, nil
+}
+
+func (r *CommentRepository) UpdateCommentsByUser(userID string, updateFields bson.M) (int64, error) {
+	log.Println("Updating comments by user:", userID)
+	result, err := r.Collection.UpdateMany(context.TODO(), bson.M{"user_id": userID}, bson.M{"$set": updateFields})
+	if err != nil {
+		log.Printf("Error updating comments: %v", err)
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+func (r *CommentRepository) DeleteCommentsByUser(userID string) (int64, error) {
+	log.Println("Deleting comments by user:", userID)
+	result, err := r.Collection.DeleteMany(context.TODO(), bson.M{"user_id": userID})
+	if err != nil {
+		log.Printf("Error deleting comments: %v", err)
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+func (r *CommentRepository) IncrementCommentReactions(id string, deltas map[string]int) (map[string]int64, error) {
+	return incrementReactions(r.Collection, id, deltas)
+}
+
+// incrementReactions atomically adds deltas to the reaction counters of a
+// post or comment and returns the counters after the update.
+func incrementReactions(collection *mongo.Collection, id string, deltas map[string]int) (map[string]int64, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	inc := bson.M{}
+	for reaction, delta := range deltas {
+		inc["reactions."+reaction] = delta
+	}
+	var target struct {
+		Reactions map[string]int64 `bson:"reactions"`
+	}
+	err = collection.FindOneAndUpdate(
+		context.TODO(),
+		bson.M{"_id": objectID},
+		bson.M{"$inc": inc},
+		options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.M{"reactions": 1}),
+	).Decode(&target)
+	if err != nil {
+		log.Printf("Error updating reaction counts: %v", err)
+	}
+	return target.Reactions, err
+}
@@ -0,0 +1,219 @@
+// Package s3test provides an in-process stand-in for an S3-compatible object
+// store for tests. It serves a single bucket with path-style addressing and
+// supports putting (including aws-chunked streaming uploads), getting,
+// heading and deleting objects. Requests must be signed with the server's
+// access key; signatures themselves are not checked.
+package s3test
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type object struct {
+	data        []byte
+	contentType string
+	etag        string
+	modified    time.Time
+}
+
+type Server struct {
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+
+	server *httptest.Server
+
+	mu      sync.Mutex
+	objects map[string]object
+}
+
+// NewServer starts a server holding one empty bucket. Call Close when done.
+func NewServer(bucket string) *Server {
+	s := &Server{
+		Bucket:    bucket,
+		Region:    "us-east-1",
+		AccessKey: "s3test-access",
+		SecretKey: "s3test-secret",
+		objects:   map[string]object{},
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Endpoint is the host:port to point an S3 client at, without a scheme.
+func (s *Server) Endpoint() string {
+	u, _ := url.Parse(s.server.URL)
+	return u.Host
+}
+
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Object returns the stored bytes of key.
+func (s *Server) Object(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.objects[key]
+	return obj.data, ok
+}
+
+// Len is the number of objects in the bucket.
+func (s *Server) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.objects)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential="+s.AccessKey+"/") {
+		writeError(w, r, http.StatusForbidden, "AccessDenied", "Access Denied")
+		return
+	}
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != s.Bucket {
+		writeError(w, r, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		return
+	}
+	if key == "" {
+		if _, ok := r.URL.Query()["location"]; ok && r.Method == http.MethodGet {
+			w.Header().Set("Content-Type", "application/xml")
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?><LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">%s</LocationConstraint>`, s.Region)
+			return
+		}
+		writeError(w, r, http.StatusNotImplemented, "NotImplemented", "Bucket operations are not supported")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		s.put(w, r, key)
+	case http.MethodGet, http.MethodHead:
+		s.get(w, r, key)
+	case http.MethodDelete:
+		s.mu.Lock()
+		delete(s.objects, key)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed")
+	}
+}
+
+func (s *Server) put(w http.ResponseWriter, r *http.Request, key string) {
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+		body = &chunkedReader{r: bufio.NewReader(r.Body)}
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	if decoded := r.Header.Get("X-Amz-Decoded-Content-Length"); decoded != "" && decoded != strconv.Itoa(len(data)) {
+		writeError(w, r, http.StatusBadRequest, "IncompleteBody", "body does not match X-Amz-Decoded-Content-Length")
+		return
+	}
+	sum := md5.Sum(data)
+	obj := object{
+		data:        data,
+		contentType: r.Header.Get("Content-Type"),
+		etag:        `"` + hex.EncodeToString(sum[:]) + `"`,
+		modified:    time.Now().UTC().Truncate(time.Second),
+	}
+	s.mu.Lock()
+	s.objects[key] = obj
+	s.mu.Unlock()
+	w.Header().Set("ETag", obj.etag)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) get(w http.ResponseWriter, r *http.Request, key string) {
+	s.mu.Lock()
+	obj, ok := s.objects[key]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+		return
+	}
+	if obj.contentType != "" {
+		w.Header().Set("Content-Type", obj.contentType)
+	}
+	w.Header().Set("ETag", obj.etag)
+	http.ServeContent(w, r, "", obj.modified, bytes.NewReader(obj.data))
+}
+
+// chunkedReader decodes an aws-chunked body: hex-sized chunks, each with a
+// chunk signature, ending with an empty chunk and optional trailers.
+type chunkedReader struct {
+	r         *bufio.Reader
+	remaining int64
+	done      bool
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	if c.done {
+		return 0, io.EOF
+	}
+	if c.remaining == 0 {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return 0, io.ErrUnexpectedEOF
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimRight(line, "\r\n"), ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid chunk size %q", sizeHex)
+		}
+		if size == 0 {
+			c.done = true
+			return 0, io.EOF
+		}
+		c.remaining = size
+	}
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.r.Read(p)
+	c.remaining -= int64(n)
+	if c.remaining == 0 {
+		if _, err := c.r.Discard(2); err != nil {
+			return n, io.ErrUnexpectedEOF
+		}
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+type errorResponse struct {
+	XMLName  xml.Name `xml:"Error"`
+	Code     string   `xml:"Code"`
+	Message  string   `xml:"Message"`
+	Resource string   `xml:"Resource"`
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	if r.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_ = xml.NewEncoder(w).Encode(errorResponse{Code: code, Message: message, Resource: r.URL.Path})
+}
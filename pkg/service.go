@@ -2,9 +2,12 @@ package pkg
 
 import (
 	"context"
+	"errors"
 	"github.com/Takeso-user/in-mem-cache/cache"
+	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 	"log"
 	"time"
 )
@@ -12,6 +15,21 @@ import (
 type PostService struct {
 	Repository PostRepositoryInterface
 	Cache      *cache.Cache
+	Renderer   *Renderer
+	// Slugs, when set, gives posts slugs and keeps their history.
+	Slugs SlugRepositoryInterface
+	// Media, when set, tracks which uploads each post uses.
+	Media *MediaService
+	// Reactions, when set, are removed along with the post.
+	Reactions ReactionRepositoryInterface
+	// Bookmarks, when set, are flagged when the post is deleted.
+	Bookmarks BookmarkRepositoryInterface
+	// Feed, when set, keeps its cache of recent posts up to date.
+	Feed *FeedService
+	// Notifications, when set, tells users they were mentioned.
+	Notifications *NotificationService
+	// Events, when set, streams changes to the post to its readers.
+	Events *EventBus
 }
 
 type UserService struct {
@@ -23,14 +41,23 @@ type CommentService struct {
 	Repository  CommentRepositoryInterface
 	UserService *UserService
 	Cache       *cache.Cache
+	Renderer    *Renderer
+	// Reactions, when set, are removed along with the comment.
+	Reactions ReactionRepositoryInterface
+	// Notifications, when set, tells users about new comments, replies
+	// and mentions.
+	Notifications *NotificationService
+	// Events, when set, streams new, edited and deleted comments to the
+	// readers of the post.
+	Events *EventBus
 }
 
 func NewPostService(repository PostRepositoryInterface, cache *cache.Cache) *PostService {
-	return &PostService{Repository: repository, Cache: cache}
+	return &PostService{Repository: repository, Cache: cache, Renderer: NewPostRenderer()}
 }
 
 func NewCommentService(repository CommentRepositoryInterface, userService *UserService, cache *cache.Cache) *CommentService {
-	return &CommentService{Repository: repository, UserService: userService, Cache: cache}
+	return &CommentService{Repository: repository, UserService: userService, Cache: cache, Renderer: NewCommentRenderer()}
 }
 
 func NewUserService(repository UserRepositoryInterface, cache *cache.Cache) *UserService {
@@ -57,6 +84,7 @@ func (s *UserService) GetUserByUsername(username string) (User, error) {
 	user, err := s.Repository.GetUserByUsername(username)
 	if err != nil {
 		log.Printf("Error getting user by username: %v", err)
+		return user, err
 	}
 	s.Cache.Set(username, user)
 	return user, err
@@ -77,6 +105,76 @@ func (s *UserService) GetUserByID(userID string) (User, error) {
 	return user, err
 }
 
+func (s *UserService) GetUserByEmail(email string) (User, error) {
+	log.Println("Getting user by email")
+	user, err := s.Repository.GetUserByEmail(email)
+	if err != nil {
+		log.Printf("Error getting user by email: %v", err)
+	}
+	return user, err
+}
+
+func (s *UserService) GetUserByIdentity(provider, subject string) (User, error) {
+	log.Println("Getting user by identity:", provider)
+	user, err := s.Repository.GetUserByIdentity(provider, subject)
+	if err != nil {
+		log.Printf("Error getting user by identity: %v", err)
+	}
+	return user, err
+}
+
+func (s *UserService) UpdateUser(id primitive.ObjectID, updateFields bson.M) (User, error) {
+	log.Println("Updating user by ID:", id.Hex())
+	user, err := s.Repository.UpdateUser(id, updateFields)
+	if err != nil {
+		log.Printf("Error updating user: %v", err)
+		return User{}, err
+	}
+	s.InvalidateUser(user)
+	return user, nil
+}
+
+func (s *UserService) DeleteUser(user User) error {
+	log.Println("Deleting user by ID:", user.ID.Hex())
+	if err := s.Repository.DeleteUser(user.ID); err != nil {
+		log.Printf("Error deleting user: %v", err)
+		return err
+	}
+	s.InvalidateUser(user)
+	return nil
+}
+
+// UseTOTPStep marks the TOTP time step used. It returns false when the
+// step, or a later one, was used already.
+func (s *UserService) UseTOTPStep(user User, step int64) (bool, error) {
+	used, err := s.Repository.UseTOTPStep(user.ID, step)
+	if err != nil {
+		log.Printf("Error recording TOTP step: %v", err)
+		return false, err
+	}
+	s.InvalidateUser(user)
+	return used, nil
+}
+
+// UseRecoveryCode removes a recovery code by its hash. It returns false
+// when the user no longer has the code.
+func (s *UserService) UseRecoveryCode(user User, hash string) (bool, error) {
+	used, err := s.Repository.UseRecoveryCode(user.ID, hash)
+	if err != nil {
+		log.Printf("Error using recovery code: %v", err)
+		return false, err
+	}
+	s.InvalidateUser(user)
+	return used, nil
+}
+
+// InvalidateUser drops cached copies of the user so the next lookup sees
+// the updated document.
+func (s *UserService) InvalidateUser(user User) {
+	s.Cache.Delete(user.Username)
+	s.Cache.Delete(user.ID.Hex())
+}
+
 func (s *UserService) GetUsers() ([]User, error) {
 	log.Println("Getting all users")
 	users, err := s.Repository.GetUsers()
@@ -86,20 +184,44 @@ func (s *UserService) GetUsers() ([]User, error) {
 	return users, err
 }
 
-func (s *PostService) CreatePost(title, content, authorID string) error {
+func (s *PostService) CreatePost(title, content, authorID string, tags ...string) error {
 	log.Println("Creating post:", title)
+	tags, err := normalizeTags(tags)
+	if err != nil {
+		return err
+	}
+	rendered, err := s.Renderer.Render(content)
+	if err != nil {
+		log.Printf("Error rendering post: %v", err)
+		return err
+	}
 	post := Post{
 		ID:        primitive.NewObjectID(),
 		Title:     title,
 		Content:   content,
 		AuthorID:  authorID,
+		Tags:      tags,
 		CreatedAt: time.Now(),
 	}
-	err := s.Repository.CreatePost(post)
+	post.setRendered(rendered)
+	if s.Slugs != nil {
+		if post.Slug, err = s.assignSlug(post.ID, title); err != nil {
+			log.Printf("Error assigning slug: %v", err)
+			return err
+		}
+	}
+	err = s.Repository.CreatePost(post)
 	if err != nil {
 		log.Printf("Error creating post: %v", err)
+		s.releaseSlugs(post.ID.Hex())
+		return err
 	}
-	return err
+	s.linkMedia(post.ID.Hex(), authorID, content)
+	if s.Feed != nil {
+		s.Feed.Publish(post)
+	}
+	s.notifyMentions(post, "")
+	return nil
 }
 
 func (s *PostService) GetPosts() ([]Post, error) {
@@ -128,11 +250,27 @@ func (s *PostService) GetPostById(id string) (Post, error) {
 
 func (s *PostService) DeletePost(id string) error {
 	log.Println("Deleting post by ID:", id)
+	var author string
+	if s.Feed != nil || s.Events != nil {
+		if post, err := s.Repository.GetPostByID(id); err == nil {
+			author = post.AuthorID
+		}
+	}
 	err := s.Repository.DeletePost(id)
 	if err != nil {
 		log.Printf("Error deleting post: %v", err)
+		return err
 	}
-	return err
+	if s.Feed != nil {
+		s.Feed.Forget(author)
+	}
+	s.releaseSlugs(id)
+	s.releaseMedia(id)
+	s.releaseReactions(id)
+	s.releaseBookmarks(id)
+	s.Cache.Delete(id)
+	s.publishPost(EventPostDeleted, id, gin.H{"id": id})
+	return nil
 }
 
 func (s *PostService) UpdatePost(id primitive.ObjectID, input Post) (Post, error) {
@@ -146,8 +284,36 @@ func (s *PostService) UpdatePost(id primitive.ObjectID, input Post) (Post, error
 	if input.Title != "" {
 		updateFields["title"] = input.Title
 	}
+	if input.Tags != nil {
+		tags, err := normalizeTags(input.Tags)
+		if err != nil {
+			return Post{}, err
+		}
+		updateFields["tags"] = tags
+	}
+	if s.Slugs != nil && (input.Title != "" || currentPost.Slug == "") {
+		title := input.Title
+		if title == "" {
+			title = currentPost.Title
+		}
+		slug, err := s.assignSlug(id, title)
+		if err != nil {
+			log.Printf("Error assigning slug: %v", err)
+			return Post{}, err
+		}
+		updateFields["slug"] = slug
+	}
 	if input.Content != "" {
+		rendered, err := s.Renderer.Render(input.Content)
+		if err != nil {
+			log.Printf("Error rendering post: %v", err)
+			return Post{}, err
+		}
 		updateFields["content"] = input.Content
+		updateFields["content_html"] = rendered.HTML
+		updateFields["toc"] = rendered.TOC
+		updateFields["word_count"] = rendered.WordCount
+		updateFields["reading_time"] = ReadingTime(rendered.WordCount)
 	}
 	updateFields["author_id"] = currentPost.AuthorID
 	updateFields["created_at"] = currentPost.CreatedAt
@@ -156,29 +322,68 @@ func (s *PostService) UpdatePost(id primitive.ObjectID, input Post) (Post, error
 		log.Printf("Error updating post: %v", err)
 		return Post{}, err
 	}
+	s.Cache.Delete(id.Hex())
+	if s.Feed != nil {
+		s.Feed.Forget(updatedPost.AuthorID)
+	}
+	if input.Content != "" {
+		s.linkMedia(id.Hex(), updatedPost.AuthorID, input.Content)
+		s.notifyMentions(updatedPost, currentPost.Content)
+	}
+	s.publishPost(EventPostUpdated, id.Hex(), s.Present(updatedPost, ""))
 	log.Printf("Updated post: %v", updatedPost)
 	return updatedPost, nil
 }
 
 func (s *CommentService) AddComment(postID, userID, content string) error {
 	log.Println("Adding comment to post:", postID)
+	return s.addComment(postID, "", userID, content)
+}
+
+// AddReply adds a comment that replies to another comment on the same
+// post.
+func (s *CommentService) AddReply(postID, parentID, userID, content string) error {
+	log.Println("Adding reply to comment:", parentID)
+	parent, err := s.Repository.GetCommentByID(parentID)
+	if errors.Is(err, mongo.ErrNoDocuments) || errors.Is(err, primitive.ErrInvalidHex) || (err == nil && parent.PostID != postID) {
+		return ErrCommentNotFound
+	}
+	if err != nil {
+		log.Printf("Error getting comment: %v", err)
+		return err
+	}
+	return s.addComment(postID, parentID, userID, content)
+}
+
+func (s *CommentService) addComment(postID, parentID, userID, content string) error {
 	user, err := s.UserService.GetUserByID(userID)
 	if err != nil {
 		log.Printf("Error getting user by ID: %v", err)
 		return err
 	}
+	rendered, err := s.Renderer.Render(content)
+	if err != nil {
+		log.Printf("Error rendering comment: %v", err)
+		return err
+	}
 	comment := Comment{
-		PostID:    postID,
-		UserID:    userID,
-		Username:  user.Username,
-		Content:   content,
-		CreatedAt: time.Now(),
+		ID:          primitive.NewObjectID(),
+		PostID:      postID,
+		ParentID:    parentID,
+		UserID:      userID,
+		Username:    user.Username,
+		Content:     content,
+		ContentHTML: rendered.HTML,
+		CreatedAt:   time.Now(),
 	}
 	err = s.Repository.AddComment(comment)
 	if err != nil {
 		log.Printf("Error adding comment: %v", err)
+		return err
 	}
-	return err
+	s.publishComment(EventCommentCreated, postID, s.Present(comment, ""))
+	s.notifyComment(comment)
+	return nil
 }
 
 func (s *CommentService) GetComments(postID string) ([]Comment, error) {
@@ -199,21 +404,47 @@ func (s *CommentService) GetAllComment() ([]Comment, error) {
 	return comments, err
 }
 
+func (s *CommentService) GetCommentByID(id string) (Comment, error) {
+	log.Println("Getting comment by ID:", id)
+	comment, err := s.Repository.GetCommentByID(id)
+	if err != nil {
+		log.Printf("Error getting comment: %v", err)
+	}
+	return comment, err
+}
+
 func (s *CommentService) DeleteComment(id string) error {
 	log.Println("Deleting comment by ID:", id)
+	var postID string
+	if s.Events != nil {
+		if comment, err := s.Repository.GetCommentByID(id); err == nil {
+			postID = comment.PostID
+		}
+	}
 	err := s.Repository.DeleteComment(id)
 	if err != nil {
 		log.Printf("Error deleting comment: %v", err)
+		return err
 	}
-	return err
+	s.releaseReactions(id)
+	if postID != "" {
+		s.publishComment(EventCommentDeleted, postID, gin.H{"id": id, "post_id": postID})
+	}
+	return nil
 }
 
 func (s *CommentService) UpdateComment(id primitive.ObjectID, input Comment) (Comment, error) {
 	log.Println("Updating comment by ID:", id.Hex())
+	rendered, err := s.Renderer.Render(input.Content)
+	if err != nil {
+		log.Printf("Error rendering comment: %v", err)
+		return Comment{}, err
+	}
 	filter := bson.M{"_id": id}
 	update := bson.M{
 		"$set": bson.M{
-			"content": input.Content,
+			"content":      input.Content,
+			"content_html": rendered.HTML,
 		},
 	}
 	updatedComment, err := s.Repository.UpdateComment(context.TODO(), filter, update)
@@ -222,5 +453,57 @@ func (s *CommentService) UpdateComment(id primitive.ObjectID, input Comment) (Co
 		return Comment{}, err
 	}
 	log.Printf("Updated comment: %v", updatedComment)
+	s.publishComment(EventCommentUpdated, updatedComment.PostID, s.Present(updatedComment, ""))
 	return updatedComment, nil
 }
+
+// Present shapes the post for the requested content format. Posts stored
+// before rendering was added are rendered on the way out.
+func (s *PostService) Present(post Post, format string) Post {
+	if post.ContentHTML == "" && post.Content != "" {
+		if rendered, err := s.Renderer.Render(post.Content); err == nil {
+			post.setRendered(rendered)
+		}
+	}
+	post.Content, post.ContentHTML = selectContent(format, post.Content, post.ContentHTML)
+	return post
+}
+
+// Present shapes the comment for the requested content format.
+func (s *CommentService) Present(comment Comment, format string) Comment {
+	if comment.ContentHTML == "" && comment.Content != "" {
+		if rendered, err := s.Renderer.Render(comment.Content); err == nil {
+			comment.ContentHTML = rendered.HTML
+		}
+	}
+	comment.Content, comment.ContentHTML = selectContent(format, comment.Content, comment.ContentHTML)
+	return comment
+}
+
+func (p *Post) setRendered(rendered Rendered) {
+	p.ContentHTML = rendered.HTML
+	p.TOC = rendered.TOC
+	p.WordCount = rendered.WordCount
+	p.ReadingTime = ReadingTime(rendered.WordCount)
+}
+
+// linkMedia records the uploads the post refers to. A failure only means
+// that dropped media is collected later or kept longer than needed.
+func (s *PostService) linkMedia(postID, author, content string) {
+	if s.Media == nil {
+		return
+	}
+	if err := s.Media.LinkPost(postID, author, content); err != nil {
+		log.Printf("Error linking media of post %s: %v", postID, err)
+	}
+}
+
+// releaseMedia removes the uploads only the deleted post used.
+func (s *PostService) releaseMedia(postID string) {
+	if s.Media == nil {
+		return
+	}
+	if err := s.Media.ReleasePost(postID); err != nil {
+		log.Printf("Error releasing media of post %s: %v", postID, err)
+	}
+}
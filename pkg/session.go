@@ -0,0 +1,172 @@
+package pkg
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type SessionRepository struct {
+	Collection *mongo.Collection
+}
+
+func NewSessionRepository(collection *mongo.Collection) *SessionRepository {
+	return &SessionRepository{Collection: collection}
+}
+
+func (r *SessionRepository) CreateSession(session Session) error {
+	log.Println("Creating session for user:", session.UserID)
+	_, err := r.Collection.InsertOne(context.TODO(), session)
+	if err != nil {
+		log.Printf("Error creating session: %v", err)
+	}
+	return err
+}
+
+func (r *SessionRepository) GetSessionByID(sessionID string) (Session, error) {
+	var session Session
+	objectID, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		log.Printf("Error converting sessionID to ObjectID: %v", err)
+		return session, err
+	}
+	err = r.Collection.FindOne(context.TODO(), bson.M{"_id": objectID}).Decode(&session)
+	if err != nil {
+		log.Printf("Error getting session by ID: %v", err)
+	}
+	return session, err
+}
+
+func (r *SessionRepository) GetUserSessions(userID string) ([]Session, error) {
+	log.Println("Getting sessions for user:", userID)
+	opts := options.Find().SetSort(bson.M{"created_at": -1})
+	cursor, err := r.Collection.Find(context.TODO(), bson.M{"user_id": userID}, opts)
+	if err != nil {
+		log.Printf("Error getting sessions: %v", err)
+		return nil, err
+	}
+	defer func(cursor *mongo.Cursor, ctx context.Context) {
+		err := cursor.Close(ctx)
+		if err != nil {
+			log.Printf("Error closing cursor: %v", err)
+		}
+	}(cursor, context.TODO())
+
+	sessions := []Session{}
+	if err = cursor.All(context.TODO(), &sessions); err != nil {
+		log.Printf("Error decoding sessions: %v", err)
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (r *SessionRepository) RevokeSession(sessionID string, now time.Time) error {
+	log.Println("Revoking session:", sessionID)
+	objectID, err := primitive.ObjectIDFromHex(sessionID)
+	if err != nil {
+		log.Printf("Error converting sessionID to ObjectID: %v", err)
+		return err
+	}
+	_, err = r.Collection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": objectID, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": now}},
+	)
+	if err != nil {
+		log.Printf("Error revoking session: %v", err)
+	}
+	return err
+}
+
+func (r *SessionRepository) RevokeUserSessions(userID string, now time.Time) error {
+	log.Println("Revoking all sessions for user:", userID)
+	_, err := r.Collection.UpdateMany(
+		context.TODO(),
+		bson.M{"user_id": userID, "revoked_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"revoked_at": now}},
+	)
+	if err != nil {
+		log.Printf("Error revoking sessions: %v", err)
+	}
+	return err
+}
+
+// SessionService records every issued login token so that it can be
+// revoked before it expires.
+type SessionService struct {
+	Repository SessionRepositoryInterface
+
+	// Events, when set, ends the open streams of a user whose sessions are
+	// all revoked.
+	Events *EventBus
+}
+
+func NewSessionService(repository SessionRepositoryInterface) *SessionService {
+	return &SessionService{Repository: repository}
+}
+
+func (s *SessionService) CreateSession(user User, ip, userAgent string) (Session, error) {
+	now := time.Now()
+	session := Session{
+		ID:        primitive.NewObjectID(),
+		UserID:    user.ID.Hex(),
+		IP:        ip,
+		UserAgent: userAgent,
+		CreatedAt: now,
+		ExpiresAt: now.Add(jwtTTL),
+	}
+	if err := s.Repository.CreateSession(session); err != nil {
+		return Session{}, err
+	}
+	return session, nil
+}
+
+// CreateImpersonationSession records a session an admin opens as user. It
+// expires after impersonationTTL.
+func (s *SessionService) CreateImpersonationSession(user User, impersonator, ip, userAgent string) (Session, error) {
+	now := time.Now()
+	session := Session{
+		ID:           primitive.NewObjectID(),
+		UserID:       user.ID.Hex(),
+		IP:           ip,
+		UserAgent:    userAgent,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(impersonationTTL),
+		Impersonator: impersonator,
+	}
+	if err := s.Repository.CreateSession(session); err != nil {
+		return Session{}, err
+	}
+	return session, nil
+}
+
+func (s *SessionService) IsActive(sessionID string, now time.Time) bool {
+	session, err := s.Repository.GetSessionByID(sessionID)
+	if err != nil {
+		return false
+	}
+	return session.RevokedAt == nil && now.Before(session.ExpiresAt)
+}
+
+func (s *SessionService) GetUserSessions(userID string) ([]Session, error) {
+	return s.Repository.GetUserSessions(userID)
+}
+
+func (s *SessionService) RevokeSession(sessionID string) error {
+	return s.Repository.RevokeSession(sessionID, time.Now())
+}
+
+func (s *SessionService) RevokeUserSessions(userID string) error {
+	if err := s.Repository.RevokeUserSessions(userID, time.Now()); err != nil {
+		return err
+	}
+	if s.Events != nil {
+		s.Events.DropUser(userID)
+	}
+	return nil
+}
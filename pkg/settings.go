@@ -0,0 +1,47 @@
+package pkg
+
+import (
+	"context"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SettingsRepository stores runtime-adjustable settings as one document per
+// key in the form {_id: key, value: ...}.
+type SettingsRepository struct {
+	Collection *mongo.Collection
+}
+
+func NewSettingsRepository(collection *mongo.Collection) *SettingsRepository {
+	return &SettingsRepository{Collection: collection}
+}
+
+func (r *SettingsRepository) GetSetting(key string, out interface{}) error {
+	log.Println("Getting setting:", key)
+	var doc struct {
+		Value bson.RawValue `bson:"value"`
+	}
+	err := r.Collection.FindOne(context.TODO(), bson.M{"_id": key}).Decode(&doc)
+	if err != nil {
+		log.Printf("Error getting setting: %v", err)
+		return err
+	}
+	return doc.Value.Unmarshal(out)
+}
+
+func (r *SettingsRepository) SaveSetting(key string, value interface{}) error {
+	log.Println("Saving setting:", key)
+	_, err := r.Collection.UpdateOne(
+		context.TODO(),
+		bson.M{"_id": key},
+		bson.M{"$set": bson.M{"value": value}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		log.Printf("Error saving setting: %v", err)
+	}
+	return err
+}
@@ -0,0 +1,175 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gosimple/slug"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	maxSlugLength = 80
+	// maxSlugSuffix bounds the "-2", "-3", ... candidates tried for a taken
+	// slug before falling back to the post ID.
+	maxSlugSuffix = 50
+	fallbackSlug  = "post"
+)
+
+var ErrPostNotFound = errors.New("post not found")
+
+type SlugRepository struct {
+	Collection *mongo.Collection
+}
+
+// NewSlugRepository stores every slug ever handed out, keyed by the slug
+// itself, so the unique _id is what settles collisions.
+func NewSlugRepository(collection *mongo.Collection) *SlugRepository {
+	_, err := collection.Indexes().CreateOne(context.TODO(), mongo.IndexModel{Keys: bson.M{"post_id": 1}})
+	if err != nil {
+		log.Printf("Error creating post slug index: %v", err)
+	}
+	return &SlugRepository{Collection: collection}
+}
+
+func (r *SlugRepository) CreatePostSlug(slug PostSlug) error {
+	_, err := r.Collection.InsertOne(context.TODO(), slug)
+	if err != nil && !mongo.IsDuplicateKeyError(err) {
+		log.Printf("Error creating post slug: %v", err)
+	}
+	return err
+}
+
+func (r *SlugRepository) GetPostSlug(slug string) (PostSlug, error) {
+	var postSlug PostSlug
+	err := r.Collection.FindOne(context.TODO(), bson.M{"_id": slug}).Decode(&postSlug)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		log.Printf("Error getting post slug: %v", err)
+	}
+	return postSlug, err
+}
+
+func (r *SlugRepository) DeletePostSlugs(postID string) (int64, error) {
+	result, err := r.Collection.DeleteMany(context.TODO(), bson.M{"post_id": postID})
+	if err != nil {
+		log.Printf("Error deleting post slugs: %v", err)
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+// Slugify turns a title into a lowercase ASCII slug, transliterating other
+// scripts ("Привет, мир" becomes "privet-mir"). Titles with nothing to keep
+// get "post", and a slug that would read as a post ID gets a "post-"
+// prefix so that /api/posts/:id stays unambiguous.
+func Slugify(title string) string {
+	s := slug.Make(title)
+	if len(s) > maxSlugLength {
+		s = s[:maxSlugLength]
+		if cut := strings.LastIndexByte(s, '-'); cut > 0 {
+			s = s[:cut]
+		}
+	}
+	s = strings.Trim(s, "-")
+	if s == "" {
+		return fallbackSlug
+	}
+	if primitive.IsValidObjectID(s) {
+		return fallbackSlug + "-" + s
+	}
+	return s
+}
+
+// assignSlug claims a slug for the title on behalf of the post. A slug the
+// post already holds, current or earlier, is reused; one held by another
+// post gets a numeric suffix.
+func (s *PostService) assignSlug(postID primitive.ObjectID, title string) (string, error) {
+	base := Slugify(title)
+	for n := 1; n <= maxSlugSuffix+1; n++ {
+		candidate := base
+		switch {
+		case n > maxSlugSuffix:
+			candidate = base + "-" + postID.Hex()
+		case n > 1:
+			candidate = fmt.Sprintf("%s-%d", base, n)
+		}
+		err := s.Slugs.CreatePostSlug(PostSlug{Slug: candidate, PostID: postID.Hex(), CreatedAt: time.Now()})
+		if err == nil {
+			return candidate, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return "", err
+		}
+		owner, err := s.Slugs.GetPostSlug(candidate)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return "", err
+		}
+		if owner.PostID == postID.Hex() {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("no free slug for %q", title)
+}
+
+// GetPostByIDOrSlug looks a post up by ObjectID or by any slug it has had.
+// Callers compare the returned post's Slug with the one they asked for to
+// tell an old slug from the current one.
+func (s *PostService) GetPostByIDOrSlug(idOrSlug string) (Post, error) {
+	if s.Slugs == nil || primitive.IsValidObjectID(idOrSlug) {
+		return s.GetPostById(idOrSlug)
+	}
+	log.Println("Getting post by slug:", idOrSlug)
+	postSlug, err := s.Slugs.GetPostSlug(idOrSlug)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Post{}, ErrPostNotFound
+	}
+	if err != nil {
+		return Post{}, err
+	}
+	post, err := s.GetPostById(postSlug.PostID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Post{}, ErrPostNotFound
+	}
+	return post, err
+}
+
+// BackfillSlugs gives a slug to posts created before slugs existed.
+func (s *PostService) BackfillSlugs() error {
+	if s.Slugs == nil {
+		return nil
+	}
+	posts, err := s.Repository.GetPosts()
+	if err != nil {
+		return err
+	}
+	for _, post := range posts {
+		if post.Slug != "" {
+			continue
+		}
+		postSlug, err := s.assignSlug(post.ID, post.Title)
+		if err != nil {
+			return err
+		}
+		if _, err := s.Repository.UpdatePost(post.ID, bson.M{"slug": postSlug}); err != nil {
+			return err
+		}
+		s.Cache.Delete(post.ID.Hex())
+	}
+	return nil
+}
+
+// releaseSlugs frees the slugs of a deleted post for reuse.
+func (s *PostService) releaseSlugs(postID string) {
+	if s.Slugs == nil {
+		return
+	}
+	if _, err := s.Slugs.DeletePostSlugs(postID); err != nil {
+		log.Printf("Error releasing slugs of post %s: %v", postID, err)
+	}
+}
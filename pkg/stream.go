@@ -0,0 +1,329 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Takeso-user/blog-backend/config"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/net/websocket"
+)
+
+const TokenPurposeStreamTicket = "stream_ticket"
+
+var ErrTooManyStreamPosts = errors.New("too many posts to follow")
+
+// streamRetry is how long browsers wait before reconnecting a dropped
+// stream.
+const streamRetry = 3 * time.Second
+
+// StreamService opens streams of real-time events. A stream carries the
+// changes to the posts the client follows and the user's own
+// notifications.
+type StreamService struct {
+	Bus      *EventBus
+	Posts    *PostService
+	Users    *UserService
+	Tokens   TokenRepositoryInterface
+	Sessions *SessionService
+	Config   config.EventsConfig
+}
+
+func NewStreamService(bus *EventBus, posts *PostService, users *UserService, tokens TokenRepositoryInterface, sessions *SessionService, cfg config.EventsConfig) *StreamService {
+	return &StreamService{Bus: bus, Posts: posts, Users: users, Tokens: tokens, Sessions: sessions, Config: cfg}
+}
+
+// CreateTicket issues a short-lived, single-use ticket that opens a stream
+// as the user of the request. Browsers need one because EventSource and
+// WebSocket can't send the Authorization header.
+func (s *StreamService) CreateTicket(c *gin.Context, user User) (string, error) {
+	raw, hash, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	data := map[string]string{"session_id": c.GetString("session_id")}
+	if c.GetBool("mfa") {
+		data["mfa"] = "true"
+	}
+	if impersonator := c.GetString("impersonator"); impersonator != "" {
+		data["impersonator"] = impersonator
+	}
+	now := time.Now()
+	err = s.Tokens.CreateToken(OneTimeToken{
+		Hash:      hash,
+		Purpose:   TokenPurposeStreamTicket,
+		UserID:    user.ID.Hex(),
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.Config.TicketTTL),
+		Data:      data,
+	})
+	if err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// RedeemTicket authenticates the request with a stream ticket, setting
+// what JWTMiddleware would have.
+func (s *StreamService) RedeemTicket(c *gin.Context, raw string) error {
+	ticket, err := s.Tokens.ConsumeToken(TokenPurposeStreamTicket, hashToken(raw), time.Now())
+	if err != nil {
+		return ErrInvalidToken
+	}
+	sessionID := ticket.Data["session_id"]
+	if s.Sessions != nil && sessionID != "" && !s.Sessions.IsActive(sessionID, time.Now()) {
+		return ErrInvalidToken
+	}
+	user, err := s.Users.GetUserByID(ticket.UserID)
+	if err != nil {
+		return ErrInvalidToken
+	}
+	c.Set("user_id", ticket.UserID)
+	c.Set("session_id", sessionID)
+	c.Set("username", user.Username)
+	c.Set("role", user.Role)
+	c.Set("mfa", ticket.Data["mfa"] == "true")
+	if impersonator := ticket.Data["impersonator"]; impersonator != "" {
+		c.Set("impersonator", impersonator)
+	}
+	return nil
+}
+
+// Open subscribes the user to the given posts, by ID or slug, and to their
+// notifications. See EventBus.Subscribe for lastEventID.
+func (s *StreamService) Open(user User, posts []string, lastEventID string) (*Subscription, []Event, bool, error) {
+	if len(posts) > s.Config.MaxPosts {
+		return nil, nil, false, ErrTooManyStreamPosts
+	}
+	userID := user.ID.Hex()
+	topics := []string{UserTopic(userID)}
+	for _, idOrSlug := range posts {
+		post, err := s.Posts.GetPostByIDOrSlug(idOrSlug)
+		if errors.Is(err, mongo.ErrNoDocuments) || errors.Is(err, primitive.ErrInvalidHex) {
+			return nil, nil, false, ErrPostNotFound
+		}
+		if err != nil {
+			return nil, nil, false, err
+		}
+		topics = append(topics, PostTopic(post.ID.Hex()))
+	}
+	return s.Bus.Subscribe(userID, topics, lastEventID)
+}
+
+// Active reports whether a stream the user opened with the session may stay
+// open: the session has not been revoked or expired and the user is not
+// suspended or banned. Streams opened with an access token have no session.
+func (s *StreamService) Active(user User, sessionID string, now time.Time) bool {
+	if s.Sessions != nil && sessionID != "" && !s.Sessions.IsActive(sessionID, now) {
+		return false
+	}
+	current, err := s.Users.GetUserByID(user.ID.Hex())
+	return err == nil && !current.Restriction.ActiveAt(now)
+}
+
+// StreamAuthMiddleware authenticates stream requests by the ticket query
+// parameter when there is one, and otherwise with auth.
+func StreamAuthMiddleware(streams *StreamService, auth gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ticket := c.Query("ticket")
+		if ticket == "" {
+			auth(c)
+			return
+		}
+		if err := streams.RedeemTicket(c, ticket); err != nil {
+			log.Printf("Invalid stream ticket: %v", err)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired ticket"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func streamError(c *gin.Context, action string, err error) {
+	switch {
+	case errors.Is(err, ErrPostNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrTooManyStreamPosts):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrTooManyStreams):
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	default:
+		log.Printf("Unable to %s: %v", action, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to " + action})
+	}
+}
+
+// CreateStreamTicket godoc
+//
+//	@Summary		Create a stream ticket
+//	@Description	Issue a single-use ticket for opening GET /api/stream?ticket=... from a browser, which can't send the Authorization header with EventSource or WebSocket. The ticket expires after events.ticket_ttl.
+//	@Security		ApiKeyAuth
+//	@Tags			stream
+//	@Produce		json
+//	@Success		201	{object}	Response
+//	@Failure		500	{object}	Response
+//	@Router			/api/stream/tickets [post]
+func (h *Handler) CreateStreamTicket(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	ticket, err := h.StreamService.CreateTicket(c, user)
+	if err != nil {
+		streamError(c, "create ticket", err)
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"ticket": ticket, "expires_in": int(h.StreamService.Config.TicketTTL.Seconds())})
+}
+
+// Stream godoc
+//
+//	@Summary		Stream real-time updates
+//	@Description	Push new, edited and deleted comments, post changes and reaction counts of the followed posts, and the user's new notifications, as Server-Sent Events. Requests with Upgrade: websocket get the same events as JSON messages over a WebSocket instead. Clients that reconnect with the Last-Event-ID header, or the last_event_id parameter, first get the events they missed; a "reset" event means those are gone and the client should reload.
+//	@Security		ApiKeyAuth
+//	@Tags			stream
+//	@Produce		text/event-stream
+//	@Param			posts			query		string	false	"Comma-separated IDs or slugs of the posts to follow"
+//	@Param			ticket			query		string	false	"Stream ticket, instead of the Authorization header"
+//	@Param			last_event_id	query		string	false	"ID of the last event received"
+//	@Param			Last-Event-ID	header		string	false	"ID of the last event received"
+//	@Success		200				{string}	string
+//	@Failure		400				{object}	Response
+//	@Failure		401				{object}	Response
+//	@Failure		404				{object}	Response
+//	@Failure		429				{object}	Response
+//	@Router			/api/stream [get]
+func (h *Handler) Stream(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	var posts []string
+	for _, post := range strings.Split(c.Query("posts"), ",") {
+		if post = strings.TrimSpace(post); post != "" {
+			posts = append(posts, post)
+		}
+	}
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+	sub, replay, missed, err := h.StreamService.Open(user, posts, lastEventID)
+	if err != nil {
+		streamError(c, "open stream", err)
+		return
+	}
+	defer sub.Close()
+	if missed {
+		replay = append([]Event{{Type: EventReset}}, replay...)
+	}
+	if c.IsWebsocket() {
+		h.streamWebSocket(c, user, sub, replay)
+		return
+	}
+	h.streamSSE(c, user, sub, replay)
+}
+
+// streamSSE and streamWebSocket check on every heartbeat that the stream
+// may stay open, so one whose session ended while it was open is closed.
+func (h *Handler) streamSSE(c *gin.Context, user User, sub *Subscription, replay []Event) {
+	// Streams outlive the server's timeouts.
+	rc := http.NewResponseController(c.Writer)
+	if err := errors.Join(rc.SetReadDeadline(time.Time{}), rc.SetWriteDeadline(time.Time{})); err != nil {
+		log.Printf("Unable to clear stream deadlines: %v", err)
+	}
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	fmt.Fprintf(c.Writer, "retry: %d\n\n", streamRetry.Milliseconds())
+	for _, event := range replay {
+		writeSSE(c.Writer, event)
+	}
+	c.Writer.Flush()
+
+	sessionID := c.GetString("session_id")
+	heartbeat := time.NewTicker(h.StreamService.Config.Heartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case event := <-sub.Events():
+			writeSSE(c.Writer, event)
+		case <-heartbeat.C:
+			if !h.StreamService.Active(user, sessionID, time.Now()) {
+				return
+			}
+			io.WriteString(c.Writer, ": ping\n\n")
+		case <-sub.Done():
+			return
+		case <-c.Request.Context().Done():
+			return
+		}
+		c.Writer.Flush()
+	}
+}
+
+func writeSSE(w io.Writer, event Event) {
+	if event.ID != "" {
+		fmt.Fprintf(w, "id: %s\n", event.ID)
+	}
+	data := event.Data
+	if data == nil {
+		data = []byte("{}")
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+}
+
+func (h *Handler) streamWebSocket(c *gin.Context, user User, sub *Subscription, replay []Event) {
+	// WebSocket clients need not send an Origin header, and ones that do
+	// still authenticate with a token or ticket rather than a cookie, so
+	// any origin is accepted.
+	server := websocket.Server{Handler: func(ws *websocket.Conn) {
+		if err := ws.SetDeadline(time.Time{}); err != nil {
+			log.Printf("Unable to clear stream deadline: %v", err)
+		}
+		// Clients have nothing to say; reading only notices when they
+		// hang up.
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			io.Copy(io.Discard, ws)
+		}()
+		for _, event := range replay {
+			if websocket.JSON.Send(ws, event) != nil {
+				return
+			}
+		}
+		sessionID := c.GetString("session_id")
+		heartbeat := time.NewTicker(h.StreamService.Config.Heartbeat)
+		defer heartbeat.Stop()
+		for {
+			var err error
+			select {
+			case event := <-sub.Events():
+				err = websocket.JSON.Send(ws, event)
+			case <-heartbeat.C:
+				if !h.StreamService.Active(user, sessionID, time.Now()) {
+					return
+				}
+				err = websocket.JSON.Send(ws, Event{Type: "ping"})
+			case <-sub.Done():
+				return
+			case <-closed:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}}
+	server.ServeHTTP(c.Writer, c.Request)
+}
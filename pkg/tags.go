@@ -0,0 +1,42 @@
+package pkg
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+)
+
+const maxPostTags = 10
+
+var (
+	ErrInvalidTag  = errors.New("tags must be 1 to 32 lowercase letters, digits or hyphens")
+	ErrTooManyTags = errors.New("a post can have at most 10 tags")
+)
+
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// NormalizeTag lowercases a tag and trims surrounding space and a leading
+// '#'.
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+}
+
+// normalizeTags normalizes and deduplicates tags, keeping their order.
+func normalizeTags(tags []string) ([]string, error) {
+	normalized := make([]string, 0, len(tags))
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = NormalizeTag(tag)
+		if !tagPattern.MatchString(tag) {
+			return nil, ErrInvalidTag
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	if len(normalized) > maxPostTags {
+		return nil, ErrTooManyTags
+	}
+	return normalized, nil
+}
@@ -0,0 +1,147 @@
+package tests
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Takeso-user/blog-backend/pkg"
+	"github.com/Takeso-user/blog-backend/pkg/mocks"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func Test_AccessTokenService_CreateToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockTokenRepo := mocks.NewMockAccessTokenRepositoryInterface(ctrl)
+	service := pkg.NewAccessTokenService(mockTokenRepo, nil)
+	user := pkg.User{ID: primitive.NewObjectID(), Username: "ci"}
+
+	var stored pkg.AccessToken
+	mockTokenRepo.EXPECT().GetUserAccessTokens(user.ID.Hex()).Return([]pkg.AccessToken{}, nil)
+	mockTokenRepo.EXPECT().CreateAccessToken(gomock.Any()).DoAndReturn(func(token pkg.AccessToken) error {
+		stored = token
+		return nil
+	})
+
+	raw, token, err := service.CreateToken(user, "release notes", []string{"posts:write", "posts:read", "posts:write"}, 24*time.Hour, true)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(raw, pkg.AccessTokenPrefix))
+	assert.NotContains(t, stored.Hash, raw)
+	assert.True(t, strings.HasPrefix(raw, stored.Prefix))
+	assert.Equal(t, []string{"posts:read", "posts:write"}, token.Scopes)
+	require.NotNil(t, token.ExpiresAt)
+	assert.True(t, stored.MFA)
+
+	_, _, err = service.CreateToken(user, "bad", []string{"admin"}, 0, false)
+	assert.ErrorIs(t, err, pkg.ErrInvalidScope)
+}
+
+func TestJWTMiddleware_AccessTokens(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockTokenRepo := mocks.NewMockAccessTokenRepositoryInterface(ctrl)
+	mockUserRepo := mocks.NewMockUserRepositoryInterface(ctrl)
+	service := pkg.NewAccessTokenService(mockTokenRepo, pkg.NewUserService(mockUserRepo, globalCache))
+
+	user := pkg.User{ID: primitive.NewObjectID(), Username: "ci-bot", Role: "Author"}
+	past := time.Now().Add(-time.Hour)
+	valid := pkg.AccessToken{ID: primitive.NewObjectID(), UserID: user.ID.Hex(), Prefix: "pat_valid", Scopes: []string{pkg.ScopePostsWrite}}
+	expired := pkg.AccessToken{ID: primitive.NewObjectID(), UserID: user.ID.Hex(), Prefix: "pat_old", Scopes: []string{pkg.ScopePostsWrite}, ExpiresAt: &past}
+
+	mockTokenRepo.EXPECT().GetAccessTokenByHash(gomock.Any()).DoAndReturn(func(hash string) (pkg.AccessToken, error) {
+		switch hash {
+		case hashOf("pat_valid"):
+			return valid, nil
+		case hashOf("pat_expired"):
+			return expired, nil
+		}
+		return pkg.AccessToken{}, mongo.ErrNoDocuments
+	}).AnyTimes()
+	mockTokenRepo.EXPECT().TouchAccessToken(valid.ID, gomock.Any()).Return(nil).AnyTimes()
+	mockUserRepo.EXPECT().GetUserByID(user.ID.Hex()).Return(user, nil).AnyTimes()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	api := router.Group("/api").Use(pkg.JWTMiddleware(nil, service))
+	created := func(c *gin.Context) {
+		username, _ := c.Get("username")
+		c.JSON(http.StatusCreated, gin.H{"author": username})
+	}
+	api.POST("/posts", created)
+	api.GET("/posts", created)
+	api.POST("/me/tokens", created)
+
+	cases := []struct {
+		token  string
+		method string
+		path   string
+		want   int
+	}{
+		{"pat_valid", "POST", "/api/posts", http.StatusCreated},
+		{"pat_valid", "GET", "/api/posts", http.StatusForbidden},
+		{"pat_valid", "POST", "/api/me/tokens", http.StatusForbidden},
+		{"pat_expired", "POST", "/api/posts", http.StatusUnauthorized},
+		{"pat_unknown", "POST", "/api/posts", http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(tc.method, tc.path, nil)
+		req.Header.Set("Authorization", "Bearer "+tc.token)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, tc.want, w.Code, "%s %s with %s", tc.method, tc.path, tc.token)
+		if tc.want == http.StatusCreated {
+			assert.Contains(t, w.Body.String(), "ci-bot")
+		}
+	}
+}
+
+func TestJWTMiddleware_AccessTokensKeepTheCreatorsMFA(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockTokenRepo := mocks.NewMockAccessTokenRepositoryInterface(ctrl)
+	mockUserRepo := mocks.NewMockUserRepositoryInterface(ctrl)
+	service := pkg.NewAccessTokenService(mockTokenRepo, pkg.NewUserService(mockUserRepo, globalCache))
+	mfaService := pkg.NewMFAService(nil, nil, "Blog", time.Minute, []string{"Admin"})
+
+	user := pkg.User{ID: primitive.NewObjectID(), Username: "admin-bot", Role: "Admin"}
+	tokens := map[string]pkg.AccessToken{
+		hashOf("pat_with_mfa"):    {ID: primitive.NewObjectID(), UserID: user.ID.Hex(), Scopes: []string{pkg.ScopePostsWrite}, MFA: true},
+		hashOf("pat_without_mfa"): {ID: primitive.NewObjectID(), UserID: user.ID.Hex(), Scopes: []string{pkg.ScopePostsWrite}},
+	}
+	mockTokenRepo.EXPECT().GetAccessTokenByHash(gomock.Any()).DoAndReturn(func(hash string) (pkg.AccessToken, error) {
+		return tokens[hash], nil
+	}).AnyTimes()
+	mockTokenRepo.EXPECT().TouchAccessToken(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	mockUserRepo.EXPECT().GetUserByID(user.ID.Hex()).Return(user, nil).AnyTimes()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.Group("/api").Use(pkg.JWTMiddleware(nil, service), mfaService.EnforcementMiddleware()).
+		POST("/posts", func(c *gin.Context) { c.Status(http.StatusCreated) })
+
+	for token, want := range map[string]int{"pat_with_mfa": http.StatusCreated, "pat_without_mfa": http.StatusForbidden} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/api/posts", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, want, w.Code, token)
+	}
+}
+
+func hashOf(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,218 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Takeso-user/blog-backend/config"
+	"github.com/Takeso-user/blog-backend/pkg"
+	"github.com/Takeso-user/blog-backend/pkg/mocks"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type accountMocks struct {
+	users    *mocks.MockUserRepositoryInterface
+	posts    *mocks.MockPostRepositoryInterface
+	comments *mocks.MockCommentRepositoryInterface
+}
+
+func newAccountRouter(t *testing.T, username string, policy config.AccountConfig) (*gin.Engine, accountMocks, *pkg.AccountService) {
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+	m := accountMocks{
+		users:    mocks.NewMockUserRepositoryInterface(ctrl),
+		posts:    mocks.NewMockPostRepositoryInterface(ctrl),
+		comments: mocks.NewMockCommentRepositoryInterface(ctrl),
+	}
+
+	userService := pkg.NewUserService(m.users, globalCache)
+	postService := pkg.NewPostService(m.posts, globalCache)
+	commentService := pkg.NewCommentService(m.comments, userService, globalCache)
+	service := pkg.NewAccountService(userService, postService, commentService, nil, nil, policy)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	handler := &pkg.Handler{UserService: userService, AccountService: service}
+	me := router.Group("/api/me").Use(func(c *gin.Context) { c.Set("username", username) })
+	me.GET("", handler.GetMe)
+	me.PATCH("", handler.UpdateMe)
+	me.DELETE("", handler.DeleteMe)
+	me.POST("/password", handler.ChangePassword)
+	return router, m, service
+}
+
+func TestGetMe_HidesSecrets(t *testing.T) {
+	hashedPassword, _ := pkg.HashPassword("password123")
+	user := pkg.User{ID: primitive.NewObjectID(), Username: "meuser", Password: hashedPassword, Role: "Reader", TOTPSecret: "SECRET"}
+	router, m, _ := newAccountRouter(t, user.Username, config.AccountConfig{})
+	m.users.EXPECT().GetUserByUsername(user.Username).Return(user, nil)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/me", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"username":"meuser"`)
+	assert.Contains(t, w.Body.String(), `"has_password":true`)
+	assert.NotContains(t, w.Body.String(), hashedPassword)
+	assert.NotContains(t, w.Body.String(), "SECRET")
+}
+
+func TestUpdateMe_RenamePropagates(t *testing.T) {
+	user := pkg.User{ID: primitive.NewObjectID(), Username: "oldname", Role: "Author"}
+	post := pkg.Post{ID: primitive.NewObjectID(), AuthorID: "oldname"}
+	router, m, _ := newAccountRouter(t, user.Username, config.AccountConfig{})
+
+	m.users.EXPECT().GetUserByUsername("oldname").Return(user, nil).AnyTimes()
+	m.users.EXPECT().GetUserByUsername("taken").Return(pkg.User{Username: "taken"}, nil)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PATCH", "/api/me", strings.NewReader(`{"username":"taken"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// A concurrent rename that takes the name first trips the unique index.
+	m.users.EXPECT().GetUserByUsername("racing").Return(pkg.User{}, errors.New("not found"))
+	m.users.EXPECT().UpdateUser(user.ID, bson.M{"username": "racing"}).Return(pkg.User{}, mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000}}})
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PATCH", "/api/me", strings.NewReader(`{"username":"racing"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	m.users.EXPECT().GetUserByUsername("newname").Return(pkg.User{}, errors.New("not found"))
+	m.users.EXPECT().UpdateUser(user.ID, bson.M{"username": "newname"}).Return(pkg.User{ID: user.ID, Username: "newname", Role: "Author"}, nil)
+	m.posts.EXPECT().GetPostsByAuthor("oldname").Return([]pkg.Post{post}, nil)
+	m.posts.EXPECT().UpdatePostsByAuthor("oldname", bson.M{"author_id": "newname"}).Return(int64(1), nil)
+	m.comments.EXPECT().UpdateCommentsByUser(user.ID.Hex(), bson.M{"username": "newname"}).Return(int64(3), nil)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PATCH", "/api/me", strings.NewReader(`{"username":"newname"}`))
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var result struct {
+		Token string `json:"token"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	claims, err := pkg.ParseJWT(result.Token)
+	require.NoError(t, err)
+	assert.Equal(t, "newname", claims.Username)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PATCH", "/api/me", strings.NewReader(`{"username":"no spaces"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestChangePassword_RequiresCurrentPassword(t *testing.T) {
+	hashedPassword, _ := pkg.HashPassword("password123")
+	user := pkg.User{ID: primitive.NewObjectID(), Username: "pwchanger", Password: hashedPassword, Role: "Reader"}
+	router, m, service := newAccountRouter(t, user.Username, config.AccountConfig{})
+	policy, err := pkg.NewPasswordPolicy(config.PasswordConfig{MinLength: 8, MaxLength: 64})
+	require.NoError(t, err)
+	service.PasswordPolicy = policy
+	m.users.EXPECT().GetUserByUsername(user.Username).Return(user, nil).AnyTimes()
+
+	w := postJSON(router, "/api/me/password", gin.H{"current_password": "wrong", "new_password": "new password 1"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = postJSON(router, "/api/me/password", gin.H{"current_password": "password123", "new_password": "short"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	m.users.EXPECT().UpdateUser(user.ID, gomock.Any()).DoAndReturn(func(_ primitive.ObjectID, fields bson.M) (pkg.User, error) {
+		assert.NoError(t, pkg.CheckPassword(fields["password"].(string), "new password 1"))
+		return user, nil
+	})
+	w = postJSON(router, "/api/me/password", gin.H{"current_password": "password123", "new_password": "new password 1"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "token")
+}
+
+func TestChangePassword_PasswordlessAccountsConfirm(t *testing.T) {
+	user := pkg.User{ID: primitive.NewObjectID(), Username: "oidcsetter", Email: "oidc@example.com", EmailVerified: true, Role: "Reader"}
+	router, m, service := newAccountRouter(t, user.Username, config.AccountConfig{})
+	outbox := pkg.NewMemoryOutbox()
+	service.Confirmations = pkg.NewConfirmationService(memoryTokens{}, nil, nil, outbox, "http://localhost")
+	m.users.EXPECT().GetUserByUsername(user.Username).Return(user, nil).AnyTimes()
+
+	// A stolen token alone can't set a first password.
+	w := postJSON(router, "/api/me/password", gin.H{"new_password": "new password 1"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	var refused struct {
+		ConfirmWith []string `json:"confirm_with"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &refused))
+	assert.Equal(t, []string{"email"}, refused.ConfirmWith)
+	w = postJSON(router, "/api/me/password", gin.H{"confirmation_token": "forged", "new_password": "new password 1"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	require.NoError(t, service.Confirmations.SendLink(context.Background(), user))
+	link, err := url.Parse(confirmLinkPattern.FindString(outbox.Messages()[0].Body))
+	require.NoError(t, err)
+	m.users.EXPECT().UpdateUser(user.ID, gomock.Any()).Return(user, nil)
+	w = postJSON(router, "/api/me/password", gin.H{"confirmation_token": link.Query().Get("token"), "new_password": "new password 1"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+}
+
+func TestDeleteAccount_PasswordlessAccountsConfirm(t *testing.T) {
+	user := pkg.User{ID: primitive.NewObjectID(), Username: "totpleaver", TOTPEnabled: true, TOTPSecret: rfcTOTPSecret}
+	_, m, service := newAccountRouter(t, user.Username, config.AccountConfig{DeletedPosts: config.ContentDelete, DeletedComments: config.ContentDelete})
+	service.Confirmations = pkg.NewConfirmationService(memoryTokens{}, pkg.NewMFAService(service.UserService, nil, "Blog", time.Minute, nil), nil, pkg.NewMemoryOutbox(), "http://localhost")
+
+	assert.ErrorIs(t, service.DeleteAccount(user, pkg.Confirmation{}), pkg.ErrConfirmationRequired)
+	assert.ErrorIs(t, service.DeleteAccount(user, pkg.Confirmation{Code: "000000"}), pkg.ErrInvalidMFACode)
+
+	code, _ := pkg.TOTPCode(rfcTOTPSecret, time.Now())
+	m.users.EXPECT().UseTOTPStep(user.ID, gomock.Any()).Return(true, nil)
+	m.posts.EXPECT().GetPostsByAuthor("totpleaver").Return(nil, nil)
+	m.posts.EXPECT().DeletePostsByAuthor("totpleaver").Return(int64(0), nil)
+	m.comments.EXPECT().DeleteCommentsByUser(user.ID.Hex()).Return(int64(0), nil)
+	m.users.EXPECT().DeleteUser(user.ID).Return(nil)
+	assert.NoError(t, service.DeleteAccount(user, pkg.Confirmation{Code: code}))
+
+	// Accounts with no factor at all have nothing to confirm with.
+	bare := pkg.User{ID: primitive.NewObjectID(), Username: "bareleaver"}
+	m.posts.EXPECT().GetPostsByAuthor("bareleaver").Return(nil, nil)
+	m.posts.EXPECT().DeletePostsByAuthor("bareleaver").Return(int64(0), nil)
+	m.comments.EXPECT().DeleteCommentsByUser(bare.ID.Hex()).Return(int64(0), nil)
+	m.users.EXPECT().DeleteUser(bare.ID).Return(nil)
+	assert.NoError(t, service.DeleteAccount(bare, pkg.Confirmation{}))
+}
+
+func TestDeleteAccount_ContentPolicy(t *testing.T) {
+	hashedPassword, _ := pkg.HashPassword("password123")
+
+	t.Run("anonymize", func(t *testing.T) {
+		user := pkg.User{ID: primitive.NewObjectID(), Username: "leaver1", Password: hashedPassword}
+		_, m, service := newAccountRouter(t, user.Username, config.AccountConfig{DeletedPosts: config.ContentAnonymize, DeletedComments: config.ContentAnonymize, DeletedUsername: "[deleted]"})
+
+		assert.ErrorIs(t, service.DeleteAccount(user, pkg.Confirmation{Password: "wrong"}), pkg.ErrPasswordMismatch)
+
+		m.posts.EXPECT().GetPostsByAuthor("leaver1").Return(nil, nil)
+		m.posts.EXPECT().UpdatePostsByAuthor("leaver1", bson.M{"author_id": ""}).Return(int64(2), nil)
+		m.comments.EXPECT().UpdateCommentsByUser(user.ID.Hex(), bson.M{"user_id": "", "username": "[deleted]"}).Return(int64(5), nil)
+		m.users.EXPECT().DeleteUser(user.ID).Return(nil)
+		assert.NoError(t, service.DeleteAccount(user, pkg.Confirmation{Password: "password123"}))
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		user := pkg.User{ID: primitive.NewObjectID(), Username: "leaver2", Password: hashedPassword}
+		_, m, service := newAccountRouter(t, user.Username, config.AccountConfig{DeletedPosts: config.ContentDelete, DeletedComments: config.ContentDelete})
+
+		m.posts.EXPECT().GetPostsByAuthor("leaver2").Return(nil, nil)
+		m.posts.EXPECT().DeletePostsByAuthor("leaver2").Return(int64(2), nil)
+		m.comments.EXPECT().DeleteCommentsByUser(user.ID.Hex()).Return(int64(5), nil)
+		m.users.EXPECT().DeleteUser(user.ID).Return(nil)
+		assert.NoError(t, service.DeleteAccount(user, pkg.Confirmation{Password: "password123"}))
+	})
+}
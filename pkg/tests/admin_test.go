@@ -0,0 +1,204 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Takeso-user/blog-backend/pkg"
+	"github.com/Takeso-user/blog-backend/pkg/mocks"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// newAdminRouter serves the admin user and audit endpoints, acting as
+// admin, and the login endpoint. users are kept in memory behind the mocked
+// repository; audit events in a memoryAudit.
+func newAdminRouter(t *testing.T, admin *pkg.User, users ...*pkg.User) (*gin.Engine, *mocks.MockUserRepositoryInterface, *pkg.MemoryOutbox) {
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+
+	all := append([]*pkg.User{admin}, users...)
+	find := func(match func(*pkg.User) bool) (pkg.User, error) {
+		for _, user := range all {
+			if match(user) {
+				return *user, nil
+			}
+		}
+		return pkg.User{}, mongo.ErrNoDocuments
+	}
+	mockUserRepo := mocks.NewMockUserRepositoryInterface(ctrl)
+	mockUserRepo.EXPECT().GetUserByUsername(gomock.Any()).DoAndReturn(func(username string) (pkg.User, error) {
+		return find(func(u *pkg.User) bool { return u.Username == username })
+	}).AnyTimes()
+	mockUserRepo.EXPECT().GetUserByID(gomock.Any()).DoAndReturn(func(id string) (pkg.User, error) {
+		return find(func(u *pkg.User) bool { return u.ID.Hex() == id })
+	}).AnyTimes()
+	mockUserRepo.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).DoAndReturn(func(id primitive.ObjectID, fields bson.M) (pkg.User, error) {
+		user, err := find(func(u *pkg.User) bool { return u.ID == id })
+		require.NoError(t, err)
+		for _, u := range all {
+			if u.ID != id {
+				continue
+			}
+			if restriction, ok := fields["restriction"]; ok {
+				u.Restriction = nil
+				if restriction != nil {
+					r := restriction.(pkg.Restriction)
+					u.Restriction = &r
+				}
+			}
+			if required, ok := fields["password_reset_required"]; ok {
+				u.PasswordResetRequired = required.(bool)
+			}
+			if role, ok := fields["role"]; ok {
+				u.Role = role.(string)
+			}
+			user = *u
+		}
+		return user, nil
+	}).AnyTimes()
+
+	userService := pkg.NewUserService(mockUserRepo, globalCache)
+	outbox := pkg.NewMemoryOutbox()
+	resets := pkg.NewPasswordResetService(memoryTokens{}, userService, nil, outbox, "http://blog.test", time.Hour)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.Use(pkg.RequestIDMiddleware())
+	handler := &pkg.Handler{
+		UserService:  userService,
+		AdminService: pkg.NewAdminService(userService, nil, resets),
+		AuditService: pkg.NewAuditService(&memoryAudit{}),
+	}
+	router.POST("/auth/login", handler.Login)
+	adminAPI := router.Group("/api/admin").Use(func(c *gin.Context) {
+		c.Set("username", admin.Username)
+		c.Set("role", admin.Role)
+	}, pkg.AdminMiddleware())
+	adminAPI.GET("/users", handler.SearchUsers)
+	adminAPI.PUT("/users/:id/role", handler.SetUserRole)
+	adminAPI.POST("/users/:id/suspend", handler.SuspendUser)
+	adminAPI.POST("/users/:id/ban", handler.BanUser)
+	adminAPI.DELETE("/users/:id/restriction", handler.LiftUserRestriction)
+	adminAPI.POST("/users/:id/password-reset", handler.ForceUserPasswordReset)
+	adminAPI.POST("/users/:id/impersonate", handler.ImpersonateUser)
+	adminAPI.GET("/audit", handler.GetAuditEvents)
+	adminAPI.GET("/audit/verify", handler.VerifyAuditLog)
+	return router, mockUserRepo, outbox
+}
+
+func TestAdmin_SuspensionBlocksLogin(t *testing.T) {
+	hashedPassword, _ := pkg.HashPassword("password123")
+	admin := &pkg.User{ID: primitive.NewObjectID(), Username: "suspendadmin", Role: "Admin"}
+	user := &pkg.User{ID: primitive.NewObjectID(), Username: "suspendee", Password: hashedPassword, Role: "Reader"}
+	router, _, _ := newAdminRouter(t, admin, user)
+	login := gin.H{"username": "suspendee", "password": "password123"}
+
+	w := postJSON(router, "/api/admin/users/"+user.ID.Hex()+"/suspend", gin.H{"reason": "spam"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NotNil(t, user.Restriction)
+	assert.Equal(t, "suspendadmin", user.Restriction.By)
+
+	w = postJSON(router, "/auth/login", login)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "Account suspended")
+	assert.Contains(t, w.Body.String(), "spam")
+
+	w = postJSON(router, "/api/admin/users/"+user.ID.Hex()+"/ban", gin.H{"reason": "spam", "expires_at": time.Now().Add(-time.Hour)})
+	assert.Equal(t, http.StatusBadRequest, w.Code, "expiry must be in the future")
+	w = postJSON(router, "/api/admin/users/"+admin.ID.Hex()+"/ban", gin.H{"reason": "oops"})
+	assert.Equal(t, http.StatusForbidden, w.Code, "admins cannot ban themselves")
+
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/api/admin/users/"+user.ID.Hex()+"/restriction", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	w = postJSON(router, "/auth/login", login)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	expired := time.Now().Add(-time.Minute)
+	user.Restriction = &pkg.Restriction{Type: pkg.RestrictionBan, Reason: "old", ExpiresAt: &expired}
+	w = postJSON(router, "/auth/login", login)
+	assert.Equal(t, http.StatusOK, w.Code, "expired bans no longer apply")
+}
+
+func TestAdmin_ForcePasswordReset(t *testing.T) {
+	hashedPassword, _ := pkg.HashPassword("password123")
+	admin := &pkg.User{ID: primitive.NewObjectID(), Username: "resetadmin", Role: "Admin"}
+	user := &pkg.User{ID: primitive.NewObjectID(), Username: "mustreset", Password: hashedPassword, Email: "mustreset@example.com", Role: "Reader"}
+	router, _, outbox := newAdminRouter(t, admin, user)
+
+	w := postJSON(router, "/api/admin/users/"+user.ID.Hex()+"/password-reset", gin.H{})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"mailed":true`)
+	assert.True(t, user.PasswordResetRequired)
+	require.Len(t, outbox.Messages(), 1)
+	assert.Equal(t, "mustreset@example.com", outbox.Messages()[0].To)
+
+	w = postJSON(router, "/auth/login", gin.H{"username": "mustreset", "password": "password123"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "password_reset_required")
+}
+
+func TestAdmin_Impersonation(t *testing.T) {
+	admin := &pkg.User{ID: primitive.NewObjectID(), Username: "supportadmin", Role: "Admin"}
+	user := &pkg.User{ID: primitive.NewObjectID(), Username: "customer", Role: "Reader"}
+	other := &pkg.User{ID: primitive.NewObjectID(), Username: "otheradmin", Role: "Admin"}
+	router, _, _ := newAdminRouter(t, admin, user, other)
+
+	w := postJSON(router, "/api/admin/users/"+other.ID.Hex()+"/impersonate", gin.H{})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = postJSON(router, "/api/admin/users/"+user.ID.Hex()+"/impersonate", gin.H{})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var result struct {
+		Token string `json:"token"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	claims, err := pkg.ParseJWT(result.Token)
+	require.NoError(t, err)
+	assert.Equal(t, "customer", claims.Username)
+	assert.Equal(t, "supportadmin", claims.Impersonator)
+	assert.LessOrEqual(t, claims.ExpiresAt, time.Now().Add(time.Hour).Unix())
+
+	api := router.Group("/api").Use(pkg.JWTMiddleware(nil, nil))
+	api.GET("/me/probe", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	api.POST("/me/password", pkg.DenyImpersonationMiddleware(), func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	send := func(method, path string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+result.Token)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusNoContent, send("GET", "/api/me/probe"))
+	assert.Equal(t, http.StatusForbidden, send("POST", "/api/me/password"), "credentials cannot be changed while impersonating")
+}
+
+func TestAdmin_SearchUsers(t *testing.T) {
+	admin := &pkg.User{ID: primitive.NewObjectID(), Username: "searchadmin", Role: "Admin"}
+	router, mockUserRepo, _ := newAdminRouter(t, admin)
+	mockUserRepo.EXPECT().SearchUsers(pkg.UserFilter{Query: "al", Role: "Author", Status: pkg.UserStatusSuspended, Limit: 50}).
+		Return([]pkg.User{{ID: primitive.NewObjectID(), Username: "alice", Password: "secret-hash", Role: "Author"}}, int64(1), nil)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/admin/users?q=al&role=Author&status=suspended", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"total":1`)
+	assert.Contains(t, w.Body.String(), `"username":"alice"`)
+	assert.NotContains(t, w.Body.String(), "secret-hash")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/admin/users?status=deleted", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,175 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Takeso-user/blog-backend/pkg"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// memoryAudit is an in-memory AuditRepositoryInterface. Searches only
+// filter by actor and action.
+type memoryAudit struct {
+	mu     sync.Mutex
+	events []pkg.AuditEvent
+}
+
+func (m *memoryAudit) AppendAuditEvent(event pkg.AuditEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events = append(m.events, event)
+	return nil
+}
+
+func (m *memoryAudit) GetLastAuditEvent() (pkg.AuditEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.events) == 0 {
+		return pkg.AuditEvent{}, mongo.ErrNoDocuments
+	}
+	return m.events[len(m.events)-1], nil
+}
+
+func (m *memoryAudit) SearchAuditEvents(filter pkg.AuditFilter) ([]pkg.AuditEvent, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	found := []pkg.AuditEvent{}
+	for i := len(m.events) - 1; i >= 0; i-- {
+		event := m.events[i]
+		group, isGroup := strings.CutSuffix(filter.Action, "*")
+		if filter.Actor != "" && event.Actor != filter.Actor ||
+			isGroup && !strings.HasPrefix(event.Action, group) ||
+			!isGroup && filter.Action != "" && event.Action != filter.Action {
+			continue
+		}
+		found = append(found, event)
+	}
+	return found, int64(len(found)), nil
+}
+
+func (m *memoryAudit) GetAuditEventsAfter(seq int64, limit int64) ([]pkg.AuditEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	found := []pkg.AuditEvent{}
+	for _, event := range m.events {
+		if event.Seq > seq && int64(len(found)) < limit {
+			found = append(found, event)
+		}
+	}
+	return found, nil
+}
+
+func TestAudit_ChainDetectsTampering(t *testing.T) {
+	repo := &memoryAudit{}
+	service := pkg.NewAuditService(repo)
+	for _, role := range []string{"Author", "Editor", "Admin"} {
+		_, err := service.Record(pkg.AuditEvent{
+			Action:   pkg.AuditRoleChange,
+			Actor:    "chainadmin",
+			TargetID: "user-1",
+			After:    json.RawMessage(`{"role":"` + role + `"}`),
+		})
+		require.NoError(t, err)
+	}
+
+	result, err := service.Verify()
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+	assert.Equal(t, int64(3), result.Checked)
+	assert.Equal(t, repo.events[2].Hash, result.LastHash)
+	assert.Equal(t, repo.events[0].Hash, repo.events[1].PrevHash)
+
+	original := repo.events[1]
+	repo.events[1].After = json.RawMessage(`{"role":"Reader"}`)
+	result, err = service.Verify()
+	require.NoError(t, err)
+	assert.False(t, result.Valid)
+	assert.Equal(t, int64(2), result.BrokenSeq)
+	assert.Contains(t, result.Problem, "hash")
+
+	repo.events = append(repo.events[:1:1], repo.events[2])
+	result, err = service.Verify()
+	require.NoError(t, err)
+	assert.False(t, result.Valid, "removing an event breaks the chain")
+	assert.Equal(t, int64(3), result.BrokenSeq)
+
+	repo.events = []pkg.AuditEvent{repo.events[0], original, repo.events[1]}
+	result, err = service.Verify()
+	require.NoError(t, err)
+	assert.True(t, result.Valid)
+}
+
+func TestAudit_AdminActionsAreRecorded(t *testing.T) {
+	hashedPassword, _ := pkg.HashPassword("password123")
+	admin := &pkg.User{ID: primitive.NewObjectID(), Username: "auditadmin", Role: "Admin"}
+	user := &pkg.User{ID: primitive.NewObjectID(), Username: "audited", Password: hashedPassword, Role: "Reader"}
+	router, _, _ := newAdminRouter(t, admin, user)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/api/admin/users/"+user.ID.Hex()+"/role", strings.NewReader(`{"role":"Author"}`))
+	req.Header.Set("X-Request-ID", "req-42")
+	req.Header.Set("User-Agent", "audit-test")
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "req-42", w.Header().Get("X-Request-ID"))
+
+	w = postJSON(router, "/auth/login", gin.H{"username": "audited", "password": "wrong"})
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	w = postJSON(router, "/auth/login", gin.H{"username": "audited", "password": "password123"})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	search := func(query string) []pkg.AuditEvent {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/api/admin/audit"+query, nil)
+		router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		var result struct {
+			Events []pkg.AuditEvent `json:"events"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+		return result.Events
+	}
+
+	events := search("?action=admin.*")
+	require.Len(t, events, 1)
+	roleChange := events[0]
+	assert.Equal(t, pkg.AuditRoleChange, roleChange.Action)
+	assert.Equal(t, "auditadmin", roleChange.Actor)
+	assert.Equal(t, user.ID.Hex(), roleChange.TargetID)
+	assert.Equal(t, "req-42", roleChange.RequestID)
+	assert.Equal(t, "audit-test", roleChange.UserAgent)
+	assert.Contains(t, string(roleChange.Before), `"role":"Reader"`)
+	assert.Contains(t, string(roleChange.After), `"role":"Author"`)
+	assert.NotContains(t, string(roleChange.Before), hashedPassword)
+
+	events = search("?action=auth.login_failed")
+	require.Len(t, events, 1)
+	assert.Empty(t, events[0].Actor, "failed logins have no proven actor")
+	assert.Equal(t, "audited", events[0].Details["username"])
+	assert.NotEmpty(t, events[0].RequestID)
+
+	events = search("?action=auth.login")
+	require.Len(t, events, 1)
+	assert.Equal(t, "audited", events[0].Actor)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/admin/audit/verify", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"valid":true`)
+	assert.Contains(t, w.Body.String(), `"checked":3`)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/admin/audit?from=yesterday", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -1,7 +1,9 @@
 package tests
 
 import (
+	"encoding/base64"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/Takeso-user/blog-backend/pkg"
@@ -34,6 +36,11 @@ func TestGenerateJWT(t *testing.T) {
 	token, err := pkg.GenerateJWT(user)
 	require.NoError(t, err)
 	require.NotEmpty(t, token)
+
+	// The payload is readable by anyone holding the token.
+	payload, err := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[1])
+	require.NoError(t, err)
+	assert.NotContains(t, string(payload), "password")
 }
 
 func TestParseJWT(t *testing.T) {
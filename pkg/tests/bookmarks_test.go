@@ -0,0 +1,138 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Takeso-user/blog-backend/pkg"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type bookmarkPage struct {
+	Bookmarks []pkg.Bookmark `json:"bookmarks"`
+	Total     int64          `json:"total"`
+}
+
+func TestBookmarks_ListsAndPagination(t *testing.T) {
+	f := newBlogFixture(t)
+	for _, title := range []string{"Onboarding", "Deploys", "On-call", "Postmortems"} {
+		f.addPost("alice", title)
+	}
+
+	var list pkg.ReadingList
+	require.Equal(t, http.StatusCreated, f.do(t, "bob", "POST", "/api/me/reading-lists", gin.H{"name": " Ops "}, &list))
+	assert.Equal(t, "Ops", list.Name)
+	assert.False(t, list.Public)
+	assert.Empty(t, list.ShareURL)
+
+	var bookmark pkg.Bookmark
+	require.Equal(t, http.StatusCreated, f.do(t, "bob", "POST", "/api/me/bookmarks", gin.H{"post_id": f.postID("Onboarding"), "note": "read first"}, &bookmark))
+	assert.Equal(t, "Onboarding", bookmark.Post.Title)
+	for _, title := range []string{"Deploys", "On-call"} {
+		require.Equal(t, http.StatusCreated, f.do(t, "bob", "POST", "/api/me/bookmarks", gin.H{"post_id": f.postID(title), "list_id": list.ID.Hex()}, nil))
+	}
+	var again pkg.Bookmark
+	require.Equal(t, http.StatusOK, f.do(t, "bob", "POST", "/api/me/bookmarks", gin.H{"post_id": f.postID("Onboarding")}, &again), "bookmarking twice keeps one bookmark")
+	assert.Equal(t, bookmark.ID, again.ID)
+	assert.Equal(t, http.StatusNotFound, f.do(t, "bob", "POST", "/api/me/bookmarks", gin.H{"post_id": primitive.NewObjectID().Hex()}, nil))
+
+	var page bookmarkPage
+	require.Equal(t, http.StatusOK, f.do(t, "bob", "GET", "/api/me/bookmarks?limit=2", nil, &page))
+	assert.Equal(t, int64(3), page.Total)
+	require.Len(t, page.Bookmarks, 2)
+	assert.Equal(t, "On-call", page.Bookmarks[0].Post.Title, "newest first")
+	require.Equal(t, http.StatusOK, f.do(t, "bob", "GET", "/api/me/bookmarks?limit=2&offset=2", nil, &page))
+	require.Len(t, page.Bookmarks, 1)
+	assert.Equal(t, "read first", page.Bookmarks[0].Note)
+	assert.Equal(t, http.StatusBadRequest, f.do(t, "bob", "GET", "/api/me/bookmarks?limit=many", nil, nil))
+
+	require.Equal(t, http.StatusOK, f.do(t, "bob", "GET", "/api/me/bookmarks?list_id="+list.ID.Hex(), nil, &page))
+	assert.Equal(t, int64(2), page.Total)
+
+	require.Equal(t, http.StatusOK, f.do(t, "bob", "PATCH", "/api/me/bookmarks/"+bookmark.ID.Hex(), gin.H{"list_id": list.ID.Hex()}, &bookmark))
+	assert.Equal(t, list.ID.Hex(), bookmark.ListID)
+	assert.Equal(t, "read first", bookmark.Note, "omitted fields are kept")
+
+	// Another user sees neither the bookmarks nor the list.
+	assert.Equal(t, http.StatusNotFound, f.do(t, "carol", "GET", "/api/me/bookmarks?list_id="+list.ID.Hex(), nil, nil))
+	assert.Equal(t, http.StatusNotFound, f.do(t, "carol", "DELETE", "/api/me/bookmarks/"+bookmark.ID.Hex(), nil, nil))
+	assert.Equal(t, http.StatusNotFound, f.do(t, "carol", "POST", "/api/me/bookmarks", gin.H{"post_id": f.postID("Postmortems"), "list_id": list.ID.Hex()}, nil))
+	require.Equal(t, http.StatusOK, f.do(t, "carol", "GET", "/api/me/bookmarks", nil, &page))
+	assert.Zero(t, page.Total)
+
+	require.Equal(t, http.StatusOK, f.do(t, "bob", "DELETE", "/api/me/reading-lists/"+list.ID.Hex(), nil, nil))
+	require.Equal(t, http.StatusOK, f.do(t, "bob", "GET", "/api/me/bookmarks", nil, &page))
+	assert.Equal(t, int64(3), page.Total, "bookmarks outlive their list")
+	for _, bookmark := range page.Bookmarks {
+		assert.Empty(t, bookmark.ListID)
+	}
+}
+
+func TestBookmarks_DeletedPostDegrades(t *testing.T) {
+	f := newBlogFixture(t)
+	for _, title := range []string{"Runbook", "Old design doc"} {
+		f.addPost("alice", title)
+	}
+	for _, title := range []string{"Runbook", "Old design doc"} {
+		require.Equal(t, http.StatusCreated, f.do(t, "bob", "POST", "/api/me/bookmarks", gin.H{"post_id": f.postID(title)}, nil))
+	}
+
+	require.Equal(t, http.StatusOK, f.do(t, "bob", "DELETE", "/api/posts/"+f.postID("Runbook"), nil, nil))
+	// A post can also vanish without going through PostService.DeletePost.
+	require.NoError(t, f.store.DeletePost(f.postID("Old design doc")))
+
+	var page bookmarkPage
+	require.Equal(t, http.StatusOK, f.do(t, "bob", "GET", "/api/me/bookmarks", nil, &page))
+	require.Len(t, page.Bookmarks, 2)
+	for _, bookmark := range page.Bookmarks {
+		assert.True(t, bookmark.PostDeleted)
+		assert.Nil(t, bookmark.Post)
+	}
+	assert.Equal(t, []string{"Old design doc", "Runbook"}, []string{page.Bookmarks[0].PostTitle, page.Bookmarks[1].PostTitle})
+	marked, _, err := f.store.GetBookmarks(pkg.BookmarkFilter{})
+	require.NoError(t, err)
+	assert.True(t, marked[1].PostDeleted, "deleting the post flags its bookmarks")
+
+	require.Equal(t, http.StatusOK, f.do(t, "bob", "DELETE", "/api/me/bookmarks/"+page.Bookmarks[0].ID.Hex(), nil, nil))
+}
+
+func TestReadingList_Sharing(t *testing.T) {
+	f := newBlogFixture(t)
+	for _, title := range []string{"Style guide"} {
+		f.addPost("alice", title)
+	}
+
+	var list pkg.ReadingList
+	require.Equal(t, http.StatusCreated, f.do(t, "bob", "POST", "/api/me/reading-lists", gin.H{"name": "Team picks", "public": true}, &list))
+	require.NotEmpty(t, list.ShareToken)
+	assert.Equal(t, "https://blog.example.com/reading-lists/"+list.ShareToken, list.ShareURL)
+	require.Equal(t, http.StatusCreated, f.do(t, "bob", "POST", "/api/me/bookmarks", gin.H{"post_id": f.postID("Style guide"), "list_id": list.ID.Hex(), "note": "private thought"}, nil))
+
+	var shared struct {
+		List      pkg.ReadingList `json:"list"`
+		Bookmarks []pkg.Bookmark  `json:"bookmarks"`
+		Total     int64           `json:"total"`
+	}
+	require.Equal(t, http.StatusOK, f.do(t, "bob", "GET", "/reading-lists/"+list.ShareToken, nil, &shared))
+	assert.Equal(t, "Team picks", shared.List.Name)
+	require.Len(t, shared.Bookmarks, 1)
+	assert.Equal(t, "Style guide", shared.Bookmarks[0].Post.Title)
+	assert.Empty(t, shared.Bookmarks[0].Note, "notes stay private")
+
+	oldToken := list.ShareToken
+	var unshared pkg.ReadingList
+	require.Equal(t, http.StatusOK, f.do(t, "bob", "PATCH", "/api/me/reading-lists/"+list.ID.Hex(), gin.H{"public": false}, &unshared))
+	assert.False(t, unshared.Public)
+	assert.Empty(t, unshared.ShareURL)
+	assert.Equal(t, http.StatusNotFound, f.do(t, "bob", "GET", "/reading-lists/"+oldToken, nil, nil))
+
+	require.Equal(t, http.StatusOK, f.do(t, "bob", "PATCH", "/api/me/reading-lists/"+list.ID.Hex(), gin.H{"public": true}, &list))
+	assert.NotEqual(t, oldToken, list.ShareToken, "sharing again issues a new link")
+	assert.Equal(t, http.StatusNotFound, f.do(t, "bob", "GET", "/reading-lists/"+oldToken, nil, nil))
+	assert.Equal(t, http.StatusOK, f.do(t, "bob", "GET", "/reading-lists/"+list.ShareToken, nil, nil))
+
+	assert.Equal(t, http.StatusBadRequest, f.do(t, "bob", "PATCH", "/api/me/reading-lists/"+list.ID.Hex(), gin.H{"name": ""}, nil))
+}
@@ -0,0 +1,208 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Takeso-user/blog-backend/pkg"
+	"github.com/Takeso-user/blog-backend/pkg/mocks"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestNormalizeEmail(t *testing.T) {
+	email, err := pkg.NormalizeEmail("  Alice@Example.COM ")
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.com", email)
+
+	for _, invalid := range []string{"", "alice", "Alice <alice@example.com>", "a@b@c"} {
+		_, err := pkg.NormalizeEmail(invalid)
+		assert.ErrorIs(t, err, pkg.ErrInvalidEmail, invalid)
+	}
+}
+
+func Test_EmailVerificationService_Verify(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockTokenRepo := mocks.NewMockTokenRepositoryInterface(ctrl)
+	mockUserRepo := mocks.NewMockUserRepositoryInterface(ctrl)
+	service := pkg.NewEmailVerificationService(mockTokenRepo, pkg.NewUserService(mockUserRepo, globalCache), pkg.NewMemoryOutbox(), "http://localhost", time.Hour)
+
+	user := pkg.User{ID: primitive.NewObjectID(), Username: "verifyuser", Email: "verify@example.com"}
+	mockTokenRepo.EXPECT().ConsumeToken(pkg.TokenPurposeEmailVerification, gomock.Any(), gomock.Any()).
+		Return(pkg.OneTimeToken{UserID: user.ID.Hex(), Email: "verify@example.com"}, nil)
+	mockUserRepo.EXPECT().GetUserByID(user.ID.Hex()).Return(user, nil)
+	mockUserRepo.EXPECT().UpdateUser(user.ID, bson.M{"email_verified": true}).Return(pkg.User{ID: user.ID, EmailVerified: true}, nil)
+
+	verified, err := service.Verify("raw-token")
+	require.NoError(t, err)
+	assert.True(t, verified.EmailVerified)
+}
+
+func Test_EmailVerificationService_Verify_RejectsStaleAddress(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockTokenRepo := mocks.NewMockTokenRepositoryInterface(ctrl)
+	mockUserRepo := mocks.NewMockUserRepositoryInterface(ctrl)
+	service := pkg.NewEmailVerificationService(mockTokenRepo, pkg.NewUserService(mockUserRepo, globalCache), pkg.NewMemoryOutbox(), "http://localhost", time.Hour)
+
+	user := pkg.User{ID: primitive.NewObjectID(), Username: "verifyuser2", Email: "new@example.com"}
+	mockTokenRepo.EXPECT().ConsumeToken(pkg.TokenPurposeEmailVerification, gomock.Any(), gomock.Any()).
+		Return(pkg.OneTimeToken{UserID: user.ID.Hex(), Email: "old@example.com"}, nil)
+	mockUserRepo.EXPECT().GetUserByID(user.ID.Hex()).Return(user, nil)
+
+	_, err := service.Verify("raw-token")
+	assert.ErrorIs(t, err, pkg.ErrInvalidToken)
+}
+
+func Test_EmailVerificationService_ChangeEmail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	var tokens []pkg.OneTimeToken
+	mockTokenRepo := mocks.NewMockTokenRepositoryInterface(ctrl)
+	mockTokenRepo.EXPECT().CreateToken(gomock.Any()).DoAndReturn(func(token pkg.OneTimeToken) error {
+		tokens = append(tokens, token)
+		return nil
+	}).AnyTimes()
+	mockTokenRepo.EXPECT().DeleteUserTokens(gomock.Any(), pkg.TokenPurposeEmailVerification).Return(nil).AnyTimes()
+	mockUserRepo := mocks.NewMockUserRepositoryInterface(ctrl)
+	outbox := pkg.NewMemoryOutbox()
+	service := pkg.NewEmailVerificationService(mockTokenRepo, pkg.NewUserService(mockUserRepo, globalCache), outbox, "http://localhost", time.Hour)
+
+	hashedPassword, _ := pkg.HashPassword("password123")
+	user := pkg.User{ID: primitive.NewObjectID(), Username: "emailchanger", Password: hashedPassword, Email: "old@example.com", EmailVerified: true}
+	_, err := service.ChangeEmail(context.Background(), user, "new@example.com", pkg.Confirmation{Password: "wrong"})
+	assert.ErrorIs(t, err, pkg.ErrPasswordMismatch)
+	_, err = service.ChangeEmail(context.Background(), user, "new@example.com", pkg.Confirmation{Code: "123456"})
+	assert.ErrorIs(t, err, pkg.ErrConfirmationRequired, "codes only count with TOTP enabled")
+
+	changed := pkg.User{ID: user.ID, Username: user.Username, Email: "new@example.com"}
+	mockUserRepo.EXPECT().GetUserByEmail("new@example.com").Return(pkg.User{}, errors.New("not found"))
+	mockUserRepo.EXPECT().UpdateUser(user.ID, bson.M{"email": "new@example.com", "email_verified": false}).Return(changed, nil)
+	_, err = service.ChangeEmail(context.Background(), user, "new@example.com", pkg.Confirmation{Password: "password123"})
+	require.NoError(t, err)
+
+	messages := outbox.Messages()
+	require.Len(t, messages, 2)
+	assert.Equal(t, "old@example.com", messages[0].To)
+	assert.Contains(t, messages[0].Body, "new@example.com")
+	assert.Contains(t, messages[0].Body, "http://localhost/revert-email?token=")
+	assert.Equal(t, "new@example.com", messages[1].To)
+
+	// The link in the notice restores the verified old address.
+	revert := tokens[0]
+	assert.Equal(t, pkg.TokenPurposeEmailRevert, revert.Purpose)
+	mockTokenRepo.EXPECT().ConsumeToken(pkg.TokenPurposeEmailRevert, gomock.Any(), gomock.Any()).Return(revert, nil)
+	mockUserRepo.EXPECT().GetUserByID(user.ID.Hex()).Return(changed, nil)
+	mockUserRepo.EXPECT().UpdateUser(user.ID, bson.M{"email": "old@example.com", "email_verified": true}).Return(user, nil)
+	restored, err := service.RevertEmail("raw-token")
+	require.NoError(t, err)
+	assert.Equal(t, "old@example.com", restored.Email)
+}
+
+var confirmLinkPattern = regexp.MustCompile(`http://localhost/confirm\?token=\S+`)
+
+func Test_ConfirmationService_PasswordlessAccounts(t *testing.T) {
+	tokens := memoryTokens{}
+	outbox := pkg.NewMemoryOutbox()
+	service := pkg.NewConfirmationService(tokens, nil, nil, outbox, "http://localhost")
+
+	// An account that signs in through an identity provider or a magic
+	// link confirms with a link mailed to its verified address.
+	user := pkg.User{ID: primitive.NewObjectID(), Username: "passwordless", Email: "pl@example.com", EmailVerified: true}
+	assert.Equal(t, []string{"email"}, pkg.ConfirmationMethods(user))
+	assert.ErrorIs(t, service.Confirm(user, pkg.Confirmation{}), pkg.ErrConfirmationRequired)
+	assert.ErrorIs(t, service.Confirm(user, pkg.Confirmation{Password: "anything"}), pkg.ErrConfirmationRequired)
+
+	mailedToken := func() string {
+		messages := outbox.Messages()
+		require.NotEmpty(t, messages)
+		assert.Equal(t, "pl@example.com", messages[len(messages)-1].To)
+		link, err := url.Parse(confirmLinkPattern.FindString(messages[len(messages)-1].Body))
+		require.NoError(t, err)
+		return link.Query().Get("token")
+	}
+	require.NoError(t, service.SendLink(context.Background(), user))
+	other := pkg.User{ID: primitive.NewObjectID(), Username: "other", Email: "o@example.com", EmailVerified: true}
+	assert.ErrorIs(t, service.Confirm(other, pkg.Confirmation{Token: mailedToken()}), pkg.ErrInvalidToken, "tokens belong to one user")
+
+	require.NoError(t, service.SendLink(context.Background(), user))
+	token := mailedToken()
+	assert.NoError(t, service.Confirm(user, pkg.Confirmation{Token: token}))
+	assert.ErrorIs(t, service.Confirm(user, pkg.Confirmation{Token: token}), pkg.ErrInvalidToken, "tokens work once")
+
+	// Unverified addresses can't be used, and an account with no factor
+	// at all has nothing to confirm with.
+	bare := pkg.User{ID: primitive.NewObjectID(), Username: "bare", Email: "bare@example.com"}
+	assert.ErrorIs(t, service.SendLink(context.Background(), bare), pkg.ErrInvalidEmail)
+	assert.NoError(t, service.Confirm(bare, pkg.Confirmation{}))
+}
+
+func Test_VerifiedEmailMiddleware_BlocksUnverifiedUsers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx := context.Background()
+
+	mockUserRepo := mocks.NewMockUserRepositoryInterface(ctrl)
+	mockUserRepo.EXPECT().GetUserByUsername("unverified").Return(pkg.User{Username: "unverified", Email: "u@example.com"}, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.Use(func(c *gin.Context) { c.Set("username", "unverified") })
+	router.POST("/posts", pkg.VerifiedEmailMiddleware(pkg.NewUserService(mockUserRepo, globalCache), true), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "Post created successfully"})
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(ctx, "POST", "/posts", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func Test_Register_SendsVerificationEmail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx := context.Background()
+
+	mockUserRepo := mocks.NewMockUserRepositoryInterface(ctrl)
+	mockTokenRepo := mocks.NewMockTokenRepositoryInterface(ctrl)
+	userService := pkg.NewUserService(mockUserRepo, globalCache)
+	outbox := pkg.NewMemoryOutbox()
+
+	mockUserRepo.EXPECT().GetUserByEmail("new@example.com").Return(pkg.User{}, assert.AnError)
+	mockUserRepo.EXPECT().CreateUser(gomock.Any()).Return(nil)
+	mockTokenRepo.EXPECT().DeleteUserTokens(gomock.Any(), pkg.TokenPurposeEmailVerification).Return(nil)
+	mockTokenRepo.EXPECT().CreateToken(gomock.Any()).Return(nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	handler := &pkg.Handler{
+		UserService:              userService,
+		EmailVerificationService: pkg.NewEmailVerificationService(mockTokenRepo, userService, outbox, "http://localhost", time.Hour),
+	}
+	router.POST("/auth/register", handler.Register)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(ctx, "POST", "/auth/register", strings.NewReader(`{"username":"newuser","password":"password123","email":"New@Example.com"}`))
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	require.Len(t, outbox.Messages(), 1)
+	assert.Equal(t, "new@example.com", outbox.Messages()[0].To)
+	assert.Contains(t, outbox.Messages()[0].Body, "/verify-email?token=")
+}
@@ -0,0 +1,193 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Takeso-user/blog-backend/config"
+	"github.com/Takeso-user/blog-backend/pkg"
+	"github.com/Takeso-user/blog-backend/pkg/mocks"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// memoryExports is an in-memory ExportRepositoryInterface; exports are
+// updated from a background goroutine, so access is locked.
+type memoryExports struct {
+	mu      sync.Mutex
+	exports map[primitive.ObjectID]pkg.DataExport
+}
+
+func newMemoryExports() *memoryExports {
+	return &memoryExports{exports: map[primitive.ObjectID]pkg.DataExport{}}
+}
+
+func (m *memoryExports) CreateExport(export pkg.DataExport) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.exports[export.ID] = export
+	return nil
+}
+
+func (m *memoryExports) GetUserExports(userID string) ([]pkg.DataExport, error) {
+	return m.filter(func(e pkg.DataExport) bool { return e.UserID == userID }), nil
+}
+
+func (m *memoryExports) GetExportByTokenHash(hash string) (pkg.DataExport, error) {
+	if found := m.filter(func(e pkg.DataExport) bool { return e.TokenHash == hash }); len(found) == 1 {
+		return found[0], nil
+	}
+	return pkg.DataExport{}, mongo.ErrNoDocuments
+}
+
+func (m *memoryExports) UpdateExport(id primitive.ObjectID, fields bson.M) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	export := m.exports[id]
+	if status, ok := fields["status"].(string); ok {
+		export.Status = status
+	}
+	if expiresAt, ok := fields["expires_at"].(time.Time); ok {
+		export.ExpiresAt = expiresAt
+	}
+	m.exports[id] = export
+	return nil
+}
+
+func (m *memoryExports) GetExpiredExports(now time.Time) ([]pkg.DataExport, error) {
+	return m.filter(func(e pkg.DataExport) bool { return !e.ExpiresAt.After(now) }), nil
+}
+
+func (m *memoryExports) DeleteExport(id primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.exports, id)
+	return nil
+}
+
+func (m *memoryExports) filter(match func(pkg.DataExport) bool) []pkg.DataExport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var found []pkg.DataExport
+	for _, export := range m.exports {
+		if match(export) {
+			found = append(found, export)
+		}
+	}
+	return found
+}
+
+func readArchive(t *testing.T, data []byte) map[string]string {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	files := map[string]string{}
+	for _, file := range archive.File {
+		r, err := file.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(r)
+		require.NoError(t, err)
+		files[file.Name] = string(content)
+	}
+	return files
+}
+
+func TestExport_WriteArchive(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	hashedPassword, _ := pkg.HashPassword("password123")
+	user := pkg.User{ID: primitive.NewObjectID(), Username: "exporter", Password: hashedPassword, Email: "exporter@example.com", TOTPSecret: "TOTPSECRET"}
+	mockPostRepo := mocks.NewMockPostRepositoryInterface(ctrl)
+	mockPostRepo.EXPECT().GetPostsByAuthor("exporter").Return([]pkg.Post{{Title: "<script>alert(1)</script>", AuthorID: "exporter"}}, nil)
+	mockCommentRepo := mocks.NewMockCommentRepositoryInterface(ctrl)
+	mockCommentRepo.EXPECT().GetCommentsByUser(user.ID.Hex()).Return(nil, nil)
+
+	service := pkg.NewExportService(newMemoryExports(), nil, config.ExportConfig{Dir: t.TempDir(), TTL: time.Hour}, "http://localhost:8080",
+		pkg.ProfileExportSection(),
+		pkg.PostsExportSection(pkg.NewPostService(mockPostRepo, globalCache)),
+		pkg.CommentsExportSection(pkg.NewCommentService(mockCommentRepo, nil, globalCache)),
+	)
+	var buf bytes.Buffer
+	require.NoError(t, service.WriteArchive(&buf, user, time.Now()))
+
+	files := readArchive(t, buf.Bytes())
+	require.Contains(t, files, "profile.json")
+	require.Contains(t, files, "posts.json")
+	require.Contains(t, files, "index.html")
+	assert.Equal(t, "[]", files["comments.json"])
+	assert.Contains(t, files["profile.json"], `"email": "exporter@example.com"`)
+	assert.NotContains(t, files["profile.json"], hashedPassword)
+	assert.NotContains(t, files["profile.json"], "TOTPSECRET")
+
+	var posts []pkg.Post
+	require.NoError(t, json.Unmarshal([]byte(files["posts.json"]), &posts))
+	assert.Len(t, posts, 1)
+	assert.Contains(t, files["index.html"], "Posts</a> (1)")
+	assert.NotContains(t, files["index.html"], "<script>")
+}
+
+func TestExport_StartDownloadAndPurge(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := pkg.User{ID: primitive.NewObjectID(), Username: "downloader", Email: "downloader@example.com", EmailVerified: true}
+	mockUserRepo := mocks.NewMockUserRepositoryInterface(ctrl)
+	mockUserRepo.EXPECT().GetUserByUsername("downloader").Return(user, nil).AnyTimes()
+
+	exports := newMemoryExports()
+	outbox := pkg.NewMemoryOutbox()
+	service := pkg.NewExportService(exports, outbox, config.ExportConfig{Dir: t.TempDir(), TTL: time.Hour}, "http://localhost:8080", pkg.ProfileExportSection())
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	handler := &pkg.Handler{UserService: pkg.NewUserService(mockUserRepo, globalCache), ExportService: service}
+	router.GET("/exports/:token", handler.DownloadExport)
+	me := router.Group("/api/me").Use(func(c *gin.Context) { c.Set("username", "downloader") })
+	me.POST("/export", handler.StartExport)
+
+	w := postJSON(router, "/api/me/export", gin.H{})
+	require.Equal(t, http.StatusAccepted, w.Code, w.Body.String())
+	var started struct {
+		DownloadURL string `json:"download_url"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &started))
+	path := strings.TrimPrefix(started.DownloadURL, "http://localhost:8080")
+	require.True(t, strings.HasPrefix(path, "/exports/"))
+	service.Wait()
+
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", path, nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+	assert.Contains(t, readArchive(t, w.Body.Bytes())["profile.json"], `"username": "downloader"`)
+
+	messages := outbox.Messages()
+	require.Len(t, messages, 1)
+	assert.Contains(t, messages[0].Body, started.DownloadURL)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/exports/not-a-token", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	require.NoError(t, service.PurgeExpired(time.Now().Add(2*time.Hour)))
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", path, nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, exports.exports)
+}
@@ -0,0 +1,168 @@
+package tests
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Takeso-user/blog-backend/config"
+	"github.com/Takeso-user/blog-backend/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func publish(t *testing.T, f *blogFixture, author, title string, tags ...string) {
+	require.NoError(t, f.posts.CreatePost(title, "Body of "+title, author, tags...))
+}
+
+type feedPage struct {
+	Posts      []pkg.Post `json:"posts"`
+	NextCursor string     `json:"next_cursor"`
+}
+
+// readFeed returns a page of dave's feed and the titles of its posts.
+func readFeed(t *testing.T, f *blogFixture, query string) (feedPage, []string) {
+	var page feedPage
+	require.Equal(t, http.StatusOK, f.do(t, "dave", "GET", "/api/feed?"+query, nil, &page))
+	titles := []string{}
+	for _, post := range page.Posts {
+		titles = append(titles, post.Title)
+	}
+	return page, titles
+}
+
+func testFeedConfig() config.FeedConfig {
+	return config.FeedConfig{FanoutThreshold: 1000, CacheSize: 3, CacheTTL: time.Minute, PageSize: 20, MaxPageSize: 100}
+}
+
+func TestFeed_FollowedAuthorsAndTags(t *testing.T) {
+	f := newBlogFixture(t)
+	f.feed.Config = testFeedConfig()
+	publish(t, f, "alice", "Alice on Go", "go")
+	publish(t, f, "bob", "Bob on Rust", "Rust")
+	publish(t, f, "carol", "Carol on cooking", "food")
+	publish(t, f, "alice", "Alice on Rust", "rust", "go")
+
+	_, titles := readFeed(t, f, "")
+	assert.Empty(t, titles, "nothing is followed yet")
+
+	require.Equal(t, http.StatusOK, f.request(t, "dave", "PUT", "/api/me/follows/authors/alice", nil).Code)
+	require.Equal(t, http.StatusOK, f.request(t, "dave", "PUT", "/api/me/follows/authors/alice", nil).Code, "following twice is fine")
+	require.Equal(t, http.StatusOK, f.request(t, "dave", "PUT", "/api/me/follows/tags/%23Rust", nil).Code)
+	assert.Equal(t, http.StatusNotFound, f.request(t, "dave", "PUT", "/api/me/follows/authors/nobody", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, f.request(t, "dave", "PUT", "/api/me/follows/authors/dave", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, f.request(t, "dave", "PUT", "/api/me/follows/tags/not%20a%20tag", nil).Code)
+
+	w := f.request(t, "dave", "GET", "/api/me/follows", nil)
+	assert.JSONEq(t, `{"authors":["alice"],"tags":["rust"]}`, w.Body.String())
+
+	page, titles := readFeed(t, f, "")
+	assert.Equal(t, []string{"Alice on Rust", "Bob on Rust", "Alice on Go"}, titles, "newest first, each post once")
+	assert.Empty(t, page.NextCursor)
+
+	require.Equal(t, http.StatusOK, f.request(t, "dave", "DELETE", "/api/me/follows/authors/alice", nil).Code)
+	_, titles = readFeed(t, f, "")
+	assert.Equal(t, []string{"Alice on Rust", "Bob on Rust"}, titles)
+
+	assert.Equal(t, http.StatusBadRequest, f.request(t, "dave", "GET", "/api/feed?cursor=garbage", nil).Code)
+}
+
+func TestFeed_PaginationIsStableWhilePostsArrive(t *testing.T) {
+	f := newBlogFixture(t)
+	f.feed.Config = testFeedConfig()
+	for _, title := range []string{"one", "two", "three", "four", "five"} {
+		publish(t, f, "bob", title)
+	}
+	require.Equal(t, http.StatusOK, f.request(t, "dave", "PUT", "/api/me/follows/authors/bob", nil).Code)
+
+	page, titles := readFeed(t, f, "limit=2")
+	assert.Equal(t, []string{"five", "four"}, titles)
+	require.NotEmpty(t, page.NextCursor)
+
+	publish(t, f, "bob", "six")
+	publish(t, f, "bob", "seven")
+
+	page, titles = readFeed(t, f, "limit=2&cursor="+page.NextCursor)
+	assert.Equal(t, []string{"three", "two"}, titles, "new posts do not shift later pages")
+	page, titles = readFeed(t, f, "limit=2&cursor="+page.NextCursor)
+	assert.Equal(t, []string{"one"}, titles)
+	assert.Empty(t, page.NextCursor, "the last page has no cursor")
+
+	_, titles = readFeed(t, f, "limit=2")
+	assert.Equal(t, []string{"seven", "six"}, titles)
+}
+
+func TestFeed_PopularAuthorsAreCached(t *testing.T) {
+	f := newBlogFixture(t)
+	f.feed.Config = testFeedConfig()
+	f.feed.Config.FanoutThreshold = 2
+	for _, title := range []string{"a1", "a2"} {
+		publish(t, f, "alice", title)
+	}
+	publish(t, f, "bob", "b1")
+	_, err := f.feed.FollowAuthor(f.users["carol"], "alice")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, f.request(t, "dave", "PUT", "/api/me/follows/authors/alice", nil).Code)
+	require.Equal(t, http.StatusOK, f.request(t, "dave", "PUT", "/api/me/follows/authors/bob", nil).Code)
+
+	_, titles := readFeed(t, f, "")
+	assert.Equal(t, []string{"b1", "a2", "a1"}, titles)
+
+	// New posts by alice are added to the cache as they are written, so
+	// her followers' feeds do not query her posts.
+	publish(t, f, "alice", "a3")
+	f.store.feedQueries = nil
+	page, titles := readFeed(t, f, "limit=2")
+	assert.Equal(t, []string{"a3", "b1"}, titles)
+	for _, authors := range f.store.feedQueries {
+		assert.NotContains(t, authors, "alice")
+	}
+
+	// Only the newest three posts are cached; older pages fall back to
+	// the database.
+	for _, title := range []string{"a4", "a5"} {
+		publish(t, f, "alice", title)
+	}
+	f.store.feedQueries = nil
+	_, titles = readFeed(t, f, "limit=2&cursor="+page.NextCursor)
+	assert.Equal(t, []string{"a2", "a1"}, titles)
+	assert.Contains(t, slices.Concat(f.store.feedQueries...), "alice")
+}
+
+func TestFeed_CachesAreSharedBetweenInstances(t *testing.T) {
+	f := newBlogFixture(t)
+	f.feed.Config = testFeedConfig()
+	f.feed.Config.FanoutThreshold = 1
+	broker := pkg.NewMemoryEventBroker()
+	first := newEventBus(broker, nil)
+	defer first.Close()
+	second := newEventBus(broker, nil)
+	defer second.Close()
+	f.feed.Listen(first)
+	other := pkg.NewFeedService(f.store, f.posts, f.feed.Users, f.feed.Config)
+	other.Listen(second)
+
+	publish(t, f, "alice", "a1")
+	_, err := f.feed.FollowAuthor(f.users["dave"], "alice")
+	require.NoError(t, err)
+	titles := func() []string {
+		posts, _, err := other.Feed(f.users["dave"], nil, 0)
+		require.NoError(t, err)
+		titles := []string{}
+		for _, post := range posts {
+			titles = append(titles, post.Title)
+		}
+		return titles
+	}
+	assert.Equal(t, []string{"a1"}, titles())
+
+	publish(t, f, "alice", "a2")
+	f.store.feedQueries = nil
+	assert.Equal(t, []string{"a2", "a1"}, titles(), "posts written on one instance reach the others' caches")
+	assert.Empty(t, f.store.feedQueries)
+
+	require.NoError(t, f.posts.DeletePost(f.postID("a2")))
+	assert.Equal(t, []string{"a1"}, titles(), "changed posts are forgotten everywhere")
+	assert.Len(t, f.store.feedQueries, 1)
+}
@@ -0,0 +1,875 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Takeso-user/blog-backend/config"
+	"github.com/Takeso-user/blog-backend/pkg"
+	"github.com/Takeso-user/blog-backend/pkg/mocks"
+	"github.com/Takeso-user/in-mem-cache/cache"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// fixtureUsers are the users every blogFixture starts with.
+var fixtureUsers = []string{"alice", "bob", "carol", "dave", "erin", "frank", "grace", "heidi"}
+
+// memoryStore keeps the documents of a blogFixture. The user, post and
+// comment repository mocks are served from it, and it is the in-memory
+// repository of reactions, bookmarks, reading lists, follows,
+// notifications and one-time tokens.
+type memoryStore struct {
+	mu        sync.Mutex
+	users     map[string]pkg.User
+	posts     []pkg.Post
+	comments  []pkg.Comment
+	reactions map[string]pkg.Reaction
+	bookmarks []pkg.Bookmark
+	lists     map[primitive.ObjectID]pkg.ReadingList
+	follows   []pkg.Follow
+	// notifications are kept in the order they were first added.
+	notifications []pkg.Notification
+	tokens        map[string]pkg.OneTimeToken
+	// feedQueries records the authors each feed query asked for.
+	feedQueries [][]string
+}
+
+func newMemoryStore() *memoryStore {
+	s := &memoryStore{
+		users:     map[string]pkg.User{},
+		reactions: map[string]pkg.Reaction{},
+		lists:     map[primitive.ObjectID]pkg.ReadingList{},
+		tokens:    map[string]pkg.OneTimeToken{},
+	}
+	for _, name := range fixtureUsers {
+		s.users[name] = pkg.User{ID: primitive.NewObjectID(), Username: name}
+	}
+	return s
+}
+
+func (s *memoryStore) GetUserByUsername(username string) (pkg.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if user, ok := s.users[username]; ok {
+		return user, nil
+	}
+	return pkg.User{}, mongo.ErrNoDocuments
+}
+
+func (s *memoryStore) GetUserByID(id string) (pkg.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, user := range s.users {
+		if user.ID.Hex() == id {
+			return user, nil
+		}
+	}
+	return pkg.User{}, mongo.ErrNoDocuments
+}
+
+func (s *memoryStore) UpdateUser(id primitive.ObjectID, fields bson.M) (pkg.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, user := range s.users {
+		if user.ID != id {
+			continue
+		}
+		if muted, ok := fields["muted_notifications"].([]string); ok {
+			user.MutedNotifications = muted
+		}
+		if restriction, ok := fields["restriction"].(pkg.Restriction); ok {
+			user.Restriction = &restriction
+		}
+		s.users[name] = user
+		return user, nil
+	}
+	return pkg.User{}, mongo.ErrNoDocuments
+}
+
+func (s *memoryStore) GetPosts() ([]pkg.Post, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	posts := make([]pkg.Post, len(s.posts))
+	for i, post := range s.posts {
+		post.Reactions = maps.Clone(post.Reactions)
+		posts[i] = post
+	}
+	return posts, nil
+}
+
+func (s *memoryStore) GetPostByID(id string) (pkg.Post, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, post := range s.posts {
+		if post.ID.Hex() == id {
+			post.Reactions = maps.Clone(post.Reactions)
+			return post, nil
+		}
+	}
+	return pkg.Post{}, mongo.ErrNoDocuments
+}
+
+func (s *memoryStore) CreatePost(post pkg.Post) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// MongoDB keeps times to the millisecond.
+	post.CreatedAt = post.CreatedAt.Truncate(time.Millisecond)
+	s.posts = append(s.posts, post)
+	return nil
+}
+
+func (s *memoryStore) GetFeedPosts(query pkg.FeedQuery) ([]pkg.Post, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.feedQueries = append(s.feedQueries, query.Authors)
+	var found []pkg.Post
+	for _, post := range s.posts {
+		source := slices.Contains(query.Authors, post.AuthorID) || slices.ContainsFunc(post.Tags, func(tag string) bool { return slices.Contains(query.Tags, tag) })
+		if source && (query.Before == nil || newerFirst(pkg.Post{ID: query.Before.ID, CreatedAt: query.Before.CreatedAt}, post) < 0) {
+			found = append(found, post)
+		}
+	}
+	slices.SortFunc(found, newerFirst)
+	return found[:min(len(found), int(query.Limit))], nil
+}
+
+func newerFirst(a, b pkg.Post) int {
+	if a.CreatedAt.UnixMilli() != b.CreatedAt.UnixMilli() {
+		return int(b.CreatedAt.UnixMilli() - a.CreatedAt.UnixMilli())
+	}
+	return strings.Compare(b.ID.Hex(), a.ID.Hex())
+}
+
+func (s *memoryStore) GetPostsByIDs(ids []string) ([]pkg.Post, error) {
+	var posts []pkg.Post
+	for _, id := range ids {
+		if post, err := s.GetPostByID(id); err == nil {
+			posts = append(posts, post)
+		}
+	}
+	return posts, nil
+}
+
+func (s *memoryStore) DeletePost(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.posts = slices.DeleteFunc(s.posts, func(p pkg.Post) bool { return p.ID.Hex() == id })
+	return nil
+}
+
+func (s *memoryStore) IncrementPostReactions(id string, deltas map[string]int) (map[string]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, post := range s.posts {
+		if post.ID.Hex() == id {
+			s.posts[i].Reactions = addReactions(post.Reactions, deltas)
+			return maps.Clone(s.posts[i].Reactions), nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func (s *memoryStore) AddComment(comment pkg.Comment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.comments = append(s.comments, comment)
+	return nil
+}
+
+func (s *memoryStore) GetCommentByID(id string) (pkg.Comment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, comment := range s.comments {
+		if comment.ID.Hex() == id {
+			comment.Reactions = maps.Clone(comment.Reactions)
+			return comment, nil
+		}
+	}
+	return pkg.Comment{}, mongo.ErrNoDocuments
+}
+
+func (s *memoryStore) DeleteComment(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, comment := range s.comments {
+		if comment.ID.Hex() == id {
+			s.comments = append(s.comments[:i], s.comments[i+1:]...)
+			return nil
+		}
+	}
+	return mongo.ErrNoDocuments
+}
+
+func (s *memoryStore) IncrementCommentReactions(id string, deltas map[string]int) (map[string]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, comment := range s.comments {
+		if comment.ID.Hex() == id {
+			s.comments[i].Reactions = addReactions(comment.Reactions, deltas)
+			return maps.Clone(s.comments[i].Reactions), nil
+		}
+	}
+	return nil, mongo.ErrNoDocuments
+}
+
+func addReactions(counts map[string]int64, deltas map[string]int) map[string]int64 {
+	if counts == nil {
+		counts = map[string]int64{}
+	}
+	for reaction, delta := range deltas {
+		counts[reaction] += int64(delta)
+	}
+	return counts
+}
+
+func (s *memoryStore) SetReaction(reaction pkg.Reaction) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous, ok := s.reactions[reaction.ID]
+	if ok {
+		reaction.CreatedAt = previous.CreatedAt
+	}
+	s.reactions[reaction.ID] = reaction
+	return previous.Type, nil
+}
+
+func (s *memoryStore) DeleteReaction(id, reactionType string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.reactions[id].Type != reactionType {
+		return false, nil
+	}
+	delete(s.reactions, id)
+	return true, nil
+}
+
+func (s *memoryStore) GetUserReactions(userID, targetType string, targetIDs []string) (map[string]string, error) {
+	types := map[string]string{}
+	for _, reaction := range s.findReactions(func(r pkg.Reaction) bool { return r.UserID == userID && r.TargetType == targetType }) {
+		types[reaction.TargetID] = reaction.Type
+	}
+	return types, nil
+}
+
+func (s *memoryStore) GetReactionsByUser(userID string) ([]pkg.Reaction, error) {
+	return s.findReactions(func(r pkg.Reaction) bool { return r.UserID == userID }), nil
+}
+
+func (s *memoryStore) DeleteReactionsByTarget(targetType string, targetIDs []string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var deleted int64
+	for id, reaction := range s.reactions {
+		for _, targetID := range targetIDs {
+			if reaction.TargetType == targetType && reaction.TargetID == targetID {
+				delete(s.reactions, id)
+				deleted++
+			}
+		}
+	}
+	return deleted, nil
+}
+
+func (s *memoryStore) findReactions(match func(pkg.Reaction) bool) []pkg.Reaction {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var found []pkg.Reaction
+	for _, reaction := range s.reactions {
+		if match(reaction) {
+			found = append(found, reaction)
+		}
+	}
+	return found
+}
+
+func (s *memoryStore) CreateBookmark(bookmark pkg.Bookmark) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, other := range s.bookmarks {
+		if other.UserID == bookmark.UserID && other.PostID == bookmark.PostID {
+			return mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000}}}
+		}
+	}
+	s.bookmarks = append(s.bookmarks, bookmark)
+	return nil
+}
+
+func (s *memoryStore) GetBookmarkByID(id string) (pkg.Bookmark, error) {
+	return s.findBookmark(func(b pkg.Bookmark) bool { return b.ID.Hex() == id })
+}
+
+func (s *memoryStore) GetBookmarkByPost(userID, postID string) (pkg.Bookmark, error) {
+	return s.findBookmark(func(b pkg.Bookmark) bool { return b.UserID == userID && b.PostID == postID })
+}
+
+func (s *memoryStore) GetBookmarks(filter pkg.BookmarkFilter) ([]pkg.Bookmark, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var found []pkg.Bookmark
+	for i := len(s.bookmarks) - 1; i >= 0; i-- {
+		bookmark := s.bookmarks[i]
+		if (filter.UserID == "" || bookmark.UserID == filter.UserID) && (filter.ListID == "" || bookmark.ListID == filter.ListID) {
+			found = append(found, bookmark)
+		}
+	}
+	total := int64(len(found))
+	found = found[min(filter.Offset, total):]
+	if filter.Limit > 0 {
+		found = found[:min(filter.Limit, int64(len(found)))]
+	}
+	return found, total, nil
+}
+
+func (s *memoryStore) UpdateBookmark(id primitive.ObjectID, updateFields bson.M) (pkg.Bookmark, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, bookmark := range s.bookmarks {
+		if bookmark.ID != id {
+			continue
+		}
+		if listID, ok := updateFields["list_id"].(string); ok {
+			s.bookmarks[i].ListID = listID
+		}
+		if note, ok := updateFields["note"].(string); ok {
+			s.bookmarks[i].Note = note
+		}
+		return s.bookmarks[i], nil
+	}
+	return pkg.Bookmark{}, mongo.ErrNoDocuments
+}
+
+func (s *memoryStore) DeleteBookmark(id primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.bookmarks = slices.DeleteFunc(s.bookmarks, func(b pkg.Bookmark) bool { return b.ID == id })
+	return nil
+}
+
+func (s *memoryStore) MarkBookmarkedPostsDeleted(postIDs []string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var marked int64
+	for i, bookmark := range s.bookmarks {
+		if slices.Contains(postIDs, bookmark.PostID) {
+			s.bookmarks[i].PostDeleted = true
+			marked++
+		}
+	}
+	return marked, nil
+}
+
+func (s *memoryStore) ClearBookmarkList(listID string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var cleared int64
+	for i, bookmark := range s.bookmarks {
+		if bookmark.ListID == listID {
+			s.bookmarks[i].ListID = ""
+			cleared++
+		}
+	}
+	return cleared, nil
+}
+
+func (s *memoryStore) DeleteBookmarksByUser(userID string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before := len(s.bookmarks)
+	s.bookmarks = slices.DeleteFunc(s.bookmarks, func(b pkg.Bookmark) bool { return b.UserID == userID })
+	return int64(before - len(s.bookmarks)), nil
+}
+
+func (s *memoryStore) findBookmark(match func(pkg.Bookmark) bool) (pkg.Bookmark, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, bookmark := range s.bookmarks {
+		if match(bookmark) {
+			return bookmark, nil
+		}
+	}
+	return pkg.Bookmark{}, mongo.ErrNoDocuments
+}
+
+func (s *memoryStore) CreateReadingList(list pkg.ReadingList) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lists[list.ID] = list
+	return nil
+}
+
+func (s *memoryStore) GetReadingListByID(id string) (pkg.ReadingList, error) {
+	return s.findList(func(l pkg.ReadingList) bool { return l.ID.Hex() == id })
+}
+
+func (s *memoryStore) GetReadingListByToken(token string) (pkg.ReadingList, error) {
+	return s.findList(func(l pkg.ReadingList) bool { return l.ShareToken == token })
+}
+
+func (s *memoryStore) GetReadingLists(ownerID string) ([]pkg.ReadingList, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	lists := []pkg.ReadingList{}
+	for _, list := range s.lists {
+		if list.OwnerID == ownerID {
+			lists = append(lists, list)
+		}
+	}
+	slices.SortFunc(lists, func(a, b pkg.ReadingList) int { return strings.Compare(a.Name, b.Name) })
+	return lists, nil
+}
+
+func (s *memoryStore) CountReadingLists(ownerID string) (int64, error) {
+	lists, err := s.GetReadingLists(ownerID)
+	return int64(len(lists)), err
+}
+
+func (s *memoryStore) UpdateReadingList(id primitive.ObjectID, updateFields bson.M) (pkg.ReadingList, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list, ok := s.lists[id]
+	if !ok {
+		return pkg.ReadingList{}, mongo.ErrNoDocuments
+	}
+	if name, ok := updateFields["name"].(string); ok {
+		list.Name = name
+	}
+	if description, ok := updateFields["description"].(string); ok {
+		list.Description = description
+	}
+	if public, ok := updateFields["public"].(bool); ok {
+		list.Public = public
+	}
+	if token, ok := updateFields["share_token"].(string); ok {
+		list.ShareToken = token
+	}
+	s.lists[id] = list
+	return list, nil
+}
+
+func (s *memoryStore) DeleteReadingList(id primitive.ObjectID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.lists, id)
+	return nil
+}
+
+func (s *memoryStore) DeleteReadingListsByOwner(ownerID string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var deleted int64
+	for id, list := range s.lists {
+		if list.OwnerID == ownerID {
+			delete(s.lists, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (s *memoryStore) findList(match func(pkg.ReadingList) bool) (pkg.ReadingList, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, list := range s.lists {
+		if match(list) {
+			return list, nil
+		}
+	}
+	return pkg.ReadingList{}, mongo.ErrNoDocuments
+}
+
+func (s *memoryStore) Follow(follow pkg.Follow) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, other := range s.follows {
+		if other.FollowerID == follow.FollowerID && other.Kind == follow.Kind && other.Target == follow.Target {
+			return false, nil
+		}
+	}
+	s.follows = append(s.follows, follow)
+	return true, nil
+}
+
+func (s *memoryStore) Unfollow(followerID, kind, target string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before := len(s.follows)
+	s.follows = slices.DeleteFunc(s.follows, func(f pkg.Follow) bool {
+		return f.FollowerID == followerID && f.Kind == kind && f.Target == target
+	})
+	return len(s.follows) < before, nil
+}
+
+func (s *memoryStore) GetFollows(followerID string) ([]pkg.Follow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	follows := []pkg.Follow{}
+	for _, follow := range s.follows {
+		if follow.FollowerID == followerID {
+			follows = append(follows, follow)
+		}
+	}
+	return follows, nil
+}
+
+func (s *memoryStore) CountFollowers(kind string, targets []string) (map[string]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := map[string]int64{}
+	for _, follow := range s.follows {
+		if follow.Kind == kind && slices.Contains(targets, follow.Target) {
+			counts[follow.Target]++
+		}
+	}
+	return counts, nil
+}
+
+func (s *memoryStore) RenameFollowTarget(kind, from, to string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var renamed int64
+	for i, follow := range s.follows {
+		if follow.Kind == kind && follow.Target == from {
+			s.follows[i].Target = to
+			renamed++
+		}
+	}
+	return renamed, nil
+}
+
+func (s *memoryStore) DeleteFollowsByFollower(followerID string) (int64, error) {
+	return s.deleteFunc(func(f pkg.Follow) bool { return f.FollowerID == followerID })
+}
+
+func (s *memoryStore) DeleteFollowsByTarget(kind, target string) (int64, error) {
+	return s.deleteFunc(func(f pkg.Follow) bool { return f.Kind == kind && f.Target == target })
+}
+
+func (s *memoryStore) deleteFunc(match func(pkg.Follow) bool) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before := len(s.follows)
+	s.follows = slices.DeleteFunc(s.follows, match)
+	return int64(before - len(s.follows)), nil
+}
+
+func (s *memoryStore) AddNotification(notification pkg.Notification) (pkg.Notification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, other := range s.notifications {
+		if other.UserID != notification.UserID || other.GroupKey != notification.GroupKey || other.Read {
+			continue
+		}
+		if !slices.Contains(other.ActorIDs, notification.ActorIDs[0]) {
+			other.ActorIDs = append(slices.Clone(notification.ActorIDs), other.ActorIDs...)
+			other.Actors = append(slices.Clone(notification.Actors), other.Actors...)
+			if len(other.ActorIDs) > 3 {
+				other.ActorIDs, other.Actors = other.ActorIDs[:3], other.Actors[:3]
+			}
+			other.ActorCount++
+		}
+		other.UpdatedAt = notification.UpdatedAt
+		if notification.CommentID != "" {
+			other.CommentID = notification.CommentID
+		}
+		s.notifications[i] = other
+		return other, nil
+	}
+	s.notifications = append(s.notifications, notification)
+	return notification, nil
+}
+
+func (s *memoryStore) GetNotifications(filter pkg.NotificationFilter) ([]pkg.Notification, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	found := []pkg.Notification{}
+	for _, notification := range s.notifications {
+		if notification.UserID == filter.UserID && !(filter.UnreadOnly && notification.Read) {
+			found = append(found, notification)
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].UpdatedAt.After(found[j].UpdatedAt) })
+	total := int64(len(found))
+	found = found[min(filter.Offset, total):]
+	if filter.Limit > 0 {
+		found = found[:min(filter.Limit, int64(len(found)))]
+	}
+	return found, total, nil
+}
+
+func (s *memoryStore) CountUnreadNotifications(userID string) (int64, error) {
+	unread, _, err := s.GetNotifications(pkg.NotificationFilter{UserID: userID, UnreadOnly: true})
+	return int64(len(unread)), err
+}
+
+func (s *memoryStore) MarkNotificationRead(userID, id string) (pkg.Notification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, notification := range s.notifications {
+		if notification.ID.Hex() == id && notification.UserID == userID {
+			s.notifications[i].Read = true
+			return s.notifications[i], nil
+		}
+	}
+	return pkg.Notification{}, mongo.ErrNoDocuments
+}
+
+func (s *memoryStore) MarkAllNotificationsRead(userID string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var updated int64
+	for i, notification := range s.notifications {
+		if notification.UserID == userID && !notification.Read {
+			s.notifications[i].Read = true
+			updated++
+		}
+	}
+	return updated, nil
+}
+
+func (s *memoryStore) RenameNotificationActor(actorID, from, to string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var renamed int64
+	for _, notification := range s.notifications {
+		if slices.Contains(notification.ActorIDs, actorID) {
+			for i, actor := range notification.Actors {
+				if actor == from {
+					notification.Actors[i] = to
+				}
+			}
+			renamed++
+		}
+	}
+	return renamed, nil
+}
+
+func (s *memoryStore) DeleteNotificationsByUser(userID string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	before := len(s.notifications)
+	s.notifications = slices.DeleteFunc(s.notifications, func(n pkg.Notification) bool { return n.UserID == userID })
+	return int64(before - len(s.notifications)), nil
+}
+
+func (s *memoryStore) CreateToken(token pkg.OneTimeToken) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[token.Hash] = token
+	return nil
+}
+
+func (s *memoryStore) ConsumeToken(purpose, hash string, now time.Time) (pkg.OneTimeToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	token, ok := s.tokens[hash]
+	if !ok || token.Purpose != purpose || token.UsedAt != nil || !now.Before(token.ExpiresAt) {
+		return pkg.OneTimeToken{}, mongo.ErrNoDocuments
+	}
+	token.UsedAt = &now
+	s.tokens[hash] = token
+	return token, nil
+}
+
+func (s *memoryStore) DeleteUserTokens(userID, purpose string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for hash, token := range s.tokens {
+		if token.UserID == userID && token.Purpose == purpose {
+			delete(s.tokens, hash)
+		}
+	}
+	return nil
+}
+
+// blogFixture is a blog whose documents live in a memoryStore, with every
+// social feature wired up and routed. Requests are made as the user named
+// by the X-User header.
+type blogFixture struct {
+	router    *gin.Engine
+	store     *memoryStore
+	users     map[string]pkg.User
+	posts     *pkg.PostService
+	comments  *pkg.CommentService
+	reactions *pkg.ReactionService
+	feed      *pkg.FeedService
+	// notifications is the NotificationService; store holds what it adds.
+	notifications *pkg.NotificationService
+	streams       *pkg.StreamService
+}
+
+func newBlogFixture(t *testing.T) *blogFixture {
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+
+	store := newMemoryStore()
+	f := &blogFixture{store: store, users: maps.Clone(store.users)}
+	cfg := config.Default()
+
+	mockUserRepo := mocks.NewMockUserRepositoryInterface(ctrl)
+	mockUserRepo.EXPECT().GetUserByUsername(gomock.Any()).DoAndReturn(store.GetUserByUsername).AnyTimes()
+	mockUserRepo.EXPECT().GetUserByID(gomock.Any()).DoAndReturn(store.GetUserByID).AnyTimes()
+	mockUserRepo.EXPECT().UpdateUser(gomock.Any(), gomock.Any()).DoAndReturn(store.UpdateUser).AnyTimes()
+	mockPostRepo := mocks.NewMockPostRepositoryInterface(ctrl)
+	mockPostRepo.EXPECT().CreatePost(gomock.Any()).DoAndReturn(store.CreatePost).AnyTimes()
+	mockPostRepo.EXPECT().GetPosts().DoAndReturn(store.GetPosts).AnyTimes()
+	mockPostRepo.EXPECT().GetPostByID(gomock.Any()).DoAndReturn(store.GetPostByID).AnyTimes()
+	mockPostRepo.EXPECT().GetPostsByIDs(gomock.Any()).DoAndReturn(store.GetPostsByIDs).AnyTimes()
+	mockPostRepo.EXPECT().DeletePost(gomock.Any()).DoAndReturn(store.DeletePost).AnyTimes()
+	mockPostRepo.EXPECT().GetFeedPosts(gomock.Any()).DoAndReturn(store.GetFeedPosts).AnyTimes()
+	mockPostRepo.EXPECT().IncrementPostReactions(gomock.Any(), gomock.Any()).DoAndReturn(store.IncrementPostReactions).AnyTimes()
+	mockCommentRepo := mocks.NewMockCommentRepositoryInterface(ctrl)
+	mockCommentRepo.EXPECT().AddComment(gomock.Any()).DoAndReturn(store.AddComment).AnyTimes()
+	mockCommentRepo.EXPECT().GetCommentByID(gomock.Any()).DoAndReturn(store.GetCommentByID).AnyTimes()
+	mockCommentRepo.EXPECT().DeleteComment(gomock.Any()).DoAndReturn(store.DeleteComment).AnyTimes()
+	mockCommentRepo.EXPECT().IncrementCommentReactions(gomock.Any(), gomock.Any()).DoAndReturn(store.IncrementCommentReactions).AnyTimes()
+
+	// The fixture's users and posts are kept out of the shared cache.
+	fixtureCache := cache.NewCache(time.Minute)
+	userService := pkg.NewUserService(mockUserRepo, fixtureCache)
+	f.posts = pkg.NewPostService(mockPostRepo, fixtureCache)
+	f.comments = pkg.NewCommentService(mockCommentRepo, userService, fixtureCache)
+	f.reactions = pkg.NewReactionService(store, f.posts, f.comments, cfg.Reactions)
+	f.feed = pkg.NewFeedService(store, f.posts, userService, cfg.Feed)
+	f.notifications = pkg.NewNotificationService(store, userService, f.posts, f.comments, cfg.Notifications)
+	f.posts.Reactions = store
+	f.posts.Bookmarks = store
+	f.posts.Feed = f.feed
+	f.posts.Notifications = f.notifications
+	f.comments.Reactions = store
+	f.comments.Notifications = f.notifications
+	f.reactions.Notifications = f.notifications
+	bus := pkg.NewEventBus(pkg.NewMemoryEventBroker(), cfg.Events)
+	t.Cleanup(bus.Close)
+	f.posts.Events = bus
+	f.comments.Events = bus
+	f.reactions.Events = bus
+	f.notifications.Events = bus
+	f.streams = pkg.NewStreamService(bus, f.posts, userService, store, nil, cfg.Events)
+
+	handler := pkg.NewHandler(f.posts, f.comments, userService)
+	handler.ReactionService = f.reactions
+	handler.FeedService = f.feed
+	handler.NotificationService = f.notifications
+	handler.StreamService = f.streams
+	handler.BookmarkService = pkg.NewBookmarkService(store, store, f.posts, "https://blog.example.com/")
+
+	gin.SetMode(gin.TestMode)
+	f.router = gin.Default()
+	auth := func(c *gin.Context) { c.Set("username", c.GetHeader("X-User")) }
+	f.router.GET("/reading-lists/:token", handler.GetSharedReadingList)
+	f.router.GET("/api/stream", pkg.StreamAuthMiddleware(f.streams, auth), handler.Stream)
+	api := f.router.Group("/api").Use(auth)
+	api.GET("/posts", handler.GetPosts)
+	api.POST("/posts/:id/comments", handler.AddComment)
+	api.DELETE("/posts/:id", handler.DeletePost)
+	api.DELETE("/posts/comments/:commentID", handler.DeleteComment)
+	api.GET("/reactions", handler.GetReactionTypes)
+	api.PUT("/posts/:id/reactions/:type", handler.ReactToPost)
+	api.DELETE("/posts/:id/reactions/:type", handler.RemovePostReaction)
+	api.PUT("/posts/comments/:commentID/reactions/:type", handler.ReactToComment)
+	api.DELETE("/posts/comments/:commentID/reactions/:type", handler.RemoveCommentReaction)
+	api.GET("/me/bookmarks", handler.GetBookmarks)
+	api.POST("/me/bookmarks", handler.AddBookmark)
+	api.PATCH("/me/bookmarks/:id", handler.UpdateBookmark)
+	api.DELETE("/me/bookmarks/:id", handler.DeleteBookmark)
+	api.GET("/me/reading-lists", handler.GetReadingLists)
+	api.POST("/me/reading-lists", handler.CreateReadingList)
+	api.PATCH("/me/reading-lists/:id", handler.UpdateReadingList)
+	api.DELETE("/me/reading-lists/:id", handler.DeleteReadingList)
+	api.GET("/feed", handler.GetFeed)
+	api.GET("/me/follows", handler.GetFollows)
+	api.PUT("/me/follows/authors/:username", handler.FollowAuthor)
+	api.DELETE("/me/follows/authors/:username", handler.UnfollowAuthor)
+	api.PUT("/me/follows/tags/:tag", handler.FollowTag)
+	api.DELETE("/me/follows/tags/:tag", handler.UnfollowTag)
+	api.GET("/notifications", handler.GetNotifications)
+	api.GET("/notifications/unread-count", handler.GetUnreadNotificationCount)
+	api.POST("/notifications/read-all", handler.MarkAllNotificationsRead)
+	api.POST("/notifications/:id/read", handler.MarkNotificationRead)
+	api.GET("/me/notification-preferences", handler.GetNotificationPreferences)
+	api.PUT("/me/notification-preferences", handler.UpdateNotificationPreferences)
+	api.POST("/stream/tickets", handler.CreateStreamTicket)
+	return f
+}
+
+// addPost stores a post without going through PostService.
+func (f *blogFixture) addPost(author, title string) pkg.Post {
+	post := pkg.Post{ID: primitive.NewObjectID(), Title: title, AuthorID: author, CreatedAt: time.Now()}
+	f.store.mu.Lock()
+	defer f.store.mu.Unlock()
+	f.store.posts = append(f.store.posts, post)
+	return post
+}
+
+// postID returns the ID of the post with the given title.
+func (f *blogFixture) postID(title string) string {
+	f.store.mu.Lock()
+	defer f.store.mu.Unlock()
+	for _, post := range f.store.posts {
+		if post.Title == title {
+			return post.ID.Hex()
+		}
+	}
+	return ""
+}
+
+// addComment stores a comment without going through CommentService.
+func (f *blogFixture) addComment(post pkg.Post, author, content string) pkg.Comment {
+	comment := pkg.Comment{ID: primitive.NewObjectID(), PostID: post.ID.Hex(), UserID: f.users[author].ID.Hex(), Username: author, Content: content}
+	f.store.mu.Lock()
+	defer f.store.mu.Unlock()
+	f.store.comments = append(f.store.comments, comment)
+	return comment
+}
+
+// comment comments on the post as the user through the API and returns
+// the stored comment.
+func (f *blogFixture) comment(t *testing.T, user string, post pkg.Post, parentID, content string) pkg.Comment {
+	w := f.request(t, user, "POST", "/api/posts/"+post.ID.Hex()+"/comments", gin.H{
+		"content": content, "parent_id": parentID,
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	f.store.mu.Lock()
+	defer f.store.mu.Unlock()
+	return f.store.comments[len(f.store.comments)-1]
+}
+
+// request sends a request as the user with an optional JSON body.
+func (f *blogFixture) request(t *testing.T, user, method, path string, body any) *httptest.ResponseRecorder {
+	var payload []byte
+	if body != nil {
+		var err error
+		payload, err = json.Marshal(body)
+		require.NoError(t, err)
+	}
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest(method, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User", user)
+	f.router.ServeHTTP(w, req)
+	return w
+}
+
+// do sends a request like request and decodes a successful response into
+// out.
+func (f *blogFixture) do(t *testing.T, user, method, path string, body, out any) int {
+	w := f.request(t, user, method, path, body)
+	if out != nil && w.Code < 300 {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), out), w.Body.String())
+	}
+	return w.Code
+}
@@ -10,7 +10,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"golang.org/x/crypto/bcrypt"
+	"go.mongodb.org/mongo-driver/mongo"
 
 	"github.com/Takeso-user/blog-backend/pkg"
 	"github.com/Takeso-user/blog-backend/pkg/mocks"
@@ -40,6 +40,58 @@ func TestRegister(t *testing.T) {
 	assert.Contains(t, w.Body.String(), "User registered successfully")
 }
 
+func TestRegister_UsernameTaken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockUserService := mocks.NewMockUserRepositoryInterface(ctrl)
+	userService := pkg.NewUserService(mockUserService, globalCache)
+	mockUserService.EXPECT().CreateUser(gomock.Any()).Return(mongo.WriteException{WriteErrors: mongo.WriteErrors{{
+		Code:    11000,
+		Message: `E11000 duplicate key error collection: blog.users index: username_1 dup key: { username: "testuser" }`,
+	}}})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	handler := &pkg.Handler{UserService: userService}
+	router.POST("/auth/register", handler.Register)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(context.Background(), "POST", "/auth/register", strings.NewReader(`{"username":"testuser","password":"password123"}`))
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), pkg.ErrUsernameTaken.Error())
+}
+
+func TestRegister_IgnoresPrivilegedFields(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockUserService := mocks.NewMockUserRepositoryInterface(ctrl)
+	userService := pkg.NewUserService(mockUserService, globalCache)
+	var created pkg.User
+	mockUserService.EXPECT().CreateUser(gomock.Any()).DoAndReturn(func(user pkg.User) error {
+		created = user
+		return nil
+	})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	handler := &pkg.Handler{UserService: userService}
+	router.POST("/auth/register", handler.Register)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(context.Background(), "POST", "/auth/register", strings.NewReader(
+		`{"username":"mallory","password":"password123","role":"Admin","totp_enabled":true,"password_reset_required":true,"restriction":{"type":"ban"},"identities":[{"provider":"x","subject":"y"}]}`))
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "user", created.Role)
+	assert.False(t, created.TOTPEnabled)
+	assert.False(t, created.PasswordResetRequired)
+	assert.Nil(t, created.Restriction)
+	assert.Empty(t, created.Identities)
+}
+
 func TestLogin(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -48,8 +100,8 @@ func TestLogin(t *testing.T) {
 	userService := pkg.NewUserService(mockUserService, globalCache)
 
 	// Hash the password used in the test
-	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
-	mockUserService.EXPECT().GetUserByUsername("testuser").Return(pkg.User{Username: "testuser", Password: string(hashedPassword)}, nil)
+	hashedPassword, _ := pkg.HashPassword("password123")
+	mockUserService.EXPECT().GetUserByUsername("testuser").Return(pkg.User{Username: "testuser", Password: hashedPassword}, nil)
 
 	gin.SetMode(gin.TestMode)
 	router := gin.Default()
@@ -70,7 +122,7 @@ func TestGetUsers(t *testing.T) {
 	ctx := context.Background()
 	mockUserService := mocks.NewMockUserRepositoryInterface(ctrl)
 	userService := pkg.NewUserService(mockUserService, globalCache)
-	mockUserService.EXPECT().GetUsers().Return([]pkg.User{{Username: "testuser"}}, nil)
+	mockUserService.EXPECT().GetUsers().Return([]pkg.User{{Username: "testuser", Password: "$argon2id$secret-hash"}}, nil)
 
 	gin.SetMode(gin.TestMode)
 	router := gin.Default()
@@ -83,6 +135,7 @@ func TestGetUsers(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, w.Code)
 	assert.Contains(t, w.Body.String(), "testuser")
+	assert.NotContains(t, w.Body.String(), "secret-hash")
 }
 
 func TestCreatePost(t *testing.T) {
@@ -90,16 +143,21 @@ func TestCreatePost(t *testing.T) {
 	defer ctrl.Finish()
 	ctx := context.Background()
 	mockPostService := mocks.NewMockPostRepositoryInterface(ctrl)
+	mockUserService := mocks.NewMockUserRepositoryInterface(ctrl)
 	postService := pkg.NewPostService(mockPostService, globalCache)
-	mockPostService.EXPECT().CreatePost(gomock.Any()).Return(nil)
+	mockUserService.EXPECT().GetUserByUsername("postauthor").Return(pkg.User{ID: primitive.NewObjectID(), Username: "postauthor"}, nil)
+	mockPostService.EXPECT().CreatePost(gomock.Any()).DoAndReturn(func(post pkg.Post) error {
+		assert.Equal(t, "postauthor", post.AuthorID, "the author comes from the token, not the body")
+		return nil
+	})
 
 	gin.SetMode(gin.TestMode)
 	router := gin.Default()
-	handler := &pkg.Handler{PostService: postService}
-	router.POST("/posts", handler.CreatePost)
+	handler := &pkg.Handler{PostService: postService, UserService: pkg.NewUserService(mockUserService, globalCache)}
+	router.POST("/posts", func(c *gin.Context) { c.Set("username", "postauthor") }, handler.CreatePost)
 
 	w := httptest.NewRecorder()
-	req, _ := http.NewRequestWithContext(ctx, "POST", "/posts", strings.NewReader(`{"title":"Test Title","content":"Test Content","author_id":"authorID"}`))
+	req, _ := http.NewRequestWithContext(ctx, "POST", "/posts", strings.NewReader(`{"title":"Test Title","content":"Test Content","author_id":"someoneelse"}`))
 	router.ServeHTTP(w, req)
 
 	assert.Equal(t, http.StatusOK, w.Code)
@@ -114,15 +172,18 @@ func TestAddComment(t *testing.T) {
 	mockUserService := mocks.NewMockUserRepositoryInterface(ctrl)
 	commentService := pkg.NewCommentService(mockCommentService, pkg.NewUserService(mockUserService, globalCache), globalCache)
 
-	// Convert userID to primitive.ObjectID
-	userID, _ := primitive.ObjectIDFromHex("000000000000000000000000")
-	mockUserService.EXPECT().GetUserByID(userID.Hex()).Return(pkg.User{ID: userID, Username: "testuser"}, nil)
-	mockCommentService.EXPECT().AddComment(gomock.Any()).Return(nil)
+	user := pkg.User{ID: primitive.NewObjectID(), Username: "commenter"}
+	mockUserService.EXPECT().GetUserByUsername("commenter").Return(user, nil).AnyTimes()
+	mockUserService.EXPECT().GetUserByID(user.ID.Hex()).Return(user, nil).AnyTimes()
+	mockCommentService.EXPECT().AddComment(gomock.Any()).DoAndReturn(func(comment pkg.Comment) error {
+		assert.Equal(t, user.ID.Hex(), comment.UserID, "the commenter comes from the token, not the body")
+		return nil
+	})
 
 	gin.SetMode(gin.TestMode)
 	router := gin.Default()
-	handler := &pkg.Handler{CommentService: commentService}
-	router.POST("/posts/:id/comments", handler.AddComment)
+	handler := &pkg.Handler{CommentService: commentService, UserService: pkg.NewUserService(mockUserService, globalCache)}
+	router.POST("/posts/:id/comments", func(c *gin.Context) { c.Set("username", "commenter") }, handler.AddComment)
 
 	w := httptest.NewRecorder()
 	req, _ := http.NewRequestWithContext(ctx, "POST", "/posts/postID/comments", strings.NewReader(`{"user_id":"000000000000000000000000","content":"Test Comment"}`))
@@ -286,7 +347,7 @@ func TestUpdateComment(t *testing.T) {
 	mockCommentService.EXPECT().UpdateComment(
 		context.TODO(),
 		bson.M{"_id": validObjectID},
-		bson.M{"$set": bson.M{"content": "Updated Comment"}},
+		bson.M{"$set": bson.M{"content": "Updated Comment", "content_html": "<p>Updated Comment</p>\n"}},
 	).Return(pkg.Comment{Content: "Updated Comment"}, nil)
 
 	gin.SetMode(gin.TestMode)
@@ -0,0 +1,254 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io/fs"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Takeso-user/blog-backend/pkg"
+	"github.com/Takeso-user/blog-backend/pkg/mocks"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/image/webp"
+)
+
+// testPhoto is a landscape gradient with some noise, like a small photo.
+func testPhoto(width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	random := rand.New(rand.NewSource(1))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 4), G: uint8(y * 4), B: uint8(128 + random.Intn(16)), A: 255})
+		}
+	}
+	return img
+}
+
+// withEXIF inserts an EXIF segment carrying the orientation, and a comment,
+// after the start of a JPEG.
+func withEXIF(t *testing.T, img image.Image, orientation uint16) []byte {
+	var encoded bytes.Buffer
+	require.NoError(t, jpeg.Encode(&encoded, img, &jpeg.Options{Quality: 90}))
+
+	var tiff bytes.Buffer
+	tiff.WriteString("MM\x00\x2a")
+	// One IFD entry: tag, type SHORT, count 1, value padded to 4 bytes.
+	for _, field := range []any{uint32(8), uint16(1), uint16(0x0112), uint16(3), uint32(1), orientation, uint16(0), uint32(0)} {
+		require.NoError(t, binary.Write(&tiff, binary.BigEndian, field))
+	}
+	exif := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	comment := []byte("taken at 52.5200N 13.4050E")
+
+	data := encoded.Bytes()
+	out := append([]byte{}, data[:2]...)
+	out = append(out, 0xff, 0xe1)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(exif)+2))
+	out = append(out, exif...)
+	out = append(out, 0xff, 0xfe)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(comment)+2))
+	out = append(out, comment...)
+	return append(out, data[2:]...)
+}
+
+// withPNGText inserts a tEXt chunk after the header chunk of a PNG.
+func withPNGText(data []byte, keyword, text string) []byte {
+	body := append([]byte("tEXt"+keyword+"\x00"), text...)
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(body)-4))
+	chunk = append(chunk, body...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(body))
+	headerEnd := 8 + 12 + 13
+	return append(append(append([]byte{}, data[:headerEnd]...), chunk...), data[headerEnd:]...)
+}
+
+// withGIFMetadata inserts a comment and an XMP application extension
+// before the trailer of a GIF.
+func withGIFMetadata(data []byte, comment string) []byte {
+	out := append([]byte{}, data[:len(data)-1]...)
+	out = append(out, 0x21, 0xfe, byte(len(comment)))
+	out = append(out, comment...)
+	out = append(out, 0x00, 0x21, 0xff, 11)
+	out = append(out, "XMP DataXMP"...)
+	out = append(out, byte(len(comment)))
+	out = append(out, comment...)
+	return append(out, 0x00, 0x3b)
+}
+
+func TestEncodeWebP_RoundTrip(t *testing.T) {
+	translucent := image.NewNRGBA(image.Rect(0, 0, 19, 7))
+	for i := range translucent.Pix {
+		translucent.Pix[i] = uint8(i * 37)
+	}
+	for name, img := range map[string]*image.NRGBA{
+		"photo":       testPhoto(100, 61),
+		"single":      testPhoto(1, 1),
+		"translucent": translucent,
+	} {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, pkg.EncodeWebP(&buf, img))
+			decoded, err := webp.Decode(&buf)
+			require.NoError(t, err)
+			require.Equal(t, img.Bounds(), decoded.Bounds())
+			for y := 0; y < img.Bounds().Dy(); y++ {
+				for x := 0; x < img.Bounds().Dx(); x++ {
+					want := img.NRGBAAt(x, y)
+					got := color.NRGBAModel.Convert(decoded.At(x, y)).(color.NRGBA)
+					if want.A == 0 {
+						assert.Zero(t, got.A)
+						continue
+					}
+					require.Equal(t, want, got, "pixel %d,%d", x, y)
+				}
+			}
+		})
+	}
+}
+
+func TestBlurhash(t *testing.T) {
+	red := image.NewNRGBA(image.Rect(0, 0, 8, 8))
+	for i := 0; i < len(red.Pix); i += 4 {
+		red.Pix[i], red.Pix[i+3] = 255, 255
+	}
+	assert.Equal(t, "00TI:j", pkg.Blurhash(red, 1, 1), "one component is the average color")
+
+	hash := pkg.Blurhash(testPhoto(40, 30), 4, 3)
+	assert.Len(t, hash, 28)
+	assert.True(t, strings.HasPrefix(hash, "L"), "the first character encodes 4x3 components")
+}
+
+func TestMedia_ImageProcessing(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := pkg.User{ID: primitive.NewObjectID(), Username: "photographer"}
+	mockUserRepo := mocks.NewMockUserRepositoryInterface(ctrl)
+	mockUserRepo.EXPECT().GetUserByUsername("photographer").Return(user, nil).AnyTimes()
+
+	dir := t.TempDir()
+	store, err := pkg.NewLocalBlobStore(dir)
+	require.NoError(t, err)
+	cfg := testMediaConfig()
+	cfg.MaxSize = 1 << 20
+	cfg.Workers = 2
+	cfg.VariantWidths = []int{16, 32, 200}
+	cfg.ThumbnailSize = 8
+	cfg.JPEGQuality = 80
+	service := pkg.NewMediaService(newMemoryMedia(), store, cfg, "http://localhost:8080")
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	handler := &pkg.Handler{UserService: pkg.NewUserService(mockUserRepo, globalCache), MediaService: service}
+	router.GET("/media/:id", handler.ServeMedia)
+	router.GET("/media/:id/:variant", handler.ServeMediaVariant)
+	api := router.Group("/api").Use(func(c *gin.Context) { c.Set("username", "photographer") })
+	api.POST("/media", handler.UploadMedia)
+	api.GET("/media/:id", handler.GetMediaByID)
+
+	// Orientation 6 means the camera was turned: the 64x48 pixels are
+	// shown rotated to 48x64.
+	w := uploadFile(router, "portrait.jpg", withEXIF(t, testPhoto(64, 48), 6))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var uploaded struct {
+		Media pkg.Media `json:"media"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &uploaded))
+	media := uploaded.Media
+	assert.Equal(t, pkg.MediaProcessing, media.Status)
+	assert.Equal(t, 48, media.Width)
+	assert.Equal(t, 64, media.Height)
+	stored, err := os.ReadFile(filepath.Join(dir, media.Hash[:2], media.Hash))
+	require.NoError(t, err)
+	assert.NotContains(t, string(stored), "Exif", "EXIF is stripped before the file is stored")
+	assert.NotContains(t, string(stored), "52.5200N")
+
+	service.Wait()
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/media/"+media.ID.Hex(), nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &media))
+	assert.Equal(t, pkg.MediaReady, media.Status)
+	assert.Len(t, media.Blurhash, 28)
+	var names []string
+	for _, variant := range media.Variants {
+		names = append(names, variant.Name)
+		assert.Equal(t, media.URL+"/"+variant.Name, variant.URL)
+	}
+	assert.Equal(t, []string{"thumb.webp", "thumb.jpg", "w16.webp", "w16.jpg", "w32.webp", "w32.jpg"}, names, "variants are not wider than the original")
+	assert.Equal(t, 8, media.Variants[0].Width)
+	assert.Equal(t, 8, media.Variants[0].Height)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/media/"+media.ID.Hex()+"/w32.webp", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/webp", w.Header().Get("Content-Type"))
+	decoded, err := webp.Decode(w.Body)
+	require.NoError(t, err)
+	assert.Equal(t, image.Pt(32, 43), decoded.Bounds().Size())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/media/"+media.ID.Hex()+"/w200.jpg", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	var picture bytes.Buffer
+	require.NoError(t, png.Encode(&picture, testPhoto(20, 20)))
+	w = uploadFile(router, "screenshot.png", withPNGText(picture.Bytes(), "Author", "Jane Roe"))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &uploaded))
+	stored, err = os.ReadFile(filepath.Join(dir, uploaded.Media.Hash[:2], uploaded.Media.Hash))
+	require.NoError(t, err)
+	assert.Equal(t, picture.Bytes(), stored, "text chunks are removed without re-encoding")
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, uploadFile(router, "broken.png", picture.Bytes()[:40]).Code)
+
+	var animation bytes.Buffer
+	frame := image.NewPaletted(image.Rect(0, 0, 4, 4), palette.Plan9)
+	require.NoError(t, gif.EncodeAll(&animation, &gif.GIF{Image: []*image.Paletted{frame, frame}, Delay: []int{10, 10}}))
+	w = uploadFile(router, "loop.gif", withGIFMetadata(animation.Bytes(), "by Jane Roe"))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &uploaded))
+	stored, err = os.ReadFile(filepath.Join(dir, uploaded.Media.Hash[:2], uploaded.Media.Hash))
+	require.NoError(t, err)
+	assert.Equal(t, animation.Bytes(), stored, "comments and XMP are removed, the loop count is kept")
+
+	// A tiny rotated JPEG that claims to be 20000x20000 is refused before
+	// it is decoded.
+	bomb := withEXIF(t, testPhoto(8, 8), 6)
+	sof := bytes.Index(bomb, []byte{0xff, 0xc0})
+	require.Positive(t, sof)
+	binary.BigEndian.PutUint16(bomb[sof+5:], 20000)
+	binary.BigEndian.PutUint16(bomb[sof+7:], 20000)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, uploadFile(router, "bomb.jpg", bomb).Code)
+
+	service.Wait()
+	require.NoError(t, service.PurgeOrphans(time.Now().Add(25*time.Hour)))
+	files := 0
+	require.NoError(t, filepath.WalkDir(dir, func(_ string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			files++
+		}
+		return err
+	}))
+	assert.Zero(t, files, "variants are removed with the media")
+}
@@ -0,0 +1,139 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Takeso-user/blog-backend/config"
+	"github.com/Takeso-user/blog-backend/pkg"
+	"github.com/Takeso-user/blog-backend/pkg/mocks"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type memoryLoginAttempts map[string]pkg.LoginAttempt
+
+func (m memoryLoginAttempts) GetLoginAttempt(key string) (pkg.LoginAttempt, error) {
+	attempt, ok := m[key]
+	if !ok {
+		return pkg.LoginAttempt{}, mongo.ErrNoDocuments
+	}
+	return attempt, nil
+}
+
+func (m memoryLoginAttempts) AddLoginFailure(key string, threshold int, policy config.LockoutConfig, now time.Time) (pkg.LoginAttempt, error) {
+	attempt, ok := m[key]
+	expired := !attempt.LockedUntil.IsZero() && !now.Before(attempt.LockedUntil)
+	if !ok || expired || attempt.LastFailure.Before(now.Add(-policy.FailureWindow)) {
+		attempt = pkg.LoginAttempt{Key: key}
+	}
+	attempt.Failures++
+	attempt.LastFailure = now
+	if attempt.Failures >= threshold {
+		attempt.LockedUntil = now.Add(policy.LockoutDuration)
+	}
+	m[key] = attempt
+	return attempt, nil
+}
+
+func (m memoryLoginAttempts) DeleteLoginAttempt(key string) error {
+	delete(m, key)
+	return nil
+}
+
+func (m memoryLoginAttempts) GetLockedLoginAttempts(now time.Time) ([]pkg.LoginAttempt, error) {
+	var locked []pkg.LoginAttempt
+	for _, attempt := range m {
+		if now.Before(attempt.LockedUntil) {
+			locked = append(locked, attempt)
+		}
+	}
+	return locked, nil
+}
+
+var testLockoutPolicy = config.LockoutConfig{
+	Enabled:            true,
+	MaxAccountFailures: 3,
+	MaxIPFailures:      10,
+	BaseDelay:          time.Second,
+	MaxDelay:           4 * time.Second,
+	LockoutDuration:    time.Minute,
+	FailureWindow:      time.Hour,
+}
+
+func Test_LockoutService_BackoffAndLock(t *testing.T) {
+	service := pkg.NewLockoutService(memoryLoginAttempts{}, testLockoutPolicy)
+	now := time.Now()
+
+	assert.Zero(t, service.Check("alice", "10.0.0.1", now))
+
+	service.RecordFailure("alice", "10.0.0.1", now)
+	assert.Equal(t, time.Second, service.Check("alice", "10.0.0.1", now))
+
+	service.RecordFailure("alice", "10.0.0.1", now)
+	assert.Equal(t, 2*time.Second, service.Check("Alice", "10.0.0.2", now))
+
+	service.RecordFailure("alice", "10.0.0.1", now)
+	assert.Equal(t, time.Minute, service.Check("alice", "10.0.0.2", now))
+
+	locked, _ := service.GetLocked(now)
+	assert.Len(t, locked, 1)
+
+	assert.NoError(t, service.UnlockAccount("alice"))
+	assert.Zero(t, service.Check("alice", "10.0.0.2", now))
+}
+
+func Test_Login_LockedAccountReturnsTooManyRequests(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx := context.Background()
+	mockUserRepo := mocks.NewMockUserRepositoryInterface(ctrl)
+	userService := pkg.NewUserService(mockUserRepo, globalCache)
+	mockUserRepo.EXPECT().GetUserByUsername("ghost").Return(pkg.User{}, mongo.ErrNoDocuments).Times(3)
+
+	policy := testLockoutPolicy
+	policy.BaseDelay = 0
+	handler := &pkg.Handler{
+		UserService:    userService,
+		LockoutService: pkg.NewLockoutService(memoryLoginAttempts{}, policy),
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.POST("/auth/login", handler.Login)
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequestWithContext(ctx, "POST", "/auth/login", strings.NewReader(`{"username":"ghost","password":"wrong"}`))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(ctx, "POST", "/auth/login", strings.NewReader(`{"username":"ghost","password":"wrong"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+}
+
+func Test_AdminMiddleware_ForbidsNonAdmins(t *testing.T) {
+	ctx := context.Background()
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.Use(func(c *gin.Context) { c.Set("role", "user") })
+	router.GET("/admin", pkg.AdminMiddleware(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "Access granted"})
+	})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(ctx, "GET", "/admin", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
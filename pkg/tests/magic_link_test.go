@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Takeso-user/blog-backend/config"
+	"github.com/Takeso-user/blog-backend/pkg"
+	"github.com/Takeso-user/blog-backend/pkg/mocks"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+var magicLinkPattern = regexp.MustCompile(`https?://\S+/auth/magic-link/consume\?token=\S+`)
+
+func mailedMagicLink(t *testing.T, outbox *pkg.MemoryOutbox) *url.URL {
+	messages := outbox.Messages()
+	require.NotEmpty(t, messages)
+	link, err := url.Parse(magicLinkPattern.FindString(messages[len(messages)-1].Body))
+	require.NoError(t, err)
+	return link
+}
+
+func Test_MagicLinkService_SingleUseAndIPBinding(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUserRepo := mocks.NewMockUserRepositoryInterface(ctrl)
+	outbox := pkg.NewMemoryOutbox()
+	service := pkg.NewMagicLinkService(memoryTokens{}, pkg.NewUserService(mockUserRepo, globalCache), outbox, "https://blog.example.com", time.Minute, true, false)
+
+	user := pkg.User{ID: primitive.NewObjectID(), Username: "magicip", Email: "magic@example.com", EmailVerified: true}
+	mockUserRepo.EXPECT().GetUserByEmail("magic@example.com").Return(user, nil).Times(2)
+	mockUserRepo.EXPECT().GetUserByID(user.ID.Hex()).Return(user, nil)
+
+	require.NoError(t, service.SendLink(context.Background(), " Magic@Example.com", "10.0.0.1", ""))
+	raw := mailedMagicLink(t, outbox).Query().Get("token")
+	_, err := service.Consume(raw, "10.0.0.2", "")
+	assert.ErrorIs(t, err, pkg.ErrInvalidToken, "link must be bound to the requesting IP")
+
+	require.NoError(t, service.SendLink(context.Background(), "magic@example.com", "10.0.0.1", ""))
+	raw = mailedMagicLink(t, outbox).Query().Get("token")
+	signedIn, err := service.Consume(raw, "10.0.0.1", "")
+	require.NoError(t, err)
+	assert.Equal(t, "magicip", signedIn.Username)
+
+	_, err = service.Consume(raw, "10.0.0.1", "")
+	assert.ErrorIs(t, err, pkg.ErrInvalidToken, "link must be single-use")
+}
+
+func Test_MagicLinkService_UnknownEmailIsSilent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUserRepo := mocks.NewMockUserRepositoryInterface(ctrl)
+	outbox := pkg.NewMemoryOutbox()
+	service := pkg.NewMagicLinkService(memoryTokens{}, pkg.NewUserService(mockUserRepo, globalCache), outbox, "https://blog.example.com", time.Minute, false, false)
+	mockUserRepo.EXPECT().GetUserByEmail("nobody@example.com").Return(pkg.User{}, mongo.ErrNoDocuments)
+
+	require.NoError(t, service.SendLink(context.Background(), "nobody@example.com", "10.0.0.1", ""))
+	assert.Empty(t, outbox.Messages())
+}
+
+func Test_MagicLinkService_LimitsLinksPerAddress(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUserRepo := mocks.NewMockUserRepositoryInterface(ctrl)
+	outbox := pkg.NewMemoryOutbox()
+	service := pkg.NewMagicLinkService(memoryTokens{}, pkg.NewUserService(mockUserRepo, globalCache), outbox, "https://blog.example.com", time.Minute, false, false)
+	cfg := config.Default().RateLimit
+	cfg.Policies["magic_link_email"] = config.RateLimitPolicy{Rate: 2, Period: time.Hour, Burst: 2, Key: "email"}
+	service.Limiter = pkg.NewRateLimiter(pkg.NewMemoryRateLimitStore(), cfg)
+
+	user := pkg.User{ID: primitive.NewObjectID(), Username: "magiclimit", Email: "limit@example.com", EmailVerified: true}
+	mockUserRepo.EXPECT().GetUserByEmail("limit@example.com").Return(user, nil).Times(2)
+
+	// Changing IP address or spelling of the address doesn't help.
+	for i, email := range []string{"limit@example.com", "LIMIT@example.com", " limit@example.com"} {
+		require.NoError(t, service.SendLink(context.Background(), email, fmt.Sprintf("10.0.0.%d", i), ""))
+	}
+	assert.Len(t, outbox.Messages(), 2)
+}
+
+func TestMagicLink_DeviceBoundLogin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUserRepo := mocks.NewMockUserRepositoryInterface(ctrl)
+	outbox := pkg.NewMemoryOutbox()
+	userService := pkg.NewUserService(mockUserRepo, globalCache)
+	service := pkg.NewMagicLinkService(memoryTokens{}, userService, outbox, "https://blog.example.com", time.Minute, false, true)
+
+	user := pkg.User{ID: primitive.NewObjectID(), Username: "magicdevice", Email: "device@example.com"}
+	mockUserRepo.EXPECT().GetUserByEmail("device@example.com").Return(user, nil)
+	mockUserRepo.EXPECT().GetUserByID(user.ID.Hex()).Return(user, nil)
+	mockUserRepo.EXPECT().UpdateUser(user.ID, bson.M{"email_verified": true}).Return(user, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	handler := &pkg.Handler{UserService: userService, MagicLinkService: service}
+	router.POST("/auth/magic-link", handler.RequestMagicLink)
+	router.GET("/auth/magic-link/consume", handler.ConsumeMagicLink)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/auth/magic-link", strings.NewReader(`{"email":"device@example.com"}`))
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	link := mailedMagicLink(t, outbox)
+
+	// Opening the link in another browser fails and burns the link.
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", link.RequestURI(), nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	mockUserRepo.EXPECT().GetUserByEmail("device@example.com").Return(user, nil)
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/auth/magic-link", strings.NewReader(`{"email":"device@example.com"}`))
+	router.ServeHTTP(w, req)
+	cookies = w.Result().Cookies()
+	link = mailedMagicLink(t, outbox)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", link.RequestURI(), nil)
+	req.AddCookie(cookies[0])
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "token")
+}
@@ -0,0 +1,129 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Takeso-user/blog-backend/pkg"
+	"github.com/Takeso-user/blog-backend/pkg/mocks"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const hostileMarkdown = "| a | b |\n|:--|--:|\n| 1 | 2 |\n\n- [x] done\n- [ ] todo\n\n" +
+	"~~old~~ <script>alert(1)</script> <img src=x onerror=alert(1)> [bad](javascript:alert(1)) [ok](https://example.com)\n\n" +
+	"<a href=\"JaVaScRiPt:alert(1)\">sneaky</a> <div onclick=\"steal()\">div</div>\n\n# Heading\n\n![pic](https://example.com/a.png)\n"
+
+func TestMarkdown_PostPolicy(t *testing.T) {
+	rendered, err := pkg.NewPostRenderer().Render(hostileMarkdown)
+	require.NoError(t, err)
+	html := rendered.HTML
+
+	assert.Contains(t, html, `<th align="left">a</th>`)
+	assert.Contains(t, html, `<input checked="" disabled="" type="checkbox"> done`)
+	assert.Contains(t, html, "<del>old</del>")
+	assert.Contains(t, html, `<h1 id="heading">Heading</h1>`)
+	assert.Contains(t, html, `<img src="https://example.com/a.png" alt="pic">`)
+	assert.Contains(t, html, `<a href="https://example.com" rel="nofollow">ok</a>`)
+	for _, unsafe := range []string{"<script", "alert(1)", "onerror", "onclick", "javascript:", "JaVaScRiPt"} {
+		assert.NotContains(t, html, unsafe)
+	}
+}
+
+func TestMarkdown_CommentPolicy(t *testing.T) {
+	rendered, err := pkg.NewCommentRenderer().Render(hostileMarkdown)
+	require.NoError(t, err)
+	html := rendered.HTML
+
+	assert.Contains(t, html, "<del>old</del>")
+	assert.Contains(t, html, `<a href="https://example.com" rel="nofollow">ok</a>`)
+	assert.Contains(t, html, "Heading", "text of dropped tags is kept")
+	for _, dropped := range []string{"<h1", "<table", "<img", "<input", "<div", "<script", "onclick", "javascript:"} {
+		assert.NotContains(t, html, dropped)
+	}
+}
+
+func TestMarkdown_ContentFormat(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	postID := primitive.NewObjectID()
+	mockPostRepo := mocks.NewMockPostRepositoryInterface(ctrl)
+	// A post stored before rendering on write has no HTML yet.
+	mockPostRepo.EXPECT().GetPostByID(postID.Hex()).Return(pkg.Post{ID: postID, Title: "Legacy", Content: "**bold**"}, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	handler := &pkg.Handler{PostService: pkg.NewPostService(mockPostRepo, globalCache)}
+	router.GET("/posts/:id", handler.GetPostById)
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/posts/"+postID.Hex()+query, nil)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("")
+	require.Equal(t, http.StatusOK, w.Code)
+	var post pkg.Post
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &post))
+	assert.Equal(t, "**bold**", post.Content)
+	assert.Equal(t, "<p><strong>bold</strong></p>\n", post.ContentHTML)
+
+	w = get("?format=html")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), `"content":`)
+	assert.Contains(t, w.Body.String(), `"content_html"`)
+
+	w = get("?format=markdown")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"content":"**bold**"`)
+	assert.NotContains(t, w.Body.String(), `"content_html"`)
+
+	assert.Equal(t, http.StatusBadRequest, get("?format=pdf").Code)
+}
+
+func TestMarkdown_HighlightingAndTOC(t *testing.T) {
+	source := "# Intro\n\nA short post.\n\n## Setup `go`\n\n```go\nfunc main() {}\n```\n\n### Details\n\n## Setup `go`\n\n# Wrap up\n"
+	rendered, err := pkg.NewPostRenderer().Render(source)
+	require.NoError(t, err)
+
+	assert.Contains(t, rendered.HTML, `<pre class="chroma">`)
+	assert.Contains(t, rendered.HTML, `<span class="kd">func</span>`)
+	assert.Contains(t, rendered.HTML, `<h2 id="setup-go">`)
+	assert.Contains(t, rendered.HTML, `<h2 id="setup-go-1">`, "repeated headings get distinct slugs")
+
+	require.Len(t, rendered.TOC, 2)
+	intro := rendered.TOC[0]
+	assert.Equal(t, pkg.TOCEntry{Level: 1, Title: "Intro", Slug: "intro"}, pkg.TOCEntry{Level: intro.Level, Title: intro.Title, Slug: intro.Slug})
+	require.Len(t, intro.Children, 2)
+	assert.Equal(t, "Setup go", intro.Children[0].Title)
+	assert.Equal(t, []pkg.TOCEntry{{Level: 3, Title: "Details", Slug: "details"}}, intro.Children[0].Children)
+	assert.Equal(t, "setup-go-1", intro.Children[1].Slug)
+	assert.Equal(t, "wrap-up", rendered.TOC[1].Slug)
+
+	assert.Equal(t, 14, rendered.WordCount)
+	assert.Equal(t, 1, pkg.ReadingTime(rendered.WordCount))
+	assert.Equal(t, 3, pkg.ReadingTime(401))
+	assert.Equal(t, 0, pkg.ReadingTime(0))
+}
+
+func TestMarkdown_UnicodeHeadingIDs(t *testing.T) {
+	source := "# Привет, мир\n\n## Über uns\n\n## Über uns\n\n## 🎉\n\n## 🎉\n"
+	rendered, err := pkg.NewPostRenderer().Render(source)
+	require.NoError(t, err)
+
+	assert.Contains(t, rendered.HTML, `<h1 id="privet-mir">`)
+	assert.Contains(t, rendered.HTML, `<h2 id="uber-uns">`)
+	assert.Contains(t, rendered.HTML, `<h2 id="uber-uns-1">`)
+	assert.Contains(t, rendered.HTML, `<h2 id="heading">`, "headings without letters still get an id")
+	assert.Contains(t, rendered.HTML, `<h2 id="heading-1">`)
+	require.Len(t, rendered.TOC, 1)
+	assert.Equal(t, "privet-mir", rendered.TOC[0].Slug)
+	assert.Equal(t, "uber-uns-1", rendered.TOC[0].Children[1].Slug)
+}
@@ -0,0 +1,381 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Takeso-user/blog-backend/config"
+	"github.com/Takeso-user/blog-backend/pkg"
+	"github.com/Takeso-user/blog-backend/pkg/mocks"
+	"github.com/Takeso-user/blog-backend/pkg/s3test"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// memoryMedia is an in-memory MediaRepositoryInterface.
+type memoryMedia struct {
+	mu    sync.Mutex
+	media map[primitive.ObjectID]pkg.Media
+}
+
+func newMemoryMedia() *memoryMedia {
+	return &memoryMedia{media: map[primitive.ObjectID]pkg.Media{}}
+}
+
+func (m *memoryMedia) CreateMedia(media pkg.Media) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, other := range m.media {
+		if other.OwnerID == media.OwnerID && other.Hash == media.Hash {
+			return mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000}}}
+		}
+	}
+	m.media[media.ID] = media
+	return nil
+}
+
+func (m *memoryMedia) GetMediaByID(id string) (pkg.Media, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return pkg.Media{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	media, ok := m.media[objectID]
+	if !ok {
+		return pkg.Media{}, mongo.ErrNoDocuments
+	}
+	return media, nil
+}
+
+func (m *memoryMedia) GetMediaByOwnerAndHash(ownerID, hash string) (pkg.Media, error) {
+	found := m.filter(func(media pkg.Media) bool { return media.OwnerID == ownerID && media.Hash == hash })
+	if len(found) == 0 {
+		return pkg.Media{}, mongo.ErrNoDocuments
+	}
+	return found[0], nil
+}
+
+func (m *memoryMedia) GetUserMedia(ownerID string) ([]pkg.Media, error) {
+	return m.filter(func(media pkg.Media) bool { return media.OwnerID == ownerID }), nil
+}
+
+func (m *memoryMedia) GetUserMediaUsage(ownerID string) (int64, error) {
+	var total int64
+	for _, media := range m.filter(func(media pkg.Media) bool { return media.OwnerID == ownerID }) {
+		total += media.Size
+	}
+	return total, nil
+}
+
+func (m *memoryMedia) CountMediaByHash(hash string) (int64, error) {
+	return int64(len(m.filter(func(media pkg.Media) bool { return media.Hash == hash }))), nil
+}
+
+func (m *memoryMedia) GetPostMedia(postID string) ([]pkg.Media, error) {
+	return m.filter(func(media pkg.Media) bool { return slices.Contains(media.PostIDs, postID) }), nil
+}
+
+func (m *memoryMedia) LinkMedia(ids []primitive.ObjectID, ownerID, postID string, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, id := range ids {
+		media, ok := m.media[id]
+		if !ok || media.OwnerID != ownerID {
+			continue
+		}
+		if !slices.Contains(media.PostIDs, postID) {
+			media.PostIDs = append(media.PostIDs, postID)
+		}
+		media.UpdatedAt = now
+		m.media[id] = media
+	}
+	return nil
+}
+
+func (m *memoryMedia) UnlinkPostMedia(postID string, now time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for id, media := range m.media {
+		if i := slices.Index(media.PostIDs, postID); i >= 0 {
+			media.PostIDs = slices.Delete(slices.Clone(media.PostIDs), i, i+1)
+			media.UpdatedAt = now
+			m.media[id] = media
+		}
+	}
+	return nil
+}
+
+func (m *memoryMedia) GetOrphanedMedia(before time.Time) ([]pkg.Media, error) {
+	return m.filter(func(media pkg.Media) bool { return len(media.PostIDs) == 0 && media.UpdatedAt.Before(before) }), nil
+}
+
+func (m *memoryMedia) GetUnprocessedMedia() ([]pkg.Media, error) {
+	return m.filter(func(media pkg.Media) bool { return media.Status != pkg.MediaReady && media.Status != pkg.MediaFailed }), nil
+}
+
+func (m *memoryMedia) UpdateMedia(id primitive.ObjectID, updateFields bson.M) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	media, ok := m.media[id]
+	if !ok {
+		return mongo.ErrNoDocuments
+	}
+	for field, value := range updateFields {
+		switch field {
+		case "status":
+			media.Status = value.(string)
+		case "width":
+			media.Width = value.(int)
+		case "height":
+			media.Height = value.(int)
+		case "blurhash":
+			media.Blurhash = value.(string)
+		case "variants":
+			media.Variants = value.([]pkg.MediaVariant)
+		}
+	}
+	m.media[id] = media
+	return nil
+}
+
+func (m *memoryMedia) DeleteMedia(id primitive.ObjectID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.media, id)
+	return nil
+}
+
+func (m *memoryMedia) filter(match func(pkg.Media) bool) []pkg.Media {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	found := []pkg.Media{}
+	for _, media := range m.media {
+		if match(media) {
+			found = append(found, media)
+		}
+	}
+	return found
+}
+
+// testPNG encodes a small image whose bytes depend on shade.
+func testPNG(t *testing.T, shade uint8) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	img.Set(1, 1, color.RGBA{R: shade, A: 255})
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func testMediaConfig() config.MediaConfig {
+	return config.MediaConfig{
+		MaxSize:      4096,
+		UserQuota:    1 << 20,
+		AllowedTypes: []string{"image/png", "image/jpeg", "image/gif", "image/webp"},
+		OrphanTTL:    24 * time.Hour,
+	}
+}
+
+func uploadFile(router *gin.Engine, filename string, data []byte) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", filename)
+	_, _ = part.Write(data)
+	_ = form.Close()
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/api/media", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestMedia_UploadLimitsAndDeduplication(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	user := pkg.User{ID: primitive.NewObjectID(), Username: "uploader"}
+	mockUserRepo := mocks.NewMockUserRepositoryInterface(ctrl)
+	mockUserRepo.EXPECT().GetUserByUsername("uploader").Return(user, nil).AnyTimes()
+
+	dir := t.TempDir()
+	store, err := pkg.NewLocalBlobStore(dir)
+	require.NoError(t, err)
+	service := pkg.NewMediaService(newMemoryMedia(), store, testMediaConfig(), "http://localhost:8080")
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	handler := &pkg.Handler{UserService: pkg.NewUserService(mockUserRepo, globalCache), MediaService: service}
+	router.GET("/media/:id", handler.ServeMedia)
+	api := router.Group("/api").Use(func(c *gin.Context) { c.Set("username", "uploader") })
+	api.POST("/media", handler.UploadMedia)
+	api.GET("/media", handler.GetMedia)
+
+	picture := testPNG(t, 1)
+	w := uploadFile(router, "../../photo.txt", picture)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var uploaded struct {
+		Media pkg.Media `json:"media"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &uploaded))
+	media := uploaded.Media
+	assert.Equal(t, "image/png", media.ContentType, "the type is sniffed, not taken from the name")
+	assert.Equal(t, "photo.txt", media.Filename)
+	assert.Equal(t, "http://localhost:8080/media/"+media.ID.Hex(), media.URL)
+	stored, err := os.ReadFile(filepath.Join(dir, media.Hash[:2], media.Hash))
+	require.NoError(t, err)
+	assert.Equal(t, picture, stored)
+
+	w = uploadFile(router, "again.png", picture)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), media.ID.Hex(), "the same content returns the existing media")
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, uploadFile(router, "notes.png", []byte("just some text")).Code)
+	assert.Equal(t, http.StatusUnsupportedMediaType, uploadFile(router, "x.svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`)).Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, uploadFile(router, "big.png", append(testPNG(t, 2), make([]byte, 4096)...)).Code)
+
+	service.Quota = media.Size + 10
+	assert.Equal(t, http.StatusForbidden, uploadFile(router, "other.png", testPNG(t, 3)).Code)
+
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/media", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), fmt.Sprintf(`"usage":%d`, media.Size))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/media/"+media.ID.Hex(), nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, picture, w.Body.Bytes())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/media/"+primitive.NewObjectID().Hex(), nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestMedia_S3StoreAndGarbageCollection(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	server := s3test.NewServer("blog-media")
+	defer server.Close()
+	store, err := pkg.NewS3BlobStore(config.S3Config{
+		Endpoint:  server.Endpoint(),
+		Region:    server.Region,
+		Bucket:    server.Bucket,
+		AccessKey: server.AccessKey,
+		SecretKey: server.SecretKey,
+		PathStyle: true,
+	})
+	require.NoError(t, err)
+	repo := newMemoryMedia()
+	service := pkg.NewMediaService(repo, store, testMediaConfig(), "http://localhost:8080")
+	userA := pkg.User{ID: primitive.NewObjectID(), Username: "media-a"}
+	userB := pkg.User{ID: primitive.NewObjectID(), Username: "media-b"}
+	mockUserRepo := mocks.NewMockUserRepositoryInterface(ctrl)
+	mockUserRepo.EXPECT().GetUserByUsername(userA.Username).Return(userA, nil).AnyTimes()
+	mockUserRepo.EXPECT().GetUserByUsername(userB.Username).Return(userB, nil).AnyTimes()
+	service.Users = pkg.NewUserService(mockUserRepo, globalCache)
+
+	picture := testPNG(t, 10)
+	first, existing, err := service.Upload(userA.ID.Hex(), "a.png", bytes.NewReader(picture))
+	require.NoError(t, err)
+	assert.False(t, existing)
+	second, _, err := service.Upload(userB.ID.Hex(), "b.png", bytes.NewReader(picture))
+	require.NoError(t, err)
+	assert.NotEqual(t, first.ID, second.ID, "each user gets their own media")
+	assert.Equal(t, 1, server.Len(), "identical content is stored once")
+	stored, ok := server.Object(first.Key)
+	require.True(t, ok)
+	assert.Equal(t, picture, stored)
+
+	_, content, err := service.Open(second.ID.Hex())
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	_, err = buf.ReadFrom(content)
+	require.NoError(t, err)
+	content.Close()
+	assert.Equal(t, picture, buf.Bytes())
+
+	require.NoError(t, service.LinkPost("post-1", userA.Username, "![a](/media/"+first.ID.Hex()+")"))
+	require.NoError(t, service.LinkPost("post-2", userB.Username, "![b](http://localhost:8080/media/"+second.ID.Hex()+")"))
+
+	// Posts don't take ownership of other users' media.
+	require.NoError(t, service.LinkPost("post-3", userB.Username, "![a](/media/"+first.ID.Hex()+")"))
+	require.NoError(t, service.ReleasePost("post-3"))
+	linked, err := repo.GetMediaByID(first.ID.Hex())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"post-1"}, linked.PostIDs)
+
+	require.NoError(t, service.ReleasePost("post-1"))
+	_, err = repo.GetMediaByID(first.ID.Hex())
+	assert.ErrorIs(t, err, mongo.ErrNoDocuments, "media only the deleted post used is removed")
+	assert.Equal(t, 1, server.Len(), "the blob is kept while other media shares it")
+
+	mockPostRepo := mocks.NewMockPostRepositoryInterface(ctrl)
+	mockPostRepo.EXPECT().DeletePost("post-2").Return(nil)
+	postService := pkg.NewPostService(mockPostRepo, globalCache)
+	postService.Media = service
+	require.NoError(t, postService.DeletePost("post-2"))
+	assert.Equal(t, 0, server.Len())
+	_, _, err = service.Open(second.ID.Hex())
+	assert.ErrorIs(t, err, pkg.ErrMediaNotFound)
+
+	unused, _, err := service.Upload(userA.ID.Hex(), "unused.png", bytes.NewReader(testPNG(t, 11)))
+	require.NoError(t, err)
+	require.NoError(t, service.PurgeOrphans(time.Now()))
+	_, err = repo.GetMediaByID(unused.ID.Hex())
+	require.NoError(t, err, "fresh uploads are kept until they had a chance to be used")
+	require.NoError(t, service.PurgeOrphans(time.Now().Add(25*time.Hour)))
+	_, err = repo.GetMediaByID(unused.ID.Hex())
+	assert.ErrorIs(t, err, mongo.ErrNoDocuments)
+	assert.Equal(t, 0, server.Len())
+}
+
+func TestMedia_ConcurrentUploadsKeepQuota(t *testing.T) {
+	store, err := pkg.NewLocalBlobStore(t.TempDir())
+	require.NoError(t, err)
+	repo := newMemoryMedia()
+	service := pkg.NewMediaService(repo, store, testMediaConfig(), "http://localhost:8080")
+	service.Quota = int64(len(testPNG(t, 20))) * 2
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(shade uint8) {
+			defer wg.Done()
+			_, _, err := service.Upload("racer", "race.png", bytes.NewReader(testPNG(t, shade)))
+			if err != nil {
+				assert.ErrorIs(t, err, pkg.ErrMediaQuotaExceeded)
+			}
+		}(uint8(20 + i))
+	}
+	wg.Wait()
+	service.Wait()
+
+	usage, err := repo.GetUserMediaUsage("racer")
+	require.NoError(t, err)
+	assert.LessOrEqual(t, usage, service.Quota)
+	assert.Positive(t, usage)
+}
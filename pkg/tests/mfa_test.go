@@ -0,0 +1,217 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Takeso-user/blog-backend/pkg"
+	"github.com/Takeso-user/blog-backend/pkg/mocks"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RFC 6238 SHA-1 test secret "12345678901234567890" in base32.
+const rfcTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode_RFC6238Vectors(t *testing.T) {
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, want := range vectors {
+		code, err := pkg.TOTPCode(rfcTOTPSecret, time.Unix(unix, 0))
+		require.NoError(t, err)
+		assert.Equal(t, want, code, unix)
+	}
+}
+
+func TestValidateTOTP_AllowsOneStepSkew(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	code, _ := pkg.TOTPCode(rfcTOTPSecret, now.Add(-30*time.Second))
+
+	step, ok := pkg.ValidateTOTP(rfcTOTPSecret, code, now)
+	assert.True(t, ok)
+	assert.Equal(t, now.Unix()/30-1, step)
+
+	_, ok = pkg.ValidateTOTP(rfcTOTPSecret, code, now.Add(90*time.Second))
+	assert.False(t, ok)
+}
+
+func Test_MFAService_ConfirmEnrollment(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUserRepo := mocks.NewMockUserRepositoryInterface(ctrl)
+	service := pkg.NewMFAService(pkg.NewUserService(mockUserRepo, globalCache), nil, "Blog", time.Minute, nil)
+
+	user := pkg.User{ID: primitive.NewObjectID(), Username: "mfaenroll", TOTPPendingSecret: rfcTOTPSecret}
+	code, _ := pkg.TOTPCode(rfcTOTPSecret, time.Now())
+
+	var update bson.M
+	mockUserRepo.EXPECT().UpdateUser(user.ID, gomock.Any()).DoAndReturn(func(_ primitive.ObjectID, fields bson.M) (pkg.User, error) {
+		update = fields
+		return user, nil
+	})
+
+	codes, err := service.ConfirmEnrollment(user, code)
+	require.NoError(t, err)
+	assert.Len(t, codes, 10)
+	assert.Equal(t, true, update["totp_enabled"])
+	assert.Equal(t, rfcTOTPSecret, update["totp_secret"])
+	assert.NotContains(t, update["recovery_codes"], codes[0])
+
+	_, err = service.ConfirmEnrollment(user, "000000")
+	assert.ErrorIs(t, err, pkg.ErrInvalidMFACode)
+}
+
+func Test_MFAService_Verify_RejectsReplayedStep(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUserRepo := mocks.NewMockUserRepositoryInterface(ctrl)
+	service := pkg.NewMFAService(pkg.NewUserService(mockUserRepo, globalCache), nil, "Blog", time.Minute, nil)
+
+	now := time.Now()
+	code, _ := pkg.TOTPCode(rfcTOTPSecret, now)
+	user := pkg.User{ID: primitive.NewObjectID(), Username: "mfareplay", TOTPEnabled: true, TOTPSecret: rfcTOTPSecret, TOTPLastStep: now.Unix() / 30}
+
+	assert.ErrorIs(t, service.Verify(user, code), pkg.ErrInvalidMFACode)
+
+	// The step may also be used between loading the user and recording it.
+	user.TOTPLastStep = 0
+	mockUserRepo.EXPECT().UseTOTPStep(user.ID, gomock.Any()).Return(false, nil)
+	assert.ErrorIs(t, service.Verify(user, code), pkg.ErrInvalidMFACode)
+}
+
+func Test_MFAService_Verify_ConsumesRecoveryCode(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUserRepo := mocks.NewMockUserRepositoryInterface(ctrl)
+	service := pkg.NewMFAService(pkg.NewUserService(mockUserRepo, globalCache), nil, "Blog", time.Minute, nil)
+
+	user := pkg.User{ID: primitive.NewObjectID(), Username: "mfarecovery", TOTPPendingSecret: rfcTOTPSecret}
+	var hashes []string
+	mockUserRepo.EXPECT().UpdateUser(user.ID, gomock.Any()).DoAndReturn(func(_ primitive.ObjectID, fields bson.M) (pkg.User, error) {
+		hashes = fields["recovery_codes"].([]string)
+		return user, nil
+	})
+	code, _ := pkg.TOTPCode(rfcTOTPSecret, time.Now())
+	codes, err := service.ConfirmEnrollment(user, code)
+	require.NoError(t, err)
+
+	user.TOTPEnabled = true
+	user.TOTPSecret = rfcTOTPSecret
+	user.RecoveryCodes = hashes
+	mockUserRepo.EXPECT().UseRecoveryCode(user.ID, hashes[3]).Return(true, nil)
+	require.NoError(t, service.Verify(user, strings.ToUpper(codes[3])))
+
+	// A concurrent request that already took the code wins.
+	mockUserRepo.EXPECT().UseRecoveryCode(user.ID, hashes[3]).Return(false, nil)
+	assert.ErrorIs(t, service.Verify(user, codes[3]), pkg.ErrInvalidMFACode)
+}
+
+func TestLogin_RequiresSecondFactor(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx := context.Background()
+
+	mockUserRepo := mocks.NewMockUserRepositoryInterface(ctrl)
+	userService := pkg.NewUserService(mockUserRepo, globalCache)
+	mfaService := pkg.NewMFAService(userService, nil, "Blog", time.Minute, nil)
+
+	hashedPassword, _ := pkg.HashPassword("password123")
+	user := pkg.User{ID: primitive.NewObjectID(), Username: "mfalogin", Password: hashedPassword, TOTPEnabled: true, TOTPSecret: rfcTOTPSecret}
+	mockUserRepo.EXPECT().GetUserByUsername("mfalogin").Return(user, nil)
+	mockUserRepo.EXPECT().GetUserByID(user.ID.Hex()).Return(user, nil).AnyTimes()
+	mockUserRepo.EXPECT().UseTOTPStep(user.ID, gomock.Any()).Return(true, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	handler := &pkg.Handler{UserService: userService, MFAService: mfaService}
+	router.POST("/auth/login", handler.Login)
+	router.POST("/auth/mfa/verify", handler.VerifyMFA)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(ctx, "POST", "/auth/login", strings.NewReader(`{"username":"mfalogin","password":"password123"}`))
+	router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var challenge struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+		Token       string `json:"token"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &challenge))
+	assert.True(t, challenge.MFARequired)
+	assert.Empty(t, challenge.Token)
+
+	_, err := pkg.ParseJWT(challenge.MFAToken)
+	assert.Error(t, err, "challenge token must not work as a login token")
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequestWithContext(ctx, "POST", "/auth/mfa/verify", strings.NewReader(`{"mfa_token":"`+challenge.MFAToken+`","code":"000000"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	code, _ := pkg.TOTPCode(rfcTOTPSecret, time.Now())
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequestWithContext(ctx, "POST", "/auth/mfa/verify", strings.NewReader(`{"mfa_token":"`+challenge.MFAToken+`","code":"`+code+`"}`))
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var result struct {
+		Token string `json:"token"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	claims, err := pkg.ParseJWT(result.Token)
+	require.NoError(t, err)
+	assert.True(t, claims.MFA)
+}
+
+func Test_MFAEnforcementMiddleware(t *testing.T) {
+	service := pkg.NewMFAService(nil, nil, "Blog", time.Minute, []string{"Admin"})
+
+	gin.SetMode(gin.TestMode)
+	newRouter := func(role string, mfa bool) *gin.Engine {
+		router := gin.Default()
+		router.Use(func(c *gin.Context) {
+			c.Set("role", role)
+			c.Set("mfa", mfa)
+		}, service.EnforcementMiddleware())
+		ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+		router.GET("/api/posts", ok)
+		router.POST("/api/me/mfa/totp/enroll", ok)
+		return router
+	}
+
+	cases := []struct {
+		role   string
+		mfa    bool
+		method string
+		path   string
+		want   int
+	}{
+		{"Admin", false, "GET", "/api/posts", http.StatusForbidden},
+		{"Admin", false, "POST", "/api/me/mfa/totp/enroll", http.StatusOK},
+		{"Admin", true, "GET", "/api/posts", http.StatusOK},
+		{"Reader", false, "GET", "/api/posts", http.StatusOK},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(tc.method, tc.path, nil)
+		newRouter(tc.role, tc.mfa).ServeHTTP(w, req)
+		assert.Equal(t, tc.want, w.Code, "%s %s as %s (mfa=%v)", tc.method, tc.path, tc.role, tc.mfa)
+	}
+}
@@ -5,18 +5,22 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/Takeso-user/blog-backend/pkg"
+	"github.com/Takeso-user/blog-backend/pkg/mocks"
 	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func Test_MissingTokenReturnsUnauthorized(t *testing.T) {
 	ctx := context.Background()
 	gin.SetMode(gin.TestMode)
 	router := gin.Default()
-	router.Use(pkg.JWTMiddleware())
+	router.Use(pkg.JWTMiddleware(nil, nil))
 
 	router.GET("/protected", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"message": "Access granted"})
@@ -34,7 +38,7 @@ func Test_InvalidTokenReturnsUnauthorized(t *testing.T) {
 	ctx := context.Background()
 	gin.SetMode(gin.TestMode)
 	router := gin.Default()
-	router.Use(pkg.JWTMiddleware())
+	router.Use(pkg.JWTMiddleware(nil, nil))
 
 	router.GET("/protected", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"message": "Access granted"})
@@ -53,7 +57,7 @@ func Test_ValidTokenGrantsAccess(t *testing.T) {
 	ctx := context.Background()
 	gin.SetMode(gin.TestMode)
 	router := gin.Default()
-	router.Use(pkg.JWTMiddleware())
+	router.Use(pkg.JWTMiddleware(nil, nil))
 
 	router.GET("/protected", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"message": "Access granted"})
@@ -70,3 +74,35 @@ func Test_ValidTokenGrantsAccess(t *testing.T) {
 	assert.Equal(t, http.StatusOK, w.Code)
 	assert.Contains(t, w.Body.String(), "Access granted")
 }
+
+func Test_RevokedSessionReturnsUnauthorized(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx := context.Background()
+	mockSessionRepo := mocks.NewMockSessionRepositoryInterface(ctrl)
+	sessionID := primitive.NewObjectID()
+	revokedAt := time.Now().Add(-time.Minute)
+	mockSessionRepo.EXPECT().GetSessionByID(sessionID.Hex()).Return(pkg.Session{
+		ID:        sessionID,
+		ExpiresAt: time.Now().Add(time.Hour),
+		RevokedAt: &revokedAt,
+	}, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.Use(pkg.JWTMiddleware(pkg.NewSessionService(mockSessionRepo), nil))
+	router.GET("/protected", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "Access granted"})
+	})
+
+	token, err := pkg.GenerateSessionJWT(pkg.User{Username: "testuser", Role: "user"}, sessionID.Hex(), false)
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(ctx, "GET", "/protected", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Session expired")
+}
@@ -0,0 +1,144 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/Takeso-user/blog-backend/pkg"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type inbox struct {
+	Notifications []pkg.Notification `json:"notifications"`
+	Total         int64              `json:"total"`
+	Unread        int64              `json:"unread"`
+}
+
+func readInbox(t *testing.T, f *blogFixture, user, query string) inbox {
+	var page inbox
+	require.Equal(t, http.StatusOK, f.do(t, user, "GET", "/api/notifications?"+query, nil, &page))
+	return page
+}
+
+func messages(page inbox) []string {
+	found := []string{}
+	for _, notification := range page.Notifications {
+		found = append(found, notification.Message)
+	}
+	return found
+}
+
+func TestMentions(t *testing.T) {
+	assert.Equal(t, []string{"bob", "carol.j", "dave"}, pkg.Mentions("@bob, ask @carol.j. Mail bob@example.com or (@dave) and @bob again; @x is too short"))
+	assert.Empty(t, pkg.Mentions("no mentions here"))
+}
+
+func TestNotifications_CommentsRepliesAndMentions(t *testing.T) {
+	f := newBlogFixture(t)
+	post := f.addPost("alice", "Hello")
+
+	first := f.comment(t, "bob", post, "", "Nice post @alice, what do you think @carol? Mail me at bob@example.com")
+	assert.Equal(t, []string{`bob commented on your post "Hello"`}, messages(readInbox(t, f, "alice", "")), "the author is not also told about the mention")
+	carol := readInbox(t, f, "carol", "")
+	assert.Equal(t, []string{"bob mentioned you in a comment"}, messages(carol))
+	assert.Equal(t, first.ID.Hex(), carol.Notifications[0].CommentID)
+	assert.Equal(t, post.ID.Hex(), carol.Notifications[0].PostID)
+
+	reply := f.comment(t, "carol", post, first.ID.Hex(), "Agreed, @bob")
+	assert.Equal(t, first.ID.Hex(), reply.ParentID)
+	assert.Equal(t, []string{"carol replied to your comment"}, messages(readInbox(t, f, "bob", "")), "a reply that mentions its parent's author notifies once")
+	alice := readInbox(t, f, "alice", "")
+	assert.Equal(t, []string{`carol and bob commented on your post "Hello"`}, messages(alice))
+	assert.Equal(t, 2, alice.Notifications[0].ActorCount)
+
+	f.comment(t, "alice", post, first.ID.Hex(), "Thanks @alice")
+	assert.Equal(t, int64(1), readInbox(t, f, "alice", "").Total, "nobody is notified of their own actions")
+	assert.Len(t, readInbox(t, f, "bob", "").Notifications, 1)
+	assert.Equal(t, "alice and carol replied to your comment", readInbox(t, f, "bob", "").Notifications[0].Message)
+
+	w := f.request(t, "bob", "POST", "/api/posts/"+post.ID.Hex()+"/comments", gin.H{
+		"user_id": f.users["bob"].ID.Hex(), "content": "Hi", "parent_id": primitive.NewObjectID().Hex(),
+	})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestNotifications_GroupingAndReadState(t *testing.T) {
+	f := newBlogFixture(t)
+	post := f.addPost("alice", "Hello")
+	for _, name := range []string{"bob", "carol", "dave", "erin", "frank", "frank"} {
+		f.notifications.Reacted(pkg.ReactionOnPost, post.ID.Hex(), f.users[name].ID.Hex())
+	}
+
+	page := readInbox(t, f, "alice", "")
+	require.Len(t, page.Notifications, 1)
+	assert.Equal(t, `frank and 4 others reacted to your post "Hello"`, page.Notifications[0].Message)
+	assert.Equal(t, []string{"frank", "erin", "dave"}, page.Notifications[0].Actors)
+	assert.Equal(t, 5, page.Notifications[0].ActorCount)
+	assert.Equal(t, int64(1), page.Unread)
+
+	w := f.request(t, "bob", "POST", "/api/notifications/"+page.Notifications[0].ID.Hex()+"/read", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code, "other users' notifications can't be marked")
+	w = f.request(t, "alice", "POST", "/api/notifications/"+page.Notifications[0].ID.Hex()+"/read", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	w = f.request(t, "alice", "GET", "/api/notifications/unread-count", nil)
+	assert.JSONEq(t, `{"unread":0}`, w.Body.String())
+
+	f.notifications.Reacted(pkg.ReactionOnPost, post.ID.Hex(), f.users["grace"].ID.Hex())
+	f.comment(t, "heidi", post, "", "First!")
+	page = readInbox(t, f, "alice", "unread=true")
+	assert.Equal(t, int64(2), page.Total, "events after reading start new notifications")
+	assert.ElementsMatch(t, []string{`grace reacted to your post "Hello"`, `heidi commented on your post "Hello"`}, messages(page))
+	assert.Equal(t, int64(3), readInbox(t, f, "alice", "").Total)
+	assert.Len(t, readInbox(t, f, "alice", "limit=1&offset=1").Notifications, 1)
+
+	w = f.request(t, "alice", "POST", "/api/notifications/read-all", nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"updated":2`)
+	assert.Equal(t, int64(0), readInbox(t, f, "alice", "").Unread)
+	assert.Equal(t, http.StatusBadRequest, f.request(t, "alice", "GET", "/api/notifications?unread=maybe", nil).Code)
+
+	require.NoError(t, f.notifications.RenameActor(f.users["grace"], "gracie"))
+	assert.Contains(t, messages(readInbox(t, f, "alice", "")), `gracie reacted to your post "Hello"`)
+}
+
+func TestNotifications_KeepsLatestActors(t *testing.T) {
+	f := newBlogFixture(t)
+	post := f.addPost("alice", "Hello")
+	for _, name := range []string{"bob", "carol", "dave", "carol", "erin", "bob"} {
+		f.notifications.Reacted(pkg.ReactionOnPost, post.ID.Hex(), f.users[name].ID.Hex())
+	}
+
+	notification := readInbox(t, f, "alice", "").Notifications[0]
+	assert.Equal(t, []string{"bob", "erin", "dave"}, notification.Actors)
+	assert.Equal(t, 5, notification.ActorCount, "bob dropped out of the latest actors and is counted again")
+	assert.Len(t, f.store.notifications[0].ActorIDs, 3)
+}
+
+func TestNotifications_Preferences(t *testing.T) {
+	f := newBlogFixture(t)
+	post := f.addPost("alice", "Hello")
+
+	w := f.request(t, "alice", "PUT", "/api/me/notification-preferences", gin.H{"reaction": false})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var preferences map[string]bool
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &preferences))
+	assert.False(t, preferences["reaction"])
+	assert.True(t, preferences["comment"])
+	assert.Len(t, preferences, len(pkg.NotificationTypes))
+
+	f.notifications.Reacted(pkg.ReactionOnPost, post.ID.Hex(), f.users["bob"].ID.Hex())
+	f.comment(t, "bob", post, "", "Hi")
+	assert.Equal(t, []string{`bob commented on your post "Hello"`}, messages(readInbox(t, f, "alice", "")))
+
+	f.notifications.RoleChanged(f.users["bob"], f.users["carol"], "Editor")
+	assert.Equal(t, []string{"bob changed your role to Editor"}, messages(readInbox(t, f, "carol", "")))
+
+	w = f.request(t, "alice", "PUT", "/api/me/notification-preferences", gin.H{"digest": true})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = f.request(t, "alice", "GET", "/api/me/notification-preferences", nil)
+	assert.Contains(t, w.Body.String(), `"reaction":false`)
+}
@@ -0,0 +1,194 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Takeso-user/blog-backend/config"
+	"github.com/Takeso-user/blog-backend/pkg"
+	"github.com/Takeso-user/blog-backend/pkg/mocks"
+	"github.com/Takeso-user/blog-backend/pkg/oidctest"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type memoryTokens map[string]pkg.OneTimeToken
+
+func (m memoryTokens) CreateToken(token pkg.OneTimeToken) error {
+	m[token.Hash] = token
+	return nil
+}
+
+func (m memoryTokens) ConsumeToken(purpose, hash string, now time.Time) (pkg.OneTimeToken, error) {
+	token, ok := m[hash]
+	if !ok || token.Purpose != purpose || token.UsedAt != nil || !now.Before(token.ExpiresAt) {
+		return pkg.OneTimeToken{}, mongo.ErrNoDocuments
+	}
+	token.UsedAt = &now
+	m[hash] = token
+	return token, nil
+}
+
+func (m memoryTokens) DeleteUserTokens(userID, purpose string) error {
+	for hash, token := range m {
+		if token.UserID == userID && token.Purpose == purpose {
+			delete(m, hash)
+		}
+	}
+	return nil
+}
+
+func newOIDCRouter(t *testing.T, userRepo pkg.UserRepositoryInterface) (*gin.Engine, *oidctest.Provider) {
+	provider := oidctest.NewProvider("blog", "secret")
+	t.Cleanup(provider.Close)
+
+	userService := pkg.NewUserService(userRepo, globalCache)
+	service := pkg.NewOIDCService(memoryTokens{}, userService, map[string]config.OIDCProvider{
+		"corp": {Issuer: provider.Issuer(), ClientID: "blog", ClientSecret: "secret", AllowSignup: true, DefaultRole: "Author"},
+	}, "http://blog.test")
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	handler := &pkg.Handler{UserService: userService, OIDCService: service}
+	router.GET("/auth/oidc/:provider/start", handler.StartOIDCLogin)
+	router.GET("/auth/oidc/:provider/callback", handler.OIDCCallback)
+	return router, provider
+}
+
+// oidcLogin drives the browser side of the flow: start, provider redirect,
+// and callback with the state cookie.
+func oidcLogin(t *testing.T, router *gin.Engine) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(context.Background(), "GET", "/auth/oidc/corp/start", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusFound, w.Code)
+	cookies := w.Result().Cookies()
+	require.NotEmpty(t, cookies)
+
+	browser := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := browser.Get(w.Header().Get("Location"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+	callback, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, "/auth/oidc/corp/callback", callback.Path)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequestWithContext(context.Background(), "GET", callback.RequestURI(), nil)
+	req.AddCookie(cookies[0])
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestOIDCLogin_ProvisionsNewUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUserRepo := mocks.NewMockUserRepositoryInterface(ctrl)
+	router, provider := newOIDCRouter(t, mockUserRepo)
+	provider.SetIdentity(oidctest.Identity{Subject: "sub-new", Email: "New.Person@Example.com", EmailVerified: true, PreferredUsername: "New Person"})
+
+	var created pkg.User
+	mockUserRepo.EXPECT().GetUserByIdentity("corp", "sub-new").Return(pkg.User{}, mongo.ErrNoDocuments)
+	mockUserRepo.EXPECT().GetUserByEmail("new.person@example.com").Return(pkg.User{}, mongo.ErrNoDocuments)
+	mockUserRepo.EXPECT().GetUserByUsername("new-person").Return(pkg.User{}, mongo.ErrNoDocuments)
+	mockUserRepo.EXPECT().CreateUser(gomock.Any()).DoAndReturn(func(user pkg.User) error {
+		created = user
+		return nil
+	})
+
+	w := oidcLogin(t, router)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var result struct {
+		Token string `json:"token"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	claims, err := pkg.ParseJWT(result.Token)
+	require.NoError(t, err)
+	assert.Equal(t, "new-person", claims.Username)
+	assert.Equal(t, "Author", created.Role)
+	assert.Equal(t, "new.person@example.com", created.Email)
+	assert.True(t, created.EmailVerified)
+	require.Len(t, created.Identities, 1)
+	assert.Equal(t, "sub-new", created.Identities[0].Subject)
+}
+
+func TestOIDCLogin_LinksExistingUserByVerifiedEmail(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUserRepo := mocks.NewMockUserRepositoryInterface(ctrl)
+	router, provider := newOIDCRouter(t, mockUserRepo)
+	provider.SetIdentity(oidctest.Identity{Subject: "sub-existing", Email: "existing@example.com", EmailVerified: true})
+
+	existing := pkg.User{ID: primitive.NewObjectID(), Username: "existing", Email: "existing@example.com", EmailVerified: true, Role: "Admin"}
+	mockUserRepo.EXPECT().GetUserByIdentity("corp", "sub-existing").Return(pkg.User{}, mongo.ErrNoDocuments)
+	mockUserRepo.EXPECT().GetUserByEmail("existing@example.com").Return(existing, nil)
+	mockUserRepo.EXPECT().UpdateUser(existing.ID, gomock.Any()).DoAndReturn(func(_ primitive.ObjectID, fields bson.M) (pkg.User, error) {
+		identities := fields["identities"].([]pkg.ExternalIdentity)
+		require.Len(t, identities, 1)
+		assert.Equal(t, "corp", identities[0].Provider)
+		existing.Identities = identities
+		return existing, nil
+	})
+
+	w := oidcLogin(t, router)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "token")
+}
+
+func TestOIDCLogin_RefusesUnverifiedEmailMatch(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUserRepo := mocks.NewMockUserRepositoryInterface(ctrl)
+	router, provider := newOIDCRouter(t, mockUserRepo)
+	provider.SetIdentity(oidctest.Identity{Subject: "sub-attacker", Email: "victim@example.com", EmailVerified: false})
+
+	mockUserRepo.EXPECT().GetUserByIdentity("corp", "sub-attacker").Return(pkg.User{}, mongo.ErrNoDocuments)
+	mockUserRepo.EXPECT().GetUserByEmail("victim@example.com").Return(pkg.User{ID: primitive.NewObjectID(), Username: "victim"}, nil)
+
+	w := oidcLogin(t, router)
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestOIDCLogin_RefusesUnverifiedLocalAccount(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUserRepo := mocks.NewMockUserRepositoryInterface(ctrl)
+	router, provider := newOIDCRouter(t, mockUserRepo)
+	provider.SetIdentity(oidctest.Identity{Subject: "sub-victim", Email: "victim@example.com", EmailVerified: true})
+
+	// Someone registered with the victim's address before the victim
+	// first signed in with the provider.
+	squatter := pkg.User{ID: primitive.NewObjectID(), Username: "squatter", Email: "victim@example.com"}
+	mockUserRepo.EXPECT().GetUserByIdentity("corp", "sub-victim").Return(pkg.User{}, mongo.ErrNoDocuments)
+	mockUserRepo.EXPECT().GetUserByEmail("victim@example.com").Return(squatter, nil)
+
+	w := oidcLogin(t, router)
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestOIDCCallback_RejectsMissingStateCookie(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	router, _ := newOIDCRouter(t, mocks.NewMockUserRepositoryInterface(ctrl))
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(context.Background(), "GET", "/auth/oidc/corp/callback?code=abc&state=forged", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
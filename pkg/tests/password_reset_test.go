@@ -0,0 +1,119 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Takeso-user/blog-backend/pkg"
+	"github.com/Takeso-user/blog-backend/pkg/mocks"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func Test_PasswordResetService_RequestReset_MailsHashedToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockTokenRepo := mocks.NewMockTokenRepositoryInterface(ctrl)
+	mockUserRepo := mocks.NewMockUserRepositoryInterface(ctrl)
+	outbox := pkg.NewMemoryOutbox()
+	service := pkg.NewPasswordResetService(mockTokenRepo, pkg.NewUserService(mockUserRepo, globalCache), nil, outbox, "https://blog.example.com/", time.Hour)
+
+	user := pkg.User{ID: primitive.NewObjectID(), Username: "resetuser", Email: "reset@example.com"}
+	mockUserRepo.EXPECT().GetUserByEmail("reset@example.com").Return(user, nil)
+	mockTokenRepo.EXPECT().DeleteUserTokens(user.ID.Hex(), pkg.TokenPurposePasswordReset).Return(nil)
+
+	var stored pkg.OneTimeToken
+	mockTokenRepo.EXPECT().CreateToken(gomock.Any()).DoAndReturn(func(token pkg.OneTimeToken) error {
+		stored = token
+		return nil
+	})
+
+	require.NoError(t, service.RequestReset(context.Background(), "reset@example.com"))
+
+	messages := outbox.Messages()
+	require.Len(t, messages, 1)
+	assert.Equal(t, "reset@example.com", messages[0].To)
+	assert.Contains(t, messages[0].Body, "https://blog.example.com/reset-password?token=")
+	assert.Equal(t, user.ID.Hex(), stored.UserID)
+	assert.NotContains(t, messages[0].Body, stored.Hash)
+}
+
+func Test_PasswordResetService_RequestReset_UnknownUserIsSilent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockUserRepo := mocks.NewMockUserRepositoryInterface(ctrl)
+	outbox := pkg.NewMemoryOutbox()
+	service := pkg.NewPasswordResetService(mocks.NewMockTokenRepositoryInterface(ctrl), pkg.NewUserService(mockUserRepo, globalCache), nil, outbox, "http://localhost", time.Hour)
+	mockUserRepo.EXPECT().GetUserByEmail("nobody@example.com").Return(pkg.User{}, mongo.ErrNoDocuments)
+
+	require.NoError(t, service.RequestReset(context.Background(), "nobody@example.com"))
+	assert.Empty(t, outbox.Messages())
+}
+
+func Test_ResetPassword_UpdatesPasswordAndRevokesSessions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx := context.Background()
+
+	mockTokenRepo := mocks.NewMockTokenRepositoryInterface(ctrl)
+	mockUserRepo := mocks.NewMockUserRepositoryInterface(ctrl)
+	mockSessionRepo := mocks.NewMockSessionRepositoryInterface(ctrl)
+	userService := pkg.NewUserService(mockUserRepo, globalCache)
+	sessionService := pkg.NewSessionService(mockSessionRepo)
+	service := pkg.NewPasswordResetService(mockTokenRepo, userService, sessionService, pkg.NewMemoryOutbox(), "http://localhost", time.Hour)
+
+	user := pkg.User{ID: primitive.NewObjectID(), Username: "resetuser2"}
+	mockTokenRepo.EXPECT().ConsumeToken(pkg.TokenPurposePasswordReset, gomock.Any(), gomock.Any()).
+		Return(pkg.OneTimeToken{UserID: user.ID.Hex(), Purpose: pkg.TokenPurposePasswordReset}, nil)
+	mockUserRepo.EXPECT().GetUserByID(user.ID.Hex()).Return(user, nil)
+	mockUserRepo.EXPECT().UpdateUser(user.ID, gomock.Any()).DoAndReturn(func(id primitive.ObjectID, fields bson.M) (pkg.User, error) {
+		require.NoError(t, pkg.CheckPassword(fields["password"].(string), "newpassword123"))
+		return user, nil
+	})
+	mockTokenRepo.EXPECT().DeleteUserTokens(user.ID.Hex(), pkg.TokenPurposePasswordReset).Return(nil)
+	mockSessionRepo.EXPECT().RevokeUserSessions(user.ID.Hex(), gomock.Any()).Return(nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	handler := &pkg.Handler{PasswordResetService: service}
+	router.POST("/auth/password/reset", handler.ResetPassword)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(ctx, "POST", "/auth/password/reset", strings.NewReader(`{"token":"raw-token","password":"newpassword123"}`))
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Password reset successfully")
+}
+
+func Test_ResetPassword_InvalidTokenReturnsBadRequest(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	ctx := context.Background()
+
+	mockTokenRepo := mocks.NewMockTokenRepositoryInterface(ctrl)
+	service := pkg.NewPasswordResetService(mockTokenRepo, nil, nil, pkg.NewMemoryOutbox(), "http://localhost", time.Hour)
+	mockTokenRepo.EXPECT().ConsumeToken(pkg.TokenPurposePasswordReset, gomock.Any(), gomock.Any()).Return(pkg.OneTimeToken{}, mongo.ErrNoDocuments)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	handler := &pkg.Handler{PasswordResetService: service}
+	router.POST("/auth/password/reset", handler.ResetPassword)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(ctx, "POST", "/auth/password/reset", strings.NewReader(`{"token":"used","password":"newpassword123"}`))
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Takeso-user/blog-backend/config"
+	"github.com/Takeso-user/blog-backend/pkg"
+	"github.com/Takeso-user/blog-backend/pkg/mocks"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestArgon2idHasher(t *testing.T) {
+	hasher := pkg.NewArgon2idHasher(8*1024, 1, 1)
+	hash, err := hasher.Hash("correct horse")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=8192,t=1,p=1$"))
+	assert.True(t, hasher.Handles(hash))
+	assert.NoError(t, hasher.Verify(hash, "correct horse"))
+	assert.ErrorIs(t, hasher.Verify(hash, "wrong horse"), pkg.ErrPasswordMismatch)
+
+	assert.False(t, hasher.NeedsRehash(hash))
+	assert.True(t, pkg.NewArgon2idHasher(16*1024, 1, 1).NeedsRehash(hash), "more memory means outdated")
+}
+
+func TestCheckPassword_AcceptsLegacyBcrypt(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	assert.NoError(t, pkg.CheckPassword(string(legacy), "password123"))
+	assert.Error(t, pkg.CheckPassword(string(legacy), "password124"))
+	assert.True(t, pkg.PasswordNeedsRehash(string(legacy)))
+	assert.ErrorIs(t, pkg.CheckPassword("plaintext", "plaintext"), pkg.ErrUnknownPasswordHash)
+
+	current, err := pkg.HashPassword("password123")
+	require.NoError(t, err)
+	assert.False(t, pkg.PasswordNeedsRehash(current))
+}
+
+func TestLogin_UpgradesLegacyHash(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	user := pkg.User{ID: primitive.NewObjectID(), Username: "legacyhash", Password: string(legacy)}
+	mockUserRepo := mocks.NewMockUserRepositoryInterface(ctrl)
+	mockUserRepo.EXPECT().GetUserByUsername("legacyhash").Return(user, nil)
+	mockUserRepo.EXPECT().UpdateUser(user.ID, gomock.Any()).DoAndReturn(func(_ primitive.ObjectID, fields bson.M) (pkg.User, error) {
+		upgraded := fields["password"].(string)
+		assert.True(t, strings.HasPrefix(upgraded, "$argon2id$"))
+		assert.NoError(t, pkg.CheckPassword(upgraded, "password123"))
+		user.Password = upgraded
+		return user, nil
+	})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	handler := &pkg.Handler{UserService: pkg.NewUserService(mockUserRepo, globalCache)}
+	router.POST("/auth/login", handler.Login)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(context.Background(), "POST", "/auth/login", strings.NewReader(`{"username":"legacyhash","password":"password123"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestPasswordPolicy(t *testing.T) {
+	list := filepath.Join(t.TempDir(), "breached.txt")
+	// "password123" in plain text, "sunshine99" as an HIBP SHA-1 line.
+	require.NoError(t, os.WriteFile(list, []byte("password123\r\n092821935DE7A85F7BCD0B72ADAEB50D38A70288:42\n"), 0o600))
+
+	policy, err := pkg.NewPasswordPolicy(config.PasswordConfig{MinLength: 8, MaxLength: 64, BreachedList: list})
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, policy.Check("short"), pkg.ErrPasswordTooShort)
+	assert.ErrorIs(t, policy.Check(strings.Repeat("a", 65)), pkg.ErrPasswordTooLong)
+	assert.ErrorIs(t, policy.Check("password123"), pkg.ErrPasswordBreached)
+	assert.ErrorIs(t, policy.Check("sunshine99"), pkg.ErrPasswordBreached)
+	assert.NoError(t, policy.Check("12345678"))
+	policy.AddBreached("12345678")
+	assert.ErrorIs(t, policy.Check("12345678"), pkg.ErrPasswordBreached)
+	assert.NoError(t, policy.Check("a long and unusual passphrase"))
+}
+
+func TestRegister_EnforcesPasswordPolicy(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	policy, err := pkg.NewPasswordPolicy(config.PasswordConfig{MinLength: 8, MaxLength: 64})
+	require.NoError(t, err)
+	policy.AddBreached("qwertyuiop")
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	handler := &pkg.Handler{UserService: pkg.NewUserService(mocks.NewMockUserRepositoryInterface(ctrl), globalCache), PasswordPolicy: policy}
+	router.POST("/auth/register", handler.Register)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(context.Background(), "POST", "/auth/register", strings.NewReader(`{"username":"weak","password":"qwertyuiop"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "breached")
+}
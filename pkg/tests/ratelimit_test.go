@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Takeso-user/blog-backend/config"
+	"github.com/Takeso-user/blog-backend/pkg"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_MemoryRateLimitStore_RefillsOverTime(t *testing.T) {
+	store := pkg.NewMemoryRateLimitStore()
+	policy := config.RateLimitPolicy{Rate: 1, Period: time.Second, Burst: 2, Key: "ip"}
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		result, err := store.Take(context.Background(), "k", policy, now)
+		require.NoError(t, err)
+		assert.True(t, result.Allowed)
+	}
+	result, err := store.Take(context.Background(), "k", policy, now)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, time.Second, result.RetryAfter)
+
+	result, err = store.Take(context.Background(), "k", policy, now.Add(time.Second))
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+}
+
+func Test_MemoryRateLimitStore_KeepsBucketsUntilRefilled(t *testing.T) {
+	store := pkg.NewMemoryRateLimitStore()
+	policy := config.RateLimitPolicy{Rate: 1, Period: 24 * time.Hour, Key: "email"}
+	now := time.Now()
+
+	result, err := store.Take(context.Background(), "k", policy, now)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	// Enough other clients to prune the store, hours later but long
+	// before the bucket has refilled.
+	later := now.Add(2 * time.Hour)
+	for i := 0; i < 1000; i++ {
+		_, err := store.Take(context.Background(), fmt.Sprint("other", i), policy, later)
+		require.NoError(t, err)
+	}
+	result, err = store.Take(context.Background(), "k", policy, later)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 22*time.Hour, result.RetryAfter)
+}
+
+func newRateLimitedRouter(role string) *gin.Engine {
+	limiter := pkg.NewRateLimiter(pkg.NewMemoryRateLimitStore(), config.RateLimitConfig{
+		Enabled: true,
+		Policies: map[string]config.RateLimitPolicy{
+			"login": {Rate: 1, Period: time.Minute, Burst: 1, Key: "ip"},
+		},
+	})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	router.Use(func(c *gin.Context) {
+		if role != "" {
+			c.Set("role", role)
+		}
+	})
+	router.POST("/auth/login", limiter.Middleware("login"), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"message": "ok"})
+	})
+	return router
+}
+
+func Test_RateLimitMiddleware_RejectsWithHeaders(t *testing.T) {
+	ctx := context.Background()
+	router := newRateLimitedRouter("")
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequestWithContext(ctx, "POST", "/auth/login", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "1", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequestWithContext(ctx, "POST", "/auth/login", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+}
+
+func Test_RateLimitMiddleware_ExemptsAdmins(t *testing.T) {
+	ctx := context.Background()
+	router := newRateLimitedRouter("Admin")
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequestWithContext(ctx, "POST", "/auth/login", nil)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+	}
+}
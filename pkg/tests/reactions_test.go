@@ -0,0 +1,114 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/Takeso-user/blog-backend/config"
+	"github.com/Takeso-user/blog-backend/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// react sends a reaction request as bob and returns the new counts.
+func react(t *testing.T, f *blogFixture, method, path string) (int, map[string]int64) {
+	var body struct {
+		Reactions map[string]int64 `json:"reactions"`
+	}
+	code := f.do(t, "bob", method, path, nil, &body)
+	return code, body.Reactions
+}
+
+func TestReactions_OnePerUserPerTarget(t *testing.T) {
+	f := newBlogFixture(t)
+	post := "/api/posts/" + f.addPost("alice", "Post").ID.Hex() + "/reactions/"
+	f.addPost("alice", "Other")
+
+	code, counts := react(t, f, "PUT", post+"like")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]int64{"like": 1}, counts)
+
+	_, counts = react(t, f, "PUT", post+"like")
+	assert.Equal(t, map[string]int64{"like": 1}, counts, "reacting twice counts once")
+
+	_, counts = react(t, f, "PUT", post+"love")
+	assert.Equal(t, map[string]int64{"love": 1}, counts, "a new reaction replaces the previous one")
+
+	_, counts = react(t, f, "DELETE", post+"like")
+	assert.Equal(t, map[string]int64{"love": 1}, counts, "removing a reaction the user doesn't have changes nothing")
+
+	var posts []pkg.Post
+	require.Equal(t, http.StatusOK, f.do(t, "bob", "GET", "/api/posts", nil, &posts))
+	assert.Equal(t, "love", posts[0].MyReaction)
+	assert.Empty(t, posts[1].MyReaction)
+
+	_, counts = react(t, f, "DELETE", post+"love")
+	assert.Empty(t, counts, "unused reaction types are left out")
+
+	code, _ = react(t, f, "PUT", post+"shrug")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = react(t, f, "PUT", "/api/posts/"+primitive.NewObjectID().Hex()+"/reactions/like")
+	assert.Equal(t, http.StatusNotFound, code)
+	code, _ = react(t, f, "PUT", "/api/posts/not-an-id/reactions/like")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	var types []config.ReactionType
+	require.Equal(t, http.StatusOK, f.do(t, "bob", "GET", "/api/reactions", nil, &types))
+	assert.Equal(t, config.Default().Reactions.Types, types)
+}
+
+func TestReactions_Comments(t *testing.T) {
+	f := newBlogFixture(t)
+	comment := "/api/posts/comments/" + f.addComment(f.addPost("alice", "Post"), "carol", "Nice").ID.Hex()
+
+	code, counts := react(t, f, "PUT", comment+"/reactions/insightful")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]int64{"insightful": 1}, counts)
+
+	code, _ = react(t, f, "DELETE", comment)
+	require.Equal(t, http.StatusOK, code)
+	reactions, err := f.store.GetReactionsByUser(f.users["bob"].ID.Hex())
+	require.NoError(t, err)
+	assert.Empty(t, reactions, "reactions are removed with the comment")
+}
+
+func TestReactions_ConcurrentRequests(t *testing.T) {
+	f := newBlogFixture(t)
+	post := f.addPost("alice", "Post").ID.Hex()
+	bob := f.users["bob"].ID.Hex()
+	types := []string{"like", "love", "laugh"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := f.reactions.React(pkg.ReactionOnPost, post, bob, types[i%len(types)])
+			assert.NoError(t, err)
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := f.reactions.React(pkg.ReactionOnPost, post, fmt.Sprintf("user-%d", i%10), "like")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	counted, err := f.store.GetPostByID(post)
+	require.NoError(t, err)
+	mine, err := f.store.GetUserReactions(bob, pkg.ReactionOnPost, []string{post})
+	require.NoError(t, err)
+	want := map[string]int64{"like": 10, "love": 0, "laugh": 0}
+	want[mine[post]]++
+	for _, reaction := range types {
+		assert.Equal(t, want[reaction], counted.Reactions[reaction], reaction)
+	}
+
+	require.NoError(t, f.reactions.RemoveUserReactions(bob))
+	counted, err = f.store.GetPostByID(post)
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), counted.Reactions["like"]+counted.Reactions["love"]+counted.Reactions["laugh"])
+}
@@ -21,7 +21,9 @@ import (
 var globalCache *cache.Cache
 
 func TestMain(m *testing.M) {
-
+	// The JWT secret is read once per process, so set it before any test
+	// issues a token.
+	os.Setenv("JWT_SECRET", "testsecret")
 	globalCache = cache.NewCache(5 * time.Minute)
 
 	code := m.Run()
@@ -130,7 +132,7 @@ func Test_CommentService_UpdateComment_Success(t *testing.T) {
 	mockCommentRepo.EXPECT().UpdateComment(
 		context.TODO(),
 		bson.M{"_id": commentID},
-		bson.M{"$set": bson.M{"content": input.Content}},
+		bson.M{"$set": bson.M{"content": input.Content, "content_html": "<p>Updated Comment</p>\n"}},
 	).Return(pkg.Comment{Content: "Updated Comment"}, nil)
 
 	updatedComment, err := commentService.UpdateComment(commentID, input)
@@ -0,0 +1,141 @@
+package tests
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Takeso-user/blog-backend/pkg"
+	"github.com/Takeso-user/blog-backend/pkg/mocks"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// memorySlugs is an in-memory SlugRepositoryInterface that rejects taken
+// slugs like the unique _id does.
+type memorySlugs map[string]pkg.PostSlug
+
+func (m memorySlugs) CreatePostSlug(slug pkg.PostSlug) error {
+	if _, taken := m[slug.Slug]; taken {
+		return mongo.WriteException{WriteErrors: mongo.WriteErrors{{Code: 11000}}}
+	}
+	m[slug.Slug] = slug
+	return nil
+}
+
+func (m memorySlugs) GetPostSlug(slug string) (pkg.PostSlug, error) {
+	postSlug, ok := m[slug]
+	if !ok {
+		return pkg.PostSlug{}, mongo.ErrNoDocuments
+	}
+	return postSlug, nil
+}
+
+func (m memorySlugs) DeletePostSlugs(postID string) (int64, error) {
+	var deleted int64
+	for slug, postSlug := range m {
+		if postSlug.PostID == postID {
+			delete(m, slug)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func TestSlugify(t *testing.T) {
+	id := primitive.NewObjectID().Hex()
+	tests := map[string]string{
+		"Hello, World!":        "hello-world",
+		"  Crème Brûlée  ":     "creme-brulee",
+		"Привет, мир":          "privet-mir",
+		"Straße & Ærø":         "strasse-and-aero",
+		"!!!":                  "post",
+		id:                     "post-" + id,
+		"Go 1.23 release news": "go-1-23-release-news",
+	}
+	for title, want := range tests {
+		assert.Equal(t, want, pkg.Slugify(title), title)
+	}
+
+	long := pkg.Slugify(strings.Repeat("word ", 40))
+	assert.LessOrEqual(t, len(long), 80)
+	assert.False(t, strings.HasSuffix(long, "-"))
+}
+
+func TestSlugs_CollisionsAndRedirects(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockPostRepo := mocks.NewMockPostRepositoryInterface(ctrl)
+	slugs := memorySlugs{}
+	postService := pkg.NewPostService(mockPostRepo, globalCache)
+	postService.Slugs = slugs
+
+	var created []pkg.Post
+	mockPostRepo.EXPECT().CreatePost(gomock.Any()).DoAndReturn(func(post pkg.Post) error {
+		created = append(created, post)
+		return nil
+	}).Times(3)
+	require.NoError(t, postService.CreatePost("Slug Collision", "first", "author"))
+	require.NoError(t, postService.CreatePost("Slug Collision", "second", "author"))
+	require.NoError(t, postService.CreatePost("Slug collision!", "third", "author"))
+	assert.Equal(t, "slug-collision", created[0].Slug)
+	assert.Equal(t, "slug-collision-2", created[1].Slug)
+	assert.Equal(t, "slug-collision-3", created[2].Slug)
+
+	post := created[0]
+	mockPostRepo.EXPECT().GetPostByID(post.ID.Hex()).DoAndReturn(func(string) (pkg.Post, error) {
+		return post, nil
+	}).AnyTimes()
+	mockPostRepo.EXPECT().UpdatePost(post.ID, gomock.Any()).DoAndReturn(func(_ primitive.ObjectID, fields bson.M) (pkg.Post, error) {
+		post.Title = fields["title"].(string)
+		post.Slug = fields["slug"].(string)
+		return post, nil
+	}).Times(2)
+
+	updated, err := postService.UpdatePost(post.ID, pkg.Post{Title: "Renamed Slug Post"})
+	require.NoError(t, err)
+	assert.Equal(t, "renamed-slug-post", updated.Slug)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	handler := &pkg.Handler{PostService: postService}
+	router.GET("/api/posts/:id", handler.GetPostById)
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", target, nil)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/api/posts/slug-collision?format=html")
+	require.Equal(t, http.StatusMovedPermanently, w.Code)
+	assert.Equal(t, "/api/posts/renamed-slug-post?format=html", w.Header().Get("Location"))
+
+	w = get("/api/posts/renamed-slug-post")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"title":"Renamed Slug Post"`)
+
+	w = get("/api/posts/" + post.ID.Hex())
+	assert.Equal(t, http.StatusOK, w.Code, "lookups by ID are not redirected")
+
+	assert.Equal(t, http.StatusNotFound, get("/api/posts/never-existed").Code)
+
+	// Going back to the original title reclaims the post's own old slug
+	// rather than picking a suffix.
+	updated, err = postService.UpdatePost(post.ID, pkg.Post{Title: "Slug Collision"})
+	require.NoError(t, err)
+	assert.Equal(t, "slug-collision", updated.Slug)
+
+	mockPostRepo.EXPECT().DeletePost(post.ID.Hex()).Return(nil)
+	require.NoError(t, postService.DeletePost(post.ID.Hex()))
+	_, taken := slugs["renamed-slug-post"]
+	assert.False(t, taken, "deleting a post releases its slugs")
+	assert.Contains(t, slugs, "slug-collision-2")
+}
@@ -0,0 +1,322 @@
+package tests
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Takeso-user/blog-backend/config"
+	"github.com/Takeso-user/blog-backend/pkg"
+	"github.com/Takeso-user/blog-backend/pkg/mocks"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"golang.org/x/net/websocket"
+)
+
+func newEventBus(broker pkg.EventBroker, configure func(*config.EventsConfig)) *pkg.EventBus {
+	cfg := config.Default().Events
+	if configure != nil {
+		configure(&cfg)
+	}
+	return pkg.NewEventBus(broker, cfg)
+}
+
+func receive(t *testing.T, sub *pkg.Subscription) pkg.Event {
+	t.Helper()
+	select {
+	case event := <-sub.Events():
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+		return pkg.Event{}
+	}
+}
+
+func TestEventBus_TopicsAndReplay(t *testing.T) {
+	bus := newEventBus(pkg.NewMemoryEventBroker(), func(cfg *config.EventsConfig) { cfg.History = 3 })
+	defer bus.Close()
+
+	sub, replay, missed, err := bus.Subscribe("u1", []string{pkg.PostTopic("a")}, "")
+	require.NoError(t, err)
+	assert.Empty(t, replay)
+	assert.False(t, missed)
+
+	bus.Publish(pkg.PostTopic("b"), pkg.EventCommentCreated, gin.H{"n": 1})
+	bus.Publish(pkg.PostTopic("a"), pkg.EventCommentCreated, gin.H{"n": 2})
+	first := receive(t, sub)
+	assert.Equal(t, pkg.EventCommentCreated, first.Type)
+	assert.JSONEq(t, `{"n":2}`, string(first.Data))
+	bus.Publish(pkg.PostTopic("a"), pkg.EventCommentUpdated, gin.H{"n": 3})
+	bus.Publish(pkg.PostTopic("b"), pkg.EventCommentCreated, gin.H{"n": 4})
+	receive(t, sub)
+	sub.Close()
+
+	// Reconnecting after the first event replays the rest on its topics.
+	sub, replay, missed, err = bus.Subscribe("u1", []string{pkg.PostTopic("a")}, first.ID)
+	require.NoError(t, err)
+	defer sub.Close()
+	assert.False(t, missed)
+	require.Len(t, replay, 1)
+	assert.Equal(t, pkg.EventCommentUpdated, replay[0].Type)
+
+	// The event history keeps only the last three events.
+	bus.Publish(pkg.PostTopic("b"), pkg.EventCommentCreated, gin.H{"n": 5})
+	other, replay, missed, err := bus.Subscribe("u2", []string{pkg.PostTopic("a")}, first.ID)
+	require.NoError(t, err)
+	defer other.Close()
+	assert.True(t, missed)
+	assert.Empty(t, replay)
+}
+
+func TestEventBus_LimitsStreams(t *testing.T) {
+	bus := newEventBus(pkg.NewMemoryEventBroker(), func(cfg *config.EventsConfig) {
+		cfg.Buffer = 2
+		cfg.MaxStreamsPerUser = 2
+	})
+	defer bus.Close()
+	topics := []string{pkg.UserTopic("u1")}
+
+	slow, _, _, err := bus.Subscribe("u1", topics, "")
+	require.NoError(t, err)
+	_, _, _, err = bus.Subscribe("u1", topics, "")
+	require.NoError(t, err)
+	_, _, _, err = bus.Subscribe("u1", topics, "")
+	assert.ErrorIs(t, err, pkg.ErrTooManyStreams)
+
+	// A stream that falls behind is ended, which frees its slot.
+	for i := 0; i < 3; i++ {
+		bus.Publish(pkg.UserTopic("u1"), pkg.EventNotification, gin.H{"n": i})
+	}
+	select {
+	case <-slow.Done():
+	default:
+		t.Fatal("slow stream was not dropped")
+	}
+	_, _, _, err = bus.Subscribe("u1", topics, "")
+	assert.NoError(t, err)
+}
+
+func TestEventBus_FansOutAcrossInstances(t *testing.T) {
+	broker := pkg.NewMemoryEventBroker()
+	first := newEventBus(broker, nil)
+	second := newEventBus(broker, nil)
+	defer first.Close()
+	defer second.Close()
+
+	sub, _, _, err := second.Subscribe("u1", []string{pkg.PostTopic("a")}, "")
+	require.NoError(t, err)
+	first.Publish(pkg.PostTopic("a"), pkg.EventPostUpdated, gin.H{"title": "New"})
+	event := receive(t, sub)
+	assert.Equal(t, pkg.EventPostUpdated, event.Type)
+	sub.Close()
+
+	// Either instance can replay, since both saw every event.
+	sub, replay, missed, err := second.Subscribe("u1", []string{pkg.PostTopic("a")}, event.ID)
+	require.NoError(t, err)
+	defer sub.Close()
+	assert.False(t, missed)
+	assert.Empty(t, replay)
+}
+
+func TestEventBus_DropsSignedOutUsers(t *testing.T) {
+	broker := pkg.NewMemoryEventBroker()
+	first := newEventBus(broker, nil)
+	defer first.Close()
+	second := newEventBus(broker, nil)
+	defer second.Close()
+
+	alice, _, _, err := second.Subscribe("alice", []string{pkg.UserTopic("alice")}, "")
+	require.NoError(t, err)
+	bob, _, _, err := second.Subscribe("bob", []string{pkg.UserTopic("bob")}, "")
+	require.NoError(t, err)
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	mockSessionRepo := mocks.NewMockSessionRepositoryInterface(ctrl)
+	mockSessionRepo.EXPECT().RevokeUserSessions("alice", gomock.Any()).Return(nil)
+	sessions := pkg.NewSessionService(mockSessionRepo)
+	sessions.Events = first
+	require.NoError(t, sessions.RevokeUserSessions("alice"))
+
+	select {
+	case <-alice.Done():
+	case <-time.After(time.Second):
+		t.Fatal("stream of the signed out user still open")
+	}
+	select {
+	case <-bob.Done():
+		t.Fatal("stream of another user closed")
+	default:
+	}
+	first.Publish(pkg.UserTopic("bob"), pkg.EventNotification, nil)
+	assert.Equal(t, pkg.EventNotification, receive(t, bob).Type)
+}
+
+// serve starts a server for the fixture, which streams need.
+func serve(t *testing.T, f *blogFixture) *httptest.Server {
+	server := httptest.NewServer(f.router)
+	t.Cleanup(server.Close)
+	return server
+}
+
+type sseEvent struct {
+	ID, Type, Data string
+}
+
+// openSSE opens a stream and returns its events as they arrive.
+func openSSE(t *testing.T, server *httptest.Server, user, query, lastEventID string) <-chan sseEvent {
+	req, err := http.NewRequest("GET", server.URL+"/api/stream?"+query, nil)
+	require.NoError(t, err)
+	if user != "" {
+		req.Header.Set("X-User", user)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	events := make(chan sseEvent, 16)
+	go func() {
+		defer close(events)
+		var event sseEvent
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				event.ID = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				event.Type = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				event.Data = strings.TrimPrefix(line, "data: ")
+			case line == "" && event.Type != "":
+				events <- event
+				event = sseEvent{}
+			}
+		}
+	}()
+	return events
+}
+
+func next(t *testing.T, events <-chan sseEvent) sseEvent {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatal("stream closed")
+		}
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event received")
+		return sseEvent{}
+	}
+}
+
+func TestStream_ServerSentEvents(t *testing.T) {
+	f := newBlogFixture(t)
+	server := serve(t, f)
+	post := f.addPost("alice", "Hello")
+	postID := post.ID.Hex()
+
+	events := openSSE(t, server, "alice", "posts="+postID, "")
+	f.comment(t, "bob", post, "", "First!")
+	created := next(t, events)
+	assert.Equal(t, pkg.EventCommentCreated, created.Type)
+	var comment pkg.Comment
+	require.NoError(t, json.Unmarshal([]byte(created.Data), &comment))
+	assert.Equal(t, "First!", comment.Content)
+	assert.Equal(t, "bob", comment.Username)
+	notified := next(t, events)
+	assert.Equal(t, pkg.EventNotification, notified.Type)
+	assert.Contains(t, notified.Data, `bob commented on your post \"Hello\"`)
+
+	// Reconnecting after the comment replays the notification, which
+	// only its recipient sees.
+	replay := openSSE(t, server, "alice", "posts="+postID, created.ID)
+	assert.Equal(t, notified, next(t, replay))
+	bobEvents := openSSE(t, server, "bob", "posts="+postID, created.ID)
+	f.comment(t, "carol", post, "", "Second")
+	second := next(t, bobEvents)
+	assert.Equal(t, pkg.EventCommentCreated, second.Type)
+	assert.Contains(t, second.Data, "Second")
+
+	reset := openSSE(t, server, "bob", "posts="+postID, "unknown")
+	assert.Equal(t, pkg.EventReset, next(t, reset).Type)
+}
+
+func TestStream_Tickets(t *testing.T) {
+	f := newBlogFixture(t)
+	server := serve(t, f)
+	post := f.addPost("alice", "Hello")
+	w := f.request(t, "alice", "POST", "/api/stream/tickets", nil)
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var body struct {
+		Ticket string `json:"ticket"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+
+	events := openSSE(t, server, "", "ticket="+body.Ticket, "")
+	f.comment(t, "bob", post, "", "Hi")
+	assert.Equal(t, pkg.EventNotification, next(t, events).Type)
+
+	// Tickets work once.
+	resp, err := http.Get(server.URL + "/api/stream?ticket=" + body.Ticket)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestStream_ClosesForRestrictedUsers(t *testing.T) {
+	f := newBlogFixture(t)
+	server := serve(t, f)
+	f.streams.Config.Heartbeat = 20 * time.Millisecond
+	events := openSSE(t, server, "alice", "", "")
+
+	_, err := f.notifications.Users.UpdateUser(f.users["alice"].ID, bson.M{"restriction": pkg.Restriction{Type: pkg.RestrictionBan, Reason: "spam"}})
+	require.NoError(t, err)
+	select {
+	case _, ok := <-events:
+		assert.False(t, ok, "stream still sending events")
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream of a banned user still open")
+	}
+}
+
+func TestStream_LimitsPosts(t *testing.T) {
+	f := newBlogFixture(t)
+	f.streams.Config.MaxPosts = 1
+	w := f.request(t, "alice", "GET", "/api/stream?posts=a,b", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestStream_WebSocket(t *testing.T) {
+	f := newBlogFixture(t)
+	server := serve(t, f)
+	post := f.addPost("alice", "Hello")
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/stream?posts=" + post.ID.Hex()
+	cfg, err := websocket.NewConfig(url, server.URL)
+	require.NoError(t, err)
+	cfg.Header.Set("X-User", "alice")
+	ws, err := websocket.DialConfig(cfg)
+	require.NoError(t, err)
+	defer ws.Close()
+
+	f.comment(t, "bob", post, "", "Over the socket")
+	require.NoError(t, ws.SetReadDeadline(time.Now().Add(2*time.Second)))
+	var event pkg.Event
+	require.NoError(t, websocket.JSON.Receive(ws, &event))
+	assert.Equal(t, pkg.EventCommentCreated, event.Type)
+	assert.NotEmpty(t, event.ID)
+	assert.Contains(t, string(event.Data), "Over the socket")
+}
@@ -0,0 +1,195 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Takeso-user/blog-backend/config"
+	"github.com/Takeso-user/blog-backend/pkg"
+	"github.com/Takeso-user/blog-backend/pkg/mocks"
+	"github.com/Takeso-user/blog-backend/pkg/webauthntest"
+	"github.com/gin-gonic/gin"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const webauthnOrigin = "https://blog.example.com"
+
+// newWebAuthnRouter serves the passkey endpoints for a single user kept in
+// memory behind the mocked repository. Authenticated routes act as user.
+func newWebAuthnRouter(t *testing.T, user *pkg.User) *gin.Engine {
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+
+	mockUserRepo := mocks.NewMockUserRepositoryInterface(ctrl)
+	mockUserRepo.EXPECT().GetUserByUsername(user.Username).DoAndReturn(func(string) (pkg.User, error) { return *user, nil }).AnyTimes()
+	mockUserRepo.EXPECT().GetUserByID(user.ID.Hex()).DoAndReturn(func(string) (pkg.User, error) { return *user, nil }).AnyTimes()
+	mockUserRepo.EXPECT().UpdateUser(user.ID, gomock.Any()).DoAndReturn(func(_ primitive.ObjectID, fields bson.M) (pkg.User, error) {
+		if credentials, ok := fields["webauthn_credentials"]; ok {
+			user.WebAuthnCredentials = credentials.([]pkg.WebAuthnCredential)
+		}
+		if codes, ok := fields["recovery_codes"]; ok {
+			user.RecoveryCodes = codes.([]string)
+		}
+		return *user, nil
+	}).AnyTimes()
+
+	userService := pkg.NewUserService(mockUserRepo, globalCache)
+	service, err := pkg.NewWebAuthnService(config.WebAuthnConfig{RPDisplayName: "Blog"}, webauthnOrigin, memoryTokens{}, userService)
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.Default()
+	handler := &pkg.Handler{
+		UserService:     userService,
+		MFAService:      pkg.NewMFAService(userService, nil, "Blog", time.Minute, nil),
+		WebAuthnService: service,
+	}
+	router.POST("/auth/login", handler.Login)
+	router.POST("/auth/webauthn/login/begin", handler.BeginWebAuthnLogin)
+	router.POST("/auth/webauthn/login/finish", handler.FinishWebAuthnLogin)
+	router.POST("/auth/mfa/webauthn/begin", handler.BeginWebAuthnMFA)
+	router.POST("/auth/mfa/webauthn/finish", handler.FinishWebAuthnMFA)
+	me := router.Group("/api/me").Use(func(c *gin.Context) { c.Set("username", user.Username) })
+	me.POST("/webauthn/register/begin", handler.BeginWebAuthnRegistration)
+	me.POST("/webauthn/register/finish", handler.FinishWebAuthnRegistration)
+	me.GET("/webauthn/credentials", handler.GetWebAuthnCredentials)
+	return router
+}
+
+type webauthnCeremony struct {
+	SessionToken string          `json:"session_token"`
+	Options      json.RawMessage `json:"options"`
+}
+
+func postJSON(router *gin.Engine, path string, body interface{}) *httptest.ResponseRecorder {
+	encoded, _ := json.Marshal(body)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", path, strings.NewReader(string(encoded)))
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func registerPasskey(t *testing.T, router *gin.Engine, authenticator *webauthntest.Authenticator, name string) *httptest.ResponseRecorder {
+	w := postJSON(router, "/api/me/webauthn/register/begin", gin.H{"name": name})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var ceremony webauthnCeremony
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &ceremony))
+
+	credential, err := authenticator.Create(ceremony.Options)
+	require.NoError(t, err)
+	w = postJSON(router, "/api/me/webauthn/register/finish", gin.H{"session_token": ceremony.SessionToken, "credential": json.RawMessage(credential)})
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	return w
+}
+
+func passkeyLogin(t *testing.T, router *gin.Engine, authenticator *webauthntest.Authenticator) *httptest.ResponseRecorder {
+	w := postJSON(router, "/auth/webauthn/login/begin", gin.H{})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var ceremony webauthnCeremony
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &ceremony))
+
+	assertion, err := authenticator.Get(ceremony.Options)
+	require.NoError(t, err)
+	return postJSON(router, "/auth/webauthn/login/finish", gin.H{"session_token": ceremony.SessionToken, "credential": json.RawMessage(assertion)})
+}
+
+func TestWebAuthn_RegisterAndPasswordlessLogin(t *testing.T) {
+	user := &pkg.User{ID: primitive.NewObjectID(), Username: "passkeyuser", Role: "Reader"}
+	router := newWebAuthnRouter(t, user)
+	authenticator := webauthntest.New(webauthnOrigin)
+
+	w := registerPasskey(t, router, authenticator, "Laptop")
+	assert.Contains(t, w.Body.String(), "recovery_codes", "first passkey comes with recovery codes")
+	registerPasskey(t, router, webauthntest.New(webauthnOrigin), "Phone")
+	require.Len(t, user.WebAuthnCredentials, 2)
+	assert.Len(t, user.RecoveryCodes, 10)
+
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/me/webauthn/credentials", nil)
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"Laptop"`)
+	assert.Contains(t, w.Body.String(), `"name":"Phone"`)
+	assert.NotContains(t, w.Body.String(), "public_key")
+
+	w = passkeyLogin(t, router, authenticator)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var result struct {
+		Token string `json:"token"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	claims, err := pkg.ParseJWT(result.Token)
+	require.NoError(t, err)
+	assert.Equal(t, "passkeyuser", claims.Username)
+	assert.True(t, claims.MFA)
+	assert.Equal(t, uint32(1), user.WebAuthnCredentials[0].SignCount)
+	assert.NotNil(t, user.WebAuthnCredentials[0].LastUsedAt)
+
+	authenticator.UserVerification = false
+	w = passkeyLogin(t, router, authenticator)
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "passwordless login requires user verification")
+}
+
+func TestWebAuthn_RejectsSignCountRegression(t *testing.T) {
+	user := &pkg.User{ID: primitive.NewObjectID(), Username: "clonedkey", Role: "Reader"}
+	router := newWebAuthnRouter(t, user)
+	authenticator := webauthntest.New(webauthnOrigin)
+	registerPasskey(t, router, authenticator, "Key")
+
+	authenticator.SetSignCount(4)
+	require.Equal(t, http.StatusOK, passkeyLogin(t, router, authenticator).Code)
+	require.Equal(t, uint32(5), user.WebAuthnCredentials[0].SignCount)
+
+	authenticator.SetSignCount(2)
+	w := passkeyLogin(t, router, authenticator)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, uint32(5), user.WebAuthnCredentials[0].SignCount, "stored counter must not move backwards")
+}
+
+func TestWebAuthn_SecondFactorAfterPassword(t *testing.T) {
+	hashedPassword, _ := pkg.HashPassword("password123")
+	user := &pkg.User{ID: primitive.NewObjectID(), Username: "passkey2fa", Password: hashedPassword, Role: "Author"}
+	router := newWebAuthnRouter(t, user)
+	authenticator := webauthntest.New(webauthnOrigin)
+	registerPasskey(t, router, authenticator, "Security key")
+
+	w := postJSON(router, "/auth/login", gin.H{"username": "passkey2fa", "password": "password123"})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var challenge struct {
+		MFAToken string   `json:"mfa_token"`
+		Methods  []string `json:"methods"`
+		Token    string   `json:"token"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &challenge))
+	assert.Empty(t, challenge.Token)
+	assert.Equal(t, []string{"webauthn"}, challenge.Methods)
+
+	w = postJSON(router, "/auth/mfa/webauthn/begin", gin.H{"mfa_token": challenge.MFAToken})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var ceremony webauthnCeremony
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &ceremony))
+	assertion, err := authenticator.Get(ceremony.Options)
+	require.NoError(t, err)
+
+	w = postJSON(router, "/auth/mfa/webauthn/finish", gin.H{"mfa_token": challenge.MFAToken, "session_token": ceremony.SessionToken, "credential": json.RawMessage(assertion)})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var result struct {
+		Token string `json:"token"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	claims, err := pkg.ParseJWT(result.Token)
+	require.NoError(t, err)
+	assert.True(t, claims.MFA)
+
+	// The ceremony session is single-use.
+	w = postJSON(router, "/auth/mfa/webauthn/finish", gin.H{"mfa_token": challenge.MFAToken, "session_token": ceremony.SessionToken, "credential": json.RawMessage(assertion)})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
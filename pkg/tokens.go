@@ -0,0 +1,88 @@
+package pkg
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const TokenPurposePasswordReset = "password_reset"
+
+type TokenRepository struct {
+	Collection *mongo.Collection
+}
+
+func NewTokenRepository(collection *mongo.Collection) *TokenRepository {
+	_, err := collection.Indexes().CreateOne(context.TODO(), mongo.IndexModel{
+		Keys:    bson.M{"expires_at": 1},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		log.Printf("Error creating token TTL index: %v", err)
+	}
+	return &TokenRepository{Collection: collection}
+}
+
+func (r *TokenRepository) CreateToken(token OneTimeToken) error {
+	log.Println("Creating token:", token.Purpose)
+	_, err := r.Collection.InsertOne(context.TODO(), token)
+	if err != nil {
+		log.Printf("Error creating token: %v", err)
+	}
+	return err
+}
+
+// ConsumeToken atomically marks an unused, unexpired token as used and
+// returns it, so that concurrent requests cannot redeem it twice.
+func (r *TokenRepository) ConsumeToken(purpose, hash string, now time.Time) (OneTimeToken, error) {
+	log.Println("Consuming token:", purpose)
+	var token OneTimeToken
+	err := r.Collection.FindOneAndUpdate(
+		context.TODO(),
+		bson.M{
+			"_id":        hash,
+			"purpose":    purpose,
+			"used_at":    bson.M{"$exists": false},
+			"expires_at": bson.M{"$gt": now},
+		},
+		bson.M{"$set": bson.M{"used_at": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&token)
+	if err != nil {
+		log.Printf("Error consuming token: %v", err)
+	}
+	return token, err
+}
+
+func (r *TokenRepository) DeleteUserTokens(userID, purpose string) error {
+	log.Println("Deleting tokens for user:", userID)
+	_, err := r.Collection.DeleteMany(context.TODO(), bson.M{"user_id": userID, "purpose": purpose})
+	if err != nil {
+		log.Printf("Error deleting tokens: %v", err)
+	}
+	return err
+}
+
+// newOpaqueToken returns a random URL-safe secret and the hash under which
+// it is stored.
+func newOpaqueToken() (string, string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	raw := base64.RawURLEncoding.EncodeToString(buf)
+	return raw, hashToken(raw), nil
+}
+
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,685 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Takeso-user/blog-backend/config"
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	TokenPurposeWebAuthnRegistration = "webauthn_registration"
+	TokenPurposeWebAuthnLogin        = "webauthn_login"
+
+	webauthnSessionTTL = 5 * time.Minute
+)
+
+var (
+	ErrCredentialCloned       = errors.New("authenticator sign count went backwards; the credential may be cloned")
+	ErrCredentialNotFound     = errors.New("credential not found")
+	ErrWebAuthnCeremonyFailed = errors.New("passkey verification failed")
+)
+
+// webauthnUser adapts User to the webauthn.User interface. The user handle
+// is the 12-byte ObjectID, which is stable and not personally identifying.
+type webauthnUser struct {
+	user User
+}
+
+func (u webauthnUser) WebAuthnID() []byte          { return u.user.ID[:] }
+func (u webauthnUser) WebAuthnName() string        { return u.user.Username }
+func (u webauthnUser) WebAuthnDisplayName() string { return u.user.Username }
+func (u webauthnUser) WebAuthnIcon() string        { return "" }
+
+func (u webauthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.user.WebAuthnCredentials))
+	for _, c := range u.user.WebAuthnCredentials {
+		transports := make([]protocol.AuthenticatorTransport, len(c.Transports))
+		for i, t := range c.Transports {
+			transports[i] = protocol.AuthenticatorTransport(t)
+		}
+		credentials = append(credentials, webauthn.Credential{
+			ID:              c.ID,
+			PublicKey:       c.PublicKey,
+			AttestationType: c.AttestationType,
+			Transport:       transports,
+			Flags:           webauthn.CredentialFlags{BackupEligible: c.BackupEligible, BackupState: c.BackupState},
+			Authenticator:   webauthn.Authenticator{AAGUID: c.AAGUID, SignCount: c.SignCount},
+		})
+	}
+	return credentials
+}
+
+// WebAuthnService registers passkeys and verifies assertions, both for
+// passwordless login and as a second factor after a password.
+type WebAuthnService struct {
+	WebAuthn    *webauthn.WebAuthn
+	Tokens      TokenRepositoryInterface
+	UserService *UserService
+}
+
+// NewWebAuthnService fills in the relying party ID and origin from
+// publicURL when they are not configured.
+func NewWebAuthnService(cfg config.WebAuthnConfig, publicURL string, tokens TokenRepositoryInterface, userService *UserService) (*WebAuthnService, error) {
+	u, err := url.Parse(publicURL)
+	if err != nil {
+		return nil, err
+	}
+	rpID := cfg.RPID
+	if rpID == "" {
+		rpID = u.Hostname()
+	}
+	origins := cfg.RPOrigins
+	if len(origins) == 0 {
+		origins = []string{u.Scheme + "://" + u.Host}
+	}
+	w, err := webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: cfg.RPDisplayName,
+		RPOrigins:     origins,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &WebAuthnService{WebAuthn: w, Tokens: tokens, UserService: userService}, nil
+}
+
+// saveSession stores the ceremony state server-side and returns the opaque
+// token the client sends back with its response.
+func (s *WebAuthnService) saveSession(purpose, userID string, session *webauthn.SessionData, data map[string]string) (string, error) {
+	encoded, err := json.Marshal(session)
+	if err != nil {
+		return "", err
+	}
+	raw, hash, err := newOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	if data == nil {
+		data = map[string]string{}
+	}
+	data["session"] = string(encoded)
+	now := time.Now()
+	err = s.Tokens.CreateToken(OneTimeToken{
+		Hash:      hash,
+		Purpose:   purpose,
+		UserID:    userID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(webauthnSessionTTL),
+		Data:      data,
+	})
+	return raw, err
+}
+
+func (s *WebAuthnService) loadSession(purpose, raw string) (webauthn.SessionData, OneTimeToken, error) {
+	var session webauthn.SessionData
+	token, err := s.Tokens.ConsumeToken(purpose, hashToken(raw), time.Now())
+	if err != nil {
+		return session, token, ErrInvalidToken
+	}
+	if err := json.Unmarshal([]byte(token.Data["session"]), &session); err != nil {
+		return session, token, ErrInvalidToken
+	}
+	return session, token, nil
+}
+
+func (s *WebAuthnService) BeginRegistration(user User, name string) (*protocol.CredentialCreation, string, error) {
+	existing := webauthnUser{user}.WebAuthnCredentials()
+	exclusions := make([]protocol.CredentialDescriptor, len(existing))
+	for i, c := range existing {
+		exclusions[i] = c.Descriptor()
+	}
+	options, session, err := s.WebAuthn.BeginRegistration(webauthnUser{user},
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred),
+	)
+	if err != nil {
+		return nil, "", err
+	}
+	token, err := s.saveSession(TokenPurposeWebAuthnRegistration, user.ID.Hex(), session, map[string]string{"name": name})
+	if err != nil {
+		return nil, "", err
+	}
+	return options, token, nil
+}
+
+// FinishRegistration verifies the attestation and stores the credential.
+// The first passkey of an account without recovery codes also gets a set,
+// since it may now be the user's only second factor.
+func (s *WebAuthnService) FinishRegistration(user User, sessionToken string, response []byte) (WebAuthnCredential, []string, error) {
+	session, token, err := s.loadSession(TokenPurposeWebAuthnRegistration, sessionToken)
+	if err != nil || token.UserID != user.ID.Hex() {
+		return WebAuthnCredential{}, nil, ErrInvalidToken
+	}
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader(response))
+	if err != nil {
+		log.Printf("Invalid WebAuthn registration response: %v", err)
+		return WebAuthnCredential{}, nil, ErrWebAuthnCeremonyFailed
+	}
+	credential, err := s.WebAuthn.CreateCredential(webauthnUser{user}, session, parsed)
+	if err != nil {
+		log.Printf("WebAuthn registration failed: %v", err)
+		return WebAuthnCredential{}, nil, ErrWebAuthnCeremonyFailed
+	}
+
+	transports := make([]string, len(credential.Transport))
+	for i, t := range credential.Transport {
+		transports[i] = string(t)
+	}
+	name := token.Data["name"]
+	if name == "" {
+		name = "Passkey " + time.Now().Format("2006-01-02")
+	}
+	stored := WebAuthnCredential{
+		ID:              credential.ID,
+		Name:            name,
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		Transports:      transports,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       credential.Authenticator.SignCount,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+		CreatedAt:       time.Now(),
+	}
+	update := bson.M{"webauthn_credentials": append(user.WebAuthnCredentials, stored)}
+	var codes []string
+	if len(user.RecoveryCodes) == 0 {
+		var hashes []string
+		codes, hashes, err = generateRecoveryCodes()
+		if err != nil {
+			return WebAuthnCredential{}, nil, err
+		}
+		update["recovery_codes"] = hashes
+	}
+	if _, err := s.UserService.UpdateUser(user.ID, update); err != nil {
+		return WebAuthnCredential{}, nil, err
+	}
+	return stored, codes, nil
+}
+
+// BeginLogin starts an assertion. With a user, only their credentials are
+// allowed; without one the browser offers any discoverable passkey.
+// Passwordless logins require user verification (PIN or biometrics) so that
+// the passkey alone counts as two factors.
+func (s *WebAuthnService) BeginLogin(user *User, passwordless bool) (*protocol.CredentialAssertion, string, error) {
+	verification := protocol.VerificationPreferred
+	if passwordless {
+		verification = protocol.VerificationRequired
+	}
+	var options *protocol.CredentialAssertion
+	var session *webauthn.SessionData
+	var err error
+	userID := ""
+	if user != nil && len(user.WebAuthnCredentials) > 0 {
+		userID = user.ID.Hex()
+		options, session, err = s.WebAuthn.BeginLogin(webauthnUser{*user}, webauthn.WithUserVerification(verification))
+	} else {
+		options, session, err = s.WebAuthn.BeginDiscoverableLogin(webauthn.WithUserVerification(verification))
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	token, err := s.saveSession(TokenPurposeWebAuthnLogin, userID, session, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	return options, token, nil
+}
+
+// FinishLogin verifies an assertion and returns the user it belongs to.
+// A sign count that does not increase is treated as a cloned
+// authenticator and rejected.
+func (s *WebAuthnService) FinishLogin(sessionToken string, response []byte) (User, error) {
+	session, token, err := s.loadSession(TokenPurposeWebAuthnLogin, sessionToken)
+	if err != nil {
+		return User{}, err
+	}
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader(response))
+	if err != nil {
+		log.Printf("Invalid WebAuthn assertion: %v", err)
+		return User{}, ErrWebAuthnCeremonyFailed
+	}
+
+	var user User
+	var credential *webauthn.Credential
+	if token.UserID != "" {
+		user, err = s.UserService.GetUserByID(token.UserID)
+		if err != nil {
+			return User{}, err
+		}
+		credential, err = s.WebAuthn.ValidateLogin(webauthnUser{user}, session, parsed)
+	} else {
+		credential, err = s.WebAuthn.ValidateDiscoverableLogin(func(_, userHandle []byte) (webauthn.User, error) {
+			if len(userHandle) != len(primitive.ObjectID{}) {
+				return nil, ErrCredentialNotFound
+			}
+			user, err = s.UserService.GetUserByID(primitive.ObjectID(userHandle).Hex())
+			if err != nil {
+				return nil, err
+			}
+			return webauthnUser{user}, nil
+		}, session, parsed)
+	}
+	if err != nil {
+		log.Printf("WebAuthn assertion failed: %v", err)
+		return User{}, ErrWebAuthnCeremonyFailed
+	}
+	if credential.Authenticator.CloneWarning {
+		log.Printf("Possible cloned authenticator for user %s", user.Username)
+		return User{}, ErrCredentialCloned
+	}
+
+	now := time.Now()
+	credentials := append([]WebAuthnCredential(nil), user.WebAuthnCredentials...)
+	for i := range credentials {
+		if bytes.Equal(credentials[i].ID, credential.ID) {
+			credentials[i].SignCount = credential.Authenticator.SignCount
+			credentials[i].BackupState = credential.Flags.BackupState
+			credentials[i].LastUsedAt = &now
+		}
+	}
+	return s.UserService.UpdateUser(user.ID, bson.M{"webauthn_credentials": credentials})
+}
+
+func (s *WebAuthnService) RenameCredential(user User, id []byte, name string) error {
+	credentials := append([]WebAuthnCredential(nil), user.WebAuthnCredentials...)
+	for i := range credentials {
+		if bytes.Equal(credentials[i].ID, id) {
+			credentials[i].Name = name
+			_, err := s.UserService.UpdateUser(user.ID, bson.M{"webauthn_credentials": credentials})
+			return err
+		}
+	}
+	return ErrCredentialNotFound
+}
+
+func (s *WebAuthnService) DeleteCredential(user User, id []byte) error {
+	credentials := make([]WebAuthnCredential, 0, len(user.WebAuthnCredentials))
+	for _, c := range user.WebAuthnCredentials {
+		if !bytes.Equal(c.ID, id) {
+			credentials = append(credentials, c)
+		}
+	}
+	if len(credentials) == len(user.WebAuthnCredentials) {
+		return ErrCredentialNotFound
+	}
+	_, err := s.UserService.UpdateUser(user.ID, bson.M{"webauthn_credentials": credentials})
+	return err
+}
+
+type webauthnCredentialView struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Transports []string   `json:"transports,omitempty"`
+	Synced     bool       `json:"synced"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+func newWebAuthnCredentialView(c WebAuthnCredential) webauthnCredentialView {
+	return webauthnCredentialView{
+		ID:         base64.RawURLEncoding.EncodeToString(c.ID),
+		Name:       c.Name,
+		Transports: c.Transports,
+		Synced:     c.BackupState,
+		CreatedAt:  c.CreatedAt,
+		LastUsedAt: c.LastUsedAt,
+	}
+}
+
+func webauthnErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrInvalidToken), errors.Is(err, ErrWebAuthnCeremonyFailed), errors.Is(err, ErrCredentialCloned):
+		return http.StatusUnauthorized
+	case errors.Is(err, ErrCredentialNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+type webauthnFinishInput struct {
+	SessionToken string          `json:"session_token" binding:"required"`
+	Credential   json.RawMessage `json:"credential" binding:"required"`
+}
+
+// BeginWebAuthnRegistration godoc
+//
+//	@Summary		Start passkey registration
+//	@Description	Return credential creation options for navigator.credentials.create()
+//	@Security		ApiKeyAuth
+//	@Tags			webauthn
+//	@Accept			json
+//	@Produce		json
+//	@Param			input	body		object{name=string}	false	"Name for the new passkey"
+//	@Success		200		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/api/me/webauthn/register/begin [post]
+func (h *Handler) BeginWebAuthnRegistration(c *gin.Context) {
+	var input struct {
+		Name string `json:"name" binding:"max=100"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	options, token, err := h.WebAuthnService.BeginRegistration(user, strings.TrimSpace(input.Name))
+	if err != nil {
+		log.Printf("Unable to start passkey registration: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to start passkey registration"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"session_token": token, "options": options})
+}
+
+// FinishWebAuthnRegistration godoc
+//
+//	@Summary		Finish passkey registration
+//	@Description	Verify the authenticator's attestation and save the passkey. Recovery codes are returned when the account had none.
+//	@Security		ApiKeyAuth
+//	@Tags			webauthn
+//	@Accept			json
+//	@Produce		json
+//	@Param			input	body		object{session_token=string,credential=object}	true	"Session token and navigator.credentials.create() result"
+//	@Success		201		{object}	Response
+//	@Failure		400		{object}	Response
+//	@Failure		401		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/api/me/webauthn/register/finish [post]
+func (h *Handler) FinishWebAuthnRegistration(c *gin.Context) {
+	var input webauthnFinishInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	credential, codes, err := h.WebAuthnService.FinishRegistration(user, input.SessionToken, input.Credential)
+	if err != nil {
+		log.Printf("Unable to register passkey: %v", err)
+		c.JSON(webauthnErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("Passkey registered for user %s", user.Username)
+	h.audit(c, AuditEvent{Action: AuditPasskeyRegister, TargetType: auditTargetPasskey, TargetID: base64.RawURLEncoding.EncodeToString(credential.ID)}, nil, newWebAuthnCredentialView(credential))
+	response := gin.H{"credential": newWebAuthnCredentialView(credential)}
+	if codes != nil {
+		response["recovery_codes"] = codes
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetWebAuthnCredentials godoc
+//
+//	@Summary		List passkeys
+//	@Description	List the current user's registered passkeys and security keys
+//	@Security		ApiKeyAuth
+//	@Tags			webauthn
+//	@Produce		json
+//	@Success		200	{array}		object
+//	@Failure		401	{object}	Response
+//	@Router			/api/me/webauthn/credentials [get]
+func (h *Handler) GetWebAuthnCredentials(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	views := make([]webauthnCredentialView, len(user.WebAuthnCredentials))
+	for i, credential := range user.WebAuthnCredentials {
+		views[i] = newWebAuthnCredentialView(credential)
+	}
+	c.JSON(http.StatusOK, views)
+}
+
+// RenameWebAuthnCredential godoc
+//
+//	@Summary		Rename a passkey
+//	@Security		ApiKeyAuth
+//	@Tags			webauthn
+//	@Accept			json
+//	@Produce		json
+//	@Param			id		path		string				true	"Credential ID (base64url)"
+//	@Param			input	body		object{name=string}	true	"New name"
+//	@Success		200		{object}	Response
+//	@Failure		400		{object}	Response
+//	@Failure		404		{object}	Response
+//	@Router			/api/me/webauthn/credentials/{id} [patch]
+func (h *Handler) RenameWebAuthnCredential(c *gin.Context) {
+	var input struct {
+		Name string `json:"name" binding:"required,max=100"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	id, err := base64.RawURLEncoding.DecodeString(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": ErrCredentialNotFound.Error()})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	if err := h.WebAuthnService.RenameCredential(user, id, strings.TrimSpace(input.Name)); err != nil {
+		c.JSON(webauthnErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Passkey renamed"})
+}
+
+// DeleteWebAuthnCredential godoc
+//
+//	@Summary		Remove a passkey
+//	@Security		ApiKeyAuth
+//	@Tags			webauthn
+//	@Produce		json
+//	@Param			id	path		string	true	"Credential ID (base64url)"
+//	@Success		200	{object}	Response
+//	@Failure		403	{object}	Response
+//	@Failure		404	{object}	Response
+//	@Router			/api/me/webauthn/credentials/{id} [delete]
+func (h *Handler) DeleteWebAuthnCredential(c *gin.Context) {
+	id, err := base64.RawURLEncoding.DecodeString(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": ErrCredentialNotFound.Error()})
+		return
+	}
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+	lastFactor := !user.TOTPEnabled && len(user.WebAuthnCredentials) == 1
+	if lastFactor && h.MFAService != nil && h.MFAService.RoleRequiresMFA(user.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is required for your role"})
+		return
+	}
+	if err := h.WebAuthnService.DeleteCredential(user, id); err != nil {
+		c.JSON(webauthnErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	h.audit(c, AuditEvent{Action: AuditPasskeyDelete, TargetType: auditTargetPasskey, TargetID: c.Param("id")}, nil, nil)
+	c.JSON(http.StatusOK, gin.H{"message": "Passkey removed"})
+}
+
+// BeginWebAuthnLogin godoc
+//
+//	@Summary		Start a passkey login
+//	@Description	Return assertion options for a passwordless login. Without a username any discoverable passkey can be used.
+//	@Tags			webauthn
+//	@Accept			json
+//	@Produce		json
+//	@Param			input	body		object{username=string}	false	"Optional username"
+//	@Success		200		{object}	Response
+//	@Failure		500		{object}	Response
+//	@Router			/auth/webauthn/login/begin [post]
+func (h *Handler) BeginWebAuthnLogin(c *gin.Context) {
+	var input struct {
+		Username string `json:"username"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	// Unknown usernames get discoverable options rather than an error so
+	// that the endpoint does not reveal which accounts exist.
+	var user *User
+	if input.Username != "" {
+		if found, err := h.UserService.GetUserByUsername(input.Username); err == nil {
+			user = &found
+		}
+	}
+	options, token, err := h.WebAuthnService.BeginLogin(user, true)
+	if err != nil {
+		log.Printf("Unable to start passkey login: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to start passkey login"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"session_token": token, "options": options})
+}
+
+// FinishWebAuthnLogin godoc
+//
+//	@Summary		Finish a passkey login
+//	@Description	Verify the passkey assertion and return a JWT
+//	@Tags			webauthn
+//	@Accept			json
+//	@Produce		json
+//	@Param			input	body		object{session_token=string,credential=object}	true	"Session token and navigator.credentials.get() result"
+//	@Success		200		{object}	Response
+//	@Failure		400		{object}	Response
+//	@Failure		401		{object}	Response
+//	@Router			/auth/webauthn/login/finish [post]
+func (h *Handler) FinishWebAuthnLogin(c *gin.Context) {
+	var input webauthnFinishInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, err := h.WebAuthnService.FinishLogin(input.SessionToken, input.Credential)
+	if err != nil {
+		log.Printf("Passkey login failed: %v", err)
+		c.JSON(webauthnErrorStatus(err), gin.H{"error": "Passkey verification failed"})
+		return
+	}
+	if h.restrictedLogin(c, user) {
+		return
+	}
+	// A user-verifying passkey is both possession and knowledge or
+	// biometrics, so the session counts as multi-factor.
+	token, err := h.issueToken(c, user, true)
+	if err != nil {
+		log.Printf("Failed to generate token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	h.auditLogin(c, user, true)
+	log.Println("User logged in successfully with a passkey")
+	c.JSON(http.StatusOK, gin.H{"token": token})
+}
+
+// BeginWebAuthnMFA godoc
+//
+//	@Summary		Start a passkey second factor
+//	@Description	Return assertion options for the user identified by an MFA challenge token
+//	@Tags			webauthn
+//	@Accept			json
+//	@Produce		json
+//	@Param			input	body		object{mfa_token=string}	true	"MFA challenge token"
+//	@Success		200		{object}	Response
+//	@Failure		400		{object}	Response
+//	@Failure		401		{object}	Response
+//	@Router			/auth/mfa/webauthn/begin [post]
+func (h *Handler) BeginWebAuthnMFA(c *gin.Context) {
+	var input struct {
+		MFAToken string `json:"mfa_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	user, ok := h.challengedUser(c, input.MFAToken)
+	if !ok {
+		return
+	}
+	if len(user.WebAuthnCredentials) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No passkeys registered"})
+		return
+	}
+	options, token, err := h.WebAuthnService.BeginLogin(&user, false)
+	if err != nil {
+		log.Printf("Unable to start passkey verification: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to start passkey verification"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"session_token": token, "options": options})
+}
+
+// FinishWebAuthnMFA godoc
+//
+//	@Summary		Finish a passkey second factor
+//	@Description	Verify the passkey assertion for an MFA challenge and return a JWT
+//	@Tags			webauthn
+//	@Accept			json
+//	@Produce		json
+//	@Param			input	body		object{mfa_token=string,session_token=string,credential=object}	true	"Challenge, session token and navigator.credentials.get() result"
+//	@Success		200		{object}	Response
+//	@Failure		400		{object}	Response
+//	@Failure		401		{object}	Response
+//	@Router			/auth/mfa/webauthn/finish [post]
+func (h *Handler) FinishWebAuthnMFA(c *gin.Context) {
+	var input struct {
+		MFAToken string `json:"mfa_token" binding:"required"`
+		webauthnFinishInput
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	challenged, ok := h.challengedUser(c, input.MFAToken)
+	if !ok {
+		return
+	}
+	user, err := h.WebAuthnService.FinishLogin(input.SessionToken, input.Credential)
+	if err == nil && user.ID != challenged.ID {
+		err = ErrWebAuthnCeremonyFailed
+	}
+	if err != nil {
+		log.Printf("Passkey verification failed: %v", err)
+		h.recordLoginFailure(c, challenged.Username)
+		c.JSON(webauthnErrorStatus(err), gin.H{"error": "Passkey verification failed"})
+		return
+	}
+	token, err := h.issueToken(c, user, true)
+	if err != nil {
+		log.Printf("Failed to generate token: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	h.auditLogin(c, user, true)
+	log.Println("User logged in successfully with MFA")
+	c.JSON(http.StatusOK, gin.H{"token": token})
+}
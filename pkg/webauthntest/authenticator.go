@@ -0,0 +1,247 @@
+// Package webauthntest provides a software WebAuthn authenticator for tests.
+// It creates ES256 (P-256) credentials with "none" attestation and answers
+// assertion requests the way a browser's navigator.credentials would.
+package webauthntest
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+)
+
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+)
+
+// ErrNoCredential is returned by Get when no stored credential matches the
+// request.
+var ErrNoCredential = errors.New("webauthntest: no matching credential")
+
+type credential struct {
+	id         []byte
+	key        *ecdsa.PrivateKey
+	rpID       string
+	userHandle []byte
+	signCount  uint32
+}
+
+// Authenticator holds credentials in memory. Origin is reported in the
+// client data; UserVerification controls the UV flag, as if the user had
+// entered a PIN or used biometrics.
+type Authenticator struct {
+	Origin           string
+	UserVerification bool
+
+	mu          sync.Mutex
+	credentials []*credential
+}
+
+func New(origin string) *Authenticator {
+	return &Authenticator{Origin: origin, UserVerification: true}
+}
+
+type creationOptions struct {
+	PublicKey struct {
+		Challenge string `json:"challenge"`
+		RP        struct {
+			ID string `json:"id"`
+		} `json:"rp"`
+		User struct {
+			ID string `json:"id"`
+		} `json:"user"`
+	} `json:"publicKey"`
+}
+
+type assertionOptions struct {
+	PublicKey struct {
+		Challenge        string `json:"challenge"`
+		RPID             string `json:"rpId"`
+		AllowCredentials []struct {
+			ID string `json:"id"`
+		} `json:"allowCredentials"`
+	} `json:"publicKey"`
+}
+
+// Create answers navigator.credentials.create() for the given options JSON
+// and returns the PublicKeyCredential JSON to send to the server.
+func (a *Authenticator) Create(options []byte) ([]byte, error) {
+	var opts creationOptions
+	if err := json.Unmarshal(options, &opts); err != nil {
+		return nil, err
+	}
+	userHandle, err := decode(opts.PublicKey.User.ID)
+	if err != nil {
+		return nil, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	cred := &credential{id: id, key: key, rpID: opts.PublicKey.RP.ID, userHandle: userHandle}
+
+	publicKey, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  1, // P-256
+		XCoord: key.PublicKey.X.FillBytes(make([]byte, 32)),
+		YCoord: key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	authData := a.authData(cred, flagAttestedData)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(id)))
+	authData = append(authData, id...)
+	authData = append(authData, publicKey...)
+
+	attestation, err := webauthncbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": authData,
+	})
+	if err != nil {
+		return nil, err
+	}
+	clientData, err := a.clientData("webauthn.create", opts.PublicKey.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	a.mu.Lock()
+	a.credentials = append(a.credentials, cred)
+	a.mu.Unlock()
+
+	return json.Marshal(map[string]interface{}{
+		"id":    encode(id),
+		"rawId": encode(id),
+		"type":  "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    encode(clientData),
+			"attestationObject": encode(attestation),
+			"transports":        []string{"internal"},
+		},
+	})
+}
+
+// Get answers navigator.credentials.get() for the given options JSON. With
+// an empty allow list it uses the most recent credential for the RP, like a
+// discoverable passkey.
+func (a *Authenticator) Get(options []byte) ([]byte, error) {
+	var opts assertionOptions
+	if err := json.Unmarshal(options, &opts); err != nil {
+		return nil, err
+	}
+	allowed := make([][]byte, 0, len(opts.PublicKey.AllowCredentials))
+	for _, c := range opts.PublicKey.AllowCredentials {
+		id, err := decode(c.ID)
+		if err != nil {
+			return nil, err
+		}
+		allowed = append(allowed, id)
+	}
+
+	a.mu.Lock()
+	var cred *credential
+	for i := len(a.credentials) - 1; i >= 0 && cred == nil; i-- {
+		c := a.credentials[i]
+		if c.rpID != opts.PublicKey.RPID {
+			continue
+		}
+		if len(allowed) == 0 {
+			cred = c
+		}
+		for _, id := range allowed {
+			if bytes.Equal(id, c.id) {
+				cred = c
+			}
+		}
+	}
+	if cred == nil {
+		a.mu.Unlock()
+		return nil, ErrNoCredential
+	}
+	cred.signCount++
+	authData := a.authData(cred, 0)
+	a.mu.Unlock()
+
+	clientData, err := a.clientData("webauthn.get", opts.PublicKey.Challenge)
+	if err != nil {
+		return nil, err
+	}
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, cred.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"id":    encode(cred.id),
+		"rawId": encode(cred.id),
+		"type":  "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    encode(clientData),
+			"authenticatorData": encode(authData),
+			"signature":         encode(signature),
+			"userHandle":        encode(cred.userHandle),
+		},
+	})
+}
+
+// SetSignCount overwrites the signature counter of every credential, for
+// example to simulate a cloned authenticator.
+func (a *Authenticator) SetSignCount(count uint32) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, c := range a.credentials {
+		c.signCount = count
+	}
+}
+
+// authData returns the fixed part of the authenticator data: RP ID hash,
+// flags and signature counter.
+func (a *Authenticator) authData(cred *credential, flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(cred.rpID))
+	flags |= flagUserPresent
+	if a.UserVerification {
+		flags |= flagUserVerified
+	}
+	data := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(data, cred.signCount)
+}
+
+func (a *Authenticator) clientData(ceremony, challenge string) ([]byte, error) {
+	return json.Marshal(map[string]string{
+		"type":      ceremony,
+		"challenge": challenge,
+		"origin":    a.Origin,
+	})
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
@@ -0,0 +1,494 @@
+package pkg
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"io"
+	"sort"
+)
+
+// The WebP encoder below writes lossless (VP8L) images in pure Go. It
+// applies the subtract-green and predictor transforms and entropy codes the
+// residuals with a single group of prefix codes, leaving out backward
+// references and the color cache. Files come out larger than libwebp's, but
+// any WebP decoder reads them.
+
+const (
+	vp8lSignature          = 0x2f
+	vp8lMaxDimension       = 1 << 14
+	vp8lPredictorBits      = 4
+	vp8lMaxCodeLength      = 15
+	vp8lMaxCodeLengthCode  = 7
+	vp8lGreenAlphabetSize  = 256 + 24
+	vp8lDistanceAlphabet   = 40
+	vp8lNumCodeLengthCodes = 19
+)
+
+var vp8lCodeLengthOrder = [vp8lNumCodeLengthCodes]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+var ErrWebPTooLarge = errors.New("image is too large for WebP")
+
+// EncodeWebP writes img to w as a lossless WebP image.
+func EncodeWebP(w io.Writer, img image.Image) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width < 1 || height < 1 || width > vp8lMaxDimension || height > vp8lMaxDimension {
+		return ErrWebPTooLarge
+	}
+	nrgba, ok := img.(*image.NRGBA)
+	if !ok || nrgba.Rect.Min != (image.Point{}) {
+		nrgba = image.NewNRGBA(image.Rect(0, 0, width, height))
+		draw.Draw(nrgba, nrgba.Rect, img, bounds.Min, draw.Src)
+	}
+
+	pixels := make([]uint32, width*height)
+	alphaUsed := false
+	for y := 0; y < height; y++ {
+		row := nrgba.Pix[y*nrgba.Stride : y*nrgba.Stride+width*4]
+		for x := 0; x < width; x++ {
+			r, g, b, a := uint32(row[x*4]), uint32(row[x*4+1]), uint32(row[x*4+2]), uint32(row[x*4+3])
+			if a != 0xff {
+				alphaUsed = true
+			}
+			// Subtract green: red and blue are stored relative to green.
+			pixels[y*width+x] = a<<24 | ((r-g)&0xff)<<16 | g<<8 | (b-g)&0xff
+		}
+	}
+	modes, residuals := vp8lPredict(pixels, width, height)
+
+	bw := &bitWriter{}
+	bw.write(vp8lSignature, 8)
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	if alphaUsed {
+		bw.write(1, 1)
+	} else {
+		bw.write(0, 1)
+	}
+	bw.write(0, 3) // version
+
+	// Transforms are listed in the order they were applied; the decoder
+	// undoes them in reverse.
+	bw.write(1, 1)
+	bw.write(2, 2) // subtract green
+	bw.write(1, 1)
+	bw.write(0, 2) // predictor
+	bw.write(vp8lPredictorBits-2, 3)
+	vp8lWriteImage(bw, modes, false)
+	bw.write(0, 1)
+	vp8lWriteImage(bw, residuals, true)
+	data := bw.bytes()
+
+	pad := len(data) & 1
+	header := make([]byte, 20)
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(4+8+len(data)+pad))
+	copy(header[8:], "WEBPVP8L")
+	binary.LittleEndian.PutUint32(header[16:], uint32(len(data)))
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if pad == 1 {
+		data = append(data, 0)
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// vp8lPredict picks a predictor mode for each tile of the image and returns
+// the tile modes as an image along with the prediction residuals.
+func vp8lPredict(pixels []uint32, width, height int) ([]uint32, []uint32) {
+	tileSize := 1 << vp8lPredictorBits
+	tilesX := (width + tileSize - 1) >> vp8lPredictorBits
+	tilesY := (height + tileSize - 1) >> vp8lPredictorBits
+	modes := make([]uint32, tilesX*tilesY)
+	residuals := make([]uint32, len(pixels))
+
+	for ty := 0; ty < tilesY; ty++ {
+		for tx := 0; tx < tilesX; tx++ {
+			x0, y0 := tx*tileSize, ty*tileSize
+			x1, y1 := min(x0+tileSize, width), min(y0+tileSize, height)
+			best, bestCost := 0, -1
+			for mode := 0; mode < 14; mode++ {
+				cost := 0
+				for y := y0; y < y1 && (bestCost < 0 || cost < bestCost); y++ {
+					for x := x0; x < x1; x++ {
+						i := y*width + x
+						cost += residualCost(subPixels(pixels[i], vp8lPrediction(pixels, i, x, y, width, mode)))
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+			modes[ty*tilesX+tx] = 0xff000000 | uint32(best)<<8
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					i := y*width + x
+					residuals[i] = subPixels(pixels[i], vp8lPrediction(pixels, i, x, y, width, best))
+				}
+			}
+		}
+	}
+	return modes, residuals
+}
+
+// vp8lPrediction predicts pixel i at (x, y) from its decoded neighbours.
+// The top row and left column use fixed predictors whatever the mode.
+func vp8lPrediction(pixels []uint32, i, x, y, width, mode int) uint32 {
+	switch {
+	case x == 0 && y == 0:
+		return 0xff000000
+	case y == 0:
+		return pixels[i-1]
+	case x == 0:
+		return pixels[i-width]
+	}
+	// On the rightmost column the top-right neighbour wraps around to the
+	// leftmost pixel of the current row, as the format specifies.
+	l, t, tl, tr := pixels[i-1], pixels[i-width], pixels[i-width-1], pixels[i-width+1]
+	switch mode {
+	case 0:
+		return 0xff000000
+	case 1:
+		return l
+	case 2:
+		return t
+	case 3:
+		return tr
+	case 4:
+		return tl
+	case 5:
+		return average2(average2(l, tr), t)
+	case 6:
+		return average2(l, tl)
+	case 7:
+		return average2(l, t)
+	case 8:
+		return average2(tl, t)
+	case 9:
+		return average2(t, tr)
+	case 10:
+		return average2(average2(l, tl), average2(t, tr))
+	case 11:
+		return selectPrediction(l, t, tl)
+	case 12:
+		return perChannel(func(c int) int { return channel(l, c) + channel(t, c) - channel(tl, c) })
+	default:
+		a := average2(l, t)
+		return perChannel(func(c int) int { return channel(a, c) + (channel(a, c)-channel(tl, c))/2 })
+	}
+}
+
+func channel(p uint32, shift int) int {
+	return int(p >> shift & 0xff)
+}
+
+// perChannel builds a pixel from f applied to each channel, clamped to a
+// byte.
+func perChannel(f func(shift int) int) uint32 {
+	var p uint32
+	for shift := 0; shift < 32; shift += 8 {
+		p |= uint32(min(max(f(shift), 0), 255)) << shift
+	}
+	return p
+}
+
+func average2(a, b uint32) uint32 {
+	return (((a ^ b) & 0xfefefefe) >> 1) + (a & b)
+}
+
+func selectPrediction(l, t, tl uint32) uint32 {
+	distanceL, distanceT := 0, 0
+	for shift := 0; shift < 32; shift += 8 {
+		distanceL += abs(channel(t, shift) - channel(tl, shift))
+		distanceT += abs(channel(l, shift) - channel(tl, shift))
+	}
+	if distanceL < distanceT {
+		return l
+	}
+	return t
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// subPixels subtracts b from a channel by channel, modulo 256.
+func subPixels(a, b uint32) uint32 {
+	var p uint32
+	for shift := 0; shift < 32; shift += 8 {
+		p |= ((a>>shift - b>>shift) & 0xff) << shift
+	}
+	return p
+}
+
+// residualCost estimates how well a residual compresses: small values,
+// positive or negative, are cheap.
+func residualCost(p uint32) int {
+	cost := 0
+	for shift := 0; shift < 32; shift += 8 {
+		v := channel(p, shift)
+		cost += min(v, 256-v)
+	}
+	return cost
+}
+
+// vp8lWriteImage entropy codes pixels as ARGB literals with one group of
+// prefix codes. Only the main image carries the meta prefix code bit.
+func vp8lWriteImage(bw *bitWriter, pixels []uint32, main bool) {
+	bw.write(0, 1) // no color cache
+	if main {
+		bw.write(0, 1) // no meta prefix codes
+	}
+	green := make([]int, vp8lGreenAlphabetSize)
+	red := make([]int, 256)
+	blue := make([]int, 256)
+	alpha := make([]int, 256)
+	for _, p := range pixels {
+		green[p>>8&0xff]++
+		red[p>>16&0xff]++
+		blue[p&0xff]++
+		alpha[p>>24]++
+	}
+	greenCode := writePrefixCode(bw, green)
+	redCode := writePrefixCode(bw, red)
+	blueCode := writePrefixCode(bw, blue)
+	alphaCode := writePrefixCode(bw, alpha)
+	writePrefixCode(bw, make([]int, vp8lDistanceAlphabet))
+	for _, p := range pixels {
+		greenCode.write(bw, int(p>>8&0xff))
+		redCode.write(bw, int(p>>16&0xff))
+		blueCode.write(bw, int(p&0xff))
+		alphaCode.write(bw, int(p>>24))
+	}
+}
+
+type prefixCode struct {
+	lengths []uint8
+	codes   []uint32
+}
+
+// write emits the code for symbol. A code with a single symbol takes no
+// bits.
+func (c prefixCode) write(bw *bitWriter, symbol int) {
+	if c.lengths == nil {
+		return
+	}
+	bw.write(c.codes[symbol], uint(c.lengths[symbol]))
+}
+
+// writePrefixCode writes a prefix code for the symbol counts and returns it.
+// Alphabets using at most one symbol get the simple single-symbol code.
+func writePrefixCode(bw *bitWriter, counts []int) prefixCode {
+	used, symbol := 0, 0
+	for s, n := range counts {
+		if n > 0 {
+			used++
+			symbol = s
+		}
+	}
+	if used <= 1 {
+		bw.write(1, 1) // simple code
+		bw.write(0, 1) // one symbol
+		if symbol < 2 {
+			bw.write(0, 1)
+			bw.write(uint32(symbol), 1)
+		} else {
+			bw.write(1, 1)
+			bw.write(uint32(symbol), 8)
+		}
+		return prefixCode{}
+	}
+	lengths := huffmanLengths(counts, vp8lMaxCodeLength)
+	bw.write(0, 1) // normal code
+	writeCodeLengths(bw, lengths)
+	return prefixCode{lengths: lengths, codes: canonicalCodes(lengths)}
+}
+
+// writeCodeLengths writes the code lengths of a normal prefix code, coding
+// runs of zeros with the repeat symbols 17 and 18.
+func writeCodeLengths(bw *bitWriter, lengths []uint8) {
+	type token struct {
+		symbol    int
+		extra     uint32
+		extraBits uint
+	}
+	var tokens []token
+	counts := make([]int, vp8lNumCodeLengthCodes)
+	for i := 0; i < len(lengths); {
+		if lengths[i] != 0 {
+			tokens = append(tokens, token{symbol: int(lengths[i])})
+			counts[lengths[i]]++
+			i++
+			continue
+		}
+		run := 1
+		for i+run < len(lengths) && lengths[i+run] == 0 && run < 138 {
+			run++
+		}
+		switch {
+		case run >= 11:
+			tokens = append(tokens, token{symbol: 18, extra: uint32(run - 11), extraBits: 7})
+			counts[18]++
+		case run >= 3:
+			tokens = append(tokens, token{symbol: 17, extra: uint32(run - 3), extraBits: 3})
+			counts[17]++
+		default:
+			for j := 0; j < run; j++ {
+				tokens = append(tokens, token{symbol: 0})
+			}
+			counts[0] += run
+		}
+		i += run
+	}
+
+	code := prefixCode{lengths: huffmanLengths(counts, vp8lMaxCodeLengthCode)}
+	used := 0
+	for _, n := range counts {
+		if n > 0 {
+			used++
+		}
+	}
+	numCodes := vp8lNumCodeLengthCodes
+	for numCodes > 4 && code.lengths[vp8lCodeLengthOrder[numCodes-1]] == 0 {
+		numCodes--
+	}
+	bw.write(uint32(numCodes-4), 4)
+	for _, symbol := range vp8lCodeLengthOrder[:numCodes] {
+		bw.write(uint32(code.lengths[symbol]), 3)
+	}
+	bw.write(0, 1) // code lengths for the whole alphabet follow
+	if used > 1 {
+		code.codes = canonicalCodes(code.lengths)
+	} else {
+		code.lengths = nil
+	}
+	for _, t := range tokens {
+		code.write(bw, t.symbol)
+		if t.extraBits > 0 {
+			bw.write(t.extra, t.extraBits)
+		}
+	}
+}
+
+// huffmanLengths returns Huffman code lengths of at most limit bits for the
+// symbol counts. Symbols that do not occur get no code. When the optimal
+// code is too deep, counts are flattened until it fits.
+func huffmanLengths(counts []int, limit int) []uint8 {
+	type node struct {
+		weight, parent int
+	}
+	var symbols []int
+	for s, n := range counts {
+		if n > 0 {
+			symbols = append(symbols, s)
+		}
+	}
+	lengths := make([]uint8, len(counts))
+	if len(symbols) == 1 {
+		lengths[symbols[0]] = 1
+		return lengths
+	}
+	for bias := 0; ; bias = max(1, bias*2) {
+		nodes := make([]node, 0, 2*len(symbols))
+		for _, s := range symbols {
+			nodes = append(nodes, node{weight: counts[s] + bias, parent: -1})
+		}
+		leaves := make([]int, len(symbols))
+		for i := range leaves {
+			leaves[i] = i
+		}
+		sort.SliceStable(leaves, func(a, b int) bool { return nodes[leaves[a]].weight < nodes[leaves[b]].weight })
+
+		// Two queues: sorted leaves and internal nodes, which are created
+		// in order of weight.
+		nextLeaf, nextInternal := 0, len(symbols)
+		smallest := func() int {
+			if nextLeaf < len(leaves) && (nextInternal >= len(nodes) || nodes[leaves[nextLeaf]].weight <= nodes[nextInternal].weight) {
+				nextLeaf++
+				return leaves[nextLeaf-1]
+			}
+			nextInternal++
+			return nextInternal - 1
+		}
+		for i := 1; i < len(symbols); i++ {
+			a, b := smallest(), smallest()
+			nodes = append(nodes, node{weight: nodes[a].weight + nodes[b].weight, parent: -1})
+			nodes[a].parent, nodes[b].parent = len(nodes)-1, len(nodes)-1
+		}
+
+		deepest := 0
+		for i, s := range symbols {
+			depth := 0
+			for n := i; nodes[n].parent >= 0; n = nodes[n].parent {
+				depth++
+			}
+			lengths[s] = uint8(depth)
+			deepest = max(deepest, depth)
+		}
+		if deepest <= limit {
+			return lengths
+		}
+	}
+}
+
+// canonicalCodes assigns canonical codes to the lengths, bit-reversed since
+// the bitstream is written least significant bit first.
+func canonicalCodes(lengths []uint8) []uint32 {
+	var count, next [vp8lMaxCodeLength + 1]uint32
+	for _, l := range lengths {
+		if l > 0 {
+			count[l]++
+		}
+	}
+	code := uint32(0)
+	for bits := 1; bits <= vp8lMaxCodeLength; bits++ {
+		code = (code + count[bits-1]) << 1
+		next[bits] = code
+	}
+	codes := make([]uint32, len(lengths))
+	for s, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		c := next[l]
+		next[l]++
+		var reversed uint32
+		for i := uint8(0); i < l; i++ {
+			reversed = reversed<<1 | c>>i&1
+		}
+		codes[s] = reversed
+	}
+	return codes
+}
+
+// bitWriter packs values least significant bit first.
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits uint
+}
+
+func (b *bitWriter) write(v uint32, n uint) {
+	b.acc |= uint64(v) << b.nbits
+	b.nbits += n
+	for b.nbits >= 8 {
+		b.buf = append(b.buf, byte(b.acc))
+		b.acc >>= 8
+		b.nbits -= 8
+	}
+}
+
+func (b *bitWriter) bytes() []byte {
+	if b.nbits > 0 {
+		b.buf = append(b.buf, byte(b.acc))
+		b.acc, b.nbits = 0, 0
+	}
+	return b.buf
+}